@@ -9,7 +9,10 @@ import (
 	"github.com/base-org/blob-archiver/api/metrics"
 	"github.com/base-org/blob-archiver/api/service"
 	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
 	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/remote"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 	"github.com/ethereum-optimism/optimism/op-service/cliapp"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
@@ -55,7 +58,7 @@ func Main() cliapp.LifecycleAction {
 
 		m := metrics.NewMetrics()
 
-		storageClient, err := storage.NewStorage(cfg.StorageConfig, l)
+		storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize storage: %w", err)
 		}
@@ -65,8 +68,44 @@ func Main() cliapp.LifecycleAction {
 			return nil, fmt.Errorf("failed to initialize beacon client: %w", err)
 		}
 
+		// Blobs and slots are looked up in the indexes of the archive itself, the blocks are then read through any fallbacks
+		archive := storageClient
+
+		if cfg.UpstreamArchiver != "" {
+			// The format is valid once the config is checked
+			format, _ := blobformat.Parse(cfg.UpstreamArchiverFormat)
+
+			// The upstream archiver is asked first, as it has blobs that the beacon node may have pruned
+			l.Info("Serving missing blobs from upstream archiver", "url", cfg.UpstreamArchiver, "format", format)
+			upstream := blobclient.NewBlobSidecarClient(cfg.UpstreamArchiver, blobclient.WithLogger(l.New("component", "upstream-client")))
+			storageClient = remote.NewRemoteArchiverStorage(storageClient, upstream, format, l.New("component", "upstream-archiver"))
+		}
+
+		if cfg.ReadThrough {
+			l.Info("Serving missing blobs from the beacon node", "concurrency", cfg.ReadThroughConcurrency)
+			storageClient = storage.NewReadThroughStorage(storageClient, beaconClient, cfg.ReadThroughConcurrency, l.New("component", "read-through"))
+		}
+
+		if cfg.CacheConfig.Enabled() {
+			l.Info("Caching blobs in memory", "size", cfg.CacheConfig.Size, "maxBytes", cfg.CacheConfig.MaxBytes, "ttl", cfg.CacheConfig.TTL, "staleWindow", cfg.CacheConfig.StaleWindow)
+			storageClient = storage.NewCachingStorage(storageClient, cfg.CacheConfig, m, l.New("component", "cache"))
+		}
+
+		var opts []service.APIOption
+		if cfg.CORSConfig.Enabled() {
+			l.Info("Serving CORS headers", "origins", cfg.CORSConfig.AllowedOrigins, "methods", cfg.CORSConfig.AllowedMethods, "headers", cfg.CORSConfig.AllowedHeaders)
+			opts = append(opts, service.WithCORS(cfg.CORSConfig))
+		}
+
+		if cfg.AuthConfig.Enabled() {
+			l.Info("Authenticating and rate limiting requests", "apiKeys", len(cfg.AuthConfig.APIKeys), "rateLimit", cfg.AuthConfig.RateLimit, "burst", cfg.AuthConfig.RateLimitBurst, "trustProxyHeaders", cfg.AuthConfig.TrustProxyHeaders)
+			opts = append(opts, service.WithAuth(cfg.AuthConfig))
+		}
+
+		opts = append(opts, service.WithBlobIndex(archive), service.WithInventory(archive))
+
 		l.Info("Initializing API Service")
-		api := service.NewAPI(storageClient, beaconClient, m, l)
+		api := service.NewAPI(storageClient, beaconClient, m, l.New("component", "api"), opts...)
 		return service.NewService(l, api, cfg, m.Registry()), nil
 	}
 }
@@ -2,8 +2,11 @@ package flags
 
 import (
 	"fmt"
+	"net/url"
 
+	"github.com/base-org/blob-archiver/common/blobformat"
 	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/urfave/cli/v2"
@@ -16,6 +19,101 @@ type APIConfig struct {
 	StorageConfig common.StorageConfig
 
 	ListenAddr string
+
+	ReadThrough            bool
+	ReadThroughConcurrency int
+
+	// UpstreamArchiver is the URL of the blob API that blobs missing from storage are fetched from, if set
+	UpstreamArchiver string
+	// UpstreamArchiverFormat is the format blobs are requested from the upstream archiver in, see blobformat.Parse
+	UpstreamArchiverFormat string
+
+	// CacheConfig configures the in-memory cache in front of storage, which is disabled if neither the size nor the
+	// maximum bytes are set
+	CacheConfig storage.CacheConfig
+
+	// CORSConfig configures the CORS headers served to web apps on other origins, which are not served if no origins
+	// are allowed
+	CORSConfig CORSConfig
+
+	// AuthConfig configures the API keys and per-client rate limits of requests, which are not checked by default
+	AuthConfig AuthConfig
+}
+
+// AuthConfig configures the authentication and rate limiting of requests to the API.
+type AuthConfig struct {
+	// APIKeys are the keys that clients must send, as a bearer token or in the X-API-Key header. Requests are not
+	// authenticated if there are none
+	APIKeys []string
+	// RateLimit is the number of requests per second allowed for each client, which is identified by its API key, or
+	// its IP address if keys are not required. Zero disables rate limiting
+	RateLimit float64
+	// RateLimitBurst is the number of requests a client can make at once before it is limited to RateLimit
+	RateLimitBurst int
+	// TrustProxyHeaders identifies clients by the last address of the X-Forwarded-For header, or the X-Real-IP header,
+	// rather than the address of the connection, for an API behind a reverse proxy or load balancer that sets them
+	TrustProxyHeaders bool
+}
+
+// Enabled returns whether requests are authenticated or rate limited.
+func (c AuthConfig) Enabled() bool {
+	return len(c.APIKeys) > 0 || c.RateLimit > 0
+}
+
+func (c AuthConfig) Check() error {
+	for _, key := range c.APIKeys {
+		if key == "" {
+			return fmt.Errorf("api keys must not be empty")
+		}
+	}
+
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+
+	if c.RateLimit > 0 && c.RateLimitBurst < 1 {
+		return fmt.Errorf("rate limit burst must be at least 1")
+	}
+
+	return nil
+}
+
+// CORSConfig configures the CORS headers that let web apps on other origins fetch from the API.
+type CORSConfig struct {
+	// AllowedOrigins are the origins that may make cross-origin requests, "*" allows every origin
+	AllowedOrigins []string
+	// AllowedMethods are the methods that cross-origin requests may use
+	AllowedMethods []string
+	// AllowedHeaders are the request headers that cross-origin requests may send, "*" allows every header
+	AllowedHeaders []string
+}
+
+// Enabled returns whether any origin may make cross-origin requests.
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+func (c CORSConfig) Check() error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		// An origin is a scheme and host, with an optional port, as sent by browsers in the Origin header
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+			return fmt.Errorf("invalid origin %q, expected e.g. https://explorer.example", origin)
+		}
+	}
+
+	if len(c.AllowedMethods) == 0 {
+		return fmt.Errorf("at least one method must be allowed")
+	}
+
+	return nil
 }
 
 func (c APIConfig) Check() error {
@@ -31,15 +129,80 @@ func (c APIConfig) Check() error {
 		return fmt.Errorf("listen address must be set")
 	}
 
+	if c.ReadThrough && c.ReadThroughConcurrency < 1 {
+		return fmt.Errorf("read-through concurrency must be at least 1")
+	}
+
+	if c.CacheConfig.Size < 0 {
+		return fmt.Errorf("cache size must not be negative")
+	}
+
+	if c.CacheConfig.MaxBytes < 0 {
+		return fmt.Errorf("cache max bytes must not be negative")
+	}
+
+	if c.CacheConfig.Enabled() && (c.CacheConfig.TTL < 0 || c.CacheConfig.StaleWindow < 0) {
+		return fmt.Errorf("cache ttl and stale window must not be negative")
+	}
+
+	if c.UpstreamArchiver != "" {
+		if _, err := blobformat.Parse(c.UpstreamArchiverFormat); err != nil {
+			return fmt.Errorf("invalid upstream archiver format: %w", err)
+		}
+	}
+
+	if err := c.CORSConfig.Check(); err != nil {
+		return fmt.Errorf("cors config check failed: %w", err)
+	}
+
+	if err := c.AuthConfig.Check(); err != nil {
+		return fmt.Errorf("auth config check failed: %w", err)
+	}
+
 	return nil
 }
 
+// authHeaders are the request headers that carry an API key, which are allowed in cross-origin requests by default if
+// keys are required.
+var authHeaders = []string{"Authorization", "X-API-Key"}
+
 func ReadConfig(cliCtx *cli.Context) APIConfig {
+	allowedHeaders := cliCtx.StringSlice(CORSAllowedHeadersFlag.Name)
+	if !cliCtx.IsSet(CORSAllowedHeadersFlag.Name) && len(cliCtx.StringSlice(APIKeysFlag.Name)) > 0 {
+		allowedHeaders = append(allowedHeaders, authHeaders...)
+	}
+
 	return APIConfig{
 		LogConfig:     oplog.ReadCLIConfig(cliCtx),
 		MetricsConfig: opmetrics.ReadCLIConfig(cliCtx),
 		BeaconConfig:  common.NewBeaconConfig(cliCtx),
 		StorageConfig: common.NewStorageConfig(cliCtx),
 		ListenAddr:    cliCtx.String(ListenAddressFlag.Name),
+
+		ReadThrough:            cliCtx.Bool(ReadThroughFlag.Name),
+		ReadThroughConcurrency: cliCtx.Int(ReadThroughConcurrencyFlag.Name),
+
+		UpstreamArchiver:       cliCtx.String(UpstreamArchiverFlag.Name),
+		UpstreamArchiverFormat: cliCtx.String(UpstreamArchiverFormatFlag.Name),
+
+		CacheConfig: storage.CacheConfig{
+			Size:        cliCtx.Int(CacheSizeFlag.Name),
+			MaxBytes:    cliCtx.Int64(CacheMaxBytesFlag.Name),
+			TTL:         cliCtx.Duration(CacheTTLFlag.Name),
+			StaleWindow: cliCtx.Duration(CacheStaleWindowFlag.Name),
+		},
+
+		CORSConfig: CORSConfig{
+			AllowedOrigins: cliCtx.StringSlice(CORSAllowedOriginsFlag.Name),
+			AllowedMethods: cliCtx.StringSlice(CORSAllowedMethodsFlag.Name),
+			AllowedHeaders: allowedHeaders,
+		},
+
+		AuthConfig: AuthConfig{
+			APIKeys:           cliCtx.StringSlice(APIKeysFlag.Name),
+			RateLimit:         cliCtx.Float64(RateLimitFlag.Name),
+			RateLimitBurst:    cliCtx.Int(RateLimitBurstFlag.Name),
+			TrustProxyHeaders: cliCtx.Bool(TrustProxyHeadersFlag.Name),
+		},
 	}
 }
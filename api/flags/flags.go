@@ -1,9 +1,12 @@
 package flags
 
 import (
+	"net/http"
+	"time"
+
 	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
-	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/urfave/cli/v2"
 )
@@ -17,13 +20,101 @@ var (
 		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "LISTEN_ADDRESS"),
 		Value:   "0.0.0.0:8000",
 	}
+	ReadThroughFlag = &cli.BoolFlag{
+		Name:    "read-through",
+		Usage:   "When true, blobs missing from storage are fetched from the beacon node, served, and stored",
+		Value:   false,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "READ_THROUGH"),
+	}
+	ReadThroughConcurrencyFlag = &cli.IntFlag{
+		Name:    "read-through-concurrency",
+		Usage:   "The maximum number of blob fetches from the beacon node in flight at once when read-through is enabled",
+		Value:   storage.DefaultReadThroughConcurrency,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "READ_THROUGH_CONCURRENCY"),
+	}
+	UpstreamArchiverFlag = &cli.StringFlag{
+		Name:    "upstream-archiver-http",
+		Usage:   "The URL of another archiver's blob API. When set, blobs missing from storage are fetched from it, served, and stored",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "UPSTREAM_ARCHIVER_HTTP"),
+	}
+	UpstreamArchiverFormatFlag = &cli.StringFlag{
+		Name:    "upstream-archiver-format",
+		Usage:   "The format to request blobs from the upstream archiver in, options are [json, ssz, ssz_snappy, auto]. auto requests ssz and falls back to json if ssz responses fail to decode",
+		Value:   "auto",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "UPSTREAM_ARCHIVER_FORMAT"),
+	}
+	CacheSizeFlag = &cli.IntFlag{
+		Name:    "cache-size",
+		Usage:   "The number of blocks of blobs to hold in memory in front of storage, 0 disables the cache unless cache-max-bytes is set",
+		Value:   0,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_SIZE"),
+	}
+	CacheMaxBytesFlag = &cli.Int64Flag{
+		Name:    "cache-max-bytes",
+		Usage:   "The total size in bytes of the blobs to hold in memory in front of storage, 0 does not limit the size and disables the cache unless cache-size is set",
+		Value:   0,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_MAX_BYTES"),
+	}
+	CacheTTLFlag = &cli.DurationFlag{
+		Name:    "cache-ttl",
+		Usage:   "How long a cached block is served before it is refreshed from storage",
+		Value:   12 * time.Second,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_TTL"),
+	}
+	CacheStaleWindowFlag = &cli.DurationFlag{
+		Name:    "cache-stale-window",
+		Usage:   "How long after the cache TTL an expired block is still served while it is refreshed in the background, 0 refreshes expired blocks before responding",
+		Value:   0,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_STALE_WINDOW"),
+	}
+	CORSAllowedOriginsFlag = &cli.StringSliceFlag{
+		Name:    "cors-allowed-origins",
+		Usage:   "The origins that web apps may fetch from the API from, e.g. https://explorer.example, or * for every origin. CORS is disabled if none are set",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CORS_ALLOWED_ORIGINS"),
+	}
+	CORSAllowedMethodsFlag = &cli.StringSliceFlag{
+		Name:    "cors-allowed-methods",
+		Usage:   "The methods that cross-origin requests may use",
+		Value:   cli.NewStringSlice(http.MethodGet, http.MethodHead),
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CORS_ALLOWED_METHODS"),
+	}
+	CORSAllowedHeadersFlag = &cli.StringSliceFlag{
+		Name:    "cors-allowed-headers",
+		Usage:   "The request headers that cross-origin requests may send, or * for every header. Authorization and X-API-Key are allowed by default if API keys are set",
+		Value:   cli.NewStringSlice("Accept", "Cache-Control", "Content-Type"),
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CORS_ALLOWED_HEADERS"),
+	}
+	APIKeysFlag = &cli.StringSliceFlag{
+		Name:    "api-keys",
+		Usage:   "The API keys that clients must send as a bearer token or in the X-API-Key header. Requests are not authenticated if none are set",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "API_KEYS"),
+	}
+	RateLimitFlag = &cli.Float64Flag{
+		Name:    "rate-limit",
+		Usage:   "The number of requests per second allowed for each client, identified by its API key or IP address, 0 disables rate limiting",
+		Value:   0,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMIT"),
+	}
+	RateLimitBurstFlag = &cli.IntFlag{
+		Name:    "rate-limit-burst",
+		Usage:   "The number of requests a client can make at once before it is rate limited",
+		Value:   20,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMIT_BURST"),
+	}
+	TrustProxyHeadersFlag = &cli.BoolFlag{
+		Name:    "trust-proxy-headers",
+		Usage:   "Identify clients without an API key by the last address of the X-Forwarded-For header, or the X-Real-IP header, for an API behind a reverse proxy that sets them",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "TRUST_PROXY_HEADERS"),
+	}
 )
 
 func init() {
 	Flags = append(Flags, common.CLIFlags(EnvVarPrefix)...)
 	Flags = append(Flags, opmetrics.CLIFlags(EnvVarPrefix)...)
-	Flags = append(Flags, oplog.CLIFlags(EnvVarPrefix)...)
-	Flags = append(Flags, ListenAddressFlag)
+	Flags = append(Flags, common.LogFlags(EnvVarPrefix)...)
+	Flags = append(Flags, ListenAddressFlag, ReadThroughFlag, ReadThroughConcurrencyFlag, UpstreamArchiverFlag, UpstreamArchiverFormatFlag,
+		CacheSizeFlag, CacheMaxBytesFlag, CacheTTLFlag, CacheStaleWindowFlag, CORSAllowedOriginsFlag, CORSAllowedMethodsFlag, CORSAllowedHeadersFlag,
+		APIKeysFlag, RateLimitFlag, RateLimitBurstFlag, TrustProxyHeadersFlag)
 }
 
 // Flags contains the list of configuration options available to the binary.
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/prometheus/client_golang/prometheus"
@@ -8,23 +9,42 @@ import (
 
 type BlockIdType string
 
+// RejectReason is why a request was rejected before it was handled.
+type RejectReason string
+
 var (
 	MetricsNamespace = "blob_api"
 
-	BlockIdTypeHash    BlockIdType = "hash"
-	BlockIdTypeBeacon  BlockIdType = "beacon"
-	BlockIdTypeInvalid BlockIdType = "invalid"
+	BlockIdTypeHash      BlockIdType = "hash"
+	BlockIdTypeBeacon    BlockIdType = "beacon"
+	BlockIdTypeInventory BlockIdType = "inventory"
+	BlockIdTypeInvalid   BlockIdType = "invalid"
+
+	RejectReasonUnauthorized RejectReason = "unauthorized"
+	RejectReasonRateLimited  RejectReason = "rate_limited"
 )
 
 type Metricer interface {
 	Registry() *prometheus.Registry
 	RecordBlockIdType(t BlockIdType)
+	RecordRejectedRequest(reason RejectReason)
+	storage.CacheRecorder
 }
 
 type metricsRecorder struct {
-	// blockIdType records the type of block id used to request a block. This could be a hash (BlockIdTypeHash), or a
-	// beacon block identifier (BlockIdTypeBeacon).
+	// blockIdType records the type of block id used to request a block. This could be a hash (BlockIdTypeHash), a
+	// beacon block identifier (BlockIdTypeBeacon), or a slot resolved from the inventory (BlockIdTypeInventory).
 	blockIdType *prometheus.CounterVec
+	// rejectedRequests records the requests rejected for a missing or invalid API key (RejectReasonUnauthorized), or
+	// for exceeding the rate limit of the client (RejectReasonRateLimited)
+	rejectedRequests *prometheus.CounterVec
+	// cacheReads records the outcome of reads from the in-memory cache, a storage.CacheResult
+	cacheReads *prometheus.CounterVec
+	// cacheEvictions records the blocks evicted from the in-memory cache to keep it within its limits
+	cacheEvictions prometheus.Counter
+	// cacheBlocks and cacheBytes record the number and total size of the blocks held in the in-memory cache
+	cacheBlocks prometheus.Gauge
+	cacheBytes  prometheus.Gauge
 	registry    *prometheus.Registry
 }
 
@@ -38,6 +58,31 @@ func NewMetrics() Metricer {
 			Name:      "block_id_type",
 			Help:      "The type of block id used to request a block",
 		}, []string{"type"}),
+		rejectedRequests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "rejected_requests",
+			Help:      "The number of requests rejected as unauthorized or rate limited",
+		}, []string{"reason"}),
+		cacheReads: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "cache_reads",
+			Help:      "The number of reads from the in-memory cache, by whether they were a hit, served stale, or a miss",
+		}, []string{"result"}),
+		cacheEvictions: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "cache_evictions",
+			Help:      "The number of blocks evicted from the in-memory cache to keep it within its limits",
+		}),
+		cacheBlocks: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "cache_blocks",
+			Help:      "The number of blocks held in the in-memory cache",
+		}),
+		cacheBytes: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "cache_bytes",
+			Help:      "The total size of the blobs held in the in-memory cache",
+		}),
 	}
 }
 
@@ -45,6 +90,23 @@ func (m *metricsRecorder) RecordBlockIdType(t BlockIdType) {
 	m.blockIdType.WithLabelValues(string(t)).Inc()
 }
 
+func (m *metricsRecorder) RecordRejectedRequest(reason RejectReason) {
+	m.rejectedRequests.WithLabelValues(string(reason)).Inc()
+}
+
+func (m *metricsRecorder) RecordCacheRead(result storage.CacheResult) {
+	m.cacheReads.WithLabelValues(string(result)).Inc()
+}
+
+func (m *metricsRecorder) RecordCacheEviction() {
+	m.cacheEvictions.Inc()
+}
+
+func (m *metricsRecorder) RecordCacheSize(blocks int, bytes int64) {
+	m.cacheBlocks.Set(float64(blocks))
+	m.cacheBytes.Set(float64(bytes))
+}
+
 func (m *metricsRecorder) Registry() *prometheus.Registry {
 	return m.registry
 }
@@ -14,8 +14,11 @@ import (
 	client "github.com/attestantio/go-eth2-client"
 	"github.com/attestantio/go-eth2-client/api"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/api/flags"
 	m "github.com/base-org/blob-archiver/api/metrics"
 	"github.com/base-org/blob-archiver/api/version"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/forks"
 	"github.com/base-org/blob-archiver/common/storage"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/ethereum/go-ethereum/common"
@@ -50,10 +53,18 @@ var (
 		Code:    http.StatusNotFound,
 		Message: "Block not found",
 	}
+	errNoBlobs = &httpError{
+		Code:    http.StatusNotFound,
+		Message: "Block has no blobs",
+	}
 	errServerError = &httpError{
 		Code:    http.StatusInternalServerError,
 		Message: "Internal server error",
 	}
+	errUnrecoverableBlobs = &httpError{
+		Code:    http.StatusInternalServerError,
+		Message: "Blobs cannot be recovered from the stored data columns",
+	}
 )
 
 func newBlockIdError(input string) *httpError {
@@ -70,10 +81,17 @@ func newIndicesError(input string) *httpError {
 	}
 }
 
-func newOutOfRangeError(input uint64, blobCount int) *httpError {
+func newNoRequestedBlobsError(blobs int) *httpError {
+	return &httpError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("invalid indices: the block has %d blobs, none of them at the requested indices", blobs),
+	}
+}
+
+func newOutOfRangeError(input uint64, fork string, maxBlobs uint64) *httpError {
 	return &httpError{
 		Code:    http.StatusBadRequest,
-		Message: fmt.Sprintf("invalid index: %d block contains %d blobs", input, blobCount),
+		Message: fmt.Sprintf("invalid index: %d %s blocks contain at most %d blobs", input, fork, maxBlobs),
 	}
 }
 
@@ -83,9 +101,18 @@ type API struct {
 	router          *chi.Mux
 	logger          log.Logger
 	metrics         m.Metricer
+	cors            flags.CORSConfig
+	blobIndex       storage.BlobIndexer
+	inventory       storage.Inventory
+	auth            flags.AuthConfig
+	// limiters are the rate limiters of the clients, nil if requests are not rate limited
+	limiters *clientLimiters
 }
 
-func NewAPI(dataStoreClient storage.DataStoreReader, beaconClient client.BeaconBlockHeadersProvider, metrics m.Metricer, logger log.Logger) *API {
+// APIOption configures an API created by NewAPI.
+type APIOption func(a *API)
+
+func NewAPI(dataStoreClient storage.DataStoreReader, beaconClient client.BeaconBlockHeadersProvider, metrics m.Metricer, logger log.Logger, opts ...APIOption) *API {
 	result := &API{
 		dataStoreClient: dataStoreClient,
 		beaconClient:    beaconClient,
@@ -93,11 +120,18 @@ func NewAPI(dataStoreClient storage.DataStoreReader, beaconClient client.BeaconB
 		logger:          logger,
 		metrics:         metrics,
 	}
+	for _, opt := range opts {
+		opt(result)
+	}
 
 	r := result.router
 	r.Use(middleware.Logger)
 	r.Use(middleware.Timeout(serverTimeout))
 	r.Use(middleware.Recoverer)
+	if result.cors.Enabled() {
+		// Before the routes, which do not accept OPTIONS, so that preflight requests are answered
+		r.Use(corsMiddleware(result.cors))
+	}
 	r.Use(middleware.Heartbeat("/healthz"))
 	r.Use(middleware.Compress(5, jsonAcceptType, sszAcceptType))
 
@@ -106,8 +140,20 @@ func NewAPI(dataStoreClient storage.DataStoreReader, beaconClient client.BeaconB
 		return opmetrics.NewHTTPRecordingMiddleware(recorder, handler)
 	})
 
+	if result.auth.Enabled() {
+		if result.auth.RateLimit > 0 {
+			result.limiters = newClientLimiters(result.auth.RateLimit, result.auth.RateLimitBurst)
+		}
+		r.Use(authMiddleware(result.auth, metrics, result.limiters))
+	}
+
+	r.Use(consistencyMiddleware)
+
 	r.Get("/eth/v1/beacon/blob_sidecars/{id}", result.blobSidecarHandler)
+	r.Get("/eth/v1/debug/beacon/data_column_sidecars/{id}", result.dataColumnSidecarHandler)
+	r.Get("/eth/v1/blobs/{versioned_hash}", result.blobHandler)
 	r.Get("/eth/v1/node/version", result.versionHandler)
+	r.Get("/blob_archiver/v1/blob_proofs/{id}", result.blobProofHandler)
 
 	return result
 }
@@ -130,6 +176,21 @@ func isKnownIdentifier(id string) bool {
 	return slices.Contains([]string{"genesis", "finalized", "head"}, id)
 }
 
+// consistencyMiddleware reads blobs with storage.ConsistencyFresh for requests that ask not to be served from a cache,
+// with a Cache-Control header of no-cache, so that e.g. a read-through API fetches the blobs from the beacon node
+// rather than serving the stored copy.
+func consistencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				r = r.WithContext(storage.WithConsistency(r.Context(), storage.ConsistencyFresh))
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // versionHandler implements the /eth/v1/node/version endpoint.
 func (a *API) versionHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", jsonAcceptType)
@@ -141,19 +202,27 @@ func (a *API) versionHandler(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-// toBeaconBlockHash converts a string that can be a slot, hash or identifier to a beacon block hash.
-func (a *API) toBeaconBlockHash(id string) (common.Hash, *httpError) {
+// toBeaconBlockHash converts a string that can be a slot, hash or identifier to a beacon block hash. Slots and
+// identifiers are resolved with the header of the block on the beacon node. A slot that the beacon node cannot resolve,
+// e.g. because it was checkpoint synced after the slot, is looked up in the inventory if the API has one, see
+// WithInventory.
+func (a *API) toBeaconBlockHash(ctx context.Context, id string) (common.Hash, *httpError) {
 	if isHash(id) {
 		a.metrics.RecordBlockIdType(m.BlockIdTypeHash)
 		return common.HexToHash(id), nil
 	} else if isSlot(id) || isKnownIdentifier(id) {
-		a.metrics.RecordBlockIdType(m.BlockIdTypeBeacon)
-		result, err := a.beaconClient.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{
+		result, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
 			Common: api.CommonOpts{},
 			Block:  id,
 		})
 
 		if err != nil {
+			if root, ok := a.inventoryRoot(ctx, id); ok {
+				a.metrics.RecordBlockIdType(m.BlockIdTypeInventory)
+				return root, nil
+			}
+
+			a.metrics.RecordBlockIdType(m.BlockIdTypeBeacon)
 			var apiErr *api.Error
 			if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
 				return common.Hash{}, errUnknownBlock
@@ -162,6 +231,7 @@ func (a *API) toBeaconBlockHash(id string) (common.Hash, *httpError) {
 			return common.Hash{}, errServerError
 		}
 
+		a.metrics.RecordBlockIdType(m.BlockIdTypeBeacon)
 		return common.Hash(result.Data.Root), nil
 	} else {
 		a.metrics.RecordBlockIdType(m.BlockIdTypeInvalid)
@@ -170,10 +240,11 @@ func (a *API) toBeaconBlockHash(id string) (common.Hash, *httpError) {
 }
 
 // blobSidecarHandler implements the /eth/v1/beacon/blob_sidecars/{id} endpoint, using the underlying DataStoreReader
-// to fetch blobs instead of the beacon node. This allows clients to fetch expired blobs.
+// to fetch blobs instead of the beacon node. This allows clients to fetch expired blobs. The sidecars of a block stored
+// with data columns are recovered from its columns.
 func (a *API) blobSidecarHandler(w http.ResponseWriter, r *http.Request) {
 	param := chi.URLParam(r, "id")
-	beaconBlockHash, err := a.toBeaconBlockHash(param)
+	beaconBlockHash, err := a.toBeaconBlockHash(r.Context(), param)
 	if err != nil {
 		err.write(w)
 		return
@@ -184,22 +255,29 @@ func (a *API) blobSidecarHandler(w http.ResponseWriter, r *http.Request) {
 		if errors.Is(storageErr, storage.ErrNotFound) {
 			errUnknownBlock.write(w)
 		} else {
-			a.logger.Info("unexpected error fetching blobs", "err", storageErr, "beaconBlockHash", beaconBlockHash.String(), "param", param)
+			a.logger.Info("unexpected error fetching blobs", "err", storageErr, "root", beaconBlockHash.String(), "param", param)
 			errServerError.write(w)
 		}
 		return
 	}
 
-	blobSidecars := result.BlobSidecars
+	selected, err := parseIndices(result.Header.Fork, r.URL.Query()["indices"])
+	if err != nil {
+		err.write(w)
+		return
+	}
 
-	filteredBlobSidecars, err := filterBlobs(blobSidecars.Data, r.URL.Query()["indices"])
+	filteredBlobSidecars, _, err := a.storedBlobs(result, selected)
 	if err != nil {
 		err.write(w)
 		return
 	}
 
-	blobSidecars.Data = filteredBlobSidecars
+	blobSidecars := storage.BlobSidecars{Data: filteredBlobSidecars}
 	responseType := r.Header.Get("Accept")
+	if result.Header.Fork != "" {
+		w.Header().Set("Eth-Consensus-Version", result.Header.Fork)
+	}
 
 	if responseType == sszAcceptType {
 		w.Header().Set("Content-Type", sszAcceptType)
@@ -228,12 +306,108 @@ func (a *API) blobSidecarHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// filterBlobs filters the blobs based on the indices query provided.
-// If no indices are provided, all blobs are returned. If invalid indices are provided, an error is returned.
-func filterBlobs(blobs []*deneb.BlobSidecar, _indices []string) ([]*deneb.BlobSidecar, *httpError) {
+// blobProofHandler implements the /blob_archiver/v1/blob_proofs/{id} endpoint, which returns the stored blobs of a block
+// in a blobproof.Bundle, so that light clients can verify them against the block root without fetching each sidecar's
+// inclusion proof. The indices query selects the blobs in the same way as the blob sidecars endpoint.
+func (a *API) blobProofHandler(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "id")
+	beaconBlockHash, err := a.toBeaconBlockHash(r.Context(), param)
+	if err != nil {
+		err.write(w)
+		return
+	}
+
+	result, storageErr := a.dataStoreClient.ReadBlob(r.Context(), beaconBlockHash)
+	if storageErr != nil {
+		if errors.Is(storageErr, storage.ErrNotFound) {
+			errUnknownBlock.write(w)
+		} else {
+			a.logger.Info("unexpected error fetching blobs", "err", storageErr, "root", beaconBlockHash.String(), "param", param)
+			errServerError.write(w)
+		}
+		return
+	}
+
+	selected, err := parseIndices(result.Header.Fork, r.URL.Query()["indices"])
+	if err != nil {
+		err.write(w)
+		return
+	}
+
+	sidecars, blobs, err := a.storedBlobs(result, selected)
+	if err != nil {
+		err.write(w)
+		return
+	}
+
+	// A bundle holds the header of the requested blobs, so there is none when no blob of the block was requested
+	if len(sidecars) == 0 && blobs > 0 {
+		newNoRequestedBlobsError(blobs).write(w)
+		return
+	}
+
+	bundle, bundleErr := blobproof.NewBundle(sidecars)
+	if bundleErr != nil {
+		if errors.Is(bundleErr, blobproof.ErrNoBlobs) {
+			errNoBlobs.write(w)
+		} else {
+			a.logger.Error("unable to create blob proof bundle", "err", bundleErr, "root", beaconBlockHash.String())
+			errServerError.write(w)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonAcceptType)
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		a.logger.Error("unable to encode blob proof bundle to JSON", "err", err)
+		errServerError.write(w)
+	}
+}
+
+// storedBlobs returns the blob sidecars of a stored block at the selected indices, or all of them if selected is nil,
+// and the number of blobs of the block. Selected indices of blobs that the block does not have are left out of the
+// result. A block stored with data columns has no blob sidecars, so its sidecars are recovered from its columns, see
+// blobproof.RecoverBlobSidecars, rather than returned as none.
+func (a *API) storedBlobs(data storage.BlobData, selected map[deneb.BlobIndex]struct{}) ([]*storage.BlobSidecar, int, *httpError) {
+	if data.DataColumnSidecars != nil && len(data.DataColumnSidecars.Data) > 0 {
+		var indices []uint64
+		if selected != nil {
+			indices = make([]uint64, 0, len(selected))
+			for index := range selected {
+				indices = append(indices, uint64(index))
+			}
+			slices.Sort(indices)
+		}
+
+		sidecars, err := blobproof.RecoverBlobSidecars(data.DataColumnSidecars.Data, data.Header.Fork, indices)
+		if err != nil {
+			a.logger.Error("unable to recover blobs from data columns", "err", err, "root", data.Header.BeaconBlockHash.String())
+			return nil, 0, errUnrecoverableBlobs
+		}
+		return sidecars, data.DataColumnSidecars.Blobs(), nil
+	}
+
+	blobs := data.BlobSidecars.Data
+	if selected == nil {
+		return blobs, len(blobs), nil
+	}
+	filteredBlobs := make([]*storage.BlobSidecar, 0)
+	for _, blob := range blobs {
+		if _, ok := selected[blob.Index]; ok {
+			filteredBlobs = append(filteredBlobs, blob)
+		}
+	}
+
+	return filteredBlobs, len(blobs), nil
+}
+
+// parseIndices parses the indices query provided, returning the selected indices, or nil if no indices are provided
+// and all blobs are selected. If invalid indices are provided, an error is returned. As on a beacon node, an index is
+// invalid if it is not below the maximum number of blobs in a block of the fork, given that the fork is known.
+func parseIndices(fork string, _indices []string) (map[deneb.BlobIndex]struct{}, *httpError) {
 	var indices []string
 	if len(_indices) == 0 {
-		return blobs, nil
+		return nil, nil
 	} else if len(_indices) == 1 {
 		indices = strings.Split(_indices[0], ",")
 	} else {
@@ -247,20 +421,13 @@ func filterBlobs(blobs []*deneb.BlobSidecar, _indices []string) ([]*deneb.BlobSi
 			return nil, newIndicesError(index)
 		}
 
-		if parsedInt >= uint64(len(blobs)) {
-			return nil, newOutOfRangeError(parsedInt, len(blobs))
+		if max := forks.MaxBlobsPerBlock(fork); max > 0 && parsedInt >= max {
+			return nil, newOutOfRangeError(parsedInt, fork, max)
 		}
 
 		blobIndex := deneb.BlobIndex(parsedInt)
 		indicesMap[blobIndex] = struct{}{}
 	}
 
-	filteredBlobs := make([]*deneb.BlobSidecar, 0)
-	for _, blob := range blobs {
-		if _, ok := indicesMap[blob.Index]; ok {
-			filteredBlobs = append(filteredBlobs, blob)
-		}
-	}
-
-	return filteredBlobs, nil
+	return indicesMap, nil
 }
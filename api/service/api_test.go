@@ -10,12 +10,11 @@ import (
 	"os"
 	"testing"
 
-	"github.com/attestantio/go-eth2-client/api"
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
-	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/api/metrics"
 	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobproof"
 	"github.com/base-org/blob-archiver/common/blobtest"
 	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
@@ -79,16 +78,17 @@ func TestAPIService(t *testing.T) {
 			BeaconBlockHash: rootOne,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: blobtest.NewBlobSidecars(t, 2),
+			Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 2)),
 		},
 	}
 
 	blockTwo := storage.BlobData{
 		Header: storage.Header{
 			BeaconBlockHash: rootTwo,
+			Fork:            "deneb",
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: blobtest.NewBlobSidecars(t, 2),
+			Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 2)),
 		},
 	}
 
@@ -158,7 +158,7 @@ func TestAPIService(t *testing.T) {
 			path:   "/eth/v1/beacon/blob_sidecars/1234?indices=1",
 			status: 200,
 			expected: &storage.BlobSidecars{
-				Data: []*deneb.BlobSidecar{
+				Data: []*storage.BlobSidecar{
 					blockTwo.BlobSidecars.Data[1],
 				},
 			},
@@ -168,7 +168,7 @@ func TestAPIService(t *testing.T) {
 			path:   "/eth/v1/beacon/blob_sidecars/1234?indices=1,1,1",
 			status: 200,
 			expected: &storage.BlobSidecars{
-				Data: []*deneb.BlobSidecar{
+				Data: []*storage.BlobSidecar{
 					blockTwo.BlobSidecars.Data[1],
 				},
 			},
@@ -190,22 +190,26 @@ func TestAPIService(t *testing.T) {
 			},
 		},
 		{
-			name:       "only index out of bounds returns empty array",
-			path:       "/eth/v1/beacon/blob_sidecars/1234?indices=3",
-			status:     400,
-			errMessage: "invalid index: 3 block contains 2 blobs",
+			name:     "only index out of bounds returns empty array",
+			path:     "/eth/v1/beacon/blob_sidecars/1234?indices=3",
+			status:   200,
+			expected: &storage.BlobSidecars{Data: []*storage.BlobSidecar{}},
 		},
 		{
-			name:       "any index out of bounds returns error",
-			path:       "/eth/v1/beacon/blob_sidecars/1234?indices=1,10",
-			status:     400,
-			errMessage: "invalid index: 10 block contains 2 blobs",
+			name:   "index out of bounds is left out",
+			path:   "/eth/v1/beacon/blob_sidecars/1234?indices=1,5",
+			status: 200,
+			expected: &storage.BlobSidecars{
+				Data: []*storage.BlobSidecar{
+					blockTwo.BlobSidecars.Data[1],
+				},
+			},
 		},
 		{
-			name:       "only index out of bounds (boundary condition) returns error",
-			path:       "/eth/v1/beacon/blob_sidecars/1234?indices=2",
+			name:       "index beyond the fork maximum returns error",
+			path:       "/eth/v1/beacon/blob_sidecars/1234?indices=1,6",
 			status:     400,
-			errMessage: "invalid index: 2 block contains 2 blobs",
+			errMessage: "invalid index: 6 deneb blocks contain at most 6 blobs",
 		},
 		{
 			name:       "negative index returns error",
@@ -282,9 +286,7 @@ func TestAPIService(t *testing.T) {
 						blobSidecars := storage.BlobSidecars{}
 
 						if rf == "application/octet-stream" {
-							res := api.BlobSidecars{}
-							err = res.UnmarshalSSZ(data)
-							blobSidecars.Data = res.Sidecars
+							err = blobSidecars.UnmarshalSSZ(data)
 						} else {
 							err = json.Unmarshal(data, &blobSidecars)
 						}
@@ -304,6 +306,135 @@ func TestAPIService(t *testing.T) {
 	}
 }
 
+func TestBlobProofHandler(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	rootOne := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	rootEmpty := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890000000")
+	sidecars := storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 3))
+
+	err := fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: rootOne},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars},
+	})
+	require.NoError(t, err)
+	err = fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: rootEmpty},
+		BlobSidecars: storage.BlobSidecars{Data: []*storage.BlobSidecar{}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		path       string
+		status     int
+		expected   []*storage.BlobSidecar
+		errMessage string
+	}{
+		{
+			name:     "all blobs",
+			path:     fmt.Sprintf("/blob_archiver/v1/blob_proofs/%s", rootOne),
+			status:   200,
+			expected: sidecars,
+		},
+		{
+			name:     "requested indices",
+			path:     fmt.Sprintf("/blob_archiver/v1/blob_proofs/%s?indices=0,2", rootOne),
+			status:   200,
+			expected: []*storage.BlobSidecar{sidecars[0], sidecars[2]},
+		},
+		{
+			name:       "index out of bounds",
+			path:       fmt.Sprintf("/blob_archiver/v1/blob_proofs/%s?indices=3", rootOne),
+			status:     400,
+			errMessage: "invalid indices: the block has 3 blobs, none of them at the requested indices",
+		},
+		{
+			name:       "block without blobs",
+			path:       fmt.Sprintf("/blob_archiver/v1/blob_proofs/%s", rootEmpty),
+			status:     404,
+			errMessage: "Block has no blobs",
+		},
+		{
+			name:       "unknown block",
+			path:       "/blob_archiver/v1/blob_proofs/0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abc111",
+			status:     404,
+			errMessage: "Block not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", test.path, nil)
+			response := httptest.NewRecorder()
+
+			a.router.ServeHTTP(response, request)
+
+			require.Equal(t, test.status, response.Code)
+			if test.status == 200 {
+				require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+				expected, err := blobproof.NewBundle(test.expected)
+				require.NoError(t, err)
+
+				var bundle blobproof.Bundle
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &bundle))
+				require.Equal(t, expected, &bundle)
+			} else {
+				var e httpError
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+				require.Equal(t, test.errMessage, e.Message)
+			}
+		})
+	}
+}
+
+// consistencyRecorder records the consistency level of the reads made through it.
+type consistencyRecorder struct {
+	storage.DataStoreReader
+	consistency storage.Consistency
+}
+
+func (r *consistencyRecorder) ReadBlob(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	r.consistency = storage.ConsistencyFromContext(ctx)
+	return r.DataStoreReader.ReadBlob(ctx, hash)
+}
+
+func TestConsistency(t *testing.T) {
+	a, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+	recorder := &consistencyRecorder{DataStoreReader: fs}
+	a = NewAPI(recorder, beaconClient, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo))
+
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	err := fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		cacheControl string
+		expected     storage.Consistency
+	}{
+		{"", storage.ConsistencyCached},
+		{"max-age=60", storage.ConsistencyCached},
+		{"no-cache", storage.ConsistencyFresh},
+		{"max-age=0, No-Cache", storage.ConsistencyFresh},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root), nil)
+		request.Header.Set("Cache-Control", test.cacheControl)
+		response := httptest.NewRecorder()
+
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 200, response.Code)
+		require.Equal(t, test.expected, recorder.consistency, test.cacheControl)
+	}
+}
+
 func TestVersionHandler(t *testing.T) {
 	a, _, _, cleanup := setup(t)
 	defer cleanup()
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	m "github.com/base-org/blob-archiver/api/metrics"
+	"golang.org/x/time/rate"
+)
+
+// idleClientTimeout is how long the rate limiter of a client is kept after its last request. A client that returns
+// after it has been dropped starts with a full burst again.
+const idleClientTimeout = 10 * time.Minute
+
+var (
+	errUnauthorized = &httpError{
+		Code:    http.StatusUnauthorized,
+		Message: "Unauthorized",
+	}
+	errRateLimited = &httpError{
+		Code:    http.StatusTooManyRequests,
+		Message: "Rate limit exceeded",
+	}
+)
+
+// WithAuth requires the requests to the API to be authenticated with one of the API keys of cfg, and limits the rate
+// of requests from each client, if configured. The health check and CORS preflight requests are neither
+// authenticated nor limited.
+func WithAuth(cfg flags.AuthConfig) APIOption {
+	return func(a *API) {
+		a.auth = cfg
+	}
+}
+
+// clientLimiter is the rate limiter of a client.
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// clientLimiters holds a rate limiter for each client, dropping those of clients that have gone idle.
+type clientLimiters struct {
+	limit rate.Limit
+	burst int
+	now   func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+func newClientLimiters(limit float64, burst int) *clientLimiters {
+	return &clientLimiters{
+		limit:   rate.Limit(limit),
+		burst:   burst,
+		now:     time.Now,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// reserve takes a request from the client's bucket. It returns false with the time until the client may make another
+// request if the client is over its limit. The returned function gives the request back to the bucket, for a request
+// that turns out not to count towards the limit of the client.
+func (l *clientLimiters) reserve(client string) (func(), bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= idleClientTimeout {
+		for id, c := range l.clients {
+			if now.Sub(c.lastSeen) >= idleClientTimeout {
+				delete(l.clients, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+
+	reservation := c.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		// The request is rejected rather than delayed, so it must not use up the tokens of later requests
+		reservation.CancelAt(now)
+		return nil, false, delay
+	}
+	return func() { reservation.CancelAt(l.now()) }, true, 0
+}
+
+// authMiddleware rejects requests without one of the API keys of cfg with errUnauthorized, if keys are configured,
+// and those of clients over their rate limit with errRateLimited, if a limit is configured. Clients are identified by
+// their API key if keys are required, and by their IP address otherwise. If keys are required, the request is also
+// taken from the bucket of its IP address before the key is checked, and given back if the key is valid, so that keys
+// cannot be guessed faster than the limit.
+func authMiddleware(cfg flags.AuthConfig, metrics m.Metricer, limiters *clientLimiters) func(http.Handler) http.Handler {
+	rateLimited := func(w http.ResponseWriter, delay time.Duration) {
+		metrics.RecordRejectedRequest(m.RejectReasonRateLimited)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		errRateLimited.write(w)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := clientIP(r, cfg.TrustProxyHeaders)
+			if len(cfg.APIKeys) > 0 {
+				giveBack := func() {}
+				if limiters != nil {
+					var ok bool
+					var delay time.Duration
+					if giveBack, ok, delay = limiters.reserve("ip:" + client); !ok {
+						rateLimited(w, delay)
+						return
+					}
+				}
+
+				key, ok := validAPIKey(r, cfg.APIKeys)
+				if !ok {
+					metrics.RecordRejectedRequest(m.RejectReasonUnauthorized)
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					errUnauthorized.write(w)
+					return
+				}
+				giveBack()
+				client = "key:" + key
+			}
+
+			if limiters != nil {
+				if _, ok, delay := limiters.reserve(client); !ok {
+					rateLimited(w, delay)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validAPIKey returns the API key of the request if it is one of keys. The key is taken from a bearer token in the
+// Authorization header, or else from the X-API-Key header.
+func validAPIKey(r *http.Request, keys []string) (string, bool) {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		provided = r.Header.Get("X-API-Key")
+	}
+	provided = strings.TrimSpace(provided)
+	if provided == "" {
+		return "", false
+	}
+
+	// Every key is compared, so that the time taken does not reveal which key a guess is close to
+	valid := false
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return provided, valid
+}
+
+// clientIP returns the IP address of the client that made the request. With trustProxyHeaders the address is taken
+// from the last address of the X-Forwarded-For header, which is the one added by the proxy in front of the API as the
+// earlier ones are sent by the client, or else from the X-Real-IP header.
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(addresses[len(addresses)-1]); last != "" {
+				return last
+			}
+		}
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			return realIP
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuth(t *testing.T, cfg flags.AuthConfig) (*API, string) {
+	_, fs, beaconClient, cleanup := setup(t)
+	t.Cleanup(cleanup)
+
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))},
+	}))
+
+	require.NoError(t, cfg.Check())
+	a := NewAPI(fs, beaconClient, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo), WithAuth(cfg))
+	return a, fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root)
+}
+
+func authRequest(a *API, path string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	return response
+}
+
+func TestAuth_APIKeys(t *testing.T) {
+	a, path := setupAuth(t, flags.AuthConfig{APIKeys: []string{"first", "second"}})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "bearer token", headers: map[string]string{"Authorization": "Bearer second"}, status: 200},
+		{name: "api key header", headers: map[string]string{"X-API-Key": "first"}, status: 200},
+		{name: "missing key", status: 401},
+		{name: "invalid key", headers: map[string]string{"Authorization": "Bearer third"}, status: 401},
+		{name: "not a bearer token", headers: map[string]string{"Authorization": "Basic Zmlyc3Q="}, status: 401},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := authRequest(a, path, test.headers)
+			require.Equal(t, test.status, response.Code)
+			if test.status == 401 {
+				require.Equal(t, "Bearer", response.Header().Get("WWW-Authenticate"))
+				var e httpError
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+				require.Equal(t, errUnauthorized.Message, e.Message)
+			}
+		})
+	}
+
+	// The health check is not authenticated
+	require.Equal(t, 200, authRequest(a, "/healthz", nil).Code)
+}
+
+func TestAuth_RateLimit(t *testing.T) {
+	a, path := setupAuth(t, flags.AuthConfig{RateLimit: 1, RateLimitBurst: 2})
+	now := time.Unix(1_700_000_000, 0)
+	a.limiters.now = func() time.Time { return now }
+
+	one := map[string]string{}
+	for i := 0; i < 2; i++ {
+		require.Equal(t, 200, authRequest(a, path, one).Code)
+	}
+	response := authRequest(a, path, one)
+	require.Equal(t, 429, response.Code)
+	require.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	// Rejected requests do not use up tokens, so the client can make a request once its bucket has refilled
+	now = now.Add(time.Second)
+	require.Equal(t, 200, authRequest(a, path, one).Code)
+	require.Equal(t, 429, authRequest(a, path, one).Code)
+
+	// Proxy headers are ignored unless trusted, as the client could set them itself
+	require.Equal(t, 429, authRequest(a, path, map[string]string{"X-Forwarded-For": "203.0.113.7"}).Code)
+}
+
+func TestAuth_RateLimitByClient(t *testing.T) {
+	a, path := setupAuth(t, flags.AuthConfig{APIKeys: []string{"first", "second"}, RateLimit: 1, RateLimitBurst: 1})
+	now := time.Unix(1_700_000_000, 0)
+	a.limiters.now = func() time.Time { return now }
+
+	// Each key has its own bucket
+	first := map[string]string{"X-API-Key": "first"}
+	second := map[string]string{"Authorization": "Bearer second"}
+	require.Equal(t, 200, authRequest(a, path, first).Code)
+	require.Equal(t, 429, authRequest(a, path, first).Code)
+	require.Equal(t, 200, authRequest(a, path, second).Code)
+
+	// The limiters of idle clients are dropped, leaving those of the key and the IP address of the last request
+	now = now.Add(idleClientTimeout)
+	require.Equal(t, 200, authRequest(a, path, first).Code)
+	require.Len(t, a.limiters.clients, 2)
+}
+
+func TestAuth_RateLimitGuesses(t *testing.T) {
+	a, path := setupAuth(t, flags.AuthConfig{APIKeys: []string{"first"}, RateLimit: 1, RateLimitBurst: 2})
+	now := time.Unix(1_700_000_000, 0)
+	a.limiters.now = func() time.Time { return now }
+
+	// Requests with a valid key are not limited by their IP address
+	first := map[string]string{"X-API-Key": "first"}
+	require.Equal(t, 200, authRequest(a, path, first).Code)
+	require.Equal(t, 200, authRequest(a, path, first).Code)
+
+	// Guesses are limited by IP address before the key is checked
+	guess := map[string]string{"X-API-Key": "guess"}
+	require.Equal(t, 401, authRequest(a, path, guess).Code)
+	require.Equal(t, 401, authRequest(a, path, guess).Code)
+	response := authRequest(a, path, first)
+	require.Equal(t, 429, response.Code)
+	require.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	// A trusted proxy header cannot be forged to get a new bucket
+	a, path = setupAuth(t, flags.AuthConfig{APIKeys: []string{"first"}, RateLimit: 1, RateLimitBurst: 1, TrustProxyHeaders: true})
+	a.limiters.now = func() time.Time { return now }
+	require.Equal(t, 401, authRequest(a, path, map[string]string{"X-Forwarded-For": "203.0.113.7, 10.0.0.1"}).Code)
+	require.Equal(t, 429, authRequest(a, path, map[string]string{"X-Forwarded-For": "203.0.113.8, 10.0.0.1"}).Code)
+}
+
+func TestClientIP(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	require.Equal(t, "192.0.2.1", clientIP(request, true))
+
+	request.Header.Set("X-Real-IP", "198.51.100.2")
+	require.Equal(t, "198.51.100.2", clientIP(request, true))
+	// Only the last address is added by the proxy, the others are sent by the client
+	request.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	require.Equal(t, "10.0.0.1", clientIP(request, true))
+	request.Header.Add("X-Forwarded-For", "10.0.0.2")
+	require.Equal(t, "10.0.0.2", clientIP(request, true))
+	require.Equal(t, "192.0.2.1", clientIP(request, false))
+}
+
+func TestAuthConfig_Check(t *testing.T) {
+	require.NoError(t, flags.AuthConfig{}.Check())
+	require.False(t, flags.AuthConfig{}.Enabled())
+	require.ErrorContains(t, flags.AuthConfig{APIKeys: []string{""}}.Check(), "api keys must not be empty")
+	require.ErrorContains(t, flags.AuthConfig{RateLimit: -1}.Check(), "rate limit must not be negative")
+	require.ErrorContains(t, flags.AuthConfig{RateLimit: 1}.Check(), "rate limit burst must be at least 1")
+}
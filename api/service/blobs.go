@@ -0,0 +1,123 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errUnknownBlob = &httpError{
+		Code:    http.StatusNotFound,
+		Message: "Blob not found",
+	}
+	errNoBlobIndex = &httpError{
+		Code:    http.StatusNotImplemented,
+		Message: "Blobs are not indexed by versioned hash",
+	}
+)
+
+func newVersionedHashError(input string) *httpError {
+	return &httpError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("invalid versioned hash: %s", input),
+	}
+}
+
+// blobResponse is the JSON response of the blobs endpoint.
+type blobResponse struct {
+	Data *storage.BlobSidecar `json:"data"`
+}
+
+// WithBlobIndex serves blobs by their versioned hash from the /eth/v1/blobs/{versioned_hash} endpoint, looking up the
+// block of each blob in index, see storage.BlobIndexer. The endpoint responds with errNoBlobIndex without an index.
+func WithBlobIndex(index storage.BlobIndexer) APIOption {
+	return func(a *API) {
+		a.blobIndex = index
+	}
+}
+
+// blobHandler implements the /eth/v1/blobs/{versioned_hash} endpoint, which returns the sidecar of the blob with the
+// given versioned hash, as referred to by an execution layer transaction, so that the blob can be fetched without
+// knowing the block it was included in. The sidecar is read from the stored block, or recovered from its data columns,
+// so a blob whose block is no longer stored, or no longer holds the blob at the indexed position, is not found.
+func (a *API) blobHandler(w http.ResponseWriter, r *http.Request) {
+	if a.blobIndex == nil {
+		errNoBlobIndex.write(w)
+		return
+	}
+
+	param := chi.URLParam(r, "versioned_hash")
+	if !isHash(param) {
+		newVersionedHashError(param).write(w)
+		return
+	}
+	versionedHash := common.HexToHash(param)
+
+	location, err := a.blobIndex.ReadBlobLocation(r.Context(), versionedHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			errUnknownBlob.write(w)
+		} else {
+			a.logger.Info("unexpected error looking up blob", "err", err, "versionedHash", param)
+			errServerError.write(w)
+		}
+		return
+	}
+
+	data, err := a.dataStoreClient.ReadBlob(r.Context(), location.BlockRoot)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			errUnknownBlob.write(w)
+		} else {
+			a.logger.Info("unexpected error fetching blobs", "err", err, "root", location.BlockRoot.String(), "versionedHash", param)
+			errServerError.write(w)
+		}
+		return
+	}
+
+	sidecars, _, httpErr := a.storedBlobs(data, map[deneb.BlobIndex]struct{}{deneb.BlobIndex(location.Index): {}})
+	if httpErr != nil {
+		httpErr.write(w)
+		return
+	}
+
+	var sidecar *storage.BlobSidecar
+	for _, s := range sidecars {
+		if uint64(s.Index) == location.Index && s.VersionedHash() == versionedHash {
+			sidecar = s
+			break
+		}
+	}
+	if sidecar == nil {
+		errUnknownBlob.write(w)
+		return
+	}
+
+	if r.Header.Get("Accept") == sszAcceptType {
+		res, err := sidecar.MarshalSSZ()
+		if err != nil {
+			a.logger.Error("unable to marshal blob sidecar to SSZ", "err", err)
+			errServerError.write(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", sszAcceptType)
+		if _, err := w.Write(res); err != nil {
+			a.logger.Error("unable to write ssz response", "err", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonAcceptType)
+	if err := json.NewEncoder(w).Encode(blobResponse{Data: sidecar}); err != nil {
+		a.logger.Error("unable to encode blob sidecar to JSON", "err", err)
+		errServerError.write(w)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobHandler(t *testing.T) {
+	_, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+	a := NewAPI(fs, beaconClient, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo), WithBlobIndex(fs))
+
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	sidecars := storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 3))
+	data := storage.BlobData{Header: storage.Header{BeaconBlockHash: root}, BlobSidecars: storage.BlobSidecars{Data: sidecars}}
+	require.NoError(t, fs.WriteBlob(context.Background(), data))
+	require.NoError(t, storage.WriteBlobIndex(context.Background(), fs, data))
+
+	// A location whose block is no longer stored
+	dangling := common.Hash{0x01, 0x02}
+	require.NoError(t, fs.WriteBlobLocation(context.Background(), dangling, storage.BlobLocation{BlockRoot: common.Hash{0x03}}))
+
+	// A block that was deleted by the reaper, which leaves the index entries of its blobs
+	pruned := storage.BlobData{Header: storage.Header{BeaconBlockHash: common.Hash{0x04}}, BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}}
+	require.NoError(t, fs.WriteBlob(context.Background(), pruned))
+	require.NoError(t, storage.WriteBlobIndex(context.Background(), fs, pruned))
+	require.NoError(t, fs.DeleteBlob(context.Background(), pruned.Header.BeaconBlockHash))
+
+	tests := []struct {
+		name       string
+		hash       string
+		accept     string
+		status     int
+		expected   *storage.BlobSidecar
+		errMessage string
+	}{
+		{
+			name:     "json",
+			hash:     sidecars[1].VersionedHash().String(),
+			status:   200,
+			expected: sidecars[1],
+		},
+		{
+			name:     "ssz",
+			hash:     sidecars[2].VersionedHash().String(),
+			accept:   sszAcceptType,
+			status:   200,
+			expected: sidecars[2],
+		},
+		{
+			name:       "not indexed",
+			hash:       common.Hash{0x01}.String(),
+			status:     404,
+			errMessage: "Blob not found",
+		},
+		{
+			name:       "block not stored",
+			hash:       dangling.String(),
+			status:     404,
+			errMessage: "Blob not found",
+		},
+		{
+			name:       "block pruned",
+			hash:       pruned.BlobSidecars.Data[0].VersionedHash().String(),
+			status:     404,
+			errMessage: "Blob not found",
+		},
+		{
+			name:       "invalid hash",
+			hash:       "0x1234",
+			status:     400,
+			errMessage: "invalid versioned hash: 0x1234",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/blobs/%s", test.hash), nil)
+			request.Header.Set("Accept", test.accept)
+			response := httptest.NewRecorder()
+
+			a.router.ServeHTTP(response, request)
+
+			require.Equal(t, test.status, response.Code)
+			if test.status != 200 {
+				var e httpError
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+				require.Equal(t, test.errMessage, e.Message)
+				return
+			}
+
+			if test.accept == sszAcceptType {
+				require.Equal(t, sszAcceptType, response.Header().Get("Content-Type"))
+				var sidecar storage.BlobSidecar
+				require.NoError(t, sidecar.UnmarshalSSZ(response.Body.Bytes()))
+				require.Equal(t, test.expected, &sidecar)
+			} else {
+				require.Equal(t, jsonAcceptType, response.Header().Get("Content-Type"))
+				var res blobResponse
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+				require.Equal(t, test.expected, res.Data)
+			}
+		})
+	}
+}
+
+func TestBlobHandler_NoIndex(t *testing.T) {
+	a, _, _, cleanup := setup(t)
+	defer cleanup()
+
+	request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/blobs/%s", common.Hash{0x01}), nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 501, response.Code)
+}
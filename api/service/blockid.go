@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WithInventory resolves the slots that the beacon node does not have a block header for from the inventory kept by
+// the archiver, see storage.Inventory, so that blobs can be requested by slot from before a checkpoint synced beacon
+// node's history starts.
+func WithInventory(inventory storage.Inventory) APIOption {
+	return func(a *API) {
+		a.inventory = inventory
+	}
+}
+
+// inventoryRoot returns the root of the block archived at the slot id, and false if there is no inventory or the slot
+// is not in it.
+func (a *API) inventoryRoot(ctx context.Context, id string) (common.Hash, bool) {
+	if a.inventory == nil {
+		return common.Hash{}, false
+	}
+	slot, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return common.Hash{}, false
+	}
+
+	chunk, err := a.inventory.ReadInventoryChunk(ctx, storage.InventoryChunkStart(slot))
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			a.logger.Info("unexpected error reading inventory", "err", err, "slot", slot)
+		}
+		return common.Hash{}, false
+	}
+
+	entry, ok := chunk.Blocks[slot]
+	return entry.Root, ok
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventoryBlockId(t *testing.T) {
+	_, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+
+	rootOne := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	rootTwo := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890222222")
+	sidecars := map[common.Hash]storage.BlobSidecars{}
+	for _, root := range []common.Hash{rootOne, rootTwo} {
+		sidecars[root] = storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}
+		require.NoError(t, fs.WriteBlob(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: root, Fork: "deneb"},
+			BlobSidecars: sidecars[root],
+		}))
+	}
+	require.NoError(t, fs.WriteInventoryChunk(context.Background(), storage.InventoryChunk{
+		StartSlot: 1024,
+		Blocks:    map[uint64]storage.InventoryEntry{1030: {Root: rootOne}, 1031: {Root: rootOne}},
+	}))
+	// The beacon node is preferred to the inventory for the slots it has a header for
+	beaconClient.Headers["1031"] = &v1.BeaconBlockHeader{Root: phase0.Root(rootTwo)}
+
+	tests := []struct {
+		name      string
+		inventory bool
+		id        string
+		status    int
+		root      common.Hash
+	}{
+		// The stub beacon node fails to find a header with an error that is not a 404
+		{name: "without inventory", id: "1030", status: 500},
+		{name: "from inventory", inventory: true, id: "1030", status: 200, root: rootOne},
+		{name: "from beacon node", inventory: true, id: "1031", status: 200, root: rootTwo},
+		{name: "not in inventory", inventory: true, id: "1032", status: 500},
+		{name: "identifier not in inventory", inventory: true, id: "head", status: 500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opts []APIOption
+			if test.inventory {
+				opts = append(opts, WithInventory(fs))
+			}
+			a := NewAPI(fs, beaconClient, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo), opts...)
+
+			request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", test.id), nil)
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+
+			require.Equal(t, test.status, response.Code)
+			if test.status == 200 {
+				require.Equal(t, "deneb", response.Header().Get("Eth-Consensus-Version"))
+				var result storage.BlobSidecars
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+				require.Equal(t, sidecars[test.root], result)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+func newColumnOutOfRangeError(input uint64) *httpError {
+	return &httpError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("invalid index: %d blocks have %d data columns", input, storage.NumberOfColumns),
+	}
+}
+
+// dataColumnSidecarHandler implements the /eth/v1/debug/beacon/data_column_sidecars/{id} endpoint, serving the stored
+// data column sidecars of a block from fulu on in the same way as blobSidecarHandler serves blob sidecars. Blocks from
+// before fulu, which are stored with blob sidecars, have no data columns.
+func (a *API) dataColumnSidecarHandler(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "id")
+	beaconBlockHash, err := a.toBeaconBlockHash(r.Context(), param)
+	if err != nil {
+		err.write(w)
+		return
+	}
+
+	result, storageErr := a.dataStoreClient.ReadBlob(r.Context(), beaconBlockHash)
+	if storageErr != nil {
+		if errors.Is(storageErr, storage.ErrNotFound) {
+			errUnknownBlock.write(w)
+		} else {
+			a.logger.Info("unexpected error fetching data columns", "err", storageErr, "root", beaconBlockHash.String(), "param", param)
+			errServerError.write(w)
+		}
+		return
+	}
+
+	columns := storage.DataColumnSidecars{Data: []*storage.DataColumnSidecar{}}
+	if result.DataColumnSidecars != nil {
+		columns.Data = result.DataColumnSidecars.Data
+	}
+
+	filteredColumns, err := filterColumns(columns.Data, r.URL.Query()["indices"])
+	if err != nil {
+		err.write(w)
+		return
+	}
+
+	columns.Data = filteredColumns
+	if result.Header.Fork != "" {
+		w.Header().Set("Eth-Consensus-Version", result.Header.Fork)
+	}
+
+	if r.Header.Get("Accept") == sszAcceptType {
+		w.Header().Set("Content-Type", sszAcceptType)
+		res, err := columns.MarshalSSZ()
+		if err != nil {
+			a.logger.Error("unable to marshal data column sidecars to SSZ", "err", err)
+			errServerError.write(w)
+			return
+		}
+
+		if _, err := w.Write(res); err != nil {
+			a.logger.Error("unable to write ssz response", "err", err)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", jsonAcceptType)
+		if err := json.NewEncoder(w).Encode(columns); err != nil {
+			a.logger.Error("unable to encode data column sidecars to JSON", "err", err)
+			errServerError.write(w)
+			return
+		}
+	}
+}
+
+// filterColumns filters the data columns based on the indices query provided, as filterBlobs does the blobs. An index
+// is invalid if it is not below storage.NumberOfColumns, and valid indices of columns that are not stored are left out
+// of the result.
+func filterColumns(columns []*storage.DataColumnSidecar, _indices []string) ([]*storage.DataColumnSidecar, *httpError) {
+	var indices []string
+	if len(_indices) == 0 {
+		return columns, nil
+	} else if len(_indices) == 1 {
+		indices = strings.Split(_indices[0], ",")
+	} else {
+		indices = _indices
+	}
+
+	indicesMap := map[uint64]struct{}{}
+	for _, index := range indices {
+		parsedInt, err := strconv.ParseUint(index, 10, 64)
+		if err != nil {
+			return nil, newIndicesError(index)
+		}
+
+		if parsedInt >= storage.NumberOfColumns {
+			return nil, newColumnOutOfRangeError(parsedInt)
+		}
+
+		indicesMap[parsedInt] = struct{}{}
+	}
+
+	filteredColumns := make([]*storage.DataColumnSidecar, 0)
+	for _, column := range columns {
+		if _, ok := indicesMap[column.Index]; ok {
+			filteredColumns = append(filteredColumns, column)
+		}
+	}
+
+	return filteredColumns, nil
+}
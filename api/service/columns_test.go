@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/blobproof/blobprooftest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataColumnSidecarHandler(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	rootFulu := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	rootDeneb := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890000000")
+	columns := storagetest.NewDataColumnSidecars(t, 2, 0, 5, 127)
+
+	err := fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:             storage.Header{BeaconBlockHash: rootFulu, Fork: "fulu"},
+		BlobSidecars:       storage.BlobSidecars{Data: []*storage.BlobSidecar{}},
+		DataColumnSidecars: &storage.DataColumnSidecars{Data: columns},
+	})
+	require.NoError(t, err)
+	err = fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: rootDeneb},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 2))},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		path       string
+		status     int
+		expected   []*storage.DataColumnSidecar
+		errMessage string
+	}{
+		{
+			name:     "all columns",
+			path:     fmt.Sprintf("/eth/v1/debug/beacon/data_column_sidecars/%s", rootFulu),
+			status:   200,
+			expected: columns,
+		},
+		{
+			name:     "requested indices",
+			path:     fmt.Sprintf("/eth/v1/debug/beacon/data_column_sidecars/%s?indices=127,0,64", rootFulu),
+			status:   200,
+			expected: []*storage.DataColumnSidecar{columns[0], columns[2]},
+		},
+		{
+			name:       "index out of range",
+			path:       fmt.Sprintf("/eth/v1/debug/beacon/data_column_sidecars/%s?indices=128", rootFulu),
+			status:     400,
+			errMessage: "invalid index: 128 blocks have 128 data columns",
+		},
+		{
+			name:       "invalid index",
+			path:       fmt.Sprintf("/eth/v1/debug/beacon/data_column_sidecars/%s?indices=abc", rootFulu),
+			status:     400,
+			errMessage: "invalid index input: abc",
+		},
+		{
+			name:     "block before fulu",
+			path:     fmt.Sprintf("/eth/v1/debug/beacon/data_column_sidecars/%s", rootDeneb),
+			status:   200,
+			expected: []*storage.DataColumnSidecar{},
+		},
+		{
+			name:       "unknown block",
+			path:       "/eth/v1/debug/beacon/data_column_sidecars/0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abc111",
+			status:     404,
+			errMessage: "Block not found",
+		},
+	}
+
+	for _, test := range tests {
+		for _, accept := range []string{jsonAcceptType, sszAcceptType} {
+			t.Run(test.name+" "+accept, func(t *testing.T) {
+				request := httptest.NewRequest("GET", test.path, nil)
+				request.Header.Set("Accept", accept)
+				response := httptest.NewRecorder()
+
+				a.router.ServeHTTP(response, request)
+
+				require.Equal(t, test.status, response.Code)
+				if test.status != 200 {
+					var e httpError
+					require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+					require.Equal(t, test.errMessage, e.Message)
+					return
+				}
+
+				require.Equal(t, accept, response.Header().Get("Content-Type"))
+				var result storage.DataColumnSidecars
+				if accept == sszAcceptType {
+					require.NoError(t, result.UnmarshalSSZ(response.Body.Bytes()))
+				} else {
+					require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+				}
+				require.Equal(t, test.expected, result.Data)
+			})
+		}
+	}
+
+	// The fork of the columns is reported as it is for blob sidecars
+	request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/debug/beacon/data_column_sidecars/%s", rootFulu), nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, "fulu", response.Header().Get("Eth-Consensus-Version"))
+}
+
+func TestBlobEndpoints_DataColumns(t *testing.T) {
+	require.NoError(t, blobproof.Configure(blobproof.Config{TrustedSetupPath: blobprooftest.WriteSetup(t)}))
+	t.Cleanup(func() { require.NoError(t, blobproof.Configure(blobproof.Config{})) })
+	_, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+	a := NewAPI(fs, beaconClient, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo), WithBlobIndex(fs))
+
+	// The block is stored with the second half of its columns, so its blobs must be recovered
+	header := &phase0.BeaconBlockHeader{Slot: 7}
+	blobs := blobprooftest.NewBlobs(t, 3)
+	var indices []uint64
+	for i := uint64(storage.NumberOfColumns / 2); i < storage.NumberOfColumns; i++ {
+		indices = append(indices, i)
+	}
+	columns := blobprooftest.NewDataColumnSidecars(t, header, blobs, indices...)
+	blockRoot, err := header.HashTreeRoot()
+	require.NoError(t, err)
+	root := common.Hash(blockRoot)
+	data := storage.BlobData{
+		Header:             storage.Header{BeaconBlockHash: root, Fork: "fulu"},
+		BlobSidecars:       storage.BlobSidecars{Data: []*storage.BlobSidecar{}},
+		DataColumnSidecars: &storage.DataColumnSidecars{Data: columns},
+	}
+	require.NoError(t, fs.WriteBlob(context.Background(), data))
+	require.NoError(t, storage.WriteBlobIndex(context.Background(), fs, data))
+
+	// A block stored before its columns were checked, with too few of them to recover its blobs from
+	rootPartial := common.Hash{0x0a}
+	require.NoError(t, fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:             storage.Header{BeaconBlockHash: rootPartial, Fork: "fulu"},
+		BlobSidecars:       storage.BlobSidecars{Data: []*storage.BlobSidecar{}},
+		DataColumnSidecars: &storage.DataColumnSidecars{Data: columns[:8]},
+	}))
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Accept", accept)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+	// checkSidecars checks that the sidecars are those of the blobs at the indices, with valid proofs
+	checkSidecars := func(sidecars []*storage.BlobSidecar, indices ...int) {
+		require.Len(t, sidecars, len(indices))
+		for i, sidecar := range sidecars {
+			require.Equal(t, deneb.BlobIndex(indices[i]), sidecar.Index)
+			require.Equal(t, deneb.Blob(blobs[indices[i]]), sidecar.Blob)
+			require.Equal(t, header, sidecar.SignedBlockHeader.Message)
+			require.NoError(t, blobproof.VerifyInclusionProof(sidecar, "fulu"))
+		}
+		require.NoError(t, blobproof.VerifyBlobsBatch(sidecars))
+	}
+
+	for _, accept := range []string{jsonAcceptType, sszAcceptType} {
+		response := get(fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root), accept)
+		require.Equal(t, 200, response.Code)
+		require.Equal(t, "fulu", response.Header().Get("Eth-Consensus-Version"))
+		var result storage.BlobSidecars
+		if accept == sszAcceptType {
+			require.NoError(t, result.UnmarshalSSZ(response.Body.Bytes()))
+		} else {
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+		}
+		checkSidecars(result.Data, 0, 1, 2)
+	}
+
+	response := get(fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s?indices=2,5", root), jsonAcceptType)
+	require.Equal(t, 200, response.Code)
+	var result storage.BlobSidecars
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+	checkSidecars(result.Data, 2)
+
+	response = get(fmt.Sprintf("/blob_archiver/v1/blob_proofs/%s?indices=0,2", root), jsonAcceptType)
+	require.Equal(t, 200, response.Code)
+	var bundle blobproof.Bundle
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &bundle))
+	require.NoError(t, bundle.Verify(root))
+	require.Len(t, bundle.Blobs, 2)
+
+	response = get(fmt.Sprintf("/blob_archiver/v1/blob_proofs/%s?indices=5", root), jsonAcceptType)
+	require.Equal(t, 400, response.Code)
+	require.Contains(t, response.Body.String(), "the block has 3 blobs")
+
+	response = get(fmt.Sprintf("/eth/v1/blobs/%s", data.DataColumnSidecars.VersionedHashes()[1]), jsonAcceptType)
+	require.Equal(t, 200, response.Code)
+	var blob blobResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &blob))
+	checkSidecars([]*storage.BlobSidecar{blob.Data}, 1)
+
+	// The blobs of a block that cannot be recovered are an error, not a block without blobs
+	for _, path := range []string{"/eth/v1/beacon/blob_sidecars/%s", "/blob_archiver/v1/blob_proofs/%s"} {
+		response := get(fmt.Sprintf(path, rootPartial), jsonAcceptType)
+		require.Equal(t, 500, response.Code)
+		var e httpError
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+		require.Equal(t, "Blobs cannot be recovered from the stored data columns", e.Message)
+	}
+}
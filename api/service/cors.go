@@ -0,0 +1,102 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/base-org/blob-archiver/api/flags"
+)
+
+var errCORSNotAllowed = &httpError{
+	Code:    http.StatusForbidden,
+	Message: "Cross-origin request not allowed",
+}
+
+// WithCORS serves CORS headers to the origins allowed by cfg, so that web apps on those origins can fetch from the API,
+// and answers their preflight OPTIONS requests. No CORS headers are served if no origins are allowed, which is the
+// default, so browsers only allow requests from the same origin.
+func WithCORS(cfg flags.CORSConfig) APIOption {
+	return func(a *API) {
+		a.cors = cfg
+	}
+}
+
+// corsMiddleware adds the CORS headers to the responses to requests from the origins allowed by cfg, and answers
+// preflight requests without passing them on. Preflight requests for an origin, method or header that is not allowed
+// are answered with errCORSNotAllowed and no CORS headers, which browsers reject.
+func corsMiddleware(cfg flags.CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin, origins := corsSet(cfg.AllowedOrigins, strings.ToLower)
+	_, methods := corsSet(cfg.AllowedMethods, strings.ToUpper)
+	anyHeader, headers := corsSet(cfg.AllowedHeaders, http.CanonicalHeaderKey)
+	allowedMethods := strings.Join(cfg.AllowedMethods, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The response depends on the origin unless every origin is allowed, so caches must not share it
+			if !anyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+			allowed := anyOrigin || origins[strings.ToLower(origin)]
+
+			if !preflight {
+				if allowed {
+					w.Header().Set("Access-Control-Allow-Origin", allowOrigin(anyOrigin, origin))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if !allowed || !methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+				errCORSNotAllowed.write(w)
+				return
+			}
+
+			requested := r.Header.Get("Access-Control-Request-Headers")
+			for _, header := range strings.Split(requested, ",") {
+				header = strings.TrimSpace(header)
+				if header != "" && !anyHeader && !headers[http.CanonicalHeaderKey(header)] {
+					errCORSNotAllowed.write(w)
+					return
+				}
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin(anyOrigin, origin))
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			if requested != "" {
+				// Echoing the requested headers also covers a wildcard, which browsers ignore for some headers
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// corsSet returns whether values contains "*", and the set of values normalized by normalize.
+func corsSet(values []string, normalize func(string) string) (bool, map[string]bool) {
+	wildcard := false
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "*" {
+			wildcard = true
+		}
+		set[normalize(value)] = true
+	}
+	return wildcard, set
+}
+
+func allowOrigin(anyOrigin bool, origin string) string {
+	if anyOrigin {
+		return "*"
+	}
+	return origin
+}
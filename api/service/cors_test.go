@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+var testCORSConfig = flags.CORSConfig{
+	AllowedOrigins: []string{"https://explorer.example"},
+	AllowedMethods: []string{http.MethodGet, http.MethodHead},
+	AllowedHeaders: []string{"Accept", "Cache-Control"},
+}
+
+// setupCORS returns an API with cfg that serves a block with blobs, and the path of the block's sidecars.
+func setupCORS(t *testing.T, cfg flags.CORSConfig) (*API, string) {
+	_, fs, beaconClient, cleanup := setup(t)
+	t.Cleanup(cleanup)
+
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	err := fs.WriteBlob(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))},
+	})
+	require.NoError(t, err)
+
+	a := NewAPI(fs, beaconClient, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo), WithCORS(cfg))
+	return a, fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root)
+}
+
+func preflight(origin, method, headers, path string) *http.Request {
+	request := httptest.NewRequest(http.MethodOptions, path, nil)
+	request.Header.Set("Origin", origin)
+	request.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		request.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return request
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	a, path := setupCORS(t, testCORSConfig)
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{"allowed", "https://explorer.example", http.MethodGet, "accept, cache-control", true},
+		{"no headers", "https://explorer.example", http.MethodGet, "", true},
+		{"other origin", "https://other.example", http.MethodGet, "", false},
+		{"method not allowed", "https://explorer.example", http.MethodPost, "", false},
+		{"header not allowed", "https://explorer.example", http.MethodGet, "Accept, Authorization", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, preflight(test.origin, test.method, test.headers, path))
+
+			require.Contains(t, response.Header().Values("Vary"), "Origin")
+			if !test.allowed {
+				require.Equal(t, http.StatusForbidden, response.Code)
+				require.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+				return
+			}
+
+			require.Equal(t, http.StatusNoContent, response.Code)
+			require.Equal(t, test.origin, response.Header().Get("Access-Control-Allow-Origin"))
+			require.Equal(t, "GET, HEAD", response.Header().Get("Access-Control-Allow-Methods"))
+			require.Equal(t, test.headers, response.Header().Get("Access-Control-Allow-Headers"))
+			require.Empty(t, response.Body.Bytes())
+		})
+	}
+}
+
+func TestCORS_Request(t *testing.T) {
+	a, path := setupCORS(t, testCORSConfig)
+
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Origin", "https://explorer.example")
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "https://explorer.example", response.Header().Get("Access-Control-Allow-Origin"))
+	require.Contains(t, response.Header().Values("Vary"), "Origin")
+
+	// The request is served to other origins, but browsers do not let their web apps read the response
+	request = httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Origin", "https://other.example")
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+
+	// Errors carry the headers too, so that web apps can read them
+	request = httptest.NewRequest(http.MethodGet, "/eth/v1/beacon/blob_sidecars/unknown", nil)
+	request.Header.Set("Origin", "https://explorer.example")
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+	require.Equal(t, "https://explorer.example", response.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	cfg := testCORSConfig
+	cfg.AllowedOrigins = []string{"*"}
+	cfg.AllowedHeaders = []string{"*"}
+	a, path := setupCORS(t, cfg)
+
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, preflight("https://other.example", http.MethodGet, "X-Custom", path))
+	require.Equal(t, http.StatusNoContent, response.Code)
+	require.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "X-Custom", response.Header().Get("Access-Control-Allow-Headers"))
+	require.NotContains(t, response.Header().Values("Vary"), "Origin")
+}
+
+func TestCORS_Disabled(t *testing.T) {
+	a, path := setupCORS(t, flags.CORSConfig{})
+
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, preflight("https://explorer.example", http.MethodGet, "", path))
+	require.Equal(t, http.StatusMethodNotAllowed, response.Code)
+	require.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Origin", "https://explorer.example")
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSConfig_Check(t *testing.T) {
+	require.NoError(t, flags.CORSConfig{}.Check())
+	require.NoError(t, testCORSConfig.Check())
+
+	cfg := testCORSConfig
+	cfg.AllowedOrigins = []string{"*", "http://localhost:3000"}
+	require.NoError(t, cfg.Check())
+
+	for _, origin := range []string{"explorer.example", "https://explorer.example/path", "https://user@explorer.example"} {
+		cfg.AllowedOrigins = []string{origin}
+		require.Error(t, cfg.Check(), origin)
+	}
+
+	cfg = testCORSConfig
+	cfg.AllowedMethods = nil
+	require.ErrorContains(t, cfg.Check(), "at least one method")
+}
@@ -61,18 +61,34 @@ func Main() cliapp.LifecycleAction {
 			return nil, err
 		}
 
-		storageClient, err := storage.NewStorage(cfg.StorageConfig, l)
+		storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
 		if err != nil {
 			return nil, err
 		}
 
+		if len(cfg.Replicas) > 0 {
+			var replicas []storage.Replica
+			for _, replicaCfg := range cfg.Replicas {
+				name := replicaCfg.Backend()
+				replica, err := storage.NewStorage(replicaCfg, l.New("component", "storage", "replica", name))
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize storage replica %s: %w", name, err)
+				}
+				replicas = append(replicas, storage.Replica{Name: name, Store: replica})
+			}
+			storageClient = storage.NewReplicatedStorage(cfg.StorageConfig.Backend(), storageClient, replicas, cfg.ReplicationPolicy, m, l.New("component", "storage"))
+		}
+
+		// Writes of the same block, e.g. a re-archive after a reorg and a retry, are applied in the order they were made
+		storageClient = storage.NewOrderedStorage(storageClient, storage.DefaultWriteConcurrency)
+
 		l.Info("Initializing Archiver Service")
-		archiver, err := service.NewArchiver(l, cfg, storageClient, beaconClient, m)
+		archiver, err := service.NewArchiver(l.New("component", "archiver"), cfg, storageClient, beaconClient, m)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize archiver: %w", err)
 		}
 
-		api := service.NewAPI(m, l, archiver)
+		api := service.NewAPI(m, l.New("component", "api"), archiver)
 
 		return service.NewService(l, cfg, api, archiver, m)
 	}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	geth "github.com/ethereum/go-ethereum/common"
@@ -20,6 +21,64 @@ type ArchiverConfig struct {
 	PollInterval  time.Duration
 	OriginBlock   geth.Hash
 	ListenAddr    string
+	// SkipEmptyBlobs stores blocks without blobs as an empty tombstone, see storage.DataStoreWriter.WriteEmptyBlob
+	SkipEmptyBlobs bool
+	// StoreBlockHeaders stores the signed header of each block with its blobs, see storage.Header
+	StoreBlockHeaders bool
+	// IndexBlobs writes the location of each blob by its versioned hash, see storage.BlobIndexer
+	IndexBlobs bool
+	// Inventory maintains a manifest of the archived blocks in storage, see storage.Inventory
+	Inventory bool
+	// BackfillMaxMemory is the approximate maximum number of bytes of blob sidecars held in memory, 0 is unlimited
+	BackfillMaxMemory uint64
+	// RetryBudgetRatio is the maximum ratio of retries to requests, 0 disables the retry budget
+	RetryBudgetRatio float64
+	RetryBudgetBurst int
+	// RateLimitBackoff is how long all requests to the beacon node are paused for when it rate limits one, doubling up
+	// to RateLimitMaxBackoff while it keeps rate limiting them. 0 disables the pause
+	RateLimitBackoff    time.Duration
+	RateLimitMaxBackoff time.Duration
+	// BackfillRetryAttempts is the number of attempts at a block that fails during backfill, in the background with
+	// backoff, before it is given up on. 0 retries the block inline until it succeeds
+	BackfillRetryAttempts int
+	// BackfillConcurrency is the number of slots of the backfill range stored concurrently
+	BackfillConcurrency int
+	// BackfillStartSlot is the first slot of a range backfilled by slot number, 0 disables the range backfill
+	BackfillStartSlot uint64
+	// BackfillEndSlot is the last slot of the backfill range, 0 ends it at the head
+	BackfillEndSlot uint64
+	// CompactionInterval is the interval at which file storage is compacted, 0 disables compaction
+	CompactionInterval    time.Duration
+	CompactionTempFileAge time.Duration
+	// UsageInterval is the interval at which the usage of storage is measured, 0 disables the measurement
+	UsageInterval time.Duration
+	// UsageStallWindow is how long the number of stored blocks may stay the same before storage is flagged as stalled
+	UsageStallWindow time.Duration
+	// UsageMinGrowth is the expected minimum number of blocks stored per hour, not checked if 0
+	UsageMinGrowth float64
+	// ObjectTTL is how long after it is written that a block expires, see storage.Header.ExpiresAt, 0 never expires
+	ObjectTTL time.Duration
+	// RetentionSlots is the number of slots behind the head that blocks are kept for, 0 keeps them forever
+	RetentionSlots uint64
+	// ReapInterval is the interval at which expired blocks and blocks older than RetentionSlots are deleted from
+	// storage, 0 disables the reaper
+	ReapInterval time.Duration
+	// ConfirmationDepth is the number of slots a block must be behind the head before it is written to storage, until
+	// then it is held in memory. 0 writes blocks as soon as they are fetched, unless WaitForFinality is set
+	ConfirmationDepth uint64
+	// WaitForFinality holds blocks in memory until they are finalized before writing them to storage
+	WaitForFinality bool
+	// DuplicateIndices is how blob sidecars with the same index in a response from the beacon node are handled
+	DuplicateIndices    storage.DuplicateIndices
+	duplicateIndicesErr error
+	// Replicas are the backends that every block is also written to, see storage.ReplicatedStorage
+	Replicas             []common.StorageConfig
+	replicasErr          error
+	ReplicationPolicy    storage.ReplicationPolicy
+	replicationPolicyErr error
+	// AdminToken is the bearer token for the admin endpoints, they are disabled if it is empty
+	AdminToken     string
+	AdminRateLimit float64
 }
 
 func (c ArchiverConfig) Check() error {
@@ -39,6 +98,60 @@ func (c ArchiverConfig) Check() error {
 		return fmt.Errorf("invalid origin block %s", c.OriginBlock)
 	}
 
+	if c.RetryBudgetRatio < 0 {
+		return fmt.Errorf("retry budget ratio must not be negative")
+	}
+
+	if c.RateLimitBackoff < 0 || c.RateLimitMaxBackoff < 0 {
+		return fmt.Errorf("rate limit backoff must not be negative")
+	}
+
+	if c.BackfillRetryAttempts < 0 {
+		return fmt.Errorf("backfill retry attempts must not be negative")
+	}
+
+	if c.BackfillConcurrency < 1 {
+		return fmt.Errorf("backfill concurrency must be at least 1")
+	}
+
+	if c.BackfillEndSlot != 0 && c.BackfillEndSlot < c.BackfillStartSlot {
+		return fmt.Errorf("backfill end slot %d must not be before the start slot %d", c.BackfillEndSlot, c.BackfillStartSlot)
+	}
+
+	if c.UsageInterval < 0 || c.UsageStallWindow < 0 || c.UsageMinGrowth < 0 {
+		return fmt.Errorf("usage interval, stall window and minimum growth must not be negative")
+	}
+
+	if c.ObjectTTL < 0 || c.ReapInterval < 0 {
+		return fmt.Errorf("object ttl and reap interval must not be negative")
+	}
+
+	if c.ConfirmationDepth > 0 && c.WaitForFinality {
+		return fmt.Errorf("confirmation depth and waiting for finality cannot both be set")
+	}
+
+	if c.duplicateIndicesErr != nil {
+		return c.duplicateIndicesErr
+	}
+
+	if c.replicasErr != nil {
+		return fmt.Errorf("invalid storage replicas: %w", c.replicasErr)
+	}
+
+	for _, replica := range c.Replicas {
+		if err := replica.Check(); err != nil {
+			return fmt.Errorf("storage replica %s: %w", replica.Backend(), err)
+		}
+	}
+
+	if c.replicationPolicyErr != nil {
+		return c.replicationPolicyErr
+	}
+
+	if c.AdminRateLimit <= 0 {
+		return fmt.Errorf("admin rate limit must be positive, got %v", c.AdminRateLimit)
+	}
+
 	if c.ListenAddr == "" {
 		return fmt.Errorf("archiver listen address must be set")
 	}
@@ -48,13 +161,58 @@ func (c ArchiverConfig) Check() error {
 
 func ReadConfig(cliCtx *cli.Context) ArchiverConfig {
 	pollInterval, _ := time.ParseDuration(cliCtx.String(ArchiverPollIntervalFlag.Name))
+	duplicateIndices, duplicateIndicesErr := storage.ParseDuplicateIndices(cliCtx.String(DuplicateIndicesFlag.Name))
+	storageConfig := common.NewStorageConfig(cliCtx)
+	replicas, replicasErr := common.ParseBackends(cliCtx.String(StorageReplicasFlag.Name), storageConfig)
+	replicationPolicy, replicationPolicyErr := storage.ParseReplicationPolicy(cliCtx.String(ReplicationPolicyFlag.Name))
 	return ArchiverConfig{
 		LogConfig:     oplog.ReadCLIConfig(cliCtx),
 		MetricsConfig: opmetrics.ReadCLIConfig(cliCtx),
 		BeaconConfig:  common.NewBeaconConfig(cliCtx),
-		StorageConfig: common.NewStorageConfig(cliCtx),
+		StorageConfig: storageConfig,
 		PollInterval:  pollInterval,
 		OriginBlock:   geth.HexToHash(strings.Trim(cliCtx.String(ArchiverOriginBlock.Name), "\"")),
 		ListenAddr:    cliCtx.String(ArchiverListenAddrFlag.Name),
+
+		SkipEmptyBlobs:    cliCtx.Bool(ArchiverSkipEmptyBlobsFlag.Name),
+		StoreBlockHeaders: cliCtx.Bool(ArchiverStoreBlockHeadersFlag.Name),
+		IndexBlobs:        cliCtx.Bool(ArchiverIndexBlobsFlag.Name),
+		Inventory:         cliCtx.Bool(ArchiverInventoryFlag.Name),
+		BackfillMaxMemory: cliCtx.Uint64(BackfillMaxMemoryFlag.Name) * 1024 * 1024,
+		RetryBudgetRatio:  cliCtx.Float64(RetryBudgetRatioFlag.Name),
+		RetryBudgetBurst:  cliCtx.Int(RetryBudgetBurstFlag.Name),
+
+		RateLimitBackoff:    cliCtx.Duration(RateLimitBackoffFlag.Name),
+		RateLimitMaxBackoff: cliCtx.Duration(RateLimitMaxBackoffFlag.Name),
+
+		BackfillRetryAttempts: cliCtx.Int(BackfillRetryAttemptsFlag.Name),
+		BackfillConcurrency:   cliCtx.Int(BackfillConcurrencyFlag.Name),
+		BackfillStartSlot:     cliCtx.Uint64(BackfillStartSlotFlag.Name),
+		BackfillEndSlot:       cliCtx.Uint64(BackfillEndSlotFlag.Name),
+
+		CompactionInterval:    cliCtx.Duration(FileCompactionIntervalFlag.Name),
+		CompactionTempFileAge: cliCtx.Duration(FileCompactionTempAgeFlag.Name),
+
+		UsageInterval:    cliCtx.Duration(UsageIntervalFlag.Name),
+		UsageStallWindow: cliCtx.Duration(UsageStallWindowFlag.Name),
+		UsageMinGrowth:   cliCtx.Float64(UsageMinGrowthFlag.Name),
+
+		ObjectTTL:      cliCtx.Duration(ObjectTTLFlag.Name),
+		RetentionSlots: cliCtx.Uint64(RetentionSlotsFlag.Name),
+		ReapInterval:   cliCtx.Duration(ReapIntervalFlag.Name),
+
+		ConfirmationDepth: cliCtx.Uint64(ConfirmationDepthFlag.Name),
+		WaitForFinality:   cliCtx.Bool(WaitForFinalityFlag.Name),
+
+		DuplicateIndices:    duplicateIndices,
+		duplicateIndicesErr: duplicateIndicesErr,
+
+		Replicas:             replicas,
+		replicasErr:          replicasErr,
+		ReplicationPolicy:    replicationPolicy,
+		replicationPolicyErr: replicationPolicyErr,
+
+		AdminToken:     cliCtx.String(AdminTokenFlag.Name),
+		AdminRateLimit: cliCtx.Float64(AdminRateLimitFlag.Name),
 	}
 }
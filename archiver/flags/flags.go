@@ -1,9 +1,10 @@
 package flags
 
 import (
+	"time"
+
 	common "github.com/base-org/blob-archiver/common/flags"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
-	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/urfave/cli/v2"
 )
@@ -23,6 +24,160 @@ var (
 		Required: true,
 		EnvVars:  opservice.PrefixEnvVar(EnvVarPrefix, "ORIGIN_BLOCK"),
 	}
+	BackfillMaxMemoryFlag = &cli.Uint64Flag{
+		Name:    "backfill-max-memory",
+		Usage:   "The approximate maximum MiB of blob sidecars to hold in memory while archiving, new fetches wait when it is exceeded. 0 disables the limit",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BACKFILL_MAX_MEMORY"),
+		Value:   0,
+	}
+	ArchiverSkipEmptyBlobsFlag = &cli.BoolFlag{
+		Name:    "archiver-skip-empty-blobs",
+		Usage:   "Store an empty tombstone instead of the encoded blob data for blocks with no blobs. Stored blocks are read back as having no blobs either way",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "SKIP_EMPTY_BLOBS"),
+	}
+	ArchiverStoreBlockHeadersFlag = &cli.BoolFlag{
+		Name:    "archiver-store-block-headers",
+		Usage:   "Store the signed beacon block header of each block alongside its blobs, so that the archive can be verified without a beacon node",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STORE_BLOCK_HEADERS"),
+	}
+	ArchiverIndexBlobsFlag = &cli.BoolFlag{
+		Name:    "archiver-index-blobs",
+		Usage:   "Write an index from the versioned hash of each blob to its block, so that the API can serve blobs by versioned hash",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "INDEX_BLOBS"),
+	}
+	ArchiverInventoryFlag = &cli.BoolFlag{
+		Name:    "archiver-inventory",
+		Usage:   "Maintain an inventory of the slots and roots of the archived blocks in storage, served by the /admin/inventory and /admin/gaps endpoints",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "INVENTORY"),
+	}
+	RetryBudgetRatioFlag = &cli.Float64Flag{
+		Name:    "retry-budget-ratio",
+		Usage:   "The maximum ratio of retries to requests made to the beacon node, shared by all requests to avoid retry storms. 0 disables the budget",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RETRY_BUDGET_RATIO"),
+		Value:   0.1,
+	}
+	RetryBudgetBurstFlag = &cli.IntFlag{
+		Name:    "retry-budget-burst",
+		Usage:   "The number of retries that can be made at once before the retry budget ratio applies",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RETRY_BUDGET_BURST"),
+		Value:   10,
+	}
+	RateLimitBackoffFlag = &cli.DurationFlag{
+		Name:    "rate-limit-backoff",
+		Usage:   "How long all requests to the beacon node are paused for when it rate limits a request with a 429, doubling for each pause that is followed by another 429. 0 disables the shared backoff",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMIT_BACKOFF"),
+		Value:   time.Second,
+	}
+	RateLimitMaxBackoffFlag = &cli.DurationFlag{
+		Name:    "rate-limit-max-backoff",
+		Usage:   "The longest that all requests to the beacon node are paused for when it rate limits requests",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMIT_MAX_BACKOFF"),
+		Value:   time.Minute,
+	}
+	BackfillRetryAttemptsFlag = &cli.IntFlag{
+		Name:    "backfill-retry-attempts",
+		Usage:   "The number of attempts at storing a block that fails during backfill. Failed blocks are re-attempted in the background with exponential backoff while the backfill continues, and reported on /status once the attempts are exhausted. 0 retries failed blocks inline until they succeed",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BACKFILL_RETRY_ATTEMPTS"),
+		Value:   5,
+	}
+	BackfillConcurrencyFlag = &cli.IntFlag{
+		Name:    "backfill-concurrency",
+		Usage:   "The number of slots of the backfill range that are stored concurrently",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BACKFILL_CONCURRENCY"),
+		Value:   4,
+	}
+	BackfillStartSlotFlag = &cli.Uint64Flag{
+		Name:    "backfill-start-slot",
+		Usage:   "The first slot of a range of slots to backfill by slot number with backfill-concurrency workers, in addition to walking back from the head to the last stored block. Progress is checkpointed in storage, so the backfill resumes where it left off after a restart. 0 disables the range backfill",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BACKFILL_START_SLOT"),
+	}
+	BackfillEndSlotFlag = &cli.Uint64Flag{
+		Name:    "backfill-end-slot",
+		Usage:   "The last slot of the backfill range. 0 ends the range at the head when the range is first backfilled",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BACKFILL_END_SLOT"),
+	}
+	FileCompactionIntervalFlag = &cli.DurationFlag{
+		Name:    "file-compaction-interval",
+		Usage:   "The interval at which the file storage directory is compacted, removing stale temporary files and empty directories. 0 disables compaction",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "FILE_COMPACTION_INTERVAL"),
+		Value:   time.Hour,
+	}
+	FileCompactionTempAgeFlag = &cli.DurationFlag{
+		Name:    "file-compaction-temp-age",
+		Usage:   "The age after which a temporary file left by a crashed write is removed during compaction",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "FILE_COMPACTION_TEMP_AGE"),
+		Value:   time.Hour,
+	}
+	UsageIntervalFlag = &cli.DurationFlag{
+		Name:    "usage-interval",
+		Usage:   "The interval at which the number and total size of stored blocks are measured, by listing every object in storage, and checked for a drop or stall. 0 disables the measurement",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "USAGE_INTERVAL"),
+	}
+	UsageStallWindowFlag = &cli.DurationFlag{
+		Name:    "usage-stall-window",
+		Usage:   "How long the number of stored blocks may stay the same before storage is flagged as stalled",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "USAGE_STALL_WINDOW"),
+		Value:   30 * time.Minute,
+	}
+	UsageMinGrowthFlag = &cli.Float64Flag{
+		Name:    "usage-min-growth",
+		Usage:   "The expected minimum growth of storage, in blocks per hour, below which it is flagged as growing slowly. 0 disables the check",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "USAGE_MIN_GROWTH"),
+	}
+	ObjectTTLFlag = &cli.DurationFlag{
+		Name:    "object-ttl",
+		Usage:   "How long after a block is written to storage that it expires, written into the stored block so that the reaper deletes it once it is finalized. 0 stores blocks without an expiry",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "OBJECT_TTL"),
+	}
+	RetentionSlotsFlag = &cli.Uint64Flag{
+		Name:    "retention-slots",
+		Usage:   "The number of slots behind the head that blocks are kept in storage for. Older blocks are deleted by the reaper once they are finalized, and are not backfilled. 0 keeps blocks forever",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RETENTION_SLOTS"),
+	}
+	ReapIntervalFlag = &cli.DurationFlag{
+		Name:    "reap-interval",
+		Usage:   "The interval at which storage is searched for expired blocks and blocks older than the retention window to delete, by listing every object in storage. 0 disables the reaper",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "REAP_INTERVAL"),
+		Value:   time.Hour,
+	}
+	ConfirmationDepthFlag = &cli.Uint64Flag{
+		Name:    "archiver-confirmation-depth",
+		Usage:   "The number of slots a block must be behind the head before its blobs are written to storage, so that blocks that are reorged out are not stored. Until then the blobs are held in memory, and are fetched again after a restart. 0 writes blobs as soon as they are fetched",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CONFIRMATION_DEPTH"),
+	}
+	WaitForFinalityFlag = &cli.BoolFlag{
+		Name:    "archiver-wait-for-finality",
+		Usage:   "Hold the blobs of each block in memory until the block is finalized before writing them to storage. Cannot be used with a confirmation depth",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WAIT_FOR_FINALITY"),
+	}
+	DuplicateIndicesFlag = &cli.StringFlag{
+		Name:    "archiver-duplicate-indices",
+		Usage:   "How blob sidecars with the same index in a response from the beacon node are handled: error rejects the response, keep-first and keep-last keep the first or last sidecar with each index. Duplicates are logged and counted either way",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DUPLICATE_INDICES"),
+		Value:   "error",
+	}
+	StorageReplicasFlag = &cli.StringFlag{
+		Name:    "storage-replicas",
+		Usage:   "A comma-separated list of backends that every block is also written to, each file:<directory>, or s3:, gcs: or azure: followed by <bucket>[/<path>], e.g. file:/mirror,s3:replica-bucket. The connection settings of the storage flags are used for each. Blocks are only read from the primary storage",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STORAGE_REPLICAS"),
+	}
+	ReplicationPolicyFlag = &cli.StringFlag{
+		Name:    "replication-policy",
+		Usage:   "When a write to the primary storage and its replicas succeeds: all requires every backend to succeed, so that a failed block is retried, any requires at least one to, so that an outage of a backend does not stall archiving",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "REPLICATION_POLICY"),
+		Value:   "all",
+	}
+	AdminTokenFlag = &cli.StringFlag{
+		Name:    "admin-token",
+		Usage:   "The bearer token required to use the admin endpoints, the admin endpoints are disabled if unset",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "ADMIN_TOKEN"),
+	}
+	AdminRateLimitFlag = &cli.Float64Flag{
+		Name:    "admin-rate-limit",
+		Usage:   "The maximum number of admin requests per second, including requests with a wrong token. Must be positive",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "ADMIN_RATE_LIMIT"),
+		Value:   1,
+	}
 	ArchiverListenAddrFlag = &cli.StringFlag{
 		Name:    "archiver-listen-address",
 		Usage:   "The address to list for new requests on",
@@ -34,8 +189,8 @@ var (
 func init() {
 	Flags = append(Flags, common.CLIFlags(EnvVarPrefix)...)
 	Flags = append(Flags, opmetrics.CLIFlags(EnvVarPrefix)...)
-	Flags = append(Flags, oplog.CLIFlags(EnvVarPrefix)...)
-	Flags = append(Flags, ArchiverPollIntervalFlag, ArchiverOriginBlock, ArchiverListenAddrFlag)
+	Flags = append(Flags, common.LogFlags(EnvVarPrefix)...)
+	Flags = append(Flags, ArchiverPollIntervalFlag, ArchiverOriginBlock, ArchiverListenAddrFlag, ArchiverSkipEmptyBlobsFlag, ArchiverStoreBlockHeadersFlag, ArchiverIndexBlobsFlag, ArchiverInventoryFlag, BackfillMaxMemoryFlag, RetryBudgetRatioFlag, RetryBudgetBurstFlag, RateLimitBackoffFlag, RateLimitMaxBackoffFlag, BackfillRetryAttemptsFlag, BackfillConcurrencyFlag, BackfillStartSlotFlag, BackfillEndSlotFlag, FileCompactionIntervalFlag, FileCompactionTempAgeFlag, UsageIntervalFlag, UsageStallWindowFlag, UsageMinGrowthFlag, ObjectTTLFlag, RetentionSlotsFlag, ReapIntervalFlag, ConfirmationDepthFlag, WaitForFinalityFlag, DuplicateIndicesFlag, StorageReplicasFlag, ReplicationPolicyFlag, AdminTokenFlag, AdminRateLimitFlag)
 }
 
 // Flags contains the list of configuration options available to the binary.
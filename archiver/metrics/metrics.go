@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"strings"
+	"time"
+
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,17 +17,84 @@ var (
 	BlockSourceBackfill  BlockSource = "backfill"
 	BlockSourceLive      BlockSource = "live"
 	BlockSourceRearchive BlockSource = "rearchive"
+	BlockSourceAdmin     BlockSource = "admin"
+
+	// ForkUnknown is the fork label of blobs whose fork could not be determined, or is not one of KnownForks
+	ForkUnknown = "unknown"
+	// KnownForks are the forks that stored blobs are labeled with, any other fork is labeled ForkUnknown so that the
+	// number of series stays bounded
+	KnownForks = []string{"deneb", "electra", "fulu"}
 )
 
+// ForkLabel returns the label that blobs from the given fork, e.g. "Deneb", are recorded under.
+func ForkLabel(fork string) string {
+	fork = strings.ToLower(fork)
+	for _, known := range KnownForks {
+		if fork == known {
+			return known
+		}
+	}
+	return ForkUnknown
+}
+
 type Metricer interface {
 	Registry() *prometheus.Registry
 	RecordProcessedBlock(source BlockSource)
-	RecordStoredBlobs(count int)
+	// RecordStoredBlobs records that count blobs from the given fork have been stored, see ForkLabel
+	RecordStoredBlobs(fork string, count int)
+	RecordInFlightBytes(bytes uint64)
+	RecordRetryDropped()
+	RecordArchivalLatency(source BlockSource, latency time.Duration)
+	// RecordStorageUsage records the number and total size of the blocks in storage
+	RecordStorageUsage(objects int64, bytes int64)
+	// RecordStorageAnomaly records whether the anomaly of the given kind, e.g. "drop", is flagged in the usage of storage
+	RecordStorageAnomaly(kind string, active bool)
+	// RecordPendingBlocks records the number of blocks held in memory until they are confirmed
+	RecordPendingBlocks(blocks int)
+	// RecordOrphanedBlocks records that count blocks held until they were confirmed were dropped, as they were reorged out
+	RecordOrphanedBlocks(count int)
+	// RecordDuplicateIndices records a response from the beacon node that contained duplicate blob indices
+	RecordDuplicateIndices()
+	// RecordRateLimitBackoff records a pause of all requests to the beacon node after it rate limited a request
+	RecordRateLimitBackoff(pause time.Duration)
+	// RecordReapedBlocks records that count expired blocks of the given total size were deleted from storage
+	RecordReapedBlocks(count int, bytes int64)
+	// RecordPrunedBlocks records that count blocks of the given total size were deleted from storage as they were
+	// older than the retention window
+	RecordPrunedBlocks(count int, bytes int64)
+	// RecordReplicaWrite records the outcome of the write of a block to the given storage backend, see
+	// storage.ReplicationRecorder
+	RecordReplicaWrite(replica string, success bool)
+	// RecordReorg records a reorg of the head chain of the given depth in slots, that replaced the given number of
+	// blocks the archiver had followed
+	RecordReorg(depth uint64, replaced int)
+	// RecordOrphanedStoredBlock records that a stored block was marked as orphaned, as it was reorged out
+	RecordOrphanedStoredBlock()
 }
 
 type metricsRecorder struct {
 	blockProcessedCounter *prometheus.CounterVec
 	blobsStored           prometheus.Counter
+	blobsStoredByFork     *prometheus.CounterVec
+	inFlightBytes         prometheus.Gauge
+	retriesDropped        prometheus.Counter
+	archivalLatency       *prometheus.HistogramVec
+	storageObjects        prometheus.Gauge
+	storageBytes          prometheus.Gauge
+	storageAnomaly        *prometheus.GaugeVec
+	pendingBlocks         prometheus.Gauge
+	orphanedBlocks        prometheus.Counter
+	duplicateIndices      prometheus.Counter
+	rateLimitBackoffs     prometheus.Counter
+	rateLimitBackoffTime  prometheus.Counter
+	reapedBlocks          prometheus.Counter
+	prunedBlocks          prometheus.Counter
+	reclaimedBytes        prometheus.Counter
+	replicaWrites         *prometheus.CounterVec
+	reorgs                prometheus.Counter
+	reorgDepth            prometheus.Histogram
+	reorgedBlocks         prometheus.Counter
+	orphanedStoredBlocks  prometheus.Counter
 	registry              *prometheus.Registry
 }
 
@@ -43,6 +113,108 @@ func NewMetrics() Metricer {
 			Name:      "blobs_stored",
 			Help:      "number of blobs stored",
 		}),
+		blobsStoredByFork: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "blobs_stored_by_fork",
+			Help:      "number of blobs stored, by the fork of their block",
+		}, []string{"fork"}),
+		inFlightBytes: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "in_flight_bytes",
+			Help:      "approximate bytes of decoded blob sidecars held in memory",
+		}),
+		retriesDropped: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "retries_dropped",
+			Help:      "number of retries that were not attempted because the retry budget was exhausted",
+		}),
+		archivalLatency: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "archival_latency_seconds",
+			Help:      "time between the start of a slot and its blobs being stored, source=live is the freshness of the archive",
+			Buckets:   []float64{1, 2, 4, 6, 8, 12, 18, 24, 36, 48, 72, 120, 300, 600},
+		}, []string{"source"}),
+		storageObjects: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "storage_objects",
+			Help:      "number of blocks in storage, as of the last usage measurement",
+		}),
+		storageBytes: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "storage_bytes",
+			Help:      "total size of the blocks in storage, as of the last usage measurement",
+		}),
+		storageAnomaly: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "storage_anomaly",
+			Help:      "1 if the anomaly of the given kind (drop, stall, slow_growth) is flagged in the usage of storage, otherwise 0",
+		}, []string{"kind"}),
+		pendingBlocks: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "pending_blocks",
+			Help:      "number of blocks held in memory until they are confirmed, before they are written to storage",
+		}),
+		orphanedBlocks: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "orphaned_blocks",
+			Help:      "number of blocks held until they were confirmed that were dropped without being stored, as they were reorged out",
+		}),
+		duplicateIndices: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "duplicate_index_responses",
+			Help:      "number of responses from the beacon node that contained more than one blob sidecar with the same index",
+		}),
+		rateLimitBackoffs: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "rate_limit_backoffs",
+			Help:      "number of times all requests to the beacon node were paused because it rate limited a request",
+		}),
+		rateLimitBackoffTime: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "rate_limit_backoff_seconds",
+			Help:      "total time that all requests to the beacon node were paused for because it rate limited them",
+		}),
+		reapedBlocks: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "reaped_blocks",
+			Help:      "number of blocks deleted from storage by the reaper because their expiry had passed",
+		}),
+		prunedBlocks: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "pruned_blocks",
+			Help:      "number of blocks deleted from storage because they were older than the retention window",
+		}),
+		reclaimedBytes: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "reclaimed_bytes",
+			Help:      "total size of the blocks deleted from storage because they expired or were older than the retention window",
+		}),
+		replicaWrites: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replica_writes",
+			Help:      "number of writes of a block to each storage backend when replicating, by whether they succeeded",
+		}, []string{"replica", "result"}),
+		reorgs: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "reorgs",
+			Help:      "number of reorgs of the head chain seen while following it",
+		}),
+		reorgDepth: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "reorg_depth_slots",
+			Help:      "number of slots between the last block shared by the replaced and new chains and the replaced head, for each reorg",
+			Buckets:   []float64{1, 2, 3, 4, 8, 16, 32, 64},
+		}),
+		reorgedBlocks: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "reorged_blocks",
+			Help:      "number of followed blocks that were replaced by a reorg of the head chain",
+		}),
+		orphanedStoredBlocks: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "orphaned_stored_blocks",
+			Help:      "number of stored blocks that were marked as orphaned, as they were reorged out",
+		}),
 	}
 }
 
@@ -50,10 +222,81 @@ func (m *metricsRecorder) Registry() *prometheus.Registry {
 	return m.registry
 }
 
-func (m *metricsRecorder) RecordStoredBlobs(count int) {
+func (m *metricsRecorder) RecordStoredBlobs(fork string, count int) {
 	m.blobsStored.Add(float64(count))
+	m.blobsStoredByFork.WithLabelValues(ForkLabel(fork)).Add(float64(count))
 }
 
 func (m *metricsRecorder) RecordProcessedBlock(source BlockSource) {
 	m.blockProcessedCounter.WithLabelValues(string(source)).Inc()
 }
+
+func (m *metricsRecorder) RecordInFlightBytes(bytes uint64) {
+	m.inFlightBytes.Set(float64(bytes))
+}
+
+func (m *metricsRecorder) RecordRetryDropped() {
+	m.retriesDropped.Inc()
+}
+
+func (m *metricsRecorder) RecordArchivalLatency(source BlockSource, latency time.Duration) {
+	m.archivalLatency.WithLabelValues(string(source)).Observe(latency.Seconds())
+}
+
+func (m *metricsRecorder) RecordStorageUsage(objects int64, bytes int64) {
+	m.storageObjects.Set(float64(objects))
+	m.storageBytes.Set(float64(bytes))
+}
+
+func (m *metricsRecorder) RecordStorageAnomaly(kind string, active bool) {
+	value := 0.0
+	if active {
+		value = 1
+	}
+	m.storageAnomaly.WithLabelValues(kind).Set(value)
+}
+
+func (m *metricsRecorder) RecordPendingBlocks(blocks int) {
+	m.pendingBlocks.Set(float64(blocks))
+}
+
+func (m *metricsRecorder) RecordOrphanedBlocks(count int) {
+	m.orphanedBlocks.Add(float64(count))
+}
+
+func (m *metricsRecorder) RecordDuplicateIndices() {
+	m.duplicateIndices.Inc()
+}
+
+func (m *metricsRecorder) RecordRateLimitBackoff(pause time.Duration) {
+	m.rateLimitBackoffs.Inc()
+	m.rateLimitBackoffTime.Add(pause.Seconds())
+}
+
+func (m *metricsRecorder) RecordReapedBlocks(count int, bytes int64) {
+	m.reapedBlocks.Add(float64(count))
+	m.reclaimedBytes.Add(float64(bytes))
+}
+
+func (m *metricsRecorder) RecordPrunedBlocks(count int, bytes int64) {
+	m.prunedBlocks.Add(float64(count))
+	m.reclaimedBytes.Add(float64(bytes))
+}
+
+func (m *metricsRecorder) RecordReplicaWrite(replica string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	m.replicaWrites.WithLabelValues(replica, result).Inc()
+}
+
+func (m *metricsRecorder) RecordReorg(depth uint64, replaced int) {
+	m.reorgs.Inc()
+	m.reorgDepth.Observe(float64(depth))
+	m.reorgedBlocks.Add(float64(replaced))
+}
+
+func (m *metricsRecorder) RecordOrphanedStoredBlock() {
+	m.orphanedStoredBlocks.Inc()
+}
@@ -1,17 +1,23 @@
 package service
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/attestantio/go-eth2-client/api"
 	m "github.com/base-org/blob-archiver/archiver/metrics"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -47,10 +53,54 @@ func NewAPI(metrics m.Metricer, logger log.Logger, archiver *Archiver) *API {
 
 	r.Get("/", http.NotFound)
 	r.Post("/rearchive", result.rearchiveBlocks)
+	r.Get("/status", result.status)
+
+	// The limit applies before the token is checked, so that guessing the token is limited too
+	limiter := rate.NewLimiter(rate.Limit(archiver.cfg.AdminRateLimit), 1)
+	r.Group(func(r chi.Router) {
+		r.Use(func(handler http.Handler) http.Handler {
+			return rateLimit(limiter, handler)
+		})
+		r.Use(result.adminAuth)
+		r.Post("/admin/archive/{id}", result.archiveBlock)
+		r.Get("/admin/inventory", result.listInventory)
+		r.Get("/admin/gaps", result.listGaps)
+	})
 
 	return result
 }
 
+// StatusResponse is returned by /status.
+type StatusResponse struct {
+	Freshness FreshnessStatus `json:"freshness"`
+	// BackfillRetries is omitted if failed backfill blocks are retried inline
+	BackfillRetries *RetryStatus `json:"backfillRetries,omitempty"`
+	// Usage is omitted if the usage of storage is not monitored
+	Usage *UsageStatus `json:"usage,omitempty"`
+	// Pending is omitted if blocks are written to storage without waiting for them to be confirmed
+	Pending *PendingStatus `json:"pending,omitempty"`
+	Reorgs  ReorgStatus    `json:"reorgs"`
+}
+
+// status reports the archival latency of recently followed slots, the backfill blocks waiting to be re-attempted or
+// given up on, the usage of storage, the blocks held until they are confirmed and the reorgs of the head chain.
+func (a *API) status(w http.ResponseWriter, _ *http.Request) {
+	response := StatusResponse{Freshness: a.archiver.freshness.status(), Reorgs: a.archiver.reorgs.status()}
+	if a.archiver.retries != nil {
+		retries := a.archiver.retries.status()
+		response.BackfillRetries = &retries
+	}
+	if a.archiver.usage != nil {
+		usage := a.archiver.usage.status()
+		response.Usage = &usage
+	}
+	if a.archiver.pending != nil {
+		pending := a.archiver.pending.status()
+		response.Pending = &pending
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
 type rearchiveResponse struct {
 	Error      string `json:"error,omitempty"`
 	BlockStart uint64 `json:"blockStart"`
@@ -122,3 +172,201 @@ func (a *API) rearchiveBlocks(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+const (
+	// ArchiveStatusStored is returned by /admin/archive when the blobs for the block were fetched and stored
+	ArchiveStatusStored = "stored"
+	// ArchiveStatusAlreadyPresent is returned by /admin/archive when the blobs for the block were already stored
+	ArchiveStatusAlreadyPresent = "already_present"
+	// ArchiveStatusHeld is returned by /admin/archive when the blobs for the block were fetched, but are held in memory
+	// until the block is confirmed rather than stored, see pendingTier
+	ArchiveStatusHeld = "held_pending_confirmation"
+	// ArchiveStatusNotFound is returned by /admin/archive when the beacon node does not have the block, e.g. the slot
+	// was skipped
+	ArchiveStatusNotFound = "not_found"
+)
+
+// ArchiveResponse is the response from /admin/archive/{id}.
+type ArchiveResponse struct {
+	Error  string `json:"error,omitempty"`
+	Status string `json:"status,omitempty"`
+	Root   string `json:"root,omitempty"`
+	Slot   uint64 `json:"slot,omitempty"`
+	Blobs  int    `json:"blobs"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// adminAuth only allows requests with the configured admin token as a bearer token. If no token is configured, the
+// admin endpoints are disabled.
+func (a *API) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := a.archiver.cfg.AdminToken
+		if token == "" {
+			writeJSON(w, http.StatusForbidden, ArchiveResponse{Error: "admin endpoints are disabled"})
+			return
+		}
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, ArchiveResponse{Error: "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rateLimit(limiter *rate.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.Allow() {
+			writeJSON(w, http.StatusTooManyRequests, ArchiveResponse{Error: "rate limit exceeded"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// archiveBlock fetches and stores the blobs for a single block immediately, this can be used to fill a known gap
+// without re-running backfill. The block can be identified by any block identifier supported by the beacon node, e.g.
+// a slot or a block root. Blobs that are already stored are not overwritten. If blocks are held until they are
+// confirmed, the blobs of a block that is not yet confirmed are held rather than stored, and 202 is returned.
+func (a *API) archiveBlock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	header, exists, err := a.archiver.persistBlobsForBlockToS3(r.Context(), id, false)
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			writeJSON(w, http.StatusNotFound, ArchiveResponse{Status: ArchiveStatusNotFound})
+			return
+		}
+
+		a.logger.Error("Failed to archive block", "id", id, "err", err)
+		writeJSON(w, http.StatusInternalServerError, ArchiveResponse{Error: err.Error()})
+		return
+	}
+
+	root := common.Hash(header.Root)
+	if a.archiver.pending != nil {
+		if held, ok := a.archiver.pending.block(root); ok {
+			if !exists {
+				a.metrics.RecordProcessedBlock(m.BlockSourceAdmin)
+			}
+			a.logger.Info("Archived block", "id", id, "status", ArchiveStatusHeld, "blobs", held.data.Blobs())
+			writeJSON(w, http.StatusAccepted, ArchiveResponse{
+				Status: ArchiveStatusHeld,
+				Root:   root.String(),
+				Slot:   uint64(header.Header.Message.Slot),
+				Blobs:  held.data.Blobs(),
+			})
+			return
+		}
+	}
+
+	data, err := a.archiver.dataStoreClient.ReadBlob(r.Context(), root)
+	if err != nil {
+		a.logger.Error("Failed to read archived block", "id", id, "err", err)
+		writeJSON(w, http.StatusInternalServerError, ArchiveResponse{Error: err.Error()})
+		return
+	}
+
+	response := ArchiveResponse{
+		Status: ArchiveStatusStored,
+		Root:   root.String(),
+		Slot:   uint64(header.Header.Message.Slot),
+		Blobs:  data.Blobs(),
+	}
+	if exists {
+		response.Status = ArchiveStatusAlreadyPresent
+	} else {
+		a.metrics.RecordProcessedBlock(m.BlockSourceAdmin)
+	}
+
+	a.logger.Info("Archived block", "id", id, "status", response.Status, "blobs", response.Blobs)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// inventoryRange returns the slot range of a request to /admin/inventory or /admin/gaps, from the start_slot and
+// end_slot params. The range ends at the newest slot recorded since the archiver started if end_slot is not given.
+func (a *API) inventoryRange(r *http.Request) (uint64, uint64, error) {
+	start, err := toSlot(r.URL.Query().Get("start_slot"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start_slot param: %w", err)
+	}
+
+	var end uint64
+	if param := r.URL.Query().Get("end_slot"); param != "" {
+		if end, err = toSlot(param); err != nil {
+			return 0, 0, fmt.Errorf("invalid end_slot param: %w", err)
+		}
+	} else if newest, ok := a.archiver.inventory.newestSlot(); ok {
+		end = newest
+	} else {
+		return 0, 0, errors.New("invalid end_slot param: must provide param until a block has been recorded")
+	}
+
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid range: start_slot %d to end_slot %d", start, end)
+	}
+	if end-start >= maxInventorySlots {
+		return 0, 0, fmt.Errorf("invalid range: at most %d slots can be listed at once", maxInventorySlots)
+	}
+	return start, end, nil
+}
+
+// listInventory lists the archived blocks in the requested slot range, from the inventory in storage.
+func (a *API) listInventory(w http.ResponseWriter, r *http.Request) {
+	if a.archiver.inventory == nil {
+		writeJSON(w, http.StatusNotFound, InventoryResponse{Error: "inventory is disabled"})
+		return
+	}
+
+	start, end, err := a.inventoryRange(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, InventoryResponse{Error: err.Error()})
+		return
+	}
+
+	blocks, err := a.archiver.inventory.blocks(r.Context(), start, end)
+	if err != nil {
+		a.logger.Error("Failed to read inventory", "startSlot", start, "endSlot", end, "err", err)
+		writeJSON(w, http.StatusInternalServerError, InventoryResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, InventoryResponse{StartSlot: start, EndSlot: end, Blocks: blocks})
+}
+
+// listGaps lists the ranges of slots in the requested slot range that have no archived block and are not known to be
+// empty, see inventory.gaps. Each gap can be re-archived with /rearchive.
+func (a *API) listGaps(w http.ResponseWriter, r *http.Request) {
+	if a.archiver.inventory == nil {
+		writeJSON(w, http.StatusNotFound, GapsResponse{Error: "inventory is disabled"})
+		return
+	}
+
+	start, end, err := a.inventoryRange(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, GapsResponse{Error: err.Error()})
+		return
+	}
+
+	gaps, err := a.archiver.inventory.gaps(r.Context(), start, end)
+	if err != nil {
+		a.logger.Error("Failed to read inventory", "startSlot", start, "endSlot", end, "err", err)
+		writeJSON(w, http.StatusInternalServerError, GapsResponse{Error: err.Error()})
+		return
+	}
+
+	response := GapsResponse{StartSlot: start, EndSlot: end, Gaps: gaps}
+	for _, gap := range gaps {
+		response.Missing += gap.End - gap.Start + 1
+	}
+	writeJSON(w, http.StatusOK, response)
+}
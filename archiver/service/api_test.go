@@ -1,17 +1,25 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/base-org/blob-archiver/archiver/flags"
 	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	common "github.com/base-org/blob-archiver/common/flags"
 	"github.com/base-org/blob-archiver/common/storage/storagetest"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 )
 
 func setupAPI(t *testing.T) (*API, *storagetest.TestFileStorage) {
@@ -103,3 +111,141 @@ func TestRearchiveHandler(t *testing.T) {
 		})
 	}
 }
+
+type notFoundBeaconClient struct {
+	*beacontest.StubBeaconClient
+	missing string
+}
+
+func (n *notFoundBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if opts.Block == n.missing {
+		return nil, &api.Error{StatusCode: 404}
+	}
+	return n.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func setupAdminAPI(t *testing.T, rateLimit float64) (*API, *storagetest.TestFileStorage) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	m := metrics.NewMetrics()
+	fs := storagetest.NewTestFileStorage(t, logger)
+	beacon := &notFoundBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t), missing: "100"}
+	archiver, err := NewArchiver(logger, flags.ArchiverConfig{
+		PollInterval:   10 * time.Second,
+		AdminToken:     "secret",
+		AdminRateLimit: rateLimit,
+	}, fs, beacon, m)
+	require.NoError(t, err)
+	return NewAPI(m, logger, archiver), fs
+}
+
+func archiveRequest(a *API, id string, token string) (int, ArchiveResponse) {
+	request := httptest.NewRequest("POST", "/admin/archive/"+id, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	var result ArchiveResponse
+	_ = json.NewDecoder(response.Body).Decode(&result)
+	return response.Code, result
+}
+
+func TestArchiveHandler(t *testing.T) {
+	a, fs := setupAdminAPI(t, 1000)
+
+	status, result := archiveRequest(a, blobtest.One.String(), "secret")
+	require.Equal(t, 200, status)
+	require.Equal(t, ArchiveResponse{
+		Status: ArchiveStatusStored,
+		Root:   blobtest.One.String(),
+		Slot:   blobtest.StartSlot + 1,
+		Blobs:  2,
+	}, result)
+	fs.CheckExistsOrFail(t, blobtest.One)
+
+	status, result = archiveRequest(a, strconv.FormatUint(blobtest.StartSlot+1, 10), "secret")
+	require.Equal(t, 200, status)
+	require.Equal(t, ArchiveStatusAlreadyPresent, result.Status)
+	require.Equal(t, 2, result.Blobs)
+
+	status, result = archiveRequest(a, "100", "secret")
+	require.Equal(t, 404, status)
+	require.Equal(t, ArchiveStatusNotFound, result.Status)
+}
+
+func TestArchiveHandler_Held(t *testing.T) {
+	a, fs := setupAdminAPI(t, float64(rate.Inf))
+	// Until the finalized slot is known every block is held
+	a.archiver.pending = newPendingTier(0, true, a.metrics)
+
+	// A block that is already held is reported as held again
+	for i := 0; i < 2; i++ {
+		status, result := archiveRequest(a, blobtest.One.String(), "secret")
+		require.Equal(t, 202, status)
+		require.Equal(t, ArchiveResponse{
+			Status: ArchiveStatusHeld,
+			Root:   blobtest.One.String(),
+			Slot:   blobtest.StartSlot + 1,
+			Blobs:  2,
+		}, result)
+		fs.CheckNotExistsOrFail(t, blobtest.One)
+		require.True(t, a.archiver.pending.has(blobtest.One))
+	}
+}
+
+func TestArchiveHandler_Auth(t *testing.T) {
+	// Unauthorized requests count towards the rate limit, so there is none
+	a, fs := setupAdminAPI(t, float64(rate.Inf))
+
+	status, result := archiveRequest(a, blobtest.One.String(), "")
+	require.Equal(t, 401, status)
+	require.Equal(t, "unauthorized", result.Error)
+
+	status, _ = archiveRequest(a, blobtest.One.String(), "wrong")
+	require.Equal(t, 401, status)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+
+	// The admin endpoints are disabled without a token
+	disabled, _ := setupAPI(t)
+	status, result = archiveRequest(disabled, blobtest.One.String(), "")
+	require.Equal(t, 403, status)
+	require.Equal(t, "admin endpoints are disabled", result.Error)
+}
+
+func TestArchiveHandler_RateLimit(t *testing.T) {
+	a, _ := setupAdminAPI(t, 0.001)
+
+	status, _ := archiveRequest(a, blobtest.One.String(), "secret")
+	require.Equal(t, 200, status)
+
+	status, result := archiveRequest(a, blobtest.Two.String(), "secret")
+	require.Equal(t, 429, status)
+	require.Equal(t, "rate limit exceeded", result.Error)
+
+	// Requests with a wrong token are limited as well
+	a, _ = setupAdminAPI(t, 0.001)
+	status, _ = archiveRequest(a, blobtest.One.String(), "guess")
+	require.Equal(t, 401, status)
+	status, _ = archiveRequest(a, blobtest.One.String(), "secret")
+	require.Equal(t, 429, status)
+}
+
+func TestArchiverConfig_AdminRateLimit(t *testing.T) {
+	cfg := flags.ArchiverConfig{
+		BeaconConfig:        common.BeaconConfig{BeaconURL: "http://localhost:5052", BeaconClientTimeout: time.Second},
+		StorageConfig:       common.StorageConfig{DataStorageType: common.DataStorageFile, FileStorageDirectory: t.TempDir()},
+		PollInterval:        time.Second,
+		OriginBlock:         blobtest.OriginBlock,
+		BackfillConcurrency: 1,
+		ListenAddr:          "0.0.0.0:8000",
+		AdminRateLimit:      1,
+	}
+	require.NoError(t, cfg.Check())
+
+	// A limit of 0 would allow a single admin request and reject every one after it
+	for _, limit := range []float64{0, -1} {
+		cfg.AdminRateLimit = limit
+		require.ErrorContains(t, cfg.Check(), "admin rate limit must be positive")
+	}
+}
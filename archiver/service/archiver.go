@@ -3,7 +3,10 @@ package service
 import (
 	"context"
 	"errors"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	client "github.com/attestantio/go-eth2-client"
@@ -39,6 +42,15 @@ func NewArchiver(l log.Logger, cfg flags.ArchiverConfig, dataStoreClient storage
 		beaconClient:    client,
 		stopCh:          make(chan struct{}),
 		id:              uuid.New().String(),
+		budget:          newMemoryBudget(cfg.BackfillMaxMemory, m),
+		retryBudget:     newRetryBudget(cfg.RetryBudgetRatio, cfg.RetryBudgetBurst, m),
+		backoff:         newRateLimitBackoff(cfg.RateLimitBackoff, cfg.RateLimitMaxBackoff, m, l),
+		freshness:       newFreshnessTracker(m),
+		retries:         newBackfillRetryQueue(cfg.BackfillRetryAttempts),
+		usage:           newUsageMonitor(cfg.UsageInterval, cfg.UsageStallWindow, cfg.UsageMinGrowth, m, l),
+		pending:         newPendingTier(cfg.ConfirmationDepth, cfg.WaitForFinality, m),
+		reorgs:          newReorgTracker(),
+		inventory:       newInventory(cfg.Inventory, dataStoreClient, l),
 	}, nil
 }
 
@@ -50,14 +62,51 @@ type Archiver struct {
 	metrics         metrics.Metricer
 	stopCh          chan struct{}
 	id              string
+	walMu           sync.Mutex
+	wal             storage.BackfillWAL
+	budget          *memoryBudget
+	retryBudget     *retryBudget
+	backoff         *rateLimitBackoff
+	freshness       *freshnessTracker
+	// forks is the fork schedule that the fork of stored blobs is derived from, nil until it has been fetched
+	forks atomic.Pointer[forkSchedule]
+	// retries is nil if failed backfill blocks are retried inline
+	retries *retryQueue
+	// usage is nil if the usage of storage is not monitored
+	usage *usageMonitor
+	// pending is nil if blocks are written to storage without waiting for them to be confirmed
+	pending *pendingTier
+	// reorgs tracks the head chain that the live data is followed along
+	reorgs *reorgTracker
+	// inventory is nil if the archived blocks are not recorded in an inventory
+	inventory *inventory
 }
 
 // Start starts archiving blobs. It begins polling the beacon node for the latest blocks and persisting blobs for
 // them. Concurrently it'll also begin a backfill process (see backfillBlobs) to store all blobs from the current head
 // to the previously stored blocks. This ensures that during restarts or outages of an archiver, any gaps will be
-// filled in.
+// filled in. If a backfill range is configured, its slots are also backfilled concurrently (see backfillRange).
 func (a *Archiver) Start(ctx context.Context) error {
-	currentBlock, _, err := retry.Do2(ctx, startupFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
+	if clock, err := newSlotClock(ctx, a.beaconClient); err != nil {
+		a.log.Warn("unable to determine slot timing, archival latency will not be tracked", "err", err)
+	} else {
+		a.freshness.setClock(clock)
+	}
+
+	if schedule, err := newForkSchedule(ctx, a.beaconClient); err != nil {
+		a.log.Warn("unable to determine fork schedule, stored blobs will only be labeled with the fork reported by the beacon node", "err", err)
+	} else {
+		a.forks.Store(&schedule)
+	}
+
+	if a.pending != nil {
+		// Until the confirmed slot is known every block is held, so it is fetched before the first block is stored
+		if err := a.promotePending(ctx); err != nil {
+			a.log.Warn("unable to determine confirmed slot, blocks will be held until it is", "err", err)
+		}
+	}
+
+	currentBlock, _, err := retryWithBudget2(ctx, a.retryBudget, startupFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
 		return a.persistBlobsForBlockToS3(ctx, "head", false)
 	})
 
@@ -68,7 +117,26 @@ func (a *Archiver) Start(ctx context.Context) error {
 
 	a.waitObtainStorageLock(ctx)
 
+	if a.cfg.CompactionInterval > 0 {
+		go a.dataStoreClient.RunCompaction(ctx, a.cfg.CompactionInterval, a.cfg.CompactionTempFileAge)
+	}
+
+	if a.usage != nil {
+		go a.usage.run(ctx, a.dataStoreClient, a.cfg.UsageInterval)
+	}
+
+	if a.cfg.ReapInterval > 0 && (a.cfg.ObjectTTL > 0 || a.cfg.RetentionSlots > 0) {
+		go a.runReaper(ctx, a.dataStoreClient, a.cfg.ReapInterval)
+	}
+
+	if a.inventory != nil {
+		go a.inventory.run(ctx, inventoryFlushInterval)
+	}
+
 	go a.backfillBlobs(ctx, currentBlock)
+	if a.cfg.BackfillStartSlot > 0 {
+		go a.backfillRange(ctx, currentBlock)
+	}
 
 	return a.trackLatestBlocks(ctx)
 }
@@ -79,61 +147,169 @@ func (a *Archiver) Stop(ctx context.Context) error {
 	return nil
 }
 
+// blobsError is returned by persistBlobsForBlockToS3 when the block header was fetched, but its blobs could not be
+// fetched or stored.
+type blobsError struct {
+	header *v1.BeaconBlockHeader
+	err    error
+}
+
+func (e *blobsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *blobsError) Unwrap() error {
+	return e.err
+}
+
 // persistBlobsForBlockToS3 fetches the blobs for a given block and persists them to S3. It returns the block header
 // and a boolean indicating whether the blobs already existed in S3 and any errors that occur.
-// If the blobs are already stored, it will not overwrite the data. Currently, the archiver does not
+// If the blobs are already stored, it will not overwrite the data. If blocks are held until they are confirmed (see
+// pendingTier), the blobs of a block that is not yet confirmed are held instead of stored, and a held block counts as
+// already existing. Currently, the archiver does not
 // perform any validation of the blobs, it assumes a trusted beacon node. See:
 // https://github.com/base-org/blob-archiver/issues/4.
 func (a *Archiver) persistBlobsForBlockToS3(ctx context.Context, blockIdentifier string, overwrite bool) (*v1.BeaconBlockHeader, bool, error) {
+	if err := a.backoff.wait(ctx); err != nil {
+		return nil, false, err
+	}
+
 	currentHeader, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
 		Block: blockIdentifier,
 	})
+	a.backoff.observe(err)
 
 	if err != nil {
-		a.log.Error("failed to fetch latest beacon block header", "err", err)
+		a.log.Error("failed to fetch beacon block header", "id", blockIdentifier, "err", err)
 		return nil, false, err
 	}
 
+	l := a.log.New("root", currentHeader.Data.Root.String(), "slot", currentHeader.Data.Header.Message.Slot)
+
 	exists, err := a.dataStoreClient.Exists(ctx, common.Hash(currentHeader.Data.Root))
 	if err != nil {
-		a.log.Error("failed to check if blob exists", "err", err)
+		l.Error("failed to check if blob exists", "err", err)
 		return nil, false, err
 	}
 
+	if exists && a.inventory != nil {
+		// Blocks stored before the inventory was enabled are recorded as they are walked over
+		a.inventory.record(currentHeader.Data)
+	}
+
+	if !exists && a.pending != nil {
+		exists = a.pending.has(common.Hash(currentHeader.Data.Root))
+	}
+
 	if exists && !overwrite {
-		a.log.Debug("blob already exists", "hash", currentHeader.Data.Root)
+		l.Debug("blob already exists")
 		return currentHeader.Data, true, nil
 	}
 
-	blobSidecars, err := a.beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
-		Block: currentHeader.Data.Root.String(),
-	})
+	if err := a.budget.wait(ctx); err != nil {
+		return nil, false, err
+	}
 
+	// From fulu on the blobs of a block are fetched as data column sidecars, if the beacon client can fetch them
+	var blobData storage.BlobData
+	var fork string
+	var size uint64
+	if columnsClient, ok := a.dataColumnsClient(currentHeader.Data.Header.Message.Slot); ok {
+		blobData, fork, size, err = a.fetchDataColumnBlock(ctx, l, columnsClient, currentHeader.Data)
+	} else {
+		blobData, fork, size, err = a.fetchBlobBlock(ctx, l, blockIdentifier, currentHeader.Data)
+	}
 	if err != nil {
-		a.log.Error("failed to fetch blob sidecars", "err", err)
-		return nil, false, err
+		return nil, false, &blobsError{header: currentHeader.Data, err: err}
 	}
+	a.budget.acquire(size)
+	defer a.budget.release(size)
 
-	a.log.Debug("fetched blob sidecars", "count", len(blobSidecars.Data))
+	if a.cfg.StoreBlockHeaders {
+		blobData.Header.BeaconBlockHeader = currentHeader.Data.Header
+		blobData.Header.Fork = fork
+	}
 
-	blobData := storage.BlobData{
-		Header: storage.Header{
-			BeaconBlockHash: common.Hash(currentHeader.Data.Root),
-		},
-		BlobSidecars: storage.BlobSidecars{Data: blobSidecars.Data},
+	if a.pending != nil && !a.pending.confirmed(currentHeader.Data.Header.Message.Slot) {
+		a.pending.add(pendingBlock{header: currentHeader.Data, data: blobData, fork: fork})
+		l.Debug("holding blob sidecars until the block is confirmed", "count", blobData.Blobs())
+		return currentHeader.Data, exists, nil
 	}
 
 	// The blob that is being written has not been validated. It is assumed that the beacon node is trusted.
-	err = a.dataStoreClient.WriteBlob(ctx, blobData)
+	writeStart := time.Now()
+	if err := a.writeBlobData(ctx, currentHeader.Data, blobData); err != nil {
+		l.Error("failed to write blob", "duration", time.Since(writeStart), "err", err)
+		return nil, false, &blobsError{header: currentHeader.Data, err: err}
+	}
+
+	l.Debug("stored blob sidecars", "count", blobData.Blobs(), "duration", time.Since(writeStart))
+
+	a.metrics.RecordStoredBlobs(fork, blobData.Blobs())
 
+	return currentHeader.Data, exists, nil
+}
+
+// fetchBlobBlock fetches the blob sidecars of the block, sorted by index, and returns the block to store with the
+// fork of its blobs and their size.
+func (a *Archiver) fetchBlobBlock(ctx context.Context, l log.Logger, blockIdentifier string, header *v1.BeaconBlockHeader) (storage.BlobData, string, uint64, error) {
+	fetchStart := time.Now()
+	blobSidecars, err := a.fetchBlobSidecars(ctx, header.Root, header.Header.Message.Slot)
 	if err != nil {
-		a.log.Error("failed to write blob", "err", err)
-		return nil, false, err
+		l.Error("failed to fetch blob sidecars", "duration", time.Since(fetchStart), "err", err)
+		return storage.BlobData{}, "", 0, err
 	}
 
-	a.metrics.RecordStoredBlobs(len(blobSidecars.Data))
+	l.Debug("fetched blob sidecars", "count", len(blobSidecars.Data), "duration", time.Since(fetchStart))
 
-	return currentHeader.Data, exists, nil
+	sidecars, duplicates, err := storage.SortSidecars(storage.FromDenebSidecars(blobSidecars.Data), a.cfg.DuplicateIndices)
+	if len(duplicates) > 0 {
+		a.metrics.RecordDuplicateIndices()
+		l.Warn("beacon node returned duplicate blob indices", "id", blockIdentifier, "indices", duplicates, "handling", a.cfg.DuplicateIndices)
+	}
+	if err != nil {
+		return storage.BlobData{}, "", 0, err
+	}
+
+	blobData := storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: common.Hash(header.Root),
+		},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars},
+	}
+	return blobData, a.blobsFork(blobSidecars, header.Header.Message.Slot), sidecarsSize(blobSidecars.Data), nil
+}
+
+// writeBlobData writes the blobs of a block to storage, as an empty tombstone if it has none and empty blobs are
+// skipped. With an object TTL the block is written with its expiry, tombstones never expire. If blobs are indexed, the
+// index is written once the block is stored, so that it never refers to a block that was not written. The block is
+// then recorded in the inventory, if there is one.
+func (a *Archiver) writeBlobData(ctx context.Context, header *v1.BeaconBlockHeader, data storage.BlobData) error {
+	if err := a.writeBlock(ctx, data); err != nil {
+		return err
+	}
+	if a.inventory != nil {
+		a.inventory.record(header)
+	}
+	return nil
+}
+
+// writeBlock writes the block to storage, and its blobs to the index, see writeBlobData.
+func (a *Archiver) writeBlock(ctx context.Context, data storage.BlobData) error {
+	if a.cfg.SkipEmptyBlobs && data.Empty() {
+		return a.dataStoreClient.WriteEmptyBlob(ctx, data.Header.BeaconBlockHash)
+	}
+	if a.cfg.ObjectTTL > 0 {
+		data.Header.ExpiresAt = time.Now().Add(a.cfg.ObjectTTL).Unix()
+	}
+	if err := a.dataStoreClient.WriteBlob(ctx, data); err != nil {
+		return err
+	}
+
+	if !a.cfg.IndexBlobs {
+		return nil
+	}
+	return storage.WriteBlobIndex(ctx, a.dataStoreClient, data)
 }
 
 const LockUpdateInterval = 10 * time.Second
@@ -166,7 +342,7 @@ func (a *Archiver) waitObtainStorageLock(ctx context.Context) {
 
 	err = a.dataStoreClient.WriteLockfile(ctx, storage.Lockfile{ArchiverId: a.id, Timestamp: currentTime})
 	if err != nil {
-		a.log.Crit("failed to write to lockfile: %v", err)
+		a.log.Crit("failed to write to lockfile", "err", err)
 	}
 	a.log.Info("obtained storage lock")
 
@@ -191,7 +367,11 @@ func (a *Archiver) waitObtainStorageLock(ctx context.Context) {
 
 // backfillBlobs will persist all blobs from the provided beacon block header, to either the last block that was persisted
 // to the archivers storage or the origin block in the configuration. This is used to ensure that any gaps can be filled.
-// If an error is encountered persisting a block, it will retry after waiting for a period of time.
+// If the blobs for a block cannot be stored, the block is queued to be re-attempted in the background with backoff
+// (see retryQueue) and the backfill moves on to its parent. If the retry queue is disabled, or the block header cannot
+// be fetched, it will retry inline after waiting for a period of time. Each block is
+// recorded in a write-ahead log before and after it is written, so that an interrupted backfill only re-processes the
+// blocks that were in-flight (see replayBackfillWAL).
 func (a *Archiver) backfillBlobs(ctx context.Context, latest *v1.BeaconBlockHeader) {
 	// Add backfill process that starts at latest slot, then loop through all backfill processes
 	backfillProcesses, err := a.dataStoreClient.ReadBackfillProcesses(ctx)
@@ -199,48 +379,82 @@ func (a *Archiver) backfillBlobs(ctx context.Context, latest *v1.BeaconBlockHead
 		a.log.Crit("failed to read backfill_processes", "err", err)
 	}
 	backfillProcesses[common.Hash(latest.Root)] = storage.BackfillProcess{Start: *latest, Current: *latest}
+	a.replayBackfillWAL(ctx, backfillProcesses)
 	a.dataStoreClient.WriteBackfillProcesses(ctx, backfillProcesses)
 
 	backfillLoop := func(start *v1.BeaconBlockHeader, current *v1.BeaconBlockHeader) {
 		curr, alreadyExists, err := current, false, error(nil)
 		count := 0
+		began := time.Now()
 		a.log.Info("backfill process initiated",
-			"currHash", curr.Root.String(),
+			"currRoot", curr.Root.String(),
 			"currSlot", curr.Header.Message.Slot,
-			"startHash", start.Root.String(),
+			"startRoot", start.Root.String(),
 			"startSlot", start.Header.Message.Slot,
 		)
 
 		defer func() {
 			a.log.Info("backfill process complete",
-				"endHash", curr.Root.String(),
+				"endRoot", curr.Root.String(),
 				"endSlot", curr.Header.Message.Slot,
-				"startHash", start.Root.String(),
+				"startRoot", start.Root.String(),
 				"startSlot", start.Header.Message.Slot,
+				"blocks", count,
+				"duration", time.Since(began),
 			)
 			delete(backfillProcesses, common.Hash(start.Root))
 			a.dataStoreClient.WriteBackfillProcesses(ctx, backfillProcesses)
+			a.walForget(ctx, common.Hash(start.Root))
 		}()
 
+		// Blocks older than the retention window are not backfilled, as the reaper would delete them again
+		cutoff, retained := retentionCutoff(uint64(start.Header.Message.Slot), a.cfg.RetentionSlots)
 		for !alreadyExists {
 			previous := curr
 
 			if common.Hash(curr.Root) == a.cfg.OriginBlock {
-				a.log.Info("reached origin block", "hash", curr.Root.String())
+				a.log.Info("reached origin block", "root", curr.Root.String())
+				return
+			}
+
+			// The parent of a block at or before the cutoff is before it, so it is not kept
+			if retained && uint64(curr.Header.Message.Slot) <= cutoff {
+				a.log.Info("reached retention window", "root", curr.Root.String(), "slot", curr.Header.Message.Slot)
 				return
 			}
 
-			curr, alreadyExists, err = a.persistBlobsForBlockToS3(ctx, previous.Header.Message.ParentRoot.String(), false)
+			parent := common.Hash(previous.Header.Message.ParentRoot)
+			inFlight := a.walBegin(ctx, common.Hash(start.Root), parent)
+
+			curr, alreadyExists, err = a.persistBlobsForBlockToS3(ctx, parent.String(), inFlight)
+			var blobsErr *blobsError
+			if err != nil && a.retries != nil && errors.As(err, &blobsErr) {
+				// The header is known so the walk can continue while the block is re-attempted in the background. Its
+				// write-ahead log entry is left in-flight, so the block is also replayed if the archiver restarts.
+				a.log.Warn("failed to persist blobs for block, queued for retry", "root", parent.String(), "slot", blobsErr.header.Header.Message.Slot, "err", err)
+				a.retries.add(common.Hash(start.Root), parent, blobsErr.header.Header.Message.Slot, err)
+				curr, alreadyExists = blobsErr.header, false
+				continue
+			}
+
 			if err != nil {
-				a.log.Error("failed to persist blobs for block, will retry", "err", err, "hash", previous.Header.Message.ParentRoot.String())
+				a.log.Error("failed to persist blobs for block, will retry", "root", previous.Header.Message.ParentRoot.String(), "err", err)
 				// Revert back to block we failed to fetch
 				curr = previous
 				time.Sleep(backfillErrorRetryInterval)
 				continue
 			}
 
+			a.walComplete(ctx, common.Hash(start.Root), curr)
+
+			if inFlight {
+				// The block was only partially written by a previous attempt, so continue walking back
+				alreadyExists = false
+			}
+
 			if !alreadyExists {
 				a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+				a.freshness.record(metrics.BlockSourceBackfill, curr.Header.Message.Slot)
 			}
 
 			count++
@@ -251,9 +465,46 @@ func (a *Archiver) backfillBlobs(ctx context.Context, latest *v1.BeaconBlockHead
 		}
 	}
 
+	if a.retries != nil {
+		retryCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go a.retries.run(retryCtx, a.retryBackfillBlock)
+	}
+
 	for _, process := range backfillProcesses {
 		backfillLoop(&process.Start, &process.Current)
 	}
+
+	if a.retries != nil {
+		a.retries.waitIdle(ctx)
+
+		if dead := a.retries.status().DeadLetters; len(dead) > 0 {
+			a.log.Error("backfill complete, some blocks could not be stored", "count", len(dead), "blocks", dead)
+		}
+	}
+}
+
+// retryBackfillBlock re-attempts storing the blobs for a block that failed during backfill. A slot of the backfill
+// range that is not found was missed, and is done.
+func (a *Archiver) retryBackfillBlock(ctx context.Context, item *retryItem) error {
+	id := item.blockID()
+	_, _, err := a.persistBlobsForBlockToS3(ctx, id, true)
+	if err != nil && item.root == (common.Hash{}) && isNotFound(err) {
+		a.log.Info("queued slot was missed", "slot", item.slot, "attempts", item.attempts+1)
+		return nil
+	}
+	if err != nil {
+		a.log.Warn("failed to persist blobs for queued block", "id", id, "slot", item.slot, "attempts", item.attempts+1, "err", err)
+		return err
+	}
+
+	a.log.Info("persisted blobs for queued block", "id", id, "slot", item.slot, "attempts", item.attempts+1)
+	if item.process != (common.Hash{}) {
+		a.walDiscard(ctx, item.process, item.root)
+	}
+	a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+	a.freshness.record(metrics.BlockSourceBackfill, item.slot)
+	return nil
 }
 
 // trackLatestBlocks will poll the beacon node for the latest blocks and persist blobs for them.
@@ -278,17 +529,20 @@ func (a *Archiver) trackLatestBlocks(ctx context.Context) error {
 // known block -- that already exists in the archivers' storage.
 func (a *Archiver) processBlocksUntilKnownBlock(ctx context.Context) {
 	a.log.Debug("refreshing live data")
+	began := time.Now()
 
 	var start *v1.BeaconBlockHeader
+	// followed are the blocks that were not stored before, newest first
+	var followed []*v1.BeaconBlockHeader
 	currentBlockId := "head"
 
 	for {
-		current, alreadyExisted, err := retry.Do2(ctx, liveFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
+		current, alreadyExisted, err := retryWithBudget2(ctx, a.retryBudget, liveFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
 			return a.persistBlobsForBlockToS3(ctx, currentBlockId, false)
 		})
 
 		if err != nil {
-			a.log.Error("failed to update live blobs for block", "err", err, "blockId", currentBlockId)
+			a.log.Error("failed to update live blobs for block", "id", currentBlockId, "err", err)
 			return
 		}
 
@@ -298,15 +552,25 @@ func (a *Archiver) processBlocksUntilKnownBlock(ctx context.Context) {
 
 		if !alreadyExisted {
 			a.metrics.RecordProcessedBlock(metrics.BlockSourceLive)
+			a.freshness.record(metrics.BlockSourceLive, current.Header.Message.Slot)
+			followed = append(followed, current)
 		} else {
-			a.log.Debug("blob already exists", "hash", current.Root.String())
+			a.log.Debug("blob already exists", "root", current.Root.String())
+			slices.Reverse(followed)
+			a.followHeadChain(ctx, current, followed)
 			break
 		}
 
 		currentBlockId = current.Header.Message.ParentRoot.String()
 	}
 
-	a.log.Info("live data refreshed", "startHash", start.Root.String(), "endHash", currentBlockId)
+	a.log.Info("live data refreshed", "startRoot", start.Root.String(), "startSlot", start.Header.Message.Slot, "endId", currentBlockId, "duration", time.Since(began))
+
+	if a.pending != nil {
+		if err := a.promotePending(ctx); err != nil {
+			a.log.Error("failed to store confirmed blocks", "err", err)
+		}
+	}
 }
 
 // rearchiveRange will rearchive all blocks in the range from the given start to end. It returns the start and end of the
@@ -320,7 +584,7 @@ func (a *Archiver) rearchiveRange(from uint64, to uint64) (uint64, uint64, error
 
 		l.Info("rearchiving block")
 
-		rewritten, err := retry.Do(context.Background(), rearchiveMaximumRetries, retry.Exponential(), func() (bool, error) {
+		rewritten, err := retryWithBudget(context.Background(), a.retryBudget, rearchiveMaximumRetries, retry.Exponential(), func() (bool, error) {
 			_, _, e := a.persistBlobsForBlockToS3(context.Background(), id, true)
 
 			// If the block is not found, we can assume that the slot has been skipped
@@ -341,7 +605,7 @@ func (a *Archiver) rearchiveRange(from uint64, to uint64) (uint64, uint64, error
 		}
 
 		if !rewritten {
-			l.Info("block not found during reachiving", "slot", id)
+			l.Info("block not found during reachiving")
 		}
 
 		a.metrics.RecordProcessedBlock(metrics.BlockSourceRearchive)
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/base-org/blob-archiver/archiver/flags"
 	"github.com/base-org/blob-archiver/archiver/metrics"
 	"github.com/base-org/blob-archiver/common/beacon/beacontest"
@@ -62,11 +63,11 @@ func TestArchiver_FetchAndPersistOverwriting(t *testing.T) {
 			BeaconBlockHash: blobtest.Five,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]),
 		},
 	})
 
-	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]))
 
 	// change the blob data -- this isn't possible w/out changing the hash. But it allows us to test the overwrite
 	beacon.Blobs[blobtest.Five.String()] = blobtest.NewBlobSidecars(t, 6)
@@ -76,7 +77,7 @@ func TestArchiver_FetchAndPersistOverwriting(t *testing.T) {
 	require.True(t, exists)
 
 	// It should have overwritten the blob data
-	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]))
 
 	// Overwriting a non-existent blob should return exists=false
 	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), true)
@@ -84,6 +85,98 @@ func TestArchiver_FetchAndPersistOverwriting(t *testing.T) {
 	require.False(t, exists)
 }
 
+func TestArchiver_SkipEmptyBlobs(t *testing.T) {
+	svc, fs := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+	svc.cfg.SkipEmptyBlobs = true
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Two.String(), false)
+	require.NoError(t, err)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+
+	// The empty block is stored as a tombstone, and is still treated as existing
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	require.Empty(t, fs.ReadOrFail(t, blobtest.Two).BlobSidecars.Data)
+
+	// Blocks with blobs are unaffected
+	require.Len(t, fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data, 4)
+
+	// Reaching the tombstone stops the walk back, as it would for any existing block
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Two.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestArchiver_StoreBlockHeaders(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Two.String(), false)
+	require.NoError(t, err)
+	require.Nil(t, fs.ReadOrFail(t, blobtest.Two).Header.BeaconBlockHeader)
+
+	svc.cfg.StoreBlockHeaders = true
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+
+	data := fs.ReadOrFail(t, blobtest.Three)
+	require.Equal(t, beacon.Headers[blobtest.Three.String()].Header, data.Header.BeaconBlockHeader)
+	require.Len(t, data.BlobSidecars.Data, 4)
+	require.Empty(t, data.Header.Fork)
+
+	// The fork of the block is stored with its header, so that its inclusion proofs can be verified later
+	svc.forks.Store(&forkSchedule{slotsPerEpoch: 1, forks: []forkEpoch{{name: "deneb", epoch: 0}}})
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, "deneb", fs.ReadOrFail(t, blobtest.Four).Header.Fork)
+}
+
+func TestArchiver_IndexBlobs(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.One.String(), false)
+	require.NoError(t, err)
+	one := fs.ReadOrFail(t, blobtest.One).BlobSidecars.Data[0]
+	_, err = fs.ReadBlobLocation(context.Background(), one.VersionedHash())
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	svc.cfg.IndexBlobs = true
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+
+	for _, sidecar := range fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data {
+		location, err := fs.ReadBlobLocation(context.Background(), sidecar.VersionedHash())
+		require.NoError(t, err)
+		require.Equal(t, storage.BlobLocation{BlockRoot: blobtest.Three, Index: uint64(sidecar.Index)}, location)
+	}
+}
+
+func TestArchiver_DuplicateIndices(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// The beacon node returns the sidecars of Three out of order, with index 1 repeated
+	sidecars := beacon.Blobs[blobtest.Three.String()]
+	repeat := *sidecars[1]
+	repeat.KZGProof = deneb.KZGProof{1}
+	beacon.Blobs[blobtest.Three.String()] = []*deneb.BlobSidecar{sidecars[3], sidecars[1], sidecars[0], &repeat, sidecars[2]}
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	var dupErr *storage.DuplicateIndicesError
+	require.ErrorAs(t, err, &dupErr)
+	require.Equal(t, []deneb.BlobIndex{1}, dupErr.Indices)
+	fs.CheckNotExistsOrFail(t, blobtest.Three)
+
+	svc.cfg.DuplicateIndices = storage.DuplicatesKeepLast
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+
+	// The stored sidecars are in index order, with the last of the repeated index
+	expected := storage.FromDenebSidecars([]*deneb.BlobSidecar{sidecars[0], &repeat, sidecars[2], sidecars[3]})
+	require.Equal(t, expected, fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data)
+}
+
 func TestArchiver_BackfillToOrigin(t *testing.T) {
 	beacon := beacontest.NewDefaultStubBeaconClient(t)
 	svc, fs := setup(t, beacon)
@@ -94,7 +187,7 @@ func TestArchiver_BackfillToOrigin(t *testing.T) {
 			BeaconBlockHash: blobtest.Five,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]),
 		},
 	})
 	require.NoError(t, err)
@@ -110,7 +203,7 @@ func TestArchiver_BackfillToOrigin(t *testing.T) {
 	for _, blob := range expectedBlobs {
 		fs.CheckExistsOrFail(t, blob)
 		data := fs.ReadOrFail(t, blob)
-		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
+		require.Equal(t, data.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blob.String()]))
 	}
 }
 
@@ -124,7 +217,7 @@ func TestArchiver_BackfillToExistingBlock(t *testing.T) {
 			BeaconBlockHash: blobtest.Five,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]),
 		},
 	})
 	require.NoError(t, err)
@@ -135,7 +228,7 @@ func TestArchiver_BackfillToExistingBlock(t *testing.T) {
 			BeaconBlockHash: blobtest.One,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.One.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.One.String()]),
 		},
 	})
 	require.NoError(t, err)
@@ -159,7 +252,7 @@ func TestArchiver_BackfillToExistingBlock(t *testing.T) {
 		data, err := fs.ReadBlob(context.Background(), blob)
 		require.NoError(t, err)
 		require.NotNil(t, data)
-		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
+		require.Equal(t, data.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blob.String()]))
 	}
 }
 
@@ -191,7 +284,7 @@ func TestArchiver_BackfillFinishOldProcess(t *testing.T) {
 			BeaconBlockHash: blobtest.Five,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]),
 		},
 	})
 	require.NoError(t, err)
@@ -202,7 +295,7 @@ func TestArchiver_BackfillFinishOldProcess(t *testing.T) {
 			BeaconBlockHash: blobtest.Three,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Three.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]),
 		},
 	})
 	require.NoError(t, err)
@@ -213,7 +306,7 @@ func TestArchiver_BackfillFinishOldProcess(t *testing.T) {
 			BeaconBlockHash: blobtest.One,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.One.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.One.String()]),
 		},
 	})
 	require.NoError(t, err)
@@ -250,7 +343,7 @@ func TestArchiver_BackfillFinishOldProcess(t *testing.T) {
 		data, err := fs.ReadBlob(context.Background(), blob)
 		require.NoError(t, err)
 		require.NotNil(t, data)
-		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
+		require.Equal(t, data.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blob.String()]))
 	}
 
 	actualProcesses, err = svc.dataStoreClient.ReadBackfillProcesses(context.Background())
@@ -260,6 +353,88 @@ func TestArchiver_BackfillFinishOldProcess(t *testing.T) {
 
 }
 
+func TestArchiver_BackfillReplaysWAL(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// Blocks 5, 4, 3 and 1 are stored, the archiver crashed while writing block 2 for the process that started at 4
+	for _, hash := range []common.Hash{blobtest.Five, blobtest.Four, blobtest.Three, blobtest.One} {
+		fs.WriteOrFail(t, storage.BlobData{
+			Header: storage.Header{
+				BeaconBlockHash: hash,
+			},
+			BlobSidecars: storage.BlobSidecars{
+				Data: storage.FromDenebSidecars(beacon.Blobs[hash.String()]),
+			},
+		})
+	}
+	fs.WriteOrFail(t, storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.Two,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1)),
+		},
+	})
+
+	// The checkpoint is stale, only the WAL knows that block 3 was stored and block 2 was in-flight
+	err := svc.dataStoreClient.WriteBackfillProcesses(context.Background(), storage.BackfillProcesses{
+		blobtest.Four: storage.BackfillProcess{Start: *beacon.Headers[blobtest.Four.String()], Current: *beacon.Headers[blobtest.Four.String()]},
+	})
+	require.NoError(t, err)
+
+	err = svc.dataStoreClient.WriteBackfillWAL(context.Background(), storage.BackfillWAL{
+		Entries: []storage.BackfillWALEntry{
+			{Process: blobtest.Four, Root: blobtest.Three, Done: true, Header: beacon.Headers[blobtest.Three.String()]},
+			{Process: blobtest.Four, Root: blobtest.Two},
+			// Entries for processes that no longer exist are discarded
+			{Process: blobtest.Six, Root: blobtest.Seven},
+		},
+	})
+	require.NoError(t, err)
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	// The partial write of block 2 should have been replaced
+	require.Equal(t, storage.FromDenebSidecars(beacon.Blobs[blobtest.Two.String()]), fs.ReadOrFail(t, blobtest.Two).BlobSidecars.Data)
+
+	processes, err := svc.dataStoreClient.ReadBackfillProcesses(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, storage.BackfillProcesses{}, processes)
+
+	wal, err := svc.dataStoreClient.ReadBackfillWAL(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, wal.Entries)
+}
+
+func TestArchiver_WALCompaction(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, _ := setup(t, beacon)
+	ctx := context.Background()
+
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two} {
+		inFlight := svc.walBegin(ctx, blobtest.Five, hash)
+		require.False(t, inFlight)
+		svc.walComplete(ctx, blobtest.Five, beacon.Headers[hash.String()])
+	}
+
+	// Only the latest completed block is retained
+	wal, err := svc.dataStoreClient.ReadBackfillWAL(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []storage.BackfillWALEntry{
+		{Process: blobtest.Five, Root: blobtest.Two, Done: true, Header: beacon.Headers[blobtest.Two.String()]},
+	}, wal.Entries)
+
+	// A block that is already in-flight is reported as such
+	require.False(t, svc.walBegin(ctx, blobtest.Five, blobtest.One))
+	require.True(t, svc.walBegin(ctx, blobtest.Five, blobtest.One))
+
+	svc.walForget(ctx, blobtest.Five)
+	wal, err = svc.dataStoreClient.ReadBackfillWAL(ctx)
+	require.NoError(t, err)
+	require.Empty(t, wal.Entries)
+}
+
 func TestArchiver_LatestStopsAtExistingBlock(t *testing.T) {
 	beacon := beacontest.NewDefaultStubBeaconClient(t)
 	svc, fs := setup(t, beacon)
@@ -270,7 +445,7 @@ func TestArchiver_LatestStopsAtExistingBlock(t *testing.T) {
 			BeaconBlockHash: blobtest.Three,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Three.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]),
 		},
 	})
 
@@ -283,17 +458,17 @@ func TestArchiver_LatestStopsAtExistingBlock(t *testing.T) {
 	fs.CheckExistsOrFail(t, blobtest.Five)
 	five := fs.ReadOrFail(t, blobtest.Five)
 	require.Equal(t, five.Header.BeaconBlockHash, blobtest.Five)
-	require.Equal(t, five.BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	require.Equal(t, five.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]))
 
 	fs.CheckExistsOrFail(t, blobtest.Four)
 	four := fs.ReadOrFail(t, blobtest.Four)
 	require.Equal(t, four.Header.BeaconBlockHash, blobtest.Four)
-	require.Equal(t, five.BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	require.Equal(t, five.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]))
 
 	fs.CheckExistsOrFail(t, blobtest.Three)
 	three := fs.ReadOrFail(t, blobtest.Three)
 	require.Equal(t, three.Header.BeaconBlockHash, blobtest.Three)
-	require.Equal(t, five.BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	require.Equal(t, five.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]))
 }
 
 func TestArchiver_LatestNoNewData(t *testing.T) {
@@ -306,7 +481,7 @@ func TestArchiver_LatestNoNewData(t *testing.T) {
 			BeaconBlockHash: common.Hash(beacon.Headers["head"].Root),
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Three.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]),
 		},
 	})
 
@@ -330,7 +505,7 @@ func TestArchiver_LatestConsumesNewBlocks(t *testing.T) {
 			BeaconBlockHash: common.Hash(beacon.Headers[blobtest.Four.String()].Root),
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Four.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Four.String()]),
 		},
 	})
 
@@ -360,7 +535,7 @@ func TestArchiver_LatestStopsAtOrigin(t *testing.T) {
 			BeaconBlockHash: blobtest.OriginBlock,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.OriginBlock.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.OriginBlock.String()]),
 		},
 	})
 
@@ -375,7 +550,7 @@ func TestArchiver_LatestStopsAtOrigin(t *testing.T) {
 	for _, hash := range toWrite {
 		fs.CheckExistsOrFail(t, hash)
 		data := fs.ReadOrFail(t, hash)
-		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[hash.String()])
+		require.Equal(t, data.BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[hash.String()]))
 	}
 }
 
@@ -389,7 +564,7 @@ func TestArchiver_LatestRetriesOnFailure(t *testing.T) {
 			BeaconBlockHash: blobtest.Three,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Three.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]),
 		},
 	})
 
@@ -416,7 +591,7 @@ func TestArchiver_LatestHaltsOnPersistentError(t *testing.T) {
 			BeaconBlockHash: blobtest.Three,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Three.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]),
 		},
 	})
 
@@ -443,7 +618,7 @@ func TestArchiver_RearchiveRange(t *testing.T) {
 			BeaconBlockHash: blobtest.Three,
 		},
 		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Three.String()],
+			Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]),
 		},
 	})
 
@@ -471,5 +646,5 @@ func TestArchiver_RearchiveRange(t *testing.T) {
 	fs.CheckExistsOrFail(t, blobtest.Four)
 
 	// Should have overwritten any existing blobs
-	require.Equal(t, fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data, beacon.Blobs[blobtest.Three.String()])
+	require.Equal(t, fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Three.String()]))
 }
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// rateLimitBackoff is a pause shared by every request to the beacon node, which starts when the beacon node rate
+// limits a request with a 429. The live follower, backfill and retries all wait for it before their next request, so
+// the whole process throttles together rather than each worker retrying into the limit. Each pause is twice as long
+// as the previous one, up to the maximum, and every request that succeeds halves the next pause, so the archiver ramps
+// back up to its full rate as the beacon node stops limiting it. Requests that were already in flight when a pause
+// started do not extend it.
+type rateLimitBackoff struct {
+	mu      sync.Mutex
+	initial time.Duration
+	max     time.Duration
+	// next is the length of the next pause, 0 if the beacon node has not rate limited a request recently
+	next    time.Duration
+	until   time.Time
+	metrics metrics.Metricer
+	log     log.Logger
+}
+
+// newRateLimitBackoff creates a rateLimitBackoff whose pauses are from initial to limit long, an initial of 0 disables
+// the backoff.
+func newRateLimitBackoff(initial, limit time.Duration, m metrics.Metricer, l log.Logger) *rateLimitBackoff {
+	return &rateLimitBackoff{
+		initial: initial,
+		max:     max(initial, limit),
+		metrics: m,
+		log:     l,
+	}
+}
+
+// wait blocks until the current pause, if any, is over or the context is done.
+func (b *rateLimitBackoff) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		remaining := time.Until(b.until)
+		b.mu.Unlock()
+
+		if remaining <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// observe records the result of a request to the beacon node, starting a pause if it was rate limited.
+func (b *rateLimitBackoff) observe(err error) {
+	if b.initial <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.next /= 2
+		if b.next < b.initial {
+			b.next = 0
+		}
+		return
+	}
+
+	now := time.Now()
+	if !isRateLimited(err) || now.Before(b.until) {
+		return
+	}
+
+	b.next = min(max(b.next*2, b.initial), b.max)
+	b.until = now.Add(b.next)
+	b.metrics.RecordRateLimitBackoff(b.next)
+	b.log.Warn("beacon node is rate limiting requests, pausing all requests", "pause", b.next)
+}
+
+// isRateLimited returns whether err is a 429 Too Many Requests response from the beacon node.
+func isRateLimited(err error) bool {
+	var apiErr *api.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var errRateLimited = &api.Error{Method: http.MethodGet, StatusCode: http.StatusTooManyRequests}
+
+func TestRateLimitBackoff_Disabled(t *testing.T) {
+	b := newRateLimitBackoff(0, time.Minute, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo))
+	b.observe(errRateLimited)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, b.wait(ctx))
+}
+
+func TestRateLimitBackoff_Pauses(t *testing.T) {
+	m := metrics.NewMetrics()
+	// Pauses of exact binary fractions of a second, so that the total time is exact
+	b := newRateLimitBackoff(62500*time.Microsecond, 187500*time.Microsecond, m, testlog.Logger(t, log.LvlInfo))
+
+	// Other errors do not pause requests
+	b.observe(errors.New("connection refused"))
+	b.observe(&api.Error{StatusCode: http.StatusServiceUnavailable})
+	require.Zero(t, b.next)
+
+	start := time.Now()
+	b.observe(errRateLimited)
+	require.Equal(t, 62500*time.Microsecond, b.next)
+
+	// A request that was in flight when the pause started does not extend it
+	until := b.until
+	b.observe(errRateLimited)
+	require.Equal(t, until, b.until)
+
+	require.NoError(t, b.wait(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), 62500*time.Microsecond)
+
+	// Each pause that is followed by another 429 is twice as long, up to the maximum
+	b.observe(errRateLimited)
+	require.Equal(t, 125*time.Millisecond, b.next)
+	require.NoError(t, b.wait(context.Background()))
+	b.observe(errRateLimited)
+	require.Equal(t, 187500*time.Microsecond, b.next)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, b.wait(ctx), context.Canceled)
+	require.NoError(t, b.wait(context.Background()))
+
+	// Requests that succeed ramp the pause back down
+	b.observe(nil)
+	require.Equal(t, 93750*time.Microsecond, b.next)
+	b.observe(nil)
+	require.Zero(t, b.next)
+
+	expected := `
+# HELP blob_archiver_rate_limit_backoffs number of times all requests to the beacon node were paused because it rate limited a request
+# TYPE blob_archiver_rate_limit_backoffs counter
+blob_archiver_rate_limit_backoffs 3
+# HELP blob_archiver_rate_limit_backoff_seconds total time that all requests to the beacon node were paused for because it rate limited them
+# TYPE blob_archiver_rate_limit_backoff_seconds counter
+blob_archiver_rate_limit_backoff_seconds 0.375
+`
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "blob_archiver_rate_limit_backoffs", "blob_archiver_rate_limit_backoff_seconds"))
+}
+
+// rateLimitingBeaconClient rate limits the first limited requests for block headers.
+type rateLimitingBeaconClient struct {
+	*beacontest.StubBeaconClient
+	limited atomic.Int32
+}
+
+func (c *rateLimitingBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if c.limited.Add(-1) >= 0 {
+		return nil, errRateLimited
+	}
+	return c.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func TestArchiver_RateLimitPausesEveryRequest(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := &rateLimitingBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	beacon.limited.Store(1)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:        5 * time.Second,
+		OriginBlock:         blobtest.OriginBlock,
+		RateLimitBackoff:    100 * time.Millisecond,
+		RateLimitMaxBackoff: time.Second,
+	}, storagetest.NewTestFileStorage(t, l), beacon, metrics.NewMetrics())
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.ErrorIs(t, err, errRateLimited)
+
+	// The next request for any block, e.g. from the backfill, waits for the pause
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+)
+
+// memoryBudget limits the approximate number of bytes of decoded sidecars that are held in memory at once. Fetches
+// wait for the budget before they start, rather than reserving a fixed amount, because the number of blobs in a block
+// is not known until it has been fetched. This means the budget can be exceeded by the size of the blocks that are
+// fetched concurrently, but a fetch can always proceed when nothing else is in-flight, so a single large block never
+// deadlocks.
+type memoryBudget struct {
+	mu       sync.Mutex
+	limit    uint64
+	inFlight uint64
+	changed  chan struct{}
+	metrics  metrics.Metricer
+}
+
+// newMemoryBudget creates a memoryBudget of limit bytes, a limit of 0 disables the budget.
+func newMemoryBudget(limit uint64, m metrics.Metricer) *memoryBudget {
+	return &memoryBudget{
+		limit:   limit,
+		changed: make(chan struct{}),
+		metrics: m,
+	}
+}
+
+// wait blocks until the in-flight bytes are below the limit or the context is done.
+func (b *memoryBudget) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if b.limit == 0 || b.inFlight < b.limit {
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// acquire records n bytes as in-flight.
+func (b *memoryBudget) acquire(n uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inFlight += n
+	b.metrics.RecordInFlightBytes(b.inFlight)
+}
+
+// release records that n bytes are no longer in-flight and wakes any waiting fetches.
+func (b *memoryBudget) release(n uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inFlight -= n
+	b.metrics.RecordInFlightBytes(b.inFlight)
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// sidecarsSize returns the approximate in-memory size of the sidecars.
+func sidecarsSize(sidecars []*deneb.BlobSidecar) uint64 {
+	size := uint64(0)
+	for _, sidecar := range sidecars {
+		size += uint64(sidecar.SizeSSZ())
+	}
+	return size
+}
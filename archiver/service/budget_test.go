@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBudget_Unlimited(t *testing.T) {
+	b := newMemoryBudget(0, metrics.NewMetrics())
+	b.acquire(1 << 40)
+	require.NoError(t, b.wait(context.Background()))
+}
+
+func TestMemoryBudget_WaitsForRelease(t *testing.T) {
+	b := newMemoryBudget(100, metrics.NewMetrics())
+
+	// A fetch can always proceed when nothing is in-flight, even if it exceeds the budget
+	require.NoError(t, b.wait(context.Background()))
+	b.acquire(150)
+
+	done := make(chan error)
+	go func() {
+		done <- b.wait(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("wait returned while the budget was exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.release(150)
+	require.NoError(t, <-done)
+}
+
+func TestMemoryBudget_ContextCancelled(t *testing.T) {
+	b := newMemoryBudget(100, metrics.NewMetrics())
+	b.acquire(100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, b.wait(ctx), context.Canceled)
+}
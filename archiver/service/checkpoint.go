@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// backfillCheckpointInterval is the number of slots completed between writes of the checkpoint. At most this
+	// many slots are fetched again after a restart, and they are skipped as already stored.
+	backfillCheckpointInterval = 10
+	// backfillWindow is how far past the lowest slot that has not been backfilled that slots are handed to workers,
+	// which bounds the size of the checkpoint while a slot is being retried.
+	backfillWindow = 1024
+)
+
+// rangeProgress tracks which slots of a backfill range have been completed by the workers, see backfillRange.
+type rangeProgress struct {
+	mu         sync.Mutex
+	checkpoint storage.BackfillCheckpoint
+	// done are the completed slots after checkpoint.NextSlot
+	done map[uint64]bool
+	// changed is closed and replaced whenever checkpoint.NextSlot advances
+	changed chan struct{}
+	// sinceWrite is the number of slots completed since the checkpoint was last written
+	sinceWrite int
+}
+
+func newRangeProgress(checkpoint storage.BackfillCheckpoint) *rangeProgress {
+	p := &rangeProgress{
+		checkpoint: checkpoint,
+		done:       make(map[uint64]bool),
+		changed:    make(chan struct{}),
+	}
+	for _, slot := range checkpoint.Done {
+		p.done[slot] = true
+	}
+	p.advance()
+	return p
+}
+
+// advance moves NextSlot past the completed slots. The caller must hold mu.
+func (p *rangeProgress) advance() {
+	for p.done[p.checkpoint.NextSlot] {
+		delete(p.done, p.checkpoint.NextSlot)
+		p.checkpoint.NextSlot++
+	}
+}
+
+// skip marks every slot before slot as completed, e.g. as they are outside the retention window.
+func (p *rangeProgress) skip(slot uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for s := range p.done {
+		if s < slot {
+			delete(p.done, s)
+		}
+	}
+	p.checkpoint.NextSlot = max(p.checkpoint.NextSlot, slot)
+	p.advance()
+}
+
+// isDone returns true if slot has been completed.
+func (p *rangeProgress) isDone(slot uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slot < p.checkpoint.NextSlot || p.done[slot]
+}
+
+// complete marks slot as completed. It returns true once backfillCheckpointInterval slots have been completed since
+// the checkpoint was last written.
+func (p *rangeProgress) complete(slot uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := p.checkpoint.NextSlot
+	p.done[slot] = true
+	p.advance()
+	if p.checkpoint.NextSlot != next {
+		close(p.changed)
+		p.changed = make(chan struct{})
+	}
+
+	p.sinceWrite++
+	return p.sinceWrite >= backfillCheckpointInterval
+}
+
+// waitWindow blocks until slot is within backfillWindow of the lowest slot not completed, or the context is done.
+func (p *rangeProgress) waitWindow(ctx context.Context, slot uint64) error {
+	for {
+		p.mu.Lock()
+		if slot < p.checkpoint.NextSlot+backfillWindow {
+			p.mu.Unlock()
+			return nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// snapshot returns the checkpoint of the slots completed so far, and resets the count of slots since it was written.
+func (p *rangeProgress) snapshot() storage.BackfillCheckpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	checkpoint := p.checkpoint
+	checkpoint.Done = make([]uint64, 0, len(p.done))
+	for slot := range p.done {
+		checkpoint.Done = append(checkpoint.Done, slot)
+	}
+	slices.Sort(checkpoint.Done)
+	p.sinceWrite = 0
+	return checkpoint
+}
+
+// rangeCheckpoint returns the checkpoint to backfill the configured range from, resuming the stored checkpoint if it
+// is of the same range. Without an end slot the range ends at the head, unless a checkpoint of a range with the same
+// start is resumed, as the blocks since are stored by the backfill from the head.
+func (a *Archiver) rangeCheckpoint(ctx context.Context, head *v1.BeaconBlockHeader) (storage.BackfillCheckpoint, error) {
+	start, end := a.cfg.BackfillStartSlot, a.cfg.BackfillEndSlot
+
+	stored, err := a.dataStoreClient.ReadBackfillCheckpoint(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return storage.BackfillCheckpoint{}, err
+	}
+
+	if err == nil && stored.StartSlot == start && (end == 0 || stored.EndSlot == end) {
+		return stored, nil
+	}
+	if err == nil {
+		a.log.Info("backfill range changed, discarding checkpoint", "startSlot", stored.StartSlot, "endSlot", stored.EndSlot, "nextSlot", stored.NextSlot)
+	}
+
+	if end == 0 {
+		end = uint64(head.Header.Message.Slot)
+	}
+	return storage.BackfillCheckpoint{StartSlot: start, EndSlot: end, NextSlot: start}, nil
+}
+
+// backfillRange stores the blobs of every slot in the configured backfill range, fetching them by slot number with
+// BackfillConcurrency workers rather than walking back the chain one block at a time. Slots that are already stored or
+// were missed are skipped, and a slot that fails is queued to be re-attempted in the background and dead-lettered once
+// its attempts are exhausted, like the blocks of backfillBlobs, so that one bad slot does not stall the range. If the
+// retry queue is disabled, a slot that fails is retried by its worker until it succeeds while the others carry on.
+// The progress is written to a checkpoint in storage every backfillCheckpointInterval slots, so that an interrupted
+// backfill resumes from the slots that were not completed rather than from the start of the range.
+func (a *Archiver) backfillRange(ctx context.Context, head *v1.BeaconBlockHeader) {
+	checkpoint, err := a.rangeCheckpoint(ctx, head)
+	if err != nil {
+		a.log.Error("failed to read backfill checkpoint, not backfilling range", "err", err)
+		return
+	}
+
+	progress := newRangeProgress(checkpoint)
+	if cutoff, retained := retentionCutoff(uint64(head.Header.Message.Slot), a.cfg.RetentionSlots); retained {
+		// Blocks older than the retention window are not backfilled, as the reaper would delete them again
+		progress.skip(cutoff)
+	}
+
+	l := a.log.New("startSlot", checkpoint.StartSlot, "endSlot", checkpoint.EndSlot)
+	if progress.isDone(checkpoint.EndSlot) {
+		l.Info("backfill range already complete")
+		return
+	}
+
+	concurrency := max(a.cfg.BackfillConcurrency, 1)
+	l.Info("backfill range initiated", "nextSlot", progress.checkpoint.NextSlot, "done", len(checkpoint.Done), "concurrency", concurrency)
+
+	writeCheckpoint := func() {
+		snapshot := progress.snapshot()
+		// The checkpoint is written with a fresh context, so that the progress is kept when the archiver is stopped
+		if err := a.dataStoreClient.WriteBackfillCheckpoint(context.Background(), snapshot); err != nil {
+			a.log.Error("failed to write backfill_checkpoint", "err", err)
+		}
+	}
+
+	if a.retries != nil {
+		retryCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go a.retries.run(retryCtx, a.retryBackfillBlock)
+	}
+
+	began := time.Now()
+	slots := make(chan uint64)
+	var wg sync.WaitGroup
+	var writeMu sync.Mutex
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slots {
+				if !a.backfillSlot(ctx, slot) {
+					continue
+				}
+				if progress.complete(slot) {
+					writeMu.Lock()
+					writeCheckpoint()
+					writeMu.Unlock()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for slot := checkpoint.NextSlot; slot <= checkpoint.EndSlot; slot++ {
+		if progress.isDone(slot) {
+			continue
+		}
+		if err := progress.waitWindow(ctx, slot); err != nil {
+			break
+		}
+
+		select {
+		case slots <- slot:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(slots)
+	wg.Wait()
+	writeCheckpoint()
+	if a.retries != nil {
+		a.retries.waitIdle(ctx)
+	}
+
+	if !progress.isDone(checkpoint.EndSlot) {
+		l.Info("backfill range interrupted", "nextSlot", progress.checkpoint.NextSlot, "duration", time.Since(began))
+		return
+	}
+	l.Info("backfill range complete", "duration", time.Since(began))
+}
+
+// backfillSlot stores the blobs of the block at slot. It returns true once the blobs are stored, if the slot was
+// missed, or if the slot failed and was queued to be re-attempted in the background (see retryQueue), and false if the
+// context ended first. If the retry queue is disabled, a slot that fails is retried inline until it succeeds.
+func (a *Archiver) backfillSlot(ctx context.Context, slot uint64) bool {
+	id := strconv.FormatUint(slot, 10)
+	for {
+		header, exists, err := a.persistBlobsForBlockToS3(ctx, id, false)
+		if err == nil {
+			if !exists {
+				a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+				a.freshness.record(metrics.BlockSourceBackfill, header.Header.Message.Slot)
+			}
+			return true
+		}
+
+		// If the block is not found, the slot was missed
+		if isNotFound(err) {
+			return true
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if a.retries != nil {
+			// The block is re-attempted by its root if its header was fetched, and by its slot otherwise
+			var root common.Hash
+			var blobsErr *blobsError
+			if errors.As(err, &blobsErr) {
+				root = common.Hash(blobsErr.header.Root)
+			}
+			a.log.Warn("failed to persist blobs for slot, queued for retry", "slot", slot, "err", err)
+			a.retries.add(common.Hash{}, root, phase0.Slot(slot), err)
+			return true
+		}
+
+		a.log.Error("failed to persist blobs for slot, will retry", "slot", slot, "err", err)
+
+		select {
+		case <-time.After(backfillErrorRetryInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// isNotFound returns whether err is a 404 Not Found response from the beacon node.
+func isNotFound(err error) bool {
+	var apiErr *api.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeProgress(t *testing.T) {
+	p := newRangeProgress(storage.BackfillCheckpoint{StartSlot: 10, EndSlot: 5000, NextSlot: 10, Done: []uint64{11, 13}})
+
+	require.True(t, p.isDone(11))
+	require.False(t, p.isDone(10))
+
+	// Completing the lowest slot advances past the slots completed after it
+	p.complete(10)
+	require.Equal(t, storage.BackfillCheckpoint{StartSlot: 10, EndSlot: 5000, NextSlot: 12, Done: []uint64{13}}, p.snapshot())
+
+	p.complete(20)
+	p.complete(15)
+	require.Equal(t, []uint64{13, 15, 20}, p.snapshot().Done)
+
+	// The checkpoint is due once enough slots have been completed since it was written
+	for slot := uint64(100); slot < 100+backfillCheckpointInterval-1; slot++ {
+		require.False(t, p.complete(slot))
+	}
+	require.True(t, p.complete(200))
+
+	p.skip(16)
+	checkpoint := p.snapshot()
+	require.Equal(t, uint64(16), checkpoint.NextSlot)
+	require.NotContains(t, checkpoint.Done, uint64(13))
+}
+
+func TestRangeProgress_Window(t *testing.T) {
+	p := newRangeProgress(storage.BackfillCheckpoint{StartSlot: 10, EndSlot: 5000, NextSlot: 10})
+	require.NoError(t, p.waitWindow(context.Background(), 10+backfillWindow-1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.waitWindow(ctx, 10+backfillWindow), context.DeadlineExceeded)
+
+	// Completing the lowest slot lets the next slot be handed out
+	waited := make(chan error)
+	go func() {
+		waited <- p.waitWindow(context.Background(), 10+backfillWindow)
+	}()
+	p.complete(10)
+	require.NoError(t, <-waited)
+}
+
+// slotRoot returns the root of the stub block at slot.
+func slotRoot(beacon *beacontest.StubBeaconClient, slot uint64) common.Hash {
+	return common.Hash(beacon.Headers[strconv.FormatUint(slot, 10)].Root)
+}
+
+func setupRange(t *testing.T, start uint64, end uint64) (*Archiver, *storagetest.TestFileStorage, *beacontest.StubBeaconClient) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.BackfillConcurrency = 3
+	svc.cfg.BackfillStartSlot = start
+	svc.cfg.BackfillEndSlot = end
+	return svc, fs, beacon
+}
+
+func TestArchiver_BackfillRange(t *testing.T) {
+	svc, fs, beacon := setupRange(t, blobtest.StartSlot, blobtest.EndSlot+1)
+	// The slot after the last block was missed
+	svc.beaconClient = &notFoundBeaconClient{StubBeaconClient: beacon, missing: strconv.FormatUint(blobtest.EndSlot+1, 10)}
+
+	svc.backfillRange(context.Background(), beacon.Headers["head"])
+
+	for slot := uint64(blobtest.StartSlot); slot <= blobtest.EndSlot; slot++ {
+		fs.CheckExistsOrFail(t, slotRoot(beacon, slot))
+	}
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, storage.BackfillCheckpoint{StartSlot: blobtest.StartSlot, EndSlot: blobtest.EndSlot + 1, NextSlot: blobtest.EndSlot + 2}, checkpoint)
+}
+
+func TestArchiver_BackfillRangeResumes(t *testing.T) {
+	svc, fs, beacon := setupRange(t, blobtest.StartSlot, 0)
+
+	// A previous run completed the first two slots and one ahead of them, and ended the range at the head it saw then
+	require.NoError(t, fs.WriteBackfillCheckpoint(context.Background(), storage.BackfillCheckpoint{
+		StartSlot: blobtest.StartSlot,
+		EndSlot:   blobtest.EndSlot - 1,
+		NextSlot:  blobtest.StartSlot + 2,
+		Done:      []uint64{blobtest.StartSlot + 3},
+	}))
+
+	svc.backfillRange(context.Background(), beacon.Headers["head"])
+
+	for _, slot := range []uint64{blobtest.StartSlot, blobtest.StartSlot + 1, blobtest.StartSlot + 3, blobtest.EndSlot} {
+		fs.CheckNotExistsOrFail(t, slotRoot(beacon, slot))
+	}
+	for _, slot := range []uint64{blobtest.StartSlot + 2, blobtest.StartSlot + 4} {
+		fs.CheckExistsOrFail(t, slotRoot(beacon, slot))
+	}
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(blobtest.EndSlot), checkpoint.NextSlot)
+	require.Empty(t, checkpoint.Done)
+}
+
+func TestArchiver_BackfillRangeChanged(t *testing.T) {
+	svc, fs, beacon := setupRange(t, blobtest.StartSlot+4, blobtest.EndSlot)
+
+	// The checkpoint of another range is discarded
+	require.NoError(t, fs.WriteBackfillCheckpoint(context.Background(), storage.BackfillCheckpoint{
+		StartSlot: blobtest.StartSlot,
+		EndSlot:   blobtest.EndSlot,
+		NextSlot:  blobtest.EndSlot + 1,
+	}))
+
+	svc.backfillRange(context.Background(), beacon.Headers["head"])
+
+	fs.CheckNotExistsOrFail(t, slotRoot(beacon, blobtest.StartSlot+3))
+	fs.CheckExistsOrFail(t, slotRoot(beacon, blobtest.StartSlot+4))
+	fs.CheckExistsOrFail(t, slotRoot(beacon, blobtest.EndSlot))
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, storage.BackfillCheckpoint{StartSlot: blobtest.StartSlot + 4, EndSlot: blobtest.EndSlot, NextSlot: blobtest.EndSlot + 1}, checkpoint)
+}
+
+func TestArchiver_BackfillRangeRetention(t *testing.T) {
+	svc, fs, beacon := setupRange(t, blobtest.StartSlot, blobtest.EndSlot)
+	// The slots from two slots behind the head are within the retention window, as the reaper keeps them
+	svc.cfg.RetentionSlots = 2
+
+	svc.backfillRange(context.Background(), beacon.Headers[strconv.FormatUint(blobtest.EndSlot, 10)])
+
+	fs.CheckNotExistsOrFail(t, slotRoot(beacon, blobtest.EndSlot-3))
+	fs.CheckExistsOrFail(t, slotRoot(beacon, blobtest.EndSlot-2))
+	fs.CheckExistsOrFail(t, slotRoot(beacon, blobtest.EndSlot-1))
+	fs.CheckExistsOrFail(t, slotRoot(beacon, blobtest.EndSlot))
+}
+
+// brokenHeaderBeaconClient is a stub beacon client that fails to return the header of a block.
+type brokenHeaderBeaconClient struct {
+	*flakyBeaconClient
+	broken string
+}
+
+func (c *brokenHeaderBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if opts.Block == c.broken {
+		return nil, errors.New("failed to decode header")
+	}
+	return c.flakyBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func TestArchiver_BackfillRangeDeadLettersFailedSlots(t *testing.T) {
+	svc, fs, beacon := setupRange(t, blobtest.StartSlot, blobtest.EndSlot)
+	svc.retries = newRetryQueue(3, retry.Fixed(time.Millisecond))
+	// The blobs of one slot and the header of another always fail, and a third slot fails once
+	broken := strconv.FormatUint(blobtest.StartSlot+2, 10)
+	svc.beaconClient = &brokenHeaderBeaconClient{
+		flakyBeaconClient: &flakyBeaconClient{StubBeaconClient: beacon, failures: map[string]int{
+			slotRoot(beacon, blobtest.StartSlot+1).String(): 100,
+			slotRoot(beacon, blobtest.StartSlot+3).String(): 1,
+		}},
+		broken: broken,
+	}
+
+	svc.backfillRange(context.Background(), beacon.Headers["head"])
+
+	// The range moves on past the failed slots
+	for _, slot := range []uint64{blobtest.StartSlot, blobtest.StartSlot + 3, blobtest.StartSlot + 4, blobtest.EndSlot} {
+		fs.CheckExistsOrFail(t, slotRoot(beacon, slot))
+	}
+	fs.CheckNotExistsOrFail(t, slotRoot(beacon, blobtest.StartSlot+1))
+	fs.CheckNotExistsOrFail(t, slotRoot(beacon, blobtest.StartSlot+2))
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(blobtest.EndSlot+1), checkpoint.NextSlot)
+
+	status := svc.retries.status()
+	require.Zero(t, status.Pending)
+	require.ElementsMatch(t, []DeadLetter{
+		{Root: slotRoot(beacon, blobtest.StartSlot+1).String(), Slot: blobtest.StartSlot + 1, Attempts: 3, LastError: "timeout"},
+		{Slot: blobtest.StartSlot + 2, Attempts: 3, LastError: "failed to decode header"},
+	}, status.DeadLetters)
+}
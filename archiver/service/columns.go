@@ -0,0 +1,113 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// dataColumnsFork is the first fork whose blobs are served as data column sidecars rather than blob sidecars.
+	dataColumnsFork = "fulu"
+	// minDataColumns is the number of data columns of a block that its blobs can be recovered from, half of
+	// NUMBER_OF_COLUMNS as the columns are the Reed-Solomon extension of the blobs to twice their size.
+	minDataColumns = storage.NumberOfColumns / 2
+)
+
+// dataColumnsClient returns the client to fetch the data column sidecars of the block at slot from, if the fork
+// schedule puts the slot in a fork from fulu on and the beacon client can fetch data columns. Otherwise the blobs of
+// the block are fetched as blob sidecars, as they are when the fork schedule is not known.
+func (a *Archiver) dataColumnsClient(slot phase0.Slot) (beacon.DataColumnSidecarsProvider, bool) {
+	schedule := a.forks.Load()
+	if schedule == nil || !schedule.scheduledAt(slot).dataColumns {
+		return nil, false
+	}
+	columnsClient, ok := a.beaconClient.(beacon.DataColumnSidecarsProvider)
+	return columnsClient, ok
+}
+
+// fetchDataColumnBlock fetches the data column sidecars of the block, sorted by index, and returns the block to store
+// with the fork of its columns and their size. A beacon node that returns a column twice is not trusted with the
+// block, as it cannot tell which of the two is the column of the block. The block is only stored if the blobs can be
+// recovered from its columns, which takes at least half of them, so a beacon node that only custodies some columns
+// cannot be archived from. The columns must be of the block's header, and their inclusion and cell proofs are
+// verified before they are stored.
+func (a *Archiver) fetchDataColumnBlock(ctx context.Context, l log.Logger, columnsClient beacon.DataColumnSidecarsProvider, header *v1.BeaconBlockHeader) (storage.BlobData, string, uint64, error) {
+	if err := a.backoff.wait(ctx); err != nil {
+		return storage.BlobData{}, "", 0, err
+	}
+
+	fetchStart := time.Now()
+	response, err := columnsClient.DataColumnSidecars(ctx, &beacon.DataColumnSidecarsOpts{Block: header.Root.String()})
+	a.backoff.observe(err)
+	if err != nil {
+		l.Error("failed to fetch data column sidecars", "duration", time.Since(fetchStart), "err", err)
+		return storage.BlobData{}, "", 0, err
+	}
+
+	l.Debug("fetched data column sidecars", "count", len(response.Data), "duration", time.Since(fetchStart))
+
+	columns := slices.Clone(response.Data)
+	slices.SortFunc(columns, func(x, y *storage.DataColumnSidecar) int {
+		return cmp.Compare(x.Index, y.Index)
+	})
+	for i := 1; i < len(columns); i++ {
+		if columns[i].Index == columns[i-1].Index {
+			return storage.BlobData{}, "", 0, fmt.Errorf("beacon node returned data column %d twice", columns[i].Index)
+		}
+	}
+
+	fork := a.responseFork(response.Metadata, header.Header.Message.Slot)
+	if err := verifyDataColumns(columns, header, fork); err != nil {
+		l.Error("invalid data column sidecars", "count", len(columns), "err", err)
+		return storage.BlobData{}, "", 0, err
+	}
+
+	blobData := storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: common.Hash(header.Root),
+		},
+		BlobSidecars:       storage.BlobSidecars{Data: []*storage.BlobSidecar{}},
+		DataColumnSidecars: &storage.DataColumnSidecars{Data: columns},
+	}
+	return blobData, fork, uint64(blobData.DataColumnSidecars.SizeSSZ()), nil
+}
+
+// verifyDataColumns checks that there are enough columns to recover the blobs of the block from, unless there are
+// none as the block has no blobs, that each column is of the block's header and includes its commitments in the body
+// of the block, using the block body layout of fork, and that each cell matches its commitment.
+func verifyDataColumns(columns []*storage.DataColumnSidecar, header *v1.BeaconBlockHeader, fork string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	if len(columns) < minDataColumns {
+		return fmt.Errorf("beacon node returned %d data columns, at least %d are needed to recover the blobs", len(columns), minDataColumns)
+	}
+
+	root, err := header.Header.Message.HashTreeRoot()
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if err := blobproof.VerifyDataColumnInclusionProof(column, fork); err != nil {
+			return err
+		}
+		if columnRoot, err := column.SignedBlockHeader.Message.HashTreeRoot(); err != nil {
+			return err
+		} else if columnRoot != root {
+			return fmt.Errorf("data column %d has a different block header to block %s", column.Index, header.Root)
+		}
+	}
+
+	return blobproof.VerifyDataColumns(columns)
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/blobproof/blobprooftest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// columnsBeaconClient is a stub beacon client that also serves data column sidecars, by block ID.
+type columnsBeaconClient struct {
+	*beacontest.StubBeaconClient
+	columns map[string][]*storage.DataColumnSidecar
+}
+
+func (c *columnsBeaconClient) DataColumnSidecars(ctx context.Context, opts *beacon.DataColumnSidecarsOpts) (*api.Response[[]*storage.DataColumnSidecar], error) {
+	return &api.Response[[]*storage.DataColumnSidecar]{Data: c.columns[opts.Block]}, nil
+}
+
+func TestForkSchedule_DataColumns(t *testing.T) {
+	beacon := &specBeaconClient{
+		StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t),
+		spec:             map[string]any{"SLOTS_PER_EPOCH": uint64(32), "ELECTRA_FORK_EPOCH": uint64(20), "FULU_FORK_EPOCH": uint64(30)},
+	}
+	schedule, err := newForkSchedule(context.Background(), beacon)
+	require.NoError(t, err)
+
+	require.Equal(t, "electra", schedule.forkAt(959))
+	require.False(t, schedule.scheduledAt(959).dataColumns)
+	require.Equal(t, "fulu", schedule.forkAt(960))
+	require.True(t, schedule.scheduledAt(960).dataColumns)
+}
+
+// newDataColumnsArchiver returns an archiver whose beacon client serves valid data column sidecars of the blobs at
+// the indices for block Three, the first block of fulu, with the trusted setup they are proven with configured.
+func newDataColumnsArchiver(t *testing.T, blobs int, indices ...uint64) (*Archiver, *columnsBeaconClient, *storagetest.TestFileStorage) {
+	require.NoError(t, blobproof.Configure(blobproof.Config{TrustedSetupPath: blobprooftest.WriteSetup(t)}))
+	t.Cleanup(func() { require.NoError(t, blobproof.Configure(blobproof.Config{})) })
+
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	header := stub.Headers[blobtest.Three.String()].Header.Message
+	columns := blobprooftest.NewDataColumnSidecars(t, header, blobprooftest.NewBlobs(t, blobs), indices...)
+	beaconClient := &columnsBeaconClient{StubBeaconClient: stub, columns: map[string][]*storage.DataColumnSidecar{
+		blobtest.Three.String(): columns,
+	}}
+
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{PollInterval: 5 * time.Second, OriginBlock: blobtest.OriginBlock, StoreBlockHeaders: true}, fs, beaconClient, metrics.NewMetrics())
+	require.NoError(t, err)
+	return svc, beaconClient, fs
+}
+
+// useDataColumns sets a fork schedule in which Three is the first block of fulu.
+func useDataColumns(svc *Archiver) {
+	svc.forks.Store(&forkSchedule{slotsPerEpoch: 1, forks: []forkEpoch{{name: "electra", epoch: 0, maxBlobs: 9}, {name: "fulu", epoch: phase0.Epoch(blobtest.StartSlot + 3), dataColumns: true}}})
+}
+
+func TestArchiver_PersistsDataColumns(t *testing.T) {
+	// The columns are returned out of order
+	var indices []uint64
+	for i := uint64(storage.NumberOfColumns - 1); i >= minDataColumns; i-- {
+		indices = append(indices, i)
+	}
+	svc, beaconClient, fs := newDataColumnsArchiver(t, 4, indices...)
+	columns := beaconClient.columns[blobtest.Three.String()]
+
+	// Without a fork schedule the blobs are fetched as blob sidecars
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+	stored := fs.ReadOrFail(t, blobtest.Three)
+	require.Nil(t, stored.DataColumnSidecars)
+	require.Len(t, stored.BlobSidecars.Data, 4)
+
+	useDataColumns(svc)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Two.String(), true)
+	require.NoError(t, err)
+	require.Nil(t, fs.ReadOrFail(t, blobtest.Two).DataColumnSidecars)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), true)
+	require.NoError(t, err)
+	stored = fs.ReadOrFail(t, blobtest.Three)
+	require.Empty(t, stored.BlobSidecars.Data)
+	require.Equal(t, "fulu", stored.Header.Fork)
+	require.Equal(t, beaconClient.Headers[blobtest.Three.String()].Header, stored.Header.BeaconBlockHeader)
+
+	// The columns are stored in order of their index
+	ordered := slices.Clone(columns)
+	slices.Reverse(ordered)
+	require.Equal(t, &storage.DataColumnSidecars{Data: ordered}, stored.DataColumnSidecars)
+	require.Equal(t, 4, stored.Blobs())
+
+	// Both the blobs and the columns are counted by the blobs they hold
+	expected := `
+# HELP blob_archiver_blobs_stored_by_fork number of blobs stored, by the fork of their block
+# TYPE blob_archiver_blobs_stored_by_fork counter
+blob_archiver_blobs_stored_by_fork{fork="fulu"} 4
+blob_archiver_blobs_stored_by_fork{fork="electra"} 0
+blob_archiver_blobs_stored_by_fork{fork="unknown"} 4
+`
+	require.NoError(t, testutil.GatherAndCompare(svc.metrics.Registry(), strings.NewReader(expected), "blob_archiver_blobs_stored_by_fork"))
+
+	// A column returned twice cannot be stored
+	beaconClient.columns[blobtest.Three.String()] = append(columns, columns[1])
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), true)
+	require.ErrorContains(t, err, "beacon node returned data column 126 twice")
+}
+
+func TestArchiver_RejectsDataColumns(t *testing.T) {
+	svc, beaconClient, fs := newDataColumnsArchiver(t, 2)
+	useDataColumns(svc)
+	columns := beaconClient.columns[blobtest.Three.String()]
+
+	// Returns a copy of the column at index, which can be changed without changing the others
+	column := func(index int) *storage.DataColumnSidecar {
+		c := *columns[index]
+		c.Column = slices.Clone(c.Column)
+		return &c
+	}
+	otherHeader := *columns[0].SignedBlockHeader.Message
+	otherHeader.ProposerIndex++
+
+	tests := []struct {
+		name    string
+		columns func() []*storage.DataColumnSidecar
+		err     error
+		message string
+	}{
+		{
+			name:    "too few columns",
+			columns: func() []*storage.DataColumnSidecar { return columns[:minDataColumns-1] },
+			message: "beacon node returned 63 data columns, at least 64 are needed to recover the blobs",
+		},
+		{
+			name: "cell",
+			columns: func() []*storage.DataColumnSidecar {
+				tampered := column(70)
+				tampered.Column[1][31] ^= 1
+				return append(slices.Clone(columns[:70]), tampered)
+			},
+			err:     blobproof.ErrInvalidCellProof,
+			message: "column 70, blob 1",
+		},
+		{
+			name: "inclusion proof",
+			columns: func() []*storage.DataColumnSidecar {
+				tampered := column(70)
+				tampered.KZGCommitmentsInclusionProof[0][0]++
+				return append(slices.Clone(columns[:70]), tampered)
+			},
+			err: blobproof.ErrInvalidInclusionProof,
+		},
+		{
+			name: "header",
+			columns: func() []*storage.DataColumnSidecar {
+				tampered := column(70)
+				tampered.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: &otherHeader}
+				return append(slices.Clone(columns[:70]), tampered)
+			},
+			message: "data column 70 has a different block header",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			beaconClient.columns[blobtest.Three.String()] = test.columns()
+			_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), true)
+			require.Error(t, err)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+			}
+			require.ErrorContains(t, err, test.message)
+			fs.CheckNotExistsOrFail(t, blobtest.Three)
+		})
+	}
+
+	// A block without blobs has no columns
+	beaconClient.columns[blobtest.Three.String()] = nil
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), true)
+	require.NoError(t, err)
+	require.True(t, fs.ReadOrFail(t, blobtest.Three).Empty())
+}
+
+func TestArchiveHandler_DataColumns(t *testing.T) {
+	svc, _, fs := newDataColumnsArchiver(t, 3)
+	useDataColumns(svc)
+	svc.cfg.AdminToken = "secret"
+	svc.cfg.AdminRateLimit = 1000
+	a := NewAPI(svc.metrics, svc.log, svc)
+
+	// The blobs of a block stored as data columns are counted from its columns
+	status, result := archiveRequest(a, blobtest.Three.String(), "secret")
+	require.Equal(t, 200, status)
+	require.Equal(t, ArchiveStatusStored, result.Status)
+	require.Equal(t, 3, result.Blobs)
+	require.Empty(t, fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data)
+
+	status, result = archiveRequest(a, blobtest.Three.String(), "secret")
+	require.Equal(t, 200, status)
+	require.Equal(t, ArchiveStatusAlreadyPresent, result.Status)
+	require.Equal(t, 3, result.Blobs)
+}
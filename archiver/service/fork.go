@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
+)
+
+// forkEpoch is the first epoch of a fork.
+type forkEpoch struct {
+	name  string
+	epoch phase0.Epoch
+	// maxBlobs is the MAX_BLOBS_PER_BLOCK of the fork, 0 if the spec does not give it
+	maxBlobs uint64
+	// dataColumns is set for the forks from fulu on, whose blobs are served as data column sidecars
+	dataColumns bool
+}
+
+// forkSchedule maps a slot to the fork that it is in, from the fork epochs in the beacon node's spec.
+type forkSchedule struct {
+	slotsPerEpoch uint64
+	// forks are the known forks that the spec has an epoch for, in the order they activate
+	forks []forkEpoch
+}
+
+// newForkSchedule fetches the epochs of the known forks from the beacon node. Forks that the spec has no epoch for are
+// left out. An error is returned if the beacon client does not support the spec endpoint.
+func newForkSchedule(ctx context.Context, beaconClient BeaconClient) (forkSchedule, error) {
+	specProvider, ok := beaconClient.(client.SpecProvider)
+	if !ok {
+		return forkSchedule{}, fmt.Errorf("beacon client does not provide spec")
+	}
+
+	spec, err := specProvider.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return forkSchedule{}, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	slotsPerEpoch, ok := spec.Data["SLOTS_PER_EPOCH"].(uint64)
+	if !ok || slotsPerEpoch == 0 {
+		return forkSchedule{}, fmt.Errorf("invalid SLOTS_PER_EPOCH in spec")
+	}
+
+	schedule := forkSchedule{slotsPerEpoch: slotsPerEpoch}
+	// Deneb introduced MAX_BLOBS_PER_BLOCK, later forks that change it have a key suffixed with their name, e.g.
+	// MAX_BLOBS_PER_BLOCK_ELECTRA, and those that do not keep the maximum of the fork before them
+	maxBlobs, _ := spec.Data["MAX_BLOBS_PER_BLOCK"].(uint64)
+	dataColumns := false
+	for _, fork := range metrics.KnownForks {
+		if max, ok := spec.Data["MAX_BLOBS_PER_BLOCK_"+strings.ToUpper(fork)].(uint64); ok {
+			maxBlobs = max
+		}
+		dataColumns = dataColumns || fork == dataColumnsFork
+		if epoch, ok := spec.Data[strings.ToUpper(fork)+"_FORK_EPOCH"].(uint64); ok {
+			schedule.forks = append(schedule.forks, forkEpoch{name: fork, epoch: phase0.Epoch(epoch), maxBlobs: maxBlobs, dataColumns: dataColumns})
+		}
+	}
+
+	return schedule, nil
+}
+
+// forkAt returns the fork that slot is in, or "" if it is before every known fork.
+func (s forkSchedule) forkAt(slot phase0.Slot) string {
+	return s.scheduledAt(slot).name
+}
+
+// scheduledAt returns the fork that slot is in, or the zero forkEpoch if it is before every known fork.
+func (s forkSchedule) scheduledAt(slot phase0.Slot) forkEpoch {
+	epoch := phase0.Epoch(uint64(slot) / s.slotsPerEpoch)
+	var result forkEpoch
+	for _, fork := range s.forks {
+		if epoch >= fork.epoch {
+			result = fork
+		}
+	}
+	return result
+}
+
+// fetchBlobSidecars fetches the blob sidecars of the block with the given root, decoded with the schema of the fork of
+// its slot rather than the one schema of the beacon client. The beacon client decodes SSZ responses with the list
+// limit of deneb (see beacon.SSZMaxBlobSidecars), so the blobs of a block whose fork allows more are fetched in JSON
+// if the client supports it. This lets a backfill that crosses a fork that raises the maximum fetch every block. The
+// response is checked against the maximum of the fork, as a sidecar with an index beyond it cannot be from the block.
+func (a *Archiver) fetchBlobSidecars(ctx context.Context, root phase0.Root, slot phase0.Slot) (*api.Response[[]*deneb.BlobSidecar], error) {
+	var fork forkEpoch
+	if schedule := a.forks.Load(); schedule != nil {
+		fork = schedule.scheduledAt(slot)
+	}
+
+	if err := a.backoff.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	opts := &api.BlobSidecarsOpts{Block: root.String()}
+	var response *api.Response[[]*deneb.BlobSidecar]
+	var err error
+	if jsonClient, ok := a.beaconClient.(beacon.JSONBlobSidecarsProvider); ok && fork.maxBlobs > beacon.SSZMaxBlobSidecars {
+		response, err = jsonClient.JSONBlobSidecars(ctx, opts)
+	} else {
+		response, err = a.beaconClient.BlobSidecars(ctx, opts)
+	}
+	a.backoff.observe(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if fork.maxBlobs == 0 {
+		return response, nil
+	}
+	for _, sidecar := range response.Data {
+		if uint64(sidecar.Index) >= fork.maxBlobs {
+			return nil, fmt.Errorf("blob sidecar index %d of slot %d is not below the %s maximum of %d blobs per block", sidecar.Index, slot, fork.name, fork.maxBlobs)
+		}
+	}
+	return response, nil
+}
+
+// blobsFork returns the fork of the blob sidecars in a response. The fork reported in the version field of a JSON
+// response is used if it is present. The beacon client does not expose the Eth-Consensus-Version header of SSZ
+// responses, so otherwise the fork is derived from the slot with the fork schedule, if the schedule is known.
+func (a *Archiver) blobsFork(response *api.Response[[]*deneb.BlobSidecar], slot phase0.Slot) string {
+	return a.responseFork(response.Metadata, slot)
+}
+
+// responseFork returns the fork reported in the metadata of a response, or else the fork of the slot, see blobsFork.
+func (a *Archiver) responseFork(metadata map[string]any, slot phase0.Slot) string {
+	if version, ok := metadata["version"].(string); ok && version != "" {
+		return version
+	}
+
+	if schedule := a.forks.Load(); schedule != nil {
+		return schedule.forkAt(slot)
+	}
+
+	return ""
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// specBeaconClient is a stub beacon client that also provides the spec.
+type specBeaconClient struct {
+	*beacontest.StubBeaconClient
+	spec map[string]any
+}
+
+func (c *specBeaconClient) Spec(context.Context, *api.SpecOpts) (*api.Response[map[string]any], error) {
+	return &api.Response[map[string]any]{Data: c.spec}, nil
+}
+
+func TestForkSchedule(t *testing.T) {
+	beacon := &specBeaconClient{
+		StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t),
+		spec:             map[string]any{"SLOTS_PER_EPOCH": uint64(32), "DENEB_FORK_EPOCH": uint64(10), "ELECTRA_FORK_EPOCH": uint64(20)},
+	}
+	schedule, err := newForkSchedule(context.Background(), beacon)
+	require.NoError(t, err)
+
+	require.Equal(t, "", schedule.forkAt(319))
+	require.Equal(t, "deneb", schedule.forkAt(320))
+	require.Equal(t, "deneb", schedule.forkAt(639))
+	require.Equal(t, "electra", schedule.forkAt(640))
+	// The spec does not give the maximum blobs per block
+	require.Zero(t, schedule.scheduledAt(640).maxBlobs)
+
+	beacon.spec = map[string]any{"SLOTS_PER_EPOCH": uint64(32), "DENEB_FORK_EPOCH": uint64(10), "ELECTRA_FORK_EPOCH": uint64(20), "MAX_BLOBS_PER_BLOCK": uint64(6), "MAX_BLOBS_PER_BLOCK_ELECTRA": uint64(9)}
+	schedule, err = newForkSchedule(context.Background(), beacon)
+	require.NoError(t, err)
+	require.Equal(t, forkEpoch{}, schedule.scheduledAt(319))
+	require.Equal(t, forkEpoch{name: "deneb", epoch: 10, maxBlobs: 6}, schedule.scheduledAt(639))
+	require.Equal(t, forkEpoch{name: "electra", epoch: 20, maxBlobs: 9}, schedule.scheduledAt(640))
+
+	// A fork that does not change the maximum keeps the maximum of the fork before it
+	beacon.spec = map[string]any{"SLOTS_PER_EPOCH": uint64(32), "DENEB_FORK_EPOCH": uint64(10), "ELECTRA_FORK_EPOCH": uint64(20), "MAX_BLOBS_PER_BLOCK": uint64(6)}
+	schedule, err = newForkSchedule(context.Background(), beacon)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), schedule.scheduledAt(640).maxBlobs)
+
+	// A fork that is not scheduled is left out
+	beacon.spec = map[string]any{"SLOTS_PER_EPOCH": uint64(32), "DENEB_FORK_EPOCH": uint64(10)}
+	schedule, err = newForkSchedule(context.Background(), beacon)
+	require.NoError(t, err)
+	require.Equal(t, "deneb", schedule.forkAt(1_000_000))
+
+	beacon.spec = map[string]any{}
+	_, err = newForkSchedule(context.Background(), beacon)
+	require.ErrorContains(t, err, "SLOTS_PER_EPOCH")
+
+	_, err = newForkSchedule(context.Background(), beacontest.NewDefaultStubBeaconClient(t))
+	require.ErrorContains(t, err, "does not provide spec")
+}
+
+func TestArchiver_BlobsFork(t *testing.T) {
+	svc, _ := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+	response := &api.Response[[]*deneb.BlobSidecar]{}
+
+	// Without a schedule or a reported version the fork is unknown
+	require.Equal(t, "", svc.blobsFork(response, 100))
+
+	svc.forks.Store(&forkSchedule{slotsPerEpoch: 1, forks: []forkEpoch{{name: "deneb", epoch: 0}, {name: "electra", epoch: 50}}})
+	require.Equal(t, "deneb", svc.blobsFork(response, 49))
+	require.Equal(t, "electra", svc.blobsFork(response, 50))
+
+	// The fork reported by the beacon node takes precedence
+	response.Metadata = map[string]any{"version": "deneb"}
+	require.Equal(t, "deneb", svc.blobsFork(response, 50))
+}
+
+func TestArchiver_StoredBlobsByFork(t *testing.T) {
+	svc, _ := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+	svc.forks.Store(&forkSchedule{slotsPerEpoch: 1, forks: []forkEpoch{{name: "deneb", epoch: 0}, {name: "electra", epoch: 14}}})
+
+	for _, block := range []string{blobtest.Three.String(), blobtest.Four.String(), blobtest.Five.String()} {
+		_, _, err := svc.persistBlobsForBlockToS3(context.Background(), block, false)
+		require.NoError(t, err)
+	}
+
+	// Blocks before every known fork are counted as unknown
+	svc.forks.Store(&forkSchedule{slotsPerEpoch: 1, forks: []forkEpoch{{name: "electra", epoch: 20}}})
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), true)
+	require.NoError(t, err)
+
+	expected := `
+# HELP blob_archiver_blobs_stored_by_fork number of blobs stored, by the fork of their block
+# TYPE blob_archiver_blobs_stored_by_fork counter
+blob_archiver_blobs_stored_by_fork{fork="deneb"} 4
+blob_archiver_blobs_stored_by_fork{fork="electra"} 11
+blob_archiver_blobs_stored_by_fork{fork="unknown"} 4
+`
+	require.NoError(t, testutil.GatherAndCompare(svc.metrics.Registry(), strings.NewReader(expected), "blob_archiver_blobs_stored_by_fork"))
+}
+
+// schemaBeaconClient is a stub beacon client whose SSZ responses, like those of go-eth2-client, fail to decode with
+// more sidecars than beacon.SSZMaxBlobSidecars, and that records the blocks fetched in JSON.
+type schemaBeaconClient struct {
+	*beacontest.StubBeaconClient
+	json []string
+}
+
+func (c *schemaBeaconClient) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	if len(c.Blobs[opts.Block]) > beacon.SSZMaxBlobSidecars {
+		return nil, fmt.Errorf("failed to decode blob sidecars")
+	}
+	return c.StubBeaconClient.BlobSidecars(ctx, opts)
+}
+
+func (c *schemaBeaconClient) JSONBlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	c.json = append(c.json, opts.Block)
+	return c.StubBeaconClient.BlobSidecars(ctx, opts)
+}
+
+func TestArchiver_BackfillAcrossForkBoundary(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	// Four is after the fork, and has more blobs than a deneb block can have
+	stub.Blobs[blobtest.Four.String()] = blobtest.NewBlobSidecars(t, 8)
+	beaconClient := &schemaBeaconClient{StubBeaconClient: stub}
+
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{PollInterval: 5 * time.Second, OriginBlock: blobtest.OriginBlock}, fs, beaconClient, metrics.NewMetrics())
+	require.NoError(t, err)
+	// Three is the first block of electra
+	svc.forks.Store(&forkSchedule{slotsPerEpoch: 1, forks: []forkEpoch{{name: "deneb", epoch: 0, maxBlobs: 6}, {name: "electra", epoch: phase0.Epoch(blobtest.StartSlot + 3), maxBlobs: 9}}})
+
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Five},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(stub.Blobs[blobtest.Five.String()])},
+	})
+	svc.backfillBlobs(context.Background(), stub.Headers[blobtest.Five.String()])
+
+	for _, block := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		require.Equal(t, storage.FromDenebSidecars(stub.Blobs[block.String()]), fs.ReadOrFail(t, block).BlobSidecars.Data)
+	}
+	// Only the electra blocks are fetched in JSON
+	require.Equal(t, []string{blobtest.Four.String(), blobtest.Three.String()}, beaconClient.json)
+
+	// A sidecar with an index beyond the maximum of the fork cannot be from the block
+	stub.Blobs[blobtest.Four.String()] = blobtest.NewBlobSidecars(t, 10)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), true)
+	require.ErrorContains(t, err, "blob sidecar index 9 of slot 14 is not below the electra maximum of 9 blobs per block")
+}
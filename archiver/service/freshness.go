@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+)
+
+// freshnessSamples is the number of recent live slots that the worst-case archival latency is taken over.
+const freshnessSamples = 64
+
+// slotClock converts a slot to the wall-clock time that it starts at.
+type slotClock struct {
+	genesis      time.Time
+	slotDuration time.Duration
+}
+
+func (c slotClock) slotStart(slot phase0.Slot) time.Time {
+	return c.genesis.Add(time.Duration(slot) * c.slotDuration)
+}
+
+// newSlotClock fetches the genesis time and slot duration from the beacon node. An error is returned if the beacon
+// client does not support the genesis and spec endpoints.
+func newSlotClock(ctx context.Context, beaconClient BeaconClient) (slotClock, error) {
+	genesisProvider, ok := beaconClient.(client.GenesisProvider)
+	if !ok {
+		return slotClock{}, fmt.Errorf("beacon client does not provide genesis")
+	}
+	specProvider, ok := beaconClient.(client.SpecProvider)
+	if !ok {
+		return slotClock{}, fmt.Errorf("beacon client does not provide spec")
+	}
+
+	genesis, err := genesisProvider.Genesis(ctx, &api.GenesisOpts{})
+	if err != nil {
+		return slotClock{}, fmt.Errorf("failed to fetch genesis: %w", err)
+	}
+
+	spec, err := specProvider.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return slotClock{}, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	slotDuration, ok := spec.Data["SECONDS_PER_SLOT"].(time.Duration)
+	if !ok || slotDuration <= 0 {
+		return slotClock{}, fmt.Errorf("invalid SECONDS_PER_SLOT in spec")
+	}
+
+	return slotClock{genesis: genesis.Data.GenesisTime, slotDuration: slotDuration}, nil
+}
+
+// FreshnessStatus reports the archival latency, the time between the start of a slot and its blobs being stored,
+// of recently followed slots.
+type FreshnessStatus struct {
+	// Enabled is false if the genesis timing could not be determined, in which case latency is not tracked
+	Enabled bool `json:"enabled"`
+	// Samples is the number of recent live slots the worst case is taken over
+	Samples int `json:"samples"`
+	// LatestSlot is the most recent live slot that was stored
+	LatestSlot uint64 `json:"latestSlot"`
+	// LatestLatencyMs is the archival latency of LatestSlot
+	LatestLatencyMs int64 `json:"latestLatencyMs"`
+	// WorstSlot is the slot with the highest archival latency of the recent live slots
+	WorstSlot uint64 `json:"worstSlot"`
+	// WorstLatencyMs is the archival latency of WorstSlot
+	WorstLatencyMs int64 `json:"worstLatencyMs"`
+}
+
+type freshnessSample struct {
+	slot    phase0.Slot
+	latency time.Duration
+}
+
+// freshnessTracker records the archival latency of each stored slot. Live slots are the archiver's freshness SLI, and
+// the most recent of them are kept for the status endpoint. Backfilled slots are recorded under their own source, as
+// their latency reflects how far behind the backfill is rather than how quickly new blocks are archived.
+type freshnessTracker struct {
+	mu      sync.Mutex
+	clock   *slotClock
+	now     func() time.Time
+	metrics metrics.Metricer
+	samples []freshnessSample
+	next    int
+}
+
+func newFreshnessTracker(m metrics.Metricer) *freshnessTracker {
+	return &freshnessTracker{
+		now:     time.Now,
+		metrics: m,
+	}
+}
+
+// setClock enables tracking, until it is called nothing is recorded.
+func (f *freshnessTracker) setClock(clock slotClock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clock = &clock
+}
+
+// record records that the blobs for slot have been stored.
+func (f *freshnessTracker) record(source metrics.BlockSource, slot phase0.Slot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.clock == nil {
+		return
+	}
+
+	latency := f.now().Sub(f.clock.slotStart(slot))
+	f.metrics.RecordArchivalLatency(source, latency)
+
+	if source != metrics.BlockSourceLive {
+		return
+	}
+
+	sample := freshnessSample{slot: slot, latency: latency}
+	if len(f.samples) < freshnessSamples {
+		f.samples = append(f.samples, sample)
+	} else {
+		f.samples[f.next] = sample
+	}
+	f.next = (f.next + 1) % freshnessSamples
+}
+
+// status returns the latest and worst-case archival latency of the recent live slots.
+func (f *freshnessTracker) status() FreshnessStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := FreshnessStatus{
+		Enabled: f.clock != nil,
+		Samples: len(f.samples),
+	}
+
+	if len(f.samples) == 0 {
+		return result
+	}
+
+	latest := f.samples[(f.next+len(f.samples)-1)%len(f.samples)]
+	result.LatestSlot = uint64(latest.slot)
+	result.LatestLatencyMs = latest.latency.Milliseconds()
+
+	worst := f.samples[0]
+	for _, sample := range f.samples[1:] {
+		if sample.latency > worst.latency {
+			worst = sample
+		}
+	}
+	result.WorstSlot = uint64(worst.slot)
+	result.WorstLatencyMs = worst.latency.Milliseconds()
+
+	return result
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var testGenesis = time.Unix(1_700_000_000, 0)
+
+// timedBeaconClient is a stub beacon client that also provides the genesis time and spec.
+type timedBeaconClient struct {
+	*beacontest.StubBeaconClient
+}
+
+func (c *timedBeaconClient) Genesis(context.Context, *api.GenesisOpts) (*api.Response[*v1.Genesis], error) {
+	return &api.Response[*v1.Genesis]{Data: &v1.Genesis{GenesisTime: testGenesis}}, nil
+}
+
+func (c *timedBeaconClient) Spec(context.Context, *api.SpecOpts) (*api.Response[map[string]any], error) {
+	return &api.Response[map[string]any]{Data: map[string]any{"SECONDS_PER_SLOT": 12 * time.Second}}, nil
+}
+
+func TestSlotClock(t *testing.T) {
+	clock, err := newSlotClock(context.Background(), &timedBeaconClient{beacontest.NewDefaultStubBeaconClient(t)})
+	require.NoError(t, err)
+	require.Equal(t, testGenesis, clock.slotStart(0))
+	require.Equal(t, testGenesis.Add(120*time.Second), clock.slotStart(10))
+
+	_, err = newSlotClock(context.Background(), beacontest.NewDefaultStubBeaconClient(t))
+	require.Error(t, err)
+}
+
+func TestFreshnessTracker(t *testing.T) {
+	m := metrics.NewMetrics()
+	f := newFreshnessTracker(m)
+
+	// Nothing is recorded until the slot timing is known
+	f.record(metrics.BlockSourceLive, 10)
+	require.Equal(t, FreshnessStatus{}, f.status())
+
+	clock := slotClock{genesis: testGenesis, slotDuration: 12 * time.Second}
+	f.setClock(clock)
+
+	now := clock.slotStart(10).Add(3 * time.Second)
+	f.now = func() time.Time { return now }
+	f.record(metrics.BlockSourceLive, 10)
+
+	now = clock.slotStart(11).Add(9 * time.Second)
+	f.record(metrics.BlockSourceLive, 11)
+
+	now = clock.slotStart(12).Add(2 * time.Second)
+	f.record(metrics.BlockSourceLive, 12)
+
+	// A backfilled slot is far older, but does not change the live freshness
+	f.record(metrics.BlockSourceBackfill, 1)
+
+	require.Equal(t, FreshnessStatus{
+		Enabled:         true,
+		Samples:         3,
+		LatestSlot:      12,
+		LatestLatencyMs: 2000,
+		WorstSlot:       11,
+		WorstLatencyMs:  9000,
+	}, f.status())
+
+	count, err := testutil.GatherAndCount(m.Registry(), "blob_archiver_archival_latency_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 2, count, "live and backfill are recorded as separate series")
+}
+
+func TestFreshnessTracker_RecentSamplesOnly(t *testing.T) {
+	f := newFreshnessTracker(metrics.NewMetrics())
+	clock := slotClock{genesis: testGenesis, slotDuration: 12 * time.Second}
+	f.setClock(clock)
+
+	// The slow slot is pushed out of the recent samples by the faster slots that follow it
+	var now time.Time
+	f.now = func() time.Time { return now }
+	now = clock.slotStart(1).Add(time.Minute)
+	f.record(metrics.BlockSourceLive, 1)
+
+	for slot := 2; slot < 2+freshnessSamples; slot++ {
+		now = clock.slotStart(phase0.Slot(slot)).Add(time.Second)
+		f.record(metrics.BlockSourceLive, phase0.Slot(slot))
+	}
+
+	status := f.status()
+	require.Equal(t, freshnessSamples, status.Samples)
+	require.Equal(t, int64(1000), status.WorstLatencyMs)
+	require.Equal(t, uint64(1+freshnessSamples), status.LatestSlot)
+}
+
+func TestStatusHandler(t *testing.T) {
+	a, _ := setupAPI(t)
+	clock := slotClock{genesis: testGenesis, slotDuration: 12 * time.Second}
+	a.archiver.freshness.setClock(clock)
+	a.archiver.freshness.now = func() time.Time { return clock.slotStart(phase0.Slot(blobtest.EndSlot)).Add(4 * time.Second) }
+	a.archiver.freshness.record(metrics.BlockSourceLive, phase0.Slot(blobtest.EndSlot))
+
+	request := httptest.NewRequest("GET", "/status", nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, 200, response.Code)
+
+	var status StatusResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &status))
+	require.True(t, status.Freshness.Enabled)
+	require.Equal(t, int64(4000), status.Freshness.WorstLatencyMs)
+}
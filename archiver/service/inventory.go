@@ -0,0 +1,304 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// inventoryFlushInterval is how often the blocks recorded in the inventory are written to storage.
+	inventoryFlushInterval = 30 * time.Second
+	// maxInventorySlots is the largest range of slots that can be listed by a single request to /admin/inventory or
+	// /admin/gaps.
+	maxInventorySlots = 32 * storage.InventoryChunkSlots
+)
+
+// InventoryBlock is an archived block listed by /admin/inventory.
+type InventoryBlock struct {
+	Slot       uint64      `json:"slot"`
+	Root       common.Hash `json:"root"`
+	ParentRoot common.Hash `json:"parentRoot"`
+}
+
+// InventoryResponse is returned by /admin/inventory.
+type InventoryResponse struct {
+	Error     string           `json:"error,omitempty"`
+	StartSlot uint64           `json:"startSlot"`
+	EndSlot   uint64           `json:"endSlot"`
+	Blocks    []InventoryBlock `json:"blocks"`
+}
+
+// SlotGap is a range of slots without an archived block that are not known to be empty.
+type SlotGap struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// GapsResponse is returned by /admin/gaps.
+type GapsResponse struct {
+	Error     string    `json:"error,omitempty"`
+	StartSlot uint64    `json:"startSlot"`
+	EndSlot   uint64    `json:"endSlot"`
+	Gaps      []SlotGap `json:"gaps"`
+	// Missing is the number of slots in the gaps
+	Missing uint64 `json:"missing"`
+}
+
+// inventoryUpdate is a change to the entry of a slot that has not been written to storage yet.
+type inventoryUpdate struct {
+	entry storage.InventoryEntry
+	// orphaned removes the entry if it is still of the same block, as the block was reorged out
+	orphaned bool
+}
+
+// inventory maintains the manifest of the blocks archived in storage, see storage.Inventory. Blocks are recorded in
+// memory as they are stored, and every inventoryFlushInterval the chunks they belong to are read, updated and written
+// back, so that a chunk is written once per interval rather than once per block.
+type inventory struct {
+	store storage.Inventory
+	log   log.Logger
+
+	mu sync.Mutex
+	// updates are the changes that have not been written to storage, by slot
+	updates map[uint64]inventoryUpdate
+	// newest is the newest slot recorded since the archiver started
+	newest uint64
+
+	// flushMu is held while the updates are written, so that a read in the meantime does not miss them
+	flushMu sync.Mutex
+}
+
+// newInventory returns nil if the inventory is not enabled.
+func newInventory(enabled bool, dataStore storage.DataStore, l log.Logger) *inventory {
+	if !enabled {
+		return nil
+	}
+	return &inventory{store: dataStore, log: l, updates: make(map[uint64]inventoryUpdate)}
+}
+
+// record adds the block to the inventory.
+func (i *inventory) record(header *v1.BeaconBlockHeader) {
+	slot := uint64(header.Header.Message.Slot)
+	entry := storage.InventoryEntry{Root: common.Hash(header.Root), ParentRoot: common.Hash(header.Header.Message.ParentRoot)}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.updates[slot] = inventoryUpdate{entry: entry}
+	i.newest = max(i.newest, slot)
+}
+
+// orphan removes the block from the inventory, unless the block that replaced it at the same slot has been recorded.
+func (i *inventory) orphan(block trackedBlock) {
+	i.remove(block.root, uint64(block.slot))
+}
+
+// remove removes the block at slot from the inventory, e.g. once it has been deleted from storage, unless another block
+// has been recorded at the slot.
+func (i *inventory) remove(root common.Hash, slot uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if update, ok := i.updates[slot]; ok && update.entry.Root != root {
+		return
+	}
+	i.updates[slot] = inventoryUpdate{entry: storage.InventoryEntry{Root: root}, orphaned: true}
+}
+
+// newestSlot returns the newest slot recorded since the archiver started, and false if none has been.
+func (i *inventory) newestSlot() (uint64, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.newest, i.newest > 0
+}
+
+// run writes the recorded blocks to storage every interval, and once more when the context is done.
+func (i *inventory) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := i.flush(ctx); err != nil {
+				i.log.Error("failed to write inventory, will retry", "err", err)
+			}
+		case <-ctx.Done():
+			// The last blocks are written with a fresh context, so that they are kept when the archiver is stopped
+			if err := i.flush(context.Background()); err != nil {
+				i.log.Error("failed to write inventory", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// flush writes the recorded changes to the chunks they belong to. The changes to a chunk that cannot be written are
+// kept to be written by the next flush.
+func (i *inventory) flush(ctx context.Context) error {
+	i.flushMu.Lock()
+	defer i.flushMu.Unlock()
+
+	i.mu.Lock()
+	updates := i.updates
+	i.updates = make(map[uint64]inventoryUpdate)
+	i.mu.Unlock()
+
+	chunks := make(map[uint64]map[uint64]inventoryUpdate)
+	for slot, update := range updates {
+		start := storage.InventoryChunkStart(slot)
+		if chunks[start] == nil {
+			chunks[start] = make(map[uint64]inventoryUpdate)
+		}
+		chunks[start][slot] = update
+	}
+
+	var result error
+	for start, chunkUpdates := range chunks {
+		err := i.writeChunk(ctx, start, chunkUpdates)
+		if err == nil {
+			continue
+		}
+
+		result = errors.Join(result, err)
+		i.mu.Lock()
+		for slot, update := range chunkUpdates {
+			// A change recorded since supersedes the one that failed to be written
+			if _, ok := i.updates[slot]; !ok {
+				i.updates[slot] = update
+			}
+		}
+		i.mu.Unlock()
+	}
+
+	return result
+}
+
+func (i *inventory) writeChunk(ctx context.Context, start uint64, updates map[uint64]inventoryUpdate) error {
+	chunk, err := i.readChunk(ctx, start)
+	if err != nil {
+		return err
+	}
+	applyInventoryUpdates(chunk, updates)
+	return i.store.WriteInventoryChunk(ctx, chunk)
+}
+
+// readChunk reads the chunk starting at start from storage, which is empty if no block in it has been written.
+func (i *inventory) readChunk(ctx context.Context, start uint64) (storage.InventoryChunk, error) {
+	chunk, err := i.store.ReadInventoryChunk(ctx, start)
+	if errors.Is(err, storage.ErrNotFound) {
+		chunk, err = storage.InventoryChunk{StartSlot: start}, nil
+	}
+	if chunk.Blocks == nil {
+		chunk.Blocks = make(map[uint64]storage.InventoryEntry)
+	}
+	return chunk, err
+}
+
+func applyInventoryUpdates(chunk storage.InventoryChunk, updates map[uint64]inventoryUpdate) {
+	for slot, update := range updates {
+		if !update.orphaned {
+			chunk.Blocks[slot] = update.entry
+		} else if chunk.Blocks[slot].Root == update.entry.Root {
+			delete(chunk.Blocks, slot)
+		}
+	}
+}
+
+// blocks returns the blocks in the slot range [start, end] that are in the inventory, including those recorded but not
+// yet written to storage, in slot order.
+func (i *inventory) blocks(ctx context.Context, start, end uint64) ([]InventoryBlock, error) {
+	i.flushMu.Lock()
+	defer i.flushMu.Unlock()
+
+	i.mu.Lock()
+	updates := make(map[uint64]map[uint64]inventoryUpdate)
+	for slot, update := range i.updates {
+		if slot >= start && slot <= end {
+			chunkStart := storage.InventoryChunkStart(slot)
+			if updates[chunkStart] == nil {
+				updates[chunkStart] = make(map[uint64]inventoryUpdate)
+			}
+			updates[chunkStart][slot] = update
+		}
+	}
+	i.mu.Unlock()
+
+	result := make([]InventoryBlock, 0)
+	for chunkStart := storage.InventoryChunkStart(start); chunkStart <= end; chunkStart += storage.InventoryChunkSlots {
+		chunk, err := i.readChunk(ctx, chunkStart)
+		if err != nil {
+			return nil, err
+		}
+		applyInventoryUpdates(chunk, updates[chunkStart])
+
+		for slot, entry := range chunk.Blocks {
+			if slot >= start && slot <= end {
+				result = append(result, InventoryBlock{Slot: slot, Root: entry.Root, ParentRoot: entry.ParentRoot})
+			}
+		}
+
+		if chunkStart > math.MaxUint64-storage.InventoryChunkSlots {
+			break
+		}
+	}
+
+	slices.SortFunc(result, func(a, b InventoryBlock) int {
+		return cmp.Compare(a.Slot, b.Slot)
+	})
+	return result, nil
+}
+
+// gaps returns the gaps in the inventory in the slot range [start, end]. A slot without a block in the inventory is
+// known to be empty if it lies between two blocks in the inventory, the later being the child of the earlier, as then
+// there was no block in the slots between them. The blocks up to a chunk before and after the range are read for
+// this, so a run of more than InventoryChunkSlots empty slots at either end of the range is reported as a gap.
+func (i *inventory) gaps(ctx context.Context, start, end uint64) ([]SlotGap, error) {
+	from := start - min(start, storage.InventoryChunkSlots)
+	to := end + min(math.MaxUint64-end, storage.InventoryChunkSlots)
+	blocks, err := i.blocks(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return findSlotGaps(blocks, start, end), nil
+}
+
+// findSlotGaps returns the gaps in the slot range [start, end] given the blocks of the inventory around it, in slot
+// order, see inventory.gaps.
+func findSlotGaps(blocks []InventoryBlock, start, end uint64) []SlotGap {
+	gaps := make([]SlotGap, 0)
+	missing := func(from, to uint64) {
+		from, to = max(from, start), min(to, end)
+		if from <= to {
+			gaps = append(gaps, SlotGap{Start: from, End: to})
+		}
+	}
+
+	if len(blocks) == 0 {
+		missing(start, end)
+		return gaps
+	}
+
+	if first := blocks[0].Slot; first > 0 {
+		missing(0, first-1)
+	}
+	for k := 1; k < len(blocks); k++ {
+		previous, next := blocks[k-1], blocks[k]
+		if next.ParentRoot != previous.Root && next.Slot > previous.Slot+1 {
+			missing(previous.Slot+1, next.Slot-1)
+		}
+	}
+	if last := blocks[len(blocks)-1].Slot; last < math.MaxUint64 {
+		missing(last+1, math.MaxUint64)
+	}
+
+	return gaps
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// failingInventory fails to write chunks while fail is set.
+type failingInventory struct {
+	storage.Inventory
+	fail bool
+}
+
+func (f *failingInventory) WriteInventoryChunk(ctx context.Context, chunk storage.InventoryChunk) error {
+	if f.fail {
+		return storage.ErrStorage
+	}
+	return f.Inventory.WriteInventoryChunk(ctx, chunk)
+}
+
+func inventoryHeader(slot uint64, root, parent common.Hash) *v1.BeaconBlockHeader {
+	return &v1.BeaconBlockHeader{
+		Root: phase0.Root(root),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot), ParentRoot: phase0.Root(parent)},
+		},
+	}
+}
+
+func TestFindSlotGaps(t *testing.T) {
+	blocks := []InventoryBlock{
+		{Slot: 10, Root: common.Hash{10}, ParentRoot: common.Hash{9}},
+		{Slot: 11, Root: common.Hash{11}, ParentRoot: common.Hash{10}},
+		// Slots 12 and 13 were empty
+		{Slot: 14, Root: common.Hash{14}, ParentRoot: common.Hash{11}},
+		// Slots 15 to 17 are missing, the parent of 18 is not 14
+		{Slot: 18, Root: common.Hash{18}, ParentRoot: common.Hash{17}},
+	}
+
+	tests := []struct {
+		name       string
+		blocks     []InventoryBlock
+		start, end uint64
+		gaps       []SlotGap
+	}{
+		{name: "complete", blocks: blocks, start: 10, end: 14, gaps: []SlotGap{}},
+		{name: "missing", blocks: blocks, start: 10, end: 18, gaps: []SlotGap{{Start: 15, End: 17}}},
+		{name: "ends", blocks: blocks, start: 5, end: 20, gaps: []SlotGap{{Start: 5, End: 9}, {Start: 15, End: 17}, {Start: 19, End: 20}}},
+		{name: "within gap", blocks: blocks, start: 16, end: 16, gaps: []SlotGap{{Start: 16, End: 16}}},
+		{name: "empty", start: 3, end: 7, gaps: []SlotGap{{Start: 3, End: 7}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.gaps, findSlotGaps(test.blocks, test.start, test.end))
+		})
+	}
+}
+
+func TestInventory_Flush(t *testing.T) {
+	fs := storagetest.NewTestFileStorage(t, testlog.Logger(t, log.LvlInfo))
+	store := &failingInventory{Inventory: fs}
+	i := newInventory(true, fs, testlog.Logger(t, log.LvlInfo))
+	i.store = store
+
+	i.record(inventoryHeader(1000, common.Hash{1}, common.Hash{}))
+	i.record(inventoryHeader(1030, common.Hash{2}, common.Hash{1}))
+	newest, ok := i.newestSlot()
+	require.True(t, ok)
+	require.Equal(t, uint64(1030), newest)
+
+	// Blocks that have not been written are still listed
+	blocks, err := i.blocks(context.Background(), 1000, 1030)
+	require.NoError(t, err)
+	require.Equal(t, []InventoryBlock{
+		{Slot: 1000, Root: common.Hash{1}},
+		{Slot: 1030, Root: common.Hash{2}, ParentRoot: common.Hash{1}},
+	}, blocks)
+
+	// The blocks are kept until they can be written
+	store.fail = true
+	require.ErrorIs(t, i.flush(context.Background()), storage.ErrStorage)
+	_, err = fs.ReadInventoryChunk(context.Background(), 0)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	store.fail = false
+	require.NoError(t, i.flush(context.Background()))
+	first, err := fs.ReadInventoryChunk(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]storage.InventoryEntry{1000: {Root: common.Hash{1}}}, first.Blocks)
+	second, err := fs.ReadInventoryChunk(context.Background(), 1024)
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]storage.InventoryEntry{1030: {Root: common.Hash{2}, ParentRoot: common.Hash{1}}}, second.Blocks)
+
+	// A reorged out block is removed, unless the slot has been recorded with another block since
+	i.orphan(trackedBlock{root: common.Hash{2}, slot: 1030})
+	i.orphan(trackedBlock{root: common.Hash{1}, slot: 1000})
+	i.record(inventoryHeader(1000, common.Hash{3}, common.Hash{}))
+	i.orphan(trackedBlock{root: common.Hash{1}, slot: 1000})
+	require.NoError(t, i.flush(context.Background()))
+
+	blocks, err = i.blocks(context.Background(), 0, 2047)
+	require.NoError(t, err)
+	require.Equal(t, []InventoryBlock{{Slot: 1000, Root: common.Hash{3}}}, blocks)
+}
+
+func TestInventory_Disabled(t *testing.T) {
+	fs := storagetest.NewTestFileStorage(t, testlog.Logger(t, log.LvlInfo))
+	require.Nil(t, newInventory(false, fs, testlog.Logger(t, log.LvlInfo)))
+}
+
+func TestArchiver_Inventory(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// A block stored before the inventory was enabled is recorded once it is walked over
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+	svc.inventory = newInventory(true, fs, svc.log)
+	for _, root := range []common.Hash{blobtest.Two, blobtest.Three} {
+		_, _, err := svc.persistBlobsForBlockToS3(context.Background(), root.String(), false)
+		require.NoError(t, err)
+	}
+
+	blocks, err := svc.inventory.blocks(context.Background(), blobtest.StartSlot, blobtest.EndSlot)
+	require.NoError(t, err)
+	require.Equal(t, []InventoryBlock{
+		{Slot: blobtest.StartSlot + 2, Root: blobtest.Two, ParentRoot: blobtest.One},
+		{Slot: blobtest.StartSlot + 3, Root: blobtest.Three, ParentRoot: blobtest.Two},
+	}, blocks)
+
+	// The inventory is written when the archiver stops
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.inventory.run(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	chunk, err := fs.ReadInventoryChunk(context.Background(), storage.InventoryChunkStart(blobtest.StartSlot))
+	require.NoError(t, err)
+	require.Len(t, chunk.Blocks, 2)
+}
+
+func setupInventoryAPI(t *testing.T) (*API, *Archiver) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	m := metrics.NewMetrics()
+	fs := storagetest.NewTestFileStorage(t, logger)
+	archiver, err := NewArchiver(logger, flags.ArchiverConfig{
+		PollInterval:   10 * time.Second,
+		AdminToken:     "secret",
+		AdminRateLimit: math.Inf(1),
+		Inventory:      true,
+	}, fs, beacontest.NewDefaultStubBeaconClient(t), m)
+	require.NoError(t, err)
+	return NewAPI(m, logger, archiver), archiver
+}
+
+func inventoryRequest(a *API, target string, result any) int {
+	request := httptest.NewRequest("GET", target, nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	_ = json.NewDecoder(response.Body).Decode(result)
+	return response.Code
+}
+
+func TestInventoryHandlers(t *testing.T) {
+	a, archiver := setupInventoryAPI(t)
+
+	// The end of the range defaults to the newest block, which is not known until one has been recorded
+	var gaps GapsResponse
+	require.Equal(t, 400, inventoryRequest(a, "/admin/gaps?start_slot=10", &gaps))
+	require.Contains(t, gaps.Error, "invalid end_slot param")
+
+	for _, root := range []common.Hash{blobtest.Two, blobtest.Three, blobtest.Five} {
+		_, _, err := archiver.persistBlobsForBlockToS3(context.Background(), root.String(), false)
+		require.NoError(t, err)
+	}
+
+	var inventory InventoryResponse
+	require.Equal(t, 200, inventoryRequest(a, "/admin/inventory?start_slot=10&end_slot=13", &inventory))
+	require.Equal(t, InventoryResponse{StartSlot: 10, EndSlot: 13, Blocks: []InventoryBlock{
+		{Slot: blobtest.StartSlot + 2, Root: blobtest.Two, ParentRoot: blobtest.One},
+		{Slot: blobtest.StartSlot + 3, Root: blobtest.Three, ParentRoot: blobtest.Two},
+	}}, inventory)
+
+	gaps = GapsResponse{}
+	require.Equal(t, 200, inventoryRequest(a, "/admin/gaps?start_slot=10", &gaps))
+	require.Equal(t, GapsResponse{
+		StartSlot: blobtest.StartSlot,
+		EndSlot:   blobtest.StartSlot + 5,
+		Gaps:      []SlotGap{{Start: blobtest.StartSlot, End: blobtest.StartSlot + 1}, {Start: blobtest.StartSlot + 4, End: blobtest.StartSlot + 4}},
+		Missing:   3,
+	}, gaps)
+
+	for _, target := range []string{"/admin/inventory", "/admin/inventory?start_slot=20&end_slot=10", "/admin/gaps?start_slot=0&end_slot=1000000"} {
+		inventory = InventoryResponse{}
+		require.Equal(t, 400, inventoryRequest(a, target, &inventory), target)
+		require.NotEmpty(t, inventory.Error, target)
+	}
+
+	// The endpoints are not found without an inventory
+	archiver.inventory = nil
+	inventory = InventoryResponse{}
+	require.Equal(t, 404, inventoryRequest(a, "/admin/inventory?start_slot=10&end_slot=13", &inventory))
+	require.Equal(t, "inventory is disabled", inventory.Error)
+}
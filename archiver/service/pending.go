@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PendingStatus reports the blocks held in memory until they are confirmed.
+type PendingStatus struct {
+	// Blocks is the number of blocks currently held
+	Blocks int `json:"blocks"`
+	// ConfirmedSlot is the highest confirmed slot, blocks after it are held until they are confirmed
+	ConfirmedSlot uint64 `json:"confirmedSlot"`
+	// Orphaned is the number of held blocks that were dropped because they were reorged out
+	Orphaned int `json:"orphaned"`
+}
+
+// pendingBlock is a block whose blobs have been fetched, but not written to storage.
+type pendingBlock struct {
+	header *v1.BeaconBlockHeader
+	data   storage.BlobData
+	// fork is the fork of the blobs from the response they were fetched in, see blobsFork
+	fork string
+}
+
+func (b pendingBlock) slot() phase0.Slot {
+	return b.header.Header.Message.Slot
+}
+
+// pendingTier holds the blobs of recent blocks in memory until they are confirmed, either by being a number of slots
+// behind the head or by being finalized, so that blobs of a block that is reorged out are never written to storage.
+// The held blocks are lost when the archiver stops, as they are not in storage the backfill stores them again on the
+// next start.
+type pendingTier struct {
+	depth    uint64
+	finality bool
+	metrics  metrics.Metricer
+
+	mu     sync.Mutex
+	blocks map[common.Hash]pendingBlock
+	// cutoff is the highest confirmed slot, it is only valid once known is set
+	cutoff   phase0.Slot
+	known    bool
+	orphaned int
+}
+
+// newPendingTier returns nil if blocks are written to storage without waiting for them to be confirmed, i.e. the
+// depth is 0 and finality is not waited for.
+func newPendingTier(depth uint64, finality bool, m metrics.Metricer) *pendingTier {
+	if depth == 0 && !finality {
+		return nil
+	}
+	return &pendingTier{
+		depth:    depth,
+		finality: finality,
+		metrics:  m,
+		blocks:   make(map[common.Hash]pendingBlock),
+	}
+}
+
+// confirmed returns true if a block at slot can be written to storage. Until the first confirmed slot is known, no
+// block is.
+func (p *pendingTier) confirmed(slot phase0.Slot) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.known && slot <= p.cutoff
+}
+
+// has returns true if the block with the given root is held.
+func (p *pendingTier) has(root common.Hash) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.blocks[root]
+	return ok
+}
+
+func (p *pendingTier) add(block pendingBlock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocks[block.data.Header.BeaconBlockHash] = block
+	p.metrics.RecordPendingBlocks(len(p.blocks))
+}
+
+// remove drops the block with the given root, once it has been written to storage.
+func (p *pendingTier) remove(root common.Hash) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.blocks, root)
+	p.metrics.RecordPendingBlocks(len(p.blocks))
+}
+
+// tipID returns the identifier of the block that confirmed blocks are descended from, the head or the finalized block.
+func (p *pendingTier) tipID() string {
+	if p.finality {
+		return "finalized"
+	}
+	return "head"
+}
+
+// confirmedSlot returns the highest confirmed slot when the block that confirmed blocks are descended from is at slot.
+func (p *pendingTier) confirmedSlot(slot phase0.Slot) phase0.Slot {
+	if p.finality {
+		return slot
+	}
+	if uint64(slot) < p.depth {
+		return 0
+	}
+	return slot - phase0.Slot(p.depth)
+}
+
+// unsettled returns the slots of the held blocks at or before cutoff by their root, whose fate settle decides.
+func (p *pendingTier) unsettled(cutoff phase0.Slot) map[common.Hash]phase0.Slot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	blocks := make(map[common.Hash]phase0.Slot)
+	for root, block := range p.blocks {
+		if block.slot() <= cutoff {
+			blocks[root] = block.slot()
+		}
+	}
+	return blocks
+}
+
+// block returns the held block with the given root.
+func (p *pendingTier) block(root common.Hash) (pendingBlock, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	block, ok := p.blocks[root]
+	return block, ok
+}
+
+// settle advances the confirmed slot to cutoff, and returns the blocks of unsettled that are now confirmed, oldest
+// first. These are the blocks that are canonical, and are left held until they are removed once written. The other
+// blocks of unsettled have been reorged out, and are dropped. Blocks held since unsettled was taken are left held.
+func (p *pendingTier) settle(cutoff phase0.Slot, unsettled map[common.Hash]phase0.Slot, canonical map[common.Hash]bool) []pendingBlock {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cutoff, p.known = cutoff, true
+
+	var confirmed []pendingBlock
+	orphaned := 0
+	for root := range unsettled {
+		block, ok := p.blocks[root]
+		if !ok {
+			continue
+		}
+		if canonical[root] {
+			confirmed = append(confirmed, block)
+		} else {
+			delete(p.blocks, root)
+			orphaned++
+		}
+	}
+
+	p.orphaned += orphaned
+	p.metrics.RecordOrphanedBlocks(orphaned)
+	p.metrics.RecordPendingBlocks(len(p.blocks))
+
+	sort.Slice(confirmed, func(i, j int) bool {
+		return confirmed[i].slot() < confirmed[j].slot()
+	})
+	return confirmed
+}
+
+func (p *pendingTier) status() PendingStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PendingStatus{Blocks: len(p.blocks), ConfirmedSlot: uint64(p.cutoff), Orphaned: p.orphaned}
+}
+
+// promotePending writes the held blocks that have been confirmed to storage, oldest first, and drops those that have
+// been reorged out. A block that cannot be written stays held, with the blocks after it, and is retried the next time.
+// The blocks are written in order so that every block still held is an ancestor of the next tip, or is reorged out.
+// If the canonical chain down to the held blocks cannot be determined, nothing is settled and it is retried the next
+// time, so that a block is never dropped without knowing that it was reorged out.
+func (a *Archiver) promotePending(ctx context.Context) error {
+	id := a.pending.tipID()
+	tip, err := a.blockHeader(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s block header: %w", id, err)
+	}
+	cutoff := a.pending.confirmedSlot(tip.Header.Message.Slot)
+
+	unsettled := a.pending.unsettled(cutoff)
+	canonical, err := a.canonicalAncestors(ctx, tip, unsettled)
+	if err != nil {
+		return fmt.Errorf("failed to determine canonical chain of %s block %s: %w", id, tip.Root, err)
+	}
+
+	for _, block := range a.pending.settle(cutoff, unsettled, canonical) {
+		if err := a.writeBlobData(ctx, block.header, block.data); err != nil {
+			return fmt.Errorf("failed to write confirmed block %s: %w", block.data.Header.BeaconBlockHash, err)
+		}
+		a.pending.remove(block.data.Header.BeaconBlockHash)
+		a.metrics.RecordStoredBlobs(block.fork, block.data.Blobs())
+		a.log.Debug("stored confirmed blob sidecars", "root", block.data.Header.BeaconBlockHash, "slot", block.slot(), "count", block.data.Blobs())
+	}
+
+	return nil
+}
+
+// canonicalAncestors returns the roots of tip and its ancestors, down to the oldest slot of the unsettled blocks. The
+// walk follows the held blocks, and the ancestors that are not held, such as blocks newer than the newest held block
+// the follower has seen, or blocks that were already written, are fetched from the beacon node.
+func (a *Archiver) canonicalAncestors(ctx context.Context, tip *v1.BeaconBlockHeader, unsettled map[common.Hash]phase0.Slot) (map[common.Hash]bool, error) {
+	canonical := make(map[common.Hash]bool)
+	if len(unsettled) == 0 {
+		return canonical, nil
+	}
+	oldest := tip.Header.Message.Slot
+	for _, slot := range unsettled {
+		oldest = min(oldest, slot)
+	}
+
+	header := tip
+	for {
+		canonical[common.Hash(header.Root)] = true
+		parent := common.Hash(header.Header.Message.ParentRoot)
+		if header.Header.Message.Slot <= oldest || parent == (common.Hash{}) {
+			return canonical, nil
+		}
+
+		if held, ok := a.pending.block(parent); ok {
+			header = held.header
+			continue
+		}
+		fetched, err := a.blockHeader(ctx, parent.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch block header %s: %w", parent, err)
+		}
+		header = fetched
+	}
+}
+
+// blockHeader fetches the header of the block with the given identifier, waiting for and recording rate limiting.
+func (a *Archiver) blockHeader(ctx context.Context, id string) (*v1.BeaconBlockHeader, error) {
+	if err := a.backoff.wait(ctx); err != nil {
+		return nil, err
+	}
+	header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{Block: id})
+	a.backoff.observe(err)
+	if err != nil {
+		return nil, err
+	}
+	return header.Data, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPending(t *testing.T, beacon *beacontest.StubBeaconClient, depth uint64, finality bool) (*Archiver, *storagetest.TestFileStorage) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:      5 * time.Second,
+		OriginBlock:       blobtest.OriginBlock,
+		ConfirmationDepth: depth,
+		WaitForFinality:   finality,
+	}, fs, beacon, metrics.NewMetrics())
+	require.NoError(t, err)
+
+	// The origin block is stored, so that following the chain stops at it
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.OriginBlock},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.OriginBlock.String()])},
+	})
+	return svc, fs
+}
+
+func TestArchiver_ConfirmationDepth(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.Headers["head"] = beacon.Headers[blobtest.Four.String()]
+	svc, fs := setupPending(t, beacon, 1, false)
+
+	require.NoError(t, svc.promotePending(context.Background()))
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	// Only the blocks at least one slot behind the head are stored
+	fs.CheckExistsOrFail(t, blobtest.One)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	require.True(t, svc.pending.has(blobtest.Four))
+
+	// A held block counts as stored, so it is not fetched again
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	beacon.Headers["head"] = beacon.Headers[blobtest.Five.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+	require.Equal(t, fs.ReadOrFail(t, blobtest.Four).BlobSidecars.Data, storage.FromDenebSidecars(beacon.Blobs[blobtest.Four.String()]))
+	require.False(t, svc.pending.has(blobtest.Four))
+	require.Equal(t, PendingStatus{Blocks: 1, ConfirmedSlot: blobtest.StartSlot + 4}, svc.pending.status())
+}
+
+func TestArchiver_ConfirmationDepthDropsOrphans(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.Headers["head"] = beacon.Headers[blobtest.Four.String()]
+	svc, fs := setupPending(t, beacon, 1, false)
+
+	// A block at the same slot as Four, that is reorged out when Five is built on Four
+	orphan := common.Hash{0xf}
+	beacon.Headers[orphan.String()] = &v1.BeaconBlockHeader{
+		Root: phase0.Root(orphan),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(blobtest.StartSlot + 4), ParentRoot: phase0.Root(blobtest.Three)},
+		},
+	}
+	beacon.Blobs[orphan.String()] = blobtest.NewBlobSidecars(t, 2)
+
+	require.NoError(t, svc.promotePending(context.Background()))
+	svc.processBlocksUntilKnownBlock(context.Background())
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), orphan.String(), false)
+	require.NoError(t, err)
+	require.True(t, svc.pending.has(orphan))
+
+	beacon.Headers["head"] = beacon.Headers[blobtest.Five.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckNotExistsOrFail(t, orphan)
+	require.False(t, svc.pending.has(orphan))
+	require.Equal(t, 1, svc.pending.status().Orphaned)
+}
+
+func TestArchiver_WaitForFinality(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setupPending(t, beacon, 0, true)
+
+	require.NoError(t, svc.promotePending(context.Background()))
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	// Three is finalized
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+
+	beacon.Headers["finalized"] = beacon.Headers[blobtest.Five.String()]
+	require.NoError(t, svc.promotePending(context.Background()))
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	require.Equal(t, PendingStatus{ConfirmedSlot: blobtest.StartSlot + 5}, svc.pending.status())
+}
+
+func TestArchiver_HoldsUntilConfirmedSlotIsKnown(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setupPending(t, beacon, 0, true)
+
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.One.String(), false)
+	require.NoError(t, err)
+	require.False(t, exists)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	require.True(t, svc.pending.has(blobtest.One))
+}
+
+func TestArchiver_ConfirmationDepthTipNotHeld(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.Headers["head"] = beacon.Headers[blobtest.Four.String()]
+	svc, fs := setupPending(t, beacon, 1, false)
+
+	require.NoError(t, svc.promotePending(context.Background()))
+	svc.processBlocksUntilKnownBlock(context.Background())
+	require.True(t, svc.pending.has(blobtest.Four))
+
+	// A new head arrives that the follower has not seen, so it is not held, and Four is confirmed through it
+	beacon.Headers["head"] = beacon.Headers[blobtest.Five.String()]
+	require.False(t, svc.pending.has(blobtest.Five))
+	require.NoError(t, svc.promotePending(context.Background()))
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	require.False(t, svc.pending.has(blobtest.Four))
+	require.Equal(t, PendingStatus{ConfirmedSlot: blobtest.StartSlot + 4}, svc.pending.status())
+}
+
+func TestArchiver_WaitForFinalityTipWritten(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.Headers["finalized"] = beacon.Headers[blobtest.Three.String()]
+	svc, fs := setupPending(t, beacon, 0, true)
+
+	require.NoError(t, svc.promotePending(context.Background()))
+	svc.processBlocksUntilKnownBlock(context.Background())
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	require.True(t, svc.pending.has(blobtest.Four))
+
+	// A held block that the finalized block, which was already written, is not descended from is still dropped
+	orphan := common.Hash{0xf}
+	svc.pending.add(pendingBlock{
+		header: &v1.BeaconBlockHeader{
+			Root: phase0.Root(orphan),
+			Header: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(blobtest.StartSlot + 3), ParentRoot: phase0.Root(blobtest.Two)},
+			},
+		},
+		data: storage.BlobData{Header: storage.Header{BeaconBlockHash: orphan}},
+	})
+	require.NoError(t, svc.promotePending(context.Background()))
+
+	fs.CheckNotExistsOrFail(t, orphan)
+	require.True(t, svc.pending.has(blobtest.Four))
+	require.Equal(t, PendingStatus{Blocks: 2, ConfirmedSlot: blobtest.StartSlot + 3, Orphaned: 1}, svc.pending.status())
+}
+
+func TestArchiver_ConfirmationDepthUnknownAncestry(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.Headers["head"] = beacon.Headers[blobtest.Four.String()]
+	svc, fs := setupPending(t, beacon, 1, false)
+
+	require.NoError(t, svc.promotePending(context.Background()))
+	svc.processBlocksUntilKnownBlock(context.Background())
+	require.True(t, svc.pending.has(blobtest.Four))
+
+	// The parent of the head is neither held nor known to the beacon node, so whether Four is canonical is unknown
+	beacon.Headers["head"] = &v1.BeaconBlockHeader{
+		Root: phase0.Root{0xe},
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(blobtest.StartSlot + 6), ParentRoot: phase0.Root{0xd}},
+		},
+	}
+	require.ErrorContains(t, svc.promotePending(context.Background()), "failed to determine canonical chain")
+
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	require.True(t, svc.pending.has(blobtest.Four))
+	require.Equal(t, PendingStatus{Blocks: 1, ConfirmedSlot: blobtest.StartSlot + 3}, svc.pending.status())
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// reapResult is the number and total size of the blocks deleted by a pass of the reaper.
+type reapResult struct {
+	Reaped      int
+	ReapedBytes int64
+	Pruned      int
+	PrunedBytes int64
+}
+
+// retentionCutoff returns the oldest slot kept by a retention window of the given number of slots behind head, and
+// false if every slot up to head is kept. The cutoff itself is kept: blocks at or after it are stored and backfilled,
+// and blocks before it are pruned and not backfilled.
+func retentionCutoff(head, retentionSlots uint64) (uint64, bool) {
+	if retentionSlots == 0 || head <= retentionSlots {
+		return 0, false
+	}
+	return head - retentionSlots, true
+}
+
+// runReaper deletes expired and old blocks from storage immediately, then every interval until the context is done or
+// the data store turns out not to list its blocks.
+func (a *Archiver) runReaper(ctx context.Context, expirer storage.Expirer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.reap(ctx, expirer, time.Now()); errors.Is(err, storage.ErrExpiryUnsupported) {
+			a.log.Warn("storage does not list its blocks, expired and old blocks will not be deleted")
+			return
+		} else if err != nil && ctx.Err() == nil {
+			a.log.Error("failed to reap blocks", "err", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reap deletes the blocks that expired at or before now, and the blocks older than the retention window behind the
+// head. A block is only deleted once it is finalized, so that an object TTL or retention window shorter than finality
+// cannot delete the blobs of a block that may still be re-archived after a reorg. A block whose slot is not known was
+// stored without sidecars, so it has no blobs to lose if it expires, but its age is not known to prune it by. A deleted
+// block is removed from the inventory, if it is kept, while the entries of its blobs in the blob index are left, as
+// finding them would mean reading the block, so a lookup of one of its blobs by versioned hash returns a 404.
+func (a *Archiver) reap(ctx context.Context, expirer storage.Expirer, now time.Time) (reapResult, error) {
+	var result reapResult
+	finalizedSlot, err := a.headerSlot(ctx, "finalized")
+	if err != nil {
+		return result, err
+	}
+	var cutoff uint64
+	var retained bool
+	if a.cfg.RetentionSlots > 0 {
+		headSlot, err := a.headerSlot(ctx, "head")
+		if err != nil {
+			return result, err
+		}
+		cutoff, retained = retentionCutoff(headSlot, a.cfg.RetentionSlots)
+	}
+
+	start := time.Now()
+	blocks, err := expirer.ListBlocks(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	record := func() {
+		a.metrics.RecordReapedBlocks(result.Reaped, result.ReapedBytes)
+		a.metrics.RecordPrunedBlocks(result.Pruned, result.PrunedBytes)
+	}
+
+	unfinalized := 0
+	for _, block := range blocks {
+		expired := block.Expired(now)
+		old := retained && block.Slot != 0 && block.Slot < cutoff
+		if !expired && !old {
+			continue
+		}
+		if block.Slot > finalizedSlot {
+			unfinalized++
+			continue
+		}
+
+		if err := expirer.DeleteBlob(ctx, block.Root); err != nil {
+			record()
+			return result, err
+		}
+		if a.inventory != nil && block.Slot != 0 {
+			a.inventory.remove(block.Root, block.Slot)
+		}
+		if expired {
+			result.Reaped++
+			result.ReapedBytes += block.Bytes
+		} else {
+			result.Pruned++
+			result.PrunedBytes += block.Bytes
+		}
+	}
+
+	record()
+	a.log.Info("reaped blocks", "expired", result.Reaped, "pruned", result.Pruned, "bytes", result.ReapedBytes+result.PrunedBytes,
+		"unfinalized", unfinalized, "finalizedSlot", finalizedSlot, "retentionCutoff", cutoff, "duration", time.Since(start))
+	return result, nil
+}
+
+// headerSlot returns the slot of the block with the given identifier, e.g. "finalized".
+func (a *Archiver) headerSlot(ctx context.Context, id string) (uint64, error) {
+	if err := a.backoff.wait(ctx); err != nil {
+		return 0, err
+	}
+	header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{Block: id})
+	a.backoff.observe(err)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(header.Data.Header.Message.Slot), nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver_ObjectTTL(t *testing.T) {
+	svc, fs := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+	require.Zero(t, fs.ReadOrFail(t, blobtest.Three).Header.ExpiresAt)
+
+	svc.cfg.ObjectTTL = time.Hour
+	before := time.Now()
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	expiresAt := fs.ReadOrFail(t, blobtest.Four).Header.ExpiresAt
+	require.GreaterOrEqual(t, expiresAt, before.Add(time.Hour).Unix())
+	require.LessOrEqual(t, expiresAt, time.Now().Add(time.Hour).Unix())
+}
+
+// writeAtSlot writes a block with one blob at slot to fs, expiring at expiresAt unless it is 0.
+func writeAtSlot(t *testing.T, fs *storagetest.TestFileStorage, hash common.Hash, slot uint64, expiresAt int64) {
+	sidecars := storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))
+	sidecars[0].SignedBlockHeader.Message.Slot = phase0.Slot(slot)
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: hash, ExpiresAt: expiresAt},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars},
+	})
+}
+
+func TestArchiver_Reap(t *testing.T) {
+	svc, fs := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+	now := time.Unix(1_700_000_000, 0)
+
+	// The stub finalizes Three at slot 13
+	writeAtSlot(t, fs, blobtest.One, 11, now.Unix()-60)
+	writeAtSlot(t, fs, blobtest.Three, 13, now.Unix())
+	writeAtSlot(t, fs, blobtest.Four, 14, now.Unix()-60)
+	writeAtSlot(t, fs, blobtest.Five, 15, now.Unix()+60)
+	require.NoError(t, fs.WriteEmptyBlob(context.Background(), blobtest.Two))
+
+	result, err := svc.reap(context.Background(), fs, now)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Reaped)
+	require.Zero(t, result.Pruned)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.Three)
+	// Four has expired but is not finalized yet
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+
+	expected := `
+# HELP blob_archiver_reaped_blocks number of blocks deleted from storage by the reaper because their expiry had passed
+# TYPE blob_archiver_reaped_blocks counter
+blob_archiver_reaped_blocks 2
+`
+	require.NoError(t, testutil.GatherAndCompare(svc.metrics.Registry(), strings.NewReader(expected), "blob_archiver_reaped_blocks"))
+	require.Equal(t, float64(result.ReapedBytes), gatheredValue(t, svc, "blob_archiver_reclaimed_bytes"))
+}
+
+// gatheredValue returns the value of the metric with the given name from the registry of svc.
+func gatheredValue(t *testing.T, svc *Archiver, name string) float64 {
+	families, err := svc.metrics.Registry().Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	require.Failf(t, "metric not found", name)
+	return 0
+}
+
+func TestArchiver_Prune(t *testing.T) {
+	svc, fs := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+	// The stub's head is Five at slot 15, so slots from 12 are kept
+	svc.cfg.RetentionSlots = 3
+
+	writeAtSlot(t, fs, blobtest.OriginBlock, 10, 0)
+	writeAtSlot(t, fs, blobtest.One, 11, 0)
+	writeAtSlot(t, fs, blobtest.Two, 12, 0)
+	writeAtSlot(t, fs, blobtest.Three, 13, 0)
+	require.NoError(t, fs.WriteEmptyBlob(context.Background(), common.Hash{0xff}))
+
+	result, err := svc.reap(context.Background(), fs, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Pruned)
+	require.Positive(t, result.PrunedBytes)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	// The age of a tombstone is not known, so it is kept
+	fs.CheckExistsOrFail(t, common.Hash{0xff})
+
+	expected := `
+# HELP blob_archiver_pruned_blocks number of blocks deleted from storage because they were older than the retention window
+# TYPE blob_archiver_pruned_blocks counter
+blob_archiver_pruned_blocks 2
+`
+	require.NoError(t, testutil.GatherAndCompare(svc.metrics.Registry(), strings.NewReader(expected), "blob_archiver_pruned_blocks"))
+	require.Equal(t, float64(result.PrunedBytes), gatheredValue(t, svc, "blob_archiver_reclaimed_bytes"))
+}
+
+func TestArchiver_PruneRemovesInventory(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	// The slots of the stub's blocks are taken from their stored headers
+	svc.cfg.StoreBlockHeaders = true
+	svc.inventory = newInventory(true, fs, svc.log)
+	// The stub's head is Five at slot 15, so slots from 13 are kept
+	svc.cfg.RetentionSlots = 2
+
+	for _, root := range []common.Hash{blobtest.Two, blobtest.Three} {
+		_, _, err := svc.persistBlobsForBlockToS3(context.Background(), root.String(), false)
+		require.NoError(t, err)
+	}
+	require.NoError(t, svc.inventory.flush(context.Background()))
+
+	result, err := svc.reap(context.Background(), fs, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Pruned)
+	fs.CheckNotExistsOrFail(t, blobtest.Two)
+
+	// The pruned block is no longer listed, so that the inventory matches storage
+	blocks, err := svc.inventory.blocks(context.Background(), blobtest.StartSlot, blobtest.EndSlot)
+	require.NoError(t, err)
+	require.Equal(t, []InventoryBlock{{Slot: blobtest.StartSlot + 3, Root: blobtest.Three, ParentRoot: blobtest.Two}}, blocks)
+	require.NoError(t, svc.inventory.flush(context.Background()))
+	chunk, err := fs.ReadInventoryChunk(context.Background(), storage.InventoryChunkStart(blobtest.StartSlot))
+	require.NoError(t, err)
+	require.Len(t, chunk.Blocks, 1)
+}
+
+func TestArchiver_PruneOnlyFinalized(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.RetentionSlots = 1
+	// Finality lags behind the retention window
+	beacon.Headers["finalized"] = beacon.Headers[blobtest.One.String()]
+
+	writeAtSlot(t, fs, blobtest.One, 11, 0)
+	writeAtSlot(t, fs, blobtest.Two, 12, 0)
+
+	result, err := svc.reap(context.Background(), fs, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Pruned)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+}
+
+func TestArchiver_BackfillStopsAtRetention(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.RetentionSlots = 2
+
+	// A backfill from Five at slot 15 keeps slots from 13, so it does not re-archive the blocks that would be pruned
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	fs.CheckNotExistsOrFail(t, blobtest.Two)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+}
+
+func TestRetentionCutoff(t *testing.T) {
+	_, retained := retentionCutoff(100, 0)
+	require.False(t, retained)
+	_, retained = retentionCutoff(100, 100)
+	require.False(t, retained)
+	cutoff, retained := retentionCutoff(100, 30)
+	require.True(t, retained)
+	require.Equal(t, uint64(70), cutoff)
+}
+
+func TestArchiver_ReapWithoutFinality(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	delete(beacon.Headers, "finalized")
+	svc, fs := setup(t, beacon)
+
+	fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.One, ExpiresAt: 1}})
+
+	// Nothing is deleted if the finalized block is not known
+	_, err := svc.reap(context.Background(), fs, time.Now())
+	require.Error(t, err)
+	fs.CheckExistsOrFail(t, blobtest.One)
+}
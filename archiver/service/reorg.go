@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// reorgWindow is the number of slots of the head chain that are tracked, two epochs, which is how far behind the head
+// blocks are finalized, and so can no longer be reorged out, on a healthy chain.
+const reorgWindow = 64
+
+// ReorgStatus reports the reorgs of the head chain seen while following it.
+type ReorgStatus struct {
+	// Reorgs is the number of reorgs seen since the archiver started
+	Reorgs int `json:"reorgs"`
+	// LastSlot is the slot of the head that was replaced by the last reorg, 0 if there has been none
+	LastSlot uint64 `json:"lastSlot"`
+	// LastDepth is the number of slots between the last block shared by the replaced and new chains and the replaced
+	// head, for the last reorg
+	LastDepth uint64 `json:"lastDepth"`
+	// Unreconciled is the number of reorged out blocks that are still to be marked as orphaned in storage
+	Unreconciled int `json:"unreconciled"`
+}
+
+// trackedBlock is a block of the head chain.
+type trackedBlock struct {
+	root common.Hash
+	slot phase0.Slot
+}
+
+// reorg is a change of the head chain that replaced some of the tracked blocks.
+type reorg struct {
+	// fork is the slot of the last block shared by the replaced and new chains
+	fork phase0.Slot
+	// head is the slot of the replaced head
+	head     phase0.Slot
+	replaced []trackedBlock
+}
+
+func (r reorg) depth() uint64 {
+	return uint64(r.head - r.fork)
+}
+
+// reorgTracker tracks the head chain that the archiver followed over the last reorgWindow slots, by the parent root of
+// each block, so that a new head that is not descended from the tracked head is detected as a reorg. The blocks of
+// the tracked chain that the new head replaced are reorged out, and are kept until they have been reconciled.
+type reorgTracker struct {
+	mu sync.Mutex
+	// chain is the tracked head chain, oldest first, each block the parent of the next
+	chain        []trackedBlock
+	unreconciled map[common.Hash]trackedBlock
+	reorgs       int
+	last         reorg
+}
+
+func newReorgTracker() *reorgTracker {
+	return &reorgTracker{unreconciled: make(map[common.Hash]trackedBlock)}
+}
+
+// replaces returns true if the block is not on the tracked chain, but at a slot the chain covers, i.e. the block is on
+// a branch that was reorged out before and is now being followed again.
+func (t *reorgTracker) replaces(header *v1.BeaconBlockHeader) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.chain) == 0 || header.Header.Message.Slot < t.chain[0].slot {
+		return false
+	}
+	return t.index(common.Hash(header.Root)) < 0
+}
+
+func (t *reorgTracker) index(root common.Hash) int {
+	for i, block := range t.chain {
+		if block.root == root {
+			return i
+		}
+	}
+	return -1
+}
+
+// advance extends the tracked chain from fork, a block at or behind the tracked head, with the blocks built on it,
+// oldest first. If fork is not the tracked head, the tracked blocks after it are replaced, and the reorg is returned.
+func (t *reorgTracker) advance(fork *v1.BeaconBlockHeader, blocks []*v1.BeaconBlockHeader) (reorg, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var replaced []trackedBlock
+	var head phase0.Slot
+	if len(t.chain) > 0 {
+		head = t.chain[len(t.chain)-1].slot
+	}
+
+	if i := t.index(common.Hash(fork.Root)); i >= 0 {
+		replaced = append(replaced, t.chain[i+1:]...)
+		t.chain = t.chain[:i+1]
+	} else {
+		// The new chain reaches back past every tracked block without passing through one, so they are all replaced
+		replaced = append(replaced, t.chain...)
+		t.chain = []trackedBlock{{root: common.Hash(fork.Root), slot: fork.Header.Message.Slot}}
+	}
+
+	for _, block := range blocks {
+		t.chain = append(t.chain, trackedBlock{root: common.Hash(block.Root), slot: block.Header.Message.Slot})
+		// A block that was reorged out but is canonical again must not be marked as orphaned after all
+		delete(t.unreconciled, common.Hash(block.Root))
+	}
+
+	newHead := t.chain[len(t.chain)-1].slot
+	for len(t.chain) > 1 && uint64(t.chain[0].slot)+reorgWindow < uint64(newHead) {
+		t.chain = t.chain[1:]
+	}
+
+	if len(replaced) == 0 {
+		return reorg{}, false
+	}
+
+	result := reorg{fork: fork.Header.Message.Slot, head: head, replaced: replaced}
+	t.reorgs++
+	t.last = result
+	for _, block := range replaced {
+		t.unreconciled[block.root] = block
+	}
+	return result, true
+}
+
+// takeUnreconciled returns the reorged out blocks that are still to be reconciled, they are tracked again with
+// unresolved if reconciling them fails.
+func (t *reorgTracker) takeUnreconciled() []trackedBlock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]trackedBlock, 0, len(t.unreconciled))
+	for _, block := range t.unreconciled {
+		result = append(result, block)
+	}
+	t.unreconciled = make(map[common.Hash]trackedBlock)
+	return result
+}
+
+func (t *reorgTracker) unresolved(block trackedBlock) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unreconciled[block.root] = block
+}
+
+func (t *reorgTracker) status() ReorgStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := ReorgStatus{Reorgs: t.reorgs, Unreconciled: len(t.unreconciled)}
+	if t.reorgs > 0 {
+		result.LastSlot, result.LastDepth = uint64(t.last.head), t.last.depth()
+	}
+	return result
+}
+
+// followHeadChain records the blocks stored while following the head from the block that was already stored, known,
+// up to the new head, oldest first. If known was reorged out before, the new head has switched back to its branch, so
+// known and its ancestors back to the tracked chain are fetched again to clear their orphaned marks. A reorg is
+// recorded, and the blocks it replaced are marked as orphaned in storage, see reconcileReorgs.
+func (a *Archiver) followHeadChain(ctx context.Context, known *v1.BeaconBlockHeader, blocks []*v1.BeaconBlockHeader) {
+	var reinstated []*v1.BeaconBlockHeader
+	fork := known
+	for a.reorgs.replaces(fork) {
+		if _, _, err := a.persistBlobsForBlockToS3(ctx, fork.Root.String(), true); err != nil {
+			a.log.Error("failed to fetch blobs of block returned to the canonical chain", "root", fork.Root.String(), "err", err)
+			return
+		}
+		reinstated = append([]*v1.BeaconBlockHeader{fork}, reinstated...)
+
+		parent, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{Block: fork.Header.Message.ParentRoot.String()})
+		if err != nil {
+			a.log.Error("failed to fetch parent of block returned to the canonical chain", "root", fork.Root.String(), "err", err)
+			return
+		}
+		fork = parent.Data
+	}
+
+	if r, ok := a.reorgs.advance(fork, append(reinstated, blocks...)); ok {
+		a.metrics.RecordReorg(r.depth(), len(r.replaced))
+		a.log.Warn("head chain reorged", "forkSlot", r.fork, "replacedHeadSlot", r.head, "depth", r.depth(), "replaced", len(r.replaced), "reinstated", len(reinstated))
+	}
+
+	a.reconcileReorgs(ctx)
+}
+
+// reconcileReorgs marks the stored blocks that were reorged out as orphaned, see storage.Header.Orphaned, so that they
+// can be told apart from the canonical blocks. Blocks that were never stored, e.g. as they were held until confirmed,
+// are skipped. A block that cannot be marked is retried the next time.
+func (a *Archiver) reconcileReorgs(ctx context.Context) {
+	for _, block := range a.reorgs.takeUnreconciled() {
+		if a.inventory != nil {
+			a.inventory.orphan(block)
+		}
+
+		marked, err := a.markOrphaned(ctx, block.root)
+		if err != nil {
+			a.log.Warn("failed to mark reorged out block as orphaned, will retry", "root", block.root.String(), "slot", block.slot, "err", err)
+			a.reorgs.unresolved(block)
+			continue
+		}
+		if marked {
+			a.metrics.RecordOrphanedStoredBlock()
+			a.log.Info("marked reorged out block as orphaned", "root", block.root.String(), "slot", block.slot)
+		}
+	}
+}
+
+// markOrphaned marks the stored block with the given root as orphaned, and returns false if it is not stored or is
+// already marked. A block without blobs is not marked, as it may be stored as an empty tombstone, see
+// storage.DataStoreWriter.WriteEmptyBlob, which has no header to hold the mark, and rewriting it would replace the
+// tombstone with the encoded block.
+func (a *Archiver) markOrphaned(ctx context.Context, root common.Hash) (bool, error) {
+	data, err := a.dataStoreClient.ReadBlob(ctx, root)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if data.Header.Orphaned || data.Empty() {
+		return false, nil
+	}
+	data.Header.Orphaned = true
+	if err := a.dataStoreClient.WriteBlob(ctx, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
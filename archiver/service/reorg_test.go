@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func testHeader(root common.Hash, slot uint64, parent common.Hash) *v1.BeaconBlockHeader {
+	return &v1.BeaconBlockHeader{
+		Root: phase0.Root(root),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot), ParentRoot: phase0.Root(parent)},
+		},
+	}
+}
+
+// addBlock adds a block with a blob to the stub beacon node.
+func addBlock(t *testing.T, beacon *beacontest.StubBeaconClient, root common.Hash, slot uint64, parent common.Hash) {
+	beacon.Headers[root.String()] = testHeader(root, slot, parent)
+	beacon.Blobs[root.String()] = blobtest.NewBlobSidecars(t, 1)
+}
+
+func TestReorgTracker_Advance(t *testing.T) {
+	tracker := newReorgTracker()
+	a, b, c, d := testHeader(common.Hash{0xa}, 10, common.Hash{}), testHeader(common.Hash{0xb}, 11, common.Hash{0xa}), testHeader(common.Hash{0xc}, 12, common.Hash{0xb}), testHeader(common.Hash{0xd}, 13, common.Hash{0xc})
+
+	_, reorged := tracker.advance(a, []*v1.BeaconBlockHeader{b, c})
+	require.False(t, reorged)
+	_, reorged = tracker.advance(c, []*v1.BeaconBlockHeader{d})
+	require.False(t, reorged)
+	require.False(t, tracker.replaces(b))
+
+	// A new head built on b replaces c and d
+	other := testHeader(common.Hash{0xe}, 12, common.Hash{0xb})
+	require.True(t, tracker.replaces(other))
+	r, reorged := tracker.advance(b, []*v1.BeaconBlockHeader{other})
+	require.True(t, reorged)
+	require.EqualValues(t, 2, r.depth())
+	require.Equal(t, []trackedBlock{{common.Hash{0xc}, 12}, {common.Hash{0xd}, 13}}, r.replaced)
+	require.Equal(t, ReorgStatus{Reorgs: 1, LastSlot: 13, LastDepth: 2, Unreconciled: 2}, tracker.status())
+
+	// Blocks before the tracked chain are not known to be replaced
+	require.False(t, tracker.replaces(testHeader(common.Hash{0xf}, 9, common.Hash{})))
+	require.Len(t, tracker.takeUnreconciled(), 2)
+	require.Zero(t, tracker.status().Unreconciled)
+}
+
+func TestReorgTracker_Window(t *testing.T) {
+	tracker := newReorgTracker()
+	parent := testHeader(common.Hash{1}, 1, common.Hash{})
+	tracker.advance(parent, nil)
+	for slot := uint64(2); slot <= 2*reorgWindow; slot++ {
+		block := testHeader(common.BigToHash(new(big.Int).SetUint64(slot)), slot, common.Hash(parent.Root))
+		tracker.advance(parent, []*v1.BeaconBlockHeader{block})
+		parent = block
+	}
+
+	require.Len(t, tracker.chain, reorgWindow+1)
+	require.EqualValues(t, reorgWindow, tracker.chain[0].slot)
+	require.Zero(t, tracker.status().Reorgs)
+}
+
+func TestArchiver_ReorgMarksOrphans(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// Following the head stores Four and Five on top of Three
+	fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Three}})
+	svc.processBlocksUntilKnownBlock(context.Background())
+	fs.CheckExistsOrFail(t, blobtest.Five)
+
+	// The head moves to another branch built on Three, replacing Four and Five
+	forked, forkedHead := common.Hash{0xf1}, common.Hash{0xf2}
+	addBlock(t, beacon, forked, blobtest.StartSlot+4, blobtest.Three)
+	addBlock(t, beacon, forkedHead, blobtest.StartSlot+6, forked)
+	beacon.Headers["head"] = beacon.Headers[forkedHead.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	require.True(t, fs.ReadOrFail(t, blobtest.Four).Header.Orphaned)
+	require.True(t, fs.ReadOrFail(t, blobtest.Five).Header.Orphaned)
+	require.Equal(t, storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()]), fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data)
+	require.False(t, fs.ReadOrFail(t, forked).Header.Orphaned)
+	require.False(t, fs.ReadOrFail(t, forkedHead).Header.Orphaned)
+	require.Equal(t, ReorgStatus{Reorgs: 1, LastSlot: blobtest.StartSlot + 5, LastDepth: 2}, svc.reorgs.status())
+
+	// And back again, to a head built on Five, so Four and Five are canonical again
+	head := common.Hash{0xf3}
+	addBlock(t, beacon, head, blobtest.StartSlot+7, blobtest.Five)
+	beacon.Headers["head"] = beacon.Headers[head.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	require.False(t, fs.ReadOrFail(t, blobtest.Four).Header.Orphaned)
+	require.False(t, fs.ReadOrFail(t, blobtest.Five).Header.Orphaned)
+	require.True(t, fs.ReadOrFail(t, forked).Header.Orphaned)
+	require.True(t, fs.ReadOrFail(t, forkedHead).Header.Orphaned)
+	require.Equal(t, ReorgStatus{Reorgs: 2, LastSlot: blobtest.StartSlot + 6, LastDepth: 3}, svc.reorgs.status())
+}
+
+func TestArchiver_ReconcileRetries(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Four},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Four.String()])},
+	})
+
+	three, four := beacon.Headers[blobtest.Three.String()], beacon.Headers[blobtest.Four.String()]
+	svc.reorgs.advance(three, []*v1.BeaconBlockHeader{four})
+	forked := testHeader(common.Hash{0xf1}, blobtest.StartSlot+4, blobtest.Three)
+	svc.reorgs.advance(three, []*v1.BeaconBlockHeader{forked})
+
+	fs.WritesFailTimes(1)
+	svc.reconcileReorgs(context.Background())
+	require.False(t, fs.ReadOrFail(t, blobtest.Four).Header.Orphaned)
+	require.Equal(t, 1, svc.reorgs.status().Unreconciled)
+
+	svc.reconcileReorgs(context.Background())
+	require.True(t, fs.ReadOrFail(t, blobtest.Four).Header.Orphaned)
+	require.Zero(t, svc.reorgs.status().Unreconciled)
+}
+
+func TestArchiver_MarkOrphanedKeepsTombstonesAndExpiry(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Four, ExpiresAt: expiresAt},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Four.String()])},
+	})
+	require.NoError(t, fs.WriteEmptyBlob(context.Background(), blobtest.Five))
+
+	marked, err := svc.markOrphaned(context.Background(), blobtest.Four)
+	require.NoError(t, err)
+	require.True(t, marked)
+	data := fs.ReadOrFail(t, blobtest.Four)
+	require.True(t, data.Header.Orphaned)
+	require.Equal(t, expiresAt, data.Header.ExpiresAt)
+
+	// The tombstone is left as it is
+	marked, err = svc.markOrphaned(context.Background(), blobtest.Five)
+	require.NoError(t, err)
+	require.False(t, marked)
+	blocks, err := fs.ListBlocks(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, blocks, storage.StoredBlock{Root: blobtest.Five})
+}
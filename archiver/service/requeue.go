@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// backfillRetryStrategy is the delay before each re-attempt of a block that failed during backfill.
+var backfillRetryStrategy retry.Strategy = &retry.ExponentialStrategy{
+	Min:       backfillErrorRetryInterval,
+	Max:       5 * time.Minute,
+	MaxJitter: time.Second,
+}
+
+// DeadLetter is a block that could not be stored during backfill after the maximum number of attempts.
+type DeadLetter struct {
+	// Root is omitted for a slot of the backfill range whose block header could not be fetched
+	Root      string `json:"root,omitempty"`
+	Slot      uint64 `json:"slot"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError"`
+}
+
+// RetryStatus reports the blocks that are waiting to be re-attempted, and those that have been given up on.
+type RetryStatus struct {
+	Pending     int          `json:"pending"`
+	DeadLetters []DeadLetter `json:"deadLetters"`
+}
+
+type retryItem struct {
+	// process is the backfill process that the block was found by, zero for a slot of the backfill range
+	process common.Hash
+	// root is zero for a slot of the backfill range whose block header could not be fetched, which is re-attempted by
+	// its slot
+	root     common.Hash
+	slot     phase0.Slot
+	attempts int
+	due      time.Time
+	err      error
+}
+
+// blockID returns the block identifier that the block is re-attempted by, its root or else its slot.
+func (i *retryItem) blockID() string {
+	if i.root == (common.Hash{}) {
+		return strconv.FormatUint(uint64(i.slot), 10)
+	}
+	return i.root.String()
+}
+
+// retryQueue is a delay queue of blocks that failed to be stored during backfill. Rather than the backfill retrying a
+// block inline, and stalling until it succeeds, the block is queued and re-attempted in the background with an
+// increasing delay. A block that still fails after maxAttempts is moved to the dead-letter list.
+type retryQueue struct {
+	mu          sync.Mutex
+	strategy    retry.Strategy
+	maxAttempts int
+	now         func() time.Time
+	pending     []*retryItem
+	dead        []DeadLetter
+	// wake is signalled when an item is added, so that the queue re-evaluates when the next item is due
+	wake chan struct{}
+	// outstanding is the number of items that have been added and not yet stored or dead-lettered, idle is closed
+	// when it reaches zero
+	outstanding int
+	idle        chan struct{}
+}
+
+// newBackfillRetryQueue creates the retry queue for backfill, or returns nil if maxAttempts is 0 and failed blocks
+// should be retried inline.
+func newBackfillRetryQueue(maxAttempts int) *retryQueue {
+	if maxAttempts <= 0 {
+		return nil
+	}
+	return newRetryQueue(maxAttempts, backfillRetryStrategy)
+}
+
+func newRetryQueue(maxAttempts int, strategy retry.Strategy) *retryQueue {
+	idle := make(chan struct{})
+	close(idle)
+	return &retryQueue{
+		strategy:    strategy,
+		maxAttempts: maxAttempts,
+		now:         time.Now,
+		wake:        make(chan struct{}, 1),
+		idle:        idle,
+	}
+}
+
+// add queues a block after its first failed attempt.
+func (q *retryQueue) add(process common.Hash, root common.Hash, slot phase0.Slot, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.outstanding == 0 {
+		q.idle = make(chan struct{})
+	}
+	q.outstanding++
+	q.schedule(&retryItem{process: process, root: root, slot: slot, attempts: 1, err: err})
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule queues the next attempt of item, or moves it to the dead-letter list. It must be called with mu held.
+func (q *retryQueue) schedule(item *retryItem) {
+	if item.attempts >= q.maxAttempts {
+		dead := DeadLetter{
+			Slot:      uint64(item.slot),
+			Attempts:  item.attempts,
+			LastError: item.err.Error(),
+		}
+		if item.root != (common.Hash{}) {
+			dead.Root = item.root.String()
+		}
+		q.dead = append(q.dead, dead)
+		q.resolved()
+		return
+	}
+
+	item.due = q.now().Add(q.strategy.Duration(item.attempts - 1))
+	q.pending = append(q.pending, item)
+}
+
+// resolved records that an item has been stored or dead-lettered. It must be called with mu held.
+func (q *retryQueue) resolved() {
+	q.outstanding--
+	if q.outstanding == 0 {
+		close(q.idle)
+	}
+}
+
+// next removes and returns the first item that is due, or returns the time until the next item is due.
+func (q *retryQueue) next() (*retryItem, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil, 0, false
+	}
+
+	now := q.now()
+	earliest := 0
+	for i, item := range q.pending {
+		if item.due.Before(q.pending[earliest].due) {
+			earliest = i
+		}
+	}
+
+	item := q.pending[earliest]
+	if wait := item.due.Sub(now); wait > 0 {
+		return nil, wait, true
+	}
+
+	q.pending = append(q.pending[:earliest], q.pending[earliest+1:]...)
+	return item, 0, true
+}
+
+// run re-attempts the queued blocks as they become due until ctx is done. A block is stored by calling attempt.
+func (q *retryQueue) run(ctx context.Context, attempt func(ctx context.Context, item *retryItem) error) {
+	for {
+		item, wait, ok := q.next()
+		if item != nil {
+			err := attempt(ctx, item)
+
+			q.mu.Lock()
+			if err == nil {
+				q.resolved()
+			} else {
+				item.attempts++
+				item.err = err
+				q.schedule(item)
+			}
+			q.mu.Unlock()
+			continue
+		}
+
+		var timer <-chan time.Time
+		if ok {
+			timer = time.After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer:
+		}
+	}
+}
+
+// waitIdle blocks until every queued block has been stored or dead-lettered, or ctx is done.
+func (q *retryQueue) waitIdle(ctx context.Context) {
+	q.mu.Lock()
+	idle := q.idle
+	q.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+	case <-idle:
+	}
+}
+
+func (q *retryQueue) status() RetryStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return RetryStatus{
+		Pending:     len(q.pending),
+		DeadLetters: append([]DeadLetter{}, q.dead...),
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyBeaconClient is a stub beacon client that fails to return the blobs of a block a number of times.
+type flakyBeaconClient struct {
+	*beacontest.StubBeaconClient
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (c *flakyBeaconClient) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	c.mu.Lock()
+	if c.failures[opts.Block] > 0 {
+		c.failures[opts.Block]--
+		c.mu.Unlock()
+		return nil, fmt.Errorf("timeout")
+	}
+	c.mu.Unlock()
+	return c.StubBeaconClient.BlobSidecars(ctx, opts)
+}
+
+// recordingStrategy records the attempts it is asked for the delay of.
+type recordingStrategy struct {
+	attempts []int
+}
+
+func (s *recordingStrategy) Duration(attempt int) time.Duration {
+	s.attempts = append(s.attempts, attempt)
+	return time.Duration(attempt+1) * time.Minute
+}
+
+func TestRetryQueue_Backoff(t *testing.T) {
+	strategy := &recordingStrategy{}
+	q := newRetryQueue(3, strategy)
+	now := time.Unix(1_700_000_000, 0)
+	q.now = func() time.Time { return now }
+
+	q.add(common.Hash{}, common.Hash{1}, 1, errors.New("failed"))
+	require.Equal(t, now.Add(time.Minute), q.pending[0].due)
+
+	// The item is not due until its delay has passed
+	item, wait, ok := q.next()
+	require.Nil(t, item)
+	require.True(t, ok)
+	require.Equal(t, time.Minute, wait)
+
+	now = now.Add(time.Minute)
+	item, _, _ = q.next()
+	require.NotNil(t, item)
+
+	item.attempts++
+	q.schedule(item)
+	require.Equal(t, now.Add(2*time.Minute), q.pending[0].due)
+	require.Equal(t, []int{0, 1}, strategy.attempts)
+}
+
+func TestRetryQueue_DeadLetters(t *testing.T) {
+	q := newRetryQueue(3, retry.Fixed(time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	attempts := make(map[common.Hash]int)
+	go q.run(ctx, func(_ context.Context, item *retryItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[item.root]++
+		if item.root == (common.Hash{1}) {
+			return errors.New("still failing")
+		}
+		return nil
+	})
+
+	q.add(common.Hash{}, common.Hash{1}, 1, errors.New("failed"))
+	q.add(common.Hash{}, common.Hash{2}, 2, errors.New("failed"))
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	q.waitIdle(waitCtx)
+	require.NoError(t, waitCtx.Err())
+
+	// The first attempt was made before the block was queued
+	mu.Lock()
+	require.Equal(t, 2, attempts[common.Hash{1}])
+	require.Equal(t, 1, attempts[common.Hash{2}])
+	mu.Unlock()
+
+	require.Equal(t, RetryStatus{
+		DeadLetters: []DeadLetter{{Root: common.Hash{1}.String(), Slot: 1, Attempts: 3, LastError: "still failing"}},
+	}, q.status())
+}
+
+func setupFlakyBackfill(t *testing.T, failures map[string]int) (*Archiver, *flakyBeaconClient, *storagetest.TestFileStorage) {
+	beacon := &flakyBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t), failures: failures}
+	svc, fs := setup(t, beacon.StubBeaconClient)
+	svc.beaconClient = beacon
+	svc.retries = newRetryQueue(3, retry.Fixed(time.Millisecond))
+
+	// The current head is already stored, so the backfill walks back to the origin
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Five},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.Five.String()])},
+	})
+	return svc, beacon, fs
+}
+
+func TestArchiver_BackfillRequeuesFailedBlock(t *testing.T) {
+	svc, beacon, fs := setupFlakyBackfill(t, map[string]int{blobtest.Three.String(): 2})
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckExistsOrFail(t, blob)
+	}
+	require.Equal(t, RetryStatus{DeadLetters: []DeadLetter{}}, svc.retries.status())
+	require.Empty(t, svc.wal.Entries)
+}
+
+func TestArchiver_BackfillDeadLettersFailedBlock(t *testing.T) {
+	svc, beacon, fs := setupFlakyBackfill(t, map[string]int{blobtest.Three.String(): 100})
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	// The backfill continues past the failed block to the origin
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckExistsOrFail(t, blob)
+	}
+	fs.CheckNotExistsOrFail(t, blobtest.Three)
+
+	a := NewAPI(svc.metrics, svc.log, svc)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/status", nil))
+	require.Equal(t, 200, response.Code)
+
+	var status StatusResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &status))
+	require.NotNil(t, status.BackfillRetries)
+	require.Equal(t, []DeadLetter{{
+		Root:      blobtest.Three.String(),
+		Slot:      blobtest.StartSlot + 3,
+		Attempts:  3,
+		LastError: "timeout",
+	}}, status.BackfillRetries.DeadLetters)
+}
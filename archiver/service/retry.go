@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+)
+
+// ErrRetryBudgetExhausted is returned when an operation fails and the shared retry budget does not allow it to be
+// retried.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// FailedPermanentlyError is returned by retryWithBudget when every attempt of the operation failed, with the error of
+// the last attempt.
+type FailedPermanentlyError struct {
+	Attempts int
+	LastErr  error
+}
+
+func (e *FailedPermanentlyError) Error() string {
+	return fmt.Sprintf("operation failed permanently after %d attempts: %v", e.Attempts, e.LastErr)
+}
+
+func (e *FailedPermanentlyError) Unwrap() error {
+	return e.LastErr
+}
+
+// retryBudget is a token bucket shared by every retried operation. Each operation deposits ratio tokens and each retry
+// withdraws a whole token, so retries are limited to roughly ratio of all operations. The bucket holds at most burst
+// tokens, and starts full, so isolated failures are always retried. When the beacon node is down every operation
+// fails, the bucket empties and operations stop retrying, rather than multiplying the load on the beacon node.
+type retryBudget struct {
+	mu      sync.Mutex
+	ratio   float64
+	burst   float64
+	tokens  float64
+	metrics metrics.Metricer
+}
+
+// newRetryBudget creates a retryBudget, a ratio of 0 disables the budget so all retries are allowed.
+func newRetryBudget(ratio float64, burst int, m metrics.Metricer) *retryBudget {
+	return &retryBudget{
+		ratio:   ratio,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		metrics: m,
+	}
+}
+
+// deposit records that an operation is being started.
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.tokens+b.ratio, b.burst)
+}
+
+// withdraw returns true if a retry is allowed, consuming a token.
+func (b *retryBudget) withdraw() bool {
+	if b.ratio <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		b.metrics.RecordRetryDropped()
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+type pair[T, U any] struct {
+	a T
+	b U
+}
+
+// retryWithBudget2 is retryWithBudget for operations that return two values, like retry.Do2.
+func retryWithBudget2[T, U any](ctx context.Context, budget *retryBudget, maxAttempts int, strategy retry.Strategy, op func() (T, U, error)) (T, U, error) {
+	res, err := retryWithBudget(ctx, budget, maxAttempts, strategy, func() (pair[T, U], error) {
+		a, b, err := op()
+		return pair[T, U]{a, b}, err
+	})
+	return res.a, res.b, err
+}
+
+// retryWithBudget performs op up to maxAttempts times with delays according to strategy, like retry.Do, but each
+// retry must be allowed by the budget. If it is not, the last error is returned wrapped with ErrRetryBudgetExhausted,
+// and if every attempt fails it is returned in a FailedPermanentlyError. The wait between attempts ends early with the
+// error of ctx if it is done first.
+func retryWithBudget[T any](ctx context.Context, budget *retryBudget, maxAttempts int, strategy retry.Strategy, op func() (T, error)) (T, error) {
+	var empty T
+
+	budget.deposit()
+
+	var err error
+	for i := 0; i < maxAttempts; i++ {
+		if ctx.Err() != nil {
+			return empty, ctx.Err()
+		}
+
+		if i > 0 {
+			if !budget.withdraw() {
+				return empty, fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+			}
+			select {
+			case <-time.After(strategy.Duration(i - 1)):
+			case <-ctx.Done():
+				return empty, ctx.Err()
+			}
+		}
+
+		var ret T
+		ret, err = op()
+		if err == nil {
+			return ret, nil
+		}
+	}
+
+	return empty, &FailedPermanentlyError{Attempts: maxAttempts, LastErr: err}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = errors.New("test error")
+
+func failing(calls *int) func() (int, error) {
+	return func() (int, error) {
+		*calls++
+		return 0, errTest
+	}
+}
+
+func TestRetryBudget_Disabled(t *testing.T) {
+	b := newRetryBudget(0, 0, metrics.NewMetrics())
+
+	calls := 0
+	_, err := retryWithBudget(context.Background(), b, 3, retry.Fixed(time.Millisecond), failing(&calls))
+	require.ErrorIs(t, err, errTest)
+	require.NotErrorIs(t, err, ErrRetryBudgetExhausted)
+	require.Equal(t, 3, calls)
+}
+
+func TestRetryBudget_StopsRetryingWhenExhausted(t *testing.T) {
+	b := newRetryBudget(0.1, 2, metrics.NewMetrics())
+
+	// The burst allows the first failures to be retried
+	calls := 0
+	_, err := retryWithBudget(context.Background(), b, 3, retry.Fixed(time.Millisecond), failing(&calls))
+	require.ErrorIs(t, err, errTest)
+	require.Equal(t, 3, calls)
+
+	// Once the budget is exhausted, failures are no longer retried
+	calls = 0
+	_, err = retryWithBudget(context.Background(), b, 3, retry.Fixed(time.Millisecond), failing(&calls))
+	require.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	require.ErrorIs(t, err, errTest)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetryBudget_RefillsWithRequests(t *testing.T) {
+	b := newRetryBudget(0.5, 1, metrics.NewMetrics())
+	b.tokens = 0
+
+	succeed := func() (int, error) {
+		return 1, nil
+	}
+
+	// Two successful operations deposit enough for a single retry
+	for i := 0; i < 2; i++ {
+		v, err := retryWithBudget(context.Background(), b, 3, retry.Fixed(time.Millisecond), succeed)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+	}
+
+	calls := 0
+	_, err := retryWithBudget(context.Background(), b, 3, retry.Fixed(time.Millisecond), failing(&calls))
+	require.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	// The bucket is capped at a single token, so exactly one retry is allowed
+	require.Equal(t, 2, calls)
+}
+
+func TestRetryBudget_Do2(t *testing.T) {
+	b := newRetryBudget(0.1, 10, metrics.NewMetrics())
+
+	calls := 0
+	a, s, err := retryWithBudget2(context.Background(), b, 3, retry.Fixed(time.Millisecond), func() (int, string, error) {
+		calls++
+		if calls < 2 {
+			return 0, "", errTest
+		}
+		return 1, "one", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, a)
+	require.Equal(t, "one", s)
+}
+
+func TestRetryBudget_FailsPermanently(t *testing.T) {
+	b := newRetryBudget(0, 0, metrics.NewMetrics())
+
+	calls := 0
+	_, err := retryWithBudget(context.Background(), b, 2, retry.Fixed(time.Millisecond), failing(&calls))
+	var failed *FailedPermanentlyError
+	require.ErrorAs(t, err, &failed)
+	require.Equal(t, 2, failed.Attempts)
+	require.ErrorIs(t, err, errTest)
+	require.Equal(t, "operation failed permanently after 2 attempts: test error", err.Error())
+	require.Equal(t, 2, calls)
+}
+
+func TestRetryBudget_ContextEndsWait(t *testing.T) {
+	b := newRetryBudget(0, 0, metrics.NewMetrics())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	calls := 0
+	_, err := retryWithBudget(ctx, b, 3, retry.Fixed(time.Hour), failing(&calls))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, 1, calls)
+}
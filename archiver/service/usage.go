@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// UsageAnomalyDrop is flagged when fewer blocks are stored than at the previous measurement, e.g. after an
+	// accidental deletion
+	UsageAnomalyDrop = "drop"
+	// UsageAnomalyStall is flagged when the number of stored blocks has not grown for the stall window, e.g. when the
+	// archiver is stuck
+	UsageAnomalyStall = "stall"
+	// UsageAnomalySlowGrowth is flagged when storage grows by fewer blocks per hour than expected
+	UsageAnomalySlowGrowth = "slow_growth"
+)
+
+// usageAnomalies are the kinds of anomaly that the usage of storage is checked for.
+var usageAnomalies = []string{UsageAnomalyDrop, UsageAnomalyStall, UsageAnomalySlowGrowth}
+
+// usageSamples is the number of recent measurements that the growth of storage is taken over.
+const usageSamples = 12
+
+// UsageStatus reports the usage of storage as of the last measurement, and any anomalies in it.
+type UsageStatus struct {
+	Objects    int64     `json:"objects"`
+	Bytes      int64     `json:"bytes"`
+	MeasuredAt time.Time `json:"measuredAt"`
+	// GrowthPerHour is the number of blocks stored per hour over the recent measurements
+	GrowthPerHour float64 `json:"growthPerHour"`
+	// Anomalies are the kinds of anomaly flagged by the last measurement, see UsageAnomalyDrop
+	Anomalies []string `json:"anomalies"`
+	// Error is the error of the last measurement if it failed, the other fields are from the last successful one
+	Error string `json:"error,omitempty"`
+}
+
+type usageSample struct {
+	at    time.Time
+	usage storage.Usage
+}
+
+// usageMonitor measures the usage of storage and checks it against the expected trajectory of an archive, which only
+// grows, by about one block per slot. This gives early warning of storage level problems that do not show in the
+// health of individual requests.
+type usageMonitor struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	metrics     metrics.Metricer
+	log         log.Logger
+	stallWindow time.Duration
+	minGrowth   float64
+	samples     []usageSample
+	// grewAt is when the number of stored blocks last grew, or was first measured
+	grewAt    time.Time
+	anomalies []string
+	err       error
+}
+
+// newUsageMonitor returns nil if the usage interval is 0.
+func newUsageMonitor(interval, stallWindow time.Duration, minGrowth float64, m metrics.Metricer, l log.Logger) *usageMonitor {
+	if interval <= 0 {
+		return nil
+	}
+	return &usageMonitor{
+		now:         time.Now,
+		metrics:     m,
+		log:         l,
+		stallWindow: stallWindow,
+		minGrowth:   minGrowth,
+	}
+}
+
+// run measures the usage of storage immediately, then every interval until the context is done or reporter turns
+// out not to support it.
+func (u *usageMonitor) run(ctx context.Context, reporter storage.UsageReporter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.measure(ctx, reporter); errors.Is(err, storage.ErrUsageUnsupported) {
+			u.log.Warn("storage does not report its usage, it will not be monitored")
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// measure measures the usage of storage and records it.
+func (u *usageMonitor) measure(ctx context.Context, reporter storage.UsageReporter) error {
+	start := time.Now()
+	usage, err := reporter.Usage(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			u.log.Error("failed to measure storage usage", "err", err)
+		}
+		u.mu.Lock()
+		u.err = err
+		u.mu.Unlock()
+		return err
+	}
+
+	u.log.Info("measured storage usage", "objects", usage.Objects, "bytes", usage.Bytes, "duration", time.Since(start))
+	u.record(usage)
+	return nil
+}
+
+// record records a measurement of the usage of storage, and flags the anomalies in it.
+func (u *usageMonitor) record(usage storage.Usage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	var anomalies []string
+	if len(u.samples) == 0 || usage.Objects > u.samples[len(u.samples)-1].usage.Objects {
+		u.grewAt = now
+	} else if usage.Objects < u.samples[len(u.samples)-1].usage.Objects {
+		anomalies = append(anomalies, UsageAnomalyDrop)
+	}
+
+	if u.stallWindow > 0 && now.Sub(u.grewAt) >= u.stallWindow {
+		anomalies = append(anomalies, UsageAnomalyStall)
+	}
+
+	u.samples = append(u.samples, usageSample{at: now, usage: usage})
+	if len(u.samples) > usageSamples {
+		u.samples = u.samples[1:]
+	}
+
+	if u.minGrowth > 0 && len(u.samples) > 1 && u.growthPerHour() < u.minGrowth {
+		anomalies = append(anomalies, UsageAnomalySlowGrowth)
+	}
+
+	for _, kind := range anomalies {
+		if !slices.Contains(u.anomalies, kind) {
+			u.log.Warn("anomaly in storage usage", "kind", kind, "objects", usage.Objects, "bytes", usage.Bytes, "growthPerHour", u.growthPerHour())
+		}
+	}
+
+	u.anomalies = anomalies
+	u.err = nil
+
+	u.metrics.RecordStorageUsage(usage.Objects, usage.Bytes)
+	for _, kind := range usageAnomalies {
+		u.metrics.RecordStorageAnomaly(kind, slices.Contains(anomalies, kind))
+	}
+}
+
+// growthPerHour returns the number of blocks stored per hour between the oldest and newest recent measurement. It
+// must be called with the lock held.
+func (u *usageMonitor) growthPerHour() float64 {
+	if len(u.samples) < 2 {
+		return 0
+	}
+
+	first, last := u.samples[0], u.samples[len(u.samples)-1]
+	hours := last.at.Sub(first.at).Hours()
+	if hours <= 0 {
+		return 0
+	}
+	return float64(last.usage.Objects-first.usage.Objects) / hours
+}
+
+func (u *usageMonitor) status() UsageStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	result := UsageStatus{
+		GrowthPerHour: u.growthPerHour(),
+		Anomalies:     append([]string{}, u.anomalies...),
+	}
+	if len(u.samples) > 0 {
+		last := u.samples[len(u.samples)-1]
+		result.Objects = last.usage.Objects
+		result.Bytes = last.usage.Bytes
+		result.MeasuredAt = last.at
+	}
+	if u.err != nil {
+		result.Error = u.err.Error()
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// testUsageMonitor returns a monitor with a stall window of 10 minutes and an expected growth of 100 blocks an hour,
+// and a function that records a measurement a minute after the previous one.
+func testUsageMonitor(t *testing.T, m metrics.Metricer) (*usageMonitor, func(objects int64) []string) {
+	u := newUsageMonitor(time.Minute, 10*time.Minute, 100, m, testlog.Logger(t, log.LvlInfo))
+	now := time.Unix(1_700_000_000, 0)
+	u.now = func() time.Time { return now }
+
+	return u, func(objects int64) []string {
+		u.record(storage.Usage{Objects: objects, Bytes: objects * 1000})
+		now = now.Add(time.Minute)
+		return u.status().Anomalies
+	}
+}
+
+func TestUsageMonitor_Drop(t *testing.T) {
+	u, record := testUsageMonitor(t, metrics.NewMetrics())
+
+	// About one block per 12 second slot is 300 an hour
+	require.Empty(t, record(1000))
+	require.Empty(t, record(1005))
+	require.Empty(t, record(1010))
+
+	// The drop also leaves the recent growth behind the expected minimum
+	require.Equal(t, []string{UsageAnomalyDrop, UsageAnomalySlowGrowth}, record(500))
+	require.Less(t, u.status().GrowthPerHour, float64(0))
+	// A drop is only flagged by the measurement that sees it
+	require.NotContains(t, record(505), UsageAnomalyDrop)
+}
+
+func TestUsageMonitor_Stall(t *testing.T) {
+	m := metrics.NewMetrics()
+	_, record := testUsageMonitor(t, m)
+
+	// The growth falls behind the expected minimum before the lack of it lasts for the stall window
+	require.Empty(t, record(1000))
+	for i := 0; i < 9; i++ {
+		require.Equal(t, []string{UsageAnomalySlowGrowth}, record(1000))
+	}
+	require.Equal(t, []string{UsageAnomalyStall, UsageAnomalySlowGrowth}, record(1000))
+
+	count, err := testutil.GatherAndCount(m.Registry(), "blob_archiver_storage_anomaly")
+	require.NoError(t, err)
+	require.Equal(t, len(usageAnomalies), count)
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(`
+# HELP blob_archiver_storage_objects number of blocks in storage, as of the last usage measurement
+# TYPE blob_archiver_storage_objects gauge
+blob_archiver_storage_objects 1000
+`), "blob_archiver_storage_objects"))
+
+	// Growth clears the stall, and enough of it the slow growth
+	require.Empty(t, record(1500))
+}
+
+func TestUsageMonitor_Disabled(t *testing.T) {
+	require.Nil(t, newUsageMonitor(0, time.Hour, 0, metrics.NewMetrics(), testlog.Logger(t, log.LvlInfo)))
+
+	a, _ := setupAPI(t)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/status", nil))
+	require.Equal(t, 200, response.Code)
+	require.NotContains(t, response.Body.String(), `"usage"`)
+}
+
+func TestUsageStatusHandler(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	m := metrics.NewMetrics()
+	fs := storagetest.NewTestFileStorage(t, logger)
+	archiver, err := NewArchiver(logger, flags.ArchiverConfig{
+		PollInterval:     10 * time.Second,
+		UsageInterval:    time.Hour,
+		UsageStallWindow: time.Hour,
+	}, fs, nil, m)
+	require.NoError(t, err)
+	a := NewAPI(m, logger, archiver)
+
+	sidecars := storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 2))
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.One},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars},
+	})
+	require.NoError(t, fs.WriteEmptyBlob(context.Background(), blobtest.Two))
+
+	require.NoError(t, archiver.usage.measure(context.Background(), fs))
+
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/status", nil))
+	require.Equal(t, 200, response.Code)
+
+	var status StatusResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &status))
+	require.NotNil(t, status.Usage)
+	require.Equal(t, int64(2), status.Usage.Objects)
+	require.Greater(t, status.Usage.Bytes, int64(2*131072))
+	require.Empty(t, status.Usage.Anomalies)
+	require.Empty(t, status.Usage.Error)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxBackfillWALEntries bounds the size of the write-ahead log. Compaction keeps at most one completed entry per
+// backfill process, so this is only reached with an unusually large number of concurrent processes.
+const maxBackfillWALEntries = 100
+
+// walBegin records that the given backfill process is about to persist the blobs for root. It returns true if the
+// block was already in-flight from a previous attempt, in which case any stored data may be a partial write and
+// should be overwritten.
+func (a *Archiver) walBegin(ctx context.Context, process common.Hash, root common.Hash) bool {
+	a.walMu.Lock()
+	defer a.walMu.Unlock()
+
+	for _, entry := range a.wal.Entries {
+		if entry.Process == process && entry.Root == root && !entry.Done {
+			return true
+		}
+	}
+
+	a.wal.Entries = append(a.wal.Entries, storage.BackfillWALEntry{
+		Process: process,
+		Root:    root,
+	})
+	a.writeWAL(ctx)
+	return false
+}
+
+// walComplete marks the block as stored for the given backfill process. Previously completed entries for the process
+// are dropped as the latest completed block is all that's needed to resume.
+func (a *Archiver) walComplete(ctx context.Context, process common.Hash, header *v1.BeaconBlockHeader) {
+	a.walMu.Lock()
+	defer a.walMu.Unlock()
+
+	root := common.Hash(header.Root)
+	entries := make([]storage.BackfillWALEntry, 0, len(a.wal.Entries)+1)
+	for _, entry := range a.wal.Entries {
+		if entry.Process == process && (entry.Done || entry.Root == root) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	entries = append(entries, storage.BackfillWALEntry{
+		Process: process,
+		Root:    root,
+		Done:    true,
+		Header:  header,
+	})
+
+	// Drop the oldest completed entries if the log has grown beyond its bound, in-flight entries are always retained
+	for i := 0; len(entries) > maxBackfillWALEntries && i < len(entries); {
+		if entries[i].Done {
+			entries = append(entries[:i], entries[i+1:]...)
+			continue
+		}
+		i++
+	}
+
+	a.wal.Entries = entries
+	a.writeWAL(ctx)
+}
+
+// walDiscard removes the in-flight entry for root, this is called once a block that the backfill process moved past
+// has been stored by the retry queue.
+func (a *Archiver) walDiscard(ctx context.Context, process common.Hash, root common.Hash) {
+	a.walMu.Lock()
+	defer a.walMu.Unlock()
+
+	entries := make([]storage.BackfillWALEntry, 0, len(a.wal.Entries))
+	for _, entry := range a.wal.Entries {
+		if entry.Process != process || entry.Root != root || entry.Done {
+			entries = append(entries, entry)
+		}
+	}
+
+	a.wal.Entries = entries
+	a.writeWAL(ctx)
+}
+
+// walForget removes all entries for a backfill process, this is called once the process has completed.
+func (a *Archiver) walForget(ctx context.Context, process common.Hash) {
+	a.walMu.Lock()
+	defer a.walMu.Unlock()
+
+	entries := make([]storage.BackfillWALEntry, 0, len(a.wal.Entries))
+	for _, entry := range a.wal.Entries {
+		if entry.Process != process {
+			entries = append(entries, entry)
+		}
+	}
+
+	a.wal.Entries = entries
+	a.writeWAL(ctx)
+}
+
+func (a *Archiver) writeWAL(ctx context.Context) {
+	if err := a.dataStoreClient.WriteBackfillWAL(ctx, a.wal); err != nil {
+		a.log.Error("failed to write backfill_wal", "err", err)
+	}
+}
+
+// replayBackfillWAL loads the write-ahead log left by a previous run of the archiver. Blocks that were in-flight are
+// persisted again, overwriting any partial write, and each backfill process is advanced to the last block the log
+// shows as stored. This means only the in-flight blocks are re-processed rather than everything since the last
+// checkpoint. Entries belonging to processes that no longer exist are discarded.
+func (a *Archiver) replayBackfillWAL(ctx context.Context, processes storage.BackfillProcesses) {
+	wal, err := a.dataStoreClient.ReadBackfillWAL(ctx)
+	if err != nil {
+		a.log.Crit("failed to read backfill_wal", "err", err)
+	}
+
+	a.walMu.Lock()
+	a.wal = storage.BackfillWAL{}
+	for _, entry := range wal.Entries {
+		if _, ok := processes[entry.Process]; ok {
+			a.wal.Entries = append(a.wal.Entries, entry)
+		}
+	}
+	pending := make([]storage.BackfillWALEntry, 0)
+	for _, entry := range a.wal.Entries {
+		if !entry.Done {
+			pending = append(pending, entry)
+		}
+	}
+	a.walMu.Unlock()
+
+	for _, entry := range pending {
+		a.log.Info("replaying in-flight backfill block", "root", entry.Root.String(), "process", entry.Process.String())
+		header, _, err := retryWithBudget2(ctx, a.retryBudget, startupFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
+			return a.persistBlobsForBlockToS3(ctx, entry.Root.String(), true)
+		})
+
+		if err != nil {
+			a.log.Error("failed to replay in-flight backfill block, it will be overwritten when backfill reaches it", "root", entry.Root.String(), "err", err)
+			continue
+		}
+
+		a.walComplete(ctx, entry.Process, header)
+	}
+
+	a.walMu.Lock()
+	defer a.walMu.Unlock()
+
+	for _, entry := range a.wal.Entries {
+		if !entry.Done || entry.Header == nil {
+			continue
+		}
+
+		process := processes[entry.Process]
+		if entry.Header.Header.Message.Slot < process.Current.Header.Message.Slot {
+			a.log.Info("resuming backfill process from write-ahead log",
+				"process", entry.Process.String(),
+				"checkpointSlot", process.Current.Header.Message.Slot,
+				"walSlot", entry.Header.Header.Message.Slot,
+			)
+			process.Current = *entry.Header
+			processes[entry.Process] = process
+		}
+	}
+
+	a.writeWAL(ctx)
+}
@@ -0,0 +1,333 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+
+	// ManifestName is the name of the manifest entry, which is always the last entry in the archive
+	ManifestName = "manifest.json"
+
+	checksumRecord = "BLOBARCHIVER.sha256"
+	slotRecord     = "BLOBARCHIVER.slot"
+)
+
+var (
+	// ErrChecksumMismatch is returned when an entry in the archive does not match its recorded checksum
+	ErrChecksumMismatch = errors.New("archive checksum mismatch")
+	// ErrInvalidArchive is returned when the archive is truncated or contains unexpected entries
+	ErrInvalidArchive = errors.New("invalid archive")
+)
+
+// CompressionForPath returns the compression to use for an archive based on the file extension, e.g. file.tar.zst
+// uses zstd compression.
+func CompressionForPath(path string) Compression {
+	switch {
+	case strings.HasSuffix(path, ".zst"), strings.HasSuffix(path, ".zstd"):
+		return CompressionZstd
+	case strings.HasSuffix(path, ".gz"), strings.HasSuffix(path, ".tgz"):
+		return CompressionGzip
+	default:
+		return CompressionNone
+	}
+}
+
+// ManifestEntry describes a single block stored in the archive.
+type ManifestEntry struct {
+	Slot   uint64      `json:"slot"`
+	Root   common.Hash `json:"root"`
+	Blobs  int         `json:"blobs"`
+	SHA256 string      `json:"sha256"`
+}
+
+// Manifest lists every block stored in the archive, along with the checksum of its entry.
+type Manifest struct {
+	StartSlot uint64          `json:"start_slot"`
+	EndSlot   uint64          `json:"end_slot"`
+	Blocks    []ManifestEntry `json:"blocks"`
+}
+
+// Entry is a single block read from the archive.
+type Entry struct {
+	Slot uint64
+	Data storage.BlobData
+}
+
+// Checksum returns the checksum of a block, as recorded in the manifest.
+func Checksum(data storage.BlobData) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode block %s: %w", data.Header.BeaconBlockHash, err)
+	}
+	return checksum(b), nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func entryName(root common.Hash) string {
+	return root.String() + ".json"
+}
+
+// Writer streams blocks into a tar archive. Each block is stored as its own entry, encoded in the same format as the
+// data stores, so only a single block needs to be held in memory at a time. The manifest is written when the writer
+// is closed.
+type Writer struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+	manifest   Manifest
+}
+
+// NewWriter creates a Writer for the slot range [start, end] that writes to w using the given compression.
+func NewWriter(w io.Writer, compression Compression, start, end uint64) (*Writer, error) {
+	result := &Writer{
+		manifest: Manifest{
+			StartSlot: start,
+			EndSlot:   end,
+			Blocks:    make([]ManifestEntry, 0),
+		},
+	}
+
+	switch compression {
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		result.compressor = enc
+		w = enc
+	case CompressionGzip:
+		gz := gzip.NewWriter(w)
+		result.compressor = gz
+		w = gz
+	}
+
+	result.tw = tar.NewWriter(w)
+	return result, nil
+}
+
+// Add writes a block to the archive.
+func (w *Writer) Add(slot uint64, data storage.BlobData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode block %s: %w", data.Header.BeaconBlockHash, err)
+	}
+
+	entry := ManifestEntry{
+		Slot:   slot,
+		Root:   data.Header.BeaconBlockHash,
+		Blobs:  len(data.BlobSidecars.Data),
+		SHA256: checksum(b),
+	}
+
+	if err := WriteFile(w.tw, entryName(entry.Root), b, map[string]string{
+		checksumRecord: entry.SHA256,
+		slotRecord:     strconv.FormatUint(slot, 10),
+	}); err != nil {
+		return err
+	}
+
+	w.manifest.Blocks = append(w.manifest.Blocks, entry)
+	return nil
+}
+
+// Manifest returns the manifest of the blocks written so far.
+func (w *Writer) Manifest() Manifest {
+	return w.manifest
+}
+
+// Close writes the manifest and flushes the archive. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := WriteManifest(w.tw, w.manifest); err != nil {
+		return err
+	}
+
+	if err := w.tw.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+
+	if w.compressor != nil {
+		if err := w.compressor.Close(); err != nil {
+			return fmt.Errorf("failed to close compressor: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// WriteManifest writes the manifest to tw as the entry ManifestName, which must be the last entry of the archive. It is
+// written by Writer, and by other exports that list the blocks they hold in the same way.
+func WriteManifest(tw *tar.Writer, manifest Manifest) error {
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	return WriteFile(tw, ManifestName, b, nil)
+}
+
+// WriteFile writes b to tw as a regular file entry, with the given PAX records in its header.
+func WriteFile(tw *tar.Writer, name string, b []byte, records map[string]string) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Size:       int64(len(b)),
+		Mode:       0644,
+		ModTime:    time.Now().UTC().Truncate(time.Second),
+		Format:     tar.FormatPAX,
+		PAXRecords: records,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write header for %s: %w", name, err)
+	}
+
+	if _, err := tw.Write(b); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Reader streams blocks from an archive created by Writer, verifying the checksum of every entry as it is read.
+type Reader struct {
+	tr           *tar.Reader
+	decompressor io.Closer
+	seen         map[common.Hash]string
+	manifest     *Manifest
+}
+
+// NewReader creates a Reader from r, which must use the given compression.
+func NewReader(r io.Reader, compression Compression) (*Reader, error) {
+	result := &Reader{
+		seen: make(map[common.Hash]string),
+	}
+
+	switch compression {
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		result.decompressor = dec.IOReadCloser()
+		r = dec
+	case CompressionGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		result.decompressor = gz
+		r = gz
+	}
+
+	result.tr = tar.NewReader(r)
+	return result, nil
+}
+
+// Next returns the next block in the archive. Once every block has been read it verifies the manifest and returns
+// io.EOF. An error wrapping ErrChecksumMismatch or ErrInvalidArchive is returned if the archive is corrupt.
+func (r *Reader) Next() (Entry, error) {
+	if r.manifest != nil {
+		return Entry{}, io.EOF
+	}
+
+	header, err := r.tr.Next()
+	if err == io.EOF {
+		return Entry{}, fmt.Errorf("%w: archive is missing a manifest", ErrInvalidArchive)
+	} else if err != nil {
+		return Entry{}, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	b, err := io.ReadAll(r.tr)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to read %s: %w", header.Name, err)
+	}
+
+	if header.Name == ManifestName {
+		return Entry{}, r.verifyManifest(b)
+	}
+
+	actual := checksum(b)
+	if expected := header.PAXRecords[checksumRecord]; expected != actual {
+		return Entry{}, fmt.Errorf("%w: %s expected %s got %s", ErrChecksumMismatch, header.Name, expected, actual)
+	}
+
+	slot, err := strconv.ParseUint(header.PAXRecords[slotRecord], 10, 64)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%w: invalid slot for %s", ErrInvalidArchive, header.Name)
+	}
+
+	var data storage.BlobData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return Entry{}, fmt.Errorf("%w: failed to decode %s: %v", ErrInvalidArchive, header.Name, err)
+	}
+
+	if header.Name != entryName(data.Header.BeaconBlockHash) {
+		return Entry{}, fmt.Errorf("%w: %s contains block %s", ErrInvalidArchive, header.Name, data.Header.BeaconBlockHash)
+	}
+
+	r.seen[data.Header.BeaconBlockHash] = actual
+	return Entry{Slot: slot, Data: data}, nil
+}
+
+// Manifest returns the manifest of the archive, this is only available once Next has returned io.EOF.
+func (r *Reader) Manifest() (Manifest, bool) {
+	if r.manifest == nil {
+		return Manifest{}, false
+	}
+	return *r.manifest, true
+}
+
+// Close releases any resources held by the decompressor. It does not close the underlying reader.
+func (r *Reader) Close() error {
+	if r.decompressor != nil {
+		return r.decompressor.Close()
+	}
+	return nil
+}
+
+func (r *Reader) verifyManifest(b []byte) error {
+	var manifest Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return fmt.Errorf("%w: failed to decode manifest: %v", ErrInvalidArchive, err)
+	}
+
+	if len(manifest.Blocks) != len(r.seen) {
+		return fmt.Errorf("%w: manifest lists %d blocks, archive contains %d", ErrInvalidArchive, len(manifest.Blocks), len(r.seen))
+	}
+
+	for _, block := range manifest.Blocks {
+		checksum, ok := r.seen[block.Root]
+		if !ok {
+			return fmt.Errorf("%w: block %s is missing from the archive", ErrInvalidArchive, block.Root)
+		}
+
+		if checksum != block.SHA256 {
+			return fmt.Errorf("%w: %s manifest has %s got %s", ErrChecksumMismatch, block.Root, block.SHA256, checksum)
+		}
+	}
+
+	r.manifest = &manifest
+	return io.EOF
+}
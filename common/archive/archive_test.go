@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func newBlock(t *testing.T, root [32]byte, blobs uint) storage.BlobData {
+	return storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: root,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, blobs)),
+		},
+	}
+}
+
+func TestCompressionForPath(t *testing.T) {
+	require.Equal(t, CompressionZstd, CompressionForPath("blobs.tar.zst"))
+	require.Equal(t, CompressionGzip, CompressionForPath("blobs.tar.gz"))
+	require.Equal(t, CompressionNone, CompressionForPath("blobs.tar"))
+}
+
+func TestRoundTrip(t *testing.T) {
+	blocks := []storage.BlobData{
+		newBlock(t, blobtest.One, 2),
+		newBlock(t, blobtest.Two, 0),
+		newBlock(t, blobtest.Three, 3),
+	}
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, compression, 10, 12)
+			require.NoError(t, err)
+
+			for i, block := range blocks {
+				require.NoError(t, w.Add(uint64(10+i), block))
+			}
+			require.NoError(t, w.Close())
+
+			r, err := NewReader(&buf, compression)
+			require.NoError(t, err)
+			defer r.Close()
+
+			for i, block := range blocks {
+				entry, err := r.Next()
+				require.NoError(t, err)
+				require.Equal(t, uint64(10+i), entry.Slot)
+				require.Equal(t, block, entry.Data)
+			}
+
+			_, err = r.Next()
+			require.ErrorIs(t, err, io.EOF)
+
+			manifest, ok := r.Manifest()
+			require.True(t, ok)
+			require.Equal(t, w.Manifest(), manifest)
+			require.Equal(t, uint64(10), manifest.StartSlot)
+			require.Equal(t, uint64(12), manifest.EndSlot)
+			require.Len(t, manifest.Blocks, 3)
+			require.Equal(t, 3, manifest.Blocks[2].Blobs)
+		})
+	}
+}
+
+func TestCorruptEntry(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, CompressionNone, 10, 10)
+	require.NoError(t, err)
+	require.NoError(t, w.Add(10, newBlock(t, blobtest.One, 1)))
+	require.NoError(t, w.Close())
+
+	// Flip a byte of the blob data, which is soon after the tar header
+	data := buf.Bytes()
+	idx := bytes.Index(data, []byte(`"blob":"0x`))
+	require.Greater(t, idx, 0)
+	data[idx+12] ^= 0x01
+
+	r, err := NewReader(bytes.NewReader(data), CompressionNone)
+	require.NoError(t, err)
+
+	_, err = r.Next()
+	require.True(t, errors.Is(err, ErrChecksumMismatch))
+}
+
+func TestTruncatedArchive(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, CompressionNone, 10, 11)
+	require.NoError(t, err)
+	require.NoError(t, w.Add(10, newBlock(t, blobtest.One, 1)))
+	// The manifest is never written
+	require.NoError(t, w.tw.Flush())
+
+	r, err := NewReader(&buf, CompressionNone)
+	require.NoError(t, err)
+
+	_, err = r.Next()
+	require.NoError(t, err)
+
+	_, err = r.Next()
+	require.True(t, errors.Is(err, ErrInvalidArchive))
+}
@@ -2,28 +2,131 @@ package beacon
 
 import (
 	"context"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"sync"
+	"time"
 
 	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
 	"github.com/attestantio/go-eth2-client/http"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/forks"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/rs/zerolog"
 )
 
+// SSZMaxBlobSidecars is the most blob sidecars that go-eth2-client decodes from an SSZ response, the list limit of its
+// api.BlobSidecars, which is the MAX_BLOBS_PER_BLOCK of deneb. The SSZ responses for blocks of later forks that have
+// more blobs fail to decode, so they must be fetched in JSON, see JSONBlobSidecarsProvider.
+const SSZMaxBlobSidecars = forks.DenebMaxBlobsPerBlock
+
 // Client is an interface that wraps the go-eth-2 interfaces that the blob archiver and api require.
 type Client interface {
 	client.BeaconBlockHeadersProvider
 	client.BlobSidecarsProvider
 }
 
-// NewBeaconClient returns a new HTTP beacon client.
+// JSONBlobSidecarsProvider is implemented by clients that can fetch blob sidecars in JSON, whichever format they
+// otherwise request, so that blocks with more blobs than SSZMaxBlobSidecars can be fetched.
+type JSONBlobSidecarsProvider interface {
+	JSONBlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error)
+}
+
+// service is a go-eth2-client HTTP service that also fetches blob sidecars in JSON, with a second service that is
+// created the first time it is needed. Requests that go-eth2-client does not support, such as for data column
+// sidecars, are sent with client, which is configured as the client of the go-eth2-client service is.
+type service struct {
+	*http.Service
+	cfg    flags.BeaconConfig
+	url    string
+	client *nethttp.Client
+
+	mu   sync.Mutex
+	json *http.Service
+}
+
+// NewBeaconClient returns a new HTTP beacon client. When several beacon node URLs are configured, requests fail over
+// between them, see failoverClient.
 func NewBeaconClient(ctx context.Context, cfg flags.BeaconConfig) (Client, error) {
+	urls := cfg.BeaconURLs()
+	if len(urls) == 1 {
+		return newService(ctx, cfg, urls[0])
+	}
+
+	var endpoints []endpoint
+	for _, u := range urls {
+		s, err := newService(ctx, cfg, u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for beacon node %s: %w", endpointName(u), err)
+		}
+		endpoints = append(endpoints, endpoint{name: endpointName(u), client: s})
+	}
+	return newFailoverClient(endpoints, int(cfg.Quorum), log.New("component", "beacon")), nil
+}
+
+func newService(ctx context.Context, cfg flags.BeaconConfig, url string) (*service, error) {
+	c, err := newHTTPService(ctx, cfg, url)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &service{Service: c, cfg: cfg, url: url, client: newHTTPClient(cfg)}
+	if cfg.EnforceJSON {
+		s.json = c
+	}
+	return s, nil
+}
+
+// newHTTPClient returns the HTTP client of the requests that a service sends itself. Its transport has the dial timeout
+// and connection limits of the client that go-eth2-client creates, which it does not expose, and each request is sent
+// with the configured timeout.
+func newHTTPClient(cfg flags.BeaconConfig) *nethttp.Client {
+	return &nethttp.Client{
+		Transport: &nethttp.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   cfg.BeaconClientTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        64,
+			MaxConnsPerHost:     64,
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     600 * time.Second,
+		},
+		Timeout: cfg.BeaconClientTimeout,
+	}
+}
+
+func newHTTPService(ctx context.Context, cfg flags.BeaconConfig, url string) (*http.Service, error) {
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	c, err := http.New(cctx, http.WithAddress(cfg.BeaconURL), http.WithTimeout(cfg.BeaconClientTimeout), http.WithEnforceJSON(cfg.EnforceJSON), http.WithLogLevel(zerolog.ErrorLevel))
+	c, err := http.New(cctx, http.WithAddress(url), http.WithTimeout(cfg.BeaconClientTimeout), http.WithEnforceJSON(cfg.EnforceJSON), http.WithLogLevel(zerolog.ErrorLevel))
 	if err != nil {
 		return nil, err
 	}
 
 	return c.(*http.Service), nil
 }
+
+// JSONBlobSidecars fetches blob sidecars in JSON. If JSON is not already enforced, a service that enforces it is
+// created on the first call, and again on the next call if that fails.
+func (s *service) JSONBlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	s.mu.Lock()
+	if s.json == nil {
+		cfg := s.cfg
+		cfg.EnforceJSON = true
+		c, err := newHTTPService(ctx, cfg, s.url)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.json = c
+	}
+	json := s.json
+	s.mu.Unlock()
+
+	return json.BlobSidecars(ctx, opts)
+}
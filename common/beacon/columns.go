@@ -0,0 +1,90 @@
+package beacon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// DataColumnSidecarsOpts are the options of a request for the data column sidecars of a block.
+type DataColumnSidecarsOpts struct {
+	// Block is the block ID, as for api.BlobSidecarsOpts
+	Block string
+	// Indices are the indices of the columns to fetch, every column that the beacon node has if empty
+	Indices []uint64
+}
+
+// DataColumnSidecarsProvider is implemented by clients that can fetch the data column sidecars of blocks from fulu on,
+// which go-eth2-client does not support yet.
+type DataColumnSidecarsProvider interface {
+	DataColumnSidecars(ctx context.Context, opts *DataColumnSidecarsOpts) (*api.Response[[]*storage.DataColumnSidecar], error)
+}
+
+// dataColumnSidecarsResponse is the JSON response of the data column sidecars endpoint of the beacon API.
+type dataColumnSidecarsResponse struct {
+	Version string                       `json:"version"`
+	Data    []*storage.DataColumnSidecar `json:"data"`
+}
+
+// DataColumnSidecars fetches the data column sidecars of a block in JSON from the debug endpoint of the beacon API. A
+// block that the node does not have, or has no columns for, returns an api.Error with the status of the response.
+func (s *service) DataColumnSidecars(ctx context.Context, opts *DataColumnSidecarsOpts) (*api.Response[[]*storage.DataColumnSidecar], error) {
+	if opts == nil || opts.Block == "" {
+		return nil, fmt.Errorf("no block specified")
+	}
+
+	url := strings.TrimSuffix(s.url, "/") + "/eth/v1/debug/beacon/data_column_sidecars/" + opts.Block
+	if len(opts.Indices) > 0 {
+		indices := make([]string, len(opts.Indices))
+		for i, index := range opts.Indices {
+			indices[i] = strconv.FormatUint(index, 10)
+		}
+		url += "?indices=" + strings.Join(indices, ",")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.BeaconClientTimeout)
+	defer cancel()
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data column sidecars: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data column sidecars: %w", err)
+	}
+
+	if resp.StatusCode != nethttp.StatusOK {
+		return nil, &api.Error{
+			Method:     nethttp.MethodGet,
+			Endpoint:   req.URL.Path,
+			StatusCode: resp.StatusCode,
+			Data:       body,
+		}
+	}
+
+	var decoded dataColumnSidecarsResponse
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode data column sidecars: %w", err)
+	}
+
+	return &api.Response[[]*storage.DataColumnSidecar]{
+		Data:     decoded.Data,
+		Metadata: map[string]any{"version": decoded.Version},
+	}, nil
+}
@@ -0,0 +1,100 @@
+package beacon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+// columnsClient serves the given data column sidecars for every block.
+type columnsClient struct {
+	Client
+	columns []*storage.DataColumnSidecar
+	err     error
+}
+
+func (c *columnsClient) DataColumnSidecars(ctx context.Context, opts *DataColumnSidecarsOpts) (*api.Response[[]*storage.DataColumnSidecar], error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &api.Response[[]*storage.DataColumnSidecar]{Data: c.columns}, nil
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	http.RoundTripper
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.RoundTripper.RoundTrip(req)
+}
+
+func TestService_DataColumnSidecars(t *testing.T) {
+	columns := storagetest.NewDataColumnSidecars(t, 2, 3, 9)
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eth/v1/debug/beacon/data_column_sidecars/head" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"message":"block not found"}`))
+			return
+		}
+		query = r.URL.RawQuery
+		_ = json.NewEncoder(w).Encode(dataColumnSidecarsResponse{Version: "fulu", Data: columns})
+	}))
+	defer srv.Close()
+
+	cfg := flags.BeaconConfig{BeaconClientTimeout: time.Second}
+	transport := &countingTransport{RoundTripper: srv.Client().Transport}
+	s := &service{cfg: cfg, url: srv.URL + "/", client: &http.Client{Transport: transport}}
+	response, err := s.DataColumnSidecars(context.Background(), &DataColumnSidecarsOpts{Block: "head", Indices: []uint64{3, 9}})
+	require.NoError(t, err)
+	require.Equal(t, columns, response.Data)
+	require.Equal(t, "fulu", response.Metadata["version"])
+	require.Equal(t, "indices=3,9", query)
+	require.Equal(t, 1, transport.requests, "requests must be sent with the client of the service")
+
+	_, err = s.DataColumnSidecars(context.Background(), &DataColumnSidecarsOpts{Block: "0x01"})
+	var apiErr *api.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Contains(t, string(apiErr.Data), "block not found")
+}
+
+func TestFailoverClient_DataColumnSidecars(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	honest := &columnsClient{Client: stub, columns: storagetest.NewDataColumnSidecars(t, 1, 0, 1)}
+	faulty := &columnsClient{Client: stub, columns: storagetest.NewDataColumnSidecars(t, 1, 0, 1)}
+	opts := &DataColumnSidecarsOpts{Block: "head"}
+
+	c := newTestFailoverClient(t, 1, &columnsClient{Client: stub, err: unavailable}, honest)
+	response, err := c.DataColumnSidecars(context.Background(), opts)
+	require.NoError(t, err)
+	require.Equal(t, honest.columns, response.Data)
+
+	// Data column sidecars are voted on like blob sidecars
+	c = newTestFailoverClient(t, 2, faulty, honest, honest)
+	response, err = c.DataColumnSidecars(context.Background(), opts)
+	require.NoError(t, err)
+	require.Equal(t, honest.columns, response.Data)
+
+	c = newTestFailoverClient(t, 2, faulty, honest, &columnsClient{Client: stub, err: errors.New("connection refused")})
+	_, err = c.DataColumnSidecars(context.Background(), opts)
+	require.ErrorIs(t, err, ErrNoQuorum)
+
+	c = newTestFailoverClient(t, 1, stub)
+	_, err = c.DataColumnSidecars(context.Background(), opts)
+	require.ErrorContains(t, err, "does not provide DataColumnSidecars")
+}
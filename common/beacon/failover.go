@@ -0,0 +1,286 @@
+package beacon
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrNoQuorum is returned when fewer beacon nodes than the quorum return the same blob sidecars for a block.
+var ErrNoQuorum = errors.New("beacon nodes did not agree on the blob sidecars")
+
+// endpoint is one of the beacon nodes of a failoverClient, named by its host so that credentials in the URL are not
+// logged.
+type endpoint struct {
+	name   string
+	client Client
+}
+
+// failoverClient sends each request to the beacon node that last answered one, and fails over to the others in turn
+// when it fails, e.g. with a 503 or because the node is behind and does not have the block yet. The head is taken
+// from whichever node is furthest ahead. With a quorum above 1, sidecars are fetched from every node and only
+// returned once that many nodes returned identical sidecars, so that a single faulty node cannot poison the archive.
+type failoverClient struct {
+	endpoints []endpoint
+	quorum    int
+	log       log.Logger
+
+	preferred atomic.Int32
+}
+
+func newFailoverClient(endpoints []endpoint, quorum int, l log.Logger) *failoverClient {
+	return &failoverClient{endpoints: endpoints, quorum: quorum, log: l}
+}
+
+// endpointName returns the host of the beacon node URL.
+func endpointName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// failover calls each beacon node in turn, starting from the preferred one, until a call succeeds. If every call
+// fails, the error of the preferred node is returned.
+func failover[T any](ctx context.Context, c *failoverClient, method string, call func(Client) (T, error)) (T, error) {
+	start := int(c.preferred.Load())
+	var first error
+	for i := range c.endpoints {
+		index := (start + i) % len(c.endpoints)
+		e := c.endpoints[index]
+
+		result, err := call(e.client)
+		if err == nil {
+			if index != start && c.preferred.CompareAndSwap(int32(start), int32(index)) {
+				c.log.Warn("failed over to another beacon node", "method", method, "node", e.name, "previous", c.endpoints[start].name)
+			}
+			return result, nil
+		}
+
+		c.log.Debug("beacon node request failed", "method", method, "node", e.name, "err", err)
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	var zero T
+	return zero, first
+}
+
+// unsupported returns the error for a beacon node client that does not provide the given method.
+func unsupported(method string) error {
+	return fmt.Errorf("beacon node client does not provide %s", method)
+}
+
+func (c *failoverClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if opts.Block == "head" {
+		return c.highestHead(ctx, opts)
+	}
+	return failover(ctx, c, "BeaconBlockHeader", func(b Client) (*api.Response[*v1.BeaconBlockHeader], error) {
+		return b.BeaconBlockHeader(ctx, opts)
+	})
+}
+
+// highestHead returns the head header of the beacon node that is furthest ahead, so that a node which has fallen
+// behind does not hold back the archiver. If every node fails, the error of the first is returned.
+func (c *failoverClient) highestHead(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	responses, errs := fetchAll(ctx, c, func(ctx context.Context, b Client) (*api.Response[*v1.BeaconBlockHeader], error) {
+		return b.BeaconBlockHeader(ctx, opts)
+	})
+
+	var result *api.Response[*v1.BeaconBlockHeader]
+	for _, response := range responses {
+		if response == nil || response.Data == nil || response.Data.Header == nil || response.Data.Header.Message == nil {
+			continue
+		}
+		if result == nil || response.Data.Header.Message.Slot > result.Data.Header.Message.Slot {
+			result = response
+		}
+	}
+	if result == nil {
+		return nil, firstError(errs)
+	}
+	return result, nil
+}
+
+func (c *failoverClient) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	return sidecars(ctx, c, "BlobSidecars", func(ctx context.Context, b Client) (*api.Response[[]*deneb.BlobSidecar], error) {
+		return b.BlobSidecars(ctx, opts)
+	})
+}
+
+func (c *failoverClient) JSONBlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	return sidecars(ctx, c, "JSONBlobSidecars", func(ctx context.Context, b Client) (*api.Response[[]*deneb.BlobSidecar], error) {
+		if p, ok := b.(JSONBlobSidecarsProvider); ok {
+			return p.JSONBlobSidecars(ctx, opts)
+		}
+		return nil, unsupported("JSONBlobSidecars")
+	})
+}
+
+func (c *failoverClient) DataColumnSidecars(ctx context.Context, opts *DataColumnSidecarsOpts) (*api.Response[[]*storage.DataColumnSidecar], error) {
+	return sidecars(ctx, c, "DataColumnSidecars", func(ctx context.Context, b Client) (*api.Response[[]*storage.DataColumnSidecar], error) {
+		if p, ok := b.(DataColumnSidecarsProvider); ok {
+			return p.DataColumnSidecars(ctx, opts)
+		}
+		return nil, unsupported("DataColumnSidecars")
+	})
+}
+
+// sidecar is a blob or data column sidecar, which responses are compared by the hash tree roots of.
+type sidecar interface {
+	HashTreeRoot() ([32]byte, error)
+}
+
+// sidecars fetches blob or data column sidecars with failover, or from every beacon node when a quorum is required.
+func sidecars[T sidecar](ctx context.Context, c *failoverClient, method string, call func(context.Context, Client) (*api.Response[[]T], error)) (*api.Response[[]T], error) {
+	if c.quorum <= 1 {
+		return failover(ctx, c, method, func(b Client) (*api.Response[[]T], error) {
+			return call(ctx, b)
+		})
+	}
+
+	type result struct {
+		index    int
+		response *api.Response[[]T]
+		err      error
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(c.endpoints))
+	for i, e := range c.endpoints {
+		go func(i int, b Client) {
+			response, err := call(cctx, b)
+			results <- result{i, response, err}
+		}(i, e.client)
+	}
+
+	// Agreeing responses have identical sidecars, so whichever reaches the quorum first is returned. If none does, the
+	// error of the first node in order is returned, regardless of which node answered first
+	votes := make(map[[32]byte]int)
+	errs := make([]error, len(c.endpoints))
+	agreed := 0
+	for range c.endpoints {
+		r := <-results
+		if r.err == nil {
+			var digest [32]byte
+			if digest, r.err = sidecarsDigest(r.response); r.err == nil {
+				votes[digest]++
+				agreed = max(agreed, votes[digest])
+				if votes[digest] >= c.quorum {
+					return r.response, nil
+				}
+				continue
+			}
+		}
+
+		c.log.Debug("beacon node request failed", "method", method, "node", c.endpoints[r.index].name, "err", r.err)
+		errs[r.index] = r.err
+	}
+
+	if agreed == 0 {
+		return nil, firstError(errs)
+	}
+	c.log.Warn("beacon nodes did not agree on the blob sidecars", "method", method, "agreed", agreed, "quorum", c.quorum, "nodes", len(c.endpoints))
+	return nil, fmt.Errorf("%w: at most %d of %d nodes returned the same sidecars, %d required", ErrNoQuorum, agreed, len(c.endpoints), c.quorum)
+}
+
+// sidecarsDigest returns a digest of the hash tree roots of the sidecars of a response, identical for responses with
+// identical sidecars.
+func sidecarsDigest[T sidecar](response *api.Response[[]T]) ([32]byte, error) {
+	if response == nil {
+		return [32]byte{}, errors.New("no response")
+	}
+
+	h := sha256.New()
+	for _, sidecar := range response.Data {
+		root, err := sidecar.HashTreeRoot()
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("failed to hash sidecar: %w", err)
+		}
+		h.Write(root[:])
+	}
+
+	var digest [32]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, nil
+}
+
+// fetchAll calls every beacon node concurrently, returning the response and error of each in the order of the nodes.
+func fetchAll[T any](ctx context.Context, c *failoverClient, call func(context.Context, Client) (T, error)) ([]T, []error) {
+	responses := make([]T, len(c.endpoints))
+	errs := make([]error, len(c.endpoints))
+	done := make(chan struct{}, len(c.endpoints))
+	for i, e := range c.endpoints {
+		go func(i int, b Client) {
+			responses[i], errs[i] = call(ctx, b)
+			done <- struct{}{}
+		}(i, e.client)
+	}
+	for range c.endpoints {
+		<-done
+	}
+	return responses, errs
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *failoverClient) Spec(ctx context.Context, opts *api.SpecOpts) (*api.Response[map[string]any], error) {
+	return failover(ctx, c, "Spec", func(b Client) (*api.Response[map[string]any], error) {
+		if p, ok := b.(client.SpecProvider); ok {
+			return p.Spec(ctx, opts)
+		}
+		return nil, unsupported("Spec")
+	})
+}
+
+func (c *failoverClient) Genesis(ctx context.Context, opts *api.GenesisOpts) (*api.Response[*v1.Genesis], error) {
+	return failover(ctx, c, "Genesis", func(b Client) (*api.Response[*v1.Genesis], error) {
+		if p, ok := b.(client.GenesisProvider); ok {
+			return p.Genesis(ctx, opts)
+		}
+		return nil, unsupported("Genesis")
+	})
+}
+
+func (c *failoverClient) Fork(ctx context.Context, opts *api.ForkOpts) (*api.Response[*phase0.Fork], error) {
+	return failover(ctx, c, "Fork", func(b Client) (*api.Response[*phase0.Fork], error) {
+		if p, ok := b.(client.ForkProvider); ok {
+			return p.Fork(ctx, opts)
+		}
+		return nil, unsupported("Fork")
+	})
+}
+
+func (c *failoverClient) SignedBeaconBlock(ctx context.Context, opts *api.SignedBeaconBlockOpts) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+	return failover(ctx, c, "SignedBeaconBlock", func(b Client) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+		if p, ok := b.(client.SignedBeaconBlockProvider); ok {
+			return p.SignedBeaconBlock(ctx, opts)
+		}
+		return nil, unsupported("SignedBeaconBlock")
+	})
+}
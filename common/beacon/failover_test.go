@@ -0,0 +1,147 @@
+package beacon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// faultyClient returns err from every request while it is set, and counts the requests made to it.
+type faultyClient struct {
+	Client
+	err   error
+	calls atomic.Int32
+}
+
+func (f *faultyClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Client.BeaconBlockHeader(ctx, opts)
+}
+
+func (f *faultyClient) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Client.BlobSidecars(ctx, opts)
+}
+
+func newTestFailoverClient(t *testing.T, quorum int, clients ...Client) *failoverClient {
+	var endpoints []endpoint
+	for i, c := range clients {
+		endpoints = append(endpoints, endpoint{name: string(rune('a' + i)), client: c})
+	}
+	return newFailoverClient(endpoints, quorum, testlog.Logger(t, log.LvlInfo))
+}
+
+var unavailable = &api.Error{StatusCode: http.StatusServiceUnavailable, Method: http.MethodGet, Endpoint: "/eth/v1/beacon/headers"}
+
+func TestFailoverClient_FailsOver(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	first := &faultyClient{Client: stub, err: unavailable}
+	second := &faultyClient{Client: stub}
+	c := newTestFailoverClient(t, 1, first, second)
+
+	header, err := c.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{Block: blobtest.Three.String()})
+	require.NoError(t, err)
+	require.Equal(t, stub.Headers[blobtest.Three.String()], header.Data)
+
+	// The node that answered keeps being used while it is healthy
+	sidecars, err := c.BlobSidecars(context.Background(), &api.BlobSidecarsOpts{Block: blobtest.Three.String()})
+	require.NoError(t, err)
+	require.Equal(t, stub.Blobs[blobtest.Three.String()], sidecars.Data)
+	require.EqualValues(t, 1, first.calls.Load())
+	require.EqualValues(t, 2, second.calls.Load())
+
+	// And is failed over from in turn
+	first.err = nil
+	second.err = unavailable
+	_, err = c.BlobSidecars(context.Background(), &api.BlobSidecarsOpts{Block: blobtest.Three.String()})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, first.calls.Load())
+}
+
+func TestFailoverClient_AllFail(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	notFound := &api.Error{StatusCode: http.StatusNotFound}
+	c := newTestFailoverClient(t, 1, &faultyClient{Client: stub, err: notFound}, &faultyClient{Client: stub, err: unavailable})
+
+	// The error of the preferred node is returned, so that a 404 is still recognised
+	_, err := c.BlobSidecars(context.Background(), &api.BlobSidecarsOpts{Block: blobtest.Three.String()})
+	var apiErr *api.Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestFailoverClient_HighestHead(t *testing.T) {
+	ahead := beacontest.NewDefaultStubBeaconClient(t)
+	behind := beacontest.NewDefaultStubBeaconClient(t)
+	behind.Headers["head"] = behind.Headers[blobtest.Three.String()]
+
+	c := newTestFailoverClient(t, 1, behind, &faultyClient{Client: ahead, err: unavailable}, ahead)
+	header, err := c.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{Block: "head"})
+	require.NoError(t, err)
+	require.Equal(t, ahead.Headers["head"], header.Data)
+
+	c = newTestFailoverClient(t, 1, &faultyClient{Client: ahead, err: unavailable})
+	_, err = c.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{Block: "head"})
+	require.ErrorIs(t, err, unavailable)
+}
+
+func TestFailoverClient_Quorum(t *testing.T) {
+	honest := beacontest.NewDefaultStubBeaconClient(t)
+	faulty := beacontest.NewDefaultStubBeaconClient(t)
+	faulty.Blobs[blobtest.Three.String()] = blobtest.NewBlobSidecars(t, 4)
+	opts := &api.BlobSidecarsOpts{Block: blobtest.Three.String()}
+
+	// A single faulty node is outvoted
+	c := newTestFailoverClient(t, 2, faulty, honest, honest)
+	sidecars, err := c.BlobSidecars(context.Background(), opts)
+	require.NoError(t, err)
+	require.Equal(t, honest.Blobs[blobtest.Three.String()], sidecars.Data)
+
+	// But nothing is returned when not enough nodes agree
+	c = newTestFailoverClient(t, 2, faulty, honest, &faultyClient{Client: honest, err: unavailable})
+	_, err = c.BlobSidecars(context.Background(), opts)
+	require.ErrorIs(t, err, ErrNoQuorum)
+
+	c = newTestFailoverClient(t, 3, honest, honest, honest)
+	_, err = c.JSONBlobSidecars(context.Background(), opts)
+	require.ErrorContains(t, err, "does not provide JSONBlobSidecars")
+
+	// If no node answers, the error of the first is returned
+	c = newTestFailoverClient(t, 2, &faultyClient{Client: honest, err: unavailable}, &faultyClient{Client: honest, err: errors.New("connection refused")})
+	_, err = c.BlobSidecars(context.Background(), opts)
+	require.ErrorIs(t, err, unavailable)
+}
+
+func TestFailoverClient_Unsupported(t *testing.T) {
+	c := newTestFailoverClient(t, 1, beacontest.NewDefaultStubBeaconClient(t))
+	_, err := c.Spec(context.Background(), &api.SpecOpts{})
+	require.ErrorContains(t, err, "does not provide Spec")
+}
+
+func TestBeaconConfig_URLs(t *testing.T) {
+	cfg := flags.BeaconConfig{BeaconURL: "http://a:5052, https://user:secret@b:5052", BeaconClientTimeout: 1, Quorum: 2}
+	require.NoError(t, cfg.Check())
+	require.Equal(t, []string{"http://a:5052", "https://user:secret@b:5052"}, cfg.BeaconURLs())
+	require.Equal(t, "b:5052", endpointName(cfg.BeaconURLs()[1]))
+
+	cfg.Quorum = 3
+	require.ErrorContains(t, cfg.Check(), "beacon quorum of 3 is more than the 2 beacon nodes configured")
+}
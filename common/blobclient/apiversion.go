@@ -0,0 +1,40 @@
+package blobclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// APIVersionV1 is the version of the blob sidecars endpoint, /eth/v1/beacon/blob_sidecars, that beacon nodes and the
+	// blob API serve today. It is the default.
+	APIVersionV1 = "v1"
+	// APIVersionV2 is the version of a future /eth/v2/beacon/blob_sidecars endpoint. Responses are decoded the same way
+	// as v1 responses.
+	APIVersionV2 = "v2"
+)
+
+// ValidAPIVersions lists every version of the blob sidecars endpoint that the client can request.
+var ValidAPIVersions = []string{APIVersionV1, APIVersionV2}
+
+// ParseAPIVersion parses a user supplied version of the blob sidecars endpoint, either the version ("v1") or the path
+// prefix of the version ("eth/v1"), case insensitively.
+func ParseAPIVersion(s string) (string, error) {
+	version := strings.TrimPrefix(strings.Trim(strings.ToLower(strings.TrimSpace(s)), "/"), "eth/")
+	for _, valid := range ValidAPIVersions {
+		if version == valid {
+			return version, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown api version %q, valid versions are %v", s, ValidAPIVersions)
+}
+
+// WithAPIVersion pins the version of the blob sidecars endpoint that is requested, see ValidAPIVersions, by default
+// APIVersionV1. The beacon API selects the version of an endpoint by its path alone, so no version header is sent. If
+// the version is not valid, every fetch fails without making a request.
+func WithAPIVersion(v string) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.apiVersion, c.apiVersionErr = ParseAPIVersion(v)
+	}
+}
@@ -0,0 +1,61 @@
+package blobclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_WithAPIVersion(t *testing.T) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	defer srv.Close()
+
+	_, _, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+
+	status, result, err := NewBlobSidecarClient(srv.URL, WithAPIVersion("v2")).FetchSidecarIndices("head", []uint64{0}, blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, sidecars, result)
+	require.Equal(t, []string{"/eth/v1/beacon/blob_sidecars/head", "/eth/v2/beacon/blob_sidecars/head?indices=0"}, paths)
+
+	// An invalid version fails every fetch without making a request
+	_, _, err = NewBlobSidecarClient(srv.URL, WithAPIVersion("v3")).FetchSidecars("head", blobformat.JSON)
+	require.ErrorContains(t, err, `unknown api version "v3"`)
+	require.Len(t, paths, 2)
+}
+
+func TestParseAPIVersion(t *testing.T) {
+	tests := map[string]string{
+		"v1":      APIVersionV1,
+		" V2 ":    APIVersionV2,
+		"eth/v1":  APIVersionV1,
+		"/eth/v2": APIVersionV2,
+	}
+
+	for input, expected := range tests {
+		version, err := ParseAPIVersion(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, version, input)
+	}
+
+	for _, version := range ValidAPIVersions {
+		parsed, err := ParseAPIVersion(version)
+		require.NoError(t, err)
+		require.Equal(t, version, parsed)
+	}
+
+	_, err := ParseAPIVersion("1")
+	require.ErrorContains(t, err, `unknown api version "1"`)
+}
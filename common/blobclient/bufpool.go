@@ -0,0 +1,87 @@
+package blobclient
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// maxPooledBufferSize is the capacity above which a buffer is never returned to the pool, so that an unusually
+	// large response does not keep a huge allocation alive
+	maxPooledBufferSize = 8 << 20
+	// oversizedBufferFactor is how many times larger than the recent payload estimate a buffer can be and still be
+	// returned to the pool
+	oversizedBufferFactor = 4
+	// estimateWeight is the weight given to each new payload size in the running estimate, as the reciprocal
+	estimateWeight = 8
+)
+
+// decodeBuffers are the buffers that response bodies are read into before they are decoded. The decoded sidecars
+// copy what they need out of the buffer, so it can be reused as soon as decoding has finished.
+var decodeBuffers = newBufferPool(maxPooledBufferSize)
+
+// bufferPool is a pool of byte buffers that are sized from a running estimate of recent payload sizes. Most reads
+// then fit in a reused buffer, rather than growing a new one from zero, which for a response of a few blobs means
+// several allocations and copies of up to a megabyte. Payloads larger than the estimate still grow the buffer as
+// needed. For a mix of backfill responses this cuts the allocations of reading a response from ~1MB to ~1KB (see
+// BenchmarkReadResponse).
+type bufferPool struct {
+	pool    sync.Pool
+	maxSize int
+	// estimate is an exponentially weighted moving average of the sizes of recent payloads
+	estimate atomic.Int64
+}
+
+func newBufferPool(maxSize int) *bufferPool {
+	return &bufferPool{maxSize: maxSize}
+}
+
+// readAll reads r into a buffer from the pool. The buffer must be returned with put once its contents are no longer
+// referenced.
+func (p *bufferPool) readAll(r io.Reader) (*bytes.Buffer, error) {
+	buf, _ := p.pool.Get().(*bytes.Buffer)
+	if buf == nil {
+		buf = new(bytes.Buffer)
+	}
+
+	// ReadFrom needs MinRead bytes of free space to detect the end of the reader without growing the buffer
+	buf.Grow(int(p.estimate.Load()) + bytes.MinRead)
+	_, err := buf.ReadFrom(r)
+	return buf, err
+}
+
+// put records the size of the payload read into buf and returns buf to the pool, unless it is much larger than recent
+// payloads.
+func (p *bufferPool) put(buf *bytes.Buffer) {
+	estimate := p.record(buf.Len())
+	if !p.retain(buf.Cap(), estimate) {
+		return
+	}
+
+	buf.Reset()
+	p.pool.Put(buf)
+}
+
+// record adds a payload size to the running estimate, and returns the new estimate.
+func (p *bufferPool) record(size int) int64 {
+	for {
+		old := p.estimate.Load()
+		estimate := old + (int64(size)-old)/estimateWeight
+		if old == 0 {
+			estimate = int64(size)
+		}
+		if p.estimate.CompareAndSwap(old, estimate) {
+			return estimate
+		}
+	}
+}
+
+// retain reports whether a buffer with the given capacity should be returned to the pool.
+func (p *bufferPool) retain(capacity int, estimate int64) bool {
+	if capacity > p.maxSize {
+		return false
+	}
+	return int64(capacity) <= max(estimate*oversizedBufferFactor, bytes.MinRead*oversizedBufferFactor)
+}
@@ -0,0 +1,91 @@
+package blobclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool_ReadAll(t *testing.T) {
+	p := newBufferPool(maxPooledBufferSize)
+	payload := make([]byte, 300_000)
+	_, _ = rand.Read(payload)
+
+	buf, err := p.readAll(bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, payload, buf.Bytes())
+	p.put(buf)
+	require.Equal(t, int64(len(payload)), p.estimate.Load())
+
+	// A buffer sized from the estimate holds the next payload of the same size without growing
+	buf, err = p.readAll(bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, payload, buf.Bytes())
+	require.GreaterOrEqual(t, buf.Cap(), len(payload))
+	capacity := buf.Cap()
+	_, err = buf.ReadFrom(bytes.NewReader(nil))
+	require.NoError(t, err)
+	require.Equal(t, capacity, buf.Cap())
+}
+
+func TestBufferPool_Estimate(t *testing.T) {
+	p := newBufferPool(maxPooledBufferSize)
+
+	require.Equal(t, int64(800), p.record(800))
+	require.Equal(t, int64(700), p.record(0))
+	require.Equal(t, int64(1312), p.record(5600))
+}
+
+func TestBufferPool_Retain(t *testing.T) {
+	p := newBufferPool(1 << 20)
+
+	require.True(t, p.retain(1000, 1000))
+	require.True(t, p.retain(4000, 1000))
+	// Buffers much larger than recent payloads are dropped
+	require.False(t, p.retain(4001, 1000))
+	// Small buffers are kept while the estimate is still low
+	require.True(t, p.retain(bytes.MinRead, 0))
+	// Buffers larger than the maximum are never kept
+	require.False(t, p.retain(1<<20+1, 1<<20))
+}
+
+// benchmarkBackfillBodies returns SSZ response bodies with a varying number of blobs, as seen during backfill.
+func benchmarkBackfillBodies() [][]byte {
+	var bodies [][]byte
+	for _, blobs := range []int{3, 0, 6, 2, 5, 1, 4, 6} {
+		body := make([]byte, blobs*131928)
+		_, _ = rand.Read(body)
+		bodies = append(bodies, body)
+	}
+	return bodies
+}
+
+func BenchmarkReadResponse_ReadAll(b *testing.B) {
+	bodies := benchmarkBackfillBodies()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.ReadAll(bytes.NewReader(bodies[i%len(bodies)])); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadResponse_Pool(b *testing.B) {
+	bodies := benchmarkBackfillBodies()
+	p := newBufferPool(maxPooledBufferSize)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, err := p.readAll(bytes.NewReader(bodies[i%len(bodies)]))
+		if err != nil {
+			b.Fatal(err)
+		}
+		p.put(buf)
+	}
+}
@@ -0,0 +1,71 @@
+package blobclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// ChecksumError is returned by FetchSidecars when the sidecars of a block do not match the checksum expected for it by
+// WithExpectedChecksums. The sidecars of a historical block are immutable, so this means that the server has started
+// returning different data for the block.
+type ChecksumError struct {
+	ID       string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("sidecars of %s have checksum %s, expected %s", e.ID, e.Actual, e.Expected)
+}
+
+// Checksum returns the checksum of sidecars, the hex encoded SHA-256 of their SSZ encoding in ascending order of index.
+// It only depends on the sidecars, not the format or order they were served in.
+func Checksum(sidecars storage.BlobSidecars) (string, error) {
+	sorted := storage.BlobSidecars{Data: make([]*storage.BlobSidecar, len(sidecars.Data))}
+	copy(sorted.Data, sidecars.Data)
+	sort.SliceStable(sorted.Data, func(i, j int) bool { return sorted.Data[i].Index < sorted.Data[j].Index })
+
+	b, err := sorted.MarshalSSZ()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sidecars: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// WithExpectedChecksums makes the client check the sidecars fetched for each id in checksums (as passed to
+// FetchSidecars, e.g. a slot) against its checksum, see Checksum, and return a *ChecksumError if they do not match,
+// e.g. to detect in CI that a server returns different sidecars for historical blocks. Checksums may have a 0x prefix.
+// Fetches of some indices of a block, and of ids that are not in checksums, are not checked.
+func WithExpectedChecksums(checksums map[string]string) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.checksums = make(map[string]string, len(checksums))
+		for id, checksum := range checksums {
+			c.checksums[id] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "0x"))
+		}
+	}
+}
+
+// checkChecksum returns a *ChecksumError if the sidecars of a block do not match their checksum set by
+// WithExpectedChecksums.
+func (c *httpBlobSidecarClient) checkChecksum(id string, sidecars storage.BlobSidecars) error {
+	expected, ok := c.checksums[id]
+	if !ok {
+		return nil
+	}
+
+	actual, err := Checksum(sidecars)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return &ChecksumError{ID: id, Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
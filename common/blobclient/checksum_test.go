@@ -0,0 +1,73 @@
+package blobclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	sidecars := fixtureSidecars()
+	checksum, err := Checksum(sidecars)
+	require.NoError(t, err)
+	// The checksum must never change, as checksums recorded from earlier runs are compared against it
+	require.Equal(t, "953b7760e5d0fd1991a14e6de202cb0b03b98b38baf25947979abe214b39fc5a", checksum)
+
+	reversed := storage.BlobSidecars{Data: []*storage.BlobSidecar{sidecars.Data[1], sidecars.Data[0]}}
+	checksum, err = Checksum(reversed)
+	require.NoError(t, err)
+	require.Equal(t, "953b7760e5d0fd1991a14e6de202cb0b03b98b38baf25947979abe214b39fc5a", checksum)
+	require.Equal(t, fixtureSidecars(), sidecars, "sidecars must not be modified")
+
+	reversed.Data[0].Blob[0] ^= 0xff
+	changed, err := Checksum(reversed)
+	require.NoError(t, err)
+	require.NotEqual(t, checksum, changed)
+}
+
+func TestClient_WithExpectedChecksums(t *testing.T) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+	checksum, err := Checksum(sidecars)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == string(blobformat.SSZ) {
+			_, _ = w.Write(ssz)
+			return
+		}
+		// The JSON response is in another order, which does not change the checksum
+		_ = json.NewEncoder(w).Encode(storage.BlobSidecars{Data: []*storage.BlobSidecar{sidecars.Data[1], sidecars.Data[0]}})
+	}))
+	defer srv.Close()
+
+	client := NewBlobSidecarClient(srv.URL, WithExpectedChecksums(map[string]string{
+		"10": "0x" + strings.ToUpper(checksum),
+		"11": strings.Repeat("0", len(checksum)),
+	}))
+
+	for _, format := range []blobformat.Format{blobformat.SSZ, blobformat.JSON} {
+		status, _, err := client.FetchSidecars("10", format)
+		require.NoError(t, err, format)
+		require.Equal(t, http.StatusOK, status)
+	}
+
+	_, result, err := client.FetchSidecars("11", blobformat.SSZ)
+	var checksumErr *ChecksumError
+	require.ErrorAs(t, err, &checksumErr)
+	require.Equal(t, ChecksumError{ID: "11", Expected: strings.Repeat("0", len(checksum)), Actual: checksum}, *checksumErr)
+	require.Empty(t, result.Data)
+
+	// Ids without a checksum, and some indices of a block, are not checked
+	_, _, err = client.FetchSidecars("12", blobformat.SSZ)
+	require.NoError(t, err)
+	_, _, err = client.FetchSidecarIndices("11", []uint64{0, 1}, blobformat.SSZ)
+	require.NoError(t, err)
+}
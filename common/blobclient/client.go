@@ -0,0 +1,476 @@
+package blobclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// consensusVersionHeader is the header used by beacon nodes to report the fork version of the response
+	consensusVersionHeader = "Eth-Consensus-Version"
+
+	// maxErrorBodySize is the maximum number of bytes read from the body of an error response
+	maxErrorBodySize = 64 * 1024
+	// maxErrorSnippetLength is the maximum length of a non-JSON error body included in a StatusError
+	maxErrorSnippetLength = 256
+)
+
+// StatusError is returned by FetchSidecars when the server responds with a status code other than 200. Message
+// contains the explanation given by the server, either from the standard beacon API error body or a truncated snippet
+// of the raw body.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsFetchError returns true if the error indicates the sidecars could not be fetched, as opposed to the endpoint
+// responding with an error status.
+func IsFetchError(err error) bool {
+	var statusErr *StatusError
+	return err != nil && !errors.As(err, &statusErr)
+}
+
+// newStatusError creates a StatusError from an error response, parsing the beacon API {code, message} body if present.
+func newStatusError(statusCode int, body io.Reader) *StatusError {
+	b, _ := io.ReadAll(io.LimitReader(body, maxErrorBodySize))
+
+	var apiErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(b, &apiErr); err == nil && apiErr.Message != "" {
+		return &StatusError{StatusCode: statusCode, Message: apiErr.Message}
+	}
+
+	snippet := strings.TrimSpace(string(b))
+	if len(snippet) > maxErrorSnippetLength {
+		snippet = snippet[:maxErrorSnippetLength] + "..."
+	}
+
+	return &StatusError{StatusCode: statusCode, Message: snippet}
+}
+
+// BlobSidecarClient is a minimal client for fetching sidecars from the blob service. This client is used instead of an
+// existing client for two reasons.
+// 1) Does not require any endpoints except /eth/v1/blob_sidecar (or a later version, see WithAPIVersion), which is the only endpoint that the Blob API supports
+// 2) Exposes implementation details, e.g. status code, as well as allowing us to specify the format
+type BlobSidecarClient interface {
+	// FetchSidecars fetches the sidecars for a given slot from the blob sidecar API. It returns the HTTP status code and
+	// the sidecars. If the status code is not 200, a *StatusError describing the failure is returned.
+	FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error)
+}
+
+type httpBlobSidecarClient struct {
+	url            string
+	client         *http.Client
+	log            log.Logger
+	formatFallback bool
+	// group is set when concurrent identical requests are deduplicated
+	group *singleflight.Group
+	// allowedForks are the forks that responses may be from, any fork is allowed if empty
+	allowedForks []string
+	auto         autoFormat
+	// dialer establishes connections, unless the transport has been replaced by WithRoundTripper
+	dialer *net.Dialer
+	// proxy chooses the proxy of each request, unless the transport has been replaced by WithRoundTripper. Requests are
+	// sent directly if it is nil.
+	proxy func(*http.Request) (*url.URL, error)
+	// consistency is the consistency level requested from the server
+	consistency storage.Consistency
+	// fork and maxBlobs are set by WithFork and WithMaxBlobsPerBlock, and seenFork is the fork of the most recent
+	// response, see checkIndices
+	fork     string
+	maxBlobs uint64
+	seenFork atomic.Value
+	// recordDir is the directory requests are recorded to, if set by WithRecorder
+	recordDir string
+	// apiVersion is the version of the blob sidecars endpoint, apiVersionErr is set if WithAPIVersion was given an
+	// invalid version
+	apiVersion    string
+	apiVersionErr error
+	// checksums are the checksums the sidecars of blocks must match, set by WithExpectedChecksums
+	checksums map[string]string
+	// retry configures how failed requests are retried, see WithRetries, and sleep waits between the attempts until
+	// the context of the request ends
+	retry RetryConfig
+	sleep func(context.Context, time.Duration) error
+	// ctx is the context requests are made with, see WithContext
+	ctx context.Context
+}
+
+// autoProbeInterval is the number of requests made in JSON format, after an SSZ response fails to decode, before
+// blobformat.Auto tries SSZ again.
+const autoProbeInterval = 100
+
+// autoFormat records how well the server's SSZ responses decode, to choose the format of blobformat.Auto requests.
+type autoFormat struct {
+	mu           sync.Mutex
+	sszSuccesses uint64
+	sszFailures  uint64
+	// jsonRequests is the number of requests remaining that are made in JSON before SSZ is tried again
+	jsonRequests int
+}
+
+// choose returns the format to request.
+func (a *autoFormat) choose() blobformat.Format {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.jsonRequests > 0 {
+		a.jsonRequests--
+		return blobformat.JSON
+	}
+	return blobformat.SSZ
+}
+
+// record records whether an SSZ response decoded, returning the number of successes and failures so far.
+func (a *autoFormat) record(decoded bool) (uint64, uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if decoded {
+		a.sszSuccesses++
+	} else {
+		a.sszFailures++
+		a.jsonRequests = autoProbeInterval
+	}
+	return a.sszSuccesses, a.sszFailures
+}
+
+// fetchResult is the result of a fetch shared by deduplicated requests.
+type fetchResult struct {
+	status   int
+	sidecars storage.BlobSidecars
+}
+
+// ClientOption configures optional behaviour of the BlobSidecarClient.
+type ClientOption func(c *httpBlobSidecarClient)
+
+// WithRoundTripper sets the http.RoundTripper used to issue requests, e.g. to record responses or to refresh
+// credentials. The round-tripper is used as-is, so it overrides any transport level configuration (such as TLS or
+// connection pooling) that would otherwise be applied to the client. Retries and metrics are handled above the
+// transport and are unaffected.
+func WithRoundTripper(rt http.RoundTripper) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.client.Transport = rt
+	}
+}
+
+// WithLogger sets the logger used to report format fallbacks, by default the root logger is used.
+func WithLogger(l log.Logger) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.log = l
+	}
+}
+
+// WithFormatFallback makes the client retry a request in JSON format if the response to an SSZ request cannot be
+// decoded. JSON is more forgiving, so this allows sidecars to be fetched from servers with buggy SSZ encoders while
+// keeping SSZ as the preferred format. Each fallback is logged.
+func WithFormatFallback() ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.formatFallback = true
+	}
+}
+
+// WithDeduplication makes concurrent requests for the same id and format share a single in-flight request and its
+// result, including any error. This avoids redundant load on the server when several callers fetch the same block at
+// once, e.g. "head". Requests are not bound to the context of any caller, so a caller giving up does not affect the
+// others sharing the request.
+func WithDeduplication() ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.group = &singleflight.Group{}
+	}
+}
+
+// WithAllowedForks makes the client reject responses from a fork that is not one of the given forks (e.g. "deneb") with
+// a *ForkError. The fork of a response is taken from the Eth-Consensus-Version header, or the version field of a JSON
+// response. Responses that do not report their fork cannot be verified and are accepted.
+func WithAllowedForks(forks []string) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.allowedForks = forks
+	}
+}
+
+// WithConsistency sets the consistency level of the reads requested from the server. With storage.ConsistencyFresh
+// requests are sent with "Cache-Control: no-cache", which makes the blob API bypass any cache in front of its source,
+// e.g. to re-read blobs right after they have been repaired. Fresh reads are slower, see storage.Consistency.
+func WithConsistency(consistency storage.Consistency) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.consistency = consistency
+	}
+}
+
+// WithContext sets the context that requests are made with, by default context.Background(). Once it ends, e.g. on
+// shutdown, the request in flight and any wait before a retry are abandoned and fetches fail with its error.
+func WithContext(ctx context.Context) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.ctx = ctx
+	}
+}
+
+// NewBlobSidecarClient creates a new BlobSidecarClient that fetches sidecars from the given URL.
+func NewBlobSidecarClient(url string, opts ...ClientOption) IndexedBlobSidecarClient {
+	c := &httpBlobSidecarClient{
+		url:        url,
+		client:     &http.Client{},
+		log:        log.Root(),
+		dialer:     newDialer(),
+		proxy:      http.ProxyFromEnvironment,
+		apiVersion: APIVersionV1,
+		sleep:      sleep,
+		ctx:        context.Background(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.client.Transport == nil {
+		c.client.Transport = newTransport(c.dialer, c.proxy)
+	}
+
+	if c.recordDir != "" {
+		c.client.Transport = newRecorder(c.client.Transport, c.recordDir, c.log)
+	}
+
+	return c
+}
+
+func (c *httpBlobSidecarClient) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	return c.FetchSidecarIndices(id, nil, format)
+}
+
+func (c *httpBlobSidecarClient) FetchSidecarIndices(id string, indices []uint64, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	if c.apiVersionErr != nil {
+		return http.StatusInternalServerError, storage.BlobSidecars{}, c.apiVersionErr
+	}
+
+	if err := c.checkIndices(indices); err != nil {
+		return http.StatusBadRequest, storage.BlobSidecars{}, err
+	}
+
+	status, sidecars, err := c.fetchDeduplicated(id, indices, format)
+	if err != nil || status != http.StatusOK || len(indices) > 0 {
+		return status, sidecars, err
+	}
+
+	if err := c.checkChecksum(id, sidecars); err != nil {
+		return status, storage.BlobSidecars{}, err
+	}
+
+	return status, sidecars, nil
+}
+
+// fetchDeduplicated fetches the sidecars, sharing the request with concurrent identical requests if enabled.
+func (c *httpBlobSidecarClient) fetchDeduplicated(id string, indices []uint64, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	if c.group == nil {
+		return c.fetchWithFallback(id, indices, format)
+	}
+
+	v, err, _ := c.group.Do(format.String()+" "+c.sidecarsURL(id, indices), func() (interface{}, error) {
+		status, sidecars, err := c.fetchWithFallback(id, indices, format)
+		return fetchResult{status: status, sidecars: sidecars}, err
+	})
+	result := v.(fetchResult)
+
+	// Each caller gets its own slice, so that one caller modifying the slice does not affect the others
+	return result.status, storage.BlobSidecars{Data: slices.Clone(result.sidecars.Data)}, err
+}
+
+// fetchWithFallback fetches the sidecars, retrying in JSON format if enabled and the response cannot be decoded.
+func (c *httpBlobSidecarClient) fetchWithFallback(id string, indices []uint64, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	if format == blobformat.Auto {
+		return c.fetchAuto(id, indices)
+	}
+
+	status, sidecars, err := c.fetch(id, indices, format)
+	if !c.formatFallback || format == blobformat.JSON || status != http.StatusOK || err == nil {
+		return status, sidecars, err
+	}
+
+	c.log.Warn("failed to decode sidecars, falling back to json", "id", id, "format", format, "err", err)
+	status, sidecars, err = c.fetch(id, indices, blobformat.JSON)
+	if err == nil {
+		c.log.Info("fetched sidecars after format fallback", "id", id, "format", blobformat.JSON)
+	}
+
+	return status, sidecars, err
+}
+
+// fetchAuto fetches the sidecars in the format chosen by autoFormat. An SSZ response that cannot be decoded is retried
+// in JSON, and JSON is used for the following requests to the server.
+func (c *httpBlobSidecarClient) fetchAuto(id string, indices []uint64) (int, storage.BlobSidecars, error) {
+	format := c.auto.choose()
+	status, sidecars, err := c.fetch(id, indices, format)
+
+	var forkErr *ForkError
+	if format != blobformat.SSZ || status != http.StatusOK || errors.As(err, &forkErr) {
+		return status, sidecars, err
+	}
+
+	successes, failures := c.auto.record(err == nil)
+	if err == nil {
+		return status, sidecars, nil
+	}
+
+	c.log.Warn("failed to decode ssz sidecars, using json", "id", id, "err", err, "successes", successes, "failures", failures, "jsonRequests", autoProbeInterval)
+	return c.fetch(id, indices, blobformat.JSON)
+}
+
+// fetch fetches the sidecars for a block, following any further pages of the response (see nextPage).
+func (c *httpBlobSidecarClient) fetch(id string, indices []uint64, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	url := c.sidecarsURL(id, indices)
+	status, sidecars, next, err := c.fetchPage(url, format)
+	if err != nil || next == "" {
+		return status, sidecars, err
+	}
+
+	visited := map[string]bool{url: true}
+	data := sidecars.Data
+	for page := 2; next != ""; page++ {
+		if page > maxPages || visited[next] {
+			return status, storage.BlobSidecars{}, fmt.Errorf("sidecars for %s did not end after %d pages", id, page-1)
+		}
+		visited[next] = true
+
+		status, sidecars, next, err = c.fetchPage(next, format)
+		if err != nil {
+			return status, storage.BlobSidecars{}, fmt.Errorf("failed to fetch page %d: %w", page, err)
+		}
+		data = append(data, sidecars.Data...)
+	}
+
+	merged, err := mergePages(data, indices)
+	if err != nil {
+		return status, storage.BlobSidecars{}, err
+	}
+
+	return status, merged, nil
+}
+
+// fetchPage fetches a single page of sidecars, returning the URL of the next page if there is one.
+func (c *httpBlobSidecarClient) fetchPage(url string, format blobformat.Format) (int, storage.BlobSidecars, string, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", url, nil)
+	if err != nil {
+		return http.StatusInternalServerError, storage.BlobSidecars{}, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", format.String())
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if c.consistency == storage.ConsistencyFresh {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+
+	response, err := c.do(req)
+	if err != nil {
+		return http.StatusInternalServerError, storage.BlobSidecars{}, "", fmt.Errorf("failed to fetch sidecars: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	body, err := decodeContentEncoding(response)
+	if err != nil {
+		return response.StatusCode, storage.BlobSidecars{}, "", err
+	}
+
+	defer body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return response.StatusCode, storage.BlobSidecars{}, "", newStatusError(response.StatusCode, body)
+	}
+
+	var sidecars storage.BlobSidecars
+	var token string
+	fork := response.Header.Get(consensusVersionHeader)
+	switch format {
+	case blobformat.JSON:
+		var version string
+		sidecars, version, token, err = decodeJSONPage(body)
+		if err == nil && version != "" && fork != "" && !strings.EqualFold(version, fork) {
+			err = fmt.Errorf("response version %s does not match %s header %s", version, consensusVersionHeader, fork)
+		}
+		if fork == "" {
+			fork = version
+		}
+	case blobformat.SSZSnappy:
+		sidecars, err = DecodeSnappySSZ(body)
+	default:
+		// A response that declares an impossible length is rejected before it is read
+		if encoding := response.Header.Get("Content-Encoding"); response.ContentLength >= 0 && (encoding == "" || strings.EqualFold(encoding, "identity")) {
+			if sizeErr := checkSSZSize(response.ContentLength); sizeErr != nil {
+				err = fmt.Errorf("failed to decode ssz response: %w", sizeErr)
+			}
+		}
+		if err == nil {
+			sidecars, err = decodeSSZ(body)
+		}
+	}
+
+	if err == nil {
+		err = c.checkFork(fork)
+	}
+
+	if err == nil && fork != "" {
+		c.seenFork.Store(strings.ToLower(fork))
+	}
+
+	if err != nil {
+		return response.StatusCode, storage.BlobSidecars{}, "", err
+	}
+
+	next, err := nextPage(req.URL, response.Header, token)
+	if err != nil {
+		return response.StatusCode, storage.BlobSidecars{}, "", err
+	}
+
+	return response.StatusCode, sidecars, next, nil
+}
+
+// ForkError is returned by FetchSidecars when the response reports a fork that is not one of the allowed forks, which
+// usually means that the client is pointed at a node on a different network or fork than expected.
+type ForkError struct {
+	Fork    string
+	Allowed []string
+}
+
+func (e *ForkError) Error() string {
+	return fmt.Sprintf("response is from unexpected fork %s, allowed forks are %v", e.Fork, e.Allowed)
+}
+
+// checkFork returns a *ForkError if the fork of a response is not one of the allowed forks.
+func (c *httpBlobSidecarClient) checkFork(fork string) error {
+	if len(c.allowedForks) == 0 || fork == "" {
+		return nil
+	}
+
+	for _, allowed := range c.allowedForks {
+		if strings.EqualFold(fork, allowed) {
+			return nil
+		}
+	}
+
+	return &ForkError{Fork: fork, Allowed: c.allowedForks}
+}
@@ -0,0 +1,857 @@
+package blobclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+type countingRoundTripper struct {
+	requests []*http.Request
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClient_WithRoundTripper(t *testing.T) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 2))}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/eth/v1/beacon/blob_sidecars/head", r.URL.Path)
+		require.Equal(t, string(blobformat.JSON), r.Header.Get("Accept"))
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	defer srv.Close()
+
+	rt := &countingRoundTripper{}
+	client := NewBlobSidecarClient(srv.URL, WithRoundTripper(rt))
+
+	status, result, err := client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, sidecars, result)
+	require.Len(t, rt.requests, 1)
+}
+
+func TestClient_WithConsistency(t *testing.T) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}
+	var cacheControl string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cacheControl = r.Header.Get("Cache-Control")
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	defer srv.Close()
+
+	_, _, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Empty(t, cacheControl)
+
+	_, _, err = NewBlobSidecarClient(srv.URL, WithConsistency(storage.ConsistencyCached)).FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Empty(t, cacheControl)
+
+	_, result, err := NewBlobSidecarClient(srv.URL, WithConsistency(storage.ConsistencyFresh)).FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, "no-cache", cacheControl)
+	require.Equal(t, sidecars, result)
+}
+
+func TestClient_ErrorBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected string
+	}{
+		{
+			name:     "beacon error body",
+			status:   400,
+			body:     `{"code":400,"message":"Invalid block ID: foo"}`,
+			expected: "status 400: Invalid block ID: foo",
+		},
+		{
+			name:     "plain text body",
+			status:   502,
+			body:     "bad gateway\n",
+			expected: "status 502: bad gateway",
+		},
+		{
+			name:     "empty body",
+			status:   404,
+			body:     "",
+			expected: "status 404",
+		},
+		{
+			name:     "long body is truncated",
+			status:   500,
+			body:     strings.Repeat("a", 1000),
+			expected: "status 500: " + strings.Repeat("a", maxErrorSnippetLength) + "...",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			status, result, err := NewBlobSidecarClient(srv.URL).FetchSidecars("foo", blobformat.JSON)
+			require.Equal(t, test.status, status)
+			require.Empty(t, result.Data)
+
+			var statusErr *StatusError
+			require.ErrorAs(t, err, &statusErr)
+			require.Equal(t, test.status, statusErr.StatusCode)
+			require.Equal(t, test.expected, err.Error())
+		})
+	}
+}
+
+// fixtureSidecars returns the sidecars stored in testdata/blob_sidecars.ssz_snappy, every byte of the blob, commitment
+// and proof of sidecar i is set to i+1.
+func fixtureSidecars() storage.BlobSidecars {
+	var sidecars storage.BlobSidecars
+	for i := 0; i < 2; i++ {
+		sidecar := &storage.BlobSidecar{
+			Index: deneb.BlobIndex(i),
+			SignedBlockHeader: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: 10},
+			},
+		}
+		copy(sidecar.Blob[:], bytes.Repeat([]byte{byte(i + 1)}, len(sidecar.Blob)))
+		copy(sidecar.KZGCommitment[:], bytes.Repeat([]byte{byte(i + 1)}, len(sidecar.KZGCommitment)))
+		copy(sidecar.KZGProof[:], bytes.Repeat([]byte{byte(i + 1)}, len(sidecar.KZGProof)))
+		sidecars.Data = append(sidecars.Data, sidecar)
+	}
+	return sidecars
+}
+
+func TestDecodeSnappySSZ_Fixture(t *testing.T) {
+	f, err := os.Open("testdata/blob_sidecars.ssz_snappy")
+	require.NoError(t, err)
+	defer f.Close()
+
+	sidecars, err := DecodeSnappySSZ(f)
+	require.NoError(t, err)
+	require.Equal(t, fixtureSidecars(), sidecars)
+}
+
+func TestSnappySSZ_RoundTrip(t *testing.T) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 3))}
+
+	var buf bytes.Buffer
+	require.NoError(t, EncodeSnappySSZ(&buf, sidecars))
+
+	result, err := DecodeSnappySSZ(&buf)
+	require.NoError(t, err)
+	require.Equal(t, sidecars, result)
+
+	_, err = DecodeSnappySSZ(strings.NewReader("not snappy"))
+	require.Error(t, err)
+}
+
+func TestClient_FormatSSZSnappy(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/blob_sidecars.ssz_snappy")
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, string(blobformat.SSZSnappy), r.Header.Get("Accept"))
+		_, _ = w.Write(fixture)
+	}))
+	defer srv.Close()
+
+	status, result, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZSnappy)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, fixtureSidecars(), result)
+}
+
+func compress(t testing.TB, encoding string, b []byte) []byte {
+	var buf bytes.Buffer
+	switch encoding {
+	case "gzip":
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+	case "zstd":
+		enc, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		_, err = enc.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, enc.Close())
+	default:
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func TestClient_ContentEncoding(t *testing.T) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+
+	for _, encoding := range []string{"", "identity", "gzip", "zstd"} {
+		t.Run(encoding, func(t *testing.T) {
+			body := compress(t, encoding, ssz)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "gzip, zstd", r.Header.Get("Accept-Encoding"))
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				_, _ = w.Write(body)
+			}))
+			defer srv.Close()
+
+			client := NewBlobSidecarClient(srv.URL)
+			// Fetch twice so that a pooled zstd decoder is re-used
+			for i := 0; i < 2; i++ {
+				status, result, err := client.FetchSidecars("head", blobformat.SSZ)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, status)
+				require.Equal(t, sidecars, result)
+			}
+		})
+	}
+}
+
+func TestClient_ContentEncodingErrorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(compress(t, "zstd", []byte(`{"code":400,"message":"Invalid block ID: foo"}`)))
+	}))
+	defer srv.Close()
+
+	_, _, err := NewBlobSidecarClient(srv.URL).FetchSidecars("foo", blobformat.JSON)
+	require.EqualError(t, err, "status 400: Invalid block ID: foo")
+}
+
+func TestClient_UnsupportedContentEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	_, _, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZ)
+	require.ErrorContains(t, err, "unsupported content encoding: br")
+}
+
+// stubRoundTripper returns the response without sending the request.
+type stubRoundTripper func(req *http.Request) *http.Response
+
+func (s stubRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return s(req), nil
+}
+
+func TestClient_RejectsImpossibleContentLength(t *testing.T) {
+	for _, length := range []int64{storage.MaxBlobSidecarsSSZSize + storage.BlobSidecarSSZSize, 1 << 40, storage.BlobSidecarSSZSize - 1} {
+		body := &countingReader{r: zeroReader{}}
+		rt := stubRoundTripper(func(req *http.Request) *http.Response {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{},
+				ContentLength: length,
+				Body:          io.NopCloser(body),
+				Request:       req,
+			}
+		})
+
+		status, result, err := NewBlobSidecarClient("http://beacon", WithRoundTripper(rt)).FetchSidecars("head", blobformat.SSZ)
+		require.ErrorContains(t, err, "failed to decode ssz response")
+		require.Equal(t, http.StatusOK, status)
+		require.Empty(t, result.Data)
+		require.Zero(t, body.read, "content length %d", length)
+	}
+}
+
+func benchmarkDecode(b *testing.B, encoding string) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(b, err)
+	body := compress(b, encoding, ssz)
+
+	b.SetBytes(int64(len(ssz)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{encoding}},
+			Body:   io.NopCloser(bytes.NewReader(body)),
+		}
+
+		r, err := decodeContentEncoding(response)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := decodeSSZ(r); err != nil {
+			b.Fatal(err)
+		}
+		_ = r.Close()
+	}
+}
+
+func BenchmarkDecode_Gzip(b *testing.B) {
+	benchmarkDecode(b, "gzip")
+}
+
+func BenchmarkDecode_Zstd(b *testing.B) {
+	benchmarkDecode(b, "zstd")
+}
+
+// benchmarkDecodeFormat measures decoding a response with six blobs in the given format, the numbers are quoted in
+// the documentation of blobformat.Auto.
+func benchmarkDecodeFormat(b *testing.B, format blobformat.Format) {
+	var sidecars storage.BlobSidecars
+	for i := 0; i < 6; i++ {
+		sidecar := &storage.BlobSidecar{
+			Index: deneb.BlobIndex(i),
+			SignedBlockHeader: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: 10},
+			},
+		}
+		_, _ = rand.Read(sidecar.Blob[:])
+		sidecars.Data = append(sidecars.Data, sidecar)
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case blobformat.JSON:
+		require.NoError(b, json.NewEncoder(&buf).Encode(sidecars))
+	case blobformat.SSZSnappy:
+		require.NoError(b, EncodeSnappySSZ(&buf, sidecars))
+	default:
+		ssz, err := sidecars.MarshalSSZ()
+		require.NoError(b, err)
+		buf.Write(ssz)
+	}
+	body := buf.Bytes()
+
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		switch format {
+		case blobformat.JSON:
+			_, _, err = decodeJSON(bytes.NewReader(body))
+		case blobformat.SSZSnappy:
+			_, err = DecodeSnappySSZ(bytes.NewReader(body))
+		default:
+			_, err = decodeSSZ(bytes.NewReader(body))
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFormat_JSON(b *testing.B) {
+	benchmarkDecodeFormat(b, blobformat.JSON)
+}
+
+func BenchmarkDecodeFormat_SSZ(b *testing.B) {
+	benchmarkDecodeFormat(b, blobformat.SSZ)
+}
+
+func BenchmarkDecodeFormat_SSZSnappy(b *testing.B) {
+	benchmarkDecodeFormat(b, blobformat.SSZSnappy)
+}
+
+func TestDecodeJSON_Shapes(t *testing.T) {
+	sidecars := fixtureSidecars()
+	data, err := json.Marshal(sidecars.Data)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		body    string
+		version string
+		err     string
+	}{
+		{
+			name:    "version envelope",
+			body:    `{"version":"deneb","execution_optimistic":false,"finalized":true,"data":` + string(data) + `}`,
+			version: "deneb",
+		},
+		{
+			name: "data only",
+			body: `{"data":` + string(data) + `}`,
+		},
+		{
+			name: "bare list",
+			body: "\n" + string(data),
+		},
+		{
+			name: "missing data",
+			body: `{"version":"deneb","sidecars":` + string(data) + `}`,
+			err:  "missing data field",
+		},
+		{
+			name: "invalid json",
+			body: `{"data":`,
+			err:  "failed to decode json response",
+		},
+		{
+			name: "null sidecar",
+			body: `{"data":[null]}`,
+			err:  "sidecar 0 is null",
+		},
+		{
+			name: "null sidecar in bare list",
+			body: `[null]`,
+			err:  "sidecar 0 is null",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, version, err := decodeJSON(strings.NewReader(test.body))
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.version, version)
+			require.Equal(t, sidecars, result)
+		})
+	}
+
+	// An empty list of sidecars is a valid response for a block without blobs
+	result, _, err := decodeJSON(strings.NewReader(`{"version":"deneb","data":[]}`))
+	require.NoError(t, err)
+	require.Empty(t, result.Data)
+}
+
+// quantityFixtureSidecars returns the sidecars stored in the testdata/blob_sidecars_*_quantities.json.gz fixtures,
+// which use slots and proposer indices that a float64 cannot represent exactly.
+func quantityFixtureSidecars() storage.BlobSidecars {
+	sidecars := fixtureSidecars()
+	for _, sidecar := range sidecars.Data {
+		sidecar.SignedBlockHeader.Message.Slot = 9007199254740993
+		sidecar.SignedBlockHeader.Message.ProposerIndex = 18446744073709551615
+	}
+	return sidecars
+}
+
+func TestDecodeJSON_QuantityFixtures(t *testing.T) {
+	for _, name := range []string{"blob_sidecars_string_quantities.json.gz", "blob_sidecars_numeric_quantities.json.gz"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open("testdata/" + name)
+			require.NoError(t, err)
+			defer f.Close()
+
+			gz, err := gzip.NewReader(f)
+			require.NoError(t, err)
+
+			result, version, err := decodeJSON(gz)
+			require.NoError(t, err)
+			require.Equal(t, "deneb", version)
+			require.Equal(t, quantityFixtureSidecars(), result)
+		})
+	}
+}
+
+func TestDecodeJSON_InvalidQuantities(t *testing.T) {
+	sidecars := fixtureSidecars()
+	data, err := json.Marshal(sidecars.Data)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		replace string
+		with    string
+	}{
+		{name: "negative", replace: `"index":"0"`, with: `"index":-1`},
+		{name: "fractional", replace: `"slot":"10"`, with: `"slot":10.5`},
+		{name: "overflow", replace: `"slot":"10"`, with: `"slot":18446744073709551616`},
+		{name: "not a number", replace: `"index":"0"`, with: `"index":"zero"`},
+		{name: "missing", replace: `"index":"0",`, with: ``},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := strings.Replace(string(data), test.replace, test.with, 1)
+			require.NotEqual(t, string(data), body)
+
+			_, _, err := decodeJSON(strings.NewReader(body))
+			require.ErrorContains(t, err, "failed to decode json response")
+		})
+	}
+}
+
+func TestClient_ConsensusVersionHeader(t *testing.T) {
+	sidecars := fixtureSidecars()
+	data, err := json.Marshal(sidecars.Data)
+	require.NoError(t, err)
+
+	header := "deneb"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Eth-Consensus-Version", header)
+		_, _ = w.Write([]byte(`{"version":"deneb","data":` + string(data) + `}`))
+	}))
+	defer srv.Close()
+
+	_, result, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, sidecars, result)
+
+	header = "electra"
+	_, _, err = NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.JSON)
+	require.ErrorContains(t, err, "does not match Eth-Consensus-Version header electra")
+}
+
+func TestClient_WithFormatFallback(t *testing.T) {
+	sidecars := fixtureSidecars()
+	var accepts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepts = append(accepts, r.Header.Get("Accept"))
+		if r.Header.Get("Accept") == string(blobformat.SSZ) {
+			// A truncated SSZ response
+			_, _ = w.Write([]byte{1, 2, 3})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	defer srv.Close()
+
+	_, _, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZ)
+	require.ErrorContains(t, err, "failed to decode ssz response")
+	require.Equal(t, []string{string(blobformat.SSZ)}, accepts)
+
+	accepts = nil
+	status, result, err := NewBlobSidecarClient(srv.URL, WithFormatFallback()).FetchSidecars("head", blobformat.SSZ)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, sidecars, result)
+	require.Equal(t, []string{string(blobformat.SSZ), string(blobformat.JSON)}, accepts)
+}
+
+func TestClient_WithFormatFallbackIgnoresErrorStatus(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	status, _, err := NewBlobSidecarClient(srv.URL, WithFormatFallback()).FetchSidecars("head", blobformat.SSZ)
+	require.Equal(t, http.StatusNotFound, status)
+	require.Error(t, err)
+	require.Equal(t, 1, requests)
+}
+
+func TestClient_WithAllowedForks(t *testing.T) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+
+	var header, version string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header != "" {
+			w.Header().Set(consensusVersionHeader, header)
+		}
+		if r.Header.Get("Accept") == string(blobformat.SSZ) {
+			_, _ = w.Write(ssz)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(struct {
+			Version string                 `json:"version,omitempty"`
+			Data    []*storage.BlobSidecar `json:"data"`
+		}{version, sidecars.Data})
+	}))
+	defer srv.Close()
+
+	client := NewBlobSidecarClient(srv.URL, WithAllowedForks([]string{"deneb", "electra"}))
+
+	// Responses that do not report their fork are accepted
+	_, _, err = client.FetchSidecars("head", blobformat.SSZ)
+	require.NoError(t, err)
+
+	header = "Deneb"
+	_, result, err := client.FetchSidecars("head", blobformat.SSZ)
+	require.NoError(t, err)
+	require.Equal(t, sidecars, result)
+
+	header = "capella"
+	_, _, err = client.FetchSidecars("head", blobformat.SSZ)
+	var forkErr *ForkError
+	require.ErrorAs(t, err, &forkErr)
+	require.Equal(t, "capella", forkErr.Fork)
+
+	// Without the header, the version field of a JSON response is checked
+	header, version = "", "capella"
+	_, _, err = client.FetchSidecars("head", blobformat.JSON)
+	require.ErrorAs(t, err, &forkErr)
+
+	version = "electra"
+	_, _, err = client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+}
+
+func readFixture(t testing.TB, name string) []byte {
+	f, err := os.Open("testdata/" + name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return b
+}
+
+func TestClient_ContinuationToken(t *testing.T) {
+	// The second page repeats the first sidecar, which is only included once
+	pages := map[string][]byte{
+		"":       readFixture(t, "blob_sidecars_page_1.json.gz"),
+		"page-2": readFixture(t, "blob_sidecars_page_2.json.gz"),
+	}
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/eth/v1/beacon/blob_sidecars/head", r.URL.Path)
+		token := r.URL.Query().Get(continuationTokenParam)
+		tokens = append(tokens, token)
+		_, _ = w.Write(pages[token])
+	}))
+	defer srv.Close()
+
+	status, result, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, fixtureSidecars(), result)
+	require.Equal(t, []string{"", "page-2"}, tokens)
+}
+
+func TestClient_LinkHeaderPagination(t *testing.T) {
+	sidecars := fixtureSidecars()
+	page := func(sidecars ...*storage.BlobSidecar) []byte {
+		b, err := (&storage.BlobSidecars{Data: sidecars}).MarshalSSZ()
+		require.NoError(t, err)
+		return b
+	}
+
+	var links map[string]string
+	var bodies map[string][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Query().Get("page")
+		if link, ok := links[p]; ok {
+			w.Header().Set("Link", link)
+		}
+		_, _ = w.Write(bodies[p])
+	}))
+	defer srv.Close()
+
+	links = map[string]string{"": `<https://example.com/docs>; rel="help", </eth/v1/beacon/blob_sidecars/head?page=2>; rel="next"`}
+	bodies = map[string][]byte{"": page(sidecars.Data[1]), "2": page(sidecars.Data[0])}
+	_, result, err := NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZ)
+	require.NoError(t, err)
+	require.Equal(t, sidecars, result)
+
+	// A page that is lost leaves a gap in the indices
+	missing := *sidecars.Data[1]
+	missing.Index = 2
+	bodies = map[string][]byte{"": page(sidecars.Data[0]), "2": page(&missing)}
+	_, _, err = NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZ)
+	require.ErrorContains(t, err, "incomplete sidecars after following pages, missing index 1")
+
+	// Pages must agree on the sidecar for each index
+	conflicting := *sidecars.Data[1]
+	conflicting.Index = 0
+	bodies = map[string][]byte{"": page(sidecars.Data[0]), "2": page(&conflicting)}
+	_, _, err = NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZ)
+	require.ErrorContains(t, err, "pages contain different sidecars for index 0")
+
+	// A loop of pages is not followed forever
+	links["2"] = `</eth/v1/beacon/blob_sidecars/head>; rel="next"`
+	bodies = map[string][]byte{"": page(sidecars.Data[0]), "2": page(sidecars.Data[1])}
+	_, _, err = NewBlobSidecarClient(srv.URL).FetchSidecars("head", blobformat.SSZ)
+	require.ErrorContains(t, err, "did not end after 2 pages")
+}
+
+// blockingServer is a test server that holds every request until release is closed.
+type blockingServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	release  chan struct{}
+}
+
+func newBlockingServer(t *testing.T, handler http.HandlerFunc) *blockingServer {
+	s := &blockingServer{release: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		<-s.release
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func fetchConcurrently(client BlobSidecarClient, n int, format func(i int) blobformat.Format) ([]int, []storage.BlobSidecars, []error) {
+	statuses := make([]int, n)
+	results := make([]storage.BlobSidecars, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], results[i], errs[i] = client.FetchSidecars("head", format(i))
+		}(i)
+	}
+	wg.Wait()
+
+	return statuses, results, errs
+}
+
+func TestClient_WithDeduplication(t *testing.T) {
+	sidecars := fixtureSidecars()
+	srv := newBlockingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(sidecars)
+	})
+
+	client := NewBlobSidecarClient(srv.URL, WithDeduplication())
+	go func() {
+		require.Eventually(t, func() bool { return srv.requests.Load() == 1 }, time.Second, time.Millisecond)
+		// Give the other callers time to join the in-flight request
+		time.Sleep(50 * time.Millisecond)
+		close(srv.release)
+	}()
+
+	statuses, results, errs := fetchConcurrently(client, 10, func(int) blobformat.Format { return blobformat.JSON })
+	for i := range results {
+		require.NoError(t, errs[i])
+		require.Equal(t, http.StatusOK, statuses[i])
+		require.Equal(t, sidecars, results[i])
+	}
+	require.Equal(t, int32(1), srv.requests.Load())
+
+	// Once the shared request has completed, the next request is made afresh
+	_, _, err := client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), srv.requests.Load())
+}
+
+func TestClient_WithDeduplicationSharesErrors(t *testing.T) {
+	srv := newBlockingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"code":500,"message":"internal error"}`))
+	})
+
+	client := NewBlobSidecarClient(srv.URL, WithDeduplication())
+	go func() {
+		require.Eventually(t, func() bool { return srv.requests.Load() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(srv.release)
+	}()
+
+	statuses, _, errs := fetchConcurrently(client, 5, func(int) blobformat.Format { return blobformat.JSON })
+	for i := range errs {
+		var statusErr *StatusError
+		require.ErrorAs(t, errs[i], &statusErr)
+		require.Equal(t, "internal error", statusErr.Message)
+		require.Equal(t, http.StatusInternalServerError, statuses[i])
+	}
+	require.Equal(t, int32(1), srv.requests.Load())
+}
+
+func TestClient_WithDeduplicationKeyedByFormat(t *testing.T) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+	srv := newBlockingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == string(blobformat.SSZ) {
+			_, _ = w.Write(ssz)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(sidecars)
+	})
+
+	client := NewBlobSidecarClient(srv.URL, WithDeduplication())
+	go func() {
+		require.Eventually(t, func() bool { return srv.requests.Load() == 2 }, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(srv.release)
+	}()
+
+	formats := []blobformat.Format{blobformat.JSON, blobformat.SSZ}
+	_, results, errs := fetchConcurrently(client, 6, func(i int) blobformat.Format { return formats[i%2] })
+	for i := range results {
+		require.NoError(t, errs[i])
+		require.Equal(t, sidecars, results[i])
+	}
+	require.Equal(t, int32(2), srv.requests.Load())
+}
+
+func TestClient_FormatAuto(t *testing.T) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+
+	brokenSSZ := false
+	var accepts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepts = append(accepts, r.Header.Get("Accept"))
+		switch {
+		case r.Header.Get("Accept") == string(blobformat.JSON):
+			_ = json.NewEncoder(w).Encode(sidecars)
+		case brokenSSZ:
+			// A truncated SSZ response
+			_, _ = w.Write([]byte{1, 2, 3})
+		default:
+			_, _ = w.Write(ssz)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewBlobSidecarClient(srv.URL)
+	fetch := func() {
+		status, result, err := client.FetchSidecars("head", blobformat.Auto)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, sidecars, result)
+	}
+
+	// SSZ is preferred
+	fetch()
+	require.Equal(t, []string{string(blobformat.SSZ)}, accepts)
+
+	// An SSZ response that fails to decode is retried in JSON, and JSON is used for the following requests
+	brokenSSZ = true
+	accepts = nil
+	fetch()
+	fetch()
+	require.Equal(t, []string{string(blobformat.SSZ), string(blobformat.JSON), string(blobformat.JSON)}, accepts)
+
+	// SSZ is tried again after a number of requests
+	brokenSSZ = false
+	for i := 1; i < autoProbeInterval; i++ {
+		fetch()
+	}
+	accepts = nil
+	fetch()
+	require.Equal(t, []string{string(blobformat.SSZ)}, accepts)
+}
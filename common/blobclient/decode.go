@@ -0,0 +1,233 @@
+package blobclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/golang/snappy"
+)
+
+// jsonResponse is a JSON encoded blob sidecars response. Some beacon clients wrap the data in an envelope that
+// includes the fork version, others only include the data.
+type jsonResponse struct {
+	Version string             `json:"version"`
+	Data    []*tolerantSidecar `json:"data"`
+	// ContinuationToken is set by proxies that split the sidecars across several responses, see nextPage
+	ContinuationToken string `json:"continuation_token"`
+}
+
+// quantity is an unsigned integer field, such as a slot or index. The beacon API spec encodes these as decimal
+// strings, but some servers send them as JSON numbers. Both encodings are accepted, and the number is parsed from its
+// literal rather than as a float64, which cannot represent every uint64 exactly.
+type quantity uint64
+
+func (q *quantity) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if len(b) >= 2 && b[0] == '"' && b[len(b)-1] == '"' {
+		s = string(b[1 : len(b)-1])
+	}
+
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid quantity %s: %w", b, err)
+	}
+
+	*q = quantity(v)
+	return nil
+}
+
+// MarshalJSON encodes the quantity as a decimal string, as required by the beacon API spec.
+func (q quantity) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatUint(uint64(q), 10))), nil
+}
+
+// tolerantSidecar is a blob sidecar that accepts its quantity fields encoded as either strings or numbers. The
+// quantity fields are normalised to strings before the sidecar is decoded by storage.BlobSidecar, which only accepts
+// strings. Pointers are used so that a missing field is still reported as missing.
+type tolerantSidecar struct {
+	storage.BlobSidecar
+}
+
+type tolerantSidecarJSON struct {
+	Index                       *quantity             `json:"index,omitempty"`
+	Blob                        json.RawMessage       `json:"blob,omitempty"`
+	KZGCommitment               json.RawMessage       `json:"kzg_commitment,omitempty"`
+	KZGProof                    json.RawMessage       `json:"kzg_proof,omitempty"`
+	SignedBlockHeader           *tolerantSignedHeader `json:"signed_block_header,omitempty"`
+	KZGCommitmentInclusionProof json.RawMessage       `json:"kzg_commitment_inclusion_proof,omitempty"`
+}
+
+type tolerantSignedHeader struct {
+	Message   *tolerantHeader `json:"message,omitempty"`
+	Signature json.RawMessage `json:"signature,omitempty"`
+}
+
+type tolerantHeader struct {
+	Slot          *quantity       `json:"slot,omitempty"`
+	ProposerIndex *quantity       `json:"proposer_index,omitempty"`
+	ParentRoot    json.RawMessage `json:"parent_root,omitempty"`
+	StateRoot     json.RawMessage `json:"state_root,omitempty"`
+	BodyRoot      json.RawMessage `json:"body_root,omitempty"`
+}
+
+func (s *tolerantSidecar) UnmarshalJSON(b []byte) error {
+	var raw tolerantSidecarJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	normalised, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return s.BlobSidecar.UnmarshalJSON(normalised)
+}
+
+// toSidecars returns the decoded sidecars. A null sidecar is not decoded by tolerantSidecar, so it is rejected here
+// rather than being returned as a nil sidecar.
+func toSidecars(data []*tolerantSidecar) ([]*storage.BlobSidecar, error) {
+	result := make([]*storage.BlobSidecar, len(data))
+	for i, sidecar := range data {
+		if sidecar == nil {
+			return nil, fmt.Errorf("failed to decode json response: sidecar %d is null", i)
+		}
+		result[i] = &sidecar.BlobSidecar
+	}
+	return result, nil
+}
+
+// decodeJSON decodes a JSON encoded blob sidecars response, returning the fork version if the response includes one.
+// Responses of the form {"version": ..., "data": [...]} and {"data": [...]} are both accepted, as is a bare list of
+// sidecars.
+func decodeJSON(r io.Reader) (storage.BlobSidecars, string, error) {
+	sidecars, version, _, err := decodeJSONPage(r)
+	return sidecars, version, err
+}
+
+// decodeJSONPage is decodeJSON for a page of a response, it also returns the continuation token of the next page if
+// there is one.
+func decodeJSONPage(r io.Reader) (storage.BlobSidecars, string, string, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return storage.BlobSidecars{}, "", "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var data []*tolerantSidecar
+		if err := json.Unmarshal(body, &data); err != nil {
+			return storage.BlobSidecars{}, "", "", fmt.Errorf("failed to decode json response: %w", err)
+		}
+		sidecars, err := toSidecars(data)
+		if err != nil {
+			return storage.BlobSidecars{}, "", "", err
+		}
+		return storage.BlobSidecars{Data: sidecars}, "", "", nil
+	}
+
+	var response jsonResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return storage.BlobSidecars{}, "", "", fmt.Errorf("failed to decode json response: %w", err)
+	}
+
+	if response.Data == nil {
+		// Without this check an unexpected response shape would silently decode as a block without blobs
+		return storage.BlobSidecars{}, "", "", fmt.Errorf("failed to decode json response: missing data field")
+	}
+
+	sidecars, err := toSidecars(response.Data)
+	if err != nil {
+		return storage.BlobSidecars{}, "", "", err
+	}
+
+	return storage.BlobSidecars{Data: sidecars}, response.Version, response.ContinuationToken, nil
+}
+
+// errSSZTooLarge is returned when an SSZ response is larger than the encoding of the most sidecars a block can have.
+var errSSZTooLarge = fmt.Errorf("ssz response exceeds %d bytes", storage.MaxBlobSidecarsSSZSize)
+
+// checkSSZSize returns an error if an SSZ response of the given size cannot be a valid encoding of sidecars. Sidecars
+// have a fixed size, so a valid response is a whole number of them, up to the most a block can have.
+func checkSSZSize(size int64) error {
+	if size > storage.MaxBlobSidecarsSSZSize {
+		return errSSZTooLarge
+	}
+	if size%storage.BlobSidecarSSZSize != 0 {
+		return fmt.Errorf("ssz response of %d bytes is not a whole number of %d byte sidecars", size, storage.BlobSidecarSSZSize)
+	}
+	return nil
+}
+
+// boundedReader fails with errSSZTooLarge as soon as more than the remaining bytes have been read, so that a response
+// is never read into memory beyond the size of the largest valid one. This includes responses that decompress to far
+// more than they were sent as.
+type boundedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	// One byte more than remains is read, to tell a response that ends at the limit from one that exceeds it
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return 0, errSSZTooLarge
+	}
+	return n, err
+}
+
+// decodeSSZ decodes an SSZ encoded blob sidecars response. The response is read into a pooled buffer, see
+// decodeBuffers, up to the size of the largest valid response, and rejected as soon as it exceeds it.
+func decodeSSZ(r io.Reader) (storage.BlobSidecars, error) {
+	buf, err := decodeBuffers.readAll(&boundedReader{r: r, remaining: storage.MaxBlobSidecarsSSZSize})
+	defer decodeBuffers.put(buf)
+	if err != nil {
+		return storage.BlobSidecars{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := checkSSZSize(int64(buf.Len())); err != nil {
+		return storage.BlobSidecars{}, fmt.Errorf("failed to decode ssz response: %w", err)
+	}
+
+	var sidecars storage.BlobSidecars
+	if err := sidecars.UnmarshalSSZ(buf.Bytes()); err != nil {
+		return storage.BlobSidecars{}, fmt.Errorf("failed to decode ssz response: %w", err)
+	}
+
+	return sidecars, nil
+}
+
+// DecodeSnappySSZ decodes blob sidecars that are SSZ encoded and compressed with the snappy framing format, as used by
+// consensus layer gossip. This allows sidecars captured from gossip to be compared directly.
+func DecodeSnappySSZ(r io.Reader) (storage.BlobSidecars, error) {
+	sidecars, err := decodeSSZ(snappy.NewReader(r))
+	if err != nil {
+		return storage.BlobSidecars{}, fmt.Errorf("snappy: %w", err)
+	}
+
+	return sidecars, nil
+}
+
+// EncodeSnappySSZ writes the blob sidecars to w, SSZ encoded and compressed with the snappy framing format.
+func EncodeSnappySSZ(w io.Writer, sidecars storage.BlobSidecars) error {
+	b, err := sidecars.MarshalSSZ()
+	if err != nil {
+		return fmt.Errorf("failed to encode ssz: %w", err)
+	}
+
+	sw := snappy.NewBufferedWriter(w)
+	if _, err := sw.Write(b); err != nil {
+		return fmt.Errorf("failed to write snappy frame: %w", err)
+	}
+
+	return sw.Close()
+}
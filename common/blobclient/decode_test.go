@@ -0,0 +1,165 @@
+package blobclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+)
+
+// requireValidSidecars checks that decoded sidecars can be used without further checks, i.e. that every sidecar and
+// its header are set, so that they can be encoded and compared.
+func requireValidSidecars(t *testing.T, sidecars storage.BlobSidecars) {
+	for i, sidecar := range sidecars.Data {
+		require.NotNil(t, sidecar, "sidecar %d", i)
+		require.NotNil(t, sidecar.SignedBlockHeader, "sidecar %d", i)
+		require.NotNil(t, sidecar.SignedBlockHeader.Message, "sidecar %d", i)
+	}
+
+	_, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+}
+
+func FuzzDecodeSSZ(f *testing.F) {
+	fixture, err := os.ReadFile("testdata/blob_sidecars.ssz_snappy")
+	require.NoError(f, err)
+	encoded, err := io.ReadAll(snappy.NewReader(bytes.NewReader(fixture)))
+	require.NoError(f, err)
+
+	f.Add(encoded)
+	// A single sidecar
+	f.Add(encoded[:len(encoded)/2])
+	f.Add(encoded[:len(encoded)-1])
+	f.Add([]byte{})
+	// Responses that are larger than any valid one, or not a whole number of sidecars
+	f.Add(make([]byte, storage.MaxBlobSidecarsSSZSize+storage.BlobSidecarSSZSize))
+	f.Add(append(bytes.Clone(encoded), 0))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sidecars, err := decodeSSZ(bytes.NewReader(data))
+		if err != nil {
+			require.Empty(t, sidecars.Data)
+			return
+		}
+
+		requireValidSidecars(t, sidecars)
+		// Sidecars have a fixed size, so a response that decodes is the encoding of the sidecars it decodes to
+		reencoded, err := sidecars.MarshalSSZ()
+		require.NoError(t, err)
+		require.Equal(t, data, reencoded)
+	})
+}
+
+func FuzzDecodeJSON(f *testing.F) {
+	sidecars := fixtureSidecars()
+	bare, err := json.Marshal(sidecars.Data)
+	require.NoError(f, err)
+	wrapped, err := json.Marshal(sidecars)
+	require.NoError(f, err)
+
+	f.Add(bare)
+	f.Add(wrapped)
+	for _, name := range []string{"blob_sidecars_string_quantities.json.gz", "blob_sidecars_numeric_quantities.json.gz", "blob_sidecars_page_1.json.gz"} {
+		f.Add(readFixture(f, name))
+	}
+	f.Add([]byte(`{"version":"deneb","data":[]}`))
+	f.Add([]byte(`{"data":[null]}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sidecars, _, _, err := decodeJSONPage(bytes.NewReader(data))
+		if err != nil {
+			require.Empty(t, sidecars.Data)
+			return
+		}
+
+		requireValidSidecars(t, sidecars)
+	})
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r    io.Reader
+	read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+// zeroReader is an endless stream of zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestDecodeSSZ_Malformed(t *testing.T) {
+	sidecars := fixtureSidecars()
+	encoded, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{
+			name: "one sidecar more than a block can have",
+			data: make([]byte, storage.MaxBlobSidecarsSSZSize+storage.BlobSidecarSSZSize),
+			err:  errSSZTooLarge.Error(),
+		},
+		{
+			name: "one byte more than the largest response",
+			data: make([]byte, storage.MaxBlobSidecarsSSZSize+1),
+			err:  errSSZTooLarge.Error(),
+		},
+		{
+			name: "truncated sidecar",
+			data: encoded[:len(encoded)-1],
+			err:  "is not a whole number",
+		},
+		{
+			name: "trailing bytes",
+			data: append(bytes.Clone(encoded), 0),
+			err:  "is not a whole number",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sidecars, err := decodeSSZ(bytes.NewReader(test.data))
+			require.ErrorContains(t, err, test.err)
+			require.Empty(t, sidecars.Data)
+		})
+	}
+}
+
+func TestDecodeSSZ_StopsReadingAtLimit(t *testing.T) {
+	r := &countingReader{r: zeroReader{}}
+	_, err := decodeSSZ(r)
+	require.ErrorIs(t, err, errSSZTooLarge)
+	require.LessOrEqual(t, r.read, int64(storage.MaxBlobSidecarsSSZSize+1))
+}
+
+func TestDecodeSnappySSZ_DecompressionBomb(t *testing.T) {
+	// 64 MiB of zeros compresses to a few KiB, and is never decompressed beyond the largest valid response
+	var compressed bytes.Buffer
+	w := snappy.NewBufferedWriter(&compressed)
+	_, err := io.CopyN(w, zeroReader{}, 64<<20)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, err = DecodeSnappySSZ(&compressed)
+	require.ErrorIs(t, err, errSSZTooLarge)
+	// The rest of the compressed response is left unread
+	require.Positive(t, compressed.Len())
+}
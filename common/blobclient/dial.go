@@ -0,0 +1,79 @@
+package blobclient
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultDialTimeout is the timeout for establishing a connection, the same as http.DefaultTransport
+	defaultDialTimeout = 30 * time.Second
+	// dualStackFallbackDelay is how long a connection attempt to the first address family is given before one to the
+	// other family is started in parallel (RFC 6555 happy eyeballs). It is shorter than the 300ms default of net.Dialer
+	// so that a dead IPv4 or IPv6 path costs little on each new connection.
+	dualStackFallbackDelay = 100 * time.Millisecond
+)
+
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:       defaultDialTimeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: dualStackFallbackDelay,
+	}
+}
+
+// WithDialer sets the dialer used to establish connections, replacing the default dialer and any earlier WithDialTimeout
+// or WithDualStack option. It has no effect if WithRoundTripper is also used.
+func WithDialer(dialer *net.Dialer) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.dialer = dialer
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing a connection, including the DNS lookup and trying each of the
+// server's addresses. It has no effect if WithRoundTripper is also used.
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.dialer.Timeout = timeout
+	}
+}
+
+// WithDualStack configures how a server with both IPv4 and IPv6 addresses is dialed. When enabled, the default, the
+// other address family is tried in parallel if the first is slow to connect (happy eyeballs). When disabled the
+// addresses are tried one after another, which may be preferable when only one address family is routable and the
+// parallel attempts are unwanted. It has no effect if WithRoundTripper is also used.
+func WithDualStack(enabled bool) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		if enabled {
+			c.dialer.FallbackDelay = dualStackFallbackDelay
+		} else {
+			c.dialer.FallbackDelay = -1
+		}
+	}
+}
+
+// WithProxy sends every request through the HTTP(S) proxy at proxyURL, e.g. "http://proxy.internal:3128", with any
+// credentials given in the URL. By default the proxy is taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables, and a nil proxyURL disables proxying even if they are set. Connections to the proxy are established with
+// the configured dialer. It has no effect if WithRoundTripper is also used.
+func WithProxy(proxyURL *url.URL) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		if proxyURL == nil {
+			c.proxy = nil
+		} else {
+			c.proxy = http.ProxyURL(proxyURL)
+		}
+	}
+}
+
+// newTransport creates a transport like http.DefaultTransport that establishes connections with dialer, and chooses
+// the proxy of each request with proxy, which may be nil to connect directly.
+func newTransport(dialer *net.Dialer, proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Set explicitly, as it is only honored by default through the proxy of http.DefaultTransport
+	transport.Proxy = proxy
+	return transport
+}
@@ -0,0 +1,104 @@
+package blobclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_WithDialTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the connection should not be established")
+	}))
+	defer srv.Close()
+
+	// The dialer stalls every connection attempt, like a dead address family, until the dial timeout expires
+	dialer := &net.Dialer{
+		ControlContext: func(ctx context.Context, _, _ string, _ syscall.RawConn) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	timeout := 100 * time.Millisecond
+	client := NewBlobSidecarClient(srv.URL, WithDialer(dialer), WithDialTimeout(timeout))
+
+	start := time.Now()
+	status, _, err := client.FetchSidecars("head", blobformat.JSON)
+	elapsed := time.Since(start)
+
+	require.Equal(t, http.StatusInternalServerError, status)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "expected a dial timeout, got %v", err)
+	require.GreaterOrEqual(t, elapsed, timeout)
+	require.Less(t, elapsed, 5*time.Second)
+}
+
+func TestClient_WithDualStack(t *testing.T) {
+	dialerOf := func(opts ...ClientOption) *net.Dialer {
+		return NewBlobSidecarClient("http://localhost", opts...).(*httpBlobSidecarClient).dialer
+	}
+
+	require.Equal(t, dualStackFallbackDelay, dialerOf().FallbackDelay)
+	require.Equal(t, defaultDialTimeout, dialerOf().Timeout)
+	require.Equal(t, time.Duration(-1), dialerOf(WithDualStack(false)).FallbackDelay)
+	require.Equal(t, dualStackFallbackDelay, dialerOf(WithDualStack(false), WithDualStack(true)).FallbackDelay)
+}
+
+func TestClient_WithProxy(t *testing.T) {
+	sidecars := fixtureSidecars()
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy is sent the absolute URL of the request
+		proxied.Store(r.URL.String())
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	// The connection to the proxy is established with the configured dialer
+	var dialed atomic.Value
+	dialer := &net.Dialer{
+		Control: func(_, address string, _ syscall.RawConn) error {
+			dialed.Store(address)
+			return nil
+		},
+	}
+
+	// The blob API's host does not resolve, so the request can only succeed through the proxy
+	client := NewBlobSidecarClient("http://blob-api.invalid", WithDialer(dialer), WithDialTimeout(time.Second), WithProxy(proxyURL))
+	status, result, err := client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, sidecars, result)
+	require.Equal(t, "http://blob-api.invalid/eth/v1/beacon/blob_sidecars/head", proxied.Load())
+	require.Equal(t, proxyURL.Host, dialed.Load())
+}
+
+func TestClient_ProxyConfiguration(t *testing.T) {
+	proxyOf := func(opts ...ClientOption) func(*http.Request) (*url.URL, error) {
+		return NewBlobSidecarClient("http://localhost", opts...).(*httpBlobSidecarClient).client.Transport.(*http.Transport).Proxy
+	}
+
+	// The environment is honored by default, and not once proxying is disabled
+	require.NotNil(t, proxyOf())
+	require.Nil(t, proxyOf(WithProxy(nil)))
+
+	proxyURL := &url.URL{Scheme: "http", Host: "proxy.internal:3128"}
+	req, err := http.NewRequest(http.MethodGet, "https://blob-api.example/eth/v1/beacon/blob_sidecars/head", nil)
+	require.NoError(t, err)
+	result, err := proxyOf(WithProxy(proxyURL))(req)
+	require.NoError(t, err)
+	require.Equal(t, proxyURL, result)
+}
@@ -0,0 +1,74 @@
+package blobclient
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is sent with every request. Setting it explicitly disables the transparent gzip support of
+// http.Transport, so decodeContentEncoding handles both encodings.
+const acceptEncoding = "gzip, zstd"
+
+// zstdDecoders pools zstd decoders, which are expensive to create, between requests.
+var zstdDecoders = sync.Pool{
+	New: func() any {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		return dec
+	},
+}
+
+// pooledZstdReader returns its decoder to the pool when closed.
+type pooledZstdReader struct {
+	*zstd.Decoder
+}
+
+func (p *pooledZstdReader) Close() error {
+	if p.Decoder == nil {
+		return nil
+	}
+
+	// Release the reference to the response body before the decoder is re-used
+	_ = p.Decoder.Reset(nil)
+	zstdDecoders.Put(p.Decoder)
+	p.Decoder = nil
+	return nil
+}
+
+// decodeContentEncoding returns a reader that decodes the response body according to the Content-Encoding the server
+// actually used, which may be gzip, zstd, or identity regardless of what was requested. Closing the returned reader
+// does not close the response body.
+func decodeContentEncoding(response *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return io.NopCloser(response.Body), nil
+	case "gzip":
+		gz, err := gzip.NewReader(response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gz, nil
+	case "zstd":
+		pooled := zstdDecoders.Get()
+		dec, ok := pooled.(*zstd.Decoder)
+		if !ok {
+			return nil, fmt.Errorf("failed to create zstd reader: %v", pooled)
+		}
+
+		if err := dec.Reset(response.Body); err != nil {
+			zstdDecoders.Put(dec)
+			return nil, fmt.Errorf("failed to reset zstd reader: %w", err)
+		}
+		return &pooledZstdReader{Decoder: dec}, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", response.Header.Get("Content-Encoding"))
+	}
+}
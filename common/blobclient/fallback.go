@@ -0,0 +1,193 @@
+package blobclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+const (
+	// latencyAlpha is the weight given to the latest sample in the latency moving average
+	latencyAlpha = 0.3
+	// errorAlpha is the weight given to the latest sample in the error rate moving average
+	errorAlpha = 0.2
+	// errorPenalty is the latency added to an endpoint's score for an error rate of 1, so an endpoint that is failing
+	// is ranked below one that is slow but healthy
+	errorPenalty = 5 * time.Second
+	// switchThreshold is the fraction of the preferred endpoint's score that another endpoint has to beat before the
+	// preferred endpoint changes. This prevents flapping between endpoints with similar, noisy measurements.
+	switchThreshold = 0.8
+)
+
+// EndpointStatus is a snapshot of the scoreboard entry for a single endpoint.
+type EndpointStatus struct {
+	URL       string  `json:"url"`
+	Preferred bool    `json:"preferred"`
+	LatencyMs float64 `json:"latencyMs"`
+	ErrorRate float64 `json:"errorRate"`
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+}
+
+type endpoint struct {
+	url      string
+	client   BlobSidecarClient
+	latency  time.Duration
+	errRate  float64
+	requests uint64
+	errors   uint64
+}
+
+// score returns the cost of using the endpoint, lower is better. Endpoints that have not been used yet have a score
+// of zero, so each endpoint is tried once before the measurements settle on the best one.
+func (e *endpoint) score() float64 {
+	return float64(e.latency) + e.errRate*float64(errorPenalty)
+}
+
+// FallbackBlobSidecarClient is a BlobSidecarClient that fetches sidecars from several blob services. It keeps a
+// scoreboard of the latency and recent error rate of each endpoint and sends each request to the currently best
+// endpoint, falling back to the others in order of score if it fails.
+type FallbackBlobSidecarClient struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	preferred int
+	now       func() time.Time
+}
+
+// NewFallbackBlobSidecarClient creates a FallbackBlobSidecarClient for the given URLs. The options are applied to the
+// client for every URL.
+func NewFallbackBlobSidecarClient(urls []string, opts ...ClientOption) *FallbackBlobSidecarClient {
+	clients := make([]BlobSidecarClient, len(urls))
+	for i, url := range urls {
+		clients[i] = NewBlobSidecarClient(url, opts...)
+	}
+	return newFallbackClient(urls, clients)
+}
+
+func newFallbackClient(urls []string, clients []BlobSidecarClient) *FallbackBlobSidecarClient {
+	result := &FallbackBlobSidecarClient{
+		now: time.Now,
+	}
+
+	for i, url := range urls {
+		result.endpoints = append(result.endpoints, &endpoint{url: url, client: clients[i]})
+	}
+
+	return result
+}
+
+// FetchSidecars fetches the sidecars from the best endpoint, trying the remaining endpoints if the request fails or the
+// endpoint returns a server error. Any other response, including a 404, is returned as-is as it is an answer from a
+// healthy endpoint.
+func (c *FallbackBlobSidecarClient) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	var (
+		status   int
+		sidecars storage.BlobSidecars
+		err      error
+	)
+
+	for _, e := range c.order() {
+		start := c.now()
+		status, sidecars, err = e.client.FetchSidecars(id, format)
+		failed := status >= http.StatusInternalServerError || IsFetchError(err)
+		c.record(e, c.now().Sub(start), failed)
+
+		if !failed {
+			return status, sidecars, err
+		}
+	}
+
+	return status, sidecars, err
+}
+
+// Retries returns true if the client of any endpoint retries failed requests, see Retrier.
+func (c *FallbackBlobSidecarClient) Retries() bool {
+	for _, e := range c.endpoints {
+		if r, ok := e.client.(Retrier); ok && r.Retries() {
+			return true
+		}
+	}
+	return false
+}
+
+// order returns the endpoints in the order they should be tried, the preferred endpoint first.
+func (c *FallbackBlobSidecarClient) order() []*endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]*endpoint, len(c.endpoints))
+	copy(result, c.endpoints)
+
+	preferred := c.endpoints[c.preferred]
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i] == preferred || result[j] == preferred {
+			return result[i] == preferred
+		}
+		return result[i].score() < result[j].score()
+	})
+
+	return result
+}
+
+// record updates the scoreboard with the result of a request, and re-evaluates the preferred endpoint.
+func (c *FallbackBlobSidecarClient) record(e *endpoint, latency time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sample := 0.0
+	if failed {
+		sample = 1.0
+		e.errors++
+	} else if e.requests == e.errors {
+		// The first successful request seeds the average rather than being blended with zero
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyAlpha*float64(latency) + (1-latencyAlpha)*float64(e.latency))
+	}
+	e.errRate = errorAlpha*sample + (1-errorAlpha)*e.errRate
+	e.requests++
+
+	best := c.preferred
+	for i, candidate := range c.endpoints {
+		if candidate.score() < c.endpoints[best].score() {
+			best = i
+		}
+	}
+
+	if best != c.preferred && c.endpoints[best].score() < switchThreshold*c.endpoints[c.preferred].score() {
+		c.preferred = best
+	}
+}
+
+// Status returns a snapshot of the scoreboard, in the order the endpoints were configured.
+func (c *FallbackBlobSidecarClient) Status() []EndpointStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]EndpointStatus, len(c.endpoints))
+	for i, e := range c.endpoints {
+		result[i] = EndpointStatus{
+			URL:       e.url,
+			Preferred: i == c.preferred,
+			LatencyMs: float64(e.latency) / float64(time.Millisecond),
+			ErrorRate: e.errRate,
+			Requests:  e.requests,
+			Errors:    e.errors,
+		}
+	}
+
+	return result
+}
+
+// ServeHTTP writes the scoreboard as JSON, this is served on /status.
+func (c *FallbackBlobSidecarClient) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.Status()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,147 @@
+package blobclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+type timedClient struct {
+	clock   *fakeClock
+	latency time.Duration
+	status  int
+	err     error
+	calls   int
+}
+
+func (t *timedClient) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	t.calls++
+	t.clock.now = t.clock.now.Add(t.latency)
+	return t.status, storage.BlobSidecars{}, t.err
+}
+
+func setupFallback(clients ...*timedClient) *FallbackBlobSidecarClient {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	urls := make([]string, len(clients))
+	stubs := make([]BlobSidecarClient, len(clients))
+	for i, c := range clients {
+		c.clock = clock
+		urls[i] = string(rune('a' + i))
+		stubs[i] = c
+	}
+
+	result := newFallbackClient(urls, stubs)
+	result.now = clock.Now
+	return result
+}
+
+func TestFallback_PrefersFastestEndpoint(t *testing.T) {
+	slow := &timedClient{latency: 500 * time.Millisecond, status: 200}
+	fast := &timedClient{latency: 50 * time.Millisecond, status: 200}
+	c := setupFallback(slow, fast)
+
+	for i := 0; i < 10; i++ {
+		status, _, err := c.FetchSidecars("head", blobformat.JSON)
+		require.NoError(t, err)
+		require.Equal(t, 200, status)
+	}
+
+	require.Equal(t, 1, slow.calls)
+	require.Equal(t, 9, fast.calls)
+	require.True(t, c.Status()[1].Preferred)
+}
+
+func TestFallback_FallsBackOnFailure(t *testing.T) {
+	down := &timedClient{latency: time.Millisecond, status: 500, err: errors.New("connection refused")}
+	up := &timedClient{latency: 100 * time.Millisecond, status: 200}
+	c := setupFallback(down, up)
+
+	status, _, err := c.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, 200, status)
+	require.Equal(t, 1, down.calls)
+	require.Equal(t, 1, up.calls)
+
+	// The failing endpoint is no longer preferred, so subsequent requests go straight to the healthy endpoint
+	_, _, err = c.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, 1, down.calls)
+	require.Equal(t, 2, up.calls)
+
+	status2 := c.Status()
+	require.Equal(t, uint64(1), status2[0].Errors)
+	require.Greater(t, status2[0].ErrorRate, 0.0)
+	require.True(t, status2[1].Preferred)
+}
+
+func TestFallback_NotFoundIsNotAFailure(t *testing.T) {
+	first := &timedClient{latency: time.Millisecond, status: 404, err: &StatusError{StatusCode: 404}}
+	second := &timedClient{latency: time.Millisecond, status: 200}
+	c := setupFallback(first, second)
+
+	status, _, err := c.FetchSidecars("head", blobformat.JSON)
+	require.Equal(t, 404, status)
+	require.Error(t, err)
+	require.Equal(t, 0, second.calls)
+}
+
+func TestFallback_Hysteresis(t *testing.T) {
+	a := &timedClient{latency: 100 * time.Millisecond, status: 200}
+	b := &timedClient{latency: 90 * time.Millisecond, status: 200}
+	c := setupFallback(a, b)
+
+	_, _, err := c.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	_, _, err = c.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.True(t, c.Status()[1].Preferred)
+
+	// b is now slightly slower than a, which is within the noise and should not cause a switch
+	b.latency = 110 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		_, _, err := c.FetchSidecars("head", blobformat.JSON)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, a.calls)
+	require.True(t, c.Status()[1].Preferred)
+
+	// b is now significantly slower than a, so the client switches
+	b.latency = 500 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		_, _, err := c.FetchSidecars("head", blobformat.JSON)
+		require.NoError(t, err)
+	}
+	require.Greater(t, a.calls, 1)
+	require.True(t, c.Status()[0].Preferred)
+}
+
+func TestFallback_StatusHandler(t *testing.T) {
+	c := setupFallback(&timedClient{latency: time.Millisecond, status: 200}, &timedClient{status: 200})
+	_, _, err := c.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status []EndpointStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, c.Status(), status)
+	require.Equal(t, "a", status[0].URL)
+	require.Equal(t, uint64(1), status[0].Requests)
+}
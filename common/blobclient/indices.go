@@ -0,0 +1,191 @@
+package blobclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/forks"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// IndicesError is returned by FetchSidecarIndices when a requested index cannot be in a block of the fork, so the
+// request is not sent.
+type IndicesError struct {
+	Index uint64
+	Max   uint64
+	// Fork is the fork the maximum was taken from, empty if the maximum was set with WithMaxBlobsPerBlock
+	Fork string
+}
+
+func (e *IndicesError) Error() string {
+	if e.Fork == "" {
+		return fmt.Sprintf("invalid index %d, blocks have at most %d blobs", e.Index, e.Max)
+	}
+	return fmt.Sprintf("invalid index %d, %s blocks have at most %d blobs", e.Index, e.Fork, e.Max)
+}
+
+// IndexedBlobSidecarClient is a BlobSidecarClient that can also fetch a subset of the sidecars of a block.
+type IndexedBlobSidecarClient interface {
+	BlobSidecarClient
+	// FetchSidecarIndices fetches the sidecars with the given indices for a block, or every sidecar if indices is
+	// empty. If an index cannot be in a block of the current fork, an *IndicesError is returned with
+	// http.StatusBadRequest without making a request.
+	FetchSidecarIndices(id string, indices []uint64, format blobformat.Format) (int, storage.BlobSidecars, error)
+	// FetchPartialSidecarIndices fetches the sidecars with the given indices for a block like FetchSidecarIndices, but
+	// succeeds with the indices that the server can provide rather than failing if it cannot provide them all, see
+	// PartialSidecars. If the server responds to the request with a 404, each index is requested individually. A 404
+	// with a *StatusError is only returned if none of the indices could be provided.
+	FetchPartialSidecarIndices(id string, indices []uint64, format blobformat.Format) (int, PartialSidecars, error)
+}
+
+// PartialSidecars is the result of FetchPartialSidecarIndices. It separates the requested indices that the server
+// returned from those it could not provide, so that the indices missing from an archive can be repaired.
+type PartialSidecars struct {
+	// Sidecars are the requested sidecars that the server returned, in index order
+	Sidecars storage.BlobSidecars
+	// Missing are the requested indices that the server could not provide, in ascending order
+	Missing []uint64
+}
+
+// WithFork sets the fork that requested indices are checked against, e.g. "deneb". By default the fork of the most
+// recent response is used, or the allowed fork if WithAllowedForks is given a single fork.
+func WithFork(fork string) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.fork = strings.ToLower(fork)
+	}
+}
+
+// WithMaxBlobsPerBlock sets the maximum number of blobs in a block that requested indices are checked against,
+// overriding the maximum of the fork. This allows indices to be checked for forks that the client does not know
+// about yet.
+func WithMaxBlobsPerBlock(max uint64) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.maxBlobs = max
+	}
+}
+
+// currentFork returns the fork that requested indices are checked against, or "" if it is not known.
+func (c *httpBlobSidecarClient) currentFork() string {
+	if c.fork != "" {
+		return c.fork
+	}
+	if fork, _ := c.seenFork.Load().(string); fork != "" {
+		return fork
+	}
+	if len(c.allowedForks) == 1 {
+		return c.allowedForks[0]
+	}
+	return ""
+}
+
+// checkIndices returns an *IndicesError if an index is not below the maximum number of blobs in a block. Indices are
+// not checked if the maximum is not known.
+func (c *httpBlobSidecarClient) checkIndices(indices []uint64) error {
+	max, fork := c.maxBlobs, ""
+	if max == 0 {
+		fork = c.currentFork()
+		max = forks.MaxBlobsPerBlock(fork)
+	}
+	if max == 0 {
+		return nil
+	}
+
+	for _, index := range indices {
+		if index >= max {
+			return &IndicesError{Index: index, Max: max, Fork: fork}
+		}
+	}
+	return nil
+}
+
+// sidecarsURL returns the URL of the blob sidecars endpoint for a block, with the indices query if any are given.
+func (c *httpBlobSidecarClient) sidecarsURL(id string, indices []uint64) string {
+	result := fmt.Sprintf("%s/eth/%s/beacon/blob_sidecars/%s", c.url, c.apiVersion, id)
+	if len(indices) == 0 {
+		return result
+	}
+
+	values := make([]string, len(indices))
+	for i, index := range indices {
+		values[i] = strconv.FormatUint(index, 10)
+	}
+	return result + "?" + url.Values{"indices": {strings.Join(values, ",")}}.Encode()
+}
+
+func (c *httpBlobSidecarClient) FetchPartialSidecarIndices(id string, indices []uint64, format blobformat.Format) (int, PartialSidecars, error) {
+	indices = slices.Clone(indices)
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+
+	status, sidecars, err := c.FetchSidecarIndices(id, indices, format)
+	if status == http.StatusNotFound && len(indices) == 1 {
+		return status, PartialSidecars{Missing: indices}, err
+	}
+	if len(indices) > 1 && (status == http.StatusNotFound || errors.Is(err, errIncompletePages)) {
+		// The server either rejects a request for an index it does not have, or it lost the page that held one.
+		// Either way, requesting each index on its own tells the indices it has from those it does not.
+		return c.fetchEachIndex(id, indices, format)
+	}
+	if err != nil {
+		return status, PartialSidecars{}, err
+	}
+	if len(indices) == 0 {
+		return status, PartialSidecars{Sidecars: sidecars}, nil
+	}
+
+	return status, partialSidecars(sidecars, indices), nil
+}
+
+// fetchEachIndex fetches the sidecars with the given sorted indices one index at a time, for servers that respond with
+// a 404 if any of the requested indices is missing.
+func (c *httpBlobSidecarClient) fetchEachIndex(id string, indices []uint64, format blobformat.Format) (int, PartialSidecars, error) {
+	var result PartialSidecars
+	var notFound error
+	for _, index := range indices {
+		status, sidecars, err := c.FetchSidecarIndices(id, []uint64{index}, format)
+		if status == http.StatusNotFound {
+			result.Missing = append(result.Missing, index)
+			notFound = err
+			continue
+		}
+		if err != nil {
+			return status, PartialSidecars{}, fmt.Errorf("failed to fetch index %d: %w", index, err)
+		}
+
+		partial := partialSidecars(sidecars, []uint64{index})
+		result.Sidecars.Data = append(result.Sidecars.Data, partial.Sidecars.Data...)
+		result.Missing = append(result.Missing, partial.Missing...)
+	}
+
+	if len(result.Sidecars.Data) == 0 {
+		return http.StatusNotFound, result, notFound
+	}
+	return http.StatusOK, result, nil
+}
+
+// partialSidecars returns the sidecars of a response that have one of the given sorted indices, in index order, and
+// the indices that the response does not have a sidecar for.
+func partialSidecars(sidecars storage.BlobSidecars, indices []uint64) PartialSidecars {
+	byIndex := make(map[uint64]*storage.BlobSidecar, len(sidecars.Data))
+	for _, sidecar := range sidecars.Data {
+		if _, ok := byIndex[uint64(sidecar.Index)]; !ok {
+			byIndex[uint64(sidecar.Index)] = sidecar
+		}
+	}
+
+	result := PartialSidecars{Sidecars: storage.BlobSidecars{Data: []*storage.BlobSidecar{}}}
+	for _, index := range indices {
+		if sidecar, ok := byIndex[index]; ok {
+			result.Sidecars.Data = append(result.Sidecars.Data, sidecar)
+		} else {
+			result.Missing = append(result.Missing, index)
+		}
+	}
+	return result
+}
@@ -0,0 +1,199 @@
+package blobclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newIndicesServer returns a server that responds with the fixture sidecars of the requested indices, reporting the
+// given fork, and records the indices query of each request.
+func newIndicesServer(t *testing.T, fork string) (*httptest.Server, *[]string) {
+	sidecars := fixtureSidecars()
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("indices"))
+		if fork != "" {
+			w.Header().Set(consensusVersionHeader, fork)
+		}
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &queries
+}
+
+func TestClient_FetchSidecarIndices(t *testing.T) {
+	srv, queries := newIndicesServer(t, "")
+	client := NewBlobSidecarClient(srv.URL, WithFork("deneb"))
+
+	status, result, err := client.FetchSidecarIndices("head", []uint64{0, 1}, blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, fixtureSidecars(), result)
+	require.Equal(t, []string{"0,1"}, *queries)
+
+	// An index that cannot be in a deneb block is rejected without a request
+	status, _, err = client.FetchSidecarIndices("head", []uint64{1, 6}, blobformat.JSON)
+	require.Equal(t, http.StatusBadRequest, status)
+	var indicesErr *IndicesError
+	require.ErrorAs(t, err, &indicesErr)
+	require.Equal(t, IndicesError{Index: 6, Max: 6, Fork: "deneb"}, *indicesErr)
+	require.Len(t, *queries, 1)
+
+	// Without indices every sidecar is requested
+	_, _, err = client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0,1", ""}, *queries)
+}
+
+func TestClient_FetchSidecarIndicesFork(t *testing.T) {
+	tests := []struct {
+		name    string
+		fork    string
+		opts    []ClientOption
+		allowed uint64
+		err     *IndicesError
+	}{
+		{
+			name:    "fork of the last response",
+			fork:    "Electra",
+			allowed: 8,
+			err:     &IndicesError{Index: 9, Max: 9, Fork: "electra"},
+		},
+		{
+			name:    "single allowed fork",
+			opts:    []ClientOption{WithAllowedForks([]string{"deneb"})},
+			allowed: 5,
+			err:     &IndicesError{Index: 9, Max: 6, Fork: "deneb"},
+		},
+		{
+			name:    "unknown fork",
+			fork:    "fulu",
+			allowed: 9,
+		},
+		{
+			name:    "overridden maximum",
+			fork:    "fulu",
+			opts:    []ClientOption{WithMaxBlobsPerBlock(4)},
+			allowed: 3,
+			err:     &IndicesError{Index: 9, Max: 4},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, _ := newIndicesServer(t, test.fork)
+			client := NewBlobSidecarClient(srv.URL, test.opts...)
+
+			// The first response reports the fork
+			_, _, err := client.FetchSidecars("head", blobformat.JSON)
+			require.NoError(t, err)
+
+			_, _, err = client.FetchSidecarIndices("head", []uint64{test.allowed}, blobformat.JSON)
+			require.NoError(t, err)
+
+			_, _, err = client.FetchSidecarIndices("head", []uint64{9}, blobformat.JSON)
+			if test.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			var indicesErr *IndicesError
+			require.ErrorAs(t, err, &indicesErr)
+			require.Equal(t, *test.err, *indicesErr)
+		})
+	}
+}
+
+func TestClient_FetchSidecarIndicesNoFork(t *testing.T) {
+	srv, queries := newIndicesServer(t, "")
+	client := NewBlobSidecarClient(srv.URL)
+
+	// Without a known fork the indices are left to the server to check
+	_, _, err := client.FetchSidecarIndices("head", []uint64{100}, blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, []string{"100"}, *queries)
+}
+
+func TestMergePages_Indices(t *testing.T) {
+	fixture := fixtureSidecars().Data
+	sidecars := []*storage.BlobSidecar{fixture[1], fixture[1]}
+
+	result, err := mergePages(sidecars, []uint64{1})
+	require.NoError(t, err)
+	require.Equal(t, storage.BlobSidecars{Data: fixture[1:]}, result)
+
+	_, err = mergePages(sidecars, []uint64{0, 1})
+	require.ErrorContains(t, err, "missing index 0")
+}
+
+// newPartialServer returns a server holding the fixture sidecars, indices 0 and 1, that responds with those of the
+// requested indices it has. If strict is set it responds with a 404 if it does not have every requested index.
+func newPartialServer(t *testing.T, strict bool) (*httptest.Server, *[]string) {
+	fixture := fixtureSidecars().Data
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("indices")
+		queries = append(queries, query)
+
+		result := storage.BlobSidecars{Data: []*storage.BlobSidecar{}}
+		for _, value := range strings.Split(query, ",") {
+			index, err := strconv.Atoi(value)
+			require.NoError(t, err)
+			if index < len(fixture) {
+				result.Data = append(result.Data, fixture[index])
+			} else if strict {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"code":404,"message":"blob not found"}`))
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &queries
+}
+
+func TestClient_FetchPartialSidecarIndices(t *testing.T) {
+	fixture := fixtureSidecars().Data
+
+	srv, queries := newPartialServer(t, false)
+	client := NewBlobSidecarClient(srv.URL)
+
+	status, result, err := client.FetchPartialSidecarIndices("head", []uint64{3, 1, 0, 1}, blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, storage.BlobSidecars{Data: fixture}, result.Sidecars)
+	require.Equal(t, []uint64{3}, result.Missing)
+	require.Equal(t, []string{"0,1,3"}, *queries)
+}
+
+func TestClient_FetchPartialSidecarIndicesEachIndex(t *testing.T) {
+	fixture := fixtureSidecars().Data
+
+	srv, queries := newPartialServer(t, true)
+	client := NewBlobSidecarClient(srv.URL)
+
+	// The server rejects the request as a whole, so each index is requested on its own
+	status, result, err := client.FetchPartialSidecarIndices("head", []uint64{1, 4, 3}, blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, storage.BlobSidecars{Data: fixture[1:]}, result.Sidecars)
+	require.Equal(t, []uint64{3, 4}, result.Missing)
+	require.Equal(t, []string{"1,3,4", "1", "3", "4"}, *queries)
+
+	// If none of the indices can be provided, the 404 is returned
+	status, result, err = client.FetchPartialSidecarIndices("head", []uint64{5, 6}, blobformat.JSON)
+	require.Equal(t, http.StatusNotFound, status)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, "blob not found", statusErr.Message)
+	require.Empty(t, result.Sidecars.Data)
+	require.Equal(t, []uint64{5, 6}, result.Missing)
+}
@@ -0,0 +1,120 @@
+package blobclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+const (
+	// maxPages is the maximum number of pages followed for the sidecars of a single block
+	maxPages = 16
+	// continuationTokenParam is the query parameter the continuation token of a JSON response is sent back in
+	continuationTokenParam = "continuation_token"
+)
+
+// errIncompletePages is returned by mergePages if the pages of a response do not hold every sidecar.
+var errIncompletePages = errors.New("incomplete sidecars after following pages")
+
+// nextPage returns the URL of the next page of a response, or "" if it is the last page. The beacon API does not
+// paginate blob sidecars, but some proxies split a block's sidecars across several responses. The next page is given
+// either by a Link header with rel="next", or by a continuation token in a JSON response, which is sent back as the
+// continuation_token query parameter of the original request.
+func nextPage(request *url.URL, header http.Header, token string) (string, error) {
+	for _, link := range header.Values("Link") {
+		if ref, ok := parseNextLink(link); ok {
+			next, err := request.Parse(ref)
+			if err != nil {
+				return "", fmt.Errorf("invalid next page link %q: %w", ref, err)
+			}
+			return next.String(), nil
+		}
+	}
+
+	if token == "" {
+		return "", nil
+	}
+
+	next := *request
+	query := next.Query()
+	query.Set(continuationTokenParam, token)
+	next.RawQuery = query.Encode()
+	return next.String(), nil
+}
+
+// parseNextLink returns the target of the rel="next" link in a Link header value, e.g. `<...?page=2>; rel="next"`.
+func parseNextLink(header string) (string, bool) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		ref := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(ref, "<") || !strings.HasSuffix(ref, ">") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if !strings.EqualFold(name, "rel") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+				if strings.EqualFold(rel, "next") {
+					return ref[1 : len(ref)-1], true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// mergePages combines the sidecars from every page of a response. Sidecars repeated across pages are only included
+// once, and the result must hold every requested index, or if no indices were requested every index from 0 up to the
+// highest index seen, otherwise a page has been lost.
+func mergePages(sidecars []*storage.BlobSidecar, indices []uint64) (storage.BlobSidecars, error) {
+	byIndex := make(map[deneb.BlobIndex]*storage.BlobSidecar, len(sidecars))
+	for _, sidecar := range sidecars {
+		if existing, ok := byIndex[sidecar.Index]; ok {
+			if !sameSidecar(existing, sidecar) {
+				return storage.BlobSidecars{}, fmt.Errorf("pages contain different sidecars for index %d", sidecar.Index)
+			}
+			continue
+		}
+		byIndex[sidecar.Index] = sidecar
+	}
+
+	result := make([]*storage.BlobSidecar, 0, len(byIndex))
+	for _, sidecar := range byIndex {
+		result = append(result, sidecar)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Index < result[j].Index })
+
+	if len(indices) > 0 {
+		for _, index := range indices {
+			if _, ok := byIndex[deneb.BlobIndex(index)]; !ok {
+				return storage.BlobSidecars{}, fmt.Errorf("%w, missing index %d", errIncompletePages, index)
+			}
+		}
+		return storage.BlobSidecars{Data: result}, nil
+	}
+
+	for i, sidecar := range result {
+		if sidecar.Index != deneb.BlobIndex(i) {
+			return storage.BlobSidecars{}, fmt.Errorf("%w, missing index %d", errIncompletePages, i)
+		}
+	}
+
+	return storage.BlobSidecars{Data: result}, nil
+}
+
+func sameSidecar(a, b *storage.BlobSidecar) bool {
+	aSSZ, errA := a.MarshalSSZ()
+	bSSZ, errB := b.MarshalSSZ()
+	return errA == nil && errB == nil && bytes.Equal(aSSZ, bSSZ)
+}
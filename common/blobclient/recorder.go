@@ -0,0 +1,213 @@
+package blobclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// redacted replaces the value of credentials in recordings.
+const redacted = "REDACTED"
+
+// redactedHeaders are the headers whose values are replaced in recordings, as they carry credentials.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Recording is a request and its response, as saved by WithRecorder and served by ReplayFrom. Body is the raw body of
+// the response, before any content encoding is decoded, so a replayed response is decoded exactly as the original.
+type Recording struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	Body            []byte      `json:"body"`
+}
+
+// WithRecorder saves each request made by the client and its response to a file in dir, so that a response that fails
+// to decode or validate can be replayed with ReplayFrom and debugged offline. Credentials in headers and in the URL are
+// redacted. Failing to save a recording is logged and does not fail the request.
+func WithRecorder(dir string) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.recordDir = dir
+	}
+}
+
+// recorder is an http.RoundTripper that saves each request and its response to a directory.
+type recorder struct {
+	next http.RoundTripper
+	dir  string
+	log  log.Logger
+	// prefix orders the recordings of this recorder after those of earlier runs, and seq orders them within the run
+	prefix string
+	seq    atomic.Uint64
+}
+
+func newRecorder(next http.RoundTripper, dir string, l log.Logger) *recorder {
+	return &recorder{
+		next:   next,
+		dir:    dir,
+		log:    l,
+		prefix: time.Now().UTC().Format("20060102T150405.000000000"),
+	}
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	recording := Recording{
+		Method:          req.Method,
+		URL:             redactURL(req.URL),
+		RequestHeaders:  redactHeaders(req.Header),
+		Status:          response.StatusCode,
+		ResponseHeaders: redactHeaders(response.Header),
+		Body:            body,
+	}
+	if err := r.save(recording); err != nil {
+		r.log.Warn("failed to save recording", "url", recording.URL, "err", err)
+	}
+
+	return response, nil
+}
+
+func (r *recorder) save(recording Recording) error {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%06d.json", r.prefix, r.seq.Add(1))
+	return os.WriteFile(filepath.Join(r.dir, name), data, 0644)
+}
+
+// redactHeaders returns a copy of headers with the values of credentials replaced.
+func redactHeaders(headers http.Header) http.Header {
+	result := headers.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := result[name]; ok {
+			result.Set(name, redacted)
+		}
+	}
+	return result
+}
+
+// redactURL returns u with the password of any user info replaced.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redactedURL := *u
+	if _, ok := u.User.Password(); ok {
+		redactedURL.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return redactedURL.String()
+}
+
+// ReplayFrom creates a client that serves the responses recorded by WithRecorder in dir, for use in tests. A request
+// is matched to the recordings of the same method, path, query and Accept header, ignoring the host, so recordings of
+// any server can be replayed. Matching recordings are served in the order they were recorded, the last being
+// repeated once they are used up. A request that matches no recording fails.
+func ReplayFrom(dir string, opts ...ClientOption) (IndexedBlobSidecarClient, error) {
+	replayer, err := newReplayer(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlobSidecarClient("http://replay", append(opts, WithRoundTripper(replayer))...), nil
+}
+
+// replayer is an http.RoundTripper that serves recorded responses.
+type replayer struct {
+	mu         sync.Mutex
+	recordings map[string][]Recording
+}
+
+func newReplayer(dir string) (*replayer, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	r := &replayer{recordings: make(map[string][]Recording)}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+
+		var recording Recording
+		if err := json.Unmarshal(data, &recording); err != nil {
+			return nil, fmt.Errorf("failed to decode recording %s: %w", filepath.Base(name), err)
+		}
+
+		u, err := url.Parse(recording.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url in recording %s: %w", filepath.Base(name), err)
+		}
+
+		key := replayKey(recording.Method, u, recording.RequestHeaders)
+		r.recordings[key] = append(r.recordings[key], recording)
+	}
+
+	if len(r.recordings) == 0 {
+		return nil, fmt.Errorf("no recordings in %s", dir)
+	}
+	return r, nil
+}
+
+func replayKey(method string, u *url.URL, headers http.Header) string {
+	return strings.Join([]string{method, u.RequestURI(), headers.Get("Accept")}, " ")
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := replayKey(req.Method, req.URL, req.Header)
+
+	r.mu.Lock()
+	recordings := r.recordings[key]
+	if len(recordings) > 1 {
+		r.recordings[key] = recordings[1:]
+	}
+	r.mu.Unlock()
+
+	if len(recordings) == 0 {
+		return nil, fmt.Errorf("no recording of %s", key)
+	}
+
+	recording := recordings[0]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recording.Status, http.StatusText(recording.Status)),
+		StatusCode:    recording.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recording.ResponseHeaders.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(recording.Body)),
+		ContentLength: int64(len(recording.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package blobclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	sidecars := fixtureSidecars()
+	ssz, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+	gzipped := compress(t, "gzip", ssz)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/missing"):
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"message":"block not found"}`))
+		case r.Header.Get("Accept") == string(blobformat.JSON):
+			_ = json.NewEncoder(w).Encode(sidecars)
+		default:
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped)
+		}
+	}))
+	defer srv.Close()
+
+	// Credentials in the URL are sent as an Authorization header, and must be redacted from both
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	u.User = url.UserPassword("user", "secret")
+
+	dir := t.TempDir()
+	client := NewBlobSidecarClient(u.String(), WithRecorder(dir))
+	for _, format := range []blobformat.Format{blobformat.SSZ, blobformat.JSON} {
+		status, result, err := client.FetchSidecars("head", format)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, sidecars, result)
+	}
+	status, _, err := client.FetchSidecars("missing", blobformat.JSON)
+	require.Equal(t, http.StatusNotFound, status)
+	require.ErrorContains(t, err, "block not found")
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "secret")
+		require.NotContains(t, string(data), "dXNlcjpzZWNyZXQ")
+
+		var recording Recording
+		require.NoError(t, json.Unmarshal(data, &recording))
+		require.Equal(t, redacted, recording.RequestHeaders.Get("Authorization"))
+	}
+
+	replay, err := ReplayFrom(dir)
+	require.NoError(t, err)
+	for _, format := range []blobformat.Format{blobformat.SSZ, blobformat.JSON} {
+		status, result, err := replay.FetchSidecars("head", format)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, sidecars, result)
+	}
+	status, _, err = replay.FetchSidecars("missing", blobformat.JSON)
+	require.Equal(t, http.StatusNotFound, status)
+	require.ErrorContains(t, err, "block not found")
+
+	// Requests that were not recorded fail
+	_, _, err = replay.FetchSidecars("finalized", blobformat.JSON)
+	require.ErrorContains(t, err, "no recording")
+}
+
+func TestReplayFrom_Errors(t *testing.T) {
+	_, err := ReplayFrom(t.TempDir())
+	require.ErrorContains(t, err, "no recordings")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0644))
+	_, err = ReplayFrom(dir)
+	require.ErrorContains(t, err, "failed to decode recording bad.json")
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer token")
+	headers.Set("X-Api-Key", "key")
+	headers.Set("Accept", string(blobformat.SSZ))
+
+	result := redactHeaders(headers)
+	require.Equal(t, redacted, result.Get("Authorization"))
+	require.Equal(t, redacted, result.Get("X-Api-Key"))
+	require.Equal(t, string(blobformat.SSZ), result.Get("Accept"))
+	require.Empty(t, result.Get("Cookie"))
+	// The original headers are left as they are
+	require.Equal(t, "Bearer token", headers.Get("Authorization"))
+}
@@ -0,0 +1,134 @@
+package blobclient
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryAfter is the longest delay requested by a Retry-After header that the client waits for, so that a server
+// cannot stall a validation run indefinitely.
+const maxRetryAfter = 5 * time.Minute
+
+// RetryConfig configures the timeout and retries of the requests of a BlobSidecarClient, see WithRetries.
+type RetryConfig struct {
+	// Timeout is the timeout of each request, including reading the response body. Zero does not time requests out
+	Timeout time.Duration
+	// MaxRetries is the number of times a request is retried after a connection error or a retryable status (5xx or
+	// 429), zero disables retries
+	MaxRetries int
+	// MinBackoff is the delay before the first retry, which doubles with each retry up to MaxBackoff. Each delay is
+	// shortened by a random jitter of up to half of it, so that clients that fail together do not retry together
+	MinBackoff time.Duration
+	// MaxBackoff is the longest delay between retries, maxRetryAfter if zero
+	MaxBackoff time.Duration
+}
+
+// Retrier is implemented by clients that retry failed requests themselves. A caller that retries failed fetches should
+// not retry the fetches of a client whose Retries returns true, as every retry of the caller would be retried again.
+type Retrier interface {
+	// Retries returns true if failed requests are retried by the client
+	Retries() bool
+}
+
+// WithRetries sets the timeout of each request, and retries requests that fail with a connection error or a
+// retryable status with an exponential backoff. A Retry-After header on a retryable response is honored if it asks for
+// a longer delay than the backoff, up to maxRetryAfter. Each page of a paginated response is retried on its own. By
+// default requests do not time out and are not retried.
+func WithRetries(cfg RetryConfig) ClientOption {
+	return func(c *httpBlobSidecarClient) {
+		c.retry = cfg
+		c.client.Timeout = cfg.Timeout
+	}
+}
+
+// Retries returns true if requests are retried, see WithRetries.
+func (c *httpBlobSidecarClient) Retries() bool {
+	return c.retry.MaxRetries > 0
+}
+
+// backoff returns the delay before retry number attempt, counted from 0, with jitter.
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	limit := r.MaxBackoff
+	if limit <= 0 {
+		limit = maxRetryAfter
+	}
+	delay := r.MinBackoff
+	for i := 0; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+	if delay <= 1 {
+		return delay
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a response, in either delay-seconds or
+// HTTP-date form, and false if the header is missing or invalid.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// ShouldRetry returns true if the status code is one of the retryable status codes
+func ShouldRetry(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends the request, retrying it as configured by WithRetries. The response to the last attempt is returned, so a
+// request that is still failing after the retries returns its error or status as if it had not been retried.
+func (c *httpBlobSidecarClient) do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := c.client.Do(req)
+		if attempt >= c.retry.MaxRetries || (err == nil && !ShouldRetry(response.StatusCode)) {
+			return response, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		if err == nil {
+			if requested, ok := retryAfter(response.Header, time.Now()); ok {
+				delay = max(delay, min(requested, maxRetryAfter))
+			}
+			// The body is drained so that the connection can be reused for the retry
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxErrorBodySize))
+			response.Body.Close()
+			c.log.Warn("retrying request", "url", req.URL.Redacted(), "status", response.StatusCode, "attempt", attempt+1, "delay", delay)
+		} else {
+			c.log.Warn("retrying request", "url", req.URL.Redacted(), "err", err, "attempt", attempt+1, "delay", delay)
+		}
+		if err := c.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleep waits for d, returning the error of ctx if it ends first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,223 @@
+package blobclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// failingRoundTripper fails the first failures requests with a connection error.
+type failingRoundTripper struct {
+	failures int
+	requests int
+}
+
+func (f *failingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.requests++
+	if f.requests <= f.failures {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// recordSleeps makes the client record the delays between its attempts rather than waiting for them.
+func recordSleeps(client IndexedBlobSidecarClient) *[]time.Duration {
+	var sleeps []time.Duration
+	client.(*httpBlobSidecarClient).sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return &sleeps
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	cfg := RetryConfig{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := cfg.backoff(attempt)
+			require.LessOrEqual(t, delay, expected)
+			require.Greater(t, delay, expected/2)
+		}
+	}
+
+	// Without a maximum, the delay is capped at maxRetryAfter
+	require.LessOrEqual(t, RetryConfig{MinBackoff: time.Minute}.backoff(10), maxRetryAfter)
+	require.Zero(t, RetryConfig{}.backoff(3))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+	header := func(value string) http.Header {
+		return http.Header{"Retry-After": []string{value}}
+	}
+
+	delay, ok := retryAfter(header("120"), now)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = retryAfter(header(now.Add(30*time.Second).Format(http.TimeFormat)), now)
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, delay)
+
+	delay, ok = retryAfter(header(now.Add(-time.Minute).Format(http.TimeFormat)), now)
+	require.True(t, ok)
+	require.Zero(t, delay)
+
+	for _, value := range []string{"", "soon", "-5"} {
+		_, ok = retryAfter(header(value), now)
+		require.False(t, ok, value)
+	}
+}
+
+func TestClient_WithRetries(t *testing.T) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_ = json.NewEncoder(w).Encode(sidecars)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := RetryConfig{MaxRetries: 3, MinBackoff: 10 * time.Millisecond, MaxBackoff: time.Second}
+	client := NewBlobSidecarClient(srv.URL, WithRetries(cfg))
+	sleeps := recordSleeps(client)
+
+	status, result, err := client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, sidecars, result)
+	require.Equal(t, int32(3), requests.Load())
+
+	// The Retry-After of the 429 is honored over the shorter backoff
+	require.Len(t, *sleeps, 2)
+	require.LessOrEqual(t, (*sleeps)[0], 10*time.Millisecond)
+	require.Equal(t, 7*time.Second, (*sleeps)[1])
+}
+
+func TestClient_WithRetriesGivesUp(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// A Retry-After beyond maxRetryAfter is capped
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"code":503,"message":"syncing"}`))
+	}))
+	defer srv.Close()
+
+	client := NewBlobSidecarClient(srv.URL, WithRetries(RetryConfig{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	sleeps := recordSleeps(client)
+
+	// The status of the last attempt is returned
+	status, _, err := client.FetchSidecars("head", blobformat.JSON)
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, "syncing", statusErr.Message)
+	require.Equal(t, int32(3), requests.Load())
+	require.Equal(t, []time.Duration{maxRetryAfter, maxRetryAfter}, *sleeps)
+
+	// Other error statuses are not retried
+	requests.Store(0)
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer notFound.Close()
+	status, _, _ = NewBlobSidecarClient(notFound.URL, WithRetries(RetryConfig{MaxRetries: 2, MinBackoff: time.Millisecond})).FetchSidecars("head", blobformat.JSON)
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestClient_WithRetriesConnectionErrors(t *testing.T) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(sidecars)
+	}))
+	defer srv.Close()
+
+	rt := &failingRoundTripper{failures: 2}
+	client := NewBlobSidecarClient(srv.URL, WithRoundTripper(rt), WithRetries(RetryConfig{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	recordSleeps(client)
+	status, result, err := client.FetchSidecars("head", blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, sidecars, result)
+	require.Equal(t, 3, rt.requests)
+
+	// Without retries the first connection error is returned
+	rt = &failingRoundTripper{failures: 1}
+	status, _, err = NewBlobSidecarClient(srv.URL, WithRoundTripper(rt)).FetchSidecars("head", blobformat.JSON)
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, status)
+	require.Equal(t, 1, rt.requests)
+}
+
+func TestClient_WithRetriesTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewBlobSidecarClient(srv.URL, WithRetries(RetryConfig{Timeout: 50 * time.Millisecond}))
+	start := time.Now()
+	status, _, err := client.FetchSidecars("head", blobformat.JSON)
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, status)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestClient_WithContext(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// The wait for the Retry-After ends with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewBlobSidecarClient(srv.URL, WithContext(ctx), WithRetries(RetryConfig{MaxRetries: 2}))
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, _, err := client.FetchSidecars("head", blobformat.JSON)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, int32(1), requests.Load())
+
+	// Once the context has ended no request is made
+	_, _, err = client.FetchSidecars("head", blobformat.JSON)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestClient_Retries(t *testing.T) {
+	retrying := NewBlobSidecarClient("http://a", WithRetries(RetryConfig{MaxRetries: 1}))
+	require.True(t, retrying.(Retrier).Retries())
+	require.False(t, NewBlobSidecarClient("http://a").(Retrier).Retries())
+
+	// A fallback client retries if the client of any of its endpoints does
+	require.True(t, newFallbackClient([]string{"a", "b"}, []BlobSidecarClient{NewBlobSidecarClient("http://a"), retrying}).Retries())
+	require.False(t, NewFallbackBlobSidecarClient([]string{"http://a", "http://b"}).Retries())
+}
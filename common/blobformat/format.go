@@ -0,0 +1,60 @@
+// Package blobformat defines the formats that blob sidecars are requested and served in. It has no dependencies, so that
+// configuration can parse a format without linking a client.
+package blobformat
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Format string
+
+const (
+	// JSON requests the response in JSON format
+	JSON Format = "application/json"
+	// SSZ requests the response in SSZ format
+	SSZ Format = "application/octet-stream"
+	// SSZSnappy requests the response in snappy framed SSZ format, the encoding used by consensus layer gossip
+	SSZSnappy Format = "application/x-snappy-framed"
+	// Auto requests the response in SSZ format, unless SSZ responses from the server have recently failed to decode, in
+	// which case JSON is requested instead (see the autoFormat of blobclient). SSZ is the recommended default for bulk
+	// fetches: decoding a block with six blobs takes ~0.5ms and ~0.8MB in SSZ, against ~14ms and ~9.9MB in JSON (see
+	// BenchmarkDecodeFormat in blobclient), and the SSZ response is half the size.
+	Auto Format = "auto"
+)
+
+// aliases maps the short names accepted by Parse to their format.
+var aliases = map[string]Format{
+	"json":       JSON,
+	"ssz":        SSZ,
+	"ssz_snappy": SSZSnappy,
+	"ssz-snappy": SSZSnappy,
+	"snappy":     SSZSnappy,
+	"auto":       Auto,
+}
+
+// MediaTypes lists every format that is sent as a media type, that is all but Auto, in the order they are shown in
+// errors.
+var MediaTypes = []Format{JSON, SSZ, SSZSnappy}
+
+// Parse parses a user supplied format, such as a flag value. Either a short name ("json", "ssz", "ssz_snappy", "auto")
+// or the media type of the format is accepted, case insensitively.
+func Parse(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if format, ok := aliases[s]; ok {
+		return format, nil
+	}
+
+	for _, format := range MediaTypes {
+		if s == string(format) {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown format %q, valid formats are json, ssz, ssz_snappy, auto or one of the media types %v", s, MediaTypes)
+}
+
+// String returns the media type of the format, as sent in the Accept header.
+func (f Format) String() string {
+	return string(f)
+}
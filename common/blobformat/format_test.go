@@ -0,0 +1,38 @@
+package blobformat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]Format{
+		"json":                        JSON,
+		" JSON ":                      JSON,
+		"ssz":                         SSZ,
+		"ssz_snappy":                  SSZSnappy,
+		"ssz-snappy":                  SSZSnappy,
+		"snappy":                      SSZSnappy,
+		"application/json":            JSON,
+		"application/octet-stream":    SSZ,
+		"Application/X-Snappy-Framed": SSZSnappy,
+		"Auto":                        Auto,
+	}
+
+	for input, expected := range tests {
+		format, err := Parse(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, format, input)
+	}
+
+	for _, format := range MediaTypes {
+		parsed, err := Parse(format.String())
+		require.NoError(t, err)
+		require.Equal(t, format, parsed)
+	}
+
+	_, err := Parse("xml")
+	require.ErrorContains(t, err, `unknown format "xml"`)
+	require.ErrorContains(t, err, "application/octet-stream")
+}
@@ -0,0 +1,55 @@
+package blobproof
+
+import (
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBlobsBatch(t *testing.T) {
+	block := newTestBlock(t, 3)
+	require.NoError(t, VerifyBlobsBatch(block.sidecars))
+	require.NoError(t, VerifyBlobsBatch(nil))
+
+	// The error names the blob that does not match
+	bad := *block.sidecars[1]
+	bad.KZGProof = block.sidecars[2].KZGProof
+	err := VerifyBlobsBatch([]*storage.BlobSidecar{block.sidecars[0], &bad, block.sidecars[2]})
+	require.ErrorIs(t, err, ErrInvalidBlobProof)
+	require.ErrorContains(t, err, "blob 1")
+}
+
+func TestBundle_VerifyNamesBadBlob(t *testing.T) {
+	block := newTestBlock(t, 2)
+	bundle, err := NewBundle(block.sidecars)
+	require.NoError(t, err)
+
+	bundle.Blobs[1].Blob[100] ^= 1
+	err = bundle.Verify(block.root)
+	require.ErrorIs(t, err, ErrInvalidBundle)
+	require.ErrorIs(t, err, ErrInvalidBlobProof)
+	require.ErrorContains(t, err, "blob 1")
+}
+
+func BenchmarkVerifyBlobs(b *testing.B) {
+	block := newTestBlock(b, 6)
+	_, err := kzgContext()
+	require.NoError(b, err)
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			require.NoError(b, VerifyBlobsBatch(block.sidecars))
+		}
+	})
+
+	b.Run("individual", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, sidecar := range block.sidecars {
+				err := kzg4844.VerifyBlobProof(kzg4844.Blob(sidecar.Blob), kzg4844.Commitment(sidecar.KZGCommitment), kzg4844.Proof(sidecar.KZGProof))
+				require.NoError(b, err)
+			}
+		}
+	})
+}
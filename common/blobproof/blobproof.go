@@ -0,0 +1,224 @@
+package blobproof
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+)
+
+var (
+	// ErrNoBlobs is returned when a bundle is created without any sidecars, as there is no header to prove against
+	ErrNoBlobs = errors.New("no blobs to prove")
+	// ErrInvalidBundle is returned when a bundle fails verification
+	ErrInvalidBundle = errors.New("invalid blob proof bundle")
+)
+
+// Blob is a blob in a Bundle, with the KZG commitment and proof needed to verify it.
+type Blob struct {
+	Index         uint64             `json:"index,string"`
+	Blob          kzg4844.Blob       `json:"blob"`
+	KZGCommitment kzg4844.Commitment `json:"kzg_commitment"`
+	KZGProof      kzg4844.Proof      `json:"kzg_proof"`
+}
+
+// Bundle is a compact proof that a set of blobs belongs to a block. It holds the signed header of the block once,
+// each blob with its KZG commitment and proof, and a single merkle multiproof of the commitments against the body root
+// of the header. The multiproof shares the nodes that the inclusion proofs of the individual sidecars have in common,
+// so a bundle of several blobs is smaller than their sidecars.
+type Bundle struct {
+	SignedBlockHeader *phase0.SignedBeaconBlockHeader `json:"signed_block_header"`
+	Blobs             []Blob                          `json:"blobs"`
+	// Proof is the helper nodes of the multiproof, in descending order of generalized index, as defined by
+	// get_helper_indices in the consensus specs
+	Proof []common.Hash `json:"proof"`
+}
+
+// NewBundle creates a bundle from the sidecars of a block, using the inclusion proof of each sidecar to build the
+// multiproof. All sidecars must be from the same block.
+func NewBundle(sidecars []*storage.BlobSidecar) (*Bundle, error) {
+	if len(sidecars) == 0 {
+		return nil, ErrNoBlobs
+	}
+
+	header := sidecars[0].SignedBlockHeader
+	if header == nil || header.Message == nil {
+		return nil, fmt.Errorf("sidecar %d has no block header", sidecars[0].Index)
+	}
+	root, err := header.Message.HashTreeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute block header root: %w", err)
+	}
+
+	bundle := &Bundle{SignedBlockHeader: header}
+	nodes := make(map[int]common.Hash)
+	var leaves []int
+	for _, sidecar := range sidecars {
+		if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+			return nil, fmt.Errorf("sidecar %d has no block header", sidecar.Index)
+		}
+		sidecarRoot, err := sidecar.SignedBlockHeader.Message.HashTreeRoot()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute block header root: %w", err)
+		} else if sidecarRoot != root {
+			return nil, fmt.Errorf("sidecar %d is from block %#x, expected %#x", sidecar.Index, sidecarRoot, root)
+		}
+
+		leaf := commitmentLeafIndex(uint64(sidecar.Index))
+		leaves = append(leaves, leaf)
+		// The branch of the inclusion proof is ordered from the sibling of the leaf up to the child of the body root,
+		// through the commitments tree, the length mix-in of the list and the body tree
+		index := leaf
+		for _, sibling := range sidecar.KZGCommitmentInclusionProof {
+			nodes[index^1] = common.Hash(sibling)
+			index >>= 1
+		}
+
+		bundle.Blobs = append(bundle.Blobs, Blob{
+			Index:         uint64(sidecar.Index),
+			Blob:          kzg4844.Blob(sidecar.Blob),
+			KZGCommitment: kzg4844.Commitment(sidecar.KZGCommitment),
+			KZGProof:      kzg4844.Proof(sidecar.KZGProof),
+		})
+	}
+
+	for _, index := range helperIndices(leaves) {
+		bundle.Proof = append(bundle.Proof, nodes[index])
+	}
+
+	return bundle, nil
+}
+
+// Verify checks that the bundle proves its blobs belong to the block with the given root. The root of the header
+// must be blockRoot, the commitments must be included in the body of the block, and each blob must match its
+// commitment. The signature of the header is not checked, as that requires the validator set of the chain.
+func (b *Bundle) Verify(blockRoot common.Hash) error {
+	if b.SignedBlockHeader == nil || b.SignedBlockHeader.Message == nil {
+		return fmt.Errorf("%w: missing block header", ErrInvalidBundle)
+	}
+	if len(b.Blobs) == 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidBundle, ErrNoBlobs)
+	}
+
+	root, err := b.SignedBlockHeader.Message.HashTreeRoot()
+	if err != nil {
+		return fmt.Errorf("failed to compute block header root: %w", err)
+	} else if common.Hash(root) != blockRoot {
+		return fmt.Errorf("%w: block header root %#x does not match %s", ErrInvalidBundle, root, blockRoot)
+	}
+
+	leaves := make(map[int]common.Hash)
+	for _, blob := range b.Blobs {
+		index := commitmentLeafIndex(blob.Index)
+		if _, ok := leaves[index]; ok || blob.Index >= uint64(denebLayout.maxCommitments) {
+			return fmt.Errorf("%w: invalid or duplicate index %d", ErrInvalidBundle, blob.Index)
+		}
+		leaves[index] = commitmentLeaf(blob.KZGCommitment)
+	}
+
+	bodyRoot, err := multiMerkleRoot(leaves, b.Proof)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	} else if bodyRoot != common.Hash(b.SignedBlockHeader.Message.BodyRoot) {
+		return fmt.Errorf("%w: commitments are not included in body root %#x", ErrInvalidBundle, b.SignedBlockHeader.Message.BodyRoot)
+	}
+
+	if err := verifyBlobs(b.Blobs); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+
+	return nil
+}
+
+// commitmentLeafIndex returns the generalized index in the block body of the commitment of the blob at index. Bundles
+// use the layout of deneb, which electra keeps, see inclusionProofLayouts.
+func commitmentLeafIndex(index uint64) int {
+	return denebLayout.leafIndex(index)
+}
+
+// commitmentLeaf returns the hash tree root of a commitment, which spans two chunks.
+func commitmentLeaf(commitment kzg4844.Commitment) [32]byte {
+	var chunks [64]byte
+	copy(chunks[:], commitment[:])
+	return sha256.Sum256(chunks[:])
+}
+
+// multiMerkleRoot computes the root of a tree from the leaves at the given generalized indices and the helper nodes of
+// their multiproof, as defined by calculate_multi_merkle_root in the consensus specs.
+func multiMerkleRoot(leaves map[int]common.Hash, proof []common.Hash) (common.Hash, error) {
+	indices := make([]int, 0, len(leaves))
+	for index := range leaves {
+		indices = append(indices, index)
+	}
+
+	helpers := helperIndices(indices)
+	if len(helpers) != len(proof) {
+		return common.Hash{}, fmt.Errorf("expected %d proof nodes, got %d", len(helpers), len(proof))
+	}
+
+	nodes := make(map[int]common.Hash, len(leaves)+len(proof))
+	for index, leaf := range leaves {
+		nodes[index] = leaf
+	}
+	for i, index := range helpers {
+		nodes[index] = proof[i]
+	}
+
+	keys := make([]int, 0, len(nodes))
+	for index := range nodes {
+		keys = append(keys, index)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+
+	// Parents are appended to keys as they are computed, so that they are in turn combined with their siblings
+	var pair [64]byte
+	for pos := 0; pos < len(keys); pos++ {
+		index := keys[pos]
+		if index <= 1 {
+			continue
+		}
+		left, hasLeft := nodes[index&^1]
+		right, hasRight := nodes[index|1]
+		if _, computed := nodes[index>>1]; computed || !hasLeft || !hasRight {
+			continue
+		}
+
+		copy(pair[:32], left[:])
+		copy(pair[32:], right[:])
+		nodes[index>>1] = sha256.Sum256(pair[:])
+		keys = append(keys, index>>1)
+	}
+
+	root, ok := nodes[1]
+	if !ok {
+		return common.Hash{}, errors.New("proof does not reach the root")
+	}
+	return root, nil
+}
+
+// helperIndices returns the generalized indices of the nodes needed to prove the leaves, in descending order. These
+// are the siblings of the nodes on the paths from the leaves to the root, other than the nodes on those paths.
+func helperIndices(leaves []int) []int {
+	siblings := make(map[int]bool)
+	paths := make(map[int]bool)
+	for _, leaf := range leaves {
+		for index := leaf; index > 1; index >>= 1 {
+			siblings[index^1] = true
+			paths[index] = true
+		}
+	}
+
+	var result []int
+	for index := range siblings {
+		if !paths[index] {
+			result = append(result, index)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(result)))
+	return result
+}
@@ -0,0 +1,215 @@
+package blobproof
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+type testBlock struct {
+	root     common.Hash
+	body     *deneb.BeaconBlockBody
+	sidecars []*storage.BlobSidecar
+}
+
+// newTestBlock creates a block with the given number of blobs, and sidecars with valid KZG and inclusion proofs.
+func newTestBlock(t testing.TB, blobCount int) testBlock {
+	var blobs []kzg4844.Blob
+	var commitments []deneb.KZGCommitment
+	for i := 0; i < blobCount; i++ {
+		var blob kzg4844.Blob
+		// Each field element must be less than the BLS modulus, so the first byte of each is left as zero
+		raw := blobtest.RandBytes(t, uint(len(blob)))
+		for j := 0; j < len(blob); j += 32 {
+			copy(blob[j+1:j+32], raw[j+1:j+32])
+		}
+		commitment, err := kzg4844.BlobToCommitment(blob)
+		require.NoError(t, err)
+
+		blobs = append(blobs, blob)
+		commitments = append(commitments, deneb.KZGCommitment(commitment))
+	}
+
+	body := &deneb.BeaconBlockBody{
+		ETH1Data:           &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+		SyncAggregate:      &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+		ExecutionPayload:   &deneb.ExecutionPayload{BaseFeePerGas: uint256.NewInt(7)},
+		BlobKZGCommitments: commitments,
+	}
+	bodyRoot, err := body.HashTreeRoot()
+	require.NoError(t, err)
+
+	header := &phase0.SignedBeaconBlockHeader{
+		Message: &phase0.BeaconBlockHeader{
+			Slot:          10,
+			ProposerIndex: 3,
+			ParentRoot:    phase0.Root{1},
+			StateRoot:     phase0.Root{2},
+			BodyRoot:      bodyRoot,
+		},
+	}
+	root, err := header.Message.HashTreeRoot()
+	require.NoError(t, err)
+
+	tree, err := body.GetTree()
+	require.NoError(t, err)
+
+	block := testBlock{root: common.Hash(root), body: body}
+	for i, blob := range blobs {
+		proof, err := kzg4844.ComputeBlobProof(blob, kzg4844.Commitment(commitments[i]))
+		require.NoError(t, err)
+
+		inclusion, err := tree.Prove(commitmentLeafIndex(uint64(i)))
+		require.NoError(t, err)
+		sidecar := &storage.BlobSidecar{
+			Index:             deneb.BlobIndex(i),
+			Blob:              deneb.Blob(blob),
+			KZGCommitment:     commitments[i],
+			KZGProof:          deneb.KZGProof(proof),
+			SignedBlockHeader: header,
+		}
+		require.Len(t, inclusion.Hashes, len(sidecar.KZGCommitmentInclusionProof))
+		for j, h := range inclusion.Hashes {
+			copy(sidecar.KZGCommitmentInclusionProof[j][:], h)
+		}
+
+		block.sidecars = append(block.sidecars, sidecar)
+	}
+
+	return block
+}
+
+func TestBundle_Verify(t *testing.T) {
+	block := newTestBlock(t, 4)
+
+	bundle, err := NewBundle([]*storage.BlobSidecar{block.sidecars[0], block.sidecars[2]})
+	require.NoError(t, err)
+	require.NoError(t, bundle.Verify(block.root))
+
+	// The multiproof matches the one computed from the full body, and shares the nodes that the inclusion proofs of
+	// the two sidecars have in common
+	tree, err := block.body.GetTree()
+	require.NoError(t, err)
+	multiproof, err := tree.ProveMulti([]int{commitmentLeafIndex(0), commitmentLeafIndex(2)})
+	require.NoError(t, err)
+	require.Len(t, bundle.Proof, len(multiproof.Hashes))
+	for i := range multiproof.Hashes {
+		require.Equal(t, common.BytesToHash(multiproof.Hashes[i]), bundle.Proof[i])
+	}
+	require.Less(t, len(bundle.Proof), 2*len(block.sidecars[0].KZGCommitmentInclusionProof))
+
+	// A bundle survives a round trip through its JSON encoding
+	encoded, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	var decoded Bundle
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	require.Equal(t, bundle, &decoded)
+	require.NoError(t, decoded.Verify(block.root))
+}
+
+func TestBundle_VerifySingleBlob(t *testing.T) {
+	block := newTestBlock(t, 3)
+
+	bundle, err := NewBundle(block.sidecars[1:2])
+	require.NoError(t, err)
+	require.Len(t, bundle.Proof, len(block.sidecars[1].KZGCommitmentInclusionProof))
+	require.NoError(t, bundle.Verify(block.root))
+}
+
+func TestBundle_VerifyRejectsTampering(t *testing.T) {
+	block := newTestBlock(t, 2)
+
+	tests := []struct {
+		name   string
+		root   common.Hash
+		tamper func(b *Bundle)
+	}{
+		{
+			name: "wrong block",
+			root: common.Hash{9},
+		},
+		{
+			name: "commitment",
+			tamper: func(b *Bundle) {
+				b.Blobs[0].KZGCommitment = b.Blobs[1].KZGCommitment
+			},
+		},
+		{
+			name: "blob",
+			tamper: func(b *Bundle) {
+				b.Blobs[1].Blob[100]++
+			},
+		},
+		{
+			name: "index",
+			tamper: func(b *Bundle) {
+				b.Blobs[0].Index, b.Blobs[1].Index = b.Blobs[1].Index, b.Blobs[0].Index
+			},
+		},
+		{
+			name: "duplicate index",
+			tamper: func(b *Bundle) {
+				b.Blobs[1].Index = b.Blobs[0].Index
+			},
+		},
+		{
+			name: "proof",
+			tamper: func(b *Bundle) {
+				b.Proof[len(b.Proof)-1][0]++
+			},
+		},
+		{
+			name: "truncated proof",
+			tamper: func(b *Bundle) {
+				b.Proof = b.Proof[1:]
+			},
+		},
+		{
+			name: "body root",
+			tamper: func(b *Bundle) {
+				header := *b.SignedBlockHeader.Message
+				header.BodyRoot[0]++
+				b.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: &header}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bundle, err := NewBundle(block.sidecars)
+			require.NoError(t, err)
+			require.NoError(t, bundle.Verify(block.root))
+
+			root := block.root
+			if test.root != (common.Hash{}) {
+				root = test.root
+			}
+			if test.tamper != nil {
+				test.tamper(bundle)
+			}
+			require.ErrorIs(t, bundle.Verify(root), ErrInvalidBundle)
+		})
+	}
+}
+
+func TestNewBundle_Errors(t *testing.T) {
+	_, err := NewBundle(nil)
+	require.ErrorIs(t, err, ErrNoBlobs)
+
+	a := newTestBlock(t, 1)
+	b := newTestBlock(t, 1)
+	_, err = NewBundle([]*storage.BlobSidecar{a.sidecars[0], b.sidecars[0]})
+	require.ErrorContains(t, err, "is from block")
+
+	_, err = NewBundle([]*storage.BlobSidecar{{Index: 1}})
+	require.ErrorContains(t, err, "has no block header")
+}
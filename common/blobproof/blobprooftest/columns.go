@@ -0,0 +1,264 @@
+// Package blobprooftest builds data column sidecars whose proofs verify, for the tests of the packages that verify or
+// rebuild them. Computing the cell proofs of a blob with the setup of the Ethereum KZG ceremony takes seconds, so the
+// sidecars are proven with an insecure setup whose secret is known, see WriteSetup. It does not import blobproof, so
+// that the tests of blobproof can use it.
+package blobprooftest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/fft"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// secret is the τ of the insecure setup
+	secret = 1337
+
+	fieldElementsPerBlob    = 4096
+	fieldElementsPerExtBlob = 2 * fieldElementsPerBlob
+	fieldElementsPerCell    = storage.BytesPerCell / 32
+)
+
+// lagrange returns L_k(τ) for the Lagrange basis of the roots of unity of a blob, in the bit reversed order of the
+// field elements of a blob, so that the commitment to a blob is the sum of its field elements times these.
+var lagrange = sync.OnceValue(func() []fr.Element {
+	domain := fft.NewDomain(fieldElementsPerBlob)
+	var tau, scale fr.Element
+	tau.SetUint64(secret)
+	// L_k(τ) = (τ^N - 1) ω^k / (N (τ - ω^k))
+	scale.Exp(tau, big.NewInt(fieldElementsPerBlob))
+	scale.Sub(&scale, new(fr.Element).SetOne())
+	scale.Mul(&scale, &domain.CardinalityInv)
+
+	roots := make([]fr.Element, fieldElementsPerBlob)
+	denominators := make([]fr.Element, fieldElementsPerBlob)
+	roots[0].SetOne()
+	for k := range roots {
+		if k > 0 {
+			roots[k].Mul(&roots[k-1], &domain.Generator)
+		}
+		denominators[k].Sub(&tau, &roots[k])
+	}
+	denominators = fr.BatchInvert(denominators)
+
+	result := make([]fr.Element, fieldElementsPerBlob)
+	for k := range roots {
+		p := reverseBits(uint64(k), fieldElementsPerBlob)
+		result[p].Mul(&roots[k], &denominators[k])
+		result[p].Mul(&result[p], &scale)
+	}
+	return result
+})
+
+// reverseBits returns the bit reversal of index in a list of size elements, a power of two.
+func reverseBits(index uint64, size int) uint64 {
+	return bits.Reverse64(index) >> (64 - bits.Len(uint(size-1)))
+}
+
+// setupJSON returns the insecure setup in the JSON format of the consensus specs.
+var setupJSON = sync.OnceValue(func() []byte {
+	var tau fr.Element
+	tau.SetUint64(secret)
+	powers := make([]fr.Element, fieldElementsPerCell+1)
+	powers[0].SetOne()
+	for i := 1; i < len(powers); i++ {
+		powers[i].Mul(&powers[i-1], &tau)
+	}
+
+	_, _, g1, g2 := bls12381.Generators()
+	setup := struct {
+		G1Lagrange []string `json:"g1_lagrange"`
+		G1Monomial []string `json:"g1_monomial"`
+		G2Monomial []string `json:"g2_monomial"`
+	}{}
+	// The g1_lagrange points of the file are in the order of the roots of unity
+	natural := make([]fr.Element, fieldElementsPerBlob)
+	for k := range natural {
+		natural[k] = lagrange()[reverseBits(uint64(k), fieldElementsPerBlob)]
+	}
+	for _, point := range bls12381.BatchScalarMultiplicationG1(&g1, natural) {
+		b := point.Bytes()
+		setup.G1Lagrange = append(setup.G1Lagrange, "0x"+hex.EncodeToString(b[:]))
+	}
+	for _, point := range bls12381.BatchScalarMultiplicationG1(&g1, powers[:fieldElementsPerCell]) {
+		b := point.Bytes()
+		setup.G1Monomial = append(setup.G1Monomial, "0x"+hex.EncodeToString(b[:]))
+	}
+	for _, point := range bls12381.BatchScalarMultiplicationG2(&g2, powers) {
+		b := point.Bytes()
+		setup.G2Monomial = append(setup.G2Monomial, "0x"+hex.EncodeToString(b[:]))
+	}
+
+	data, err := json.Marshal(setup)
+	if err != nil {
+		panic(err)
+	}
+	return data
+})
+
+// WriteSetup writes the insecure setup to a file of the test, returning its path. The sidecars of
+// NewDataColumnSidecars verify once blobproof is configured with it.
+func WriteSetup(t testing.TB) string {
+	path := filepath.Join(t.TempDir(), "trusted_setup.json")
+	require.NoError(t, os.WriteFile(path, setupJSON(), 0644))
+	return path
+}
+
+// NewBlobs returns random blobs.
+func NewBlobs(t testing.TB, count int) []kzg4844.Blob {
+	blobs := make([]kzg4844.Blob, count)
+	for i := range blobs {
+		// Each field element must be less than the BLS modulus, so the first byte of each is left as zero
+		raw := blobtest.RandBytes(t, uint(len(blobs[i])))
+		for j := 0; j < len(blobs[i]); j += 32 {
+			copy(blobs[i][j+1:j+32], raw[j+1:j+32])
+		}
+	}
+	return blobs
+}
+
+// NewDataColumnSidecars returns the data column sidecars with the given indices, or all of them if there are none, of
+// a block with the blobs and the header. The body root of the header is set to that of a block body with the
+// commitments of the blobs, so that the inclusion proofs of the sidecars verify. The commitments and proofs are those
+// of the insecure setup, see WriteSetup.
+func NewDataColumnSidecars(t testing.TB, header *phase0.BeaconBlockHeader, blobs []kzg4844.Blob, indices ...uint64) []*storage.DataColumnSidecar {
+	if len(indices) == 0 {
+		for i := uint64(0); i < storage.NumberOfColumns; i++ {
+			indices = append(indices, i)
+		}
+	}
+
+	_, _, g1, _ := bls12381.Generators()
+	commitments := make([][48]byte, len(blobs))
+	cells := make([][][storage.BytesPerCell]byte, len(blobs))
+	proofs := make([][]bls12381.G1Affine, len(blobs))
+	for i, blob := range blobs {
+		values := make([]fr.Element, fieldElementsPerBlob)
+		for j := range values {
+			require.NoError(t, values[j].SetBytesCanonical(blob[j*32:(j+1)*32]))
+		}
+		var commitment fr.Element
+		commitment.SetZero()
+		for j := range values {
+			var term fr.Element
+			term.Mul(&values[j], &lagrange()[j])
+			commitment.Add(&commitment, &term)
+		}
+		commitments[i] = bls12381.BatchScalarMultiplicationG1(&g1, []fr.Element{commitment})[0].Bytes()
+
+		var quotients []fr.Element
+		cells[i], quotients = extend(values, commitment, indices)
+		proofs[i] = bls12381.BatchScalarMultiplicationG1(&g1, quotients)
+	}
+
+	body := &deneb.BeaconBlockBody{
+		ETH1Data:           &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+		SyncAggregate:      &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+		ExecutionPayload:   &deneb.ExecutionPayload{BaseFeePerGas: uint256.NewInt(7)},
+		BlobKZGCommitments: make([]deneb.KZGCommitment, len(blobs)),
+	}
+	for i, commitment := range commitments {
+		body.BlobKZGCommitments[i] = commitment
+	}
+	bodyRoot, err := body.HashTreeRoot()
+	require.NoError(t, err)
+	header.BodyRoot = bodyRoot
+	tree, err := body.GetTree()
+	require.NoError(t, err)
+	inclusion, err := tree.Prove(16 + 11)
+	require.NoError(t, err)
+
+	result := make([]*storage.DataColumnSidecar, len(indices))
+	signed := &phase0.SignedBeaconBlockHeader{Message: header}
+	for n, index := range indices {
+		sidecar := &storage.DataColumnSidecar{
+			Index:             index,
+			Column:            make([][storage.BytesPerCell]byte, len(blobs)),
+			KZGCommitments:    commitments,
+			KZGProofs:         make([][48]byte, len(blobs)),
+			SignedBlockHeader: signed,
+		}
+		for i := range blobs {
+			sidecar.Column[i] = cells[i][n]
+			sidecar.KZGProofs[i] = proofs[i][n].Bytes()
+		}
+		require.Len(t, inclusion.Hashes, len(sidecar.KZGCommitmentsInclusionProof))
+		for j, h := range inclusion.Hashes {
+			copy(sidecar.KZGCommitmentsInclusionProof[j][:], h)
+		}
+		result[n] = sidecar
+	}
+	return result
+}
+
+// extend returns the cells at the given indices of the extension of the blob with the values, and the quotient
+// q(τ) = (P(τ) - I(τ)) / (τ^n - h^n) of the proof of each, where evaluation is P(τ) and I is the interpolation
+// polynomial of the cell on its coset. The coset is h times the roots of unity of order n, FIELD_ELEMENTS_PER_CELL, so
+// that I(τ) = (τ^n - h^n) Σ y_j x_j / (n h^n (τ - x_j)) over its points x_j and values y_j.
+func extend(values []fr.Element, evaluation fr.Element, indices []uint64) ([][storage.BytesPerCell]byte, []fr.Element) {
+	// The field elements of a blob are in bit reversed order, so the inverse FFT gives the coefficients in order, and
+	// the FFT of the coefficients gives the extension in the bit reversed order of the cells
+	coefficients := make([]fr.Element, fieldElementsPerExtBlob)
+	copy(coefficients, values)
+	fft.NewDomain(fieldElementsPerBlob).FFTInverse(coefficients[:fieldElementsPerBlob], fft.DIT)
+	extDomain := fft.NewDomain(fieldElementsPerExtBlob)
+	extended := coefficients
+	extDomain.FFT(extended, fft.DIF)
+
+	var tau fr.Element
+	tau.SetUint64(secret)
+	cells := make([][storage.BytesPerCell]byte, len(indices))
+	quotients := make([]fr.Element, len(indices))
+	for n, index := range indices {
+		points := make([]fr.Element, fieldElementsPerCell)
+		denominators := make([]fr.Element, fieldElementsPerCell)
+		for j := range points {
+			position := index*fieldElementsPerCell + uint64(j)
+			b := extended[position].Bytes()
+			copy(cells[n][j*32:], b[:])
+
+			points[j].Exp(extDomain.Generator, new(big.Int).SetUint64(reverseBits(position, fieldElementsPerExtBlob)))
+			denominators[j].Sub(&tau, &points[j])
+		}
+		denominators = fr.BatchInvert(denominators)
+
+		var shift, vanishing, sum fr.Element
+		shift.Exp(points[0], big.NewInt(fieldElementsPerCell))
+		vanishing.Exp(tau, big.NewInt(fieldElementsPerCell))
+		vanishing.Sub(&vanishing, &shift)
+		for j := range points {
+			var term fr.Element
+			term.Mul(&extended[index*fieldElementsPerCell+uint64(j)], &points[j])
+			term.Mul(&term, &denominators[j])
+			sum.Add(&sum, &term)
+		}
+		var scale fr.Element
+		scale.SetUint64(fieldElementsPerCell)
+		scale.Mul(&scale, &shift)
+		scale.Inverse(&scale)
+		sum.Mul(&sum, &scale)
+
+		// q(τ) = P(τ) / (τ^n - h^n) - Σ y_j x_j / (n h^n (τ - x_j))
+		quotients[n].Inverse(&vanishing)
+		quotients[n].Mul(&quotients[n], &evaluation)
+		quotients[n].Sub(&quotients[n], &sum)
+	}
+	return cells, quotients
+}
@@ -0,0 +1,351 @@
+package blobproof
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/fft"
+)
+
+const (
+	// bytesPerFieldElement is the BYTES_PER_FIELD_ELEMENT of deneb
+	bytesPerFieldElement = 32
+	// fieldElementsPerBlob is the FIELD_ELEMENTS_PER_BLOB of deneb
+	fieldElementsPerBlob = 4096
+	// fieldElementsPerExtBlob is the FIELD_ELEMENTS_PER_EXT_BLOB of fulu, the number of evaluations of the polynomial
+	// of a blob in its extension, which is twice the blob
+	fieldElementsPerExtBlob = 2 * fieldElementsPerBlob
+	// fieldElementsPerCell is the FIELD_ELEMENTS_PER_CELL of fulu
+	fieldElementsPerCell = storage.BytesPerCell / bytesPerFieldElement
+)
+
+// ErrInvalidCellProof is returned when a cell of a data column does not match the commitment of its blob and its proof.
+var ErrInvalidCellProof = errors.New("cell does not match its commitment")
+
+// defaultCellTrustedSetup holds the points of the Ethereum KZG ceremony's setup that cell proofs are verified with,
+// which go-kzg-4844 does not embed: the first 64 g1_monomial points and the 65 g2_monomial points of the setup, as in
+// trusted_setup_4096.json of the consensus specs.
+//
+//go:embed trusted_setup_cells.json
+var defaultCellTrustedSetup []byte
+
+// cellTrustedSetup is the part of a trusted setup in the JSON format of the consensus specs that cell proofs are
+// verified with.
+type cellTrustedSetup struct {
+	SetupG1Monomial []string `json:"g1_monomial"`
+	SetupG2         []string `json:"g2_monomial"`
+}
+
+// cellSetup is the part of a trusted setup that cell proofs are verified with.
+type cellSetup struct {
+	// g1 are the points [τ^i]₁ for i below FIELD_ELEMENTS_PER_CELL, which the interpolation polynomial of a cell is
+	// committed to with
+	g1 []bls12381.G1Affine
+	// g2 is the generator [1]₂ and g2Cell is [τ^FIELD_ELEMENTS_PER_CELL]₂
+	g2, g2Cell bls12381.G2Affine
+}
+
+// defaultCellSetup is the cell setup of the Ethereum KZG ceremony's setup, loaded on first use.
+var defaultCellSetup = sync.OnceValues(func() (*cellSetup, error) {
+	var setup cellTrustedSetup
+	if err := json.Unmarshal(defaultCellTrustedSetup, &setup); err != nil {
+		return nil, err
+	}
+	return newCellSetup(&setup)
+})
+
+// newCellSetup decodes the points of setup, and checks that they are the powers of the same secret in both groups by
+// comparing e(Σ r^i [τ^i]₁, [1]₂) with e([1]₁, Σ r^i [τ^i]₂) for a random r.
+func newCellSetup(setup *cellTrustedSetup) (*cellSetup, error) {
+	if len(setup.SetupG1Monomial) < fieldElementsPerCell {
+		return nil, fmt.Errorf("verifying cell proofs needs %d g1_monomial points, the setup has %d", fieldElementsPerCell, len(setup.SetupG1Monomial))
+	}
+	if len(setup.SetupG2) <= fieldElementsPerCell {
+		return nil, fmt.Errorf("verifying cell proofs needs %d g2_monomial points, the setup has %d", fieldElementsPerCell+1, len(setup.SetupG2))
+	}
+
+	result := &cellSetup{g1: make([]bls12381.G1Affine, fieldElementsPerCell)}
+	for i := range result.g1 {
+		if err := decodePoint(&result.g1[i], setup.SetupG1Monomial[i]); err != nil {
+			return nil, fmt.Errorf("g1_monomial point %d: %w", i, err)
+		}
+	}
+	g2 := make([]bls12381.G2Affine, fieldElementsPerCell+1)
+	for i := range g2 {
+		if err := decodePoint(&g2[i], setup.SetupG2[i]); err != nil {
+			return nil, fmt.Errorf("g2_monomial point %d: %w", i, err)
+		}
+	}
+	result.g2, result.g2Cell = g2[0], g2[fieldElementsPerCell]
+
+	_, _, g1Generator, g2Generator := bls12381.Generators()
+	if !result.g1[0].Equal(&g1Generator) || !result.g2.Equal(&g2Generator) {
+		return nil, errors.New("the monomial points do not start with the generators")
+	}
+
+	powers, err := randomPowers(fieldElementsPerCell)
+	if err != nil {
+		return nil, err
+	}
+	var left bls12381.G1Affine
+	var right bls12381.G2Affine
+	if _, err := left.MultiExp(result.g1, powers, ecc.MultiExpConfig{}); err != nil {
+		return nil, err
+	}
+	if _, err := right.MultiExp(g2[:fieldElementsPerCell], powers, ecc.MultiExpConfig{}); err != nil {
+		return nil, err
+	}
+	left.Neg(&left)
+	if ok, err := bls12381.PairingCheck([]bls12381.G1Affine{left, g1Generator}, []bls12381.G2Affine{result.g2, right}); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("the g1_monomial and g2_monomial points are not powers of the same secret")
+	}
+
+	return result, nil
+}
+
+// decodePoint decodes a 0x prefixed hex string of a compressed point, checking that it is in the subgroup.
+func decodePoint(point interface{ SetBytes([]byte) (int, error) }, s string) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return err
+	}
+	_, err = point.SetBytes(b)
+	return err
+}
+
+// randomPowers returns the first count powers of a random field element. The verifications are combined with a random
+// rather than a Fiat-Shamir challenge as in the consensus specs, which is as sound for a verifier that does not need
+// to be reproduced.
+func randomPowers(count int) ([]fr.Element, error) {
+	var r fr.Element
+	if _, err := r.SetRandom(); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	powers := make([]fr.Element, count)
+	if count > 0 {
+		powers[0].SetOne()
+	}
+	for i := 1; i < count; i++ {
+		powers[i].Mul(&powers[i-1], &r)
+	}
+	return powers, nil
+}
+
+// cellDomain is the subgroup of FIELD_ELEMENTS_PER_CELL roots of unity, whose cosets are the points of the cells.
+var cellDomain = fft.NewDomain(fieldElementsPerCell)
+
+// cellCosetShifts are the coset_shift_for_cell of each cell index in the consensus specs: the root of unity of the
+// extended blob at the position of the first field element of the cell, in bit reversed order. The cell holds the
+// evaluations of the polynomial of its blob at the shift times each root of cellDomain, in bit reversed order.
+var cellCosetShifts = sync.OnceValue(func() []fr.Element {
+	root, err := fft.Generator(fieldElementsPerExtBlob)
+	if err != nil {
+		panic(err)
+	}
+	result := make([]fr.Element, storage.NumberOfColumns)
+	for i := range result {
+		result[i].Exp(root, new(big.Int).SetUint64(reverseBits(uint64(i), storage.NumberOfColumns)))
+	}
+	return result
+})
+
+// reverseBits returns the bit reversal of index in a list of size elements, a power of two.
+func reverseBits(index uint64, size int) uint64 {
+	return bits.Reverse64(index) >> (64 - bits.Len(uint(size-1)))
+}
+
+// cellValues decodes the field elements of a cell, which must be canonical.
+func cellValues(cell *[storage.BytesPerCell]byte) ([]fr.Element, error) {
+	values := make([]fr.Element, fieldElementsPerCell)
+	for i := range values {
+		if err := values[i].SetBytesCanonical(cell[i*bytesPerFieldElement : (i+1)*bytesPerFieldElement]); err != nil {
+			return nil, fmt.Errorf("field element %d: %w", i, err)
+		}
+	}
+	return values, nil
+}
+
+// interpolateCell returns the coefficients of the polynomial of degree below FIELD_ELEMENTS_PER_CELL that takes the
+// values of the cell at index on its coset. The inverse FFT of the bit reversed values gives the coefficients of the
+// polynomial shifted onto cellDomain, which are then divided by the powers of the shift.
+func interpolateCell(values []fr.Element, index uint64) []fr.Element {
+	coefficients := slices.Clone(values)
+	cellDomain.FFTInverse(coefficients, fft.DIT)
+
+	var inverse, power fr.Element
+	inverse.Inverse(&cellCosetShifts()[index])
+	power.SetOne()
+	for i := range coefficients {
+		coefficients[i].Mul(&coefficients[i], &power)
+		power.Mul(&power, &inverse)
+	}
+	return coefficients
+}
+
+// cellProof is a cell to verify, of the blob at index blob in the column at index column.
+type cellProof struct {
+	column uint64
+	blob   int
+	cell   *[storage.BytesPerCell]byte
+	proof  [48]byte
+}
+
+// VerifyDataColumns checks that the cells of the data column sidecars of a block match the KZG commitments of its
+// blobs with the proof of each cell, in a single batched verification as verify_cell_kzg_proof_batch in the consensus
+// specs. Every column must hold the same commitments, and a cell and a proof for each. If the batch fails, the cells
+// are verified one by one so that the error names the first bad cell. The cells are verified with the trusted setup
+// set by Configure, and an error is returned if there are more than its maximum number of blobs.
+func VerifyDataColumns(columns []*storage.DataColumnSidecar) error {
+	if len(columns) == 0 {
+		return nil
+	}
+
+	commitments := columns[0].KZGCommitments
+	if err := checkBlobCount(len(commitments)); err != nil {
+		return err
+	}
+	if err := checkColumns(columns); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCellProof, err)
+	}
+	var cells []cellProof
+	for _, column := range columns {
+		for i := range column.Column {
+			cells = append(cells, cellProof{column: column.Index, blob: i, cell: &column.Column[i], proof: column.KZGProofs[i]})
+		}
+	}
+	if len(cells) == 0 {
+		return nil
+	}
+
+	setup, err := cellContext()
+	if err != nil {
+		return fmt.Errorf("failed to load KZG trusted setup for cell proofs: %w", err)
+	}
+	points := make([]bls12381.G1Affine, len(commitments))
+	for i, commitment := range commitments {
+		if _, err := points[i].SetBytes(commitment[:]); err != nil {
+			return fmt.Errorf("%w: commitment %d: %w", ErrInvalidCellProof, i, err)
+		}
+	}
+
+	batchErr := verifyCells(setup, points, cells)
+	if batchErr == nil {
+		return nil
+	}
+
+	for _, cell := range cells {
+		if err := verifyCells(setup, points, []cellProof{cell}); err != nil {
+			return fmt.Errorf("%w: column %d, blob %d: %w", ErrInvalidCellProof, cell.column, cell.blob, err)
+		}
+	}
+
+	// Each cell verified on its own, which the batch verification should not allow
+	return fmt.Errorf("%w: batch verification failed: %w", ErrInvalidCellProof, batchErr)
+}
+
+// checkColumns checks that the index of each column is below NUMBER_OF_COLUMNS, and that each holds the commitments of
+// the first column, and a cell and a proof for each.
+func checkColumns(columns []*storage.DataColumnSidecar) error {
+	commitments := columns[0].KZGCommitments
+	for _, column := range columns {
+		if column.Index >= storage.NumberOfColumns {
+			return fmt.Errorf("column index %d is not below %d", column.Index, storage.NumberOfColumns)
+		}
+		if len(column.Column) != len(commitments) || len(column.KZGCommitments) != len(commitments) || len(column.KZGProofs) != len(commitments) {
+			return fmt.Errorf("column %d has %d cells, %d commitments and %d proofs, column %d has %d commitments", column.Index, len(column.Column), len(column.KZGCommitments), len(column.KZGProofs), columns[0].Index, len(commitments))
+		}
+		for i := range column.KZGCommitments {
+			if column.KZGCommitments[i] != commitments[i] {
+				return fmt.Errorf("commitment %d of column %d differs from that of column %d", i, column.Index, columns[0].Index)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyCells checks the proofs of cells against the commitments of their blobs. Each cell k satisfies
+// C_k - [I_k(τ)]₁ = π_k (τ^n - h_k^n), with n FIELD_ELEMENTS_PER_CELL, C_k the commitment of its blob, I_k its
+// interpolation polynomial, π_k its proof and h_k its coset shift, so the cells are verified together with a random r
+// by checking
+//
+//	e(Σ r^k π_k, [τ^n]₂) = e(Σ r^k (C_k - [I_k(τ)]₁ + h_k^n π_k), [1]₂)
+//
+// in which the commitments of a blob share one weight, and the interpolation polynomials are combined before they are
+// committed to.
+func verifyCells(setup *cellSetup, commitments []bls12381.G1Affine, cells []cellProof) error {
+	powers, err := randomPowers(len(cells))
+	if err != nil {
+		return err
+	}
+
+	proofs := make([]bls12381.G1Affine, len(cells))
+	shifted := make([]fr.Element, len(cells))
+	weights := make([]fr.Element, len(commitments))
+	interpolation := make([]fr.Element, fieldElementsPerCell)
+	exponent := big.NewInt(fieldElementsPerCell)
+	for k, cell := range cells {
+		if _, err := proofs[k].SetBytes(cell.proof[:]); err != nil {
+			return fmt.Errorf("invalid proof: %w", err)
+		}
+		values, err := cellValues(cell.cell)
+		if err != nil {
+			return err
+		}
+
+		var term fr.Element
+		for i, coefficient := range interpolateCell(values, cell.column) {
+			term.Mul(&coefficient, &powers[k])
+			interpolation[i].Add(&interpolation[i], &term)
+		}
+		weights[cell.blob].Add(&weights[cell.blob], &powers[k])
+		shifted[k].Exp(cellCosetShifts()[cell.column], exponent)
+		shifted[k].Mul(&shifted[k], &powers[k])
+	}
+
+	var left, committed, interpolated, correction bls12381.G1Affine
+	for _, msm := range []struct {
+		result  *bls12381.G1Affine
+		points  []bls12381.G1Affine
+		scalars []fr.Element
+	}{
+		{&left, proofs, powers},
+		{&committed, commitments, weights},
+		{&interpolated, setup.g1, interpolation},
+		{&correction, proofs, shifted},
+	} {
+		if _, err := msm.result.MultiExp(msm.points, msm.scalars, ecc.MultiExpConfig{}); err != nil {
+			return err
+		}
+	}
+
+	var right, term bls12381.G1Jac
+	right.FromAffine(&committed)
+	term.FromAffine(&interpolated)
+	right.SubAssign(&term)
+	right.AddMixed(&correction)
+	var rightAffine bls12381.G1Affine
+	rightAffine.FromJacobian(&right)
+	rightAffine.Neg(&rightAffine)
+
+	ok, err := bls12381.PairingCheck([]bls12381.G1Affine{left, rightAffine}, []bls12381.G2Affine{setup.g2Cell, setup.g2})
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.New("pairing check failed")
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package blobproof
+
+import (
+	"bytes"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobproof/blobprooftest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/fft"
+	gokzg4844 "github.com/crate-crypto/go-kzg-4844"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/stretchr/testify/require"
+)
+
+// configureTestSetup configures the insecure setup that the sidecars of blobprooftest are proven with.
+func configureTestSetup(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Configure(Config{})) })
+	require.NoError(t, Configure(Config{TrustedSetupPath: blobprooftest.WriteSetup(t)}))
+}
+
+// evaluate returns the value of the polynomial with the coefficients at x.
+func evaluate(coefficients []fr.Element, x fr.Element) fr.Element {
+	var result fr.Element
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result.Mul(&result, &x)
+		result.Add(&result, &coefficients[i])
+	}
+	return result
+}
+
+func randomElements(t *testing.T, count int) []fr.Element {
+	result := make([]fr.Element, count)
+	for i := range result {
+		_, err := result[i].SetRandom()
+		require.NoError(t, err)
+	}
+	return result
+}
+
+func TestCellCosetShifts(t *testing.T) {
+	// The roots of unity are those of the consensus specs, 7^((r - 1) / n) for the primitive root 7
+	var root fr.Element
+	exponent := new(big.Int).Sub(fr.Modulus(), big.NewInt(1))
+	exponent.Div(exponent, big.NewInt(fieldElementsPerExtBlob))
+	root.Exp(*new(fr.Element).SetUint64(7), exponent)
+
+	shifts := cellCosetShifts()
+	require.Len(t, shifts, storage.NumberOfColumns)
+	require.True(t, shifts[0].IsOne())
+	// Cell 1 starts at position 64 of the extended blob, whose root is ω^rev13(64) = ω^64
+	var expected fr.Element
+	expected.Exp(root, big.NewInt(64))
+	require.Equal(t, expected, shifts[1])
+	expected.Exp(root, big.NewInt(int64(reverseBits(100*fieldElementsPerCell, fieldElementsPerExtBlob))))
+	require.Equal(t, expected, shifts[100])
+
+	require.Equal(t, uint64(0b110), reverseBits(0b011, 8))
+	require.Equal(t, uint64(1), reverseBits(64, 128))
+}
+
+func TestInterpolateCell(t *testing.T) {
+	coefficients := randomElements(t, fieldElementsPerCell)
+	for _, index := range []uint64{0, 5, 127} {
+		values := make([]fr.Element, fieldElementsPerCell)
+		for j := range values {
+			var x fr.Element
+			x.Exp(cellDomain.Generator, new(big.Int).SetUint64(reverseBits(uint64(j), fieldElementsPerCell)))
+			x.Mul(&x, &cellCosetShifts()[index])
+			values[j] = evaluate(coefficients, x)
+		}
+		require.Equal(t, coefficients, interpolateCell(values, index), "cell %d", index)
+	}
+}
+
+func TestVerifyDataColumns(t *testing.T) {
+	configureTestSetup(t)
+	blobs := blobprooftest.NewBlobs(t, 2)
+	columns := blobprooftest.NewDataColumnSidecars(t, &phase0.BeaconBlockHeader{Slot: 5}, blobs)
+
+	// The first half of the cells of a blob are the blob, whose commitment is that of the configured setup
+	ctx, err := kzgContext()
+	require.NoError(t, err)
+	for i, blob := range blobs {
+		commitment, err := ctx.BlobToKZGCommitment(gokzg4844.Blob(blob), 0)
+		require.NoError(t, err)
+		require.Equal(t, columns[0].KZGCommitments[i], [48]byte(commitment), "blob %d", i)
+
+		var cells []byte
+		for _, column := range columns[:storage.NumberOfColumns/2] {
+			cells = append(cells, column.Column[i][:]...)
+		}
+		require.Equal(t, blob[:], cells, "blob %d", i)
+	}
+
+	require.NoError(t, VerifyDataColumns(columns))
+	require.NoError(t, VerifyDataColumns(columns[70:]))
+	require.NoError(t, VerifyDataColumns(nil))
+
+	// Returns a copy of the column at index, which can be changed without changing the others
+	column := func(index int) *storage.DataColumnSidecar {
+		c := *columns[index]
+		c.Column = slices.Clone(c.Column)
+		c.KZGCommitments = slices.Clone(c.KZGCommitments)
+		c.KZGProofs = slices.Clone(c.KZGProofs)
+		return &c
+	}
+	tests := []struct {
+		name   string
+		modify func(c *storage.DataColumnSidecar)
+		err    string
+	}{
+		{
+			name:   "cell",
+			modify: func(c *storage.DataColumnSidecar) { c.Column[1][31] ^= 1 },
+			err:    "column 3, blob 1: pairing check failed",
+		},
+		{
+			name:   "swapped proofs",
+			modify: func(c *storage.DataColumnSidecar) { c.KZGProofs[0], c.KZGProofs[1] = c.KZGProofs[1], c.KZGProofs[0] },
+			err:    "column 3, blob 0: pairing check failed",
+		},
+		{
+			name:   "index",
+			modify: func(c *storage.DataColumnSidecar) { c.Index = 4 },
+			err:    "column 4, blob 0: pairing check failed",
+		},
+		{
+			name:   "non canonical field element",
+			modify: func(c *storage.DataColumnSidecar) { copy(c.Column[0][:32], bytes.Repeat([]byte{0xff}, 32)) },
+			err:    "column 3, blob 0: field element 0",
+		},
+		{
+			name:   "commitment",
+			modify: func(c *storage.DataColumnSidecar) { c.KZGCommitments[1] = c.KZGCommitments[0] },
+			err:    "commitment 1 of column 3 differs from that of column 0",
+		},
+		{
+			name:   "missing proof",
+			modify: func(c *storage.DataColumnSidecar) { c.KZGProofs = c.KZGProofs[:1] },
+			err:    "column 3 has 2 cells, 2 commitments and 1 proofs",
+		},
+		{
+			name:   "index out of range",
+			modify: func(c *storage.DataColumnSidecar) { c.Index = storage.NumberOfColumns },
+			err:    "column index 128 is not below 128",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tampered := column(3)
+			test.modify(tampered)
+			err := VerifyDataColumns([]*storage.DataColumnSidecar{columns[0], tampered, columns[9]})
+			require.ErrorIs(t, err, ErrInvalidCellProof)
+			require.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestVerifyDataColumns_MaxBlobsPerBlock(t *testing.T) {
+	configureTestSetup(t)
+	columns := blobprooftest.NewDataColumnSidecars(t, &phase0.BeaconBlockHeader{}, blobprooftest.NewBlobs(t, 3), 0, 1)
+
+	require.NoError(t, Configure(Config{TrustedSetupPath: blobprooftest.WriteSetup(t), MaxBlobsPerBlock: 2}))
+	require.ErrorIs(t, VerifyDataColumns(columns), ErrTooManyBlobs)
+}
+
+func TestVerifyDataColumns_TrustedSetup(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Configure(Config{})) })
+	columns := blobprooftest.NewDataColumnSidecars(t, &phase0.BeaconBlockHeader{}, blobprooftest.NewBlobs(t, 1), 0, 1)
+
+	// The proofs of the insecure setup do not verify with the default setup
+	require.ErrorIs(t, VerifyDataColumns(columns), ErrInvalidCellProof)
+
+	// A setup without g1_monomial points can verify blobs, but not cells
+	require.NoError(t, Configure(Config{TrustedSetupPath: writeSetup(t, insecureSetup(t))}))
+	err := VerifyDataColumns(columns)
+	require.ErrorContains(t, err, "needs 64 g1_monomial points, the setup has 0")
+	require.NotErrorIs(t, err, ErrInvalidCellProof)
+}
+
+func TestDefaultCellSetup(t *testing.T) {
+	setup, err := defaultCellSetup()
+	require.NoError(t, err)
+
+	// The g1_monomial points are those of the ceremony's g1_lagrange points, so a polynomial of low degree has the
+	// same commitment from its coefficients as from its blob
+	coefficients := randomElements(t, fieldElementsPerCell)
+	values := make([]fr.Element, fieldElementsPerBlob)
+	copy(values, coefficients)
+	fft.NewDomain(fieldElementsPerBlob).FFT(values, fft.DIF)
+	var blob kzg4844.Blob
+	for i := range values {
+		b := values[i].Bytes()
+		copy(blob[i*bytesPerFieldElement:], b[:])
+	}
+	expected, err := kzg4844.BlobToCommitment(blob)
+	require.NoError(t, err)
+
+	var commitment bls12381.G1Affine
+	_, err = commitment.MultiExp(setup.g1, coefficients, ecc.MultiExpConfig{})
+	require.NoError(t, err)
+	require.Equal(t, expected, kzg4844.Commitment(commitment.Bytes()))
+}
@@ -0,0 +1,82 @@
+package blobproof
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// CommitmentMismatchError is returned by VerifyAgainstBlockBody when the sidecars do not exactly match the commitments
+// in the block body.
+type CommitmentMismatchError struct {
+	// Missing contains the positions in the block body of commitments that have no sidecar
+	Missing []int
+	// Extra contains the indices of sidecars whose commitment is not in the block body, or is a duplicate
+	Extra []uint64
+	// Reordered contains the indices of sidecars whose commitment is in the block body, but at a different position
+	Reordered []uint64
+}
+
+func (e *CommitmentMismatchError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing commitments at positions %v", e.Missing))
+	}
+	if len(e.Extra) > 0 {
+		parts = append(parts, fmt.Sprintf("unexpected commitments in sidecars %v", e.Extra))
+	}
+	if len(e.Reordered) > 0 {
+		parts = append(parts, fmt.Sprintf("reordered commitments in sidecars %v", e.Reordered))
+	}
+	return "sidecars do not match block body: " + strings.Join(parts, ", ")
+}
+
+// VerifyAgainstBlockBody checks that the commitments of the sidecars exactly match the blob_kzg_commitments of the
+// block body, in order. Every commitment in the block body must have exactly one sidecar, with an index equal to the
+// commitment's position, and the sidecars must be sorted by index. As the block body is authoritative this confirms
+// that the sidecars contain all, and only, the blobs for the block. A *CommitmentMismatchError is returned if they do
+// not match.
+func VerifyAgainstBlockBody(sidecars storage.BlobSidecars, commitments [][]byte) error {
+	positions := make(map[deneb.KZGCommitment]int, len(commitments))
+	for i, c := range commitments {
+		var commitment deneb.KZGCommitment
+		if len(c) != len(commitment) {
+			return fmt.Errorf("invalid commitment length at position %d: %d", i, len(c))
+		}
+		copy(commitment[:], c)
+		positions[commitment] = i
+	}
+
+	result := &CommitmentMismatchError{}
+	seen := make(map[int]bool, len(commitments))
+	last := -1
+	for _, sidecar := range sidecars.Data {
+		position, ok := positions[sidecar.KZGCommitment]
+		if !ok || seen[position] {
+			result.Extra = append(result.Extra, uint64(sidecar.Index))
+			continue
+		}
+
+		seen[position] = true
+		if uint64(sidecar.Index) != uint64(position) || position < last {
+			result.Reordered = append(result.Reordered, uint64(sidecar.Index))
+		}
+		if position > last {
+			last = position
+		}
+	}
+
+	for i := range commitments {
+		if !seen[i] {
+			result.Missing = append(result.Missing, i)
+		}
+	}
+
+	if len(result.Missing) > 0 || len(result.Extra) > 0 || len(result.Reordered) > 0 {
+		return result
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package blobproof
+
+import (
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func commitmentsOf(sidecars []*storage.BlobSidecar) [][]byte {
+	result := make([][]byte, len(sidecars))
+	for i, sidecar := range sidecars {
+		result[i] = sidecar.KZGCommitment[:]
+	}
+	return result
+}
+
+func TestVerifyAgainstBlockBody(t *testing.T) {
+	sidecars := storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 3))
+	commitments := commitmentsOf(sidecars)
+	other := storage.FromDeneb(blobtest.NewBlobSidecar(t, 3))
+
+	tests := []struct {
+		name        string
+		sidecars    []*storage.BlobSidecar
+		commitments [][]byte
+		expected    *CommitmentMismatchError
+	}{
+		{
+			name:        "exact match",
+			sidecars:    sidecars,
+			commitments: commitments,
+		},
+		{
+			name:        "no blobs",
+			sidecars:    []*storage.BlobSidecar{},
+			commitments: [][]byte{},
+		},
+		{
+			name:        "missing sidecar",
+			sidecars:    []*storage.BlobSidecar{sidecars[0], sidecars[2]},
+			commitments: commitments,
+			expected:    &CommitmentMismatchError{Missing: []int{1}},
+		},
+		{
+			name:        "extra sidecar",
+			sidecars:    append(append([]*storage.BlobSidecar{}, sidecars...), other),
+			commitments: commitments,
+			expected:    &CommitmentMismatchError{Extra: []uint64{3}},
+		},
+		{
+			name:        "duplicate sidecar",
+			sidecars:    []*storage.BlobSidecar{sidecars[0], sidecars[1], sidecars[1], sidecars[2]},
+			commitments: commitments,
+			expected:    &CommitmentMismatchError{Extra: []uint64{1}},
+		},
+		{
+			name:        "reordered sidecars",
+			sidecars:    []*storage.BlobSidecar{sidecars[0], sidecars[2], sidecars[1]},
+			commitments: commitments,
+			expected:    &CommitmentMismatchError{Reordered: []uint64{1}},
+		},
+		{
+			name:        "reordered commitments",
+			sidecars:    sidecars,
+			commitments: [][]byte{commitments[1], commitments[0], commitments[2]},
+			expected:    &CommitmentMismatchError{Reordered: []uint64{0, 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyAgainstBlockBody(storage.BlobSidecars{Data: test.sidecars}, test.commitments)
+			if test.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var mismatch *CommitmentMismatchError
+			require.ErrorAs(t, err, &mismatch)
+			require.Equal(t, test.expected, mismatch)
+		})
+	}
+}
+
+func TestVerifyAgainstBlockBody_InvalidCommitment(t *testing.T) {
+	err := VerifyAgainstBlockBody(storage.BlobSidecars{}, [][]byte{{1, 2, 3}})
+	require.ErrorContains(t, err, "invalid commitment length")
+}
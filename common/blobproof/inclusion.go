@@ -0,0 +1,217 @@
+package blobproof
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+)
+
+var (
+	// ErrUnknownFork is returned when the inclusion proof of a sidecar is verified for a fork whose block body layout
+	// is not known, as verifying it against the layout of another fork could accept an invalid proof
+	ErrUnknownFork = errors.New("unknown fork")
+	// ErrInvalidInclusionProof is returned when the inclusion proof of a sidecar fails verification
+	ErrInvalidInclusionProof = errors.New("invalid commitment inclusion proof")
+)
+
+// inclusionProofLayout is where the blob_kzg_commitments list is in the BeaconBlockBody of a fork, which determines the
+// generalized index of each commitment and so the depth of the inclusion proof of a sidecar.
+type inclusionProofLayout struct {
+	// bodyFields is the number of fields of the block body
+	bodyFields int
+	// commitmentsField is the position of the commitments list in the fields of the block body
+	commitmentsField int
+	// maxCommitments is the MAX_BLOB_COMMITMENTS_PER_BLOCK of the fork, the limit of the commitments list
+	maxCommitments int
+}
+
+var (
+	denebLayout = inclusionProofLayout{bodyFields: 12, commitmentsField: 11, maxCommitments: 4096}
+	// inclusionProofLayouts are the layouts of the forks whose inclusion proofs can be verified. Electra adds
+	// execution_requests after the commitments, so its body has 13 fields, which still fit a tree of depth 4, and the
+	// commitments keep their generalized index and proof depth of 17. Fulu keeps the body of electra. A fork that
+	// changes the layout needs an entry of its own, as there is deliberately no default.
+	inclusionProofLayouts = map[string]inclusionProofLayout{
+		"deneb":   denebLayout,
+		"electra": {bodyFields: 13, commitmentsField: 11, maxCommitments: 4096},
+		"fulu":    {bodyFields: 13, commitmentsField: 11, maxCommitments: 4096},
+	}
+)
+
+// bodyDepth returns the depth of the tree of the fields of the block body.
+func (l inclusionProofLayout) bodyDepth() int {
+	return bits.Len(uint(l.bodyFields - 1))
+}
+
+// commitmentsDepth returns the depth of the tree of the commitments list, without its length mix-in.
+func (l inclusionProofLayout) commitmentsDepth() int {
+	return bits.Len(uint(l.maxCommitments - 1))
+}
+
+// depth returns the number of nodes in the inclusion proof of a commitment, through the commitments tree, the length
+// mix-in of the list and the body tree.
+func (l inclusionProofLayout) depth() int {
+	return l.commitmentsDepth() + 1 + l.bodyDepth()
+}
+
+// listIndex returns the generalized index in the block body of the root of the commitments list.
+func (l inclusionProofLayout) listIndex() int {
+	return 1<<l.bodyDepth() | l.commitmentsField
+}
+
+// leafIndex returns the generalized index in the block body of the commitment of the blob at index. The commitments
+// list is the left child of its root, the right child being its length.
+func (l inclusionProofLayout) leafIndex(index uint64) int {
+	return (l.listIndex()*2)<<l.commitmentsDepth() | int(index)
+}
+
+// InclusionProofDepth returns the depth of the commitment inclusion proofs of sidecars in fork, or ErrUnknownFork.
+func InclusionProofDepth(fork string) (int, error) {
+	layout, ok := inclusionProofLayouts[strings.ToLower(fork)]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownFork, fork)
+	}
+	return layout.depth(), nil
+}
+
+// VerifyInclusionProof checks that the KZG commitment of sidecar is included in the body of the block in its signed
+// header, using the generalized index and proof depth of the block body in fork, e.g. the fork of the slot of the
+// block. ErrUnknownFork is returned for a fork without a known layout rather than assuming the layout of another. The
+// signature of the header is not checked, as that requires the validator set of the chain.
+func VerifyInclusionProof(sidecar *storage.BlobSidecar, fork string) error {
+	layout, ok := inclusionProofLayouts[strings.ToLower(fork)]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownFork, fork)
+	}
+	if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+		return fmt.Errorf("%w: sidecar %d has no block header", ErrInvalidInclusionProof, sidecar.Index)
+	}
+
+	proof := sidecar.KZGCommitmentInclusionProof
+	if len(proof) != layout.depth() {
+		return fmt.Errorf("%w: %s proofs have %d nodes, sidecar %d has %d", ErrInvalidInclusionProof, fork, layout.depth(), sidecar.Index, len(proof))
+	}
+	if uint64(sidecar.Index) >= uint64(layout.maxCommitments) {
+		return fmt.Errorf("%w: index %d is not below the %s maximum of %d commitments", ErrInvalidInclusionProof, sidecar.Index, fork, layout.maxCommitments)
+	}
+
+	node := commitmentLeaf(kzg4844.Commitment(sidecar.KZGCommitment))
+	node = branchRoot(node, layout.leafIndex(uint64(sidecar.Index)), proof[:])
+	if bodyRoot := sidecar.SignedBlockHeader.Message.BodyRoot; node != bodyRoot {
+		return fmt.Errorf("%w: commitment of sidecar %d is not included in body root %s", ErrInvalidInclusionProof, sidecar.Index, common.Hash(bodyRoot))
+	}
+
+	return nil
+}
+
+// VerifyDataColumnInclusionProof checks that the KZG commitments of sidecar, which are the blob_kzg_commitments list
+// of its block, are included in the body of the block in its signed header, as VerifyInclusionProof does for the
+// commitment of a blob sidecar. The proof is of the root of the list, so its depth is that of the block body tree.
+func VerifyDataColumnInclusionProof(sidecar *storage.DataColumnSidecar, fork string) error {
+	layout, ok := inclusionProofLayouts[strings.ToLower(fork)]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownFork, fork)
+	}
+	if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+		return fmt.Errorf("%w: data column %d has no block header", ErrInvalidInclusionProof, sidecar.Index)
+	}
+
+	proof := sidecar.KZGCommitmentsInclusionProof
+	if len(proof) != layout.bodyDepth() {
+		return fmt.Errorf("%w: %s proofs of data columns have %d nodes, data column %d has %d", ErrInvalidInclusionProof, fork, layout.bodyDepth(), sidecar.Index, len(proof))
+	}
+	if len(sidecar.KZGCommitments) > layout.maxCommitments {
+		return fmt.Errorf("%w: data column %d has %d commitments, the %s maximum is %d", ErrInvalidInclusionProof, sidecar.Index, len(sidecar.KZGCommitments), fork, layout.maxCommitments)
+	}
+
+	node := branchRoot(commitmentsRoot(sidecar.KZGCommitments, layout), layout.listIndex(), proof[:])
+	if bodyRoot := sidecar.SignedBlockHeader.Message.BodyRoot; node != bodyRoot {
+		return fmt.Errorf("%w: commitments of data column %d are not included in body root %s", ErrInvalidInclusionProof, sidecar.Index, common.Hash(bodyRoot))
+	}
+
+	return nil
+}
+
+// branchRoot returns the root of a tree from the node at the generalized index and its branch, the siblings of the
+// nodes on its path to the root from the bottom up.
+func branchRoot(node [32]byte, index int, branch [][32]byte) [32]byte {
+	var pair [64]byte
+	for _, sibling := range branch {
+		if index&1 == 0 {
+			copy(pair[:32], node[:])
+			copy(pair[32:], sibling[:])
+		} else {
+			copy(pair[:32], sibling[:])
+			copy(pair[32:], node[:])
+		}
+		node = sha256.Sum256(pair[:])
+		index >>= 1
+	}
+	return node
+}
+
+// commitmentsRoot returns the hash tree root of the commitments as the blob_kzg_commitments list of a block body of
+// layout: the root of the tree of their leaves, padded with zero leaves to the limit of the list, mixed in with the
+// length of the list.
+func commitmentsRoot(commitments [][48]byte, layout inclusionProofLayout) [32]byte {
+	root, _ := commitmentsTree(commitments, 0, layout)
+	return mixInLength(root, len(commitments))
+}
+
+// commitmentsTree returns the root of the tree of the leaves of the commitments, padded with zero leaves to the limit
+// of the blob_kzg_commitments list of layout, and the branch of the leaf at index, from its sibling up to the child of
+// the root.
+func commitmentsTree(commitments [][48]byte, index int, layout inclusionProofLayout) ([32]byte, [][32]byte) {
+	level := make([][32]byte, len(commitments))
+	for i, commitment := range commitments {
+		level[i] = commitmentLeaf(commitment)
+	}
+
+	var pair [64]byte
+	var branch [][32]byte
+	zero := [32]byte{}
+	for depth := 0; depth < layout.commitmentsDepth(); depth++ {
+		if len(level)%2 == 1 {
+			level = append(level, zero)
+		}
+		if sibling := index ^ 1; sibling < len(level) {
+			branch = append(branch, level[sibling])
+		} else {
+			branch = append(branch, zero)
+		}
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			copy(pair[:32], level[2*i][:])
+			copy(pair[32:], level[2*i+1][:])
+			next[i] = sha256.Sum256(pair[:])
+		}
+		copy(pair[:32], zero[:])
+		copy(pair[32:], zero[:])
+		level, zero, index = next, sha256.Sum256(pair[:]), index>>1
+	}
+
+	if len(level) > 0 {
+		return level[0], branch
+	}
+	return zero, branch
+}
+
+// lengthChunk returns the chunk that the length of a list is mixed in with, the length as a little endian uint256.
+func lengthChunk(length int) [32]byte {
+	var chunk [32]byte
+	binary.LittleEndian.PutUint64(chunk[:], uint64(length))
+	return chunk
+}
+
+// mixInLength returns the hash tree root of a list from the root of the tree of its elements and its length.
+func mixInLength(root [32]byte, length int) [32]byte {
+	chunk := lengthChunk(length)
+	return sha256.Sum256(append(root[:], chunk[:]...))
+}
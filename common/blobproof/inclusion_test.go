@@ -0,0 +1,312 @@
+package blobproof
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobproof/blobprooftest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// merkleBranch returns the root of the tree of leaves, padded with zero leaves to a power of two, and the branch of
+// the leaf at index from its sibling up to the child of the root.
+func merkleBranch(leaves [][32]byte, index int) ([32]byte, [][32]byte) {
+	width := 1
+	for width < len(leaves) {
+		width *= 2
+	}
+	level := make([][32]byte, width)
+	copy(level, leaves)
+
+	var branch [][32]byte
+	var pair [64]byte
+	for len(level) > 1 {
+		branch = append(branch, level[index^1])
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			copy(pair[:32], level[2*i][:])
+			copy(pair[32:], level[2*i+1][:])
+			next[i] = sha256.Sum256(pair[:])
+		}
+		level = next
+		index /= 2
+	}
+	return level[0], branch
+}
+
+// withBody returns copies of sidecars whose header has bodyRoot, and whose inclusion proofs end with bodyBranch in
+// place of the nodes of the body tree.
+func withBody(sidecars []*storage.BlobSidecar, bodyRoot [32]byte, bodyBranch [][32]byte) []*storage.BlobSidecar {
+	header := *sidecars[0].SignedBlockHeader.Message
+	header.BodyRoot = bodyRoot
+	signed := &phase0.SignedBeaconBlockHeader{Message: &header}
+
+	var result []*storage.BlobSidecar
+	for _, sidecar := range sidecars {
+		sidecar := *sidecar
+		sidecar.SignedBlockHeader = signed
+		bodyStart := len(sidecar.KZGCommitmentInclusionProof) - len(bodyBranch)
+		for i, node := range bodyBranch {
+			sidecar.KZGCommitmentInclusionProof[bodyStart+i] = node
+		}
+		result = append(result, &sidecar)
+	}
+	return result
+}
+
+// bodyFields returns the roots of the fields of a block body with count fields, which are random other than the root
+// of the commitments list of block.
+func bodyFields(t *testing.T, block testBlock, count int) [][32]byte {
+	tree, err := block.body.GetTree()
+	require.NoError(t, err)
+	commitments, err := tree.Get(16 + 11)
+	require.NoError(t, err)
+
+	fields := make([][32]byte, count)
+	for i := range fields {
+		copy(fields[i][:], blobtest.RandBytes(t, 32))
+	}
+	copy(fields[11][:], commitments.Hash())
+	return fields
+}
+
+func TestInclusionProofLayouts(t *testing.T) {
+	for _, fork := range []string{"deneb", "electra", "Electra", "fulu"} {
+		depth, err := InclusionProofDepth(fork)
+		require.NoError(t, err, fork)
+		require.Equal(t, len(storage.BlobSidecar{}.KZGCommitmentInclusionProof), depth, fork)
+	}
+	require.Equal(t, (27*2)<<12, denebLayout.leafIndex(0))
+	require.Equal(t, inclusionProofLayouts["deneb"].leafIndex(5), inclusionProofLayouts["electra"].leafIndex(5))
+
+	// A body that outgrows a tree of depth 4 deepens the proof
+	require.Equal(t, 18, inclusionProofLayout{bodyFields: 17, commitmentsField: 11, maxCommitments: 4096}.depth())
+
+	_, err := InclusionProofDepth("gloas")
+	require.ErrorIs(t, err, ErrUnknownFork)
+}
+
+func TestVerifyInclusionProof_Deneb(t *testing.T) {
+	block := newTestBlock(t, 3)
+	for _, sidecar := range block.sidecars {
+		require.NoError(t, VerifyInclusionProof(sidecar, "deneb"))
+	}
+
+	// The body tree of the test helpers matches the deneb body
+	tree, err := block.body.GetTree()
+	require.NoError(t, err)
+	fields := make([][32]byte, 12)
+	for i := range fields {
+		field, err := tree.Get(16 + i)
+		require.NoError(t, err)
+		copy(fields[i][:], field.Hash())
+	}
+	bodyRoot, _ := merkleBranch(fields, 11)
+	require.Equal(t, block.sidecars[0].SignedBlockHeader.Message.BodyRoot, phase0.Root(bodyRoot))
+}
+
+func TestVerifyInclusionProof_Electra(t *testing.T) {
+	block := newTestBlock(t, 2)
+	// The electra body has execution_requests as a 13th field after the commitments
+	bodyRoot, branch := merkleBranch(bodyFields(t, block, 13), 11)
+	require.Len(t, branch, 4)
+	sidecars := withBody(block.sidecars, bodyRoot, branch)
+
+	for _, sidecar := range sidecars {
+		require.NoError(t, VerifyInclusionProof(sidecar, "electra"))
+	}
+	// The proof of the deneb body does not prove the commitments are in the electra body
+	require.ErrorIs(t, VerifyInclusionProof(withBody(block.sidecars, bodyRoot, nil)[0], "electra"), ErrInvalidInclusionProof)
+}
+
+func TestVerifyInclusionProof_Rejects(t *testing.T) {
+	block := newTestBlock(t, 2)
+
+	tests := []struct {
+		name   string
+		fork   string
+		tamper func(s *storage.BlobSidecar)
+		err    error
+	}{
+		{
+			name: "unknown fork",
+			fork: "gloas",
+			err:  ErrUnknownFork,
+		},
+		{
+			name: "no fork",
+			fork: "",
+			err:  ErrUnknownFork,
+		},
+		{
+			name: "commitment",
+			fork: "deneb",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.BlobSidecar) {
+				s.KZGCommitment = block.sidecars[1].KZGCommitment
+			},
+		},
+		{
+			name: "index",
+			fork: "deneb",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.BlobSidecar) {
+				s.Index = 1
+			},
+		},
+		{
+			name: "index beyond the list",
+			fork: "deneb",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.BlobSidecar) {
+				s.Index = 4096
+			},
+		},
+		{
+			name: "proof",
+			fork: "deneb",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.BlobSidecar) {
+				s.KZGCommitmentInclusionProof[3][0]++
+			},
+		},
+		{
+			name: "body root",
+			fork: "deneb",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.BlobSidecar) {
+				header := *s.SignedBlockHeader.Message
+				header.BodyRoot[0]++
+				s.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: &header}
+			},
+		},
+		{
+			name: "no header",
+			fork: "deneb",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.BlobSidecar) {
+				s.SignedBlockHeader = nil
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sidecar := *block.sidecars[0]
+			if test.tamper != nil {
+				test.tamper(&sidecar)
+			}
+			require.ErrorIs(t, VerifyInclusionProof(&sidecar, test.fork), test.err)
+		})
+	}
+}
+
+func TestVerifyInclusionProof_WrongDepth(t *testing.T) {
+	// A fork whose body tree is deeper cannot be verified with a proof of the deneb depth
+	inclusionProofLayouts["test"] = inclusionProofLayout{bodyFields: 17, commitmentsField: 11, maxCommitments: 4096}
+	t.Cleanup(func() { delete(inclusionProofLayouts, "test") })
+
+	block := newTestBlock(t, 1)
+	err := VerifyInclusionProof(block.sidecars[0], "test")
+	require.ErrorIs(t, err, ErrInvalidInclusionProof)
+	require.ErrorContains(t, err, "have 18 nodes")
+}
+
+func TestCommitmentsRoot(t *testing.T) {
+	for _, blobs := range []int{0, 1, 3} {
+		block := newTestBlock(t, blobs)
+		tree, err := block.body.GetTree()
+		require.NoError(t, err)
+		node, err := tree.Get(denebLayout.listIndex())
+		require.NoError(t, err)
+
+		commitments := make([][48]byte, len(block.body.BlobKZGCommitments))
+		for i, commitment := range block.body.BlobKZGCommitments {
+			commitments[i] = commitment
+		}
+		require.Equal(t, [32]byte(node.Hash()), commitmentsRoot(commitments, denebLayout), "%d blobs", blobs)
+	}
+}
+
+func TestVerifyDataColumnInclusionProof(t *testing.T) {
+	blobs := blobprooftest.NewBlobs(t, 2)
+	columns := blobprooftest.NewDataColumnSidecars(t, &phase0.BeaconBlockHeader{Slot: 5}, blobs, 0, 100)
+	for _, column := range columns {
+		require.NoError(t, VerifyDataColumnInclusionProof(column, "fulu"))
+	}
+
+	tests := []struct {
+		name   string
+		fork   string
+		tamper func(s *storage.DataColumnSidecar)
+		err    error
+	}{
+		{
+			name: "unknown fork",
+			fork: "gloas",
+			err:  ErrUnknownFork,
+		},
+		{
+			name: "commitment",
+			fork: "fulu",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.DataColumnSidecar) {
+				s.KZGCommitments = [][48]byte{s.KZGCommitments[1], s.KZGCommitments[0]}
+			},
+		},
+		{
+			name: "missing commitment",
+			fork: "fulu",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.DataColumnSidecar) {
+				s.KZGCommitments = s.KZGCommitments[:1]
+			},
+		},
+		{
+			name: "proof",
+			fork: "fulu",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.DataColumnSidecar) {
+				s.KZGCommitmentsInclusionProof[2][0]++
+			},
+		},
+		{
+			name: "body root",
+			fork: "fulu",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.DataColumnSidecar) {
+				header := *s.SignedBlockHeader.Message
+				header.BodyRoot[0]++
+				s.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: &header}
+			},
+		},
+		{
+			name: "no header",
+			fork: "fulu",
+			err:  ErrInvalidInclusionProof,
+			tamper: func(s *storage.DataColumnSidecar) {
+				s.SignedBlockHeader = nil
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sidecar := *columns[1]
+			if test.tamper != nil {
+				test.tamper(&sidecar)
+			}
+			require.ErrorIs(t, VerifyDataColumnInclusionProof(&sidecar, test.fork), test.err)
+		})
+	}
+
+	// A fork whose body tree is deeper needs a longer proof
+	inclusionProofLayouts["test"] = inclusionProofLayout{bodyFields: 17, commitmentsField: 11, maxCommitments: 4096}
+	t.Cleanup(func() { delete(inclusionProofLayouts, "test") })
+	err := VerifyDataColumnInclusionProof(columns[0], "test")
+	require.ErrorIs(t, err, ErrInvalidInclusionProof)
+	require.ErrorContains(t, err, "have 5 nodes, data column 0 has 4")
+}
@@ -0,0 +1,199 @@
+package blobproof
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/fft"
+	gokzg4844 "github.com/crate-crypto/go-kzg-4844"
+)
+
+// ErrTooFewColumns is returned when the blobs of a block cannot be recovered from its data columns, as fewer than half
+// of them are given.
+var ErrTooFewColumns = errors.New("too few data columns to recover the blobs")
+
+var (
+	// blobDomain is the subgroup of FIELD_ELEMENTS_PER_BLOB roots of unity that a blob holds the evaluations of its
+	// polynomial at, in bit reversed order.
+	blobDomain = sync.OnceValue(func() *fft.Domain { return fft.NewDomain(fieldElementsPerBlob) })
+	// extDomain is the subgroup of FIELD_ELEMENTS_PER_EXT_BLOB roots of unity that the cells of a blob hold the
+	// evaluations of its polynomial at, in bit reversed order.
+	extDomain = sync.OnceValue(func() *fft.Domain { return fft.NewDomain(fieldElementsPerExtBlob) })
+)
+
+// RecoverBlobSidecars returns the sidecars of the blobs at indices, or of every blob if indices is nil, of the block
+// of the data column sidecars, which must be at least half of its columns. Indices of blobs the block does not have
+// are left out. The KZG proof of each blob is computed with the trusted setup set by Configure, and its inclusion proof
+// is built from the inclusion proof of the commitments of the columns, using the block body layout of fork. The
+// columns are not verified, see VerifyDataColumns.
+func RecoverBlobSidecars(columns []*storage.DataColumnSidecar, fork string, indices []uint64) ([]*storage.BlobSidecar, error) {
+	if len(columns) == 0 {
+		return []*storage.BlobSidecar{}, nil
+	}
+
+	layout, ok := inclusionProofLayouts[strings.ToLower(fork)]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFork, fork)
+	}
+	var inclusionProof deneb.KZGCommitmentInclusionProof
+	if depth := layout.depth(); depth != len(inclusionProof) {
+		return nil, fmt.Errorf("%s inclusion proofs have %d nodes, blob sidecars hold %d", fork, depth, len(inclusionProof))
+	}
+	header := columns[0].SignedBlockHeader
+	if header == nil || header.Message == nil {
+		return nil, fmt.Errorf("data column %d has no block header", columns[0].Index)
+	}
+	if err := checkColumns(columns); err != nil {
+		return nil, err
+	}
+
+	byIndex := make(map[uint64]*storage.DataColumnSidecar, len(columns))
+	for _, column := range columns {
+		if _, ok := byIndex[column.Index]; ok {
+			return nil, fmt.Errorf("data column %d is given twice", column.Index)
+		}
+		byIndex[column.Index] = column
+	}
+	if len(byIndex) < storage.NumberOfColumns/2 {
+		return nil, fmt.Errorf("%w: %d of the %d columns are given, at least %d are needed", ErrTooFewColumns, len(byIndex), storage.NumberOfColumns, storage.NumberOfColumns/2)
+	}
+
+	commitments := columns[0].KZGCommitments
+	if indices == nil {
+		for i := range commitments {
+			indices = append(indices, uint64(i))
+		}
+	}
+
+	ctx, err := kzgContext()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KZG trusted setup: %w", err)
+	}
+	sidecars := make([]*storage.BlobSidecar, 0, len(indices))
+	for _, index := range indices {
+		if index >= uint64(len(commitments)) {
+			continue
+		}
+
+		blob, err := recoverBlob(byIndex, int(index))
+		if err != nil {
+			return nil, err
+		}
+		proof, err := ctx.ComputeBlobKZGProof(gokzg4844.Blob(blob), gokzg4844.KZGCommitment(commitments[index]), 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute KZG proof of blob %d: %w", index, err)
+		}
+
+		// The branch of the commitment in the list, then the length of the list that its root is mixed in with, then
+		// the branch of the list in the block body
+		_, branch := commitmentsTree(commitments, int(index), layout)
+		branch = append(branch, lengthChunk(len(commitments)))
+		branch = append(branch, columns[0].KZGCommitmentsInclusionProof[:]...)
+		sidecar := &storage.BlobSidecar{
+			Index:             deneb.BlobIndex(index),
+			Blob:              blob,
+			KZGCommitment:     commitments[index],
+			KZGProof:          deneb.KZGProof(proof),
+			SignedBlockHeader: header,
+		}
+		for i, node := range branch {
+			sidecar.KZGCommitmentInclusionProof[i] = node
+		}
+		sidecars = append(sidecars, sidecar)
+	}
+	return sidecars, nil
+}
+
+// recoverBlob returns the blob at index blob of the columns, at least half of the columns of a block by their index.
+// The cells of a blob are the evaluations of its polynomial P in the extension of the blob to twice its size, and the
+// blob is the first half of the cells, so it is read from the columns if they are all given. Otherwise P is recovered
+// from the cells as in recover_polynomialcoeff of the consensus specs: the polynomial Z whose roots are the points of
+// the missing cells is a polynomial in x^n, n FIELD_ELEMENTS_PER_CELL, as the points of a cell are the roots of
+// x^n - h^n for its coset shift h, so Z takes a single value, the product of h^n - h_m^n over the shifts h_m of the
+// missing cells, on the points of each cell. P Z is then known at every point, and of a degree that its evaluations
+// determine, so it is interpolated, and divided by Z on a coset of the points on which Z has no roots.
+func recoverBlob(columns map[uint64]*storage.DataColumnSidecar, blob int) (deneb.Blob, error) {
+	var result deneb.Blob
+	complete := true
+	for i := uint64(0); i < storage.NumberOfColumns/2 && complete; i++ {
+		_, complete = columns[i]
+	}
+	if complete {
+		for i := 0; i < storage.NumberOfColumns/2; i++ {
+			copy(result[i*storage.BytesPerCell:], columns[uint64(i)].Column[blob][:])
+		}
+		return result, nil
+	}
+
+	domain := extDomain()
+	exponent := big.NewInt(fieldElementsPerCell)
+	shifts := make([]fr.Element, storage.NumberOfColumns)
+	var missing []fr.Element
+	for i := range shifts {
+		shifts[i].Exp(cellCosetShifts()[i], exponent)
+		if _, ok := columns[uint64(i)]; !ok {
+			missing = append(missing, shifts[i])
+		}
+	}
+	var cosetShift fr.Element
+	cosetShift.Exp(domain.FrMultiplicativeGen, exponent)
+
+	// The evaluations of P Z at the points of the cells, and Z at the points of the coset
+	extended := make([]fr.Element, fieldElementsPerExtBlob)
+	vanishing := make([]fr.Element, storage.NumberOfColumns)
+	for i := range shifts {
+		var onCells, onCoset, point, term fr.Element
+		onCells.SetOne()
+		onCoset.SetOne()
+		point.Mul(&shifts[i], &cosetShift)
+		for _, shift := range missing {
+			term.Sub(&shifts[i], &shift)
+			onCells.Mul(&onCells, &term)
+			term.Sub(&point, &shift)
+			onCoset.Mul(&onCoset, &term)
+		}
+		vanishing[i] = onCoset
+
+		column, ok := columns[uint64(i)]
+		if !ok {
+			continue
+		}
+		values, err := cellValues(&column.Column[blob])
+		if err != nil {
+			return result, fmt.Errorf("cell of blob %d in column %d: %w", blob, column.Index, err)
+		}
+		for j := range values {
+			extended[i*fieldElementsPerCell+j].Mul(&values[j], &onCells)
+		}
+	}
+
+	domain.FFTInverse(extended, fft.DIT)
+	domain.FFT(extended, fft.DIF, fft.OnCoset())
+	vanishing = fr.BatchInvert(vanishing)
+	for i := range extended {
+		extended[i].Mul(&extended[i], &vanishing[i/fieldElementsPerCell])
+	}
+	domain.FFTInverse(extended, fft.DIT, fft.OnCoset())
+
+	// The cells of a blob are the evaluations of a polynomial of a degree below FIELD_ELEMENTS_PER_BLOB, so if there
+	// are more cells than needed to recover it, they must agree on it
+	for _, coefficient := range extended[fieldElementsPerBlob:] {
+		if !coefficient.IsZero() {
+			return result, fmt.Errorf("the cells of blob %d are not the extension of a blob", blob)
+		}
+	}
+
+	values := extended[:fieldElementsPerBlob]
+	blobDomain().FFT(values, fft.DIF)
+	for i := range values {
+		b := values[i].Bytes()
+		copy(result[i*bytesPerFieldElement:], b[:])
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package blobproof
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobproof/blobprooftest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverBlobSidecars(t *testing.T) {
+	configureTestSetup(t)
+	blobs := blobprooftest.NewBlobs(t, 3)
+	columns := blobprooftest.NewDataColumnSidecars(t, &phase0.BeaconBlockHeader{Slot: 5}, blobs)
+
+	shuffled := slices.Clone(columns)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	subsets := map[string][]*storage.DataColumnSidecar{
+		"all columns":      columns,
+		"first half":       columns[:storage.NumberOfColumns/2],
+		"second half":      columns[storage.NumberOfColumns/2:],
+		"one missing":      append(slices.Clone(columns[:10]), columns[11:]...),
+		"random half":      shuffled[:storage.NumberOfColumns/2],
+		"random remainder": shuffled[storage.NumberOfColumns/3:],
+	}
+	for name, subset := range subsets {
+		t.Run(name, func(t *testing.T) {
+			sidecars, err := RecoverBlobSidecars(subset, "fulu", nil)
+			require.NoError(t, err)
+			require.Len(t, sidecars, len(blobs))
+			for i, sidecar := range sidecars {
+				require.Equal(t, deneb.BlobIndex(i), sidecar.Index)
+				require.Equal(t, deneb.Blob(blobs[i]), sidecar.Blob)
+				require.Equal(t, deneb.KZGCommitment(columns[0].KZGCommitments[i]), sidecar.KZGCommitment)
+				require.Equal(t, columns[0].SignedBlockHeader, sidecar.SignedBlockHeader)
+				require.NoError(t, VerifyInclusionProof(sidecar, "fulu"))
+			}
+			require.NoError(t, VerifyBlobsBatch(sidecars))
+		})
+	}
+
+	// Only the requested blobs are recovered
+	sidecars, err := RecoverBlobSidecars(columns[40:], "fulu", []uint64{2, 7})
+	require.NoError(t, err)
+	require.Len(t, sidecars, 1)
+	require.Equal(t, deneb.BlobIndex(2), sidecars[0].Index)
+	require.Equal(t, deneb.Blob(blobs[2]), sidecars[0].Blob)
+
+	sidecars, err = RecoverBlobSidecars(nil, "fulu", nil)
+	require.NoError(t, err)
+	require.Empty(t, sidecars)
+}
+
+func TestRecoverBlobSidecars_Rejects(t *testing.T) {
+	configureTestSetup(t)
+	columns := blobprooftest.NewDataColumnSidecars(t, &phase0.BeaconBlockHeader{Slot: 5}, blobprooftest.NewBlobs(t, 2))
+
+	_, err := RecoverBlobSidecars(columns[1:storage.NumberOfColumns/2], "fulu", nil)
+	require.ErrorIs(t, err, ErrTooFewColumns)
+	require.ErrorContains(t, err, "63 of the 128 columns are given, at least 64 are needed")
+
+	_, err = RecoverBlobSidecars(append(slices.Clone(columns[1:storage.NumberOfColumns/2]), columns[1]), "fulu", nil)
+	require.ErrorContains(t, err, "data column 1 is given twice")
+
+	_, err = RecoverBlobSidecars(columns, "gloas", nil)
+	require.ErrorIs(t, err, ErrUnknownFork)
+
+	// A cell that is not of the blob is found when there are more cells than needed to recover it
+	tampered := *columns[70]
+	tampered.Column = slices.Clone(tampered.Column)
+	tampered.Column[1][31] ^= 1
+	subset := append(slices.Clone(columns[1:storage.NumberOfColumns/2+1]), &tampered)
+	_, err = RecoverBlobSidecars(subset, "fulu", []uint64{0})
+	require.NoError(t, err)
+	_, err = RecoverBlobSidecars(subset, "fulu", []uint64{1})
+	require.ErrorContains(t, err, "the cells of blob 1 are not the extension of a blob")
+
+	tampered = *columns[70]
+	tampered.KZGCommitments = tampered.KZGCommitments[:1]
+	_, err = RecoverBlobSidecars(append(slices.Clone(columns[:64]), &tampered), "fulu", nil)
+	require.ErrorContains(t, err, "column 70 has 2 cells, 1 commitments and 2 proofs")
+}
@@ -0,0 +1,157 @@
+package blobproof
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	gokzg4844 "github.com/crate-crypto/go-kzg-4844"
+)
+
+// ErrTooManyBlobs is returned when a block has more blobs than the configured maximum.
+var ErrTooManyBlobs = errors.New("too many blobs")
+
+// Config configures the verification of blobs.
+type Config struct {
+	// TrustedSetupPath is the path of a trusted setup in the JSON format of go-kzg-4844 (g1_lagrange and g2_monomial),
+	// e.g. for a testnet with its own setup. The setup of the Ethereum KZG ceremony is used if it is empty. The cell
+	// proofs of data columns are verified with its g1_monomial points, which the format of the consensus specs adds,
+	// so a setup without them can only verify blobs.
+	TrustedSetupPath string
+	// MaxBlobsPerBlock is the maximum number of blobs a verified block may have, not checked if 0
+	MaxBlobsPerBlock int
+}
+
+// defaultContext is the context of the Ethereum KZG ceremony's setup. Loading a setup takes a few seconds, so it is
+// only done on first use.
+var defaultContext = sync.OnceValues(gokzg4844.NewContext4096Secure)
+
+var (
+	configMu sync.RWMutex
+	// customContext is the context of the trusted setup loaded by Configure, nil to use defaultContext
+	customContext *gokzg4844.Context
+	// customCellSetup returns the cell setup of the trusted setup loaded by Configure, nil to use defaultCellSetup
+	customCellSetup  func() (*cellSetup, error)
+	maxBlobsPerBlock int
+)
+
+// Configure sets the trusted setup and maximum number of blobs used by VerifyBlobsBatch, Bundle.Verify and
+// VerifyDataColumns. A custom trusted setup is loaded and checked immediately, so that a missing or malformed file is
+// reported at startup rather than on the first verification, and the loaded setup is reused for every verification
+// after. Only its points for cell proofs are checked on first use, as blobs can be verified without them. Configure
+// with the zero Config restores the defaults.
+func Configure(cfg Config) error {
+	if cfg.MaxBlobsPerBlock < 0 {
+		return fmt.Errorf("max blobs per block must not be negative")
+	}
+
+	var ctx *gokzg4844.Context
+	var cells func() (*cellSetup, error)
+	if cfg.TrustedSetupPath != "" {
+		var err error
+		if ctx, cells, err = loadTrustedSetup(cfg.TrustedSetupPath); err != nil {
+			return err
+		}
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	customContext = ctx
+	customCellSetup = cells
+	maxBlobsPerBlock = cfg.MaxBlobsPerBlock
+	return nil
+}
+
+// loadTrustedSetup reads and checks the trusted setup at path, returning its context and a function that loads its
+// cell setup on first use.
+func loadTrustedSetup(path string) (*gokzg4844.Context, func() (*cellSetup, error), error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read trusted setup: %w", err)
+	}
+
+	var setup gokzg4844.JSONTrustedSetup
+	if err := json.Unmarshal(data, &setup); err != nil {
+		return nil, nil, fmt.Errorf("malformed trusted setup %s: %w", path, err)
+	}
+	var cellPoints cellTrustedSetup
+	if err := json.Unmarshal(data, &cellPoints); err != nil {
+		return nil, nil, fmt.Errorf("malformed trusted setup %s: %w", path, err)
+	}
+
+	// The library assumes the points are valid, and panics on some malformed ones
+	if len(setup.SetupG2) < 2 {
+		return nil, nil, fmt.Errorf("malformed trusted setup %s: at least 2 g2_monomial points are required", path)
+	}
+	if err := checkPoints("g1_lagrange", setup.SetupG1Lagrange[:], gokzg4844.CompressedG1Size); err != nil {
+		return nil, nil, fmt.Errorf("malformed trusted setup %s: %w", path, err)
+	}
+	if err := checkPoints("g2_monomial", setup.SetupG2, gokzg4844.CompressedG2Size); err != nil {
+		return nil, nil, fmt.Errorf("malformed trusted setup %s: %w", path, err)
+	}
+	if err := gokzg4844.CheckTrustedSetupIsWellFormed(&setup); err != nil {
+		return nil, nil, fmt.Errorf("malformed trusted setup %s: %w", path, err)
+	}
+
+	ctx, err := gokzg4844.NewContext4096(&setup)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid trusted setup %s: %w", path, err)
+	}
+	cells := sync.OnceValues(func() (*cellSetup, error) {
+		result, err := newCellSetup(&cellPoints)
+		if err != nil {
+			return nil, fmt.Errorf("trusted setup %s: %w", path, err)
+		}
+		return result, nil
+	})
+	return ctx, cells, nil
+}
+
+// checkPoints returns an error if a point is not a 0x prefixed hex string of a compressed point of size bytes.
+func checkPoints(field string, points []string, size int) error {
+	for i, point := range points {
+		if len(point) != 2+2*size || !strings.HasPrefix(point, "0x") {
+			return fmt.Errorf("%s point %d is not a 0x prefixed %d byte point", field, i, size)
+		}
+	}
+	return nil
+}
+
+// kzgContext returns the context of the configured trusted setup, loading the default setup on first use.
+func kzgContext() (*gokzg4844.Context, error) {
+	configMu.RLock()
+	ctx := customContext
+	configMu.RUnlock()
+
+	if ctx != nil {
+		return ctx, nil
+	}
+	return defaultContext()
+}
+
+// cellContext returns the cell setup of the configured trusted setup, loading the default setup on first use.
+func cellContext() (*cellSetup, error) {
+	configMu.RLock()
+	cells := customCellSetup
+	configMu.RUnlock()
+
+	if cells != nil {
+		return cells()
+	}
+	return defaultCellSetup()
+}
+
+// checkBlobCount returns ErrTooManyBlobs if count is above the configured maximum.
+func checkBlobCount(count int) error {
+	configMu.RLock()
+	max := maxBlobsPerBlock
+	configMu.RUnlock()
+
+	if max > 0 && count > max {
+		return fmt.Errorf("%w: %d blobs, at most %d are allowed", ErrTooManyBlobs, count, max)
+	}
+	return nil
+}
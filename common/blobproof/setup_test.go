@@ -0,0 +1,83 @@
+package blobproof
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	gokzg4844 "github.com/crate-crypto/go-kzg-4844"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSetup writes a trusted setup to a file, returning its path.
+func writeSetup(t *testing.T, data []byte) string {
+	path := filepath.Join(t.TempDir(), "trusted_setup.json")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// insecureSetup returns a well formed trusted setup whose points are all the generators, which cannot verify the
+// proofs of the Ethereum KZG ceremony's setup.
+func insecureSetup(t *testing.T) []byte {
+	_, _, g1, g2 := bls12381.Generators()
+	g1Bytes, g2Bytes := g1.Bytes(), g2.Bytes()
+
+	var setup gokzg4844.JSONTrustedSetup
+	for i := range setup.SetupG1Lagrange {
+		setup.SetupG1Lagrange[i] = "0x" + hex.EncodeToString(g1Bytes[:])
+	}
+	setup.SetupG2 = []string{"0x" + hex.EncodeToString(g2Bytes[:]), "0x" + hex.EncodeToString(g2Bytes[:])}
+
+	data, err := json.Marshal(setup)
+	require.NoError(t, err)
+	return data
+}
+
+func TestConfigure_TrustedSetup(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Configure(Config{})) })
+	block := newTestBlock(t, 2)
+
+	require.NoError(t, Configure(Config{TrustedSetupPath: writeSetup(t, insecureSetup(t))}))
+	require.ErrorIs(t, VerifyBlobsBatch(block.sidecars), ErrInvalidBlobProof)
+
+	// The default setup is restored by the zero config
+	require.NoError(t, Configure(Config{}))
+	require.NoError(t, VerifyBlobsBatch(block.sidecars))
+}
+
+func TestConfigure_InvalidTrustedSetup(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Configure(Config{})) })
+
+	err := Configure(Config{TrustedSetupPath: filepath.Join(t.TempDir(), "missing.json")})
+	require.ErrorContains(t, err, "failed to read trusted setup")
+
+	err = Configure(Config{TrustedSetupPath: writeSetup(t, []byte("{"))})
+	require.ErrorContains(t, err, "malformed trusted setup")
+
+	err = Configure(Config{TrustedSetupPath: writeSetup(t, []byte(`{"g2_monomial":["0x00","0x00"]}`))})
+	require.ErrorContains(t, err, "malformed trusted setup")
+
+	err = Configure(Config{TrustedSetupPath: writeSetup(t, []byte(`{"g2_monomial":[]}`))})
+	require.ErrorContains(t, err, "at least 2 g2_monomial points")
+
+	// A failed configuration leaves the previous one in place
+	require.NoError(t, VerifyBlobsBatch(newTestBlock(t, 1).sidecars))
+}
+
+func TestConfigure_MaxBlobsPerBlock(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Configure(Config{})) })
+	block := newTestBlock(t, 3)
+
+	require.NoError(t, Configure(Config{MaxBlobsPerBlock: 2}))
+	require.ErrorIs(t, VerifyBlobsBatch(block.sidecars), ErrTooManyBlobs)
+	require.NoError(t, VerifyBlobsBatch(block.sidecars[:2]))
+
+	bundle, err := NewBundle(block.sidecars)
+	require.NoError(t, err)
+	require.ErrorIs(t, bundle.Verify(block.root), ErrTooManyBlobs)
+
+	require.ErrorContains(t, Configure(Config{MaxBlobsPerBlock: -1}), "must not be negative")
+}
@@ -24,7 +24,7 @@ var (
 	EndSlot   = uint64(15)
 )
 
-func RandBytes(t *testing.T, size uint) []byte {
+func RandBytes(t testing.TB, size uint) []byte {
 	randomBytes := make([]byte, size)
 	_, err := rand.Read(randomBytes)
 	require.NoError(t, err)
@@ -3,6 +3,8 @@ package flags
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -11,13 +13,21 @@ import (
 type DataStorage string
 type S3CredentialType string
 
+// Compression is the codec that newly written blobs are compressed with.
+type Compression string
+
 const (
 	DataStorageUnknown  DataStorage      = "unknown"
 	DataStorageS3       DataStorage      = "s3"
 	DataStorageFile     DataStorage      = "file"
+	DataStorageGCS      DataStorage      = "gcs"
+	DataStorageAzure    DataStorage      = "azure"
 	S3CredentialUnknown S3CredentialType = "unknown"
 	S3CredentialStatic  S3CredentialType = "static"
 	S3CredentialIAM     S3CredentialType = "iam"
+	CompressionNone     Compression      = "none"
+	CompressionGzip     Compression      = "gzip"
+	CompressionZstd     Compression      = "zstd"
 )
 
 type S3Config struct {
@@ -29,7 +39,14 @@ type S3Config struct {
 	S3CredentialType S3CredentialType
 	AccessKey        string
 	SecretAccessKey  string
-	Compress         bool
+	// Compress compresses blobs with gzip, unless Compression is set
+	Compress    bool
+	Compression Compression
+
+	// ObjectTags are comma separated key=value tags added to every blob
+	ObjectTags string
+	// TagSlot adds a slot tag to every blob
+	TagSlot bool
 }
 
 func (c S3Config) check() error {
@@ -55,19 +72,119 @@ func (c S3Config) check() error {
 		return errors.New("s3 bucket must be set")
 	}
 
+	if _, err := ParseObjectTags(c.ObjectTags); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GCSConfig configures a Google Cloud Storage bucket. Requests are authenticated with the service account key in
+// CredentialsFile if it is set, and otherwise with the application default credentials of the environment.
+type GCSConfig struct {
+	Bucket          string
+	Path            string
+	CredentialsFile string
+	// Endpoint overrides the storage API endpoint, e.g. for a private endpoint
+	Endpoint string
+	// Compress compresses blobs with gzip, unless Compression is set
+	Compress    bool
+	Compression Compression
+}
+
+func (c GCSConfig) check() error {
+	if c.Bucket == "" {
+		return errors.New("gcs bucket must be set")
+	}
+
+	return nil
+}
+
+// AzureConfig configures an Azure Blob Storage container. Requests are authenticated with the shared key of the
+// account if AccountKey is set, and otherwise with the Azure identity of the environment, e.g. a managed identity.
+type AzureConfig struct {
+	AccountName string
+	AccountKey  string
+	Container   string
+	Path        string
+	// Endpoint is the blob service URL, https://<account>.blob.core.windows.net/ when unset
+	Endpoint string
+	// Compress compresses blobs with gzip, unless Compression is set
+	Compress    bool
+	Compression Compression
+}
+
+// ServiceURL returns the URL of the blob service of the account.
+func (c AzureConfig) ServiceURL() string {
+	if c.Endpoint != "" {
+		return c.Endpoint
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net/", c.AccountName)
+}
+
+func (c AzureConfig) check() error {
+	if c.AccountName == "" {
+		return errors.New("azure account name must be set")
+	}
+
+	if c.Container == "" {
+		return errors.New("azure container must be set")
+	}
+
 	return nil
 }
 
+// ParseObjectTags parses comma separated key=value tags, e.g. "team=infra,env=prod".
+func ParseObjectTags(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	if s == "" {
+		return result, nil
+	}
+
+	for _, tag := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(tag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid s3 object tag %q, expected key=value", tag)
+		}
+		result[key] = strings.TrimSpace(value)
+	}
+
+	return result, nil
+}
+
+// networkPrefixPattern restricts a network prefix to a single path segment, so that one network's prefix cannot
+// resolve to another's namespace, e.g. "holesky/../mainnet".
+var networkPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 type BeaconConfig struct {
+	// BeaconURL is the URL of the beacon node, or a comma separated list of beacon nodes to fail over between
 	BeaconURL           string
 	BeaconClientTimeout time.Duration
 	EnforceJSON         bool
+	// Quorum is the number of beacon nodes that must return identical blob sidecars for them to be used, 0 or 1 using
+	// the sidecars of whichever node answers
+	Quorum uint64
+}
+
+// BeaconURLs returns the beacon node URLs, a single one unless a comma separated list is configured.
+func (c BeaconConfig) BeaconURLs() []string {
+	return splitList(c.BeaconURL)
 }
 
 type StorageConfig struct {
 	DataStorageType      DataStorage
 	S3Config             S3Config
+	GCSConfig            GCSConfig
+	AzureConfig          AzureConfig
 	FileStorageDirectory string
+	// PreviousShards are the buckets or directories that the blobs were sharded across before a rebalance
+	PreviousShards []string
+	// NetworkPrefix namespaces every key in storage, so that networks sharing a bucket or directory are kept apart
+	NetworkPrefix string
+	// Compression is the codec newly written blobs are compressed with on any backend. Blobs are read whatever they
+	// were compressed with, so it can be changed at any time.
+	Compression Compression
 }
 
 func NewBeaconConfig(cliCtx *cli.Context) BeaconConfig {
@@ -77,6 +194,7 @@ func NewBeaconConfig(cliCtx *cli.Context) BeaconConfig {
 		BeaconURL:           cliCtx.String(BeaconHttpFlagName),
 		BeaconClientTimeout: timeout,
 		EnforceJSON:         cliCtx.Bool(BeaconHttpEnforceJson),
+		Quorum:              cliCtx.Uint64(BeaconQuorumFlagName),
 	}
 }
 
@@ -84,20 +202,109 @@ func NewStorageConfig(cliCtx *cli.Context) StorageConfig {
 	return StorageConfig{
 		DataStorageType:      toDataStorage(cliCtx.String(DataStoreFlagName)),
 		S3Config:             readS3Config(cliCtx),
+		GCSConfig:            readGCSConfig(cliCtx),
+		AzureConfig:          readAzureConfig(cliCtx),
 		FileStorageDirectory: cliCtx.String(FileStorageDirectoryFlagName),
+		PreviousShards:       splitList(cliCtx.String(StoragePreviousShardsFlagName)),
+		NetworkPrefix:        cliCtx.String(NetworkPrefixFlagName),
+		Compression:          Compression(cliCtx.String(StorageCompressionFlagName)),
 	}
 }
 
-func toDataStorage(s string) DataStorage {
-	if s == string(DataStorageS3) {
-		return DataStorageS3
+// Shards returns the buckets, containers or directories that the blobs are sharded across. There is a single shard
+// unless a comma separated list is configured.
+func (c StorageConfig) Shards() []string {
+	switch c.DataStorageType {
+	case DataStorageS3:
+		return splitList(c.S3Config.Bucket)
+	case DataStorageGCS:
+		return splitList(c.GCSConfig.Bucket)
+	case DataStorageAzure:
+		return splitList(c.AzureConfig.Container)
+	default:
+		return splitList(c.FileStorageDirectory)
+	}
+}
+
+// Backend returns the backend in the form parsed by ParseBackend, e.g. s3:bucket/path, to name it in logs and metrics.
+func (c StorageConfig) Backend() string {
+	var location, dir string
+	switch c.DataStorageType {
+	case DataStorageS3:
+		location, dir = c.S3Config.Bucket, c.S3Config.Path
+	case DataStorageGCS:
+		location, dir = c.GCSConfig.Bucket, c.GCSConfig.Path
+	case DataStorageAzure:
+		location, dir = c.AzureConfig.Container, c.AzureConfig.Path
+	default:
+		location = c.FileStorageDirectory
+	}
+	if dir != "" {
+		location += "/" + dir
+	}
+	return string(c.DataStorageType) + ":" + location
+}
+
+// ParseBackend returns the storage config for a backend given as file:<directory>, or s3:, gcs: or azure: followed by
+// <bucket>[/<path>], the bucket being a container on Azure. The connection settings are taken from base.
+func ParseBackend(spec string, base StorageConfig) (StorageConfig, error) {
+	kind, location, ok := strings.Cut(spec, ":")
+	if !ok || location == "" {
+		return StorageConfig{}, fmt.Errorf("expected file:<directory>, or s3:, gcs: or azure: followed by <bucket>[/<path>], got %q", spec)
+	}
+
+	result := base
+	result.PreviousShards = nil
+	switch DataStorage(kind) {
+	case DataStorageFile:
+		result.DataStorageType = DataStorageFile
+		result.FileStorageDirectory = location
+	case DataStorageS3:
+		result.DataStorageType = DataStorageS3
+		result.S3Config.Bucket, result.S3Config.Path, _ = strings.Cut(location, "/")
+	case DataStorageGCS:
+		result.DataStorageType = DataStorageGCS
+		result.GCSConfig.Bucket, result.GCSConfig.Path, _ = strings.Cut(location, "/")
+	case DataStorageAzure:
+		result.DataStorageType = DataStorageAzure
+		result.AzureConfig.Container, result.AzureConfig.Path, _ = strings.Cut(location, "/")
+	default:
+		return StorageConfig{}, fmt.Errorf("unknown backend type %q", kind)
 	}
 
-	if s == string(DataStorageFile) {
-		return DataStorageFile
+	return result, nil
+}
+
+// ParseBackends parses a comma-separated list of backends, see ParseBackend.
+func ParseBackends(specs string, base StorageConfig) ([]StorageConfig, error) {
+	var result []StorageConfig
+	for _, spec := range splitList(specs) {
+		cfg, err := ParseBackend(spec, base)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cfg)
 	}
+	return result, nil
+}
 
-	return DataStorageUnknown
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func toDataStorage(s string) DataStorage {
+	switch DataStorage(s) {
+	case DataStorageS3, DataStorageFile, DataStorageGCS, DataStorageAzure:
+		return DataStorage(s)
+	default:
+		return DataStorageUnknown
+	}
 }
 
 func readS3Config(ctx *cli.Context) S3Config {
@@ -110,6 +317,29 @@ func readS3Config(ctx *cli.Context) S3Config {
 		Path:             ctx.String(S3PathFlagName),
 		S3CredentialType: toS3CredentialType(ctx.String(S3CredentialTypeFlagName)),
 		Compress:         ctx.Bool(S3CompressFlagName),
+		ObjectTags:       ctx.String(S3ObjectTagsFlagName),
+		TagSlot:          ctx.Bool(S3TagSlotFlagName),
+	}
+}
+
+func readGCSConfig(ctx *cli.Context) GCSConfig {
+	return GCSConfig{
+		Bucket:          ctx.String(GCSBucketFlagName),
+		Path:            ctx.String(GCSPathFlagName),
+		CredentialsFile: ctx.String(GCSCredentialsFileFlagName),
+		Endpoint:        ctx.String(GCSEndpointFlagName),
+		Compress:        ctx.Bool(GCSCompressFlagName),
+	}
+}
+
+func readAzureConfig(ctx *cli.Context) AzureConfig {
+	return AzureConfig{
+		AccountName: ctx.String(AzureAccountNameFlagName),
+		AccountKey:  ctx.String(AzureAccountKeyFlagName),
+		Container:   ctx.String(AzureContainerFlagName),
+		Path:        ctx.String(AzurePathFlagName),
+		Endpoint:    ctx.String(AzureEndpointFlagName),
+		Compress:    ctx.Bool(AzureCompressFlagName),
 	}
 }
 
@@ -123,10 +353,14 @@ func toS3CredentialType(s string) S3CredentialType {
 }
 
 func (c BeaconConfig) Check() error {
-	if c.BeaconURL == "" {
+	if len(c.BeaconURLs()) == 0 {
 		return errors.New("beacon url must be set")
 	}
 
+	if c.Quorum > uint64(len(c.BeaconURLs())) {
+		return fmt.Errorf("beacon quorum of %d is more than the %d beacon nodes configured", c.Quorum, len(c.BeaconURLs()))
+	}
+
 	if c.BeaconClientTimeout == 0 {
 		return errors.New("beacon client timeout must be set")
 	}
@@ -139,12 +373,33 @@ func (c StorageConfig) Check() error {
 		return errors.New("unknown data-storage type")
 	}
 
-	if c.DataStorageType == DataStorageS3 {
+	switch c.DataStorageType {
+	case DataStorageS3:
 		if err := c.S3Config.check(); err != nil {
 			return fmt.Errorf("s3 config check failed: %w", err)
 		}
-	} else if c.DataStorageType == DataStorageFile && c.FileStorageDirectory == "" {
-		return errors.New("file storage directory must be set")
+	case DataStorageGCS:
+		if err := c.GCSConfig.check(); err != nil {
+			return fmt.Errorf("gcs config check failed: %w", err)
+		}
+	case DataStorageAzure:
+		if err := c.AzureConfig.check(); err != nil {
+			return fmt.Errorf("azure config check failed: %w", err)
+		}
+	case DataStorageFile:
+		if c.FileStorageDirectory == "" {
+			return errors.New("file storage directory must be set")
+		}
+	}
+
+	if c.NetworkPrefix != "" && !networkPrefixPattern.MatchString(c.NetworkPrefix) {
+		return fmt.Errorf("invalid network prefix %q, must only contain letters, digits, '.', '_' and '-'", c.NetworkPrefix)
+	}
+
+	switch c.Compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("invalid storage compression %q, must be none, gzip or zstd", c.Compression)
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package flags
 
 import (
 	opservice "github.com/ethereum-optimism/optimism/op-service"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	"github.com/urfave/cli/v2"
 )
 
@@ -9,6 +10,7 @@ const (
 	BeaconHttpFlagName              = "l1-beacon-http"
 	BeaconHttpClientTimeoutFlagName = "l1-beacon-client-timeout"
 	BeaconHttpEnforceJson           = "l1-beacon-enforce-json"
+	BeaconQuorumFlagName            = "l1-beacon-quorum"
 	DataStoreFlagName               = "data-store"
 	S3CredentialTypeFlagName        = "s3-credential-type"
 	S3EndpointFlagName              = "s3-endpoint"
@@ -18,21 +20,83 @@ const (
 	S3SecretAccessKeyFlagName       = "s3-secret-access-key"
 	S3BucketFlagName                = "s3-bucket"
 	S3PathFlagName                  = "s3-path"
+	S3ObjectTagsFlagName            = "s3-object-tags"
+	S3TagSlotFlagName               = "s3-tag-slot"
+	GCSBucketFlagName               = "gcs-bucket"
+	GCSPathFlagName                 = "gcs-path"
+	GCSCredentialsFileFlagName      = "gcs-credentials-file"
+	GCSEndpointFlagName             = "gcs-endpoint"
+	GCSCompressFlagName             = "gcs-compress"
+	AzureAccountNameFlagName        = "azure-account-name"
+	AzureAccountKeyFlagName         = "azure-account-key"
+	AzureContainerFlagName          = "azure-container"
+	AzurePathFlagName               = "azure-path"
+	AzureEndpointFlagName           = "azure-endpoint"
+	AzureCompressFlagName           = "azure-compress"
 	FileStorageDirectoryFlagName    = "file-directory"
+	StoragePreviousShardsFlagName   = "storage-previous-shards"
+	NetworkPrefixFlagName           = "network-prefix"
+	StorageCompressionFlagName      = "storage-compression"
+	LogFormatFlagName               = "log-format"
 )
 
 func CLIFlags(envPrefix string) []cli.Flag {
+	return append(BeaconFlags(envPrefix), StorageFlags(envPrefix)...)
+}
+
+// LogFlags returns the logging flags, with log-format accepted as an alias of log.format. The json format writes each
+// log line as a JSON object, so that fields such as component, slot, root, format, duration and err can be parsed by
+// log aggregation pipelines.
+func LogFlags(envPrefix string) []cli.Flag {
+	result := oplog.CLIFlags(envPrefix)
+	for _, flag := range result {
+		if f, ok := flag.(*cli.GenericFlag); ok && f.Name == oplog.FormatFlagName {
+			f.Aliases = append(f.Aliases, LogFormatFlagName)
+			f.Usage = "Format the log output. Supported formats: 'text', 'terminal', 'logfmt', 'json', 'json-pretty'"
+		}
+	}
+	return result
+}
+
+// BeaconFlags returns the flags required to configure the beacon client.
+func BeaconFlags(envPrefix string) []cli.Flag {
 	return []cli.Flag{
 		// Required Flags
 		&cli.StringFlag{
 			Name:     BeaconHttpFlagName,
-			Usage:    "HTTP provider URL for L1 Beacon-node API",
+			Usage:    "HTTP provider URL for L1 Beacon-node API, a comma separated list of URLs fails over between them",
 			Required: true,
 			EnvVars:  opservice.PrefixEnvVar(envPrefix, "L1_BEACON_HTTP"),
 		},
+		// Beacon Client Settings
+		&cli.StringFlag{
+			Name:    BeaconHttpClientTimeoutFlagName,
+			Usage:   "The timeout duration for the beacon client",
+			Value:   "10s",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "L1_BEACON_CLIENT_TIMEOUT"),
+		},
+		&cli.BoolFlag{
+			Name:    BeaconHttpEnforceJson,
+			Usage:   "When true uses json for all requests/responses to the beacon node",
+			Value:   false,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "L1_BEACON_CLIENT_ENFORCE_JSON"),
+		},
+		&cli.Uint64Flag{
+			Name:    BeaconQuorumFlagName,
+			Usage:   "When set above 1, blob sidecars are fetched from every beacon node and only used once this many nodes returned identical sidecars",
+			Value:   1,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "L1_BEACON_QUORUM"),
+		},
+	}
+}
+
+// StorageFlags returns the flags required to configure the storage backend.
+func StorageFlags(envPrefix string) []cli.Flag {
+	return []cli.Flag{
+		// Required Flags
 		&cli.StringFlag{
 			Name:     DataStoreFlagName,
-			Usage:    "The type of data-store, options are [s3, file]",
+			Usage:    "The type of data-store, options are [s3, gcs, azure, file]",
 			Required: true,
 			EnvVars:  opservice.PrefixEnvVar(envPrefix, "DATA_STORE"),
 		},
@@ -74,7 +138,7 @@ func CLIFlags(envPrefix string) []cli.Flag {
 		},
 		&cli.StringFlag{
 			Name:    S3BucketFlagName,
-			Usage:   "The bucket to use",
+			Usage:   "The bucket to use, a comma separated list of buckets shards the blobs across them",
 			Hidden:  true,
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_BUCKET"),
 		},
@@ -85,24 +149,97 @@ func CLIFlags(envPrefix string) []cli.Flag {
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_PATH"),
 			Value:   "",
 		},
+		&cli.StringFlag{
+			Name:    S3ObjectTagsFlagName,
+			Usage:   "Comma separated key=value tags to add to every blob written to S3, for use in bucket lifecycle rules",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_OBJECT_TAGS"),
+		},
+		&cli.BoolFlag{
+			Name:    S3TagSlotFlagName,
+			Usage:   "Whether to tag each blob written to S3 with its slot",
+			Value:   false,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_TAG_SLOT"),
+		},
+		// GCS Data Store Flags
+		&cli.StringFlag{
+			Name:    GCSBucketFlagName,
+			Usage:   "The GCS bucket to use, a comma separated list of buckets shards the blobs across them",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "GCS_BUCKET"),
+		},
+		&cli.StringFlag{
+			Name:    GCSPathFlagName,
+			Usage:   "The path within the GCS bucket to store blobs under",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "GCS_PATH"),
+		},
+		&cli.StringFlag{
+			Name:    GCSCredentialsFileFlagName,
+			Usage:   "The service account key file to authenticate to GCS with, the application default credentials are used when unset",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "GCS_CREDENTIALS_FILE"),
+		},
+		&cli.StringFlag{
+			Name:    GCSEndpointFlagName,
+			Usage:   "Overrides the GCS API endpoint, e.g. for a private endpoint",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "GCS_ENDPOINT"),
+		},
+		&cli.BoolFlag{
+			Name:    GCSCompressFlagName,
+			Usage:   "Whether to compress data before storing in GCS",
+			Value:   false,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "GCS_COMPRESS"),
+		},
+		// Azure Data Store Flags
+		&cli.StringFlag{
+			Name:    AzureAccountNameFlagName,
+			Usage:   "The Azure storage account to use",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "AZURE_ACCOUNT_NAME"),
+		},
+		&cli.StringFlag{
+			Name:    AzureAccountKeyFlagName,
+			Usage:   "The shared key of the Azure storage account, the Azure identity of the environment is used when unset",
+			Hidden:  true,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "AZURE_ACCOUNT_KEY"),
+		},
+		&cli.StringFlag{
+			Name:    AzureContainerFlagName,
+			Usage:   "The Azure container to use, a comma separated list of containers shards the blobs across them",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "AZURE_CONTAINER"),
+		},
+		&cli.StringFlag{
+			Name:    AzurePathFlagName,
+			Usage:   "The path within the Azure container to store blobs under",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "AZURE_PATH"),
+		},
+		&cli.StringFlag{
+			Name:    AzureEndpointFlagName,
+			Usage:   "The Azure blob service URL, https://<account>.blob.core.windows.net/ when unset",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "AZURE_ENDPOINT"),
+		},
+		&cli.BoolFlag{
+			Name:    AzureCompressFlagName,
+			Usage:   "Whether to compress data before storing in Azure",
+			Value:   false,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "AZURE_COMPRESS"),
+		},
 		// File Data Store Flags
 		&cli.StringFlag{
 			Name:    FileStorageDirectoryFlagName,
-			Usage:   "The path to the directory to use for storing blobs on the file system",
+			Usage:   "The path to the directory to use for storing blobs on the file system, a comma separated list of directories shards the blobs across them",
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "FILE_DIRECTORY"),
 		},
-		// Beacon Client Settings
 		&cli.StringFlag{
-			Name:    BeaconHttpClientTimeoutFlagName,
-			Usage:   "The timeout duration for the beacon client",
-			Value:   "10s",
-			EnvVars: opservice.PrefixEnvVar(envPrefix, "L1_BEACON_CLIENT_TIMEOUT"),
+			Name:    StoragePreviousShardsFlagName,
+			Usage:   "While rebalancing, the comma separated list of buckets or directories the blobs were previously sharded across. Reads that miss fall through to the previous placement",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "STORAGE_PREVIOUS_SHARDS"),
 		},
-		&cli.BoolFlag{
-			Name:    BeaconHttpEnforceJson,
-			Usage:   "When true uses json for all requests/responses to the beacon node",
-			Value:   false,
-			EnvVars: opservice.PrefixEnvVar(envPrefix, "L1_BEACON_CLIENT_ENFORCE_JSON"),
+		&cli.StringFlag{
+			Name:    NetworkPrefixFlagName,
+			Usage:   "A namespace for every storage key, e.g. the network name, so that archives for several networks can share a bucket or directory",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "NETWORK_PREFIX"),
+		},
+		&cli.StringFlag{
+			Name:    StorageCompressionFlagName,
+			Usage:   "The codec to compress newly stored blobs with: none, gzip or zstd. Takes precedence over the s3-compress, gcs-compress and azure-compress flags. Blobs already stored are read whatever they were compressed with",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "STORAGE_COMPRESSION"),
 		},
 	}
 }
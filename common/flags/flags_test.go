@@ -0,0 +1,80 @@
+package flags
+
+import (
+	"testing"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func readLogConfig(t *testing.T, args ...string) oplog.CLIConfig {
+	var cfg oplog.CLIConfig
+	app := cli.NewApp()
+	app.Flags = LogFlags("TEST")
+	app.Action = func(cliCtx *cli.Context) error {
+		cfg = oplog.ReadCLIConfig(cliCtx)
+		return nil
+	}
+	require.NoError(t, app.Run(append([]string{"test"}, args...)))
+	return cfg
+}
+
+func TestLogFlags_Format(t *testing.T) {
+	require.Equal(t, oplog.FormatText, readLogConfig(t).Format)
+	require.Equal(t, oplog.FormatJSON, readLogConfig(t, "--log-format", "json").Format)
+	require.Equal(t, oplog.FormatJSON, readLogConfig(t, "--log.format", "json").Format)
+	require.Equal(t, oplog.FormatText, readLogConfig(t, "--log-format", "text").Format)
+}
+
+func TestLogFlags_InvalidFormat(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = LogFlags("TEST")
+	app.Action = func(*cli.Context) error { return nil }
+	require.Error(t, app.Run([]string{"test", "--log-format", "xml"}))
+}
+
+func TestStorageConfig_Backends(t *testing.T) {
+	gcs := StorageConfig{DataStorageType: toDataStorage("gcs"), GCSConfig: GCSConfig{Bucket: "a, b"}}
+	require.NoError(t, gcs.Check())
+	require.Equal(t, []string{"a", "b"}, gcs.Shards())
+	require.ErrorContains(t, StorageConfig{DataStorageType: DataStorageGCS}.Check(), "gcs bucket must be set")
+
+	azure := StorageConfig{DataStorageType: toDataStorage("azure"), AzureConfig: AzureConfig{AccountName: "account", Container: "blobs"}}
+	require.NoError(t, azure.Check())
+	require.Equal(t, []string{"blobs"}, azure.Shards())
+	require.Equal(t, "https://account.blob.core.windows.net/", azure.AzureConfig.ServiceURL())
+	azure.AzureConfig.Endpoint = "http://localhost:10000/devstoreaccount1/"
+	require.Equal(t, "http://localhost:10000/devstoreaccount1/", azure.AzureConfig.ServiceURL())
+	require.ErrorContains(t, StorageConfig{DataStorageType: DataStorageAzure, AzureConfig: AzureConfig{Container: "blobs"}}.Check(), "azure account name must be set")
+	require.ErrorContains(t, StorageConfig{DataStorageType: DataStorageAzure, AzureConfig: AzureConfig{AccountName: "account"}}.Check(), "azure container must be set")
+
+	require.Equal(t, DataStorageUnknown, toDataStorage("gs"))
+}
+
+func TestParseBackends(t *testing.T) {
+	base := StorageConfig{DataStorageType: DataStorageS3, S3Config: S3Config{Endpoint: "s3.example.com", Bucket: "primary"}, PreviousShards: []string{"old"}}
+
+	backends, err := ParseBackends("file:/mirror, s3:replica/blobs,gcs:bucket,azure:container/path", base)
+	require.NoError(t, err)
+	require.Len(t, backends, 4)
+	require.Equal(t, DataStorageFile, backends[0].DataStorageType)
+	require.Equal(t, "/mirror", backends[0].FileStorageDirectory)
+	require.Equal(t, "s3.example.com", backends[1].S3Config.Endpoint)
+	require.Equal(t, "replica", backends[1].S3Config.Bucket)
+	require.Equal(t, "blobs", backends[1].S3Config.Path)
+	require.Nil(t, backends[1].PreviousShards)
+	require.Equal(t, "bucket", backends[2].GCSConfig.Bucket)
+	require.Equal(t, "container", backends[3].AzureConfig.Container)
+	require.Equal(t, "path", backends[3].AzureConfig.Path)
+	require.Equal(t, []string{"file:/mirror", "s3:replica/blobs", "gcs:bucket", "azure:container/path"}, []string{backends[0].Backend(), backends[1].Backend(), backends[2].Backend(), backends[3].Backend()})
+
+	backends, err = ParseBackends("", base)
+	require.NoError(t, err)
+	require.Empty(t, backends)
+
+	_, err = ParseBackends("file:/mirror,ftp:host", base)
+	require.ErrorContains(t, err, "unknown backend type \"ftp\"")
+	_, err = ParseBackends("s3:", base)
+	require.ErrorContains(t, err, "expected file:<directory>")
+}
@@ -0,0 +1,26 @@
+// Package forks defines the limits of the consensus layer forks that blobs are stored, served and fetched for, so that
+// the packages that check them share one table. It has no dependencies, so that it can be imported by any of them.
+package forks
+
+const (
+	// DenebMaxBlobsPerBlock is the MAX_BLOBS_PER_BLOCK of deneb
+	DenebMaxBlobsPerBlock = 6
+	// ElectraMaxBlobsPerBlock is the MAX_BLOBS_PER_BLOCK of electra
+	ElectraMaxBlobsPerBlock = 9
+	// LatestMaxBlobsPerBlock is the MAX_BLOBS_PER_BLOCK of the latest fork in the table, the most blobs a block of any
+	// known fork has
+	LatestMaxBlobsPerBlock = ElectraMaxBlobsPerBlock
+)
+
+// maxBlobsPerBlock is the MAX_BLOBS_PER_BLOCK of each fork, by the name that is sent in the Eth-Consensus-Version
+// header.
+var maxBlobsPerBlock = map[string]uint64{
+	"deneb":   DenebMaxBlobsPerBlock,
+	"electra": ElectraMaxBlobsPerBlock,
+}
+
+// MaxBlobsPerBlock returns the MAX_BLOBS_PER_BLOCK of the fork, or 0 if the fork is empty or not known, in which case
+// indices should not be checked against a maximum.
+func MaxBlobsPerBlock(fork string) uint64 {
+	return maxBlobsPerBlock[fork]
+}
@@ -0,0 +1,18 @@
+package forks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxBlobsPerBlock(t *testing.T) {
+	require.Equal(t, uint64(6), MaxBlobsPerBlock("deneb"))
+	require.Equal(t, uint64(9), MaxBlobsPerBlock("electra"))
+	require.Zero(t, MaxBlobsPerBlock(""))
+	require.Zero(t, MaxBlobsPerBlock("capella"))
+
+	for _, max := range maxBlobsPerBlock {
+		require.LessOrEqual(t, max, uint64(LatestMaxBlobsPerBlock))
+	}
+}
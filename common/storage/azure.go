@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// AzureStorage stores blobs in an Azure Blob Storage container, laid out and encoded the same way as S3Storage. Blobs
+// are written without the object metadata of S3Storage, as Azure only accepts metadata names that are identifiers.
+type AzureStorage struct {
+	client      *azblob.Client
+	container   string
+	path        string
+	log         log.Logger
+	compression flags.Compression
+}
+
+func NewAzureStorage(cfg flags.AzureConfig, l log.Logger) (*AzureStorage, error) {
+	var client *azblob.Client
+	if cfg.AccountKey != "" {
+		cred, err := azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(cfg.ServiceURL(), cred, nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		client, err = azblob.NewClient(cfg.ServiceURL(), cred, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storage := &AzureStorage{
+		client:      client,
+		container:   cfg.Container,
+		path:        cfg.Path,
+		log:         l,
+		compression: blobCompression(cfg.Compression, cfg.Compress),
+	}
+
+	_, err := storage.ReadBackfillProcesses(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty backfill_processes object")
+		if err := storage.WriteBackfillProcesses(context.Background(), BackfillProcesses{}); err != nil {
+			return nil, fmt.Errorf("failed to create backfill_processes object: %w", err)
+		}
+	}
+
+	_, err = storage.ReadBackfillWAL(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty backfill_wal object")
+		if err := storage.WriteBackfillWAL(context.Background(), BackfillWAL{}); err != nil {
+			return nil, fmt.Errorf("failed to create backfill_wal object: %w", err)
+		}
+	}
+
+	_, err = storage.ReadLockfile(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty lockfile object")
+		if err := storage.WriteLockfile(context.Background(), Lockfile{}); err != nil {
+			return nil, fmt.Errorf("failed to create lockfile object: %w", err)
+		}
+	}
+
+	return storage, nil
+}
+
+func (s *AzureStorage) name(name string) string {
+	return path.Join(s.path, name)
+}
+
+func (s *AzureStorage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
+	client := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(s.name(hash.String()))
+	_, err := client.GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return false, nil
+	} else if err != nil {
+		s.log.Info("unexpected error checking blob", "root", hash.String(), "err", err)
+		return false, ErrStorage
+	}
+
+	return true, nil
+}
+
+func (s *AzureStorage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
+	res, err := s.client.DownloadStream(ctx, s.container, s.name(hash.String()), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		s.log.Info("unable to find blob", "root", hash.String())
+		return BlobData{}, ErrNotFound
+	} else if err != nil {
+		s.log.Info("unexpected error fetching blob", "root", hash.String(), "err", err)
+		return BlobData{}, ErrStorage
+	}
+	defer res.Body.Close()
+
+	if res.ContentLength != nil && *res.ContentLength == 0 {
+		return emptyBlobData(hash), nil
+	}
+
+	contentEncoding := ""
+	if res.ContentEncoding != nil {
+		contentEncoding = *res.ContentEncoding
+	}
+	reader, err := decompressBlob(res.Body, contentEncoding)
+	if err != nil {
+		s.log.Warn("error creating decompressor", "root", hash.String(), "err", err)
+		return BlobData{}, ErrMarshaling
+	}
+	defer reader.Close()
+
+	var data BlobData
+	err = json.NewDecoder(reader).Decode(&data)
+	if err != nil {
+		s.log.Warn("error decoding blob", "root", hash.String(), "err", err)
+		return BlobData{}, ErrMarshaling
+	}
+
+	return data, nil
+}
+
+// readJSON decodes the JSON blob with the given name into v.
+func (s *AzureStorage) readJSON(ctx context.Context, name string, v any) error {
+	res, err := s.client.DownloadStream(ctx, s.container, s.name(name), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		s.log.Info("unable to find " + name + " key")
+		return ErrNotFound
+	} else if err != nil {
+		s.log.Info("unexpected error fetching "+name, "err", err)
+		return ErrStorage
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		s.log.Warn("error decoding "+name, "err", err)
+		return ErrMarshaling
+	}
+
+	return nil
+}
+
+// writeObject writes b to the blob with the given name.
+func (s *AzureStorage) writeObject(ctx context.Context, name string, b []byte, contentEncoding string) error {
+	headers := &blob.HTTPHeaders{BlobContentType: to.Ptr("application/json")}
+	if contentEncoding != "" {
+		headers.BlobContentEncoding = to.Ptr(contentEncoding)
+	}
+
+	_, err := s.client.UploadBuffer(ctx, s.container, s.name(name), b, &azblob.UploadBufferOptions{HTTPHeaders: headers})
+	return err
+}
+
+// writeJSON encodes v and writes it to the blob with the given name.
+func (s *AzureStorage) writeJSON(ctx context.Context, name string, v any) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		s.log.Warn("error encoding "+name, "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.writeObject(ctx, name, d, ""); err != nil {
+		s.log.Warn("error writing to "+name, "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *AzureStorage) ReadBackfillProcesses(ctx context.Context) (BackfillProcesses, error) {
+	BackfillMu.Lock()
+	defer BackfillMu.Unlock()
+
+	var data BackfillProcesses
+	if err := s.readJSON(ctx, "backfill_processes", &data); err != nil {
+		return BackfillProcesses{}, err
+	}
+	return data, nil
+}
+
+func (s *AzureStorage) ReadBackfillWAL(ctx context.Context) (BackfillWAL, error) {
+	var data BackfillWAL
+	if err := s.readJSON(ctx, "backfill_wal", &data); err != nil {
+		return BackfillWAL{}, err
+	}
+	return data, nil
+}
+
+func (s *AzureStorage) ReadBackfillCheckpoint(ctx context.Context) (BackfillCheckpoint, error) {
+	var data BackfillCheckpoint
+	if err := s.readJSON(ctx, "backfill_checkpoint", &data); err != nil {
+		return BackfillCheckpoint{}, err
+	}
+	return data, nil
+}
+
+func (s *AzureStorage) ReadLockfile(ctx context.Context) (Lockfile, error) {
+	var data Lockfile
+	if err := s.readJSON(ctx, "lockfile", &data); err != nil {
+		return Lockfile{}, err
+	}
+	return data, nil
+}
+
+func (s *AzureStorage) WriteBackfillProcesses(ctx context.Context, data BackfillProcesses) error {
+	BackfillMu.Lock()
+	defer BackfillMu.Unlock()
+
+	if err := s.writeJSON(ctx, "backfill_processes", data); err != nil {
+		return err
+	}
+
+	s.log.Info("wrote to backfill_processes")
+	return nil
+}
+
+func (s *AzureStorage) WriteBackfillWAL(ctx context.Context, data BackfillWAL) error {
+	if err := s.writeJSON(ctx, "backfill_wal", data); err != nil {
+		return err
+	}
+
+	s.log.Debug("wrote to backfill_wal", "entries", len(data.Entries))
+	return nil
+}
+
+func (s *AzureStorage) WriteBackfillCheckpoint(ctx context.Context, data BackfillCheckpoint) error {
+	if err := s.writeJSON(ctx, "backfill_checkpoint", data); err != nil {
+		return err
+	}
+
+	s.log.Debug("wrote to backfill_checkpoint", "nextSlot", data.NextSlot)
+	return nil
+}
+
+func (s *AzureStorage) WriteLockfile(ctx context.Context, data Lockfile) error {
+	if err := s.writeJSON(ctx, "lockfile", data); err != nil {
+		return err
+	}
+
+	s.log.Info("wrote to lockfile", "archiverId", data.ArchiverId, "timestamp", strconv.FormatInt(data.Timestamp, 10))
+	return nil
+}
+
+func (s *AzureStorage) WriteBlob(ctx context.Context, data BlobData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.log.Warn("error encoding blob", "err", err)
+		return ErrMarshaling
+	}
+
+	b, contentEncoding, err := compressBlob(s.compression, b)
+	if err != nil {
+		s.log.Warn("error compressing blob", "err", err)
+		return ErrCompress
+	}
+
+	if err := s.writeObject(ctx, data.Header.BeaconBlockHash.String(), b, contentEncoding); err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote blob", "root", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+func (s *AzureStorage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	if err := s.writeObject(ctx, hash.String(), nil, ""); err != nil {
+		s.log.Warn("error writing empty blob", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote empty blob", "root", hash.String())
+	return nil
+}
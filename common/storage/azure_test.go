@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// azuriteAccountKey is the well known key of the devstoreaccount1 account of the Azurite emulator.
+const azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+// Prior to running these tests, a local Azurite emulator must be running.
+// You can accomplish this with:
+// docker compose down # shut down any running services
+// docker compose up azurite # start the Azure Blob Storage emulator
+func setupAzure(t *testing.T, compress bool) *AzureStorage {
+	if os.Getenv("RUN_INTEGRATION_TESTS") == "" {
+		t.Skip("skipping integration tests: set RUN_INTEGRATION_TESTS environment variable")
+	}
+
+	l := testlog.Logger(t, log.LvlInfo)
+	cfg := flags.AzureConfig{
+		AccountName: "devstoreaccount1",
+		AccountKey:  azuriteAccountKey,
+		Container:   "blobs",
+		Endpoint:    "http://localhost:10000/devstoreaccount1/",
+		Compress:    compress,
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey)
+	require.NoError(t, err)
+	client, err := azblob.NewClientWithSharedKeyCredential(cfg.ServiceURL(), cred, nil)
+	require.NoError(t, err)
+
+	_, err = client.CreateContainer(context.Background(), cfg.Container, nil)
+	if !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		require.NoError(t, err)
+	}
+	pager := client.NewListBlobsFlatPager(cfg.Container, nil)
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		require.NoError(t, err)
+		for _, item := range page.Segment.BlobItems {
+			_, err := client.DeleteBlob(context.Background(), cfg.Container, *item.Name, nil)
+			require.NoError(t, err)
+		}
+	}
+
+	azure, err := NewAzureStorage(cfg, l)
+	require.NoError(t, err)
+	return azure
+}
+
+func TestAzureExists(t *testing.T) {
+	s := setupAzure(t, false)
+
+	runTestExists(t, s)
+}
+
+func TestAzureRead(t *testing.T) {
+	s := setupAzure(t, false)
+
+	runTestRead(t, s)
+}
+
+func TestAzureReadCompressed(t *testing.T) {
+	s := setupAzure(t, true)
+
+	runTestRead(t, s)
+
+	client := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(s.name(common.Hash{1, 2, 3}.String()))
+	props, err := client.GetProperties(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, "gzip", *props.ContentEncoding)
+}
+
+func TestAzureReadMixedCompression(t *testing.T) {
+	s := setupAzure(t, false)
+
+	runTestReadMixedCompression(t, s, func(compression flags.Compression) { s.compression = compression })
+
+	client := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(s.name(common.Hash{3}.String()))
+	props, err := client.GetProperties(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, "zstd", *props.ContentEncoding)
+}
+
+func TestAzureReadEmpty(t *testing.T) {
+	s := setupAzure(t, false)
+
+	runTestReadEmpty(t, s)
+}
+
+func TestAzureReadBlockHeader(t *testing.T) {
+	s := setupAzure(t, false)
+
+	runTestReadBlockHeader(t, s)
+}
+
+func TestAzureBackfillState(t *testing.T) {
+	s := setupAzure(t, false)
+
+	processes, err := s.ReadBackfillProcesses(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, processes)
+
+	lockfile := Lockfile{ArchiverId: "archiver", Timestamp: 1_700_000_000}
+	require.NoError(t, s.WriteLockfile(context.Background(), lockfile))
+	read, err := s.ReadLockfile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, lockfile, read)
+
+	runTestBackfillCheckpoint(t, s)
+	runTestInventoryChunk(t, s)
+}
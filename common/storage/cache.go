@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheResult is the outcome of a read from a CachingStorage.
+type CacheResult string
+
+const (
+	// CacheHit is a read served from an entry younger than the TTL
+	CacheHit CacheResult = "hit"
+	// CacheStale is a read served from an expired entry within the stale window, which triggers a background refresh
+	CacheStale CacheResult = "stale"
+	// CacheMiss is a read of a block that is not cached, or whose entry is past the stale window, served from the
+	// inner data store
+	CacheMiss CacheResult = "miss"
+)
+
+// CacheRecorder records the outcome of reads from a CachingStorage, and the blocks it holds.
+type CacheRecorder interface {
+	RecordCacheRead(result CacheResult)
+	// RecordCacheEviction records a block evicted to bring the cache within its limits
+	RecordCacheEviction()
+	// RecordCacheSize records the number and total size of the blocks held in the cache
+	RecordCacheSize(blocks int, bytes int64)
+}
+
+// CacheConfig configures a CachingStorage.
+type CacheConfig struct {
+	// Size is the maximum number of blocks held in memory, the least recently used block is evicted beyond it. Zero
+	// does not limit the number of blocks if MaxBytes is set
+	Size int
+	// MaxBytes is the maximum total size of the blocks held in memory, the least recently used blocks are evicted
+	// beyond it and a block larger than it is not cached. Zero does not limit the size
+	MaxBytes int64
+	// TTL is how long an entry is served without being refreshed
+	TTL time.Duration
+	// StaleWindow is how long after the TTL an expired entry is still served while it is refreshed in the background.
+	// Zero disables stale-while-revalidate, so expired entries are read from the inner data store before responding.
+	StaleWindow time.Duration
+}
+
+// Enabled returns whether the cache is configured with a limit, as it is disabled otherwise.
+func (c CacheConfig) Enabled() bool {
+	return c.Size > 0 || c.MaxBytes > 0
+}
+
+// cacheEntry is a block of blobs held by a CachingStorage.
+type cacheEntry struct {
+	hash     common.Hash
+	data     BlobData
+	storedAt time.Time
+	// size is the size of the blobs of the block, see cachedSize
+	size int64
+}
+
+// cachedSize returns the size of the blobs of a block, which the size of a cache entry is taken to be, as they make
+// up almost all of it.
+func cachedSize(data BlobData) int64 {
+	size := data.BlobSidecars.SizeSSZ()
+	if data.DataColumnSidecars != nil {
+		size += data.DataColumnSidecars.SizeSSZ()
+	}
+	return int64(size)
+}
+
+// CachingStorage is a DataStore that holds recently read blocks in memory in front of an inner data store, so that
+// hot blocks, such as those of recent slots, are not read from storage on every request. Entries are refreshed from
+// the inner data store once they are older than the TTL. Within the stale window after that, the expired entry is
+// served immediately and refreshed in the background, which bounds the latency of hot blocks. Concurrent reads and
+// refreshes of the same block share a single read of the inner data store.
+//
+// Reads with ConsistencyFresh bypass the cache and update it with the result. Writes update the cache, and Exists
+// only reports the contents of the inner data store.
+type CachingStorage struct {
+	DataStore
+	log       log.Logger
+	cfg       CacheConfig
+	recorder  CacheRecorder
+	now       func() time.Time
+	group     singleflight.Group
+	refreshes sync.WaitGroup
+
+	mu      sync.Mutex
+	entries map[common.Hash]*list.Element
+	order   *list.List
+	// bytes is the total size of the entries
+	bytes int64
+	// refreshing are the blocks with a background refresh in flight
+	refreshing map[common.Hash]struct{}
+}
+
+// NewCachingStorage creates a CachingStorage in front of inner. recorder may be nil.
+func NewCachingStorage(inner DataStore, cfg CacheConfig, recorder CacheRecorder, l log.Logger) *CachingStorage {
+	return &CachingStorage{
+		DataStore: inner,
+		log:       l,
+		cfg:       cfg,
+		recorder:  recorder,
+		now:       time.Now,
+		entries:   make(map[common.Hash]*list.Element),
+		order:     list.New(),
+
+		refreshing: make(map[common.Hash]struct{}),
+	}
+}
+
+func (s *CachingStorage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
+	if ConsistencyFromContext(ctx) == ConsistencyFresh {
+		return s.load(ctx, hash)
+	}
+
+	entry, ok := s.get(hash)
+	if ok {
+		age := s.now().Sub(entry.storedAt)
+		if age < s.cfg.TTL {
+			s.record(CacheHit)
+			return entry.data, nil
+		}
+		if age < s.cfg.TTL+s.cfg.StaleWindow {
+			s.record(CacheStale)
+			s.refresh(ctx, hash)
+			return entry.data, nil
+		}
+	}
+
+	s.record(CacheMiss)
+	return s.load(ctx, hash)
+}
+
+func (s *CachingStorage) WriteBlob(ctx context.Context, data BlobData) error {
+	if err := s.DataStore.WriteBlob(ctx, data); err != nil {
+		return err
+	}
+	s.put(data.Header.BeaconBlockHash, data)
+	return nil
+}
+
+func (s *CachingStorage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	if err := s.DataStore.WriteEmptyBlob(ctx, hash); err != nil {
+		return err
+	}
+	s.put(hash, BlobData{Header: Header{BeaconBlockHash: hash}})
+	return nil
+}
+
+// DeleteBlob deletes the block from the inner data store and the cache, so that a deleted block is not served from
+// memory.
+func (s *CachingStorage) DeleteBlob(ctx context.Context, hash common.Hash) error {
+	if err := s.DataStore.DeleteBlob(ctx, hash); err != nil {
+		return err
+	}
+	s.remove(hash)
+	return nil
+}
+
+// load reads hash from the inner data store and caches it, sharing the read with concurrent loads of the same block
+// and consistency level.
+func (s *CachingStorage) load(ctx context.Context, hash common.Hash) (BlobData, error) {
+	key := hash.String() + "/" + ConsistencyFromContext(ctx).String()
+	result := s.group.DoChan(key, func() (interface{}, error) {
+		// The read is shared with other readers, so it must not be cancelled if the reader that started it goes away
+		return s.read(context.WithoutCancel(ctx), hash)
+	})
+
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return BlobData{}, r.Err
+		}
+		return r.Val.(BlobData), nil
+	case <-ctx.Done():
+		return BlobData{}, ctx.Err()
+	}
+}
+
+// refresh reloads hash from the inner data store in the background, unless it is already being refreshed, so a hot
+// block that has expired is refreshed once, however many times it is read.
+func (s *CachingStorage) refresh(ctx context.Context, hash common.Hash) {
+	s.mu.Lock()
+	if _, ok := s.refreshing[hash]; ok {
+		s.mu.Unlock()
+		return
+	}
+	s.refreshing[hash] = struct{}{}
+	s.mu.Unlock()
+
+	s.refreshes.Add(1)
+	go func() {
+		defer s.refreshes.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.refreshing, hash)
+			s.mu.Unlock()
+		}()
+		if _, err := s.load(context.WithoutCancel(ctx), hash); err != nil {
+			s.log.Warn("failed to refresh cached blobs", "root", hash.String(), "err", err)
+		}
+	}()
+}
+
+// read reads hash from the inner data store and updates the cache with the result. A block that the inner data store
+// no longer has is removed from the cache, while an entry is kept if the read fails.
+func (s *CachingStorage) read(ctx context.Context, hash common.Hash) (BlobData, error) {
+	data, err := s.DataStore.ReadBlob(ctx, hash)
+	if errors.Is(err, ErrNotFound) {
+		s.remove(hash)
+	}
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	s.put(hash, data)
+	return data, nil
+}
+
+func (s *CachingStorage) get(hash common.Hash) (cacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[hash]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	s.order.MoveToFront(element)
+	return *element.Value.(*cacheEntry), true
+}
+
+func (s *CachingStorage) put(hash common.Hash, data BlobData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.recordSize()
+
+	entry := &cacheEntry{hash: hash, data: data, storedAt: s.now(), size: cachedSize(data)}
+	if s.cfg.MaxBytes > 0 && entry.size > s.cfg.MaxBytes {
+		// The block would evict every other block, and then itself
+		s.removeLocked(hash)
+		return
+	}
+
+	if element, ok := s.entries[hash]; ok {
+		s.bytes += entry.size - element.Value.(*cacheEntry).size
+		element.Value = entry
+		s.order.MoveToFront(element)
+	} else {
+		s.entries[hash] = s.order.PushFront(entry)
+		s.bytes += entry.size
+	}
+
+	for s.overLimit() {
+		s.removeLocked(s.order.Back().Value.(*cacheEntry).hash)
+		if s.recorder != nil {
+			s.recorder.RecordCacheEviction()
+		}
+	}
+}
+
+// overLimit returns whether the entries exceed the limits of the cache. Without either limit the cache holds a single
+// block.
+func (s *CachingStorage) overLimit() bool {
+	if s.cfg.MaxBytes > 0 && s.bytes > s.cfg.MaxBytes {
+		return true
+	}
+	if s.cfg.Size > 0 || s.cfg.MaxBytes == 0 {
+		return s.order.Len() > max(s.cfg.Size, 1)
+	}
+	return false
+}
+
+func (s *CachingStorage) remove(hash common.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.recordSize()
+
+	s.removeLocked(hash)
+}
+
+func (s *CachingStorage) removeLocked(hash common.Hash) {
+	if element, ok := s.entries[hash]; ok {
+		s.order.Remove(element)
+		delete(s.entries, hash)
+		s.bytes -= element.Value.(*cacheEntry).size
+	}
+}
+
+// recordSize records the size of the cache, it must be called with mu held.
+func (s *CachingStorage) recordSize() {
+	if s.recorder != nil {
+		s.recorder.RecordCacheSize(s.order.Len(), s.bytes)
+	}
+}
+
+func (s *CachingStorage) record(result CacheResult) {
+	if s.recorder != nil {
+		s.recorder.RecordCacheRead(result)
+	}
+}
+
+// Wait blocks until all background refreshes have completed.
+func (s *CachingStorage) Wait() {
+	s.refreshes.Wait()
+}
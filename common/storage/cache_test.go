@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore is a DataStore that counts reads, optionally blocking them until release is closed or failing them
+// with err.
+type countingStore struct {
+	DataStore
+	reads   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (s *countingStore) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
+	s.reads.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	if s.err != nil {
+		return BlobData{}, s.err
+	}
+	return s.DataStore.ReadBlob(ctx, hash)
+}
+
+type cacheResults struct {
+	mu        sync.Mutex
+	results   map[CacheResult]int
+	evictions int
+	blocks    int
+	bytes     int64
+}
+
+func (r *cacheResults) RecordCacheRead(result CacheResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[result]++
+}
+
+func (r *cacheResults) RecordCacheEviction() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.evictions++
+}
+
+func (r *cacheResults) RecordCacheSize(blocks int, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocks, r.bytes = blocks, bytes
+}
+
+func (r *cacheResults) count(result CacheResult) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.results[result]
+}
+
+// fakeClock is a clock for CachingStorage that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func setupCache(t *testing.T, cfg CacheConfig) (*CachingStorage, *countingStore, *cacheResults, *fakeClock) {
+	fs, cleanup := setup(t)
+	t.Cleanup(cleanup)
+
+	inner := &countingStore{DataStore: fs}
+	results := &cacheResults{results: make(map[CacheResult]int)}
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	s := NewCachingStorage(inner, cfg, results, testlog.Logger(t, log.LvlInfo))
+	s.now = clock.Now
+	return s, inner, results, clock
+}
+
+func writeBlock(t *testing.T, s DataStore, hash common.Hash, blobs int) {
+	var sidecars BlobSidecars
+	for i := 0; i < blobs; i++ {
+		sidecars.Data = append(sidecars.Data, sidecarsAtSlot(10).Data...)
+	}
+	data := BlobData{Header: Header{BeaconBlockHash: hash}, BlobSidecars: sidecars}
+	require.NoError(t, s.WriteBlob(context.Background(), data))
+}
+
+func TestCache_HitAndExpiry(t *testing.T) {
+	s, inner, results, clock := setupCache(t, CacheConfig{Size: 4, TTL: time.Minute})
+	hash := common.Hash{0x01}
+	writeBlock(t, inner.DataStore, hash, 1)
+
+	for i := 0; i < 3; i++ {
+		data, err := s.ReadBlob(context.Background(), hash)
+		require.NoError(t, err)
+		require.Len(t, data.BlobSidecars.Data, 1)
+	}
+	require.Equal(t, int32(1), inner.reads.Load())
+	require.Equal(t, 1, results.count(CacheMiss))
+	require.Equal(t, 2, results.count(CacheHit))
+
+	// Without a stale window an expired entry is read from storage before responding
+	writeBlock(t, inner.DataStore, hash, 2)
+	clock.Advance(time.Minute)
+	data, err := s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Len(t, data.BlobSidecars.Data, 2)
+	require.Equal(t, int32(2), inner.reads.Load())
+	require.Equal(t, 0, results.count(CacheStale))
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	s, inner, results, clock := setupCache(t, CacheConfig{Size: 4, TTL: time.Minute, StaleWindow: time.Minute})
+	hash := common.Hash{0x01}
+	writeBlock(t, inner.DataStore, hash, 1)
+
+	_, err := s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+
+	// Expired entries in the stale window are served at once, with a single refresh however many reads there are
+	writeBlock(t, inner.DataStore, hash, 2)
+	clock.Advance(90 * time.Second)
+	inner.release = make(chan struct{})
+	for i := 0; i < 5; i++ {
+		data, err := s.ReadBlob(context.Background(), hash)
+		require.NoError(t, err)
+		require.Len(t, data.BlobSidecars.Data, 1)
+	}
+	require.Equal(t, 5, results.count(CacheStale))
+
+	close(inner.release)
+	s.Wait()
+	require.Equal(t, int32(2), inner.reads.Load())
+
+	data, err := s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Len(t, data.BlobSidecars.Data, 2)
+	require.Equal(t, 1, results.count(CacheHit))
+
+	// Past the stale window the entry is read from storage
+	clock.Advance(2 * time.Minute)
+	_, err = s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Equal(t, 2, results.count(CacheMiss))
+	require.Equal(t, int32(3), inner.reads.Load())
+}
+
+func TestCache_RemovesDeletedBlocks(t *testing.T) {
+	s, inner, _, clock := setupCache(t, CacheConfig{Size: 4, TTL: time.Minute, StaleWindow: time.Minute})
+	hash := common.Hash{0x01}
+	writeBlock(t, inner.DataStore, hash, 1)
+
+	_, err := s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	inner.err = ErrNotFound
+
+	clock.Advance(90 * time.Second)
+	_, err = s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	s.Wait()
+
+	_, err = s.ReadBlob(context.Background(), hash)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// A block deleted through the cache is not served from memory
+	inner.err = nil
+	writeBlock(t, inner.DataStore, hash, 1)
+	_, err = s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteBlob(context.Background(), hash))
+	_, err = s.ReadBlob(context.Background(), hash)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCache_Eviction(t *testing.T) {
+	s, inner, _, _ := setupCache(t, CacheConfig{Size: 2, TTL: time.Minute})
+	hashes := []common.Hash{{0x01}, {0x02}, {0x03}}
+	for _, hash := range hashes {
+		writeBlock(t, inner.DataStore, hash, 1)
+		_, err := s.ReadBlob(context.Background(), hash)
+		require.NoError(t, err)
+	}
+
+	// The least recently used block was evicted
+	_, err := s.ReadBlob(context.Background(), hashes[2])
+	require.NoError(t, err)
+	require.Equal(t, int32(3), inner.reads.Load())
+	_, err = s.ReadBlob(context.Background(), hashes[0])
+	require.NoError(t, err)
+	require.Equal(t, int32(4), inner.reads.Load())
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	blockSize := cachedSize(BlobData{BlobSidecars: sidecarsAtSlot(10)})
+	s, inner, results, _ := setupCache(t, CacheConfig{MaxBytes: 3 * blockSize, TTL: time.Minute})
+	hashes := []common.Hash{{0x01}, {0x02}, {0x03}}
+	for i, hash := range hashes {
+		writeBlock(t, inner.DataStore, hash, i+1)
+	}
+
+	// The blocks of one and two blobs fit, the number of blocks is not limited
+	for _, hash := range hashes[:2] {
+		_, err := s.ReadBlob(context.Background(), hash)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, results.blocks)
+	require.Equal(t, 3*blockSize, results.bytes)
+	require.Zero(t, results.evictions)
+
+	// The block of three blobs evicts both
+	_, err := s.ReadBlob(context.Background(), hashes[2])
+	require.NoError(t, err)
+	require.Equal(t, 2, results.evictions)
+	require.Equal(t, 1, results.blocks)
+	require.Equal(t, 3*blockSize, results.bytes)
+	_, err = s.ReadBlob(context.Background(), hashes[2])
+	require.NoError(t, err)
+	require.Equal(t, int32(3), inner.reads.Load())
+
+	// A block larger than the cache is not cached, and replaces the entry of its previous contents
+	writeBlock(t, inner.DataStore, hashes[2], 4)
+	data, err := s.ReadBlob(WithConsistency(context.Background(), ConsistencyFresh), hashes[2])
+	require.NoError(t, err)
+	require.Len(t, data.BlobSidecars.Data, 4)
+	require.Zero(t, results.blocks)
+	require.Zero(t, results.bytes)
+	_, err = s.ReadBlob(context.Background(), hashes[2])
+	require.NoError(t, err)
+	require.Equal(t, int32(5), inner.reads.Load())
+}
+
+func TestCacheConfig_Enabled(t *testing.T) {
+	require.False(t, CacheConfig{TTL: time.Minute}.Enabled())
+	require.True(t, CacheConfig{Size: 1}.Enabled())
+	require.True(t, CacheConfig{MaxBytes: 1}.Enabled())
+}
+
+func TestCache_WritesAndFreshReads(t *testing.T) {
+	s, inner, _, _ := setupCache(t, CacheConfig{Size: 4, TTL: time.Minute})
+	hash := common.Hash{0x01}
+
+	// Writes through the cache are served without a storage read
+	writeBlock(t, s, hash, 1)
+	_, err := s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Equal(t, int32(0), inner.reads.Load())
+
+	// Fresh reads bypass the cache and update it
+	writeBlock(t, inner.DataStore, hash, 2)
+	data, err := s.ReadBlob(WithConsistency(context.Background(), ConsistencyFresh), hash)
+	require.NoError(t, err)
+	require.Len(t, data.BlobSidecars.Data, 2)
+	require.Equal(t, int32(1), inner.reads.Load())
+
+	data, err = s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Len(t, data.BlobSidecars.Data, 2)
+	require.Equal(t, int32(1), inner.reads.Load())
+
+	// A block written as empty is no longer served with its old blobs
+	require.NoError(t, s.WriteEmptyBlob(context.Background(), hash))
+	data, err = s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Empty(t, data.BlobSidecars.Data)
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ssz "github.com/ferranbt/fastssz"
+)
+
+const (
+	// NumberOfColumns is the NUMBER_OF_COLUMNS of fulu, the number of data columns that the blobs of a block are
+	// extended into, and so the most data column sidecars that a block has
+	NumberOfColumns = 128
+	// BytesPerCell is the BYTES_PER_CELL of fulu, the size of the cell of a blob in a data column
+	BytesPerCell = 2048
+	// KZGCommitmentsInclusionProofDepth is the KZG_COMMITMENTS_INCLUSION_PROOF_DEPTH of fulu
+	KZGCommitmentsInclusionProofDepth = 4
+
+	// maxBlobCommitmentsPerBlock is the MAX_BLOB_COMMITMENTS_PER_BLOCK of fulu, the list limit of the cells,
+	// commitments and proofs of a data column sidecar
+	maxBlobCommitmentsPerBlock = 4096
+)
+
+// DataColumnSidecar is the canonical representation of a data column sidecar, which beacon nodes serve instead of blob
+// sidecars from fulu on (EIP-7594, PeerDAS). Each sidecar holds one column of the extended blobs of a block: a cell of
+// every blob, with the commitment of each blob and the proof of each cell. Like BlobSidecar, its schema and encoding
+// are defined here rather than taken from go-eth2-client, which does not support fulu yet. The fields are byte arrays
+// rather than the named types of go-eth2-client, which the SSZ generator does not support in lists. The SSZ encoding is
+// generated by make generate, see column_encoding.go, and the JSON encoding is that of the beacon API.
+type DataColumnSidecar struct {
+	Index                        uint64
+	Column                       [][2048]byte `ssz-max:"4096" ssz-size:"?,2048"`
+	KZGCommitments               [][48]byte   `ssz-max:"4096" ssz-size:"?,48"`
+	KZGProofs                    [][48]byte   `ssz-max:"4096" ssz-size:"?,48"`
+	SignedBlockHeader            *phase0.SignedBeaconBlockHeader
+	KZGCommitmentsInclusionProof [4][32]byte `ssz-size:"4,32"`
+}
+
+// dataColumnSidecarJSON is the beacon API representation of a data column sidecar, see blobSidecarJSON.
+type dataColumnSidecarJSON struct {
+	Index                        string                                         `json:"index"`
+	Column                       []hexutil.Bytes                                `json:"column"`
+	KZGCommitments               []deneb.KZGCommitment                          `json:"kzg_commitments"`
+	KZGProofs                    []deneb.KZGProof                               `json:"kzg_proofs"`
+	SignedBlockHeader            *phase0.SignedBeaconBlockHeader                `json:"signed_block_header"`
+	KZGCommitmentsInclusionProof [KZGCommitmentsInclusionProofDepth]phase0.Root `json:"kzg_commitments_inclusion_proof"`
+}
+
+// dataColumnSidecarFields are the fields of dataColumnSidecarJSON, all of which are required.
+var dataColumnSidecarFields = []string{"index", "column", "kzg_commitments", "kzg_proofs", "signed_block_header", "kzg_commitments_inclusion_proof"}
+
+func (s *DataColumnSidecar) MarshalJSON() ([]byte, error) {
+	result := &dataColumnSidecarJSON{
+		Index:             strconv.FormatUint(s.Index, 10),
+		Column:            make([]hexutil.Bytes, len(s.Column)),
+		KZGCommitments:    make([]deneb.KZGCommitment, len(s.KZGCommitments)),
+		KZGProofs:         make([]deneb.KZGProof, len(s.KZGProofs)),
+		SignedBlockHeader: s.SignedBlockHeader,
+	}
+	for i := range s.Column {
+		result.Column[i] = s.Column[i][:]
+	}
+	for i, commitment := range s.KZGCommitments {
+		result.KZGCommitments[i] = commitment
+	}
+	for i, proof := range s.KZGProofs {
+		result.KZGProofs[i] = proof
+	}
+	for i, node := range s.KZGCommitmentsInclusionProof {
+		result.KZGCommitmentsInclusionProof[i] = node
+	}
+	return json.Marshal(result)
+}
+
+func (s *DataColumnSidecar) UnmarshalJSON(input []byte) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(input, &raw); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	for _, field := range dataColumnSidecarFields {
+		if _, ok := raw[field]; !ok {
+			return fmt.Errorf("%s: missing", field)
+		}
+	}
+
+	var decoded dataColumnSidecarJSON
+	if err := json.Unmarshal(input, &decoded); err != nil {
+		return err
+	}
+
+	index, err := strconv.ParseUint(decoded.Index, 10, 64)
+	if err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	s.Index = index
+
+	s.Column = make([][BytesPerCell]byte, len(decoded.Column))
+	for i, cell := range decoded.Column {
+		if len(cell) != BytesPerCell {
+			return fmt.Errorf("column: cell %d is %d bytes, expected %d", i, len(cell), BytesPerCell)
+		}
+		copy(s.Column[i][:], cell)
+	}
+
+	s.KZGCommitments = make([][48]byte, len(decoded.KZGCommitments))
+	for i, commitment := range decoded.KZGCommitments {
+		s.KZGCommitments[i] = commitment
+	}
+
+	s.KZGProofs = make([][48]byte, len(decoded.KZGProofs))
+	for i, proof := range decoded.KZGProofs {
+		s.KZGProofs[i] = proof
+	}
+
+	if decoded.SignedBlockHeader == nil {
+		return fmt.Errorf("signed_block_header: missing")
+	}
+	s.SignedBlockHeader = decoded.SignedBlockHeader
+
+	for i, node := range decoded.KZGCommitmentsInclusionProof {
+		s.KZGCommitmentsInclusionProof[i] = node
+	}
+
+	return s.validate()
+}
+
+// validate checks that the sidecar is a column of a block, which has a cell, commitment and proof for each blob.
+func (s *DataColumnSidecar) validate() error {
+	if s.Index >= NumberOfColumns {
+		return fmt.Errorf("column index %d is not below %d", s.Index, NumberOfColumns)
+	}
+	if len(s.Column) != len(s.KZGCommitments) || len(s.Column) != len(s.KZGProofs) {
+		return fmt.Errorf("column %d has %d cells, %d commitments and %d proofs", s.Index, len(s.Column), len(s.KZGCommitments), len(s.KZGProofs))
+	}
+	if len(s.Column) > maxBlobCommitmentsPerBlock {
+		return fmt.Errorf("column %d has %d cells, more than %d", s.Index, len(s.Column), maxBlobCommitmentsPerBlock)
+	}
+	return nil
+}
+
+// DataColumnSidecars are the data column sidecars of a block.
+type DataColumnSidecars struct {
+	Data []*DataColumnSidecar `json:"data"`
+}
+
+// Blobs returns the number of blobs of the block that the sidecars are the columns of.
+func (d *DataColumnSidecars) Blobs() int {
+	if d == nil || len(d.Data) == 0 {
+		return 0
+	}
+	return len(d.Data[0].KZGCommitments)
+}
+
+// VersionedHashes returns the versioned hash of each blob of the block, in the order of the blobs, from the commitments
+// of the first column, which every column of a block shares.
+func (d *DataColumnSidecars) VersionedHashes() []common.Hash {
+	if d == nil || len(d.Data) == 0 {
+		return nil
+	}
+	result := make([]common.Hash, len(d.Data[0].KZGCommitments))
+	for i, commitment := range d.Data[0].KZGCommitments {
+		result[i] = versionedHash(commitment)
+	}
+	return result
+}
+
+// MarshalSSZ marshals the sidecars into SSZ, as a list of variable size elements: the offset of each sidecar followed
+// by the sidecars.
+func (d *DataColumnSidecars) MarshalSSZ() ([]byte, error) {
+	result := make([]byte, 0, d.SizeSSZ())
+	offset := 4 * len(d.Data)
+	for _, sidecar := range d.Data {
+		result = ssz.WriteOffset(result, offset)
+		offset += sidecar.SizeSSZ()
+	}
+
+	for i, sidecar := range d.Data {
+		var err error
+		if result, err = sidecar.MarshalSSZTo(result); err != nil {
+			return nil, fmt.Errorf("sidecar %d: %w", i, err)
+		}
+	}
+
+	return result, nil
+}
+
+// UnmarshalSSZ unmarshals a list of data column sidecars from SSZ, the inverse of MarshalSSZ.
+func (d *DataColumnSidecars) UnmarshalSSZ(buf []byte) error {
+	if len(buf) == 0 {
+		d.Data = []*DataColumnSidecar{}
+		return nil
+	}
+	if len(buf) < 4 {
+		return ssz.ErrSize
+	}
+
+	first := ssz.ReadOffset(buf[0:4])
+	if first%4 != 0 || first == 0 || first > uint64(len(buf)) {
+		return ssz.ErrOffset
+	}
+	count := int(first / 4)
+	if count > NumberOfColumns {
+		return ssz.ErrListTooBig
+	}
+
+	offsets := make([]uint64, count+1)
+	for i := 0; i < count; i++ {
+		offsets[i] = ssz.ReadOffset(buf[i*4 : (i+1)*4])
+		if offsets[i] > uint64(len(buf)) || (i > 0 && offsets[i] < offsets[i-1]) {
+			return ssz.ErrOffset
+		}
+	}
+	offsets[count] = uint64(len(buf))
+
+	d.Data = make([]*DataColumnSidecar, count)
+	for i := range d.Data {
+		d.Data[i] = new(DataColumnSidecar)
+		if err := d.Data[i].UnmarshalSSZ(buf[offsets[i]:offsets[i+1]]); err != nil {
+			return fmt.Errorf("sidecar %d: %w", i, err)
+		}
+		if err := d.Data[i].validate(); err != nil {
+			return fmt.Errorf("sidecar %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *DataColumnSidecars) SizeSSZ() int {
+	size := 4 * len(d.Data)
+	for _, sidecar := range d.Data {
+		size += sidecar.SizeSSZ()
+	}
+	return size
+}
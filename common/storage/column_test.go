@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func newDataColumnSidecar(t *testing.T, index uint64, blobs int) *DataColumnSidecar {
+	sidecar := &DataColumnSidecar{
+		Index:          index,
+		Column:         make([][BytesPerCell]byte, blobs),
+		KZGCommitments: make([][48]byte, blobs),
+		KZGProofs:      make([][48]byte, blobs),
+		SignedBlockHeader: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: 12, BodyRoot: phase0.Root{1}},
+		},
+	}
+	for i := 0; i < blobs; i++ {
+		copy(sidecar.Column[i][:], blobtest.RandBytes(t, BytesPerCell))
+		copy(sidecar.KZGCommitments[i][:], blobtest.RandBytes(t, 48))
+		copy(sidecar.KZGProofs[i][:], blobtest.RandBytes(t, 48))
+	}
+	copy(sidecar.KZGCommitmentsInclusionProof[2][:], blobtest.RandBytes(t, 32))
+	return sidecar
+}
+
+func TestDataColumnSidecar_JSON(t *testing.T) {
+	sidecar := newDataColumnSidecar(t, 7, 2)
+
+	b, err := json.Marshal(sidecar)
+	require.NoError(t, err)
+
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(b, &fields))
+	require.ElementsMatch(t, dataColumnSidecarFields, keys(fields))
+	require.JSONEq(t, `"7"`, string(fields["index"]))
+
+	var decoded DataColumnSidecar
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, *sidecar, decoded)
+
+	// Every field is required
+	delete(fields, "kzg_proofs")
+	b, err = json.Marshal(fields)
+	require.NoError(t, err)
+	require.ErrorContains(t, json.Unmarshal(b, &decoded), "kzg_proofs: missing")
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
+
+func TestDataColumnSidecar_Validation(t *testing.T) {
+	encode := func(s *DataColumnSidecar) []byte {
+		b, err := json.Marshal(s)
+		require.NoError(t, err)
+		return b
+	}
+
+	var decoded DataColumnSidecar
+	sidecar := newDataColumnSidecar(t, NumberOfColumns, 1)
+	require.ErrorContains(t, json.Unmarshal(encode(sidecar), &decoded), "not below 128")
+
+	sidecar = newDataColumnSidecar(t, 0, 2)
+	sidecar.KZGProofs = sidecar.KZGProofs[:1]
+	require.ErrorContains(t, json.Unmarshal(encode(sidecar), &decoded), "2 cells, 2 commitments and 1 proofs")
+
+	// Cells must be BytesPerCell long
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(encode(newDataColumnSidecar(t, 0, 1)), &fields))
+	fields["column"] = json.RawMessage(`["0x0102"]`)
+	b, err := json.Marshal(fields)
+	require.NoError(t, err)
+	require.ErrorContains(t, json.Unmarshal(b, &decoded), "cell 0 is 2 bytes")
+
+	// An SSZ sidecar is validated when decoded as part of a list
+	sidecar = newDataColumnSidecar(t, 200, 1)
+	b, err = (&DataColumnSidecars{Data: []*DataColumnSidecar{sidecar}}).MarshalSSZ()
+	require.NoError(t, err)
+	require.ErrorContains(t, new(DataColumnSidecars).UnmarshalSSZ(b), "sidecar 0: column index 200")
+}
+
+func TestDataColumnSidecars_SSZ(t *testing.T) {
+	sidecars := &DataColumnSidecars{Data: []*DataColumnSidecar{
+		newDataColumnSidecar(t, 0, 3),
+		newDataColumnSidecar(t, 64, 3),
+		newDataColumnSidecar(t, 127, 3),
+	}}
+	require.Equal(t, 3, sidecars.Blobs())
+
+	b, err := sidecars.MarshalSSZ()
+	require.NoError(t, err)
+	require.Len(t, b, sidecars.SizeSSZ())
+
+	var decoded DataColumnSidecars
+	require.NoError(t, decoded.UnmarshalSSZ(b))
+	require.Equal(t, sidecars, &decoded)
+
+	// Each element is the SSZ encoding of a sidecar, after the offsets of the list
+	first, err := sidecars.Data[0].MarshalSSZ()
+	require.NoError(t, err)
+	require.Equal(t, first, b[12:12+len(first)])
+
+	// An empty list has no offsets
+	b, err = (&DataColumnSidecars{}).MarshalSSZ()
+	require.NoError(t, err)
+	require.Empty(t, b)
+	require.NoError(t, decoded.UnmarshalSSZ(b))
+	require.Empty(t, decoded.Data)
+	require.Zero(t, decoded.Blobs())
+
+	for _, invalid := range [][]byte{{1, 2}, {3, 0, 0, 0}, {8, 0, 0, 0, 4, 0, 0, 0}, {0, 0, 0, 0}} {
+		require.Error(t, decoded.UnmarshalSSZ(invalid), invalid)
+	}
+}
+
+func TestBlobData_DataColumnSidecars(t *testing.T) {
+	data := BlobData{
+		Header:             Header{BeaconBlockHash: common.Hash{1}, Fork: "fulu"},
+		BlobSidecars:       BlobSidecars{Data: []*BlobSidecar{}},
+		DataColumnSidecars: &DataColumnSidecars{Data: []*DataColumnSidecar{newDataColumnSidecar(t, 3, 1)}},
+	}
+	require.False(t, data.Empty())
+	require.Equal(t, 1, data.Blobs())
+	require.Equal(t, int64(data.DataColumnSidecars.SizeSSZ()), cachedSize(data))
+
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+	var decoded BlobData
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, data, decoded)
+
+	// Blocks before fulu are stored as they were
+	data = BlobData{Header: Header{BeaconBlockHash: common.Hash{1}}, BlobSidecars: BlobSidecars{Data: []*BlobSidecar{}}}
+	require.True(t, data.Empty())
+	b, err = json.Marshal(data)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "data_column_sidecars")
+
+	data.DataColumnSidecars = &DataColumnSidecars{}
+	require.True(t, data.Empty())
+}
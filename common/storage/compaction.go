@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tempFileSuffix is the suffix of the temporary files written by writeFileAtomic. A temporary file is only left behind
+// if the archiver crashes part-way through a write.
+const tempFileSuffix = ".tmp"
+
+// Compactor runs the periodic compaction of a data store. Of the backends only FileStorage needs compacting, the object
+// stores return at once.
+type Compactor interface {
+	// RunCompaction compacts the data store every interval until the context is done, see FileStorage.Compact.
+	RunCompaction(ctx context.Context, interval time.Duration, tempFileAge time.Duration)
+}
+
+// CompactionResult summarises the work done by FileStorage.Compact.
+type CompactionResult struct {
+	RemovedTempFiles   int
+	RemovedDirectories int
+	ReclaimedBytes     int64
+}
+
+// writeFileAtomic writes b to name by writing a temporary file in the same directory and renaming it, so that readers
+// never see a partially written file.
+func writeFileAtomic(name string, b []byte) error {
+	f, err := os.CreateTemp(path.Dir(name), path.Base(name)+".*"+tempFileSuffix)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Compact tidies the storage directory. Temporary files older than tempFileAge are removed, as they can only be left
+// by writes that crashed, and any empty sub-directories are removed. Temporary files younger than tempFileAge are kept
+// as they may belong to a write that is still in progress.
+func (s *FileStorage) Compact(ctx context.Context, tempFileAge time.Duration) (CompactionResult, error) {
+	var result CompactionResult
+	var directories []string
+	cutoff := time.Now().Add(-tempFileAge)
+
+	err := filepath.WalkDir(s.directory, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() {
+			if name != s.directory {
+				directories = append(directories, name)
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(name, tempFileSuffix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+
+		result.RemovedTempFiles++
+		result.ReclaimedBytes += info.Size()
+		return nil
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	// Remove the deepest directories first, so that parents emptied by removing their children are also removed
+	sort.Slice(directories, func(i, j int) bool {
+		return len(directories[i]) > len(directories[j])
+	})
+
+	for _, dir := range directories {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return result, err
+		}
+
+		if len(entries) > 0 {
+			continue
+		}
+
+		if err := os.Remove(dir); err != nil {
+			return result, err
+		}
+		result.RemovedDirectories++
+	}
+
+	return result, nil
+}
+
+// RunCompaction runs Compact every interval until the context is done.
+func (s *FileStorage) RunCompaction(ctx context.Context, interval time.Duration, tempFileAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := s.Compact(ctx, tempFileAge)
+			if err != nil {
+				s.log.Error("failed to compact file storage", "err", err)
+				continue
+			}
+
+			s.log.Info("compacted file storage",
+				"removedTempFiles", result.RemovedTempFiles,
+				"removedDirectories", result.RemovedDirectories,
+				"reclaimedBytes", result.ReclaimedBytes,
+			)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunCompaction returns at once, a bucket leaves nothing behind to compact.
+func (s *S3Storage) RunCompaction(context.Context, time.Duration, time.Duration) {}
+
+// RunCompaction returns at once, a bucket leaves nothing behind to compact.
+func (s *GCSStorage) RunCompaction(context.Context, time.Duration, time.Duration) {}
+
+// RunCompaction returns at once, a container leaves nothing behind to compact.
+func (s *AzureStorage) RunCompaction(context.Context, time.Duration, time.Duration) {}
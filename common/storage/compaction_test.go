@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLeavesNoTempFiles(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	err := fs.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: common.Hash{1}}})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(fs.directory)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), tempFileSuffix)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	id := common.Hash{1, 2, 3}
+	require.NoError(t, fs.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}))
+
+	stale := path.Join(fs.directory, id.String()+".123"+tempFileSuffix)
+	require.NoError(t, os.WriteFile(stale, []byte("partial"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	recent := path.Join(fs.directory, id.String()+".456"+tempFileSuffix)
+	require.NoError(t, os.WriteFile(recent, []byte("in progress"), 0644))
+
+	require.NoError(t, os.MkdirAll(path.Join(fs.directory, "shard", "empty"), 0755))
+	require.NoError(t, os.MkdirAll(path.Join(fs.directory, "full"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(fs.directory, "full", "data"), []byte("data"), 0644))
+
+	result, err := fs.Compact(context.Background(), time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, CompactionResult{
+		RemovedTempFiles:   1,
+		RemovedDirectories: 2,
+		ReclaimedBytes:     int64(len("partial")),
+	}, result)
+
+	require.NoFileExists(t, stale)
+	require.FileExists(t, recent)
+	require.NoDirExists(t, path.Join(fs.directory, "shard"))
+	require.DirExists(t, path.Join(fs.directory, "full"))
+
+	// The stored data is untouched
+	data, err := fs.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, id, data.Header.BeaconBlockHash)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// zstdEncoder compresses whole blobs with EncodeAll, which is safe for concurrent use
+	zstdEncoder, _ = zstd.NewWriter(nil)
+)
+
+// blobCompression returns the codec a backend writes blobs with: compression if set, and otherwise gzip if the
+// backend's compress flag is set.
+func blobCompression(compression flags.Compression, compress bool) flags.Compression {
+	if compression != "" {
+		return compression
+	}
+	if compress {
+		return flags.CompressionGzip
+	}
+	return flags.CompressionNone
+}
+
+// compressBlob compresses the encoded blob b with compression. It returns the data to store along with the content
+// encoding to record on the object, which is empty if the blob is stored uncompressed.
+func compressBlob(compression flags.Compression, b []byte) ([]byte, string, error) {
+	switch compression {
+	case flags.CompressionGzip:
+		result, err := compress(b)
+		if err != nil {
+			return nil, "", err
+		}
+		return result, string(flags.CompressionGzip), nil
+	case flags.CompressionZstd:
+		return zstdEncoder.EncodeAll(b, make([]byte, 0, len(b)/4)), string(flags.CompressionZstd), nil
+	default:
+		return b, "", nil
+	}
+}
+
+func compress(in []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(in)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressBlob returns a reader of the encoded blob stored in r with the given content encoding. Objects written
+// without a content encoding, such as files or blobs stored before compression was enabled, are detected from their
+// magic number, so that an archive can be read whatever its blobs were compressed with. Closing the returned reader
+// does not close r.
+func decompressBlob(r io.Reader, contentEncoding string) (io.ReadCloser, error) {
+	if contentEncoding == "" || contentEncoding == "identity" {
+		buffered := bufio.NewReader(r)
+		magic, _ := buffered.Peek(len(zstdMagic))
+		switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			contentEncoding = string(flags.CompressionGzip)
+		case bytes.HasPrefix(magic, zstdMagic):
+			contentEncoding = string(flags.CompressionZstd)
+		}
+		r = buffered
+	}
+
+	switch contentEncoding {
+	case string(flags.CompressionGzip):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gz, nil
+	case string(flags.CompressionZstd):
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return dec.IOReadCloser(), nil
+	case "", "identity":
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", contentEncoding)
+	}
+}
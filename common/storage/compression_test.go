@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobCompression(t *testing.T) {
+	require.Equal(t, flags.CompressionNone, blobCompression("", false))
+	require.Equal(t, flags.CompressionGzip, blobCompression("", true))
+	require.Equal(t, flags.CompressionZstd, blobCompression(flags.CompressionZstd, true))
+	require.Equal(t, flags.CompressionNone, blobCompression(flags.CompressionNone, true))
+}
+
+func TestCompressBlob(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"header":{},"blob_sidecars":{"data":[]}}`), 100)
+
+	for _, compression := range []flags.Compression{flags.CompressionNone, flags.CompressionGzip, flags.CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			compressed, contentEncoding, err := compressBlob(compression, data)
+			require.NoError(t, err)
+			if compression == flags.CompressionNone {
+				require.Empty(t, contentEncoding)
+				require.Equal(t, data, compressed)
+			} else {
+				require.Equal(t, string(compression), contentEncoding)
+				require.Less(t, len(compressed), len(data))
+			}
+
+			// The codec is detected when the content encoding was not recorded
+			for _, encoding := range []string{contentEncoding, ""} {
+				r, err := decompressBlob(bytes.NewReader(compressed), encoding)
+				require.NoError(t, err)
+				read, err := io.ReadAll(r)
+				require.NoError(t, err)
+				require.NoError(t, r.Close())
+				require.Equal(t, data, read)
+			}
+		})
+	}
+}
+
+func TestDecompressBlob_UnsupportedEncoding(t *testing.T) {
+	_, err := decompressBlob(bytes.NewReader([]byte("{}")), "br")
+	require.ErrorContains(t, err, "unsupported content encoding")
+}
+
+// runTestReadMixedCompression checks that blobs are read whatever they were compressed with, as the codec of an
+// archive can be changed after blobs have been written.
+func runTestReadMixedCompression(t *testing.T, s DataStore, setCompression func(flags.Compression)) {
+	compressions := []flags.Compression{flags.CompressionNone, flags.CompressionGzip, flags.CompressionZstd}
+	for i, compression := range compressions {
+		setCompression(compression)
+		require.NoError(t, s.WriteBlob(context.Background(), BlobData{
+			Header:       Header{BeaconBlockHash: common.Hash{byte(i + 1)}},
+			BlobSidecars: sidecarsAtSlot(uint64(10 + i)),
+		}))
+	}
+
+	setCompression(flags.CompressionZstd)
+	for i := range compressions {
+		data, err := s.ReadBlob(context.Background(), common.Hash{byte(i + 1)})
+		require.NoError(t, err, compressions[i])
+		require.Equal(t, sidecarsAtSlot(uint64(10+i)), data.BlobSidecars, compressions[i])
+	}
+}
+
+func TestFileReadMixedCompression(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestReadMixedCompression(t, fs, func(compression flags.Compression) { fs.compression = compression })
+}
+
+func TestNewStorage_Compression(t *testing.T) {
+	dir := t.TempDir()
+	cfg := flags.StorageConfig{
+		DataStorageType:      flags.DataStorageFile,
+		FileStorageDirectory: dir,
+		Compression:          flags.CompressionZstd,
+	}
+	require.NoError(t, cfg.Check())
+	s, err := NewStorage(cfg, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	id := common.Hash{1, 2, 3}
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}, BlobSidecars: sidecarsAtSlot(10)}))
+
+	stored, err := os.ReadFile(path.Join(dir, id.String()))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(stored, zstdMagic))
+
+	data, err := s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, sidecarsAtSlot(10), data.BlobSidecars)
+
+	cfg.Compression = "brotli"
+	require.ErrorContains(t, cfg.Check(), "invalid storage compression")
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Consistency is the consistency level of a read, which data stores that sit in front of another source of blobs, such
+// as ReadThroughStorage, honor. Data stores that read directly from a bucket or directory are always authoritative
+// and ignore it.
+type Consistency int
+
+const (
+	// ConsistencyCached serves a read from the nearest copy of the blobs, e.g. a read-through data store only asks the
+	// beacon node for blocks that are missing from storage. This is the default, and the fastest: a stored block is
+	// served with a single storage read.
+	ConsistencyCached Consistency = iota
+	// ConsistencyFresh bypasses any copy of the blobs and refreshes it from the source, e.g. a read-through data store
+	// fetches the block from the beacon node and rewrites it to storage, only falling back to storage once the beacon
+	// node has pruned the blobs. Use it for reads that must reflect the source, such as right after a repair, as each
+	// read costs a beacon node round trip (tens to hundreds of milliseconds for a block of blobs) and a storage write.
+	ConsistencyFresh
+)
+
+// consistencyKey is the context key of the consistency level of a read.
+type consistencyKey struct{}
+
+// WithConsistency returns a context that requests reads with the given consistency level.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the consistency level requested by ctx, ConsistencyCached if none was set.
+func ConsistencyFromContext(ctx context.Context) Consistency {
+	c, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return c
+}
+
+// ParseConsistency parses a user supplied consistency level, either "cached" or "fresh", case insensitively.
+func ParseConsistency(s string) (Consistency, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "cached":
+		return ConsistencyCached, nil
+	case "fresh":
+		return ConsistencyFresh, nil
+	default:
+		return ConsistencyCached, fmt.Errorf("unknown consistency %q, valid levels are cached and fresh", s)
+	}
+}
+
+func (c Consistency) String() string {
+	switch c {
+	case ConsistencyCached:
+		return "cached"
+	case ConsistencyFresh:
+		return "fresh"
+	default:
+		return fmt.Sprintf("Consistency(%d)", int(c))
+	}
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistencyFromContext(t *testing.T) {
+	require.Equal(t, ConsistencyCached, ConsistencyFromContext(context.Background()))
+
+	ctx := WithConsistency(context.Background(), ConsistencyFresh)
+	require.Equal(t, ConsistencyFresh, ConsistencyFromContext(ctx))
+	require.Equal(t, ConsistencyCached, ConsistencyFromContext(WithConsistency(ctx, ConsistencyCached)))
+}
+
+func TestParseConsistency(t *testing.T) {
+	c, err := ParseConsistency("cached")
+	require.NoError(t, err)
+	require.Equal(t, ConsistencyCached, c)
+
+	c, err = ParseConsistency(" Fresh ")
+	require.NoError(t, err)
+	require.Equal(t, ConsistencyFresh, c)
+
+	_, err = ParseConsistency("strong")
+	require.ErrorContains(t, err, "unknown consistency")
+}
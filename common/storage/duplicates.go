@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+)
+
+// DuplicateIndices is how sidecars with the same index in a response are handled, see SortSidecars. A block cannot
+// have two blobs with the same index, so duplicates come from a bug in the server.
+type DuplicateIndices int
+
+const (
+	// DuplicatesError rejects a response with duplicate indices, with a *DuplicateIndicesError. This is the
+	// default, as the response cannot be trusted.
+	DuplicatesError DuplicateIndices = iota
+	// DuplicatesKeepFirst keeps the first sidecar with each index, in the order of the response
+	DuplicatesKeepFirst
+	// DuplicatesKeepLast keeps the last sidecar with each index, in the order of the response
+	DuplicatesKeepLast
+)
+
+// ParseDuplicateIndices parses a user supplied handling of duplicate indices, either "error", "keep-first" or
+// "keep-last", case insensitively.
+func ParseDuplicateIndices(s string) (DuplicateIndices, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "error":
+		return DuplicatesError, nil
+	case "keep-first":
+		return DuplicatesKeepFirst, nil
+	case "keep-last":
+		return DuplicatesKeepLast, nil
+	default:
+		return DuplicatesError, fmt.Errorf("unknown duplicate indices handling %q, valid options are error, keep-first and keep-last", s)
+	}
+}
+
+func (d DuplicateIndices) String() string {
+	switch d {
+	case DuplicatesError:
+		return "error"
+	case DuplicatesKeepFirst:
+		return "keep-first"
+	case DuplicatesKeepLast:
+		return "keep-last"
+	default:
+		return fmt.Sprintf("DuplicateIndices(%d)", int(d))
+	}
+}
+
+// DuplicateIndicesError is returned by SortSidecars, with DuplicatesError, if sidecars contains duplicate indices.
+type DuplicateIndicesError struct {
+	// Indices are the indices that more than one sidecar has, in ascending order
+	Indices []deneb.BlobIndex
+}
+
+func (e *DuplicateIndicesError) Error() string {
+	return fmt.Sprintf("sidecars contain duplicate indices %v", e.Indices)
+}
+
+// SortSidecars returns the sidecars in canonical order, ascending by index, with the sidecars that have the same index
+// handled by duplicates. It also returns the indices that more than one sidecar has, in ascending order, which are
+// dropped to one sidecar each unless duplicates is DuplicatesError. sidecars is not modified.
+func SortSidecars(sidecars []*BlobSidecar, duplicates DuplicateIndices) ([]*BlobSidecar, []deneb.BlobIndex, error) {
+	sorted := make([]*BlobSidecar, len(sidecars))
+	copy(sorted, sidecars)
+	// The sort is stable, so the sidecars with each index stay in the order of the response
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	result := make([]*BlobSidecar, 0, len(sorted))
+	var repeated []deneb.BlobIndex
+	for _, sidecar := range sorted {
+		last := len(result) - 1
+		if last < 0 || result[last].Index != sidecar.Index {
+			result = append(result, sidecar)
+			continue
+		}
+
+		if len(repeated) == 0 || repeated[len(repeated)-1] != sidecar.Index {
+			repeated = append(repeated, sidecar.Index)
+		}
+		if duplicates == DuplicatesKeepLast {
+			result[last] = sidecar
+		}
+	}
+
+	if len(repeated) > 0 && duplicates == DuplicatesError {
+		return nil, repeated, &DuplicateIndicesError{Indices: repeated}
+	}
+
+	return result, repeated, nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortSidecars(t *testing.T) {
+	first := &BlobSidecar{Index: 1, KZGProof: deneb.KZGProof{1}}
+	last := &BlobSidecar{Index: 1, KZGProof: deneb.KZGProof{2}}
+	zero := &BlobSidecar{Index: 0}
+	two := &BlobSidecar{Index: 2}
+	response := []*BlobSidecar{two, first, zero, last, two}
+
+	_, repeated, err := SortSidecars(response, DuplicatesError)
+	var dupErr *DuplicateIndicesError
+	require.ErrorAs(t, err, &dupErr)
+	require.Equal(t, []deneb.BlobIndex{1, 2}, dupErr.Indices)
+	require.Equal(t, []deneb.BlobIndex{1, 2}, repeated)
+
+	sorted, repeated, err := SortSidecars(response, DuplicatesKeepFirst)
+	require.NoError(t, err)
+	require.Equal(t, []*BlobSidecar{zero, first, two}, sorted)
+	require.Equal(t, []deneb.BlobIndex{1, 2}, repeated)
+
+	sorted, _, err = SortSidecars(response, DuplicatesKeepLast)
+	require.NoError(t, err)
+	require.Equal(t, []*BlobSidecar{zero, last, two}, sorted)
+
+	// The response is not modified
+	require.Equal(t, []*BlobSidecar{two, first, zero, last, two}, response)
+
+	sorted, repeated, err = SortSidecars([]*BlobSidecar{two, zero}, DuplicatesError)
+	require.NoError(t, err)
+	require.Equal(t, []*BlobSidecar{zero, two}, sorted)
+	require.Empty(t, repeated)
+}
+
+func TestParseDuplicateIndices(t *testing.T) {
+	for _, d := range []DuplicateIndices{DuplicatesError, DuplicatesKeepFirst, DuplicatesKeepLast} {
+		parsed, err := ParseDuplicateIndices(d.String())
+		require.NoError(t, err)
+		require.Equal(t, d, parsed)
+	}
+
+	parsed, err := ParseDuplicateIndices(" Keep-Last ")
+	require.NoError(t, err)
+	require.Equal(t, DuplicatesKeepLast, parsed)
+
+	_, err = ParseDuplicateIndices("drop")
+	require.ErrorContains(t, err, "unknown duplicate indices handling")
+}
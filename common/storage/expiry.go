@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// ExpiresAtMetadata is the user metadata of S3 objects holding the expiry of the block, see Header.ExpiresAt, so
+	// that expired blocks can be found without downloading them
+	ExpiresAtMetadata = "Expires-At"
+	// SlotMetadata is the user metadata of S3 objects holding the slot of the block
+	SlotMetadata = "Slot"
+)
+
+// ErrExpiryUnsupported is returned by Expirer.ListBlocks when the data store cannot list its blocks.
+var ErrExpiryUnsupported = errors.New("data store does not list its blocks for deletion")
+
+// StoredBlock is a block in storage, with what is needed to decide whether to delete it by its expiry or its age.
+type StoredBlock struct {
+	Root common.Hash
+	// Slot is the slot of the block, 0 if it was stored without a header or sidecars to take it from, e.g. a tombstone
+	Slot uint64
+	// Bytes is the size of the block as stored
+	Bytes int64
+	// ExpiresAt is the expiry of the block, see Header.ExpiresAt
+	ExpiresAt int64
+}
+
+// Expired returns whether the block expires at or before now.
+func (b StoredBlock) Expired(now time.Time) bool {
+	return Header{ExpiresAt: b.ExpiresAt}.Expired(now)
+}
+
+// Expirer lists and deletes the blocks of a data store, so that blocks are deleted by their expiry or age the same way
+// whatever the backend and its native lifecycle features.
+type Expirer interface {
+	// ListBlocks returns every stored block, including tombstones. It should return nil, ErrStorage or
+	// ErrExpiryUnsupported.
+	ListBlocks(ctx context.Context) ([]StoredBlock, error)
+	// DeleteBlob deletes the stored block with the given root. Deleting a block that is not stored is not an error. It
+	// should return nil, ErrStorage or ErrExpiryUnsupported.
+	DeleteBlob(ctx context.Context, hash common.Hash) error
+}
+
+// Expired returns whether the block expires at or before now.
+func (h Header) Expired(now time.Time) bool {
+	return h.ExpiresAt != 0 && h.ExpiresAt <= now.Unix()
+}
+
+// slot returns the slot of the block, from its stored header or otherwise its blob or data column sidecars, or 0 if it
+// has neither.
+func (d BlobData) slot() uint64 {
+	if d.Header.BeaconBlockHeader != nil && d.Header.BeaconBlockHeader.Message != nil {
+		return uint64(d.Header.BeaconBlockHeader.Message.Slot)
+	}
+	var header *phase0.SignedBeaconBlockHeader
+	if len(d.BlobSidecars.Data) > 0 {
+		header = d.BlobSidecars.Data[0].SignedBlockHeader
+	} else if d.DataColumnSidecars != nil && len(d.DataColumnSidecars.Data) > 0 {
+		header = d.DataColumnSidecars.Data[0].SignedBlockHeader
+	}
+	if header == nil || header.Message == nil {
+		return 0
+	}
+	return uint64(header.Message.Slot)
+}
+
+// ListBlocks reads every block in the storage directory for its slot and expiry. Blocks that cannot be decoded are
+// left out, for verify-storage to report rather than the reaper to delete.
+func (s *FileStorage) ListBlocks(ctx context.Context) ([]StoredBlock, error) {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		s.log.Warn("error listing storage directory", "err", err)
+		return nil, ErrStorage
+	}
+
+	var result []StoredBlock
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if entry.IsDir() || !isBlockObject(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			s.log.Warn("error reading stored block", "name", entry.Name(), "err", err)
+			return nil, ErrStorage
+		}
+
+		root := common.HexToHash(entry.Name())
+		data, err := s.ReadBlob(ctx, root)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrMarshaling) {
+			continue
+		} else if err != nil {
+			s.log.Warn("error reading stored block", "name", entry.Name(), "err", err)
+			return nil, ErrStorage
+		}
+
+		result = append(result, StoredBlock{Root: root, Slot: data.slot(), Bytes: info.Size(), ExpiresAt: data.Header.ExpiresAt})
+	}
+
+	return result, nil
+}
+
+func (s *FileStorage) DeleteBlob(_ context.Context, hash common.Hash) error {
+	if err := os.Remove(s.fileName(hash)); err != nil && !os.IsNotExist(err) {
+		s.log.Warn("error deleting blob", "root", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("deleted blob", "root", hash.String())
+	return nil
+}
+
+// objectMetadata returns the user metadata to write a block with, holding its slot if it is known and its expiry if
+// it has one.
+func objectMetadata(data BlobData) map[string]string {
+	result := make(map[string]string, 2)
+	if slot := data.slot(); slot != 0 {
+		result[SlotMetadata] = strconv.FormatUint(slot, 10)
+	}
+	if data.Header.ExpiresAt != 0 {
+		result[ExpiresAtMetadata] = strconv.FormatInt(data.Header.ExpiresAt, 10)
+	}
+	return result
+}
+
+// ListBlocks lists the blocks under the storage path of the bucket, and reads the slot and expiry of each from the
+// metadata of the object with a HEAD request. Blocks written before their slot was stored in the metadata are
+// downloaded instead.
+func (s *S3Storage) ListBlocks(ctx context.Context) ([]StoredBlock, error) {
+	prefix := ""
+	if s.path != "" {
+		prefix = strings.TrimSuffix(s.path, "/") + "/"
+	}
+
+	var result []StoredBlock
+	for object := range s.s3.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			s.log.Warn("error listing bucket", "err", object.Err)
+			return nil, ErrStorage
+		}
+
+		name := path.Base(object.Key)
+		if !isBlockObject(name) {
+			continue
+		}
+
+		block := StoredBlock{Root: common.HexToHash(name), Bytes: object.Size}
+		if object.Size == 0 {
+			result = append(result, block)
+			continue
+		}
+
+		stat, err := s.s3.StatObject(ctx, s.bucket, object.Key, minio.StatObjectOptions{})
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			continue
+		} else if err != nil {
+			s.log.Warn("error reading object metadata", "key", object.Key, "err", err)
+			return nil, ErrStorage
+		}
+
+		block.Slot, _ = strconv.ParseUint(stat.UserMetadata[SlotMetadata], 10, 64)
+		block.ExpiresAt, _ = strconv.ParseInt(stat.UserMetadata[ExpiresAtMetadata], 10, 64)
+		if block.Slot == 0 {
+			data, err := s.ReadBlob(ctx, block.Root)
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrMarshaling) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			block.Slot, block.ExpiresAt = data.slot(), data.Header.ExpiresAt
+		}
+		result = append(result, block)
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return result, nil
+}
+
+func (s *S3Storage) DeleteBlob(ctx context.Context, hash common.Hash) error {
+	err := s.s3.RemoveObject(ctx, s.bucket, path.Join(s.path, hash.String()), minio.RemoveObjectOptions{})
+	if err != nil {
+		s.log.Warn("error deleting blob", "root", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("deleted blob", "root", hash.String())
+	return nil
+}
+
+// ListBlocks returns the blocks of the current and previous shards, a block held by both once. ErrExpiryUnsupported
+// is returned if a shard does not list its blocks.
+func (s *ShardedStorage) ListBlocks(ctx context.Context) ([]StoredBlock, error) {
+	var result []StoredBlock
+	seen := make(map[common.Hash]bool)
+	for _, shard := range s.distinctShards() {
+		blocks, err := shard.Store.ListBlocks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			if !seen[block.Root] {
+				seen[block.Root] = true
+				result = append(result, block)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteBlob deletes the block from every shard, as a block may still be held by its previous shard.
+func (s *ShardedStorage) DeleteBlob(ctx context.Context, hash common.Hash) error {
+	for _, shard := range s.distinctShards() {
+		if err := shard.Store.DeleteBlob(ctx, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBlob deletes the block from the inner data store, in order with any write of it.
+func (s *OrderedStorage) DeleteBlob(ctx context.Context, hash common.Hash) error {
+	return s.ordered(ctx, hash, func() error {
+		return s.DataStore.DeleteBlob(ctx, hash)
+	})
+}
+
+// DeleteBlob deletes the block from the primary and every replica, under the replication policy like a write, so that
+// a block reaped or pruned from the archive is not left behind in its copies. ErrExpiryUnsupported is returned if a
+// backend cannot delete blocks and the delete is not successful under the policy without it.
+func (s *ReplicatedStorage) DeleteBlob(ctx context.Context, hash common.Hash) error {
+	return s.replicate(ctx, hash, func(store DataStore) error {
+		return store.DeleteBlob(ctx, hash)
+	})
+}
+
+// ListBlocks returns ErrExpiryUnsupported, the blocks of a GCS bucket are not listed.
+func (s *GCSStorage) ListBlocks(context.Context) ([]StoredBlock, error) {
+	return nil, ErrExpiryUnsupported
+}
+
+// DeleteBlob returns ErrExpiryUnsupported, the blocks of a GCS bucket are not deleted.
+func (s *GCSStorage) DeleteBlob(context.Context, common.Hash) error {
+	return ErrExpiryUnsupported
+}
+
+// ListBlocks returns ErrExpiryUnsupported, the blocks of an Azure container are not listed.
+func (s *AzureStorage) ListBlocks(context.Context) ([]StoredBlock, error) {
+	return nil, ErrExpiryUnsupported
+}
+
+// DeleteBlob returns ErrExpiryUnsupported, the blocks of an Azure container are not deleted.
+func (s *AzureStorage) DeleteBlob(context.Context, common.Hash) error {
+	return ErrExpiryUnsupported
+}
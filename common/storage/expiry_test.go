@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type expiringStore interface {
+	DataStore
+	Expirer
+}
+
+// writeExpiring writes a block at slot 20 that expires at expiresAt, 0 never expiring.
+func writeExpiring(t *testing.T, s DataStore, hash common.Hash, expiresAt int64) {
+	data := BlobData{Header: Header{BeaconBlockHash: hash, ExpiresAt: expiresAt}, BlobSidecars: sidecarsAtSlot(20)}
+	require.NoError(t, s.WriteBlob(context.Background(), data))
+}
+
+// expiredRoots returns the roots of the listed blocks of s that expire at or before now.
+func expiredRoots(t *testing.T, s Expirer, now time.Time) []common.Hash {
+	blocks, err := s.ListBlocks(context.Background())
+	require.NoError(t, err)
+	var result []common.Hash
+	for _, block := range blocks {
+		if block.Expired(now) {
+			result = append(result, block.Root)
+		}
+	}
+	return result
+}
+
+func runTestExpiry(t *testing.T, s expiringStore) {
+	now := time.Unix(1_700_000_000, 0)
+	writeExpiring(t, s, common.Hash{0x01}, now.Unix()-1)
+	writeExpiring(t, s, common.Hash{0x02}, now.Unix())
+	writeExpiring(t, s, common.Hash{0x03}, now.Unix()+1)
+	writeExpiring(t, s, common.Hash{0x04}, 0)
+	require.NoError(t, s.WriteEmptyBlob(context.Background(), common.Hash{0x05}))
+
+	blocks, err := s.ListBlocks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, blocks, 5)
+	for _, block := range blocks {
+		if block.Root == (common.Hash{0x05}) {
+			require.Equal(t, StoredBlock{Root: block.Root}, block, "tombstones have no slot, size or expiry")
+			continue
+		}
+		require.Equal(t, uint64(20), block.Slot)
+		require.Positive(t, block.Bytes)
+	}
+	require.ElementsMatch(t, []common.Hash{{0x01}, {0x02}}, expiredRoots(t, s, now))
+
+	require.NoError(t, s.DeleteBlob(context.Background(), common.Hash{0x01}))
+	exists, err := s.Exists(context.Background(), common.Hash{0x01})
+	require.NoError(t, err)
+	require.False(t, exists)
+	// Deleting a block that is not stored succeeds, e.g. when it was reaped by another run
+	require.NoError(t, s.DeleteBlob(context.Background(), common.Hash{0x01}))
+
+	require.Equal(t, []common.Hash{{0x02}}, expiredRoots(t, s, now))
+}
+
+func TestFileExpiry(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestExpiry(t, fs)
+}
+
+func TestS3Expiry(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestExpiry(t, s3)
+}
+
+func TestObjectMetadata(t *testing.T) {
+	require.Empty(t, objectMetadata(BlobData{}))
+	require.Equal(t, map[string]string{SlotMetadata: "20"}, objectMetadata(BlobData{BlobSidecars: sidecarsAtSlot(20)}))
+	require.Equal(t, map[string]string{ExpiresAtMetadata: "1700000000", SlotMetadata: "20"}, objectMetadata(BlobData{
+		Header:       Header{ExpiresAt: 1_700_000_000},
+		BlobSidecars: sidecarsAtSlot(20),
+	}))
+}
+
+func TestShardedExpiry(t *testing.T) {
+	shards := setupShards(t, "a", "b", "c")
+	now := time.Unix(1_700_000_000, 0)
+	hashes := testHashes(20)
+	old, err := NewShardedStorage(shards[:2], nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	for _, hash := range hashes {
+		writeExpiring(t, old, hash, now.Unix())
+	}
+
+	// During a rebalance the blocks still held by their previous shard are found and deleted there too
+	s, err := NewShardedStorage(shards, shards[:2], testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	expired := expiredRoots(t, s, now)
+	require.ElementsMatch(t, hashes, expired)
+
+	for _, root := range expired {
+		require.NoError(t, s.DeleteBlob(context.Background(), root))
+	}
+	blocks, err := s.ListBlocks(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+}
+
+func TestOrderedExpiry(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestExpiry(t, NewOrderedStorage(fs, DefaultWriteConcurrency))
+}
@@ -1,12 +1,14 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"os"
 	"path"
 	"strconv"
 
+	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 )
@@ -14,6 +16,9 @@ import (
 type FileStorage struct {
 	log       log.Logger
 	directory string
+	// compression is the codec blobs are written with. Files have no metadata to record it in, so it is detected from
+	// the magic number of the file when reading.
+	compression flags.Compression
 }
 
 func NewFileStorage(dir string, l log.Logger) *FileStorage {
@@ -31,6 +36,15 @@ func NewFileStorage(dir string, l log.Logger) *FileStorage {
 		}
 	}
 
+	_, err = storage.ReadBackfillWAL(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty backfill_wal file")
+		err = storage.WriteBackfillWAL(context.Background(), BackfillWAL{})
+		if err != nil {
+			storage.log.Crit("failed to create empty backfill_wal file", "err", err)
+		}
+	}
+
 	_, err = storage.ReadLockfile(context.Background())
 	if err == ErrNotFound {
 		storage.log.Info("creating empty lockfile file")
@@ -63,10 +77,20 @@ func (s *FileStorage) ReadBlob(_ context.Context, hash common.Hash) (BlobData, e
 
 		return BlobData{}, err
 	}
+	if len(data) == 0 {
+		return emptyBlobData(hash), nil
+	}
+	reader, err := decompressBlob(bytes.NewReader(data), "")
+	if err != nil {
+		s.log.Warn("error creating decompressor", "root", hash.String(), "err", err)
+		return BlobData{}, ErrMarshaling
+	}
+	defer reader.Close()
+
 	var result BlobData
-	err = json.Unmarshal(data, &result)
+	err = json.NewDecoder(reader).Decode(&result)
 	if err != nil {
-		s.log.Warn("error decoding blob", "err", err, "hash", hash.String())
+		s.log.Warn("error decoding blob", "err", err, "root", hash.String())
 		return BlobData{}, ErrMarshaling
 	}
 	return result, nil
@@ -93,6 +117,42 @@ func (s *FileStorage) ReadBackfillProcesses(ctx context.Context) (BackfillProces
 	return result, nil
 }
 
+func (s *FileStorage) ReadBackfillWAL(_ context.Context) (BackfillWAL, error) {
+	data, err := os.ReadFile(path.Join(s.directory, "backfill_wal"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return BackfillWAL{}, ErrNotFound
+		}
+
+		return BackfillWAL{}, err
+	}
+	var result BackfillWAL
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		s.log.Warn("error decoding backfill_wal", "err", err)
+		return BackfillWAL{}, ErrMarshaling
+	}
+	return result, nil
+}
+
+func (s *FileStorage) ReadBackfillCheckpoint(_ context.Context) (BackfillCheckpoint, error) {
+	data, err := os.ReadFile(path.Join(s.directory, "backfill_checkpoint"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return BackfillCheckpoint{}, ErrNotFound
+		}
+
+		return BackfillCheckpoint{}, err
+	}
+	var result BackfillCheckpoint
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		s.log.Warn("error decoding backfill_checkpoint", "err", err)
+		return BackfillCheckpoint{}, ErrMarshaling
+	}
+	return result, nil
+}
+
 func (s *FileStorage) ReadLockfile(ctx context.Context) (Lockfile, error) {
 	data, err := os.ReadFile(path.Join(s.directory, "lockfile"))
 	if err != nil {
@@ -120,7 +180,7 @@ func (s *FileStorage) WriteBackfillProcesses(_ context.Context, data BackfillPro
 		s.log.Warn("error encoding backfill_processes", "err", err)
 		return ErrMarshaling
 	}
-	err = os.WriteFile(path.Join(s.directory, "backfill_processes"), b, 0644)
+	err = writeFileAtomic(path.Join(s.directory, "backfill_processes"), b)
 	if err != nil {
 		s.log.Warn("error writing backfill_processes", "err", err)
 		return err
@@ -130,13 +190,45 @@ func (s *FileStorage) WriteBackfillProcesses(_ context.Context, data BackfillPro
 	return nil
 }
 
+func (s *FileStorage) WriteBackfillWAL(_ context.Context, data BackfillWAL) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.log.Warn("error encoding backfill_wal", "err", err)
+		return ErrMarshaling
+	}
+	err = writeFileAtomic(path.Join(s.directory, "backfill_wal"), b)
+	if err != nil {
+		s.log.Warn("error writing backfill_wal", "err", err)
+		return err
+	}
+
+	s.log.Debug("wrote backfill_wal", "entries", len(data.Entries))
+	return nil
+}
+
+func (s *FileStorage) WriteBackfillCheckpoint(_ context.Context, data BackfillCheckpoint) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.log.Warn("error encoding backfill_checkpoint", "err", err)
+		return ErrMarshaling
+	}
+	err = writeFileAtomic(path.Join(s.directory, "backfill_checkpoint"), b)
+	if err != nil {
+		s.log.Warn("error writing backfill_checkpoint", "err", err)
+		return err
+	}
+
+	s.log.Debug("wrote backfill_checkpoint", "nextSlot", data.NextSlot)
+	return nil
+}
+
 func (s *FileStorage) WriteLockfile(_ context.Context, data Lockfile) error {
 	b, err := json.Marshal(data)
 	if err != nil {
 		s.log.Warn("error encoding lockfile", "err", err)
 		return ErrMarshaling
 	}
-	err = os.WriteFile(path.Join(s.directory, "lockfile"), b, 0644)
+	err = writeFileAtomic(path.Join(s.directory, "lockfile"), b)
 	if err != nil {
 		s.log.Warn("error writing lockfile", "err", err)
 		return err
@@ -152,13 +244,29 @@ func (s *FileStorage) WriteBlob(_ context.Context, data BlobData) error {
 		s.log.Warn("error encoding blob", "err", err)
 		return ErrMarshaling
 	}
-	err = os.WriteFile(s.fileName(data.Header.BeaconBlockHash), b, 0644)
+	b, _, err = compressBlob(s.compression, b)
+	if err != nil {
+		s.log.Warn("error compressing blob", "err", err)
+		return ErrCompress
+	}
+	err = writeFileAtomic(s.fileName(data.Header.BeaconBlockHash), b)
 	if err != nil {
 		s.log.Warn("error writing blob", "err", err)
 		return err
 	}
 
-	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	s.log.Info("wrote blob", "root", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+func (s *FileStorage) WriteEmptyBlob(_ context.Context, hash common.Hash) error {
+	err := writeFileAtomic(s.fileName(hash), nil)
+	if err != nil {
+		s.log.Warn("error writing empty blob", "err", err)
+		return err
+	}
+
+	s.log.Info("wrote empty blob", "root", hash.String())
 	return nil
 }
 
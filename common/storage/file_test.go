@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
@@ -49,6 +50,24 @@ func TestExists(t *testing.T) {
 	runTestExists(t, fs)
 }
 
+func runTestBackfillCheckpoint(t *testing.T, s DataStore) {
+	_, err := s.ReadBackfillCheckpoint(context.Background())
+	require.ErrorIs(t, err, ErrNotFound)
+
+	checkpoint := BackfillCheckpoint{StartSlot: 100, EndSlot: 200, NextSlot: 150, Done: []uint64{152, 160}}
+	require.NoError(t, s.WriteBackfillCheckpoint(context.Background(), checkpoint))
+	read, err := s.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, checkpoint, read)
+}
+
+func TestBackfillCheckpoint(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestBackfillCheckpoint(t, fs)
+}
+
 func runTestRead(t *testing.T, s DataStore) {
 	id := common.Hash{1, 2, 3}
 
@@ -76,6 +95,70 @@ func TestRead(t *testing.T) {
 	runTestRead(t, fs)
 }
 
+func runTestReadEmpty(t *testing.T, s DataStore) {
+	id := common.Hash{1, 2, 3}
+
+	err := s.WriteEmptyBlob(context.Background(), id)
+	require.NoError(t, err)
+
+	exists, err := s.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	data, err := s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, id, data.Header.BeaconBlockHash)
+	require.NotNil(t, data.BlobSidecars.Data)
+	require.Empty(t, data.BlobSidecars.Data)
+}
+
+func TestReadEmpty(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestReadEmpty(t, fs)
+
+	stat, err := os.Stat(fs.fileName(common.Hash{1, 2, 3}))
+	require.NoError(t, err)
+	require.Zero(t, stat.Size())
+}
+
+func runTestReadBlockHeader(t *testing.T, s DataStore) {
+	header := &phase0.SignedBeaconBlockHeader{
+		Message: &phase0.BeaconBlockHeader{
+			Slot:          10,
+			ProposerIndex: 3,
+			ParentRoot:    phase0.Root{1},
+			StateRoot:     phase0.Root{2},
+			BodyRoot:      phase0.Root{3},
+		},
+		Signature: phase0.BLSSignature{4},
+	}
+	root, err := header.Message.HashTreeRoot()
+	require.NoError(t, err)
+
+	err = s.WriteBlob(context.Background(), BlobData{
+		Header: Header{
+			BeaconBlockHash:   common.Hash(root),
+			BeaconBlockHeader: header,
+		},
+		BlobSidecars: sidecarsAtSlot(10),
+	})
+	require.NoError(t, err)
+
+	data, err := s.ReadBlob(context.Background(), common.Hash(root))
+	require.NoError(t, err)
+	require.Equal(t, header, data.Header.BeaconBlockHeader)
+	require.NoError(t, data.Header.VerifyBlockHeader())
+}
+
+func TestReadBlockHeader(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestReadBlockHeader(t, fs)
+}
+
 func TestBrokenStorage(t *testing.T) {
 	fs, cleanup := setup(t)
 
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"google.golang.org/api/option"
+)
+
+// GCSStorage stores blobs in a Google Cloud Storage bucket, laid out and encoded the same way as S3Storage. The client
+// connects to the emulator named by the STORAGE_EMULATOR_HOST environment variable when it is set.
+type GCSStorage struct {
+	client      *gcs.Client
+	bucket      *gcs.BucketHandle
+	path        string
+	log         log.Logger
+	compression flags.Compression
+}
+
+func NewGCSStorage(cfg flags.GCSConfig, l log.Logger) (*GCSStorage, error) {
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+
+	client, err := gcs.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &GCSStorage{
+		client:      client,
+		bucket:      client.Bucket(cfg.Bucket),
+		path:        cfg.Path,
+		log:         l,
+		compression: blobCompression(cfg.Compression, cfg.Compress),
+	}
+
+	_, err = storage.ReadBackfillProcesses(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty backfill_processes object")
+		if err := storage.WriteBackfillProcesses(context.Background(), BackfillProcesses{}); err != nil {
+			return nil, fmt.Errorf("failed to create backfill_processes object: %w", err)
+		}
+	}
+
+	_, err = storage.ReadBackfillWAL(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty backfill_wal object")
+		if err := storage.WriteBackfillWAL(context.Background(), BackfillWAL{}); err != nil {
+			return nil, fmt.Errorf("failed to create backfill_wal object: %w", err)
+		}
+	}
+
+	_, err = storage.ReadLockfile(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty lockfile object")
+		if err := storage.WriteLockfile(context.Background(), Lockfile{}); err != nil {
+			return nil, fmt.Errorf("failed to create lockfile object: %w", err)
+		}
+	}
+
+	return storage, nil
+}
+
+func (s *GCSStorage) object(name string) *gcs.ObjectHandle {
+	return s.bucket.Object(path.Join(s.path, name))
+}
+
+func (s *GCSStorage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
+	_, err := s.object(hash.String()).Attrs(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return false, nil
+	} else if err != nil {
+		s.log.Info("unexpected error checking blob", "root", hash.String(), "err", err)
+		return false, ErrStorage
+	}
+
+	return true, nil
+}
+
+func (s *GCSStorage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
+	// Compressed blobs are decoded here, like on S3, rather than relying on GCS transcoding them
+	res, err := s.object(hash.String()).ReadCompressed(true).NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		s.log.Info("unable to find blob", "root", hash.String())
+		return BlobData{}, ErrNotFound
+	} else if err != nil {
+		s.log.Info("unexpected error fetching blob", "root", hash.String(), "err", err)
+		return BlobData{}, ErrStorage
+	}
+	defer res.Close()
+
+	if res.Attrs.Size == 0 {
+		return emptyBlobData(hash), nil
+	}
+
+	reader, err := decompressBlob(res, res.Attrs.ContentEncoding)
+	if err != nil {
+		s.log.Warn("error creating decompressor", "root", hash.String(), "err", err)
+		return BlobData{}, ErrMarshaling
+	}
+	defer reader.Close()
+
+	var data BlobData
+	err = json.NewDecoder(reader).Decode(&data)
+	if err != nil {
+		s.log.Warn("error decoding blob", "root", hash.String(), "err", err)
+		return BlobData{}, ErrMarshaling
+	}
+
+	return data, nil
+}
+
+// readJSON decodes the JSON object with the given name into v.
+func (s *GCSStorage) readJSON(ctx context.Context, name string, v any) error {
+	res, err := s.object(name).NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		s.log.Info("unable to find " + name + " key")
+		return ErrNotFound
+	} else if err != nil {
+		s.log.Info("unexpected error fetching "+name, "err", err)
+		return ErrStorage
+	}
+	defer res.Close()
+
+	if err := json.NewDecoder(res).Decode(v); err != nil {
+		s.log.Warn("error decoding "+name, "err", err)
+		return ErrMarshaling
+	}
+
+	return nil
+}
+
+// writeObject writes b to the object with the given name.
+func (s *GCSStorage) writeObject(ctx context.Context, name string, b []byte, contentEncoding string, metadata map[string]string) error {
+	w := s.object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+	w.ContentEncoding = contentEncoding
+	w.Metadata = metadata
+	// Objects are small enough to upload in a single request, rather than buffering a chunk for each concurrent write
+	w.ChunkSize = 0
+
+	if _, err := w.Write(b); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeJSON encodes v and writes it to the object with the given name.
+func (s *GCSStorage) writeJSON(ctx context.Context, name string, v any) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		s.log.Warn("error encoding "+name, "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.writeObject(ctx, name, d, "", nil); err != nil {
+		s.log.Warn("error writing to "+name, "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *GCSStorage) ReadBackfillProcesses(ctx context.Context) (BackfillProcesses, error) {
+	BackfillMu.Lock()
+	defer BackfillMu.Unlock()
+
+	var data BackfillProcesses
+	if err := s.readJSON(ctx, "backfill_processes", &data); err != nil {
+		return BackfillProcesses{}, err
+	}
+	return data, nil
+}
+
+func (s *GCSStorage) ReadBackfillWAL(ctx context.Context) (BackfillWAL, error) {
+	var data BackfillWAL
+	if err := s.readJSON(ctx, "backfill_wal", &data); err != nil {
+		return BackfillWAL{}, err
+	}
+	return data, nil
+}
+
+func (s *GCSStorage) ReadBackfillCheckpoint(ctx context.Context) (BackfillCheckpoint, error) {
+	var data BackfillCheckpoint
+	if err := s.readJSON(ctx, "backfill_checkpoint", &data); err != nil {
+		return BackfillCheckpoint{}, err
+	}
+	return data, nil
+}
+
+func (s *GCSStorage) ReadLockfile(ctx context.Context) (Lockfile, error) {
+	var data Lockfile
+	if err := s.readJSON(ctx, "lockfile", &data); err != nil {
+		return Lockfile{}, err
+	}
+	return data, nil
+}
+
+func (s *GCSStorage) WriteBackfillProcesses(ctx context.Context, data BackfillProcesses) error {
+	BackfillMu.Lock()
+	defer BackfillMu.Unlock()
+
+	if err := s.writeJSON(ctx, "backfill_processes", data); err != nil {
+		return err
+	}
+
+	s.log.Info("wrote to backfill_processes")
+	return nil
+}
+
+func (s *GCSStorage) WriteBackfillWAL(ctx context.Context, data BackfillWAL) error {
+	if err := s.writeJSON(ctx, "backfill_wal", data); err != nil {
+		return err
+	}
+
+	s.log.Debug("wrote to backfill_wal", "entries", len(data.Entries))
+	return nil
+}
+
+func (s *GCSStorage) WriteBackfillCheckpoint(ctx context.Context, data BackfillCheckpoint) error {
+	if err := s.writeJSON(ctx, "backfill_checkpoint", data); err != nil {
+		return err
+	}
+
+	s.log.Debug("wrote to backfill_checkpoint", "nextSlot", data.NextSlot)
+	return nil
+}
+
+func (s *GCSStorage) WriteLockfile(ctx context.Context, data Lockfile) error {
+	if err := s.writeJSON(ctx, "lockfile", data); err != nil {
+		return err
+	}
+
+	s.log.Info("wrote to lockfile", "archiverId", data.ArchiverId, "timestamp", strconv.FormatInt(data.Timestamp, 10))
+	return nil
+}
+
+func (s *GCSStorage) WriteBlob(ctx context.Context, data BlobData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.log.Warn("error encoding blob", "err", err)
+		return ErrMarshaling
+	}
+
+	b, contentEncoding, err := compressBlob(s.compression, b)
+	if err != nil {
+		s.log.Warn("error compressing blob", "err", err)
+		return ErrCompress
+	}
+
+	if err := s.writeObject(ctx, data.Header.BeaconBlockHash.String(), b, contentEncoding, objectMetadata(data)); err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote blob", "root", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+func (s *GCSStorage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	if err := s.writeObject(ctx, hash.String(), nil, "", nil); err != nil {
+		s.log.Warn("error writing empty blob", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote empty blob", "root", hash.String())
+	return nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+)
+
+// Prior to running these tests, a local GCS emulator must be running.
+// You can accomplish this with:
+// docker compose down # shut down any running services
+// docker compose up fake-gcs # start the GCS emulator
+func setupGCS(t *testing.T, compress bool) *GCSStorage {
+	if os.Getenv("RUN_INTEGRATION_TESTS") == "" {
+		t.Skip("skipping integration tests: set RUN_INTEGRATION_TESTS environment variable")
+	}
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Setenv("STORAGE_EMULATOR_HOST", "localhost:4443")
+	}
+
+	l := testlog.Logger(t, log.LvlInfo)
+
+	client, err := gcs.NewClient(context.Background())
+	require.NoError(t, err)
+	defer client.Close()
+
+	bucket := client.Bucket("blobs")
+	if _, err := bucket.Attrs(context.Background()); errors.Is(err, gcs.ErrBucketNotExist) {
+		require.NoError(t, bucket.Create(context.Background(), "test", nil))
+	}
+	objects := bucket.Objects(context.Background(), nil)
+	for {
+		object, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, bucket.Object(object.Name).Delete(context.Background()))
+	}
+
+	s, err := NewGCSStorage(flags.GCSConfig{Bucket: "blobs", Compress: compress}, l)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.client.Close() })
+	return s
+}
+
+func TestGCSExists(t *testing.T) {
+	s := setupGCS(t, false)
+
+	runTestExists(t, s)
+}
+
+func TestGCSRead(t *testing.T) {
+	s := setupGCS(t, false)
+
+	runTestRead(t, s)
+}
+
+func TestGCSReadCompressed(t *testing.T) {
+	s := setupGCS(t, true)
+
+	runTestRead(t, s)
+
+	attrs, err := s.object(common.Hash{1, 2, 3}.String()).Attrs(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "gzip", attrs.ContentEncoding)
+}
+
+func TestGCSReadMixedCompression(t *testing.T) {
+	s := setupGCS(t, false)
+
+	runTestReadMixedCompression(t, s, func(compression flags.Compression) { s.compression = compression })
+
+	attrs, err := s.object(common.Hash{3}.String()).Attrs(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "zstd", attrs.ContentEncoding)
+}
+
+func TestGCSReadEmpty(t *testing.T) {
+	s := setupGCS(t, false)
+
+	runTestReadEmpty(t, s)
+}
+
+func TestGCSReadBlockHeader(t *testing.T) {
+	s := setupGCS(t, false)
+
+	runTestReadBlockHeader(t, s)
+}
+
+func TestGCSBackfillState(t *testing.T) {
+	s := setupGCS(t, false)
+
+	processes, err := s.ReadBackfillProcesses(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, processes)
+
+	lockfile := Lockfile{ArchiverId: "archiver", Timestamp: 1_700_000_000}
+	require.NoError(t, s.WriteLockfile(context.Background(), lockfile))
+	read, err := s.ReadLockfile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, lockfile, read)
+
+	runTestBackfillCheckpoint(t, s)
+	runTestInventoryChunk(t, s)
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/minio/minio-go/v7"
+)
+
+// blobIndexPrefix is the directory, or key prefix, holding the blob index of a data store, one object per versioned
+// hash. It is not a block root, so the index is not listed as blocks, see isBlockObject.
+const blobIndexPrefix = "blob_index"
+
+// BlobLocation is where a blob is stored, the block it belongs to and its index in the block.
+type BlobLocation struct {
+	BlockRoot common.Hash `json:"block_root"`
+	Index     uint64      `json:"index"`
+}
+
+// BlobIndexer is the secondary index that data stores keep from the versioned hash of each blob, which an execution
+// layer transaction refers to the blob by, to its location. The index is written by the archiver with the
+// block, see WriteBlobIndex, and is not removed when the block is deleted, so a location may refer to a block that is
+// no longer stored.
+type BlobIndexer interface {
+	// WriteBlobLocation records the location of the blob with the given versioned hash. It should return nil,
+	// ErrStorage or ErrMarshaling.
+	WriteBlobLocation(ctx context.Context, versionedHash common.Hash, location BlobLocation) error
+	// ReadBlobLocation returns the location of the blob with the given versioned hash. It should return nil,
+	// ErrNotFound if the blob is not indexed, ErrStorage or ErrMarshaling.
+	ReadBlobLocation(ctx context.Context, versionedHash common.Hash) (BlobLocation, error)
+}
+
+// WriteBlobIndex records the location of every blob of the block in the index, whether the block is stored with blob
+// sidecars or, from fulu on, data column sidecars.
+func WriteBlobIndex(ctx context.Context, indexer BlobIndexer, data BlobData) error {
+	for _, sidecar := range data.BlobSidecars.Data {
+		location := BlobLocation{BlockRoot: data.Header.BeaconBlockHash, Index: uint64(sidecar.Index)}
+		if err := indexer.WriteBlobLocation(ctx, sidecar.VersionedHash(), location); err != nil {
+			return err
+		}
+	}
+	for i, hash := range data.DataColumnSidecars.VersionedHashes() {
+		location := BlobLocation{BlockRoot: data.Header.BeaconBlockHash, Index: uint64(i)}
+		if err := indexer.WriteBlobLocation(ctx, hash, location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStorage) WriteBlobLocation(_ context.Context, versionedHash common.Hash, location BlobLocation) error {
+	b, err := json.Marshal(location)
+	if err != nil {
+		s.log.Warn("error encoding blob location", "err", err)
+		return ErrMarshaling
+	}
+
+	// The directory is created on each write, as compaction removes it if it is ever empty
+	if err := os.MkdirAll(path.Join(s.directory, blobIndexPrefix), 0755); err != nil {
+		s.log.Warn("error creating blob index directory", "err", err)
+		return ErrStorage
+	}
+	if err := writeFileAtomic(s.indexFileName(versionedHash), b); err != nil {
+		s.log.Warn("error writing blob location", "versionedHash", versionedHash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadBlobLocation(_ context.Context, versionedHash common.Hash) (BlobLocation, error) {
+	data, err := os.ReadFile(s.indexFileName(versionedHash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return BlobLocation{}, ErrNotFound
+		}
+
+		s.log.Warn("error reading blob location", "versionedHash", versionedHash.String(), "err", err)
+		return BlobLocation{}, ErrStorage
+	}
+
+	var result BlobLocation
+	if err := json.Unmarshal(data, &result); err != nil {
+		s.log.Warn("error decoding blob location", "versionedHash", versionedHash.String(), "err", err)
+		return BlobLocation{}, ErrMarshaling
+	}
+	return result, nil
+}
+
+func (s *FileStorage) indexFileName(versionedHash common.Hash) string {
+	return path.Join(s.directory, blobIndexPrefix, versionedHash.String())
+}
+
+func (s *S3Storage) WriteBlobLocation(ctx context.Context, versionedHash common.Hash, location BlobLocation) error {
+	d, err := json.Marshal(location)
+	if err != nil {
+		s.log.Warn("error encoding blob location", "err", err)
+		return ErrMarshaling
+	}
+
+	options := minio.PutObjectOptions{
+		ContentType: "application/json",
+	}
+	reader := bytes.NewReader(d)
+
+	_, err = s.s3.PutObject(ctx, s.bucket, s.indexKey(versionedHash), reader, int64(len(d)), options)
+	if err != nil {
+		s.log.Warn("error writing blob location", "versionedHash", versionedHash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadBlobLocation(ctx context.Context, versionedHash common.Hash) (BlobLocation, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, s.indexKey(versionedHash), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching blob location", "versionedHash", versionedHash.String(), "err", err)
+		return BlobLocation{}, ErrStorage
+	}
+	defer res.Close()
+	_, err = res.Stat()
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return BlobLocation{}, ErrNotFound
+		}
+		s.log.Info("unexpected error fetching blob location", "versionedHash", versionedHash.String(), "err", err)
+		return BlobLocation{}, ErrStorage
+	}
+
+	var result BlobLocation
+	if err := json.NewDecoder(res).Decode(&result); err != nil {
+		s.log.Warn("error decoding blob location", "versionedHash", versionedHash.String(), "err", err)
+		return BlobLocation{}, ErrMarshaling
+	}
+	return result, nil
+}
+
+func (s *S3Storage) indexKey(versionedHash common.Hash) string {
+	return path.Join(s.path, blobIndexPrefix, versionedHash.String())
+}
+
+func (s *GCSStorage) WriteBlobLocation(ctx context.Context, versionedHash common.Hash, location BlobLocation) error {
+	return s.writeJSON(ctx, path.Join(blobIndexPrefix, versionedHash.String()), location)
+}
+
+func (s *GCSStorage) ReadBlobLocation(ctx context.Context, versionedHash common.Hash) (BlobLocation, error) {
+	var result BlobLocation
+	if err := s.readJSON(ctx, path.Join(blobIndexPrefix, versionedHash.String()), &result); err != nil {
+		return BlobLocation{}, err
+	}
+	return result, nil
+}
+
+func (s *AzureStorage) WriteBlobLocation(ctx context.Context, versionedHash common.Hash, location BlobLocation) error {
+	return s.writeJSON(ctx, path.Join(blobIndexPrefix, versionedHash.String()), location)
+}
+
+func (s *AzureStorage) ReadBlobLocation(ctx context.Context, versionedHash common.Hash) (BlobLocation, error) {
+	var result BlobLocation
+	if err := s.readJSON(ctx, path.Join(blobIndexPrefix, versionedHash.String()), &result); err != nil {
+		return BlobLocation{}, err
+	}
+	return result, nil
+}
+
+// WriteBlobLocation writes the location to the shard of the versioned hash, which is placed on the ring like a block
+// root.
+func (s *ShardedStorage) WriteBlobLocation(ctx context.Context, versionedHash common.Hash, location BlobLocation) error {
+	return s.shard(versionedHash).Store.WriteBlobLocation(ctx, versionedHash, location)
+}
+
+// ReadBlobLocation reads the location from the shard of the versioned hash, falling through to its previous shard
+// while the archive is being rebalanced.
+func (s *ShardedStorage) ReadBlobLocation(ctx context.Context, versionedHash common.Hash) (BlobLocation, error) {
+	location, err := s.shard(versionedHash).Store.ReadBlobLocation(ctx, versionedHash)
+	if !errors.Is(err, ErrNotFound) {
+		return location, err
+	}
+
+	if previous, ok := s.previousShard(versionedHash); ok {
+		return previous.Store.ReadBlobLocation(ctx, versionedHash)
+	}
+	return location, err
+}
+
+// WriteBlobLocation writes the location to the primary and every replica, under the replication policy, so that a
+// replica can serve lookups by versioned hash if it is promoted. Index writes are not ordered with the writes of the
+// block, as a blob is always at the same location.
+func (s *ReplicatedStorage) WriteBlobLocation(ctx context.Context, versionedHash common.Hash, location BlobLocation) error {
+	return s.replicate(ctx, location.BlockRoot, func(store DataStore) error {
+		return store.WriteBlobLocation(ctx, versionedHash, location)
+	})
+}
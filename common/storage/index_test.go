@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// indexedBlock returns a block with blobs that have distinct commitments, and so distinct versioned hashes.
+func indexedBlock(root common.Hash, blobs int) BlobData {
+	data := BlobData{Header: Header{BeaconBlockHash: root}}
+	for i := 0; i < blobs; i++ {
+		sidecar := sidecarsAtSlot(10).Data[0]
+		sidecar.Index = deneb.BlobIndex(i)
+		sidecar.KZGCommitment = deneb.KZGCommitment{root[0], byte(i)}
+		data.BlobSidecars.Data = append(data.BlobSidecars.Data, sidecar)
+	}
+	return data
+}
+
+func requireIndexed(t *testing.T, indexer BlobIndexer, data BlobData) {
+	for _, sidecar := range data.BlobSidecars.Data {
+		location, err := indexer.ReadBlobLocation(context.Background(), sidecar.VersionedHash())
+		require.NoError(t, err)
+		require.Equal(t, BlobLocation{BlockRoot: data.Header.BeaconBlockHash, Index: uint64(sidecar.Index)}, location)
+	}
+}
+
+func TestVersionedHash(t *testing.T) {
+	sidecar := &BlobSidecar{KZGCommitment: deneb.KZGCommitment{0x01}}
+	hash := sidecar.VersionedHash()
+	// The version byte of a KZG versioned hash
+	require.Equal(t, byte(0x01), hash[0])
+	require.NotEqual(t, hash, (&BlobSidecar{KZGCommitment: deneb.KZGCommitment{0x02}}).VersionedHash())
+}
+
+func TestFileBlobIndex(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	data := indexedBlock(common.Hash{0x01}, 3)
+	_, err := fs.ReadBlobLocation(context.Background(), data.BlobSidecars.Data[0].VersionedHash())
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, fs.WriteBlob(context.Background(), data))
+	require.NoError(t, WriteBlobIndex(context.Background(), fs, data))
+	requireIndexed(t, fs, data)
+
+	// The index is not listed as blocks
+	blocks, err := fs.ListBlocks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	usage, err := fs.Usage(context.Background())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, usage.Objects)
+}
+
+func TestFileBlobIndexDataColumns(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	columns := []*DataColumnSidecar{newDataColumnSidecar(t, 0, 3), newDataColumnSidecar(t, 1, 3)}
+	columns[1].KZGCommitments = columns[0].KZGCommitments
+	data := BlobData{
+		Header:             Header{BeaconBlockHash: common.Hash{0x01}, Fork: "fulu"},
+		DataColumnSidecars: &DataColumnSidecars{Data: columns},
+	}
+	require.NoError(t, WriteBlobIndex(context.Background(), fs, data))
+
+	hashes := data.DataColumnSidecars.VersionedHashes()
+	require.Len(t, hashes, 3)
+	for i, hash := range hashes {
+		require.Equal(t, (&BlobSidecar{KZGCommitment: columns[0].KZGCommitments[i]}).VersionedHash(), hash)
+		location, err := fs.ReadBlobLocation(context.Background(), hash)
+		require.NoError(t, err)
+		require.Equal(t, BlobLocation{BlockRoot: common.Hash{0x01}, Index: uint64(i)}, location)
+	}
+}
+
+func TestShardedBlobIndex(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	previous := setupShards(t, "a")
+	s, err := NewShardedStorage(append(previous, setupShards(t, "b", "c")...), previous, l)
+	require.NoError(t, err)
+
+	data := indexedBlock(common.Hash{0x01}, 6)
+	require.NoError(t, WriteBlobIndex(context.Background(), s, data))
+	requireIndexed(t, s, data)
+
+	// Locations written before the rebalance are read from their previous shard
+	old := indexedBlock(common.Hash{0x02}, 6)
+	require.NoError(t, WriteBlobIndex(context.Background(), previous[0].Store, old))
+	requireIndexed(t, s, old)
+}
+
+func TestReplicatedBlobIndex(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	primary, replica := NewFileStorage(t.TempDir(), l), NewFileStorage(t.TempDir(), l)
+	s := NewReplicatedStorage("primary", primary, []Replica{{Name: "replica", Store: replica}}, ReplicateAll, nil, l)
+
+	data := indexedBlock(common.Hash{0x01}, 2)
+	require.NoError(t, WriteBlobIndex(context.Background(), NewOrderedStorage(s, 1), data))
+	requireIndexed(t, primary, data)
+	requireIndexed(t, replica, data)
+}
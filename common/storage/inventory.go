@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/minio/minio-go/v7"
+)
+
+// inventoryPrefix is the directory, or key prefix, holding the inventory of a data store, one object per chunk. It is
+// not a block root, so the inventory is not listed as blocks, see isBlockObject.
+const inventoryPrefix = "inventory"
+
+// InventoryChunkSlots is the number of slots covered by each chunk of the inventory. Chunks start at multiples of it.
+const InventoryChunkSlots = 1024
+
+// InventoryEntry is the block archived at a slot.
+type InventoryEntry struct {
+	Root common.Hash `json:"root"`
+	// ParentRoot links the entry to the entry of its parent, so that the slots between them are known to be empty
+	ParentRoot common.Hash `json:"parent_root"`
+}
+
+// InventoryChunk is the manifest of the blocks archived in the InventoryChunkSlots slots from StartSlot.
+type InventoryChunk struct {
+	StartSlot uint64                    `json:"start_slot"`
+	Blocks    map[uint64]InventoryEntry `json:"blocks"`
+}
+
+// InventoryChunkStart returns the start slot of the chunk that slot belongs to.
+func InventoryChunkStart(slot uint64) uint64 {
+	return slot - slot%InventoryChunkSlots
+}
+
+// Inventory is the manifest that data stores keep of the slots and roots of the blocks archived in them, so that the
+// completeness of the archive can be checked without reading every block. The inventory is maintained by the archiver,
+// and is divided into chunks of InventoryChunkSlots slots that are each read and written whole.
+type Inventory interface {
+	// ReadInventoryChunk returns the chunk starting at startSlot. It should return nil, ErrNotFound if no block in the
+	// chunk has been recorded, ErrStorage or ErrMarshaling.
+	ReadInventoryChunk(ctx context.Context, startSlot uint64) (InventoryChunk, error)
+	// WriteInventoryChunk replaces the chunk starting at chunk.StartSlot. It should return nil, ErrStorage or
+	// ErrMarshaling.
+	WriteInventoryChunk(ctx context.Context, chunk InventoryChunk) error
+}
+
+func inventoryName(startSlot uint64) string {
+	return path.Join(inventoryPrefix, strconv.FormatUint(startSlot, 10))
+}
+
+func (s *FileStorage) ReadInventoryChunk(_ context.Context, startSlot uint64) (InventoryChunk, error) {
+	data, err := os.ReadFile(path.Join(s.directory, inventoryName(startSlot)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return InventoryChunk{}, ErrNotFound
+		}
+
+		s.log.Warn("error reading inventory chunk", "startSlot", startSlot, "err", err)
+		return InventoryChunk{}, ErrStorage
+	}
+
+	var result InventoryChunk
+	if err := json.Unmarshal(data, &result); err != nil {
+		s.log.Warn("error decoding inventory chunk", "startSlot", startSlot, "err", err)
+		return InventoryChunk{}, ErrMarshaling
+	}
+	return result, nil
+}
+
+func (s *FileStorage) WriteInventoryChunk(_ context.Context, chunk InventoryChunk) error {
+	b, err := json.Marshal(chunk)
+	if err != nil {
+		s.log.Warn("error encoding inventory chunk", "err", err)
+		return ErrMarshaling
+	}
+
+	// The directory is created on each write, as compaction removes it if it is ever empty
+	if err := os.MkdirAll(path.Join(s.directory, inventoryPrefix), 0755); err != nil {
+		s.log.Warn("error creating inventory directory", "err", err)
+		return ErrStorage
+	}
+	if err := writeFileAtomic(path.Join(s.directory, inventoryName(chunk.StartSlot)), b); err != nil {
+		s.log.Warn("error writing inventory chunk", "startSlot", chunk.StartSlot, "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadInventoryChunk(ctx context.Context, startSlot uint64) (InventoryChunk, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, path.Join(s.path, inventoryName(startSlot)), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching inventory chunk", "startSlot", startSlot, "err", err)
+		return InventoryChunk{}, ErrStorage
+	}
+	defer res.Close()
+	_, err = res.Stat()
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return InventoryChunk{}, ErrNotFound
+		}
+		s.log.Info("unexpected error fetching inventory chunk", "startSlot", startSlot, "err", err)
+		return InventoryChunk{}, ErrStorage
+	}
+
+	var result InventoryChunk
+	if err := json.NewDecoder(res).Decode(&result); err != nil {
+		s.log.Warn("error decoding inventory chunk", "startSlot", startSlot, "err", err)
+		return InventoryChunk{}, ErrMarshaling
+	}
+	return result, nil
+}
+
+func (s *S3Storage) WriteInventoryChunk(ctx context.Context, chunk InventoryChunk) error {
+	d, err := json.Marshal(chunk)
+	if err != nil {
+		s.log.Warn("error encoding inventory chunk", "err", err)
+		return ErrMarshaling
+	}
+
+	options := minio.PutObjectOptions{
+		ContentType: "application/json",
+	}
+	reader := bytes.NewReader(d)
+
+	_, err = s.s3.PutObject(ctx, s.bucket, path.Join(s.path, inventoryName(chunk.StartSlot)), reader, int64(len(d)), options)
+	if err != nil {
+		s.log.Warn("error writing inventory chunk", "startSlot", chunk.StartSlot, "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *GCSStorage) ReadInventoryChunk(ctx context.Context, startSlot uint64) (InventoryChunk, error) {
+	var result InventoryChunk
+	if err := s.readJSON(ctx, inventoryName(startSlot), &result); err != nil {
+		return InventoryChunk{}, err
+	}
+	return result, nil
+}
+
+func (s *GCSStorage) WriteInventoryChunk(ctx context.Context, chunk InventoryChunk) error {
+	return s.writeJSON(ctx, inventoryName(chunk.StartSlot), chunk)
+}
+
+func (s *AzureStorage) ReadInventoryChunk(ctx context.Context, startSlot uint64) (InventoryChunk, error) {
+	var result InventoryChunk
+	if err := s.readJSON(ctx, inventoryName(startSlot), &result); err != nil {
+		return InventoryChunk{}, err
+	}
+	return result, nil
+}
+
+func (s *AzureStorage) WriteInventoryChunk(ctx context.Context, chunk InventoryChunk) error {
+	return s.writeJSON(ctx, inventoryName(chunk.StartSlot), chunk)
+}
+
+// ReadInventoryChunk reads the chunk from the first shard, which holds the state objects of the archive.
+func (s *ShardedStorage) ReadInventoryChunk(ctx context.Context, startSlot uint64) (InventoryChunk, error) {
+	return s.shards[0].Store.ReadInventoryChunk(ctx, startSlot)
+}
+
+// WriteInventoryChunk writes the chunk to the first shard, which holds the state objects of the archive.
+func (s *ShardedStorage) WriteInventoryChunk(ctx context.Context, chunk InventoryChunk) error {
+	return s.shards[0].Store.WriteInventoryChunk(ctx, chunk)
+}
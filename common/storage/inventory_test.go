@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func runTestInventoryChunk(t *testing.T, s Inventory) {
+	_, err := s.ReadInventoryChunk(context.Background(), 2048)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	chunk := InventoryChunk{StartSlot: 2048, Blocks: map[uint64]InventoryEntry{
+		2048: {Root: common.Hash{1}, ParentRoot: common.Hash{9}},
+		2050: {Root: common.Hash{2}, ParentRoot: common.Hash{1}},
+	}}
+	require.NoError(t, s.WriteInventoryChunk(context.Background(), chunk))
+	read, err := s.ReadInventoryChunk(context.Background(), 2048)
+	require.NoError(t, err)
+	require.Equal(t, chunk, read)
+
+	// Other chunks are stored separately
+	_, err = s.ReadInventoryChunk(context.Background(), 1024)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestInventoryChunkStart(t *testing.T) {
+	require.Equal(t, uint64(0), InventoryChunkStart(1023))
+	require.Equal(t, uint64(1024), InventoryChunkStart(1024))
+	require.Equal(t, uint64(2048), InventoryChunkStart(3000))
+}
+
+func TestFileInventory(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestInventoryChunk(t, fs)
+
+	// The inventory is not listed as blocks
+	blocks, err := fs.ListBlocks(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+}
+
+func TestShardedInventory(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	shards := setupShards(t, "a", "b")
+	s, err := NewShardedStorage(shards, nil, l)
+	require.NoError(t, err)
+
+	runTestInventoryChunk(t, s)
+
+	// The inventory is kept with the other state objects in the first shard
+	_, err = shards[0].Store.ReadInventoryChunk(context.Background(), 2048)
+	require.NoError(t, err)
+}
+
+func TestReplicatedInventory(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	primary, replica := NewFileStorage(t.TempDir(), l), NewFileStorage(t.TempDir(), l)
+	s := NewReplicatedStorage("primary", primary, []Replica{{Name: "replica", Store: replica}}, ReplicateAll, nil, l)
+
+	runTestInventoryChunk(t, NewOrderedStorage(s, 1))
+
+	_, err := primary.ReadInventoryChunk(context.Background(), 2048)
+	require.NoError(t, err)
+	_, err = replica.ReadInventoryChunk(context.Background(), 2048)
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultWriteConcurrency is the default number of writes an OrderedStorage applies at once.
+const DefaultWriteConcurrency = 16
+
+// OrderedStorage is a DataStore that applies writes of the same block in the order they were submitted, while writes
+// of different blocks proceed in parallel, up to a bound. Without it, two writes of a block that overlap, such as a
+// re-archive after a reorg and a retry of an earlier write, could reach the inner data store in either order, and the
+// stale one could overwrite the canonical blobs. Reads are passed through.
+type OrderedStorage struct {
+	DataStore
+	writes chan struct{}
+
+	mu sync.Mutex
+	// tails holds, for each block with a write in flight, a channel that is closed when its last submitted write is done
+	tails map[common.Hash]chan struct{}
+}
+
+// NewOrderedStorage creates an OrderedStorage in front of inner, with at most concurrency writes in flight.
+func NewOrderedStorage(inner DataStore, concurrency int) *OrderedStorage {
+	return &OrderedStorage{
+		DataStore: inner,
+		writes:    make(chan struct{}, max(concurrency, 1)),
+		tails:     make(map[common.Hash]chan struct{}),
+	}
+}
+
+func (s *OrderedStorage) WriteBlob(ctx context.Context, data BlobData) error {
+	return s.ordered(ctx, data.Header.BeaconBlockHash, func() error {
+		return s.DataStore.WriteBlob(ctx, data)
+	})
+}
+
+func (s *OrderedStorage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	return s.ordered(ctx, hash, func() error {
+		return s.DataStore.WriteEmptyBlob(ctx, hash)
+	})
+}
+
+// ordered runs write once every write of hash submitted before it is done, and a write slot is free. If ctx ends
+// first, the write is abandoned, without reordering the writes submitted after it.
+func (s *OrderedStorage) ordered(ctx context.Context, hash common.Hash, write func() error) error {
+	s.mu.Lock()
+	previous := s.tails[hash]
+	done := make(chan struct{})
+	s.tails[hash] = done
+	s.mu.Unlock()
+
+	// finish lets the next write of hash go ahead, and forgets hash if no write was submitted after this one
+	finish := func() {
+		close(done)
+		s.mu.Lock()
+		if s.tails[hash] == done {
+			delete(s.tails, hash)
+		}
+		s.mu.Unlock()
+	}
+
+	if previous != nil {
+		select {
+		case <-previous:
+		case <-ctx.Done():
+			// The next write must still wait for the previous one
+			go func() {
+				<-previous
+				finish()
+			}()
+			return ctx.Err()
+		}
+	}
+	defer finish()
+
+	select {
+	case s.writes <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.writes }()
+
+	return write()
+}
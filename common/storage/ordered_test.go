@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedStore is a DataStore that records the order of writes, blocking writes of the gated block until release is
+// closed.
+type gatedStore struct {
+	DataStore
+	gated   common.Hash
+	release chan struct{}
+
+	mu     sync.Mutex
+	writes []uint64
+}
+
+func (s *gatedStore) WriteBlob(ctx context.Context, data BlobData) error {
+	if data.Header.BeaconBlockHash == s.gated {
+		<-s.release
+	}
+
+	s.mu.Lock()
+	s.writes = append(s.writes, uint64(data.BlobSidecars.Data[0].SignedBlockHeader.Message.Slot))
+	s.mu.Unlock()
+	return s.DataStore.WriteBlob(ctx, data)
+}
+
+func (s *gatedStore) order() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.writes...)
+}
+
+func setupOrdered(t *testing.T, gated common.Hash) (*OrderedStorage, *gatedStore) {
+	fs, cleanup := setup(t)
+	t.Cleanup(cleanup)
+	inner := &gatedStore{DataStore: fs, gated: gated, release: make(chan struct{})}
+	return NewOrderedStorage(inner, 4), inner
+}
+
+// submit starts a write of hash, marked with slot, and waits until it has been queued so that writes are submitted in
+// a known order.
+func submit(t *testing.T, ctx context.Context, s *OrderedStorage, hash common.Hash, slot uint64) chan error {
+	s.mu.Lock()
+	previous := s.tails[hash]
+	s.mu.Unlock()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- s.WriteBlob(ctx, BlobData{Header: Header{BeaconBlockHash: hash}, BlobSidecars: sidecarsAtSlot(slot)})
+	}()
+
+	// A write that is not held up may be done before its queueing is seen
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.tails[hash] != previous || len(result) > 0
+	}, 5*time.Second, time.Millisecond)
+	return result
+}
+
+func TestOrdered_LastSubmittedWins(t *testing.T) {
+	hash := common.Hash{0x01}
+	s, inner := setupOrdered(t, hash)
+
+	var results []chan error
+	for slot := uint64(1); slot <= 10; slot++ {
+		results = append(results, submit(t, context.Background(), s, hash, slot))
+	}
+
+	close(inner.release)
+	for _, result := range results {
+		require.NoError(t, <-result)
+	}
+
+	require.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, inner.order())
+	data, err := s.ReadBlob(context.Background(), hash)
+	require.NoError(t, err)
+	require.Equal(t, sidecarsAtSlot(10), data.BlobSidecars)
+	require.Empty(t, s.tails)
+}
+
+func TestOrdered_OtherBlocksProceed(t *testing.T) {
+	gated := common.Hash{0x01}
+	s, inner := setupOrdered(t, gated)
+
+	blocked := submit(t, context.Background(), s, gated, 1)
+
+	// A write of another block is not held up by the gated block
+	other := submit(t, context.Background(), s, common.Hash{0x02}, 2)
+	require.NoError(t, <-other)
+	require.Equal(t, []uint64{2}, inner.order())
+
+	close(inner.release)
+	require.NoError(t, <-blocked)
+}
+
+func TestOrdered_CancelledWriteKeepsOrder(t *testing.T) {
+	hash := common.Hash{0x01}
+	s, inner := setupOrdered(t, hash)
+
+	first := submit(t, context.Background(), s, hash, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := submit(t, ctx, s, hash, 2)
+	cancel()
+	require.ErrorIs(t, <-cancelled, context.Canceled)
+
+	// The write after the cancelled one still waits for the first
+	last := submit(t, context.Background(), s, hash, 3)
+	select {
+	case err := <-last:
+		t.Fatalf("write finished before the earlier write: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(inner.release)
+	require.NoError(t, <-first)
+	require.NoError(t, <-last)
+	require.Equal(t, []uint64{1, 3}, inner.order())
+}
+
+func TestOrdered_RunCompaction(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+	require.NoError(t, os.WriteFile(filepath.Join(fs.directory, "leftover"+tempFileSuffix), nil, 0644))
+
+	// The compaction of the inner data store still runs behind the ordering
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewOrderedStorage(fs, 1).RunCompaction(ctx, time.Millisecond, 0)
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(fs.directory, "leftover"+tempFileSuffix))
+		return os.IsNotExist(err)
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
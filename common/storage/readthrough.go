@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultReadThroughConcurrency is the default number of beacon node fetches a ReadThroughStorage makes at once.
+const DefaultReadThroughConcurrency = 4
+
+// ReadThroughStorage is a DataStore that fetches blobs from a beacon node when they are missing from the inner data
+// store. The fetched blobs are returned to the caller and written to the inner data store in the background, so the
+// archive fills in on demand, e.g. before a backfill has completed. Concurrent reads of the same missing block share
+// a single fetch, and the number of fetches in flight is bounded so that a burst of misses cannot overload the beacon
+// node. Exists only reports the contents of the inner data store.
+//
+// Reads with ConsistencyFresh bypass the inner data store: the blobs are fetched from the beacon node and rewritten to
+// the inner data store, and the stored blobs are only returned if the beacon node no longer has the block.
+type ReadThroughStorage struct {
+	DataStore
+	log          log.Logger
+	beaconClient client.BlobSidecarsProvider
+	group        singleflight.Group
+	fetches      chan struct{}
+	writes       sync.WaitGroup
+}
+
+// NewReadThroughStorage creates a ReadThroughStorage that fetches missing blobs from beaconClient, with at most
+// concurrency fetches in flight.
+func NewReadThroughStorage(inner DataStore, beaconClient client.BlobSidecarsProvider, concurrency int, l log.Logger) *ReadThroughStorage {
+	return &ReadThroughStorage{
+		DataStore:    inner,
+		log:          l,
+		beaconClient: beaconClient,
+		fetches:      make(chan struct{}, max(concurrency, 1)),
+	}
+}
+
+func (s *ReadThroughStorage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
+	fresh := ConsistencyFromContext(ctx) == ConsistencyFresh
+	if !fresh {
+		data, err := s.DataStore.ReadBlob(ctx, hash)
+		if !errors.Is(err, ErrNotFound) {
+			return data, err
+		}
+	}
+
+	data, err := s.readFromBeacon(ctx, hash)
+	if fresh && errors.Is(err, ErrNotFound) {
+		// The beacon node has pruned the blobs, so the stored copy is the only one left
+		return s.DataStore.ReadBlob(ctx, hash)
+	}
+	return data, err
+}
+
+// readFromBeacon fetches the blobs for hash from the beacon node, sharing the fetch with concurrent reads of the same
+// block.
+func (s *ReadThroughStorage) readFromBeacon(ctx context.Context, hash common.Hash) (BlobData, error) {
+	result := s.group.DoChan(hash.String(), func() (interface{}, error) {
+		// The fetch is shared with other readers, so it must not be cancelled if the reader that started it goes away
+		return s.fetch(context.WithoutCancel(ctx), hash)
+	})
+
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return BlobData{}, r.Err
+		}
+		return r.Val.(BlobData), nil
+	case <-ctx.Done():
+		return BlobData{}, ctx.Err()
+	}
+}
+
+// fetch fetches the blobs for hash from the beacon node, and writes them to the inner data store in the background.
+func (s *ReadThroughStorage) fetch(ctx context.Context, hash common.Hash) (BlobData, error) {
+	s.fetches <- struct{}{}
+	defer func() { <-s.fetches }()
+
+	sidecars, err := s.beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: hash.String(),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return BlobData{}, ErrNotFound
+		}
+
+		s.log.Warn("failed to fetch blobs from beacon node", "root", hash.String(), "err", err)
+		return BlobData{}, ErrStorage
+	}
+
+	data := BlobData{
+		Header: Header{
+			BeaconBlockHash: hash,
+		},
+		BlobSidecars: BlobSidecars{Data: FromDenebSidecars(sidecars.Data)},
+	}
+
+	s.writes.Add(1)
+	go func() {
+		defer s.writes.Done()
+		if err := s.DataStore.WriteBlob(ctx, data); err != nil {
+			s.log.Warn("failed to store blobs fetched from beacon node", "root", hash.String(), "err", err)
+			return
+		}
+		s.log.Info("stored blobs fetched from beacon node", "root", hash.String(), "blobs", len(data.BlobSidecars.Data))
+	}()
+
+	return data, nil
+}
+
+// Wait blocks until all background writes have completed.
+func (s *ReadThroughStorage) Wait() {
+	s.writes.Wait()
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSidecarsProvider struct {
+	sidecars map[string][]*deneb.BlobSidecar
+	err      error
+	calls    atomic.Int32
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+	release  chan struct{}
+}
+
+func (s *stubSidecarsProvider) BlobSidecars(_ context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	s.calls.Add(1)
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		seen := s.maxSeen.Load()
+		if n <= seen || s.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+
+	if s.release != nil {
+		<-s.release
+	}
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	sidecars, ok := s.sidecars[opts.Block]
+	if !ok {
+		return nil, &api.Error{StatusCode: 404}
+	}
+	return &api.Response[[]*deneb.BlobSidecar]{Data: sidecars}, nil
+}
+
+func setupReadThrough(t *testing.T, beacon *stubSidecarsProvider, concurrency int) (*ReadThroughStorage, *FileStorage) {
+	fs, cleanup := setup(t)
+	t.Cleanup(cleanup)
+	return NewReadThroughStorage(fs, beacon, concurrency, testlog.Logger(t, log.LvlInfo)), fs
+}
+
+func TestReadThrough_FetchesAndStoresOnMiss(t *testing.T) {
+	id := common.Hash{1, 2, 3}
+	sidecars := append(sidecarsAtSlot(10).Data, sidecarsAtSlot(10).Data...)
+	beacon := &stubSidecarsProvider{sidecars: map[string][]*deneb.BlobSidecar{id.String(): ToDenebSidecars(sidecars)}}
+	s, fs := setupReadThrough(t, beacon, 1)
+
+	exists, err := s.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	data, err := s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, id, data.Header.BeaconBlockHash)
+	require.Len(t, data.BlobSidecars.Data, 2)
+
+	s.Wait()
+	stored, err := fs.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Len(t, stored.BlobSidecars.Data, 2)
+
+	// Once stored, the blobs are read from storage rather than the beacon node
+	_, err = s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), beacon.calls.Load())
+}
+
+func TestReadThrough_NotFound(t *testing.T) {
+	s, _ := setupReadThrough(t, &stubSidecarsProvider{}, 1)
+
+	_, err := s.ReadBlob(context.Background(), common.Hash{1})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReadThrough_BeaconError(t *testing.T) {
+	s, _ := setupReadThrough(t, &stubSidecarsProvider{err: errors.New("connection refused")}, 1)
+
+	_, err := s.ReadBlob(context.Background(), common.Hash{1})
+	require.ErrorIs(t, err, ErrStorage)
+}
+
+func TestReadThrough_SharesConcurrentFetches(t *testing.T) {
+	id := common.Hash{1}
+	beacon := &stubSidecarsProvider{
+		sidecars: map[string][]*deneb.BlobSidecar{id.String(): {}},
+		release:  make(chan struct{}),
+	}
+	s, _ := setupReadThrough(t, beacon, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.ReadBlob(context.Background(), id)
+			require.NoError(t, err)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return beacon.calls.Load() == 1 }, time.Second, time.Millisecond)
+	// Give the other readers time to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(beacon.release)
+	wg.Wait()
+	s.Wait()
+
+	require.Equal(t, int32(1), beacon.calls.Load())
+}
+
+func TestReadThrough_BoundsConcurrency(t *testing.T) {
+	beacon := &stubSidecarsProvider{
+		sidecars: make(map[string][]*deneb.BlobSidecar),
+		release:  make(chan struct{}),
+	}
+	var ids []common.Hash
+	for i := 0; i < 6; i++ {
+		id := common.Hash{byte(i + 1)}
+		beacon.sidecars[id.String()] = []*deneb.BlobSidecar{}
+		ids = append(ids, id)
+	}
+	s, _ := setupReadThrough(t, beacon, 2)
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id common.Hash) {
+			defer wg.Done()
+			_, err := s.ReadBlob(context.Background(), id)
+			require.NoError(t, err)
+		}(id)
+	}
+
+	require.Eventually(t, func() bool { return beacon.calls.Load() == 2 }, time.Second, time.Millisecond)
+	close(beacon.release)
+	wg.Wait()
+	s.Wait()
+
+	require.Equal(t, int32(6), beacon.calls.Load())
+	require.Equal(t, int32(2), beacon.maxSeen.Load())
+}
+
+func TestReadThrough_CancelledReaderDoesNotCancelFetch(t *testing.T) {
+	id := common.Hash{1}
+	beacon := &stubSidecarsProvider{
+		sidecars: map[string][]*deneb.BlobSidecar{id.String(): {}},
+		release:  make(chan struct{}),
+	}
+	s, fs := setupReadThrough(t, beacon, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.ReadBlob(ctx, id)
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool { return beacon.calls.Load() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	// The fetch started by the cancelled reader still completes and is shared with a later reader
+	close(beacon.release)
+	_, err := s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	s.Wait()
+
+	exists, err := fs.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestReadThrough_FreshRefreshesStoredBlobs(t *testing.T) {
+	id := common.Hash{1}
+	beacon := &stubSidecarsProvider{sidecars: map[string][]*deneb.BlobSidecar{id.String(): ToDenebSidecars(sidecarsAtSlot(11).Data)}}
+	s, fs := setupReadThrough(t, beacon, 1)
+
+	// The stored blobs are out of date, e.g. they were stored before a repair
+	require.NoError(t, fs.WriteBlob(context.Background(), BlobData{
+		Header:       Header{BeaconBlockHash: id},
+		BlobSidecars: sidecarsAtSlot(10),
+	}))
+
+	data, err := s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, sidecarsAtSlot(10), data.BlobSidecars)
+	require.Equal(t, int32(0), beacon.calls.Load())
+
+	data, err = s.ReadBlob(WithConsistency(context.Background(), ConsistencyFresh), id)
+	require.NoError(t, err)
+	require.Equal(t, sidecarsAtSlot(11), data.BlobSidecars)
+	require.Equal(t, int32(1), beacon.calls.Load())
+
+	// The fresh blobs replace the stored blobs, so later cached reads see them
+	s.Wait()
+	data, err = s.ReadBlob(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, sidecarsAtSlot(11), data.BlobSidecars)
+	require.Equal(t, int32(1), beacon.calls.Load())
+}
+
+func TestReadThrough_FreshFallsBackToStorageWhenPruned(t *testing.T) {
+	id := common.Hash{1}
+	s, fs := setupReadThrough(t, &stubSidecarsProvider{}, 1)
+	ctx := WithConsistency(context.Background(), ConsistencyFresh)
+
+	_, err := s.ReadBlob(ctx, id)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, fs.WriteBlob(context.Background(), BlobData{
+		Header:       Header{BeaconBlockHash: id},
+		BlobSidecars: sidecarsAtSlot(10),
+	}))
+	data, err := s.ReadBlob(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, sidecarsAtSlot(10), data.BlobSidecars)
+}
+
+func TestReadThrough_FreshBeaconError(t *testing.T) {
+	id := common.Hash{1}
+	s, fs := setupReadThrough(t, &stubSidecarsProvider{err: errors.New("connection refused")}, 1)
+	require.NoError(t, fs.WriteBlob(context.Background(), BlobData{
+		Header:       Header{BeaconBlockHash: id},
+		BlobSidecars: sidecarsAtSlot(10),
+	}))
+
+	// A fresh read fails rather than serving blobs that may be out of date
+	_, err := s.ReadBlob(WithConsistency(context.Background(), ConsistencyFresh), id)
+	require.ErrorIs(t, err, ErrStorage)
+}
@@ -0,0 +1,146 @@
+// Package remote provides a data store backed by the blob API of another archiver, so that archivers can be deployed
+// in a hierarchy where edge instances cache blobs from a central, authoritative one.
+package remote
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// RemoteArchiverStorage is a DataStore that reads blobs from an upstream archiver when they are missing from the local
+// data store. The fetched blobs are returned to the caller and written to the local data store in the background, so
+// the local archive fills in on demand. Concurrent reads of the same missing block share a single fetch. Exists only
+// reports the contents of the local data store.
+//
+// The upstream is asked for the blobs in the configured format, blobformat.Auto by default, which requests SSZ and
+// switches to JSON while SSZ responses from the upstream fail to decode. A 404 from the upstream is returned as
+// storage.ErrNotFound, and any other failure as storage.ErrStorage.
+//
+// Reads with ConsistencyFresh bypass the local data store: the blobs are fetched from the upstream and rewritten to
+// the local data store, and the local blobs are only returned if the upstream does not have the block.
+type RemoteArchiverStorage struct {
+	storage.DataStore
+	log      log.Logger
+	upstream blobclient.BlobSidecarClient
+	format   blobformat.Format
+	group    singleflight.Group
+	writes   sync.WaitGroup
+}
+
+// NewRemoteArchiverStorage creates a RemoteArchiverStorage that fetches blobs missing from local from the archiver
+// behind upstream, requesting them in format.
+func NewRemoteArchiverStorage(local storage.DataStore, upstream blobclient.BlobSidecarClient, format blobformat.Format, l log.Logger) *RemoteArchiverStorage {
+	return &RemoteArchiverStorage{
+		DataStore: local,
+		log:       l,
+		upstream:  upstream,
+		format:    format,
+	}
+}
+
+func (s *RemoteArchiverStorage) ReadBlob(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	fresh := storage.ConsistencyFromContext(ctx) == storage.ConsistencyFresh
+	if !fresh {
+		data, err := s.DataStore.ReadBlob(ctx, hash)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return data, err
+		}
+	}
+
+	data, err := s.readFromUpstream(ctx, hash)
+	if fresh && errors.Is(err, storage.ErrNotFound) {
+		// The upstream does not have the blobs, so the local copy is the only one left
+		return s.DataStore.ReadBlob(ctx, hash)
+	}
+	return data, err
+}
+
+// readFromUpstream fetches the blobs for hash from the upstream archiver, sharing the fetch with concurrent reads of
+// the same block.
+func (s *RemoteArchiverStorage) readFromUpstream(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	result := s.group.DoChan(hash.String(), func() (interface{}, error) {
+		return s.fetch(context.WithoutCancel(ctx), hash)
+	})
+
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return storage.BlobData{}, r.Err
+		}
+		return r.Val.(storage.BlobData), nil
+	case <-ctx.Done():
+		return storage.BlobData{}, ctx.Err()
+	}
+}
+
+// fetch fetches the blobs for hash from the upstream archiver, and writes them to the local data store in the
+// background.
+func (s *RemoteArchiverStorage) fetch(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	status, sidecars, err := s.upstream.FetchSidecars(hash.String(), s.format)
+	if status == http.StatusNotFound {
+		return storage.BlobData{}, storage.ErrNotFound
+	}
+	if err != nil {
+		s.log.Warn("failed to fetch blobs from upstream archiver", "root", hash.String(), "status", status, "err", err)
+		return storage.BlobData{}, storage.ErrStorage
+	}
+
+	if err := checkBlockRoot(sidecars.Data, hash); err != nil {
+		s.log.Warn("upstream archiver returned blobs for the wrong block", "root", hash.String(), "err", err)
+		return storage.BlobData{}, storage.ErrStorage
+	}
+
+	data := storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: hash,
+		},
+		BlobSidecars: sidecars,
+	}
+
+	s.writes.Add(1)
+	go func() {
+		defer s.writes.Done()
+		if err := s.DataStore.WriteBlob(ctx, data); err != nil {
+			s.log.Warn("failed to store blobs fetched from upstream archiver", "root", hash.String(), "err", err)
+			return
+		}
+		s.log.Info("stored blobs fetched from upstream archiver", "root", hash.String(), "blobs", len(data.BlobSidecars.Data))
+	}()
+
+	return data, nil
+}
+
+// errWrongBlock is returned by checkBlockRoot when a sidecar does not belong to the requested block.
+var errWrongBlock = errors.New("sidecar block root does not match")
+
+// checkBlockRoot returns an error if any sidecar is not for the block with the given root, so that a misbehaving
+// upstream cannot store blobs under the wrong block.
+func checkBlockRoot(sidecars []*storage.BlobSidecar, root common.Hash) error {
+	for _, sidecar := range sidecars {
+		if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+			return errWrongBlock
+		}
+		sidecarRoot, err := sidecar.SignedBlockHeader.Message.HashTreeRoot()
+		if err != nil {
+			return err
+		}
+		if common.Hash(sidecarRoot) != root {
+			return errWrongBlock
+		}
+	}
+	return nil
+}
+
+// Wait blocks until all background writes have completed.
+func (s *RemoteArchiverStorage) Wait() {
+	s.writes.Wait()
+}
@@ -0,0 +1,124 @@
+package remote
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type stubUpstream struct {
+	sidecars map[string][]*storage.BlobSidecar
+	status   int
+	calls    atomic.Int32
+	formats  []blobformat.Format
+}
+
+func (s *stubUpstream) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	s.calls.Add(1)
+	s.formats = append(s.formats, format)
+
+	if s.status != 0 {
+		return s.status, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: s.status}
+	}
+
+	sidecars, ok := s.sidecars[id]
+	if !ok {
+		return http.StatusNotFound, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: http.StatusNotFound}
+	}
+	return http.StatusOK, storage.BlobSidecars{Data: sidecars}, nil
+}
+
+// newBlock returns blob sidecars and the root of the block they belong to.
+func newBlock(t *testing.T, count uint) (common.Hash, []*storage.BlobSidecar) {
+	sidecars := storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, count))
+	root, err := sidecars[0].SignedBlockHeader.Message.HashTreeRoot()
+	require.NoError(t, err)
+	return root, sidecars
+}
+
+func setup(t *testing.T, upstream *stubUpstream) (*RemoteArchiverStorage, *storage.FileStorage) {
+	l := testlog.Logger(t, log.LvlInfo)
+	local := storage.NewFileStorage(t.TempDir(), l)
+	return NewRemoteArchiverStorage(local, upstream, blobformat.Auto, l), local
+}
+
+func TestRemoteArchiver_FetchesAndStoresOnMiss(t *testing.T) {
+	root, sidecars := newBlock(t, 2)
+	upstream := &stubUpstream{sidecars: map[string][]*storage.BlobSidecar{root.String(): sidecars}}
+	s, local := setup(t, upstream)
+
+	data, err := s.ReadBlob(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, root, data.Header.BeaconBlockHash)
+	require.Equal(t, sidecars, data.BlobSidecars.Data)
+	require.Equal(t, []blobformat.Format{blobformat.Auto}, upstream.formats)
+
+	s.Wait()
+	exists, err := local.Exists(context.Background(), root)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// The second read is served locally
+	_, err = s.ReadBlob(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), upstream.calls.Load())
+}
+
+func TestRemoteArchiver_ErrorMapping(t *testing.T) {
+	root, _ := newBlock(t, 1)
+
+	s, _ := setup(t, &stubUpstream{})
+	_, err := s.ReadBlob(context.Background(), root)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	s, _ = setup(t, &stubUpstream{status: http.StatusInternalServerError})
+	_, err = s.ReadBlob(context.Background(), root)
+	require.ErrorIs(t, err, storage.ErrStorage)
+}
+
+func TestRemoteArchiver_RejectsWrongBlock(t *testing.T) {
+	_, sidecars := newBlock(t, 1)
+	other := common.Hash{0x01}
+	upstream := &stubUpstream{sidecars: map[string][]*storage.BlobSidecar{other.String(): sidecars}}
+	s, local := setup(t, upstream)
+
+	_, err := s.ReadBlob(context.Background(), other)
+	require.ErrorIs(t, err, storage.ErrStorage)
+
+	s.Wait()
+	exists, err := local.Exists(context.Background(), other)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestRemoteArchiver_Fresh(t *testing.T) {
+	root, sidecars := newBlock(t, 1)
+	upstream := &stubUpstream{sidecars: map[string][]*storage.BlobSidecar{root.String(): sidecars}}
+	s, local := setup(t, upstream)
+
+	stale := storage.BlobData{Header: storage.Header{BeaconBlockHash: root}, BlobSidecars: storage.BlobSidecars{Data: sidecars[:0]}}
+	require.NoError(t, local.WriteBlob(context.Background(), stale))
+
+	fresh := storage.WithConsistency(context.Background(), storage.ConsistencyFresh)
+	data, err := s.ReadBlob(fresh, root)
+	require.NoError(t, err)
+	require.Equal(t, sidecars, data.BlobSidecars.Data)
+	s.Wait()
+
+	// Once the upstream no longer has the block, the local copy is served
+	upstream.sidecars = nil
+	data, err = s.ReadBlob(fresh, root)
+	require.NoError(t, err)
+	require.Len(t, data.BlobSidecars.Data, 1)
+	require.Equal(t, int32(2), upstream.calls.Load())
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ReplicationPolicy is when a write to a ReplicatedStorage is considered successful.
+type ReplicationPolicy int
+
+const (
+	// ReplicateAll succeeds once the write succeeded on every backend, so that a failed write is retried until every
+	// backend holds the block. This is the default.
+	ReplicateAll ReplicationPolicy = iota
+	// ReplicateAny succeeds once the write succeeded on at least one backend, so that an outage of one backend does not
+	// stall archiving, at the cost of the blocks written during it missing from that backend.
+	ReplicateAny
+)
+
+// ParseReplicationPolicy parses a user supplied replication policy, either "all" or "any", case insensitively.
+func ParseReplicationPolicy(s string) (ReplicationPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "all":
+		return ReplicateAll, nil
+	case "any":
+		return ReplicateAny, nil
+	default:
+		return ReplicateAll, fmt.Errorf("unknown replication policy %q, valid options are all and any", s)
+	}
+}
+
+func (p ReplicationPolicy) String() string {
+	switch p {
+	case ReplicateAll:
+		return "all"
+	case ReplicateAny:
+		return "any"
+	default:
+		return fmt.Sprintf("ReplicationPolicy(%d)", int(p))
+	}
+}
+
+// ReplicationRecorder records the outcome of the write of a block to each backend of a ReplicatedStorage.
+type ReplicationRecorder interface {
+	RecordReplicaWrite(replica string, success bool)
+}
+
+// Replica is a named backend of a ReplicatedStorage, the name being used in logs and metrics.
+type Replica struct {
+	Name  string
+	Store DataStore
+}
+
+// ReplicatedStorage is a DataStore that writes every block to a primary data store and each of its replicas at once,
+// e.g. to mirror an S3 bucket onto the local filesystem or a bucket in another region. Deletes, by which blocks expire
+// and are pruned, and writes to the blob index go to every backend the same way. Whether a write or delete succeeds depends
+// on the ReplicationPolicy. Reads, as well as the backfill processes, WAL and lockfile, only use the primary, so the
+// replicas are copies of the archive rather than archives of their own.
+type ReplicatedStorage struct {
+	DataStore
+	replicas []Replica
+	policy   ReplicationPolicy
+	recorder ReplicationRecorder
+	log      log.Logger
+}
+
+// NewReplicatedStorage creates a ReplicatedStorage that writes to primary, named primaryName, and replicas. recorder
+// may be nil.
+func NewReplicatedStorage(primaryName string, primary DataStore, replicas []Replica, policy ReplicationPolicy, recorder ReplicationRecorder, l log.Logger) *ReplicatedStorage {
+	return &ReplicatedStorage{
+		DataStore: primary,
+		replicas:  append([]Replica{{Name: primaryName, Store: primary}}, replicas...),
+		policy:    policy,
+		recorder:  recorder,
+		log:       l,
+	}
+}
+
+func (s *ReplicatedStorage) WriteBlob(ctx context.Context, data BlobData) error {
+	return s.replicate(ctx, data.Header.BeaconBlockHash, func(store DataStore) error {
+		return store.WriteBlob(ctx, data)
+	})
+}
+
+func (s *ReplicatedStorage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	return s.replicate(ctx, hash, func(store DataStore) error {
+		return store.WriteEmptyBlob(ctx, hash)
+	})
+}
+
+// replicate runs write, a write or delete of the block with the given hash, against every backend at once, and returns
+// the error of the first backend, in order, whose write failed if the write is not successful under the policy.
+func (s *ReplicatedStorage) replicate(ctx context.Context, hash common.Hash, write func(store DataStore) error) error {
+	errs := make([]error, len(s.replicas))
+	var wg sync.WaitGroup
+	for i, replica := range s.replicas {
+		wg.Add(1)
+		go func(i int, replica Replica) {
+			defer wg.Done()
+			errs[i] = write(replica.Store)
+		}(i, replica)
+	}
+	wg.Wait()
+
+	var first error
+	succeeded := 0
+	for i, err := range errs {
+		if s.recorder != nil {
+			s.recorder.RecordReplicaWrite(s.replicas[i].Name, err == nil)
+		}
+		if err == nil {
+			succeeded++
+			continue
+		}
+
+		s.log.Warn("failed to write block to replica", "replica", s.replicas[i].Name, "root", hash.String(), "err", err)
+		if first == nil {
+			first = err
+		}
+	}
+
+	if first == nil || (s.policy == ReplicateAny && succeeded > 0) {
+		return nil
+	}
+	return first
+}
+
+// RunCompaction runs the compaction of every backend, see FileStorage.RunCompaction, until the context is done.
+func (s *ReplicatedStorage) RunCompaction(ctx context.Context, interval time.Duration, tempFileAge time.Duration) {
+	var wg sync.WaitGroup
+	for _, replica := range s.replicas {
+		store := replica.Store
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.RunCompaction(ctx, interval, tempFileAge)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore is a DataStore whose writes fail while err is set.
+type failingStore struct {
+	DataStore
+	err error
+}
+
+func (s *failingStore) WriteBlob(ctx context.Context, data BlobData) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.DataStore.WriteBlob(ctx, data)
+}
+
+func (s *failingStore) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.DataStore.WriteEmptyBlob(ctx, hash)
+}
+
+func (s *failingStore) DeleteBlob(ctx context.Context, hash common.Hash) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.DataStore.DeleteBlob(ctx, hash)
+}
+
+type replicaWrite struct {
+	replica string
+	success bool
+}
+
+type stubReplicationRecorder struct {
+	mu     sync.Mutex
+	writes []replicaWrite
+}
+
+func (r *stubReplicationRecorder) RecordReplicaWrite(replica string, success bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, replicaWrite{replica, success})
+}
+
+func setupReplicated(t *testing.T, policy ReplicationPolicy) (*ReplicatedStorage, *failingStore, *failingStore, *stubReplicationRecorder) {
+	l := testlog.Logger(t, log.LvlInfo)
+	primary := &failingStore{DataStore: NewFileStorage(t.TempDir(), l)}
+	replica := &failingStore{DataStore: NewFileStorage(t.TempDir(), l)}
+	recorder := &stubReplicationRecorder{}
+	return NewReplicatedStorage("primary", primary, []Replica{{Name: "replica", Store: replica}}, policy, recorder, l), primary, replica, recorder
+}
+
+func TestReplicatedExists(t *testing.T) {
+	s, _, _, _ := setupReplicated(t, ReplicateAll)
+	runTestExists(t, s)
+}
+
+func TestReplicatedRead(t *testing.T) {
+	s, _, _, _ := setupReplicated(t, ReplicateAll)
+	runTestRead(t, s)
+}
+
+func TestReplicated_WritesEveryBackend(t *testing.T) {
+	s, primary, replica, recorder := setupReplicated(t, ReplicateAll)
+
+	full, empty := common.Hash{1}, common.Hash{2}
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: full}}))
+	require.NoError(t, s.WriteEmptyBlob(context.Background(), empty))
+
+	for _, store := range []DataStore{primary, replica} {
+		for _, hash := range []common.Hash{full, empty} {
+			exists, err := store.Exists(context.Background(), hash)
+			require.NoError(t, err)
+			require.True(t, exists)
+		}
+	}
+	require.ElementsMatch(t, []replicaWrite{{"primary", true}, {"replica", true}, {"primary", true}, {"replica", true}}, recorder.writes)
+}
+
+func TestReplicated_Policy(t *testing.T) {
+	failed := errors.New("replica unavailable")
+
+	// Under all, a failure of any backend fails the write, so that it is retried
+	s, _, replica, recorder := setupReplicated(t, ReplicateAll)
+	replica.err = failed
+	require.ErrorIs(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: common.Hash{1}}}), failed)
+	require.ElementsMatch(t, []replicaWrite{{"primary", true}, {"replica", false}}, recorder.writes)
+
+	// Under any, a single success is enough
+	s, primary, replica, recorder := setupReplicated(t, ReplicateAny)
+	primary.err = failed
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: common.Hash{1}}}))
+	exists, err := replica.Exists(context.Background(), common.Hash{1})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.ElementsMatch(t, []replicaWrite{{"primary", false}, {"replica", true}}, recorder.writes)
+
+	// But not no success, the error of the first backend being returned
+	replica.err = errors.New("other error")
+	require.ErrorIs(t, s.WriteEmptyBlob(context.Background(), common.Hash{2}), failed)
+}
+
+func TestReplicated_DeletesEveryBackend(t *testing.T) {
+	s, primary, replica, recorder := setupReplicated(t, ReplicateAll)
+
+	// A block, an expiring block and a tombstone, as deleted by the reaper
+	full, expiring, empty := common.Hash{1}, common.Hash{2}, common.Hash{3}
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: full}}))
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: expiring, ExpiresAt: 1}}))
+	require.NoError(t, s.WriteEmptyBlob(context.Background(), empty))
+
+	blocks, err := s.ListBlocks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+
+	recorder.writes = nil
+	for _, hash := range []common.Hash{full, expiring, empty} {
+		require.NoError(t, s.DeleteBlob(context.Background(), hash))
+	}
+	for _, store := range []DataStore{primary, replica} {
+		for _, hash := range []common.Hash{full, expiring, empty} {
+			exists, err := store.Exists(context.Background(), hash)
+			require.NoError(t, err)
+			require.False(t, exists)
+		}
+	}
+	require.Len(t, recorder.writes, 6)
+}
+
+func TestReplicated_DeletePolicy(t *testing.T) {
+	failed := errors.New("replica unavailable")
+	hash := common.Hash{1}
+
+	// Under all, a delete that fails on a replica fails, so that it is retried
+	s, _, replica, _ := setupReplicated(t, ReplicateAll)
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: hash}}))
+	replica.err = failed
+	require.ErrorIs(t, s.DeleteBlob(context.Background(), hash), failed)
+	replica.err = nil
+	require.NoError(t, s.DeleteBlob(context.Background(), hash))
+	exists, err := replica.Exists(context.Background(), hash)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Under any, a single success is enough
+	s, primary, replica, recorder := setupReplicated(t, ReplicateAny)
+	require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: hash}}))
+	recorder.writes = nil
+	replica.err = failed
+	require.NoError(t, s.DeleteBlob(context.Background(), hash))
+	exists, err = primary.Exists(context.Background(), hash)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.ElementsMatch(t, []replicaWrite{{"primary", true}, {"replica", false}}, recorder.writes)
+}
+
+func TestParseReplicationPolicy(t *testing.T) {
+	for input, expected := range map[string]ReplicationPolicy{"all": ReplicateAll, "ANY": ReplicateAny, " any ": ReplicateAny} {
+		policy, err := ParseReplicationPolicy(input)
+		require.NoError(t, err)
+		require.Equal(t, expected, policy)
+	}
+
+	_, err := ParseReplicationPolicy("quorum")
+	require.ErrorContains(t, err, "unknown replication policy \"quorum\"")
+	require.Equal(t, "any", ReplicateAny.String())
+}
@@ -2,7 +2,6 @@ package storage
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"io"
@@ -17,13 +16,19 @@ import (
 )
 
 type S3Storage struct {
-	s3       *minio.Client
-	bucket   string
-	path     string
-	log      log.Logger
-	compress bool
+	s3          *minio.Client
+	bucket      string
+	path        string
+	log         log.Logger
+	compression flags.Compression
+
+	tags    map[string]string
+	tagSlot bool
 }
 
+// SlotTag is the object tag holding the slot of a blob, when enabled
+const SlotTag = "slot"
+
 func NewS3Storage(cfg flags.S3Config, l log.Logger) (*S3Storage, error) {
 	var c *credentials.Credentials
 	if cfg.S3CredentialType == flags.S3CredentialStatic {
@@ -41,12 +46,19 @@ func NewS3Storage(cfg flags.S3Config, l log.Logger) (*S3Storage, error) {
 		return nil, err
 	}
 
+	tags, err := flags.ParseObjectTags(cfg.ObjectTags)
+	if err != nil {
+		return nil, err
+	}
+
 	storage := &S3Storage{
-		s3:       client,
-		bucket:   cfg.Bucket,
-		path:     cfg.Path,
-		log:      l,
-		compress: cfg.Compress,
+		s3:          client,
+		bucket:      cfg.Bucket,
+		path:        cfg.Path,
+		log:         l,
+		compression: blobCompression(cfg.Compression, cfg.Compress),
+		tags:        tags,
+		tagSlot:     cfg.TagSlot,
 	}
 
 	_, err = storage.ReadBackfillProcesses(context.Background())
@@ -58,6 +70,15 @@ func NewS3Storage(cfg flags.S3Config, l log.Logger) (*S3Storage, error) {
 		}
 	}
 
+	_, err = storage.ReadBackfillWAL(context.Background())
+	if err == ErrNotFound {
+		storage.log.Info("creating empty backfill_wal object")
+		err = storage.WriteBackfillWAL(context.Background(), BackfillWAL{})
+		if err != nil {
+			log.Crit("failed to create backfill_wal key")
+		}
+	}
+
 	_, err = storage.ReadLockfile(context.Background())
 	if err == ErrNotFound {
 		storage.log.Info("creating empty lockfile object")
@@ -87,7 +108,7 @@ func (s *S3Storage) Exists(ctx context.Context, hash common.Hash) (bool, error)
 func (s *S3Storage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
 	res, err := s.s3.GetObject(ctx, s.bucket, path.Join(s.path, hash.String()), minio.GetObjectOptions{})
 	if err != nil {
-		s.log.Info("unexpected error fetching blob", "hash", hash.String(), "err", err)
+		s.log.Info("unexpected error fetching blob", "root", hash.String(), "err", err)
 		return BlobData{}, ErrStorage
 	}
 	defer res.Close()
@@ -95,29 +116,29 @@ func (s *S3Storage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, e
 	if err != nil {
 		errResponse := minio.ToErrorResponse(err)
 		if errResponse.Code == "NoSuchKey" {
-			s.log.Info("unable to find blob", "hash", hash.String())
+			s.log.Info("unable to find blob", "root", hash.String())
 			return BlobData{}, ErrNotFound
 		} else {
-			s.log.Info("unexpected error fetching blob", "hash", hash.String(), "err", err)
+			s.log.Info("unexpected error fetching blob", "root", hash.String(), "err", err)
 			return BlobData{}, ErrStorage
 		}
 	}
 
-	var reader io.ReadCloser = res
-	defer reader.Close()
+	if stat.Size == 0 {
+		return emptyBlobData(hash), nil
+	}
 
-	if stat.Metadata.Get("Content-Encoding") == "gzip" {
-		reader, err = gzip.NewReader(reader)
-		if err != nil {
-			s.log.Warn("error creating gzip reader", "hash", hash.String(), "err", err)
-			return BlobData{}, ErrMarshaling
-		}
+	reader, err := decompressBlob(res, stat.Metadata.Get("Content-Encoding"))
+	if err != nil {
+		s.log.Warn("error creating decompressor", "root", hash.String(), "err", err)
+		return BlobData{}, ErrMarshaling
 	}
+	defer reader.Close()
 
 	var data BlobData
 	err = json.NewDecoder(reader).Decode(&data)
 	if err != nil {
-		s.log.Warn("error decoding blob", "hash", hash.String(), "err", err)
+		s.log.Warn("error decoding blob", "root", hash.String(), "err", err)
 		return BlobData{}, ErrMarshaling
 	}
 
@@ -159,6 +180,62 @@ func (s *S3Storage) ReadBackfillProcesses(ctx context.Context) (BackfillProcesse
 	return data, nil
 }
 
+func (s *S3Storage) ReadBackfillWAL(ctx context.Context) (BackfillWAL, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, path.Join(s.path, "backfill_wal"), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching backfill_wal", "err", err)
+		return BackfillWAL{}, ErrStorage
+	}
+	defer res.Close()
+	_, err = res.Stat()
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			s.log.Info("unable to find backfill_wal key")
+			return BackfillWAL{}, ErrNotFound
+		} else {
+			s.log.Info("unexpected error fetching backfill_wal", "err", err)
+			return BackfillWAL{}, ErrStorage
+		}
+	}
+
+	var data BackfillWAL
+	err = json.NewDecoder(res).Decode(&data)
+	if err != nil {
+		s.log.Warn("error decoding backfill_wal", "err", err)
+		return BackfillWAL{}, ErrMarshaling
+	}
+
+	return data, nil
+}
+
+func (s *S3Storage) ReadBackfillCheckpoint(ctx context.Context) (BackfillCheckpoint, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, path.Join(s.path, "backfill_checkpoint"), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching backfill_checkpoint", "err", err)
+		return BackfillCheckpoint{}, ErrStorage
+	}
+	defer res.Close()
+	_, err = res.Stat()
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return BackfillCheckpoint{}, ErrNotFound
+		}
+		s.log.Info("unexpected error fetching backfill_checkpoint", "err", err)
+		return BackfillCheckpoint{}, ErrStorage
+	}
+
+	var data BackfillCheckpoint
+	err = json.NewDecoder(res).Decode(&data)
+	if err != nil {
+		s.log.Warn("error decoding backfill_checkpoint", "err", err)
+		return BackfillCheckpoint{}, ErrMarshaling
+	}
+
+	return data, nil
+}
+
 func (s *S3Storage) ReadLockfile(ctx context.Context) (Lockfile, error) {
 	res, err := s.s3.GetObject(ctx, s.bucket, path.Join(s.path, "lockfile"), minio.GetObjectOptions{})
 	if err != nil {
@@ -216,6 +293,50 @@ func (s *S3Storage) WriteBackfillProcesses(ctx context.Context, data BackfillPro
 	return nil
 }
 
+func (s *S3Storage) WriteBackfillWAL(ctx context.Context, data BackfillWAL) error {
+	d, err := json.Marshal(data)
+	if err != nil {
+		s.log.Warn("error encoding backfill_wal", "err", err)
+		return ErrMarshaling
+	}
+
+	options := minio.PutObjectOptions{
+		ContentType: "application/json",
+	}
+	reader := bytes.NewReader(d)
+
+	_, err = s.s3.PutObject(ctx, s.bucket, path.Join(s.path, "backfill_wal"), reader, int64(len(d)), options)
+	if err != nil {
+		s.log.Warn("error writing to backfill_wal", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Debug("wrote to backfill_wal", "entries", len(data.Entries))
+	return nil
+}
+
+func (s *S3Storage) WriteBackfillCheckpoint(ctx context.Context, data BackfillCheckpoint) error {
+	d, err := json.Marshal(data)
+	if err != nil {
+		s.log.Warn("error encoding backfill_checkpoint", "err", err)
+		return ErrMarshaling
+	}
+
+	options := minio.PutObjectOptions{
+		ContentType: "application/json",
+	}
+	reader := bytes.NewReader(d)
+
+	_, err = s.s3.PutObject(ctx, s.bucket, path.Join(s.path, "backfill_checkpoint"), reader, int64(len(d)), options)
+	if err != nil {
+		s.log.Warn("error writing to backfill_checkpoint", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Debug("wrote to backfill_checkpoint", "nextSlot", data.NextSlot)
+	return nil
+}
+
 func (s *S3Storage) WriteLockfile(ctx context.Context, data Lockfile) error {
 	d, err := json.Marshal(data)
 	if err != nil {
@@ -249,15 +370,15 @@ func (s *S3Storage) WriteBlob(ctx context.Context, data BlobData) error {
 		ContentType: "application/json",
 	}
 
-	if s.compress {
-		b, err = compress(b)
-		if err != nil {
-			s.log.Warn("error compressing blob", "err", err)
-			return ErrCompress
-		}
-		options.ContentEncoding = "gzip"
+	b, options.ContentEncoding, err = compressBlob(s.compression, b)
+	if err != nil {
+		s.log.Warn("error compressing blob", "err", err)
+		return ErrCompress
 	}
 
+	options.UserTags = s.objectTags(data)
+	options.UserMetadata = objectMetadata(data)
+
 	reader := bytes.NewReader(b)
 
 	_, err = s.s3.PutObject(ctx, s.bucket, path.Join(s.path, data.Header.BeaconBlockHash.String()), reader, int64(len(b)), options)
@@ -267,20 +388,38 @@ func (s *S3Storage) WriteBlob(ctx context.Context, data BlobData) error {
 		return ErrStorage
 	}
 
-	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	s.log.Info("wrote blob", "root", data.Header.BeaconBlockHash.String())
 	return nil
 }
 
-func compress(in []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	gz := gzip.NewWriter(&buf)
-	_, err := gz.Write(in)
+func (s *S3Storage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	_, err := s.s3.PutObject(ctx, s.bucket, path.Join(s.path, hash.String()), bytes.NewReader(nil), 0, minio.PutObjectOptions{
+		ContentType: "application/json",
+		UserTags:    s.objectTags(BlobData{}),
+	})
+
 	if err != nil {
-		return nil, err
+		s.log.Warn("error writing empty blob", "err", err)
+		return ErrStorage
 	}
-	err = gz.Close()
-	if err != nil {
-		return nil, err
+
+	s.log.Info("wrote empty blob", "root", hash.String())
+	return nil
+}
+
+// objectTags returns the tags to write a blob with, so that bucket lifecycle rules can transition or expire blobs
+// based on them. The slot can only be determined for blocks with a stored header or sidecars, blob or data column. Tags
+// are fixed once the object is written, so rules that move blobs between storage classes as they age should filter on
+// the age of the object instead.
+func (s *S3Storage) objectTags(data BlobData) map[string]string {
+	result := make(map[string]string, len(s.tags)+1)
+	for k, v := range s.tags {
+		result[k] = v
 	}
-	return buf.Bytes(), nil
+
+	if slot := data.slot(); s.tagSlot && slot != 0 {
+		result[SlotTag] = strconv.FormatUint(slot, 10)
+	}
+
+	return result
 }
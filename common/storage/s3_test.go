@@ -3,10 +3,13 @@ package storage
 import (
 	"context"
 	"os"
+	"path"
 	"testing"
 
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/minio/minio-go/v7"
 	"github.com/stretchr/testify/require"
@@ -54,3 +57,70 @@ func TestS3Read(t *testing.T) {
 
 	runTestRead(t, s3)
 }
+
+func TestS3ReadEmpty(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestReadEmpty(t, s3)
+}
+
+func TestS3ReadBlockHeader(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestReadBlockHeader(t, s3)
+}
+
+func TestS3ReadMixedCompression(t *testing.T) {
+	s := setupS3(t)
+
+	runTestReadMixedCompression(t, s, func(compression flags.Compression) { s.compression = compression })
+}
+
+func sidecarsAtSlot(slot uint64) BlobSidecars {
+	return BlobSidecars{
+		Data: []*BlobSidecar{{
+			SignedBlockHeader: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot)},
+			},
+		}},
+	}
+}
+
+func TestS3ObjectTags(t *testing.T) {
+	s := &S3Storage{
+		tags:    map[string]string{"team": "infra"},
+		tagSlot: true,
+	}
+
+	require.Equal(t, map[string]string{"team": "infra", SlotTag: "1000"}, s.objectTags(BlobData{BlobSidecars: sidecarsAtSlot(1000)}))
+	require.Equal(t, map[string]string{"team": "infra", SlotTag: "899"}, s.objectTags(BlobData{BlobSidecars: sidecarsAtSlot(899)}))
+
+	// The slot of a block from fulu on is read from its data column sidecars
+	columns := &DataColumnSidecars{Data: []*DataColumnSidecar{newDataColumnSidecar(t, 0, 1)}}
+	require.Equal(t, map[string]string{"team": "infra", SlotTag: "12"}, s.objectTags(BlobData{DataColumnSidecars: columns}))
+
+	// Without sidecars there is no slot, only the configured tags are added
+	require.Equal(t, map[string]string{"team": "infra"}, s.objectTags(BlobData{}))
+}
+
+func TestS3ObjectTagsDisabled(t *testing.T) {
+	s := &S3Storage{}
+	require.Empty(t, s.objectTags(BlobData{BlobSidecars: sidecarsAtSlot(1000)}))
+}
+
+func TestS3WriteTags(t *testing.T) {
+	s3 := setupS3(t)
+	s3.tags = map[string]string{"team": "infra"}
+	s3.tagSlot = true
+
+	id := common.Hash{1, 2, 3}
+	err := s3.WriteBlob(context.Background(), BlobData{
+		Header:       Header{BeaconBlockHash: id},
+		BlobSidecars: sidecarsAtSlot(20),
+	})
+	require.NoError(t, err)
+
+	tags, err := s3.s3.GetObjectTagging(context.Background(), s3.bucket, path.Join(s3.path, id.String()), minio.GetObjectTaggingOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "infra", SlotTag: "20"}, tags.ToMap())
+}
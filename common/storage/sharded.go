@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// virtualNodes is the number of points each shard has on the hash ring. More points spread the keys more evenly
+// between the shards.
+const virtualNodes = 128
+
+// Shard is a single backend of a ShardedStorage. The name identifies the shard on the hash ring, so it must be stable
+// across restarts, e.g. the bucket or directory of the backend.
+type Shard struct {
+	Name  string
+	Store DataStore
+}
+
+// ShardOwnership is the fraction of the key space that a shard owns.
+type ShardOwnership struct {
+	Name     string  `json:"name"`
+	Fraction float64 `json:"fraction"`
+}
+
+type ringPoint struct {
+	position uint64
+	shard    int
+}
+
+// ring is a consistent hash ring, each key is owned by the first point at or after its position.
+type ring []ringPoint
+
+func newRing(shards []Shard) ring {
+	var result ring
+	for i, shard := range shards {
+		for v := 0; v < virtualNodes; v++ {
+			h := sha256.Sum256([]byte(shard.Name + "#" + strconv.Itoa(v)))
+			result = append(result, ringPoint{position: binary.BigEndian.Uint64(h[:8]), shard: i})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].position < result[j].position
+	})
+
+	return result
+}
+
+func (r ring) lookup(hash common.Hash) int {
+	// Block roots are already uniformly distributed, so they are placed on the ring without hashing them again
+	position := binary.BigEndian.Uint64(hash[:8])
+	i := sort.Search(len(r), func(i int) bool {
+		return r[i].position >= position
+	})
+	if i == len(r) {
+		i = 0
+	}
+	return r[i].shard
+}
+
+func (r ring) ownership(shards []Shard) []ShardOwnership {
+	result := make([]ShardOwnership, len(shards))
+	for i, shard := range shards {
+		result[i].Name = shard.Name
+	}
+
+	for i, point := range r {
+		// Each point owns the arc from the previous point, the first point also owns the wrap-around arc
+		var arc uint64
+		if i == 0 {
+			arc = point.position + (math.MaxUint64 - r[len(r)-1].position) + 1
+		} else {
+			arc = point.position - r[i-1].position
+		}
+		result[point.shard].Fraction += float64(arc) / math.MaxUint64
+	}
+
+	return result
+}
+
+// ShardedStorage is a DataStore that spreads blobs across several backends by consistent-hashing their block root, so
+// reads and writes are routed deterministically and adding a backend only moves the blobs it takes ownership of.
+// The backfill processes, WAL and lockfile are not blob data, so they are always kept in the first shard.
+//
+// While the archive is being rebalanced onto a new set of shards, the previous set can be given. Blobs are always
+// written to their new placement, but reads that miss fall through to the previous placement, so blobs that have not
+// been moved yet can still be served.
+type ShardedStorage struct {
+	log      log.Logger
+	shards   []Shard
+	ring     ring
+	previous []Shard
+	prevRing ring
+}
+
+// NewShardedStorage creates a ShardedStorage over shards. previous is the set of shards before a rebalance, and should
+// be empty once the rebalance is complete.
+func NewShardedStorage(shards []Shard, previous []Shard, l log.Logger) (*ShardedStorage, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("at least one shard must be configured")
+	}
+
+	for _, set := range [][]Shard{shards, previous} {
+		names := make(map[string]bool)
+		for _, shard := range set {
+			if names[shard.Name] {
+				return nil, fmt.Errorf("duplicate shard %s", shard.Name)
+			}
+			names[shard.Name] = true
+		}
+	}
+
+	result := &ShardedStorage{
+		log:    l,
+		shards: shards,
+		ring:   newRing(shards),
+	}
+
+	if len(previous) > 0 {
+		result.previous = previous
+		result.prevRing = newRing(previous)
+	}
+
+	return result, nil
+}
+
+// ShardFor returns the name of the shard that the blob for hash is written to.
+func (s *ShardedStorage) ShardFor(hash common.Hash) string {
+	return s.shards[s.ring.lookup(hash)].Name
+}
+
+// ShardMap returns the fraction of the key space owned by each shard, in the order the shards were configured.
+func (s *ShardedStorage) ShardMap() []ShardOwnership {
+	return s.ring.ownership(s.shards)
+}
+
+func (s *ShardedStorage) shard(hash common.Hash) Shard {
+	return s.shards[s.ring.lookup(hash)]
+}
+
+// previousShard returns the shard that hash was placed on before the rebalance, if it is different to its current
+// shard.
+func (s *ShardedStorage) previousShard(hash common.Hash) (Shard, bool) {
+	if len(s.previous) == 0 {
+		return Shard{}, false
+	}
+
+	previous := s.previous[s.prevRing.lookup(hash)]
+	return previous, previous.Name != s.shard(hash).Name
+}
+
+func (s *ShardedStorage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
+	exists, err := s.shard(hash).Store.Exists(ctx, hash)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	if previous, ok := s.previousShard(hash); ok {
+		return previous.Store.Exists(ctx, hash)
+	}
+
+	return false, nil
+}
+
+func (s *ShardedStorage) ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error) {
+	data, err := s.shard(hash).Store.ReadBlob(ctx, hash)
+	if !errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+
+	if previous, ok := s.previousShard(hash); ok {
+		s.log.Debug("reading blob from previous shard", "root", hash.String(), "shard", previous.Name)
+		return previous.Store.ReadBlob(ctx, hash)
+	}
+
+	return data, err
+}
+
+func (s *ShardedStorage) ReadBackfillProcesses(ctx context.Context) (BackfillProcesses, error) {
+	return s.shards[0].Store.ReadBackfillProcesses(ctx)
+}
+
+func (s *ShardedStorage) ReadBackfillWAL(ctx context.Context) (BackfillWAL, error) {
+	return s.shards[0].Store.ReadBackfillWAL(ctx)
+}
+
+func (s *ShardedStorage) ReadBackfillCheckpoint(ctx context.Context) (BackfillCheckpoint, error) {
+	return s.shards[0].Store.ReadBackfillCheckpoint(ctx)
+}
+
+func (s *ShardedStorage) ReadLockfile(ctx context.Context) (Lockfile, error) {
+	return s.shards[0].Store.ReadLockfile(ctx)
+}
+
+func (s *ShardedStorage) WriteBlob(ctx context.Context, data BlobData) error {
+	return s.shard(data.Header.BeaconBlockHash).Store.WriteBlob(ctx, data)
+}
+
+func (s *ShardedStorage) WriteEmptyBlob(ctx context.Context, hash common.Hash) error {
+	return s.shard(hash).Store.WriteEmptyBlob(ctx, hash)
+}
+
+func (s *ShardedStorage) WriteBackfillProcesses(ctx context.Context, data BackfillProcesses) error {
+	return s.shards[0].Store.WriteBackfillProcesses(ctx, data)
+}
+
+func (s *ShardedStorage) WriteBackfillWAL(ctx context.Context, data BackfillWAL) error {
+	return s.shards[0].Store.WriteBackfillWAL(ctx, data)
+}
+
+func (s *ShardedStorage) WriteBackfillCheckpoint(ctx context.Context, data BackfillCheckpoint) error {
+	return s.shards[0].Store.WriteBackfillCheckpoint(ctx, data)
+}
+
+func (s *ShardedStorage) WriteLockfile(ctx context.Context, data Lockfile) error {
+	return s.shards[0].Store.WriteLockfile(ctx, data)
+}
+
+// RunCompaction runs the compaction of every current and previous shard, see FileStorage.RunCompaction, until the
+// context is done.
+func (s *ShardedStorage) RunCompaction(ctx context.Context, interval time.Duration, tempFileAge time.Duration) {
+	var wg sync.WaitGroup
+	for _, shard := range s.distinctShards() {
+		store := shard.Store
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.RunCompaction(ctx, interval, tempFileAge)
+		}()
+	}
+	wg.Wait()
+}
+
+// distinctShards returns the current and previous shards, a backend that is in both sets once.
+func (s *ShardedStorage) distinctShards() []Shard {
+	var result []Shard
+	seen := make(map[string]bool)
+	for _, shard := range append(append([]Shard{}, s.shards...), s.previous...) {
+		if !seen[shard.Name] {
+			seen[shard.Name] = true
+			result = append(result, shard)
+		}
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func setupShards(t *testing.T, names ...string) []Shard {
+	l := testlog.Logger(t, log.LvlInfo)
+	result := make([]Shard, len(names))
+	for i, name := range names {
+		result[i] = Shard{Name: name, Store: NewFileStorage(t.TempDir(), l)}
+	}
+	return result
+}
+
+// testHashes returns n uniformly distributed hashes, as block roots are.
+func testHashes(n int) []common.Hash {
+	result := make([]common.Hash, n)
+	for i := range result {
+		result[i] = crypto.Keccak256Hash([]byte(strconv.Itoa(i)))
+	}
+	return result
+}
+
+func TestShardedExists(t *testing.T) {
+	s, err := NewShardedStorage(setupShards(t, "a", "b", "c"), nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	runTestExists(t, s)
+}
+
+func TestShardedRead(t *testing.T) {
+	s, err := NewShardedStorage(setupShards(t, "a", "b", "c"), nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	runTestRead(t, s)
+}
+
+func TestSharded_RoutesDeterministically(t *testing.T) {
+	shards := setupShards(t, "a", "b", "c")
+	s, err := NewShardedStorage(shards, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	used := make(map[string]bool)
+	for _, hash := range testHashes(30) {
+		require.NoError(t, s.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: hash}}))
+
+		name := s.ShardFor(hash)
+		used[name] = true
+		for _, shard := range shards {
+			exists, err := shard.Store.Exists(context.Background(), hash)
+			require.NoError(t, err)
+			require.Equal(t, shard.Name == name, exists)
+		}
+	}
+	require.Len(t, used, 3)
+
+	// The same names always produce the same placement
+	other, err := NewShardedStorage(setupShards(t, "a", "b", "c"), nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	for _, hash := range testHashes(30) {
+		require.Equal(t, s.ShardFor(hash), other.ShardFor(hash))
+	}
+}
+
+func TestSharded_AddingShardMinimizesMoves(t *testing.T) {
+	before, err := NewShardedStorage(setupShards(t, "a", "b", "c"), nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	after, err := NewShardedStorage(setupShards(t, "a", "b", "c", "d"), nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	moved := 0
+	hashes := testHashes(1000)
+	for _, hash := range hashes {
+		if before.ShardFor(hash) != after.ShardFor(hash) {
+			// Keys only move to the new shard, never between the existing ones
+			require.Equal(t, "d", after.ShardFor(hash))
+			moved++
+		}
+	}
+
+	// Roughly a quarter of the keys move to the new shard
+	require.Greater(t, moved, 150)
+	require.Less(t, moved, 350)
+}
+
+func TestSharded_ShardMap(t *testing.T) {
+	s, err := NewShardedStorage(setupShards(t, "a", "b", "c", "d"), nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	total := 0.0
+	for _, ownership := range s.ShardMap() {
+		require.InDelta(t, 0.25, ownership.Fraction, 0.1)
+		total += ownership.Fraction
+	}
+	require.InDelta(t, 1.0, total, 1e-9)
+}
+
+func TestSharded_ReadThroughDuringRebalance(t *testing.T) {
+	shards := setupShards(t, "a", "b", "c", "d")
+	old, err := NewShardedStorage(shards[:3], nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	hashes := testHashes(100)
+	for _, hash := range hashes {
+		require.NoError(t, old.WriteBlob(context.Background(), BlobData{Header: Header{BeaconBlockHash: hash}}))
+	}
+
+	// Without the previous placement, the blobs that now belong to the new shard cannot be found
+	withoutPrevious, err := NewShardedStorage(shards, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	missing := 0
+	for _, hash := range hashes {
+		exists, err := withoutPrevious.Exists(context.Background(), hash)
+		require.NoError(t, err)
+		if !exists {
+			missing++
+		}
+	}
+	require.Greater(t, missing, 0)
+
+	rebalancing, err := NewShardedStorage(shards, shards[:3], testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	for _, hash := range hashes {
+		exists, err := rebalancing.Exists(context.Background(), hash)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		data, err := rebalancing.ReadBlob(context.Background(), hash)
+		require.NoError(t, err)
+		require.Equal(t, hash, data.Header.BeaconBlockHash)
+	}
+
+	_, err = rebalancing.ReadBlob(context.Background(), common.Hash{})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSharded_MetadataInFirstShard(t *testing.T) {
+	shards := setupShards(t, "a", "b")
+	s, err := NewShardedStorage(shards, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	require.NoError(t, s.WriteLockfile(context.Background(), Lockfile{ArchiverId: "archiver"}))
+
+	lockfile, err := shards[0].Store.ReadLockfile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "archiver", lockfile.ArchiverId)
+
+	lockfile, err = shards[1].Store.ReadLockfile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Lockfile{}, lockfile)
+}
+
+func TestSharded_InvalidShards(t *testing.T) {
+	_, err := NewShardedStorage(nil, nil, testlog.Logger(t, log.LvlInfo))
+	require.Error(t, err)
+
+	_, err = NewShardedStorage(setupShards(t, "a", "a"), nil, testlog.Logger(t, log.LvlInfo))
+	require.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+)
+
+// BlobSidecar is the canonical representation of a blob sidecar, which is stored and served by the archiver. Its
+// schema and encoding are defined here rather than taken from go-eth2-client, so that the stored format does not change
+// with that library, and a fork can be supported without waiting for a release of it. The fields use the primitive
+// types of the consensus specs, which are the same in every fork. The SSZ encoding is generated by make generate, see
+// sidecar_encoding.go, and the JSON encoding is that of the beacon API. FromDeneb and ToDeneb convert from and to the
+// go-eth2-client type.
+type BlobSidecar struct {
+	Index                       deneb.BlobIndex
+	Blob                        deneb.Blob          `ssz-size:"131072"`
+	KZGCommitment               deneb.KZGCommitment `ssz-size:"48"`
+	KZGProof                    deneb.KZGProof      `ssz-size:"48"`
+	SignedBlockHeader           *phase0.SignedBeaconBlockHeader
+	KZGCommitmentInclusionProof deneb.KZGCommitmentInclusionProof `ssz-size:"17,32"`
+}
+
+// FromDeneb returns the sidecar as a BlobSidecar. It shares the signed block header of sidecar.
+func FromDeneb(sidecar *deneb.BlobSidecar) *BlobSidecar {
+	return &BlobSidecar{
+		Index:                       sidecar.Index,
+		Blob:                        sidecar.Blob,
+		KZGCommitment:               sidecar.KZGCommitment,
+		KZGProof:                    sidecar.KZGProof,
+		SignedBlockHeader:           sidecar.SignedBlockHeader,
+		KZGCommitmentInclusionProof: sidecar.KZGCommitmentInclusionProof,
+	}
+}
+
+// ToDeneb returns the sidecar as a go-eth2-client sidecar. It shares the signed block header of s.
+func (s *BlobSidecar) ToDeneb() *deneb.BlobSidecar {
+	return &deneb.BlobSidecar{
+		Index:                       s.Index,
+		Blob:                        s.Blob,
+		KZGCommitment:               s.KZGCommitment,
+		KZGProof:                    s.KZGProof,
+		SignedBlockHeader:           s.SignedBlockHeader,
+		KZGCommitmentInclusionProof: s.KZGCommitmentInclusionProof,
+	}
+}
+
+// VersionedHash returns the versioned hash of the KZG commitment of the sidecar, which execution layer transactions
+// refer to the blob by.
+func (s *BlobSidecar) VersionedHash() common.Hash {
+	return versionedHash(s.KZGCommitment)
+}
+
+// versionedHash returns the KZG versioned hash of a commitment.
+func versionedHash(commitment [48]byte) common.Hash {
+	c := kzg4844.Commitment(commitment)
+	return kzg4844.CalcBlobHashV1(sha256.New(), &c)
+}
+
+// FromDenebSidecars returns the sidecars as BlobSidecars, e.g. for the response of a beacon node.
+func FromDenebSidecars(sidecars []*deneb.BlobSidecar) []*BlobSidecar {
+	result := make([]*BlobSidecar, len(sidecars))
+	for i, sidecar := range sidecars {
+		result[i] = FromDeneb(sidecar)
+	}
+	return result
+}
+
+// ToDenebSidecars returns the sidecars as go-eth2-client sidecars.
+func ToDenebSidecars(sidecars []*BlobSidecar) []*deneb.BlobSidecar {
+	result := make([]*deneb.BlobSidecar, len(sidecars))
+	for i, sidecar := range sidecars {
+		result[i] = sidecar.ToDeneb()
+	}
+	return result
+}
+
+// blobSidecarJSON is the beacon API representation of a blob sidecar. encoding/json writes the fields in the order
+// they are declared, which must be the order of the beacon API spec, so that re-serving stored sidecars produces the
+// same bytes as any other encoder of the spec (see TestBlobSidecars_CanonicalJSON), e.g. for ETags and cache keys.
+type blobSidecarJSON struct {
+	Index                       string                            `json:"index"`
+	Blob                        deneb.Blob                        `json:"blob"`
+	KZGCommitment               deneb.KZGCommitment               `json:"kzg_commitment"`
+	KZGProof                    deneb.KZGProof                    `json:"kzg_proof"`
+	SignedBlockHeader           *phase0.SignedBeaconBlockHeader   `json:"signed_block_header"`
+	KZGCommitmentInclusionProof deneb.KZGCommitmentInclusionProof `json:"kzg_commitment_inclusion_proof"`
+}
+
+// blobSidecarFields are the fields of blobSidecarJSON, all of which are required.
+var blobSidecarFields = []string{"index", "blob", "kzg_commitment", "kzg_proof", "signed_block_header", "kzg_commitment_inclusion_proof"}
+
+func (s *BlobSidecar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&blobSidecarJSON{
+		Index:                       strconv.FormatUint(uint64(s.Index), 10),
+		Blob:                        s.Blob,
+		KZGCommitment:               s.KZGCommitment,
+		KZGProof:                    s.KZGProof,
+		SignedBlockHeader:           s.SignedBlockHeader,
+		KZGCommitmentInclusionProof: s.KZGCommitmentInclusionProof,
+	})
+}
+
+func (s *BlobSidecar) UnmarshalJSON(input []byte) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(input, &raw); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	for _, field := range blobSidecarFields {
+		if _, ok := raw[field]; !ok {
+			return fmt.Errorf("%s: missing", field)
+		}
+	}
+
+	if err := s.Index.UnmarshalJSON(raw["index"]); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+
+	if err := s.Blob.UnmarshalJSON(raw["blob"]); err != nil {
+		return fmt.Errorf("blob: %w", err)
+	}
+
+	if err := s.KZGCommitment.UnmarshalJSON(raw["kzg_commitment"]); err != nil {
+		return fmt.Errorf("kzg_commitment: %w", err)
+	}
+
+	if err := s.KZGProof.UnmarshalJSON(raw["kzg_proof"]); err != nil {
+		return fmt.Errorf("kzg_proof: %w", err)
+	}
+
+	s.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{}
+	if err := s.SignedBlockHeader.UnmarshalJSON(raw["signed_block_header"]); err != nil {
+		return fmt.Errorf("signed_block_header: %w", err)
+	}
+
+	if err := s.KZGCommitmentInclusionProof.UnmarshalJSON(raw["kzg_commitment_inclusion_proof"]); err != nil {
+		return fmt.Errorf("kzg_commitment_inclusion_proof: %w", err)
+	}
+
+	return nil
+}
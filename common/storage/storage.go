@@ -3,17 +3,29 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path"
 	"sync"
 
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
-	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/forks"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
+	ssz "github.com/ferranbt/fastssz"
 )
 
 const (
+	// BlobSidecarSSZSize is the size of the SSZ encoding of a BlobSidecar, which is fixed
+	BlobSidecarSSZSize = blobSidecarSize
+	// MaxBlobSidecarsSSZSize is the size of the largest SSZ encoding of BlobSidecars that can be decoded
+	MaxBlobSidecarsSSZSize = maxBlobSidecars * blobSidecarSize
+
 	blobSidecarSize = 131928
+	// maxBlobSidecars is the most sidecars decoded from an SSZ list, the MAX_BLOBS_PER_BLOCK of the latest fork
+	maxBlobSidecars = forks.LatestMaxBlobsPerBlock
 )
 
 var (
@@ -23,16 +35,49 @@ var (
 	ErrStorage = errors.New("error accessing storage")
 	// ErrMarshaling is returned when there is an error in (un)marshaling the blob
 	ErrMarshaling = errors.New("error encoding/decoding blob")
-	// ErrCompress is returned when there is an error gzipping the data
+	// ErrCompress is returned when there is an error compressing the data
 	ErrCompress = errors.New("error compressing blob")
 )
 
 type Header struct {
 	BeaconBlockHash common.Hash `json:"beacon_block_hash"`
+	// BeaconBlockHeader is the signed header of the block, it is only stored if the archiver is configured to store
+	// block headers, and is nil for blocks stored before then or stored with WriteEmptyBlob
+	BeaconBlockHeader *phase0.SignedBeaconBlockHeader `json:"beacon_block_header,omitempty"`
+	// Fork is the fork of the block, e.g. deneb, which selects the layout of its body that the inclusion proofs of
+	// the sidecars are verified against. It is stored with the block header if the archiver knows the fork, and is
+	// empty otherwise.
+	Fork string `json:"fork,omitempty"`
+	// ExpiresAt is the unix time in seconds after which the block may be deleted, see Expirer, 0 if it never expires.
+	// It is written by an archiver with an object TTL
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// Orphaned is set by the archiver on a block that was reorged out of the canonical chain after it was stored. The
+	// blobs are still those of the block, but the block is not an ancestor of the head
+	Orphaned bool `json:"orphaned,omitempty"`
+}
+
+// VerifyBlockHeader checks that the stored block header is the header of the block that the blobs are stored for, so
+// that the header can be used to verify the inclusion proofs of the sidecars without a beacon node. An error is
+// returned if no header is stored, or if the root of the header is not BeaconBlockHash.
+func (h Header) VerifyBlockHeader() error {
+	if h.BeaconBlockHeader == nil || h.BeaconBlockHeader.Message == nil {
+		return fmt.Errorf("no block header stored for %s", h.BeaconBlockHash)
+	}
+
+	root, err := h.BeaconBlockHeader.Message.HashTreeRoot()
+	if err != nil {
+		return fmt.Errorf("failed to compute block header root: %w", err)
+	}
+
+	if common.Hash(root) != h.BeaconBlockHash {
+		return fmt.Errorf("block header root %s does not match %s", common.Hash(root), h.BeaconBlockHash)
+	}
+
+	return nil
 }
 
 type BlobSidecars struct {
-	Data []*deneb.BlobSidecar `json:"data"`
+	Data []*BlobSidecar `json:"data"`
 }
 
 // MarshalSSZ marshals the blob sidecars into SSZ. As the blob sidecars are a single list of fixed size elements, we can
@@ -55,6 +100,24 @@ func (b *BlobSidecars) MarshalSSZ() ([]byte, error) {
 	return result, nil
 }
 
+// UnmarshalSSZ unmarshals a list of blob sidecars from SSZ, the inverse of MarshalSSZ.
+func (b *BlobSidecars) UnmarshalSSZ(buf []byte) error {
+	count, err := ssz.DivideInt2(len(buf), blobSidecarSize, maxBlobSidecars)
+	if err != nil {
+		return err
+	}
+
+	b.Data = make([]*BlobSidecar, count)
+	for i := range b.Data {
+		b.Data[i] = new(BlobSidecar)
+		if err := b.Data[i].UnmarshalSSZ(buf[i*blobSidecarSize : (i+1)*blobSidecarSize]); err != nil {
+			return fmt.Errorf("sidecar %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
 func (b *BlobSidecars) SizeSSZ() int {
 	return len(b.Data) * blobSidecarSize
 }
@@ -62,6 +125,20 @@ func (b *BlobSidecars) SizeSSZ() int {
 type BlobData struct {
 	Header       Header       `json:"header"`
 	BlobSidecars BlobSidecars `json:"blob_sidecars"`
+	// DataColumnSidecars are the data column sidecars of a block from fulu on, whose blobs are served as columns
+	// rather than blob sidecars. BlobSidecars is empty for such a block, and DataColumnSidecars is nil for the blocks
+	// before fulu.
+	DataColumnSidecars *DataColumnSidecars `json:"data_column_sidecars,omitempty"`
+}
+
+// Blobs returns the number of blobs of the block, whether they are stored as blob sidecars or data column sidecars.
+func (d BlobData) Blobs() int {
+	return len(d.BlobSidecars.Data) + d.DataColumnSidecars.Blobs()
+}
+
+// Empty returns true if the block has neither blob sidecars nor data column sidecars.
+func (d BlobData) Empty() bool {
+	return len(d.BlobSidecars.Data) == 0 && (d.DataColumnSidecars == nil || len(d.DataColumnSidecars.Data) == 0)
 }
 
 var BackfillMu sync.Mutex
@@ -81,6 +158,47 @@ type Lockfile struct {
 // an active backfill
 type BackfillProcesses map[common.Hash]BackfillProcess
 
+// BackfillWALEntry records a block that a backfill process is persisting. The entry is written before the blobs are
+// stored and marked as done once the write succeeds, so that after a crash the archiver knows exactly which blocks
+// were in-flight.
+type BackfillWALEntry struct {
+	// Process is the start block hash of the backfill process that owns this entry
+	Process common.Hash `json:"process"`
+	// Root is the beacon block root being persisted
+	Root common.Hash `json:"root"`
+	// Done is set once the blobs for Root have been written to storage
+	Done bool `json:"done"`
+	// Header is the header of the persisted block, only set once Done is true
+	Header *v1.BeaconBlockHeader `json:"header,omitempty"`
+}
+
+// BackfillWAL is the write-ahead log used by the backfill processes, see BackfillWALEntry.
+type BackfillWAL struct {
+	Entries []BackfillWALEntry `json:"entries"`
+}
+
+// BackfillCheckpoint records the progress of the backfill of a range of slots by concurrent workers, so that an
+// interrupted backfill resumes where it left off rather than from the start of the range.
+type BackfillCheckpoint struct {
+	StartSlot uint64 `json:"start_slot"`
+	EndSlot   uint64 `json:"end_slot"`
+	// NextSlot is the lowest slot of the range that has not been backfilled, every slot before it has been. It is
+	// after EndSlot once the range is complete.
+	NextSlot uint64 `json:"next_slot"`
+	// Done are the slots after NextSlot that have been backfilled, by workers ahead of the slowest, in ascending order
+	Done []uint64 `json:"done,omitempty"`
+}
+
+// emptyBlobData returns the blob data for a block that was stored with WriteEmptyBlob.
+func emptyBlobData(hash common.Hash) BlobData {
+	return BlobData{
+		Header: Header{
+			BeaconBlockHash: hash,
+		},
+		BlobSidecars: BlobSidecars{Data: []*BlobSidecar{}},
+	}
+}
+
 // DataStoreReader is the interface for reading from a data store.
 type DataStoreReader interface {
 	// Exists returns true if the given blob hash exists in the data store, false otherwise.
@@ -88,7 +206,8 @@ type DataStoreReader interface {
 	// - nil: the existence check was successful. In this case the boolean should also be set correctly.
 	// - ErrStorage: there was an error accessing the data store.
 	Exists(ctx context.Context, hash common.Hash) (bool, error)
-	// ReadBlob reads the blob data for the given beacon block hash from the data store.
+	// ReadBlob reads the blob data for the given beacon block hash from the data store. If the block was stored with
+	// WriteEmptyBlob, blob data with no sidecars is returned.
 	// It should return one of the following:
 	// - nil: reading the blob was successful. The blob data is also returned.
 	// - ErrNotFound: the blob data was not found in the data store.
@@ -96,6 +215,10 @@ type DataStoreReader interface {
 	// - ErrMarshaling: there was an error decoding the blob data.
 	ReadBlob(ctx context.Context, hash common.Hash) (BlobData, error)
 	ReadBackfillProcesses(ctx context.Context) (BackfillProcesses, error)
+	ReadBackfillWAL(ctx context.Context) (BackfillWAL, error)
+	// ReadBackfillCheckpoint reads the checkpoint of the backfill of a range of slots. It returns ErrNotFound if no
+	// range has been backfilled.
+	ReadBackfillCheckpoint(ctx context.Context) (BackfillCheckpoint, error)
 	ReadLockfile(ctx context.Context) (Lockfile, error)
 }
 
@@ -106,20 +229,105 @@ type DataStoreWriter interface {
 	// - ErrStorage: there was an error accessing the data store.
 	// - ErrMarshaling: there was an error encoding the blob data.
 	WriteBlob(ctx context.Context, data BlobData) error
+	// WriteEmptyBlob records that the block with the given hash has no blobs, by writing an empty tombstone object
+	// rather than the encoded blob data. Exists returns true for the block and ReadBlob returns no sidecars, so the
+	// block is not treated as a gap. It should return one of the following errors:
+	// - nil: writing the tombstone was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	WriteEmptyBlob(ctx context.Context, hash common.Hash) error
 	WriteBackfillProcesses(ctx context.Context, data BackfillProcesses) error
+	WriteBackfillWAL(ctx context.Context, data BackfillWAL) error
+	WriteBackfillCheckpoint(ctx context.Context, data BackfillCheckpoint) error
 	WriteLockfile(ctx context.Context, data Lockfile) error
 }
 
-// DataStore is the interface for a data store that can be both written to and read from.
+// DataStore is the interface for a data store that can be both written to and read from. Every backend also lists and
+// deletes its blocks, indexes blobs, keeps an inventory, measures its usage and runs its compaction, returning
+// ErrExpiryUnsupported or ErrUsageUnsupported where it cannot, so that wrappers forward them like any other method.
 type DataStore interface {
 	DataStoreReader
 	DataStoreWriter
+	Expirer
+	BlobIndexer
+	Inventory
+	UsageReporter
+	Compactor
 }
 
 func NewStorage(cfg flags.StorageConfig, l log.Logger) (DataStore, error) {
-	if cfg.DataStorageType == flags.DataStorageS3 {
-		return NewS3Storage(cfg.S3Config, l)
-	} else {
-		return NewFileStorage(cfg.FileStorageDirectory, l), nil
+	shards := cfg.Shards()
+	if len(shards) <= 1 && len(cfg.PreviousShards) == 0 {
+		return newBackend(cfg, l)
+	}
+
+	// A backend that is in both the current and previous set of shards is only created once
+	backends := make(map[string]DataStore)
+	toShards := func(names []string) ([]Shard, error) {
+		var result []Shard
+		for _, name := range names {
+			if _, ok := backends[name]; !ok {
+				shardCfg := cfg
+				shardCfg.S3Config.Bucket = name
+				shardCfg.GCSConfig.Bucket = name
+				shardCfg.AzureConfig.Container = name
+				shardCfg.FileStorageDirectory = name
+				backend, err := newBackend(shardCfg, l.New("shard", name))
+				if err != nil {
+					return nil, err
+				}
+				backends[name] = backend
+			}
+			result = append(result, Shard{Name: name, Store: backends[name]})
+		}
+		return result, nil
+	}
+
+	current, err := toShards(shards)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := toShards(cfg.PreviousShards)
+	if err != nil {
+		return nil, err
+	}
+
+	sharded, err := NewShardedStorage(current, previous, l)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Info("using sharded storage", "shards", sharded.ShardMap(), "previous", cfg.PreviousShards)
+	return sharded, nil
+}
+
+// newBackend creates the data store for a single bucket, container or directory, with every key under the network
+// prefix.
+func newBackend(cfg flags.StorageConfig, l log.Logger) (DataStore, error) {
+	switch cfg.DataStorageType {
+	case flags.DataStorageS3:
+		s3Cfg := cfg.S3Config
+		s3Cfg.Path = path.Join(s3Cfg.Path, cfg.NetworkPrefix)
+		s3Cfg.Compression = cfg.Compression
+		return NewS3Storage(s3Cfg, l)
+	case flags.DataStorageGCS:
+		gcsCfg := cfg.GCSConfig
+		gcsCfg.Path = path.Join(gcsCfg.Path, cfg.NetworkPrefix)
+		gcsCfg.Compression = cfg.Compression
+		return NewGCSStorage(gcsCfg, l)
+	case flags.DataStorageAzure:
+		azureCfg := cfg.AzureConfig
+		azureCfg.Path = path.Join(azureCfg.Path, cfg.NetworkPrefix)
+		azureCfg.Compression = cfg.Compression
+		return NewAzureStorage(azureCfg, l)
+	default:
+		dir := path.Join(cfg.FileStorageDirectory, cfg.NetworkPrefix)
+		if cfg.NetworkPrefix != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create network directory: %w", err)
+			}
+		}
+		fs := NewFileStorage(dir, l)
+		fs.compression = blobCompression(cfg.Compression, false)
+		return fs, nil
 	}
 }
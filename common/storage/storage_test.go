@@ -1,17 +1,25 @@
 package storage
 
 import (
+	"context"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/attestantio/go-eth2-client/api"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/stretchr/testify/require"
 )
 
 func TestMarshalSSZ(t *testing.T) {
 	b := &BlobSidecars{
-		Data: []*deneb.BlobSidecar{
+		Data: []*BlobSidecar{
 			{
 				Index:         1,
 				Blob:          deneb.Blob(blobtest.RandBytes(t, 131072)),
@@ -42,3 +50,65 @@ func TestMarshalSSZ(t *testing.T) {
 		require.Equal(t, b.Data[i].KZGProof, sidecars.Sidecars[i].KZGProof)
 	}
 }
+
+func TestVerifyBlockHeader(t *testing.T) {
+	message := &phase0.BeaconBlockHeader{Slot: 10, ProposerIndex: 3, BodyRoot: phase0.Root{1}}
+	root, err := message.HashTreeRoot()
+	require.NoError(t, err)
+	signed := &phase0.SignedBeaconBlockHeader{Message: message}
+
+	require.NoError(t, Header{BeaconBlockHash: root, BeaconBlockHeader: signed}.VerifyBlockHeader())
+	require.ErrorContains(t, Header{BeaconBlockHash: common.Hash{1}, BeaconBlockHeader: signed}.VerifyBlockHeader(), "does not match")
+	require.ErrorContains(t, Header{BeaconBlockHash: root}.VerifyBlockHeader(), "no block header stored")
+}
+
+func TestNewStorage_NetworkPrefix(t *testing.T) {
+	dir := t.TempDir()
+	newStorage := func(prefix string) DataStore {
+		cfg := flags.StorageConfig{
+			DataStorageType:      flags.DataStorageFile,
+			FileStorageDirectory: dir,
+			NetworkPrefix:        prefix,
+		}
+		require.NoError(t, cfg.Check())
+		s, err := NewStorage(cfg, testlog.Logger(t, log.LvlInfo))
+		require.NoError(t, err)
+		return s
+	}
+
+	id := common.Hash{1, 2, 3}
+	mainnet := newStorage("mainnet")
+	require.NoError(t, mainnet.WriteBlob(context.Background(), BlobData{
+		Header:       Header{BeaconBlockHash: id},
+		BlobSidecars: sidecarsAtSlot(10),
+	}))
+
+	_, err := os.Stat(path.Join(dir, "mainnet", id.String()))
+	require.NoError(t, err)
+
+	exists, err := mainnet.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Another network, or no network, sharing the directory does not see the blob
+	for _, prefix := range []string{"holesky", ""} {
+		other := newStorage(prefix)
+		exists, err := other.Exists(context.Background(), id)
+		require.NoError(t, err)
+		require.False(t, exists, prefix)
+
+		_, err = other.ReadBlob(context.Background(), id)
+		require.ErrorIs(t, err, ErrNotFound, prefix)
+	}
+}
+
+func TestStorageConfig_InvalidNetworkPrefix(t *testing.T) {
+	for _, prefix := range []string{".", "..", "holesky/../mainnet", "/mainnet", "main net"} {
+		cfg := flags.StorageConfig{
+			DataStorageType:      flags.DataStorageFile,
+			FileStorageDirectory: t.TempDir(),
+			NetworkPrefix:        prefix,
+		}
+		require.ErrorContains(t, cfg.Check(), "invalid network prefix", prefix)
+	}
+}
@@ -0,0 +1,40 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// NewDataColumnSidecars returns random data column sidecars with the given indices, of a block with the given number of
+// blobs.
+func NewDataColumnSidecars(t *testing.T, blobs int, indices ...uint64) []*storage.DataColumnSidecar {
+	commitments := make([][48]byte, blobs)
+	for i := range commitments {
+		copy(commitments[i][:], blobtest.RandBytes(t, 48))
+	}
+
+	result := make([]*storage.DataColumnSidecar, len(indices))
+	for i, index := range indices {
+		sidecar := &storage.DataColumnSidecar{
+			Index:          index,
+			Column:         make([][storage.BytesPerCell]byte, blobs),
+			KZGCommitments: commitments,
+			KZGProofs:      make([][48]byte, blobs),
+			SignedBlockHeader: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{},
+			},
+		}
+		for j := 0; j < blobs; j++ {
+			copy(sidecar.Column[j][:], blobtest.RandBytes(t, storage.BytesPerCell))
+			copy(sidecar.KZGProofs[j][:], blobtest.RandBytes(t, 48))
+		}
+		for j := range sidecar.KZGCommitmentsInclusionProof {
+			copy(sidecar.KZGCommitmentsInclusionProof[j][:], blobtest.RandBytes(t, 32))
+		}
+		result[i] = sidecar
+	}
+	return result
+}
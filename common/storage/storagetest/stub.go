@@ -35,6 +35,15 @@ func (s *TestFileStorage) WriteBlob(_ context.Context, data storage.BlobData) er
 	return s.FileStorage.WriteBlob(context.Background(), data)
 }
 
+func (s *TestFileStorage) WriteEmptyBlob(_ context.Context, hash common.Hash) error {
+	if s.writeFailCount > 0 {
+		s.writeFailCount--
+		return storage.ErrStorage
+	}
+
+	return s.FileStorage.WriteEmptyBlob(context.Background(), hash)
+}
+
 func (fs *TestFileStorage) CheckExistsOrFail(t *testing.T, hash common.Hash) {
 	exists, err := fs.Exists(context.Background(), hash)
 	require.NoError(t, err)
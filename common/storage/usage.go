@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/minio/minio-go/v7"
+)
+
+// ErrUsageUnsupported is returned by UsageReporter.Usage when the data store cannot measure its usage.
+var ErrUsageUnsupported = errors.New("data store does not report its usage")
+
+// Usage is the amount of block data held in a data store. The backfill processes, WAL and lockfile are not included.
+type Usage struct {
+	// Objects is the number of stored blocks, including empty tombstones
+	Objects int64 `json:"objects"`
+	// Bytes is the total size of the stored blocks, as stored, i.e. after any compression
+	Bytes int64 `json:"bytes"`
+}
+
+// UsageReporter measures the usage of a data store. The usage is measured by enumerating
+// every stored object, which for a large bucket can take many list requests, so it should not be measured often.
+type UsageReporter interface {
+	Usage(ctx context.Context) (Usage, error)
+}
+
+// isBlockObject returns true if name is the name of a stored block, i.e. a block root, see FileStorage.fileName.
+func isBlockObject(name string) bool {
+	digits, ok := strings.CutPrefix(name, "0x")
+	if !ok || len(digits) != 2*common.HashLength {
+		return false
+	}
+	_, err := hex.DecodeString(digits)
+	return err == nil
+}
+
+// Usage counts the blocks in the storage directory. Temporary files of writes in progress are not counted.
+func (s *FileStorage) Usage(ctx context.Context) (Usage, error) {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		s.log.Warn("error listing storage directory", "err", err)
+		return Usage{}, ErrStorage
+	}
+
+	var result Usage
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return Usage{}, ctx.Err()
+		}
+
+		if entry.IsDir() || !isBlockObject(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			s.log.Warn("error reading stored block", "name", entry.Name(), "err", err)
+			return Usage{}, ErrStorage
+		}
+
+		result.Objects++
+		result.Bytes += info.Size()
+	}
+
+	return result, nil
+}
+
+// Usage counts the blocks under the storage path of the bucket, with one list request per 1000 objects.
+func (s *S3Storage) Usage(ctx context.Context) (Usage, error) {
+	prefix := ""
+	if s.path != "" {
+		prefix = strings.TrimSuffix(s.path, "/") + "/"
+	}
+
+	var result Usage
+	for object := range s.s3.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			s.log.Warn("error listing bucket", "err", object.Err)
+			return Usage{}, ErrStorage
+		}
+
+		if !isBlockObject(path.Base(object.Key)) {
+			continue
+		}
+
+		result.Objects++
+		result.Bytes += object.Size
+	}
+
+	if ctx.Err() != nil {
+		return Usage{}, ctx.Err()
+	}
+
+	return result, nil
+}
+
+// Usage is the total usage of the current and previous shards. ErrUsageUnsupported is returned if a shard does not
+// report its usage.
+func (s *ShardedStorage) Usage(ctx context.Context) (Usage, error) {
+	var result Usage
+	for _, shard := range s.distinctShards() {
+		usage, err := shard.Store.Usage(ctx)
+		if err != nil {
+			return Usage{}, err
+		}
+		result.Objects += usage.Objects
+		result.Bytes += usage.Bytes
+	}
+
+	return result, nil
+}
+
+// Usage returns ErrUsageUnsupported, the objects of a GCS bucket are not counted.
+func (s *GCSStorage) Usage(context.Context) (Usage, error) {
+	return Usage{}, ErrUsageUnsupported
+}
+
+// Usage returns ErrUsageUnsupported, the blobs of an Azure container are not counted.
+func (s *AzureStorage) Usage(context.Context) (Usage, error) {
+	return Usage{}, ErrUsageUnsupported
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileUsage(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	// The backfill processes, WAL and lockfile are not counted
+	usage, err := fs.Usage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Usage{}, usage)
+
+	writeBlock(t, fs, common.Hash{0x01}, 2)
+	writeBlock(t, fs, common.Hash{0x02}, 1)
+	require.NoError(t, fs.WriteEmptyBlob(context.Background(), common.Hash{0x03}))
+	// Nor are temporary files of writes in progress
+	require.NoError(t, os.WriteFile(filepath.Join(fs.directory, common.Hash{0x04}.String()+".123"+tempFileSuffix), []byte("partial"), 0644))
+
+	var bytes int64
+	for _, hash := range []common.Hash{{0x01}, {0x02}, {0x03}} {
+		info, err := os.Stat(fs.fileName(hash))
+		require.NoError(t, err)
+		bytes += info.Size()
+	}
+
+	usage, err = fs.Usage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Usage{Objects: 3, Bytes: bytes}, usage)
+}
+
+func TestShardedUsage(t *testing.T) {
+	shards := setupShards(t, "a", "b", "c")
+	s, err := NewShardedStorage(shards, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	for _, hash := range testHashes(20) {
+		writeBlock(t, s, hash, 1)
+	}
+
+	var expected Usage
+	for _, shard := range shards {
+		usage, err := shard.Store.Usage(context.Background())
+		require.NoError(t, err)
+		expected.Objects += usage.Objects
+		expected.Bytes += usage.Bytes
+	}
+
+	usage, err := s.Usage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(20), usage.Objects)
+	require.Equal(t, expected, usage)
+
+	// Behind OrderedStorage the usage of the inner data store is reported
+	usage, err = NewOrderedStorage(s, 1).Usage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, usage)
+}
+
+func TestUsageUnsupported(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	// A sharded archive cannot be measured if one of its shards cannot be
+	s, err := NewShardedStorage([]Shard{{Name: "file", Store: fs}, {Name: "gcs", Store: &GCSStorage{}}}, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	_, err = NewOrderedStorage(s, 1).Usage(context.Background())
+	require.ErrorIs(t, err, ErrUsageUnsupported)
+}
+
+func TestIsBlockObject(t *testing.T) {
+	require.True(t, isBlockObject(common.Hash{0x01}.String()))
+	require.False(t, isBlockObject("backfill_processes"))
+	require.False(t, isBlockObject(common.Hash{0x01}.String()+".123"+tempFileSuffix))
+	require.False(t, isBlockObject("0x"+common.Hash{}.String()[4:]+"zz"))
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+)
+
+const (
+	// FormatVersionSidecars is the format of blocks stored with their sidecars only, which every block was stored in
+	// before block headers could be stored
+	FormatVersionSidecars = 1
+	// FormatVersionBlockHeader is the format of blocks stored with their signed block header, see Header
+	FormatVersionBlockHeader = 2
+	// LatestFormatVersion is the most recent format version
+	LatestFormatVersion = FormatVersionBlockHeader
+)
+
+// FormatVersion returns the version of the format that data was stored in. The version is derived from the fields that
+// are set rather than stored, so that blocks written before versions existed have one.
+func (d BlobData) FormatVersion() int {
+	if d.Header.BeaconBlockHeader != nil {
+		return FormatVersionBlockHeader
+	}
+	return FormatVersionSidecars
+}
+
+// AtFormatVersion returns data in the given format version, for rewriting a stored block in another format. The block
+// header added by FormatVersionBlockHeader is taken from the sidecars, which each hold it, and is checked to be the
+// header of the block, or from the data column sidecars for a block from fulu on. Blocks without sidecars, such as
+// tombstones, cannot be given a header and are returned as they are. data is not modified.
+func (d BlobData) AtFormatVersion(version int) (BlobData, error) {
+	result := d
+	switch version {
+	case FormatVersionSidecars:
+		result.Header.BeaconBlockHeader = nil
+		result.Header.Fork = ""
+	case FormatVersionBlockHeader:
+		if result.Header.BeaconBlockHeader != nil || result.Empty() {
+			return result, nil
+		}
+		if len(result.BlobSidecars.Data) > 0 {
+			result.Header.BeaconBlockHeader = result.BlobSidecars.Data[0].SignedBlockHeader
+		} else {
+			result.Header.BeaconBlockHeader = result.DataColumnSidecars.Data[0].SignedBlockHeader
+		}
+		if err := result.Header.VerifyBlockHeader(); err != nil {
+			return BlobData{}, err
+		}
+	default:
+		return BlobData{}, fmt.Errorf("unknown format version %d, the latest is %d", version, LatestFormatVersion)
+	}
+	return result, nil
+}
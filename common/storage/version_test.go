@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtFormatVersion(t *testing.T) {
+	message := &phase0.BeaconBlockHeader{Slot: 10, ProposerIndex: 3, BodyRoot: phase0.Root{1}}
+	root, err := message.HashTreeRoot()
+	require.NoError(t, err)
+	signed := &phase0.SignedBeaconBlockHeader{Message: message}
+
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: root},
+		BlobSidecars: BlobSidecars{Data: []*BlobSidecar{{Index: 0, SignedBlockHeader: signed}}},
+	}
+	require.Equal(t, FormatVersionSidecars, data.FormatVersion())
+
+	migrated, err := data.AtFormatVersion(FormatVersionBlockHeader)
+	require.NoError(t, err)
+	require.Equal(t, FormatVersionBlockHeader, migrated.FormatVersion())
+	require.Equal(t, signed, migrated.Header.BeaconBlockHeader)
+	require.Nil(t, data.Header.BeaconBlockHeader, "data must not be modified")
+
+	// The fork is stored with the header, and removed with it
+	migrated.Header.Fork = "deneb"
+	reverted, err := migrated.AtFormatVersion(FormatVersionSidecars)
+	require.NoError(t, err)
+	require.Equal(t, data, reverted)
+
+	// The header of the sidecars must be the header of the block
+	data.Header.BeaconBlockHash = common.Hash{1}
+	_, err = data.AtFormatVersion(FormatVersionBlockHeader)
+	require.ErrorContains(t, err, "does not match")
+
+	// A block without sidecars has no header to store
+	empty := BlobData{Header: Header{BeaconBlockHash: root}}
+	unchanged, err := empty.AtFormatVersion(FormatVersionBlockHeader)
+	require.NoError(t, err)
+	require.Equal(t, empty, unchanged)
+
+	// The header of a block from fulu on is taken from its data column sidecars
+	columns := BlobData{
+		Header:             Header{BeaconBlockHash: root},
+		DataColumnSidecars: &DataColumnSidecars{Data: []*DataColumnSidecar{{Index: 5, SignedBlockHeader: signed}}},
+	}
+	migrated, err = columns.AtFormatVersion(FormatVersionBlockHeader)
+	require.NoError(t, err)
+	require.Equal(t, signed, migrated.Header.BeaconBlockHeader)
+
+	_, err = data.AtFormatVersion(LatestFormatVersion + 1)
+	require.ErrorContains(t, err, "unknown format version")
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+
+	"github.com/base-org/blob-archiver/common/archive"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/tools/flags"
+	"github.com/base-org/blob-archiver/tools/service"
+	opservice "github.com/ethereum-optimism/optimism/op-service"
+	"github.com/ethereum-optimism/optimism/op-service/cliapp"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	Version   = "v0.0.1"
+	GitCommit = ""
+	GitDate   = ""
+)
+
+func main() {
+	oplog.SetupDefaults()
+
+	app := cli.NewApp()
+	app.Version = opservice.FormatVersion(Version, GitCommit, GitDate, "")
+	app.Name = "blob-tools"
+	app.Usage = "Operator tooling for blob archives"
+	app.Description = "Commands for managing the data held in a blob archiver's storage"
+	app.Commands = []*cli.Command{
+		{
+			Name:        "export",
+			Usage:       "Export a slot range to an archive file",
+			Description: "Reads the blobs for every block in the slot range from storage and writes them to a tar archive with a manifest of roots, slots and checksums",
+			Flags:       cliapp.ProtectFlags(flags.ExportFlags),
+			Action:      Export,
+		},
+		{
+			Name:        "export-blobs",
+			Usage:       "Export the blobs of a slot range for offline analysis",
+			Description: "Reads the blocks in the slot range from storage with concurrent readers and writes each blob to a tar file as the SSZ encoding of its sidecar, with its slot, block root, index and KZG commitment in the entry's name and PAX header. Progress can be checkpointed to resume an interrupted export, which truncates the file to the last checkpointed block",
+			Flags:       cliapp.ProtectFlags(flags.ExportBlobsFlags),
+			Action:      ExportBlobs,
+		},
+		{
+			Name:        "import",
+			Usage:       "Import an archive file into storage",
+			Description: "Verifies the checksums of an archive created by export and writes its blobs to storage",
+			Flags:       cliapp.ProtectFlags(flags.ImportFlags),
+			Action:      Import,
+		},
+		{
+			Name:        "diff-archives",
+			Usage:       "Compare the blobs held by two archives",
+			Description: "Compares every block that either of two storage backends holds in the slot range, and writes each block that is present in only one of them or whose checksums differ to stdout as a line of JSON",
+			Flags:       cliapp.ProtectFlags(flags.DiffFlags),
+			Action:      DiffArchives,
+		},
+		{
+			Name:        "heal-gaps",
+			Usage:       "Archive the blocks missing from storage in a slot range",
+			Description: "Finds the gaps in storage in the slot range, fetches the blobs for each gap from the beacon node and writes the outcome of each gap to stdout as a line of JSON, then checks the range again and fails if any gap remains",
+			Flags:       cliapp.ProtectFlags(flags.HealFlags),
+			Action:      HealGaps,
+		},
+		{
+			Name:        "verify-against-beacon",
+			Usage:       "Verify that an archive is faithful to the chain history of a beacon node",
+			Description: "Fetches each canonical block in the slot range, or a random sample of them, from the beacon node and checks that the commitments of the stored sidecars exactly match the blob_kzg_commitments of the block body. Each block that is missing or does not match is written to stdout as a line of JSON",
+			Flags:       cliapp.ProtectFlags(flags.VerifyFlags),
+			Action:      VerifyAgainstBeacon,
+		},
+		{
+			Name:        "verify-storage",
+			Usage:       "Audit the integrity of the blocks held in storage",
+			Description: "Reads each block in the slot range from storage and checks that it can be decoded, that its sidecars are for the canonical block at its slot, and that its blobs match their KZG commitments and proofs. Each block that fails is written to stdout as a line of JSON. Reads can be throttled, and progress is logged with the throughput and ETA, and can be checkpointed to resume an interrupted run",
+			Flags:       cliapp.ProtectFlags(flags.AuditFlags),
+			Action:      VerifyStorage,
+		},
+		{
+			Name:        "migrate-storage",
+			Usage:       "Rewrite the blocks held in storage in another format version",
+			Description: "Lists every block stored in the slot range and rewrites it in the format version given by --to-version, then reads it back to check that it is in the version and holds the same sidecars. Each block is replaced by a single write, so the command is safe to run against a live archive and to interrupt. Reads can be throttled, and progress can be checkpointed to resume an interrupted run. With --dry-run, the blocks that need to be migrated are counted without writing them",
+			Flags:       cliapp.ProtectFlags(flags.MigrateFlags),
+			Action:      MigrateStorage,
+		},
+		{
+			Name:        "selftest",
+			Usage:       "Check that a blob service works end to end",
+			Description: "Checks the health endpoint of a blob service, fetches a block in both JSON and SSZ, checks that the formats hold the same sidecars, and verifies the blobs' KZG proofs. Each check is reported as passed, failed or skipped, and the command exits with an error if any did not pass",
+			Flags:       cliapp.ProtectFlags(flags.SelfTestFlags),
+			Action:      SelfTest,
+		},
+		{
+			Name:        "inspect",
+			Usage:       "Print the sidecars of a block as served by a blob service",
+			Description: "Fetches the sidecars of a block from a blob service or beacon node, in JSON or SSZ, and prints them as indented JSON with every byte field as hex and the versioned hash of each blob's commitment. Blobs are truncated to their first bytes unless --full is given",
+			Flags:       cliapp.ProtectFlags(flags.InspectFlags),
+			Action:      Inspect,
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Crit("Application failed", "message", err)
+	}
+}
+
+// Export is the entrypoint into the export command.
+func Export(cliCtx *cli.Context) error {
+	cfg := flags.ReadExportConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, cfg.BeaconConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize beacon client: %w", err)
+	}
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	f, err := os.Create(cfg.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	w, err := archive.NewWriter(f, archive.CompressionForPath(cfg.Output), cfg.StartSlot, cfg.EndSlot)
+	if err != nil {
+		return err
+	}
+
+	if err := service.Export(cliCtx.Context, l, beaconClient, storageClient, w, cfg.StartSlot, cfg.EndSlot); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	l.Info("export complete", "file", cfg.Output, "blocks", len(w.Manifest().Blocks))
+	return nil
+}
+
+// ExportBlobs is the entrypoint into the export-blobs command.
+func ExportBlobs(cliCtx *cli.Context) error {
+	cfg := flags.ReadExportBlobsConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, cfg.BeaconConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize beacon client: %w", err)
+	}
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	opts := service.BlobExportOptions{
+		Concurrency: cfg.Concurrency,
+		Checkpoint:  cfg.Checkpoint,
+	}
+	summary, err := service.ExportBlobs(cliCtx.Context, l, beaconClient, storageClient, cfg.Output, cfg.StartSlot, cfg.EndSlot, opts)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	l.Info("export complete", "file", cfg.Output, "slots", summary.Slots, "blocks", summary.Blocks, "blobs", summary.Blobs)
+	return nil
+}
+
+// Import is the entrypoint into the import command.
+func Import(cliCtx *cli.Context) error {
+	cfg := flags.ReadImportConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	f, err := os.Open(cfg.Input)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer f.Close()
+
+	r, err := archive.NewReader(f, archive.CompressionForPath(cfg.Input))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	count, err := service.Import(cliCtx.Context, l, r, storageClient)
+	if err != nil {
+		return fmt.Errorf("import failed after %d blocks: %w", count, err)
+	}
+
+	l.Info("import complete", "file", cfg.Input, "blocks", count)
+	return nil
+}
+
+// DiffArchives is the entrypoint into the diff-archives command.
+func DiffArchives(cliCtx *cli.Context) error {
+	cfg := flags.ReadDiffConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	archiveA, archiveB, err := cfg.Archives()
+	if err != nil {
+		return err
+	}
+
+	a, err := storage.NewStorage(archiveA, l.New("component", "storage", "archive", "a"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage a: %w", err)
+	}
+
+	b, err := storage.NewStorage(archiveB, l.New("component", "storage", "archive", "b"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage b: %w", err)
+	}
+
+	enc := json.NewEncoder(cliCtx.App.Writer)
+	summary, err := service.Diff(cliCtx.Context, l, a, b, cfg.StartSlot, cfg.EndSlot, cfg.Concurrency, func(d service.Difference) {
+		if err := enc.Encode(d); err != nil {
+			l.Error("failed to write difference", "err", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("diff failed: %w", err)
+	}
+
+	l.Info("diff complete", "blocks", summary.Blocks, "identical", summary.Identical, "differences", summary.Differences)
+	if summary.Differences > 0 {
+		return fmt.Errorf("archives differ in %d blocks", summary.Differences)
+	}
+
+	return nil
+}
+
+// HealGaps is the entrypoint into the heal-gaps command.
+func HealGaps(cliCtx *cli.Context) error {
+	cfg := flags.ReadHealConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, cfg.BeaconConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize beacon client: %w", err)
+	}
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	enc := json.NewEncoder(cliCtx.App.Writer)
+	summary, err := service.Heal(cliCtx.Context, l, beaconClient, storageClient, cfg.StartSlot, cfg.EndSlot, cfg.Concurrency, func(r service.HealResult) {
+		if r.Error != "" {
+			l.Warn("failed to heal gap", "start", r.Start, "end", r.End, "archived", r.Archived, "err", r.Error)
+		}
+		if err := enc.Encode(r); err != nil {
+			l.Error("failed to write result", "err", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("heal failed: %w", err)
+	}
+
+	l.Info("heal complete", "gaps", summary.Gaps, "healed", summary.Healed, "failed", summary.Failed, "remaining", len(summary.Remaining))
+	if len(summary.Remaining) > 0 {
+		return fmt.Errorf("%d gaps remain after healing, starting at slot %d", len(summary.Remaining), summary.Remaining[0].Start)
+	}
+
+	return nil
+}
+
+// VerifyAgainstBeacon is the entrypoint into the verify-against-beacon command.
+func VerifyAgainstBeacon(cliCtx *cli.Context) error {
+	cfg := flags.ReadVerifyConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, cfg.BeaconConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize beacon client: %w", err)
+	}
+	blockProvider, ok := beaconClient.(client.SignedBeaconBlockProvider)
+	if !ok {
+		return fmt.Errorf("beacon client does not provide blocks")
+	}
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if cfg.SampleRate < 1 {
+		l.Info("sampling slots", "rate", cfg.SampleRate, "seed", seed)
+	}
+
+	enc := json.NewEncoder(cliCtx.App.Writer)
+	opts := service.VerifyOptions{Concurrency: cfg.Concurrency, SampleRate: cfg.SampleRate, Seed: seed}
+	summary, err := service.VerifyAgainstBeacon(cliCtx.Context, l, blockProvider, storageClient, cfg.StartSlot, cfg.EndSlot, opts, func(d service.Discrepancy) {
+		l.Warn("archive is not faithful to block", "slot", d.Slot, "root", d.Root, "status", d.Status)
+		if err := enc.Encode(d); err != nil {
+			l.Error("failed to write discrepancy", "err", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+
+	l.Info("verify complete", "slots", summary.Slots, "blocks", summary.Blocks, "verified", summary.Verified, "discrepancies", summary.Discrepancies)
+	if summary.Discrepancies > 0 {
+		return fmt.Errorf("archive differs from the beacon node in %d blocks", summary.Discrepancies)
+	}
+
+	return nil
+}
+
+// VerifyStorage is the entrypoint into the verify-storage command.
+func VerifyStorage(cliCtx *cli.Context) error {
+	cfg := flags.ReadAuditConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, cfg.BeaconConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize beacon client: %w", err)
+	}
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	enc := json.NewEncoder(cliCtx.App.Writer)
+	opts := service.AuditOptions{
+		Concurrency:      cfg.Concurrency,
+		PerObjectTimeout: cfg.PerObjectTimeout,
+		Rate:             cfg.Rate,
+		Checkpoint:       cfg.Checkpoint,
+	}
+	summary, err := service.AuditStorage(cliCtx.Context, l, beaconClient, storageClient, cfg.StartSlot, cfg.EndSlot, opts, func(f service.AuditFinding) {
+		l.Warn("stored block failed audit", "slot", f.Slot, "root", f.Root, "status", f.Status)
+		if err := enc.Encode(f); err != nil {
+			l.Error("failed to write finding", "err", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("audit failed: %w", err)
+	}
+
+	l.Info("audit complete", "slots", summary.Slots, "blocks", summary.Blocks, "verified", summary.Verified, "missing", summary.Missing, "findings", summary.Findings)
+	if summary.Findings > 0 {
+		return fmt.Errorf("%d stored blocks failed the audit", summary.Findings)
+	}
+
+	return nil
+}
+
+// MigrateStorage is the entrypoint into the migrate-storage command.
+func MigrateStorage(cliCtx *cli.Context) error {
+	cfg := flags.ReadMigrateConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	storageClient, err := storage.NewStorage(cfg.StorageConfig, l.New("component", "storage"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	opts := service.MigrateOptions{
+		Concurrency: cfg.Concurrency,
+		Rate:        cfg.Rate,
+		Checkpoint:  cfg.Checkpoint,
+		DryRun:      cfg.DryRun,
+	}
+	summary, err := service.MigrateStorage(cliCtx.Context, l, storageClient, cfg.StartSlot, cfg.EndSlot, cfg.ToVersion, opts)
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	if cfg.DryRun {
+		l.Info("dry run complete", "version", cfg.ToVersion, "blocks", summary.Blocks, "current", summary.Current, "needMigration", summary.Migrated)
+		return nil
+	}
+
+	l.Info("migration complete", "version", cfg.ToVersion, "blocks", summary.Blocks, "current", summary.Current, "migrated", summary.Migrated)
+	return nil
+}
+
+// SelfTest is the entrypoint into the selftest command.
+func SelfTest(cliCtx *cli.Context) error {
+	cfg := flags.ReadSelfTestConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	client := blobclient.NewBlobSidecarClient(cfg.URL, blobclient.WithDialTimeout(cfg.DialTimeout), blobclient.WithLogger(l.New("component", "client")))
+	httpClient := &http.Client{Transport: &http.Transport{
+		Proxy:       http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{Timeout: cfg.DialTimeout}).DialContext,
+	}}
+
+	report := service.SelfTest(cliCtx.Context, client, httpClient, cfg.URL, cfg.Block)
+	w := tabwriter.NewWriter(cliCtx.App.Writer, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.ToUpper(string(check.Status)), check.Name, check.Duration.Round(time.Millisecond), check.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d checks did not pass: %s", len(failed), len(report.Checks), strings.Join(failed, ", "))
+	}
+
+	l.Info("all checks passed", "url", cfg.URL, "block", cfg.Block)
+	return nil
+}
+
+// Inspect is the entrypoint into the inspect command.
+func Inspect(cliCtx *cli.Context) error {
+	cfg := flags.ReadInspectConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+	oplog.SetGlobalLogHandler(l.Handler())
+
+	// The format is valid once the config is checked
+	format, _ := blobformat.Parse(cfg.Format)
+	client := blobclient.NewBlobSidecarClient(cfg.URL, blobclient.WithDialTimeout(cfg.DialTimeout), blobclient.WithLogger(l.New("component", "client")))
+	block, err := service.Inspect(client, cfg.ID, format, cfg.Full)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(cliCtx.App.Writer)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(block); err != nil {
+		return fmt.Errorf("failed to write sidecars: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,462 @@
+package flags
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobformat"
+	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/urfave/cli/v2"
+)
+
+type ExportConfig struct {
+	LogConfig     oplog.CLIConfig
+	BeaconConfig  common.BeaconConfig
+	StorageConfig common.StorageConfig
+	StartSlot     uint64
+	EndSlot       uint64
+	Output        string
+}
+
+func (c ExportConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if err := c.BeaconConfig.Check(); err != nil {
+		return fmt.Errorf("beacon config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Output == "" {
+		return fmt.Errorf("output file must be set")
+	}
+
+	return nil
+}
+
+func ReadExportConfig(cliCtx *cli.Context) ExportConfig {
+	return ExportConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		BeaconConfig:  common.NewBeaconConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		StartSlot:     cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:       cliCtx.Uint64(EndSlotFlag.Name),
+		Output:        cliCtx.String(OutputFlag.Name),
+	}
+}
+
+type ExportBlobsConfig struct {
+	LogConfig     oplog.CLIConfig
+	BeaconConfig  common.BeaconConfig
+	StorageConfig common.StorageConfig
+	StartSlot     uint64
+	EndSlot       uint64
+	Output        string
+	Concurrency   int
+	Checkpoint    string
+}
+
+func (c ExportBlobsConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if err := c.BeaconConfig.Check(); err != nil {
+		return fmt.Errorf("beacon config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Output == "" {
+		return fmt.Errorf("output file must be set")
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	return nil
+}
+
+func ReadExportBlobsConfig(cliCtx *cli.Context) ExportBlobsConfig {
+	return ExportBlobsConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		BeaconConfig:  common.NewBeaconConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		StartSlot:     cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:       cliCtx.Uint64(EndSlotFlag.Name),
+		Output:        cliCtx.String(BlobOutputFlag.Name),
+		Concurrency:   cliCtx.Int(ConcurrencyFlag.Name),
+		Checkpoint:    cliCtx.String(CheckpointFlag.Name),
+	}
+}
+
+type ImportConfig struct {
+	LogConfig     oplog.CLIConfig
+	StorageConfig common.StorageConfig
+	Input         string
+}
+
+func (c ImportConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if c.Input == "" {
+		return fmt.Errorf("input file must be set")
+	}
+
+	return nil
+}
+
+func ReadImportConfig(cliCtx *cli.Context) ImportConfig {
+	return ImportConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		Input:         cliCtx.String(InputFlag.Name),
+	}
+}
+
+type DiffConfig struct {
+	LogConfig oplog.CLIConfig
+	// StorageConfig is the storage configuration that the archives are based on, see common.ParseBackend
+	StorageConfig common.StorageConfig
+	// ArchiveA and ArchiveB are the specs of the two archives, see common.ParseBackend
+	ArchiveA    string
+	ArchiveB    string
+	StartSlot   uint64
+	EndSlot     uint64
+	Concurrency int
+}
+
+// Archives returns the storage configurations of the two archives.
+func (c DiffConfig) Archives() (common.StorageConfig, common.StorageConfig, error) {
+	a, err := common.ParseBackend(c.ArchiveA, c.StorageConfig)
+	if err != nil {
+		return common.StorageConfig{}, common.StorageConfig{}, fmt.Errorf("invalid archive a: %w", err)
+	}
+
+	b, err := common.ParseBackend(c.ArchiveB, c.StorageConfig)
+	if err != nil {
+		return common.StorageConfig{}, common.StorageConfig{}, fmt.Errorf("invalid archive b: %w", err)
+	}
+
+	return a, b, nil
+}
+
+func (c DiffConfig) Check() error {
+	a, b, err := c.Archives()
+	if err != nil {
+		return err
+	}
+
+	if err := a.Check(); err != nil {
+		return fmt.Errorf("archive a config check failed: %w", err)
+	}
+
+	if err := b.Check(); err != nil {
+		return fmt.Errorf("archive b config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	return nil
+}
+
+func ReadDiffConfig(cliCtx *cli.Context) DiffConfig {
+	return DiffConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		ArchiveA:      cliCtx.String(ArchiveAFlag.Name),
+		ArchiveB:      cliCtx.String(ArchiveBFlag.Name),
+		StartSlot:     cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:       cliCtx.Uint64(EndSlotFlag.Name),
+		Concurrency:   cliCtx.Int(ConcurrencyFlag.Name),
+	}
+}
+
+type HealConfig struct {
+	LogConfig     oplog.CLIConfig
+	BeaconConfig  common.BeaconConfig
+	StorageConfig common.StorageConfig
+	StartSlot     uint64
+	EndSlot       uint64
+	Concurrency   int
+}
+
+func (c HealConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if err := c.BeaconConfig.Check(); err != nil {
+		return fmt.Errorf("beacon config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	return nil
+}
+
+func ReadHealConfig(cliCtx *cli.Context) HealConfig {
+	return HealConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		BeaconConfig:  common.NewBeaconConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		StartSlot:     cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:       cliCtx.Uint64(EndSlotFlag.Name),
+		Concurrency:   cliCtx.Int(ConcurrencyFlag.Name),
+	}
+}
+
+type VerifyConfig struct {
+	LogConfig     oplog.CLIConfig
+	BeaconConfig  common.BeaconConfig
+	StorageConfig common.StorageConfig
+	StartSlot     uint64
+	EndSlot       uint64
+	Concurrency   int
+	SampleRate    float64
+	Seed          int64
+}
+
+func (c VerifyConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if err := c.BeaconConfig.Check(); err != nil {
+		return fmt.Errorf("beacon config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		return fmt.Errorf("sample rate must be above 0 and at most 1")
+	}
+
+	return nil
+}
+
+func ReadVerifyConfig(cliCtx *cli.Context) VerifyConfig {
+	return VerifyConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		BeaconConfig:  common.NewBeaconConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		StartSlot:     cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:       cliCtx.Uint64(EndSlotFlag.Name),
+		Concurrency:   cliCtx.Int(ConcurrencyFlag.Name),
+		SampleRate:    cliCtx.Float64(SampleRateFlag.Name),
+		Seed:          cliCtx.Int64(SeedFlag.Name),
+	}
+}
+
+type AuditConfig struct {
+	LogConfig        oplog.CLIConfig
+	BeaconConfig     common.BeaconConfig
+	StorageConfig    common.StorageConfig
+	StartSlot        uint64
+	EndSlot          uint64
+	Concurrency      int
+	PerObjectTimeout time.Duration
+	Rate             float64
+	Checkpoint       string
+}
+
+func (c AuditConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if err := c.BeaconConfig.Check(); err != nil {
+		return fmt.Errorf("beacon config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	if c.PerObjectTimeout < 0 {
+		return fmt.Errorf("per-object timeout must not be negative")
+	}
+
+	if c.Rate < 0 {
+		return fmt.Errorf("rate must not be negative")
+	}
+
+	return nil
+}
+
+func ReadAuditConfig(cliCtx *cli.Context) AuditConfig {
+	return AuditConfig{
+		LogConfig:        oplog.ReadCLIConfig(cliCtx),
+		BeaconConfig:     common.NewBeaconConfig(cliCtx),
+		StorageConfig:    common.NewStorageConfig(cliCtx),
+		StartSlot:        cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:          cliCtx.Uint64(EndSlotFlag.Name),
+		Concurrency:      cliCtx.Int(ConcurrencyFlag.Name),
+		PerObjectTimeout: cliCtx.Duration(PerObjectTimeoutFlag.Name),
+		Rate:             cliCtx.Float64(RateFlag.Name),
+		Checkpoint:       cliCtx.String(CheckpointFlag.Name),
+	}
+}
+
+type MigrateConfig struct {
+	LogConfig     oplog.CLIConfig
+	StorageConfig common.StorageConfig
+	StartSlot     uint64
+	EndSlot       uint64
+	Concurrency   int
+	Rate          float64
+	Checkpoint    string
+	ToVersion     int
+	DryRun        bool
+}
+
+func (c MigrateConfig) Check() error {
+	if err := c.StorageConfig.Check(); err != nil {
+		return fmt.Errorf("storage config check failed: %w", err)
+	}
+
+	if c.StartSlot > c.EndSlot {
+		return fmt.Errorf("invalid range: start %d is after end %d", c.StartSlot, c.EndSlot)
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	if c.Rate < 0 {
+		return fmt.Errorf("rate must not be negative")
+	}
+
+	if c.ToVersion < storage.FormatVersionSidecars || c.ToVersion > storage.LatestFormatVersion {
+		return fmt.Errorf("to-version must be between %d and %d", storage.FormatVersionSidecars, storage.LatestFormatVersion)
+	}
+
+	return nil
+}
+
+func ReadMigrateConfig(cliCtx *cli.Context) MigrateConfig {
+	return MigrateConfig{
+		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		StorageConfig: common.NewStorageConfig(cliCtx),
+		StartSlot:     cliCtx.Uint64(StartSlotFlag.Name),
+		EndSlot:       cliCtx.Uint64(EndSlotFlag.Name),
+		Concurrency:   cliCtx.Int(ConcurrencyFlag.Name),
+		Rate:          cliCtx.Float64(RateFlag.Name),
+		Checkpoint:    cliCtx.String(CheckpointFlag.Name),
+		ToVersion:     cliCtx.Int(ToVersionFlag.Name),
+		DryRun:        cliCtx.Bool(DryRunFlag.Name),
+	}
+}
+
+type SelfTestConfig struct {
+	LogConfig   oplog.CLIConfig
+	URL         string
+	Block       string
+	DialTimeout time.Duration
+}
+
+func (c SelfTestConfig) Check() error {
+	if c.URL == "" {
+		return fmt.Errorf("url must be set")
+	}
+
+	if c.Block == "" || c.Block == "head" {
+		return fmt.Errorf("block must be a slot or block root, head may change between requests")
+	}
+
+	if c.DialTimeout <= 0 {
+		return fmt.Errorf("dial timeout must be greater than 0")
+	}
+
+	return nil
+}
+
+func ReadSelfTestConfig(cliCtx *cli.Context) SelfTestConfig {
+	dialTimeout, _ := time.ParseDuration(cliCtx.String(DialTimeoutFlag.Name))
+	return SelfTestConfig{
+		LogConfig:   oplog.ReadCLIConfig(cliCtx),
+		URL:         cliCtx.String(URLFlag.Name),
+		Block:       cliCtx.String(BlockFlag.Name),
+		DialTimeout: dialTimeout,
+	}
+}
+
+type InspectConfig struct {
+	LogConfig oplog.CLIConfig
+	URL       string
+	ID        string
+	// Format is the format the block is requested in, see blobformat.Parse
+	Format      string
+	Full        bool
+	DialTimeout time.Duration
+}
+
+func (c InspectConfig) Check() error {
+	format, err := blobformat.Parse(c.Format)
+	if err != nil {
+		return err
+	}
+
+	if format == blobformat.Auto {
+		return fmt.Errorf("format must be json, ssz or ssz_snappy")
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("url must be set")
+	}
+
+	if c.ID == "" {
+		return fmt.Errorf("id must be set")
+	}
+
+	if c.DialTimeout <= 0 {
+		return fmt.Errorf("dial timeout must be greater than 0")
+	}
+
+	return nil
+}
+
+func ReadInspectConfig(cliCtx *cli.Context) InspectConfig {
+	dialTimeout, _ := time.ParseDuration(cliCtx.String(DialTimeoutFlag.Name))
+	return InspectConfig{
+		LogConfig:   oplog.ReadCLIConfig(cliCtx),
+		URL:         cliCtx.String(URLFlag.Name),
+		ID:          cliCtx.String(IDFlag.Name),
+		Format:      cliCtx.String(FormatFlag.Name),
+		Full:        cliCtx.Bool(FullFlag.Name),
+		DialTimeout: dialTimeout,
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/time/rate"
+)
+
+// AuditStatus describes why a stored block failed the audit.
+type AuditStatus string
+
+const (
+	// AuditUndecodable is a stored block that cannot be read back
+	AuditUndecodable AuditStatus = "undecodable"
+	// AuditWrongBlock is a stored block whose sidecars are for another block
+	AuditWrongBlock AuditStatus = "wrong_block"
+	// AuditInvalidProof is a stored block with a blob that does not match its KZG commitment and proof, or, for a block
+	// stored with its fork, a commitment that its inclusion proof does not prove is in the block
+	AuditInvalidProof AuditStatus = "invalid_proof"
+	// AuditTimeout is a stored block that could not be read within the per-object timeout
+	AuditTimeout AuditStatus = "timeout"
+)
+
+// defaultProgressInterval is how often the progress of an audit is logged and checkpointed, if not set.
+const defaultProgressInterval = 30 * time.Second
+
+// AuditFinding is a stored block that failed the audit.
+type AuditFinding struct {
+	Slot   uint64      `json:"slot"`
+	Root   common.Hash `json:"root"`
+	Status AuditStatus `json:"status"`
+	Error  string      `json:"error"`
+}
+
+// AuditSummary counts the slots checked by AuditStorage.
+type AuditSummary struct {
+	// Slots is the number of slots checked by this run, which excludes the slots before a resumed checkpoint
+	Slots int `json:"slots"`
+	// Blocks is the number of checked slots that have a block
+	Blocks int `json:"blocks"`
+	// Verified is the number of stored blocks that passed the audit
+	Verified int `json:"verified"`
+	// Missing is the number of blocks that are not stored, see find-gaps
+	Missing int `json:"missing"`
+	// Findings is the number of stored blocks reported as an AuditFinding
+	Findings int `json:"findings"`
+}
+
+// AuditOptions configures AuditStorage.
+type AuditOptions struct {
+	// Concurrency is the number of slots checked at once
+	Concurrency int
+	// PerObjectTimeout bounds the time to read a single block from storage, unbounded if 0
+	PerObjectTimeout time.Duration
+	// Rate is the maximum number of blocks read from storage per second, so that the audit does not compete with
+	// serving, unlimited if 0
+	Rate float64
+	// Checkpoint is the path of a file that progress is saved to, so that an interrupted audit of the same range
+	// resumes where it stopped. Progress is not saved if it is empty.
+	Checkpoint string
+	// ProgressInterval is how often progress is logged and saved, defaultProgressInterval if 0
+	ProgressInterval time.Duration
+}
+
+// auditCheckpoint is the progress of an audit saved to AuditOptions.Checkpoint.
+type auditCheckpoint struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	// Next is the lowest slot that has not been checked, every slot before it has been
+	Next uint64 `json:"next"`
+}
+
+// AuditStorage checks the integrity of the stored blocks in the slot range [start, end]. The beacon node resolves each
+// slot to its block root, and the block is read from storage, its sidecars checked to be for that block, and its blobs
+// verified against their KZG commitments and proofs. Each stored block that fails is passed to report as soon as it
+// is found, so findings are not reported in slot order. An error is returned if a slot cannot be checked, e.g. if the
+// beacon node or storage cannot be reached. With a checkpoint, an audit that stops, for any reason, can be run again to
+// resume, and the checkpoint is removed once the range is done.
+func AuditStorage(ctx context.Context, l log.Logger, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, start, end uint64, opts AuditOptions, report func(AuditFinding)) (AuditSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	first := start
+	if opts.Checkpoint != "" {
+		checkpoint, err := readCheckpointFile[auditCheckpoint](opts.Checkpoint)
+		if err != nil {
+			return AuditSummary{}, err
+		}
+		if checkpoint != nil && checkpoint.Start == start && checkpoint.End == end && checkpoint.Next > start {
+			l.Info("resuming audit from checkpoint", "slot", checkpoint.Next)
+			first = checkpoint.Next
+		}
+	}
+	if first > end {
+		return AuditSummary{}, removeCheckpointFile(opts.Checkpoint)
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+
+	var (
+		mu       sync.Mutex
+		summary  AuditSummary
+		firstErr error
+		wg       sync.WaitGroup
+		// done holds the checked slots from next on, which are done out of order by the workers
+		done = make(map[uint64]bool)
+		next = first
+	)
+
+	progress := newAuditProgress(end - first + 1)
+	saveProgress := func() {
+		mu.Lock()
+		checkpoint := auditCheckpoint{Start: start, End: end, Next: next}
+		checked := uint64(summary.Slots)
+		mu.Unlock()
+
+		throughput, eta := progress.estimate(checked)
+		l.Info("audit progress", "checked", checked, "remaining", progress.total-checked, "slotsPerSecond", fmt.Sprintf("%.1f", throughput), "eta", eta.Round(time.Second), "next", checkpoint.Next)
+		if opts.Checkpoint != "" {
+			if err := writeCheckpointFile(opts.Checkpoint, checkpoint); err != nil {
+				l.Error("failed to save audit checkpoint", "err", err)
+			}
+		}
+	}
+
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	stopProgress := make(chan struct{})
+	var progressWg sync.WaitGroup
+	progressWg.Add(1)
+	go func() {
+		defer progressWg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				saveProgress()
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+
+	slots := slotRange(ctx, first, end)
+	for i := 0; i < max(opts.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slots {
+				block, stored, finding, err := auditSlot(ctx, beaconClient, dataStore, limiter, opts.PerObjectTimeout, slot)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+
+				summary.Slots++
+				if block {
+					summary.Blocks++
+				}
+				switch {
+				case finding != nil:
+					summary.Findings++
+					report(*finding)
+				case block && !stored:
+					summary.Missing++
+				case block:
+					summary.Verified++
+				}
+
+				done[slot] = true
+				for done[next] {
+					delete(done, next)
+					next++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stopProgress)
+	progressWg.Wait()
+
+	if firstErr != nil || ctx.Err() != nil {
+		saveProgress()
+		if firstErr == nil {
+			firstErr = ctx.Err()
+		}
+		return summary, firstErr
+	}
+
+	return summary, removeCheckpointFile(opts.Checkpoint)
+}
+
+// auditSlot checks the stored block at slot. It returns whether the slot has a block, whether it is stored, and an
+// AuditFinding if it failed the audit.
+func auditSlot(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, limiter *rate.Limiter, timeout time.Duration, slot uint64) (bool, bool, *AuditFinding, error) {
+	header, err := beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: strconv.FormatUint(slot, 10),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return false, false, nil, nil
+		}
+
+		return false, false, nil, fmt.Errorf("failed to fetch header for slot %d: %w", slot, err)
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return false, false, nil, err
+	}
+
+	root := common.Hash(header.Data.Root)
+	readCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	finding := &AuditFinding{Slot: slot, Root: root}
+	data, err := dataStore.ReadBlob(readCtx, root)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return true, false, nil, nil
+	case err != nil && ctx.Err() != nil:
+		return false, false, nil, ctx.Err()
+	case err != nil && readCtx.Err() != nil:
+		finding.Status, finding.Error = AuditTimeout, fmt.Sprintf("not read within %s", timeout)
+		return true, true, finding, nil
+	case errors.Is(err, storage.ErrMarshaling) || errors.Is(err, storage.ErrCompress):
+		finding.Status, finding.Error = AuditUndecodable, err.Error()
+		return true, true, finding, nil
+	case err != nil:
+		return false, false, nil, fmt.Errorf("failed to read slot %d (%s): %w", slot, root, err)
+	}
+
+	for _, sidecar := range data.BlobSidecars.Data {
+		if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+			finding.Status, finding.Error = AuditWrongBlock, fmt.Sprintf("sidecar %d has no block header", sidecar.Index)
+			return true, true, finding, nil
+		}
+		sidecarRoot, err := sidecar.SignedBlockHeader.Message.HashTreeRoot()
+		if err != nil || common.Hash(sidecarRoot) != root {
+			finding.Status, finding.Error = AuditWrongBlock, fmt.Sprintf("sidecar %d is for block %s", sidecar.Index, common.Hash(sidecarRoot))
+			return true, true, finding, nil
+		}
+	}
+
+	// The inclusion proofs are only verified for blocks stored with their fork, as the layout of the block body that
+	// they prove against depends on it
+	if fork := data.Header.Fork; fork != "" {
+		for _, sidecar := range data.BlobSidecars.Data {
+			if err := blobproof.VerifyInclusionProof(sidecar, fork); err != nil {
+				finding.Status, finding.Error = AuditInvalidProof, err.Error()
+				return true, true, finding, nil
+			}
+		}
+	}
+
+	if err := blobproof.VerifyBlobsBatch(data.BlobSidecars.Data); err != nil {
+		finding.Status, finding.Error = AuditInvalidProof, err.Error()
+		return true, true, finding, nil
+	}
+
+	return true, true, nil, nil
+}
+
+// auditProgress estimates the throughput and remaining time of an audit.
+type auditProgress struct {
+	started time.Time
+	total   uint64
+}
+
+func newAuditProgress(total uint64) *auditProgress {
+	return &auditProgress{started: time.Now(), total: total}
+}
+
+// estimate returns the number of slots checked per second so far, and the time to check the rest at that rate.
+func (p *auditProgress) estimate(checked uint64) (float64, time.Duration) {
+	elapsed := time.Since(p.started).Seconds()
+	if checked == 0 || elapsed <= 0 {
+		return 0, 0
+	}
+
+	throughput := float64(checked) / elapsed
+	remaining := float64(p.total - min(checked, p.total))
+	return throughput, time.Duration(remaining / throughput * float64(time.Second))
+}
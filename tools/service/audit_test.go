@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// faultyStore fails to decode the blocks in undecodable, and does not return the blocks in slow until the read is
+// cancelled.
+type faultyStore struct {
+	storage.DataStoreReader
+	undecodable map[common.Hash]bool
+	slow        map[common.Hash]bool
+}
+
+func (s *faultyStore) ReadBlob(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	if s.undecodable[hash] {
+		return storage.BlobData{}, storage.ErrMarshaling
+	}
+	if s.slow[hash] {
+		<-ctx.Done()
+		return storage.BlobData{}, ctx.Err()
+	}
+	return s.DataStoreReader.ReadBlob(ctx, hash)
+}
+
+// addAuditBlock adds a block with count blobs at slot to beacon, whose sidecars' headers hash to its root, and returns
+// its root and sidecars.
+func addAuditBlock(t *testing.T, beacon *beacontest.StubBeaconClient, slot uint64, count int) (common.Hash, storage.BlobSidecars) {
+	sidecars := provenSidecars(t, count)
+	header := &phase0.SignedBeaconBlockHeader{
+		Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot), ProposerIndex: phase0.ValidatorIndex(slot)},
+	}
+	root, err := header.Message.HashTreeRoot()
+	require.NoError(t, err)
+	for _, sidecar := range sidecars.Data {
+		sidecar.SignedBlockHeader = header
+	}
+
+	beacon.Headers[strconv.FormatUint(slot, 10)] = &v1.BeaconBlockHeader{Root: root, Header: header}
+	return common.Hash(root), sidecars
+}
+
+// auditFixture stores six blocks from slot 10: two that are sound, one that is missing, and one of each finding that
+// is not a timeout.
+func auditFixture(t *testing.T, l log.Logger) (*beacontest.StubBeaconClient, *faultyStore) {
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	fs := storagetest.NewTestFileStorage(t, l)
+	store := &faultyStore{DataStoreReader: fs, undecodable: make(map[common.Hash]bool), slow: make(map[common.Hash]bool)}
+
+	write := func(root common.Hash, sidecars storage.BlobSidecars) {
+		fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: root}, BlobSidecars: sidecars})
+	}
+
+	root, sidecars := addAuditBlock(t, beacon, 10, 2)
+	write(root, sidecars)
+	root, sidecars = addAuditBlock(t, beacon, 11, 1)
+	write(root, sidecars)
+	addAuditBlock(t, beacon, 12, 1)
+
+	// 13 holds the sidecars of 10
+	root, _ = addAuditBlock(t, beacon, 13, 1)
+	_, sidecars = addAuditBlock(t, beacon, 10, 2)
+	write(root, sidecars)
+
+	root, sidecars = addAuditBlock(t, beacon, 14, 2)
+	sidecars.Data[1].Blob[1] ^= 0xff
+	write(root, sidecars)
+
+	root, sidecars = addAuditBlock(t, beacon, 15, 1)
+	write(root, sidecars)
+	store.undecodable[root] = true
+
+	return beacon, store
+}
+
+func TestAuditStorage(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, store := auditFixture(t, l)
+
+	var findings []AuditFinding
+	summary, err := AuditStorage(context.Background(), l, beacon, store, 10, 15, AuditOptions{Concurrency: 3}, func(f AuditFinding) {
+		findings = append(findings, f)
+	})
+	require.NoError(t, err)
+	require.Equal(t, AuditSummary{Slots: 6, Blocks: 6, Verified: 2, Missing: 1, Findings: 3}, summary)
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Slot < findings[j].Slot
+	})
+	require.Len(t, findings, 3)
+	require.Equal(t, AuditWrongBlock, findings[0].Status)
+	require.Equal(t, uint64(13), findings[0].Slot)
+	require.Equal(t, AuditInvalidProof, findings[1].Status)
+	require.Equal(t, uint64(14), findings[1].Slot)
+	require.Equal(t, AuditUndecodable, findings[2].Status)
+	require.Equal(t, uint64(15), findings[2].Slot)
+}
+
+func TestAuditStorage_Timeout(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, store := auditFixture(t, l)
+	store.slow[common.Hash(beacon.Headers["11"].Root)] = true
+
+	var findings []AuditFinding
+	opts := AuditOptions{Concurrency: 2, PerObjectTimeout: 50 * time.Millisecond}
+	summary, err := AuditStorage(context.Background(), l, beacon, store, 10, 11, opts, func(f AuditFinding) {
+		findings = append(findings, f)
+	})
+	require.NoError(t, err)
+	require.Equal(t, AuditSummary{Slots: 2, Blocks: 2, Verified: 1, Findings: 1}, summary)
+	require.Equal(t, AuditTimeout, findings[0].Status)
+	require.Equal(t, uint64(11), findings[0].Slot)
+}
+
+func TestAuditStorage_InclusionProofs(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	// The sidecars have no inclusion proofs, which is only found for blocks stored with their fork
+	for slot, fork := range []string{"", "deneb", "gloas"} {
+		root, sidecars := addAuditBlock(t, beacon, uint64(10+slot), 1)
+		fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: root, Fork: fork}, BlobSidecars: sidecars})
+	}
+
+	var findings []AuditFinding
+	summary, err := AuditStorage(context.Background(), l, beacon, fs, 10, 12, AuditOptions{Concurrency: 1}, func(f AuditFinding) {
+		findings = append(findings, f)
+	})
+	require.NoError(t, err)
+	require.Equal(t, AuditSummary{Slots: 3, Blocks: 3, Verified: 1, Findings: 2}, summary)
+	require.Equal(t, AuditInvalidProof, findings[0].Status)
+	require.Equal(t, uint64(11), findings[0].Slot)
+	require.Contains(t, findings[0].Error, "inclusion proof")
+	// A fork without a known layout is a finding rather than checked against the layout of another fork
+	require.Equal(t, AuditInvalidProof, findings[1].Status)
+	require.Equal(t, uint64(12), findings[1].Slot)
+	require.Contains(t, findings[1].Error, "unknown fork")
+}
+
+func TestAuditStorage_Rate(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, store := auditFixture(t, l)
+
+	// The first read is immediate, and each of the other two waits 100ms
+	start := time.Now()
+	_, err := AuditStorage(context.Background(), l, beacon, store, 10, 12, AuditOptions{Concurrency: 3, Rate: 10}, func(AuditFinding) {})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestAuditStorage_ResumesFromCheckpoint(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, store := auditFixture(t, l)
+	checkpoint := filepath.Join(t.TempDir(), "audit.json")
+
+	// The beacon node fails at slot 13, which stops the audit after the slots before it
+	header := beacon.Headers["13"]
+	delete(beacon.Headers, "13")
+	opts := AuditOptions{Concurrency: 1, Checkpoint: checkpoint}
+	summary, err := AuditStorage(context.Background(), l, beacon, store, 10, 15, opts, func(AuditFinding) {})
+	require.ErrorContains(t, err, "slot 13")
+	require.Equal(t, 3, summary.Slots)
+
+	data, err := os.ReadFile(checkpoint)
+	require.NoError(t, err)
+	var saved auditCheckpoint
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Equal(t, auditCheckpoint{Start: 10, End: 15, Next: 13}, saved)
+
+	// A different range does not resume
+	summary, err = AuditStorage(context.Background(), l, beacon, store, 10, 12, opts, func(AuditFinding) {})
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.Slots)
+	_, err = os.Stat(checkpoint)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, writeCheckpointFile(checkpoint, saved))
+	beacon.Headers["13"] = header
+	var findings []AuditFinding
+	summary, err = AuditStorage(context.Background(), l, beacon, store, 10, 15, opts, func(f AuditFinding) {
+		findings = append(findings, f)
+	})
+	require.NoError(t, err)
+	require.Equal(t, AuditSummary{Slots: 3, Blocks: 3, Findings: 3}, summary)
+	require.Len(t, findings, 3)
+
+	// The checkpoint is removed once the range is done
+	_, err = os.Stat(checkpoint)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestAuditProgress(t *testing.T) {
+	p := newAuditProgress(100)
+	p.started = time.Now().Add(-10 * time.Second)
+
+	throughput, eta := p.estimate(25)
+	require.InDelta(t, 2.5, throughput, 0.1)
+	require.InDelta(t, 30*time.Second, eta, float64(time.Second))
+
+	throughput, eta = p.estimate(0)
+	require.Zero(t, throughput)
+	require.Zero(t, eta)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// readCheckpointFile returns the checkpoint saved to path by writeCheckpointFile, or nil if there is none. Each command
+// that saves progress has its own checkpoint type, see auditCheckpoint, blobExportCheckpoint and migrateCheckpoint.
+func readCheckpointFile[T any](path string) (*T, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint T
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("malformed checkpoint %s: %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// writeCheckpointFile saves checkpoint to path, replacing the file so that it is never left partially written.
+func writeCheckpointFile(path string, checkpoint any) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeCheckpointFile removes the checkpoint at path, if there is one.
+func removeCheckpointFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
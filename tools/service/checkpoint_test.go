@@ -0,0 +1,37 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	checkpoint, err := readCheckpointFile[migrateCheckpoint](path)
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+
+	saved := migrateCheckpoint{Start: 10, End: 20, Version: 2, Next: 15}
+	require.NoError(t, writeCheckpointFile(path, saved))
+	checkpoint, err = readCheckpointFile[migrateCheckpoint](path)
+	require.NoError(t, err)
+	require.Equal(t, saved, *checkpoint)
+
+	// The checkpoint is written to a temporary file first, which is not left behind
+	_, err = os.Stat(path + ".tmp")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = readCheckpointFile[migrateCheckpoint](path)
+	require.ErrorContains(t, err, "malformed checkpoint")
+
+	require.NoError(t, removeCheckpointFile(path))
+	require.NoError(t, removeCheckpointFile(path))
+	require.NoError(t, removeCheckpointFile(""))
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
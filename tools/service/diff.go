@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/base-org/blob-archiver/common/archive"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DiffStatus describes how a block differs between two archives.
+type DiffStatus string
+
+const (
+	DiffOnlyInA   DiffStatus = "only_in_a"
+	DiffOnlyInB   DiffStatus = "only_in_b"
+	DiffChecksums DiffStatus = "differ"
+)
+
+// Difference is a block that is present in only one of the archives, or whose contents differ between them.
+type Difference struct {
+	Slot      uint64      `json:"slot"`
+	Root      common.Hash `json:"root"`
+	Status    DiffStatus  `json:"status"`
+	ChecksumA string      `json:"checksum_a,omitempty"`
+	ChecksumB string      `json:"checksum_b,omitempty"`
+}
+
+// DiffSummary counts the blocks compared by Diff.
+type DiffSummary struct {
+	// Blocks is the number of blocks in the range held by either archive
+	Blocks int `json:"blocks"`
+	// Identical is the number of blocks present in both archives with the same checksum
+	Identical int `json:"identical"`
+	// Differences is the number of blocks reported as a Difference
+	Differences int `json:"differences"`
+}
+
+// diffBlock is a block held by either archive, and which of them hold it.
+type diffBlock struct {
+	root common.Hash
+	slot uint64
+	inA  bool
+	inB  bool
+}
+
+// Diff compares the blocks in the slot range [start, end] in archives a and b. The blocks of both archives are
+// enumerated with ListBlocks, so a block held by one archive alone is reported whether or not it is canonical or known
+// to a beacon node, and the blobs of each block are read from the archives that hold it and compared by checksum.
+// Blocks stored without a slot, such as tombstones, are compared whatever the range. Up to concurrency blocks are
+// compared at once, and each difference is passed to report as soon as it is found, so they are not reported in slot
+// order. An error is returned if an archive cannot be listed or a block cannot be compared.
+func Diff(ctx context.Context, l log.Logger, a, b storage.DataStore, start, end uint64, concurrency int, report func(Difference)) (DiffSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	listedA, err := listBlocks(ctx, a, start, end)
+	if err != nil {
+		return DiffSummary{}, fmt.Errorf("failed to list archive a: %w", err)
+	}
+	listedB, err := listBlocks(ctx, b, start, end)
+	if err != nil {
+		return DiffSummary{}, fmt.Errorf("failed to list archive b: %w", err)
+	}
+
+	byRoot := make(map[common.Hash]*diffBlock)
+	for _, block := range listedA {
+		byRoot[block.Root] = &diffBlock{root: block.Root, slot: block.Slot, inA: true}
+	}
+	for _, block := range listedB {
+		if existing, ok := byRoot[block.Root]; ok {
+			existing.inB = true
+			existing.slot = max(existing.slot, block.Slot)
+		} else {
+			byRoot[block.Root] = &diffBlock{root: block.Root, slot: block.Slot, inB: true}
+		}
+	}
+
+	sorted := make([]diffBlock, 0, len(byRoot))
+	for _, block := range byRoot {
+		sorted = append(sorted, *block)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].slot != sorted[j].slot {
+			return sorted[i].slot < sorted[j].slot
+		}
+		return sorted[i].root.Cmp(sorted[j].root) < 0
+	})
+
+	blocks := make(chan diffBlock)
+	go func() {
+		defer close(blocks)
+		for _, block := range sorted {
+			select {
+			case blocks <- block:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		summary  DiffSummary
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for block := range blocks {
+				difference, found, err := compareBlock(ctx, a, b, block)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else if found {
+					summary.Blocks++
+					if difference != nil {
+						summary.Differences++
+						report(*difference)
+					} else {
+						summary.Identical++
+					}
+				}
+				mu.Unlock()
+
+				l.Debug("compared block", "slot", block.slot, "root", block.root, "differs", difference != nil)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return summary, firstErr
+}
+
+// listBlocks returns the blocks of the data store in the slot range [start, end], and those stored without a slot.
+func listBlocks(ctx context.Context, dataStore storage.Expirer, start, end uint64) ([]storage.StoredBlock, error) {
+	blocks, err := dataStore.ListBlocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []storage.StoredBlock
+	for _, block := range blocks {
+		if block.Slot == 0 || (block.Slot >= start && block.Slot <= end) {
+			result = append(result, block)
+		}
+	}
+	return result, nil
+}
+
+// slotRange returns a channel that yields each slot in [start, end] in order, and is closed once the range is done or
+// ctx is cancelled.
+func slotRange(ctx context.Context, start, end uint64) <-chan uint64 {
+	slots := make(chan uint64)
+	go func() {
+		defer close(slots)
+		for slot := start; slot <= end; slot++ {
+			select {
+			case slots <- slot:
+			case <-ctx.Done():
+				return
+			}
+			if slot == end {
+				// Prevents overflow when end is the maximum slot
+				return
+			}
+		}
+	}()
+	return slots
+}
+
+// compareBlock reads the block from the archives that hold it, and returns how it differs between them, or nil if it
+// is the same in both. A block deleted after the archives were listed is read as missing from that archive, and found
+// is false if it has been deleted from both.
+func compareBlock(ctx context.Context, a, b storage.DataStoreReader, block diffBlock) (difference *Difference, found bool, err error) {
+	difference = &Difference{Slot: block.slot, Root: block.root}
+	if block.inA {
+		if difference.ChecksumA, err = readChecksum(ctx, a, block.root); err != nil {
+			return nil, false, fmt.Errorf("failed to read block %s from a: %w", block.root, err)
+		}
+	}
+	if block.inB {
+		if difference.ChecksumB, err = readChecksum(ctx, b, block.root); err != nil {
+			return nil, false, fmt.Errorf("failed to read block %s from b: %w", block.root, err)
+		}
+	}
+
+	switch {
+	case difference.ChecksumA == "" && difference.ChecksumB == "":
+		return nil, false, nil
+	case difference.ChecksumA == difference.ChecksumB:
+		return nil, true, nil
+	case difference.ChecksumB == "":
+		difference.Status = DiffOnlyInA
+	case difference.ChecksumA == "":
+		difference.Status = DiffOnlyInB
+	default:
+		difference.Status = DiffChecksums
+	}
+	return difference, true, nil
+}
+
+// readChecksum returns the checksum of the blobs for root, or an empty string if they are not in the data store.
+func readChecksum(ctx context.Context, dataStore storage.DataStoreReader, root common.Hash) (string, error) {
+	data, err := dataStore.ReadBlob(ctx, root)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return archive.Checksum(data)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBlocks(t *testing.T, s *storagetest.TestFileStorage, beacon *beacontest.StubBeaconClient, blocks ...common.Hash) {
+	for _, hash := range blocks {
+		s.WriteOrFail(t, storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: hash, BeaconBlockHeader: beacon.Headers[hash.String()].Header},
+			BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(beacon.Blobs[hash.String()])},
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	a := storagetest.NewTestFileStorage(t, l)
+	b := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, a, beacon, blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three)
+	writeBlocks(t, b, beacon, blobtest.OriginBlock, blobtest.Two, blobtest.Three, blobtest.Four)
+
+	// Three holds different blobs in b
+	b.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Three, BeaconBlockHeader: beacon.Headers[blobtest.Three.String()].Header},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(beacon.Blobs[blobtest.One.String()])},
+	})
+
+	var differences []Difference
+	summary, err := Diff(context.Background(), l, a, b, blobtest.StartSlot, blobtest.EndSlot, 3, func(d Difference) {
+		differences = append(differences, d)
+	})
+	require.NoError(t, err)
+	require.Equal(t, DiffSummary{Blocks: 5, Identical: 2, Differences: 3}, summary)
+
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Slot < differences[j].Slot
+	})
+	require.Len(t, differences, 3)
+
+	require.Equal(t, blobtest.One, differences[0].Root)
+	require.Equal(t, DiffOnlyInA, differences[0].Status)
+	require.NotEmpty(t, differences[0].ChecksumA)
+	require.Empty(t, differences[0].ChecksumB)
+
+	require.Equal(t, blobtest.Three, differences[1].Root)
+	require.Equal(t, DiffChecksums, differences[1].Status)
+	require.NotEqual(t, differences[1].ChecksumA, differences[1].ChecksumB)
+
+	require.Equal(t, blobtest.Four, differences[2].Root)
+	require.Equal(t, blobtest.StartSlot+4, differences[2].Slot)
+	require.Equal(t, DiffOnlyInB, differences[2].Status)
+}
+
+func TestDiffIdentical(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	a := storagetest.NewTestFileStorage(t, l)
+	b := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, a, beacon, blobtest.One, blobtest.Two)
+	writeBlocks(t, b, beacon, blobtest.One, blobtest.Two)
+
+	summary, err := Diff(context.Background(), l, a, b, blobtest.StartSlot+1, blobtest.StartSlot+2, 1, func(d Difference) {
+		t.Fatalf("unexpected difference %v", d)
+	})
+	require.NoError(t, err)
+	require.Equal(t, DiffSummary{Blocks: 2, Identical: 2}, summary)
+}
+
+func TestDiffOrphanedBlocks(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	a := storagetest.NewTestFileStorage(t, l)
+	b := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, a, beacon, blobtest.One)
+	writeBlocks(t, b, beacon, blobtest.One)
+
+	// A block the beacon node does not know of, in the range, and one after the range are held by b alone
+	orphaned := common.Hash{0xaa}
+	for root, slot := range map[common.Hash]uint64{orphaned: blobtest.StartSlot + 1, {0xbb}: blobtest.EndSlot + 1} {
+		b.WriteOrFail(t, storage.BlobData{
+			Header: storage.Header{
+				BeaconBlockHash:   root,
+				BeaconBlockHeader: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot)}},
+			},
+			BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))},
+		})
+	}
+
+	var differences []Difference
+	summary, err := Diff(context.Background(), l, a, b, blobtest.StartSlot, blobtest.EndSlot, 2, func(d Difference) {
+		differences = append(differences, d)
+	})
+	require.NoError(t, err)
+	require.Equal(t, DiffSummary{Blocks: 2, Identical: 1, Differences: 1}, summary)
+	require.Len(t, differences, 1)
+	require.Equal(t, orphaned, differences[0].Root)
+	require.Equal(t, blobtest.StartSlot+1, differences[0].Slot)
+	require.Equal(t, DiffOnlyInB, differences[0].Status)
+}
+
+func TestDiffListError(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	a := storagetest.NewTestFileStorage(t, l)
+
+	// GCS does not list its blocks
+	_, err := Diff(context.Background(), l, a, &storage.GCSStorage{}, blobtest.StartSlot, blobtest.EndSlot, 2, func(Difference) {})
+	require.ErrorIs(t, err, storage.ErrExpiryUnsupported)
+	require.ErrorContains(t, err, "failed to list archive b")
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/base-org/blob-archiver/common/archive"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Export writes the blobs for every block in the slot range [start, end] to w. The blocks are read as export-blobs
+// reads them, see readExportBlocks: the beacon node is used to resolve each slot to its block root, and slots without a
+// block are skipped. Blocks are read from storage one at a time, so memory usage does not depend on the size of the
+// range.
+func Export(ctx context.Context, l log.Logger, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, w *archive.Writer, start, end uint64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for result := range readExportBlocks(ctx, beaconClient, dataStore, start, end, 1) {
+		block := <-result
+		if block.err != nil {
+			return block.err
+		}
+		if block.data == nil {
+			l.Debug("no block for slot, skipping", "slot", block.slot)
+			continue
+		}
+
+		if err := w.Add(block.slot, *block.data); err != nil {
+			return err
+		}
+
+		l.Debug("exported block", "slot", block.slot, "root", block.root.String(), "blobs", len(block.data.BlobSidecars.Data))
+	}
+
+	return ctx.Err()
+}
+
+// Import writes every block in the archive to storage, returning the number of blocks imported. Checksums are
+// verified before each block is written and the manifest is verified once the archive has been read, so an error is
+// returned for a corrupt or truncated archive.
+func Import(ctx context.Context, l log.Logger, r *archive.Reader, dataStore storage.DataStoreWriter) (int, error) {
+	count := 0
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+
+		if err := dataStore.WriteBlob(ctx, entry.Data); err != nil {
+			return count, fmt.Errorf("failed to write blobs for slot %d (%s): %w", entry.Slot, entry.Data.Header.BeaconBlockHash, err)
+		}
+
+		l.Debug("imported block", "slot", entry.Slot, "root", entry.Data.Header.BeaconBlockHash.String())
+		count++
+	}
+}
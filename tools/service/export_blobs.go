@@ -0,0 +1,348 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/archive"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The PAX records of each blob in a blob export, so that the blobs can be listed without decoding them.
+const (
+	BlobSlotRecord       = "BLOBARCHIVER.slot"
+	BlobRootRecord       = "BLOBARCHIVER.root"
+	BlobIndexRecord      = "BLOBARCHIVER.index"
+	BlobCommitmentRecord = "BLOBARCHIVER.kzg_commitment"
+	// BlobBlockChecksumRecord is the checksum of the block of the blob, as listed in the manifest, see archive.Checksum
+	BlobBlockChecksumRecord = "BLOBARCHIVER.block_sha256"
+)
+
+// BlobExportSummary counts the slots exported by ExportBlobs.
+type BlobExportSummary struct {
+	// Slots is the number of slots exported by this run, which excludes the slots before a resumed checkpoint
+	Slots int `json:"slots"`
+	// Blocks is the number of exported slots that have a block
+	Blocks int `json:"blocks"`
+	// Blobs is the number of blobs written
+	Blobs int `json:"blobs"`
+}
+
+// BlobExportOptions configures ExportBlobs.
+type BlobExportOptions struct {
+	// Concurrency is the number of blocks read from storage at once
+	Concurrency int
+	// Checkpoint is the path of a file that progress is saved to, so that an interrupted export of the same range
+	// resumes where it stopped. Progress is not saved if it is empty.
+	Checkpoint string
+	// ProgressInterval is how often progress is logged and saved, defaultProgressInterval if 0
+	ProgressInterval time.Duration
+}
+
+// blobExportCheckpoint is the progress of an export saved to BlobExportOptions.Checkpoint.
+type blobExportCheckpoint struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	// Next is the lowest slot that has not been exported, every slot before it has been
+	Next uint64 `json:"next"`
+	// Offset is the size of the output once every slot before Next had been written to it
+	Offset int64 `json:"offset"`
+}
+
+// exportedBlock is a block read from storage to be exported, without data if the slot is empty.
+type exportedBlock struct {
+	slot uint64
+	root common.Hash
+	data *storage.BlobData
+	err  error
+}
+
+// ExportBlobs writes every blob of the blocks in the slot range [start, end] to a tar file at path. Each blob is its own
+// entry named <slot>/<block root>/<index>.ssz, which holds the SSZ encoding of its sidecar, and the slot, block root,
+// index and KZG commitment of the blob are also recorded in the PAX header of the entry. The last entry is the manifest
+// of the blocks with blobs, as written by export, see archive.Manifest. The beacon node resolves each
+// slot to its block root, and slots without a block are skipped. Blocks are read from storage by concurrent readers
+// but written in slot order, with at most Concurrency blocks held in memory. With a checkpoint, an export that stops,
+// for any reason, can be run again to resume: the output is truncated to the last block saved to the checkpoint and the
+// export continues from there, and the checkpoint is removed once the range is done.
+func ExportBlobs(ctx context.Context, l log.Logger, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, path string, start, end uint64, opts BlobExportOptions) (BlobExportSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	f, checkpoint, err := openBlobExport(l, path, start, end, opts.Checkpoint)
+	if err != nil {
+		return BlobExportSummary{}, err
+	}
+	defer f.Close()
+
+	manifest := archive.Manifest{StartSlot: start, EndSlot: end, Blocks: make([]archive.ManifestEntry, 0)}
+	if checkpoint.Offset > 0 {
+		if manifest.Blocks, err = readBlobExportManifest(f, checkpoint.Offset); err != nil {
+			return BlobExportSummary{}, err
+		}
+	}
+
+	out := &countingWriter{w: f, n: checkpoint.Offset}
+	tw := tar.NewWriter(out)
+
+	var summary BlobExportSummary
+	progress := newAuditProgress(end - min(checkpoint.Next, end) + 1)
+	saveProgress := func() error {
+		throughput, eta := progress.estimate(uint64(summary.Slots))
+		l.Info("export progress", "exported", summary.Slots, "remaining", progress.total-min(uint64(summary.Slots), progress.total), "slotsPerSecond", fmt.Sprintf("%.1f", throughput), "eta", eta.Round(time.Second), "next", checkpoint.Next)
+		if opts.Checkpoint == "" {
+			return nil
+		}
+		// The output is synced first, so that the checkpoint never points past what has been written
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync output: %w", err)
+		}
+		return writeCheckpointFile(opts.Checkpoint, checkpoint)
+	}
+
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	lastSave := time.Now()
+
+	var exportErr error
+	if checkpoint.Next <= end {
+		for result := range readExportBlocks(ctx, beaconClient, dataStore, checkpoint.Next, end, opts.Concurrency) {
+			block := <-result
+			var entry *archive.ManifestEntry
+			if block.err == nil {
+				entry, block.err = writeExportBlock(tw, block)
+			}
+			if block.err != nil {
+				exportErr = block.err
+				break
+			}
+			if entry != nil {
+				manifest.Blocks = append(manifest.Blocks, *entry)
+			}
+
+			summary.Slots++
+			if block.data != nil {
+				summary.Blocks++
+				summary.Blobs += len(block.data.BlobSidecars.Data)
+			}
+			checkpoint.Next, checkpoint.Offset = block.slot+1, out.n
+
+			if time.Since(lastSave) >= interval {
+				if err := saveProgress(); err != nil {
+					l.Error("failed to save export checkpoint", "err", err)
+				}
+				lastSave = time.Now()
+			}
+		}
+		if exportErr == nil {
+			exportErr = ctx.Err()
+		}
+	}
+
+	if exportErr != nil {
+		cancel()
+		if err := saveProgress(); err != nil {
+			l.Error("failed to save export checkpoint", "err", err)
+		}
+		return summary, exportErr
+	}
+
+	// The manifest and the end of the archive are only written once the range is done, and are written again if the
+	// export is run after they were written but before the checkpoint was removed, as the output is truncated to the
+	// checkpoint
+	if err := archive.WriteManifest(tw, manifest); err != nil {
+		return summary, err
+	}
+	if err := tw.Close(); err != nil {
+		return summary, fmt.Errorf("failed to close export: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return summary, fmt.Errorf("failed to close output: %w", err)
+	}
+
+	return summary, removeCheckpointFile(opts.Checkpoint)
+}
+
+// openBlobExport opens the output of an export of the slot range [start, end]. If the checkpoint is of an export of the
+// same range, and the output holds everything written before it was saved, the output is truncated to the checkpoint
+// and the export resumes from it. Otherwise the output is replaced and the export starts from start.
+func openBlobExport(l log.Logger, path string, start, end uint64, checkpointPath string) (*os.File, blobExportCheckpoint, error) {
+	if checkpointPath != "" {
+		checkpoint, err := readCheckpointFile[blobExportCheckpoint](checkpointPath)
+		if err != nil {
+			return nil, blobExportCheckpoint{}, err
+		}
+
+		if checkpoint != nil && checkpoint.Start == start && checkpoint.End == end && checkpoint.Next > start {
+			f, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, blobExportCheckpoint{}, fmt.Errorf("failed to open output: %w", err)
+			}
+
+			if err == nil {
+				info, err := f.Stat()
+				if err != nil {
+					f.Close()
+					return nil, blobExportCheckpoint{}, fmt.Errorf("failed to stat output: %w", err)
+				}
+
+				if info.Size() >= checkpoint.Offset {
+					if err := f.Truncate(checkpoint.Offset); err != nil {
+						f.Close()
+						return nil, blobExportCheckpoint{}, fmt.Errorf("failed to truncate output: %w", err)
+					}
+					if _, err := f.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+						f.Close()
+						return nil, blobExportCheckpoint{}, fmt.Errorf("failed to seek output: %w", err)
+					}
+
+					l.Info("resuming export from checkpoint", "slot", checkpoint.Next)
+					return f, *checkpoint, nil
+				}
+				f.Close()
+			}
+
+			l.Warn("output does not hold the blobs saved to the checkpoint, restarting export", "file", path)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, blobExportCheckpoint{}, fmt.Errorf("failed to create output: %w", err)
+	}
+	return f, blobExportCheckpoint{Start: start, End: end, Next: start}, nil
+}
+
+// readExportBlocks reads the blocks in the slot range [start, end] with up to concurrency reads at once. The result of
+// each slot is sent on its own channel, and the channels are returned in slot order, so that the blocks can be written
+// in order as their reads complete. No more reads are started once the context is done.
+func readExportBlocks(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, start, end uint64, concurrency int) <-chan chan exportedBlock {
+	// A read is started once its channel is queued, so the reads in flight are those queued and the one being awaited
+	pending := make(chan chan exportedBlock, max(concurrency, 1)-1)
+	go func() {
+		defer close(pending)
+		for slot := range slotRange(ctx, start, end) {
+			result := make(chan exportedBlock, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(slot uint64) {
+				result <- readExportBlock(ctx, beaconClient, dataStore, slot)
+			}(slot)
+		}
+	}()
+	return pending
+}
+
+func readExportBlock(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, slot uint64) exportedBlock {
+	header, err := beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: strconv.FormatUint(slot, 10),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return exportedBlock{slot: slot}
+		}
+
+		return exportedBlock{slot: slot, err: fmt.Errorf("failed to fetch header for slot %d: %w", slot, err)}
+	}
+
+	root := common.Hash(header.Data.Root)
+	data, err := dataStore.ReadBlob(ctx, root)
+	if err != nil {
+		return exportedBlock{slot: slot, root: root, err: fmt.Errorf("failed to read blobs for slot %d (%s): %w", slot, root, err)}
+	}
+
+	return exportedBlock{slot: slot, root: root, data: &data}
+}
+
+// writeExportBlock writes the blobs of the block to the export, and flushes it so that the output ends on an entry. It
+// returns the manifest entry of the block, or nil if it has no blobs.
+func writeExportBlock(tw *tar.Writer, block exportedBlock) (*archive.ManifestEntry, error) {
+	if block.data == nil || len(block.data.BlobSidecars.Data) == 0 {
+		return nil, nil
+	}
+
+	sum, err := archive.Checksum(*block.data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sidecar := range block.data.BlobSidecars.Data {
+		b, err := sidecar.MarshalSSZ()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode blob %d of slot %d (%s): %w", sidecar.Index, block.slot, block.root, err)
+		}
+
+		err = archive.WriteFile(tw, fmt.Sprintf("%d/%s/%d.ssz", block.slot, block.root, sidecar.Index), b, map[string]string{
+			BlobSlotRecord:          strconv.FormatUint(block.slot, 10),
+			BlobRootRecord:          block.root.String(),
+			BlobIndexRecord:         strconv.FormatUint(uint64(sidecar.Index), 10),
+			BlobCommitmentRecord:    sidecar.KZGCommitment.String(),
+			BlobBlockChecksumRecord: sum,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush export: %w", err)
+	}
+	return &archive.ManifestEntry{Slot: block.slot, Root: block.root, Blobs: len(block.data.BlobSidecars.Data), SHA256: sum}, nil
+}
+
+// readBlobExportManifest returns the manifest entries of the blocks written to the first offset bytes of an export, from
+// the PAX records of their blobs, so that the manifest of a resumed export lists the blocks written before it. The
+// entries are skipped over rather than read.
+func readBlobExportManifest(f *os.File, offset int64) ([]archive.ManifestEntry, error) {
+	result := make([]archive.ManifestEntry, 0)
+	tr := tar.NewReader(io.NewSectionReader(f, 0, offset))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read export: %w", err)
+		}
+
+		slot, err := strconv.ParseUint(header.PAXRecords[BlobSlotRecord], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot record of %s: %w", header.Name, err)
+		}
+		root := common.HexToHash(header.PAXRecords[BlobRootRecord])
+
+		if last := len(result) - 1; last >= 0 && result[last].Root == root {
+			result[last].Blobs++
+		} else {
+			result = append(result, archive.ManifestEntry{Slot: slot, Root: root, Blobs: 1, SHA256: header.PAXRecords[BlobBlockChecksumRecord]})
+		}
+	}
+}
+
+// countingWriter counts the bytes written through it, starting from n.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/common/archive"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// emptySlotsBeacon serves the headers of a stub beacon client, and a 404 for the slots without one.
+type emptySlotsBeacon struct {
+	*beacontest.StubBeaconClient
+}
+
+func (b emptySlotsBeacon) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if _, ok := b.Headers[opts.Block]; !ok {
+		return nil, &api.Error{StatusCode: http.StatusNotFound}
+	}
+	return b.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+// exportedBlob is an entry read back from a blob export.
+type exportedBlob struct {
+	name    string
+	records map[string]string
+	sidecar storage.BlobSidecar
+}
+
+// readBlobExport returns the blobs of a blob export and its manifest, which must be the last entry.
+func readBlobExport(t *testing.T, path string) ([]exportedBlob, archive.Manifest) {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var (
+		result   []exportedBlob
+		manifest *archive.Manifest
+	)
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			require.NotNil(t, manifest, "export has no manifest")
+			return result, *manifest
+		}
+		require.NoError(t, err)
+		require.Nil(t, manifest, "manifest is not the last entry")
+
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if header.Name == archive.ManifestName {
+			manifest = new(archive.Manifest)
+			require.NoError(t, json.Unmarshal(b, manifest))
+			continue
+		}
+		entry := exportedBlob{name: header.Name, records: header.PAXRecords}
+		require.NoError(t, entry.sidecar.UnmarshalSSZ(b))
+		result = append(result, entry)
+	}
+}
+
+// blobExportFixture stores blocks with 2, 1 and 1 blobs at slots 10, 11 and 13, slot 12 is empty. The block at 13 is
+// only stored if storeLast is set.
+func blobExportFixture(t *testing.T, l log.Logger, storeLast bool) (client.BeaconBlockHeadersProvider, storage.DataStore, func()) {
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	fs := storagetest.NewTestFileStorage(t, l)
+	write := func(root common.Hash, sidecars storage.BlobSidecars) {
+		fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: root}, BlobSidecars: sidecars})
+	}
+
+	for slot, count := range map[uint64]int{10: 2, 11: 1} {
+		write(addAuditBlock(t, beacon, slot, count))
+	}
+	root, sidecars := addAuditBlock(t, beacon, 13, 1)
+	if storeLast {
+		write(root, sidecars)
+	}
+
+	return emptySlotsBeacon{beacon}, fs, func() { write(root, sidecars) }
+}
+
+func TestExportBlobs(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, fs, _ := blobExportFixture(t, l, true)
+	out := filepath.Join(t.TempDir(), "blobs.tar")
+
+	summary, err := ExportBlobs(context.Background(), l, beacon, fs, out, 10, 13, BlobExportOptions{Concurrency: 3})
+	require.NoError(t, err)
+	require.Equal(t, BlobExportSummary{Slots: 4, Blocks: 3, Blobs: 4}, summary)
+
+	blobs, manifest := readBlobExport(t, out)
+	require.Len(t, blobs, 4)
+	require.Equal(t, uint64(10), manifest.StartSlot)
+	require.Equal(t, uint64(13), manifest.EndSlot)
+	require.Len(t, manifest.Blocks, 3)
+	for i, expected := range []struct {
+		slot  uint64
+		index uint64
+	}{{10, 0}, {10, 1}, {11, 0}, {13, 0}} {
+		header, err := beacon.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{Block: strconv.FormatUint(expected.slot, 10)})
+		require.NoError(t, err)
+		root := common.Hash(header.Data.Root)
+		stored, err := fs.ReadBlob(context.Background(), root)
+		require.NoError(t, err)
+		sidecar := stored.BlobSidecars.Data[expected.index]
+
+		sum, err := archive.Checksum(stored)
+		require.NoError(t, err)
+		require.Contains(t, manifest.Blocks, archive.ManifestEntry{Slot: expected.slot, Root: root, Blobs: len(stored.BlobSidecars.Data), SHA256: sum})
+
+		blob := blobs[i]
+		require.Equal(t, strconv.FormatUint(expected.slot, 10)+"/"+root.String()+"/"+strconv.FormatUint(expected.index, 10)+".ssz", blob.name)
+		require.Equal(t, map[string]string{
+			BlobSlotRecord:          strconv.FormatUint(expected.slot, 10),
+			BlobRootRecord:          root.String(),
+			BlobIndexRecord:         strconv.FormatUint(expected.index, 10),
+			BlobCommitmentRecord:    sidecar.KZGCommitment.String(),
+			BlobBlockChecksumRecord: sum,
+		}, blob.records)
+		require.Equal(t, *sidecar, blob.sidecar)
+	}
+}
+
+func TestExportBlobs_ResumesFromCheckpoint(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, fs, storeLast := blobExportFixture(t, l, false)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "blobs.tar")
+	checkpoint := filepath.Join(dir, "export.json")
+	opts := BlobExportOptions{Concurrency: 2, Checkpoint: checkpoint}
+
+	// The block at 13 is not stored, which stops the export after the slots before it
+	summary, err := ExportBlobs(context.Background(), l, beacon, fs, out, 10, 13, opts)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.ErrorContains(t, err, "slot 13")
+	require.Equal(t, BlobExportSummary{Slots: 3, Blocks: 2, Blobs: 3}, summary)
+
+	data, err := os.ReadFile(checkpoint)
+	require.NoError(t, err)
+	var saved blobExportCheckpoint
+	require.NoError(t, json.Unmarshal(data, &saved))
+	info, err := os.Stat(out)
+	require.NoError(t, err)
+	require.Equal(t, blobExportCheckpoint{Start: 10, End: 13, Next: 13, Offset: info.Size()}, saved)
+
+	// Anything written after the checkpoint is discarded when the export resumes
+	f, err := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("partially written block"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	storeLast()
+	summary, err = ExportBlobs(context.Background(), l, beacon, fs, out, 10, 13, opts)
+	require.NoError(t, err)
+	require.Equal(t, BlobExportSummary{Slots: 1, Blocks: 1, Blobs: 1}, summary)
+	blobs, manifest := readBlobExport(t, out)
+	require.Len(t, blobs, 4)
+
+	// The manifest also lists the blocks written before the export resumed
+	require.Len(t, manifest.Blocks, 3)
+	for i, slot := range []uint64{10, 11, 13} {
+		require.Equal(t, slot, manifest.Blocks[i].Slot)
+		require.Equal(t, blobs[i+1].records[BlobBlockChecksumRecord], manifest.Blocks[i].SHA256)
+	}
+	require.Equal(t, 2, manifest.Blocks[0].Blobs)
+
+	// The checkpoint is removed once the range is done
+	_, err = os.Stat(checkpoint)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestExportBlobs_RestartsWithoutOutput(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon, fs, _ := blobExportFixture(t, l, true)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "blobs.tar")
+	checkpoint := filepath.Join(dir, "export.json")
+
+	// The output is shorter than the checkpoint, so the export cannot resume from it
+	require.NoError(t, writeCheckpointFile(checkpoint, blobExportCheckpoint{Start: 10, End: 13, Next: 12, Offset: 1 << 20}))
+	require.NoError(t, os.WriteFile(out, []byte("truncated"), 0644))
+
+	summary, err := ExportBlobs(context.Background(), l, beacon, fs, out, 10, 13, BlobExportOptions{Concurrency: 1, Checkpoint: checkpoint})
+	require.NoError(t, err)
+	require.Equal(t, BlobExportSummary{Slots: 4, Blocks: 3, Blobs: 4}, summary)
+	blobs, _ := readBlobExport(t, out)
+	require.Len(t, blobs, 4)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/archive"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	source := storagetest.NewTestFileStorage(t, l)
+
+	blocks := []common.Hash{blobtest.One, blobtest.Two, blobtest.Three}
+	for _, hash := range blocks {
+		source.WriteOrFail(t, storage.BlobData{
+			Header: storage.Header{
+				BeaconBlockHash: hash,
+			},
+			BlobSidecars: storage.BlobSidecars{
+				Data: storage.FromDenebSidecars(beacon.Blobs[hash.String()]),
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(&buf, archive.CompressionZstd, blobtest.StartSlot+1, blobtest.StartSlot+3)
+	require.NoError(t, err)
+
+	err = Export(context.Background(), l, beacon, source, w, blobtest.StartSlot+1, blobtest.StartSlot+3)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	manifest := w.Manifest()
+	require.Len(t, manifest.Blocks, 3)
+	for i, hash := range blocks {
+		require.Equal(t, hash, manifest.Blocks[i].Root)
+		require.Equal(t, blobtest.StartSlot+1+uint64(i), manifest.Blocks[i].Slot)
+	}
+
+	r, err := archive.NewReader(&buf, archive.CompressionZstd)
+	require.NoError(t, err)
+	defer r.Close()
+
+	dest := storagetest.NewTestFileStorage(t, l)
+	count, err := Import(context.Background(), l, r, dest)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	for _, hash := range blocks {
+		require.Equal(t, source.ReadOrFail(t, hash), dest.ReadOrFail(t, hash))
+	}
+}
+
+func TestExportMissingBlock(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	source := storagetest.NewTestFileStorage(t, l)
+
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(&buf, archive.CompressionNone, blobtest.StartSlot, blobtest.StartSlot)
+	require.NoError(t, err)
+
+	err = Export(context.Background(), l, beacon, source, w, blobtest.StartSlot, blobtest.StartSlot)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
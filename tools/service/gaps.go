@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Gap is a range of slots whose blocks are missing from storage. Slots in the range without a block are not counted,
+// so a gap can span empty slots but never a block that is stored.
+type Gap struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	// Blocks is the number of blocks in the range that are missing
+	Blocks int `json:"blocks"`
+}
+
+// HealResult is the outcome of archiving the blocks in a single gap.
+type HealResult struct {
+	Gap
+	// Archived is the number of blocks that were fetched from the beacon node and stored
+	Archived int    `json:"archived"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealSummary describes a run of Heal.
+type HealSummary struct {
+	// Gaps is the number of gaps found before healing
+	Gaps int `json:"gaps"`
+	// Healed is the number of gaps whose blocks were all archived
+	Healed int `json:"healed"`
+	// Failed is the number of gaps in which a block could not be archived
+	Failed int `json:"failed"`
+	// Remaining is the gaps found when detection is re-run after healing
+	Remaining []Gap `json:"remaining"`
+}
+
+// FindGaps returns the gaps in storage in the slot range [start, end], in slot order. The beacon node is used to resolve
+// each slot to its block root, and up to concurrency slots are checked at once. An error is returned if a slot cannot
+// be checked.
+func FindGaps(ctx context.Context, l log.Logger, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, start, end uint64, concurrency int) ([]Gap, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := slotRange(ctx, start, end)
+
+	var (
+		mu       sync.Mutex
+		missing  []uint64
+		stored   []uint64
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slots {
+				block, exists, err := checkSlot(ctx, beaconClient, dataStore, slot)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else if block && exists {
+					stored = append(stored, slot)
+				} else if block {
+					missing = append(missing, slot)
+				}
+				mu.Unlock()
+
+				if block {
+					l.Debug("checked block", "slot", slot, "stored", exists)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return mergeGaps(missing, stored), nil
+}
+
+// mergeGaps groups the missing slots into gaps, starting a new gap whenever a stored slot lies between two missing
+// slots.
+func mergeGaps(missing, stored []uint64) []Gap {
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	sort.Slice(stored, func(i, j int) bool { return stored[i] < stored[j] })
+
+	var gaps []Gap
+	next := 0
+	for _, slot := range missing {
+		separated := false
+		for next < len(stored) && stored[next] < slot {
+			separated = true
+			next++
+		}
+
+		if len(gaps) == 0 || separated {
+			gaps = append(gaps, Gap{Start: slot, End: slot, Blocks: 1})
+			continue
+		}
+
+		gaps[len(gaps)-1].End = slot
+		gaps[len(gaps)-1].Blocks++
+	}
+
+	return gaps
+}
+
+// checkSlot reports whether the slot has a block, and if so whether its blobs are in the data store.
+func checkSlot(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, dataStore storage.DataStoreReader, slot uint64) (bool, bool, error) {
+	root, block, err := resolveSlot(ctx, beaconClient, slot)
+	if err != nil || !block {
+		return false, false, err
+	}
+
+	exists, err := dataStore.Exists(ctx, root)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check slot %d (%s): %w", slot, root, err)
+	}
+
+	return true, exists, nil
+}
+
+// resolveSlot returns the root of the block at slot, or false if the slot has no block.
+func resolveSlot(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, slot uint64) (common.Hash, bool, error) {
+	header, err := beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: strconv.FormatUint(slot, 10),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return common.Hash{}, false, nil
+		}
+
+		return common.Hash{}, false, fmt.Errorf("failed to fetch header for slot %d: %w", slot, err)
+	}
+
+	return common.Hash(header.Data.Root), true, nil
+}
+
+// Heal finds the gaps in storage in the slot range [start, end], archives the blocks in each gap from the beacon node,
+// and then re-runs detection to confirm that the gaps are closed. Up to concurrency gaps are archived at once, and the
+// outcome of each gap is passed to report as soon as it is done, so they are not reported in slot order. A gap stops at
+// the first block that cannot be archived, and the other gaps carry on. An error is only returned if detection fails;
+// the gaps that are still open afterwards are returned in the summary.
+func Heal(ctx context.Context, l log.Logger, beaconClient beacon.Client, dataStore storage.DataStore, start, end uint64, concurrency int, report func(HealResult)) (HealSummary, error) {
+	gaps, err := FindGaps(ctx, l, beaconClient, dataStore, start, end, concurrency)
+	if err != nil {
+		return HealSummary{}, fmt.Errorf("failed to find gaps: %w", err)
+	}
+
+	summary := HealSummary{Gaps: len(gaps)}
+	l.Info("found gaps", "gaps", len(gaps))
+
+	work := make(chan Gap)
+	go func() {
+		defer close(work)
+		for _, gap := range gaps {
+			select {
+			case work <- gap:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for gap := range work {
+				result := healGap(ctx, beaconClient, dataStore, gap)
+
+				mu.Lock()
+				if result.Error == "" {
+					summary.Healed++
+				} else {
+					summary.Failed++
+				}
+				report(result)
+				mu.Unlock()
+
+				l.Debug("archived gap", "start", gap.Start, "end", gap.End, "archived", result.Archived, "err", result.Error)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	summary.Remaining, err = FindGaps(ctx, l, beaconClient, dataStore, start, end, concurrency)
+	if err != nil {
+		return summary, fmt.Errorf("failed to confirm gaps are closed: %w", err)
+	}
+
+	return summary, nil
+}
+
+// healGap archives every missing block in the gap, stopping at the first block that cannot be archived.
+func healGap(ctx context.Context, beaconClient beacon.Client, dataStore storage.DataStore, gap Gap) HealResult {
+	result := HealResult{Gap: gap}
+	for slot := gap.Start; slot <= gap.End; slot++ {
+		archived, err := archiveSlot(ctx, beaconClient, dataStore, slot)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if archived {
+			result.Archived++
+		}
+		if slot == gap.End {
+			// Prevents overflow when the gap ends at the maximum slot
+			break
+		}
+	}
+	return result
+}
+
+// archiveSlot fetches the blobs for the block at slot from the beacon node and writes them to the data store. It
+// reports false if the slot has no block or its blobs are already stored.
+func archiveSlot(ctx context.Context, beaconClient beacon.Client, dataStore storage.DataStore, slot uint64) (bool, error) {
+	root, block, err := resolveSlot(ctx, beaconClient, slot)
+	if err != nil || !block {
+		return false, err
+	}
+
+	exists, err := dataStore.Exists(ctx, root)
+	if err != nil {
+		return false, fmt.Errorf("failed to check slot %d (%s): %w", slot, root, err)
+	} else if exists {
+		return false, nil
+	}
+
+	sidecars, err := beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: root.String(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch blobs for slot %d (%s): %w", slot, root, err)
+	}
+
+	data := storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: root,
+		},
+		BlobSidecars: storage.BlobSidecars{Data: storage.FromDenebSidecars(sidecars.Data)},
+	}
+	if err := dataStore.WriteBlob(ctx, data); err != nil {
+		return false, fmt.Errorf("failed to write blobs for slot %d (%s): %w", slot, root, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindGaps(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, fs, beacon, blobtest.OriginBlock, blobtest.Three)
+
+	gaps, err := FindGaps(context.Background(), l, beacon, fs, blobtest.StartSlot, blobtest.EndSlot, 3)
+	require.NoError(t, err)
+	require.Equal(t, []Gap{
+		{Start: blobtest.StartSlot + 1, End: blobtest.StartSlot + 2, Blocks: 2},
+		{Start: blobtest.StartSlot + 4, End: blobtest.StartSlot + 5, Blocks: 2},
+	}, gaps)
+}
+
+func TestFindGapsNone(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, fs, beacon, blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three, blobtest.Four, blobtest.Five)
+
+	gaps, err := FindGaps(context.Background(), l, beacon, fs, blobtest.StartSlot, blobtest.EndSlot, 2)
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+}
+
+func TestMergeGaps(t *testing.T) {
+	// Slots 11 and 14 are missing blocks with empty slots between them, so they form a single gap
+	require.Equal(t, []Gap{{Start: 11, End: 14, Blocks: 2}}, mergeGaps([]uint64{14, 11}, []uint64{10, 15}))
+	// A stored block between two missing blocks splits the gap
+	require.Equal(t, []Gap{{Start: 11, End: 11, Blocks: 1}, {Start: 14, End: 14, Blocks: 1}}, mergeGaps([]uint64{11, 14}, []uint64{12}))
+	require.Empty(t, mergeGaps(nil, []uint64{10}))
+}
+
+func TestHeal(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, fs, beacon, blobtest.OriginBlock, blobtest.Three)
+
+	var results []HealResult
+	summary, err := Heal(context.Background(), l, beacon, fs, blobtest.StartSlot, blobtest.EndSlot, 2, func(r HealResult) {
+		results = append(results, r)
+	})
+	require.NoError(t, err)
+	require.Equal(t, HealSummary{Gaps: 2, Healed: 2}, summary)
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Start < results[j].Start
+	})
+	require.Equal(t, []HealResult{
+		{Gap: Gap{Start: blobtest.StartSlot + 1, End: blobtest.StartSlot + 2, Blocks: 2}, Archived: 2},
+		{Gap: Gap{Start: blobtest.StartSlot + 4, End: blobtest.StartSlot + 5, Blocks: 2}, Archived: 2},
+	}, results)
+
+	data := fs.ReadOrFail(t, blobtest.Four)
+	require.Equal(t, storage.FromDenebSidecars(beacon.Blobs[blobtest.Four.String()]), data.BlobSidecars.Data)
+	fs.CheckExistsOrFail(t, blobtest.One)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	fs.CheckExistsOrFail(t, blobtest.Five)
+}
+
+func TestHealReportsRemainingGaps(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	writeBlocks(t, fs, beacon, blobtest.OriginBlock, blobtest.Three)
+	// The blobs for Four cannot be fetched, so the gap it starts cannot be healed
+	delete(beacon.Blobs, blobtest.Four.String())
+
+	var failed []HealResult
+	summary, err := Heal(context.Background(), l, beacon, fs, blobtest.StartSlot, blobtest.EndSlot, 1, func(r HealResult) {
+		if r.Error != "" {
+			failed = append(failed, r)
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Gaps)
+	require.Equal(t, 1, summary.Healed)
+	require.Equal(t, 1, summary.Failed)
+	require.Equal(t, []Gap{{Start: blobtest.StartSlot + 4, End: blobtest.StartSlot + 5, Blocks: 2}}, summary.Remaining)
+
+	require.Len(t, failed, 1)
+	require.Equal(t, blobtest.StartSlot+4, failed[0].Start)
+	require.Zero(t, failed[0].Archived)
+	require.Contains(t, failed[0].Error, "failed to fetch blobs for slot 14")
+
+	fs.CheckExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+}
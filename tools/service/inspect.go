@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// inspectBlobPrefix is the number of bytes of a blob that are printed unless the whole blob is requested.
+const inspectBlobPrefix = 32
+
+// InspectedBlock is the human-readable form of the sidecars of a block, as printed by the inspect command.
+type InspectedBlock struct {
+	ID string `json:"id"`
+	// Format is the format the sidecars were fetched in, the output is the same for every format
+	Format   blobformat.Format  `json:"format"`
+	Sidecars []InspectedSidecar `json:"sidecars"`
+}
+
+// InspectedSidecar is the human-readable form of a blob sidecar, with every byte field as 0x prefixed hex.
+type InspectedSidecar struct {
+	Index         uint64 `json:"index"`
+	Slot          uint64 `json:"slot"`
+	ProposerIndex uint64 `json:"proposer_index"`
+	BlockRoot     string `json:"block_root"`
+	ParentRoot    string `json:"parent_root"`
+	KZGCommitment string `json:"kzg_commitment"`
+	// VersionedHash is the hash of the commitment that transactions refer to the blob by
+	VersionedHash string `json:"versioned_hash"`
+	KZGProof      string `json:"kzg_proof"`
+	// Blob is the whole blob if full was requested, otherwise its first bytes followed by its size
+	Blob                        string   `json:"blob"`
+	KZGCommitmentInclusionProof []string `json:"kzg_commitment_inclusion_proof"`
+}
+
+// Inspect fetches the sidecars of the block with the given id (a slot, block root or "head") from a blob service in
+// format, and returns them in a form that can be read by an operator. Blobs are truncated unless full is set.
+func Inspect(client blobclient.BlobSidecarClient, id string, format blobformat.Format, full bool) (InspectedBlock, error) {
+	status, sidecars, err := client.FetchSidecars(id, format)
+	if err != nil {
+		return InspectedBlock{}, fmt.Errorf("failed to fetch sidecars: status %d: %w", status, err)
+	}
+
+	result := InspectedBlock{ID: id, Format: format, Sidecars: make([]InspectedSidecar, 0, len(sidecars.Data))}
+	for _, sidecar := range sidecars.Data {
+		inspected, err := inspectSidecar(sidecar, full)
+		if err != nil {
+			return InspectedBlock{}, fmt.Errorf("failed to inspect sidecar %d: %w", sidecar.Index, err)
+		}
+		result.Sidecars = append(result.Sidecars, inspected)
+	}
+
+	return result, nil
+}
+
+func inspectSidecar(sidecar *storage.BlobSidecar, full bool) (InspectedSidecar, error) {
+	if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+		return InspectedSidecar{}, fmt.Errorf("sidecar has no block header")
+	}
+	header := sidecar.SignedBlockHeader.Message
+	root, err := header.HashTreeRoot()
+	if err != nil {
+		return InspectedSidecar{}, fmt.Errorf("failed to compute block root: %w", err)
+	}
+
+	versionedHash := sidecar.VersionedHash()
+
+	blob := fmt.Sprintf("%s... (%d bytes)", hexutil.Encode(sidecar.Blob[:inspectBlobPrefix]), len(sidecar.Blob))
+	if full {
+		blob = hexutil.Encode(sidecar.Blob[:])
+	}
+
+	proof := make([]string, len(sidecar.KZGCommitmentInclusionProof))
+	for i, node := range sidecar.KZGCommitmentInclusionProof {
+		proof[i] = hexutil.Encode(node[:])
+	}
+
+	return InspectedSidecar{
+		Index:                       uint64(sidecar.Index),
+		Slot:                        uint64(header.Slot),
+		ProposerIndex:               uint64(header.ProposerIndex),
+		BlockRoot:                   hexutil.Encode(root[:]),
+		ParentRoot:                  hexutil.Encode(header.ParentRoot[:]),
+		KZGCommitment:               hexutil.Encode(sidecar.KZGCommitment[:]),
+		VersionedHash:               hexutil.Encode(versionedHash[:]),
+		KZGProof:                    hexutil.Encode(sidecar.KZGProof[:]),
+		Blob:                        blob,
+		KZGCommitmentInclusionProof: proof,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	sidecars := provenSidecars(t, 2)
+	srv := blobServer(t, 200, sidecars, sidecars)
+	client := blobclient.NewBlobSidecarClient(srv.URL)
+
+	block, err := Inspect(client, "1234", blobformat.JSON, false)
+	require.NoError(t, err)
+	require.Equal(t, "1234", block.ID)
+	require.Len(t, block.Sidecars, 2)
+
+	for i, inspected := range block.Sidecars {
+		sidecar := sidecars.Data[i]
+		root, err := sidecar.SignedBlockHeader.Message.HashTreeRoot()
+		require.NoError(t, err)
+		commitment := kzg4844.Commitment(sidecar.KZGCommitment)
+		versionedHash := kzg4844.CalcBlobHashV1(sha256.New(), &commitment)
+
+		require.Equal(t, uint64(sidecar.Index), inspected.Index)
+		require.Equal(t, uint64(sidecar.SignedBlockHeader.Message.Slot), inspected.Slot)
+		require.Equal(t, hexutil.Encode(root[:]), inspected.BlockRoot)
+		require.Equal(t, hexutil.Encode(sidecar.KZGCommitment[:]), inspected.KZGCommitment)
+		require.Equal(t, hexutil.Encode(versionedHash[:]), inspected.VersionedHash)
+		require.Equal(t, hexutil.Encode(sidecar.KZGProof[:]), inspected.KZGProof)
+		require.Len(t, inspected.KZGCommitmentInclusionProof, len(sidecar.KZGCommitmentInclusionProof))
+		require.True(t, strings.HasPrefix(inspected.Blob, hexutil.Encode(sidecar.Blob[:inspectBlobPrefix])+"..."), inspected.Blob)
+		require.True(t, strings.HasSuffix(inspected.Blob, "(131072 bytes)"), inspected.Blob)
+	}
+
+	// The output is the same whichever format the sidecars were fetched in
+	fromSSZ, err := Inspect(client, "1234", blobformat.SSZ, false)
+	require.NoError(t, err)
+	require.Equal(t, blobformat.SSZ, fromSSZ.Format)
+	require.Equal(t, block.Sidecars, fromSSZ.Sidecars)
+
+	full, err := Inspect(client, "1234", blobformat.SSZ, true)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Encode(sidecars.Data[0].Blob[:]), full.Sidecars[0].Blob)
+}
+
+func TestInspect_FetchFails(t *testing.T) {
+	srv := blobServer(t, 200, storage.BlobSidecars{}, storage.BlobSidecars{})
+	srv.Close()
+
+	_, err := Inspect(blobclient.NewBlobSidecarClient(srv.URL), "head", blobformat.JSON, false)
+	require.ErrorContains(t, err, "failed to fetch sidecars")
+}
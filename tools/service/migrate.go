@@ -0,0 +1,325 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/time/rate"
+)
+
+// MigrateSummary counts the blocks handled by MigrateStorage.
+type MigrateSummary struct {
+	// Blocks is the number of stored blocks handled by this run, which excludes the blocks before a resumed checkpoint
+	// and those deleted while the run was listing or reading them
+	Blocks int `json:"blocks"`
+	// Current is the number of stored blocks that are already in the target version
+	Current int `json:"current"`
+	// Migrated is the number of stored blocks that were rewritten in the target version, or that need to be in a dry
+	// run
+	Migrated int `json:"migrated"`
+}
+
+// MigrateOptions configures MigrateStorage.
+type MigrateOptions struct {
+	// Concurrency is the number of blocks migrated at once
+	Concurrency int
+	// Rate is the maximum number of blocks read from storage per second, so that the migration does not compete with
+	// serving, unlimited if 0
+	Rate float64
+	// Checkpoint is the path of a file that progress is saved to, so that an interrupted migration of the same range
+	// resumes where it stopped. Progress is not saved if it is empty, or in a dry run.
+	Checkpoint string
+	// DryRun counts the blocks that need to be migrated without writing them
+	DryRun bool
+	// ProgressInterval is how often progress is logged and saved, defaultProgressInterval if 0
+	ProgressInterval time.Duration
+}
+
+// migrateCheckpoint is the progress of a migration saved to MigrateOptions.Checkpoint.
+type migrateCheckpoint struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	// Version is the format version that the blocks are migrated to
+	Version int `json:"version"`
+	// Next is the lowest slot that has blocks that have not been migrated, every block before it has been
+	Next uint64 `json:"next"`
+}
+
+// MigrateStorage rewrites the stored blocks in the slot range [start, end] in the given format version, see
+// storage.LatestFormatVersion. The blocks are listed from the data store with ListBlocks, so every stored block in the
+// range is migrated whether or not it is canonical, and blocks stored without a slot are migrated whatever the range.
+// Each block that is not in the version is rewritten, and read back to check that it is in the version and holds the
+// same sidecars before it is counted as migrated. A block is replaced by a single write of the whole object, so a
+// migration that is interrupted, for any reason, leaves every block in either its old or its new version and can be run
+// again. It is safe to run against a live archive. With a checkpoint, a migration of the same range to the same version
+// resumes from the slot where it stopped, and the checkpoint is removed once the range is done.
+func MigrateStorage(ctx context.Context, l log.Logger, dataStore storage.DataStore, start, end uint64, version int, opts MigrateOptions) (MigrateSummary, error) {
+	if _, err := (storage.BlobData{}).AtFormatVersion(version); err != nil {
+		return MigrateSummary{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// A dry run does not migrate anything, so it neither resumes nor saves progress
+	checkpointPath := opts.Checkpoint
+	if opts.DryRun {
+		checkpointPath = ""
+	}
+
+	first := start
+	if checkpointPath != "" {
+		checkpoint, err := readCheckpointFile[migrateCheckpoint](checkpointPath)
+		if err != nil {
+			return MigrateSummary{}, err
+		}
+		if checkpoint != nil && checkpoint.Start == start && checkpoint.End == end && checkpoint.Version == version && checkpoint.Next > start {
+			l.Info("resuming migration from checkpoint", "slot", checkpoint.Next)
+			first = checkpoint.Next
+		}
+	}
+	if first > end {
+		return MigrateSummary{}, removeCheckpointFile(checkpointPath)
+	}
+
+	listed, err := listBlocks(ctx, dataStore, first, end)
+	if err != nil {
+		return MigrateSummary{}, fmt.Errorf("failed to list stored blocks: %w", err)
+	}
+	// The blocks are migrated in slot order, so that the slot before which every block is done can be saved
+	sort.Slice(listed, func(i, j int) bool {
+		if listed[i].Slot != listed[j].Slot {
+			return listed[i].Slot < listed[j].Slot
+		}
+		return listed[i].Root.Cmp(listed[j].Root) < 0
+	})
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+
+	var (
+		mu       sync.Mutex
+		summary  MigrateSummary
+		firstErr error
+		wg       sync.WaitGroup
+		// done holds the positions in listed of the migrated blocks from next on, which are done out of order by the
+		// workers
+		done = make(map[int]bool)
+		next = 0
+		// handled counts the blocks done by this run, including those deleted before they were read
+		handled uint64
+	)
+
+	progress := newAuditProgress(uint64(len(listed)))
+	saveProgress := func() {
+		mu.Lock()
+		// Every block before the one at next is done, and those stored without a slot are checked again on resume
+		checkpoint := migrateCheckpoint{Start: start, End: end, Version: version, Next: end + 1}
+		if next < len(listed) {
+			checkpoint.Next = max(listed[next].Slot, first)
+		}
+		count := handled
+		mu.Unlock()
+
+		throughput, eta := progress.estimate(count)
+		l.Info("migration progress", "handled", count, "remaining", progress.total-count, "blocksPerSecond", fmt.Sprintf("%.1f", throughput), "eta", eta.Round(time.Second), "next", checkpoint.Next)
+		if checkpointPath != "" {
+			if err := writeCheckpointFile(checkpointPath, checkpoint); err != nil {
+				l.Error("failed to save migration checkpoint", "err", err)
+			}
+		}
+	}
+
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	stopProgress := make(chan struct{})
+	var progressWg sync.WaitGroup
+	progressWg.Add(1)
+	go func() {
+		defer progressWg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				saveProgress()
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+
+	positions := make(chan int)
+	go func() {
+		defer close(positions)
+		for i := range listed {
+			select {
+			case positions <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < max(opts.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for position := range positions {
+				outcome, err := migrateBlock(ctx, dataStore, limiter, version, opts.DryRun, listed[position])
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+
+				handled++
+				switch outcome {
+				case migrateCurrent:
+					summary.Blocks++
+					summary.Current++
+				case migrateMigrated:
+					summary.Blocks++
+					summary.Migrated++
+				}
+
+				done[position] = true
+				for done[next] {
+					delete(done, next)
+					next++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stopProgress)
+	progressWg.Wait()
+
+	if firstErr != nil || ctx.Err() != nil {
+		saveProgress()
+		if firstErr == nil {
+			firstErr = ctx.Err()
+		}
+		return summary, firstErr
+	}
+
+	return summary, removeCheckpointFile(checkpointPath)
+}
+
+// migrateOutcome is what migrateBlock did with a block.
+type migrateOutcome int
+
+const (
+	migrateDeleted migrateOutcome = iota
+	migrateCurrent
+	migrateMigrated
+)
+
+// migrateBlock rewrites the stored block in the given version, unless it already is or dryRun is set, and checks that
+// it reads back in the version with the same sidecars. A block deleted since it was listed is left as it is.
+func migrateBlock(ctx context.Context, dataStore storage.DataStore, limiter *rate.Limiter, version int, dryRun bool, block storage.StoredBlock) (migrateOutcome, error) {
+	slot, root := block.Slot, block.Root
+	if err := limiter.Wait(ctx); err != nil {
+		return migrateDeleted, err
+	}
+
+	data, err := dataStore.ReadBlob(ctx, root)
+	if errors.Is(err, storage.ErrNotFound) {
+		return migrateDeleted, nil
+	} else if err != nil {
+		return migrateDeleted, fmt.Errorf("failed to read slot %d (%s): %w", slot, root, err)
+	}
+
+	// Blocks without sidecars, including tombstones, are the same in every version
+	if data.Empty() || data.FormatVersion() == version {
+		return migrateCurrent, nil
+	}
+
+	migrated, err := data.AtFormatVersion(version)
+	if err != nil {
+		return migrateDeleted, fmt.Errorf("failed to migrate slot %d (%s): %w", slot, root, err)
+	}
+	if dryRun {
+		return migrateMigrated, nil
+	}
+
+	if err := dataStore.WriteBlob(ctx, migrated); err != nil {
+		return migrateDeleted, fmt.Errorf("failed to write slot %d (%s): %w", slot, root, err)
+	}
+
+	readBack, err := dataStore.ReadBlob(ctx, root)
+	if err != nil {
+		return migrateDeleted, fmt.Errorf("failed to read back slot %d (%s): %w", slot, root, err)
+	}
+	if err := checkMigrated(migrated, readBack, version); err != nil {
+		return migrateDeleted, fmt.Errorf("slot %d (%s) did not read back as migrated: %w", slot, root, err)
+	}
+
+	return migrateMigrated, nil
+}
+
+// checkMigrated returns an error if readBack is not in version, or does not hold the blob and data column sidecars that
+// were written.
+func checkMigrated(written, readBack storage.BlobData, version int) error {
+	if readBack.FormatVersion() != version {
+		return fmt.Errorf("read back in version %d", readBack.FormatVersion())
+	}
+
+	expected, err := written.BlobSidecars.MarshalSSZ()
+	if err != nil {
+		return fmt.Errorf("failed to encode written sidecars: %w", err)
+	}
+	actual, err := readBack.BlobSidecars.MarshalSSZ()
+	if err != nil {
+		return fmt.Errorf("failed to encode read back sidecars: %w", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return fmt.Errorf("read back sidecars differ from those written")
+	}
+
+	if (written.DataColumnSidecars == nil) != (readBack.DataColumnSidecars == nil) {
+		return fmt.Errorf("read back with %d data columns, %d were written", columns(readBack), columns(written))
+	}
+	if written.DataColumnSidecars == nil {
+		return nil
+	}
+	expected, err = written.DataColumnSidecars.MarshalSSZ()
+	if err != nil {
+		return fmt.Errorf("failed to encode written data columns: %w", err)
+	}
+	actual, err = readBack.DataColumnSidecars.MarshalSSZ()
+	if err != nil {
+		return fmt.Errorf("failed to encode read back data columns: %w", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return fmt.Errorf("read back data columns differ from those written")
+	}
+
+	return nil
+}
+
+// columns returns the number of data column sidecars that the block is stored with.
+func columns(data storage.BlobData) int {
+	if data.DataColumnSidecars == nil {
+		return 0
+	}
+	return len(data.DataColumnSidecars.Data)
+}
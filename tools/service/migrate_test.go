@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// headerDroppingStore writes blocks without their block header, like a backend that does not store it.
+type headerDroppingStore struct {
+	storage.DataStore
+}
+
+func (s *headerDroppingStore) WriteBlob(ctx context.Context, data storage.BlobData) error {
+	data.Header.BeaconBlockHeader = nil
+	return s.DataStore.WriteBlob(ctx, data)
+}
+
+// failingStore fails to read one block.
+type failingStore struct {
+	storage.DataStore
+	root common.Hash
+}
+
+func (s *failingStore) ReadBlob(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	if hash == s.root {
+		return storage.BlobData{}, errors.New("read failed")
+	}
+	return s.DataStore.ReadBlob(ctx, hash)
+}
+
+// migrateFixture stores seven blocks: two with sidecars only at slots 10 and 14, one that already has its block header
+// at 11, one at 12 that the beacon node does not know of, one after the range at 20 and a tombstone. It returns the roots of the blocks
+// by slot, with the tombstone as 0.
+func migrateFixture(t *testing.T, l log.Logger) (*storagetest.TestFileStorage, map[uint64]common.Hash) {
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	fs := storagetest.NewTestFileStorage(t, l)
+	roots := make(map[uint64]common.Hash)
+
+	for _, slot := range []uint64{10, 11, 12, 14, 20} {
+		root, sidecars := addAuditBlock(t, beacon, slot, 2)
+		data := storage.BlobData{Header: storage.Header{BeaconBlockHash: root}, BlobSidecars: sidecars}
+		if slot == 11 {
+			data.Header.BeaconBlockHeader = sidecars.Data[0].SignedBlockHeader
+		}
+		fs.WriteOrFail(t, data)
+		roots[slot] = root
+	}
+
+	roots[0], _ = addAuditBlock(t, beacon, 13, 0)
+	require.NoError(t, fs.WriteEmptyBlob(context.Background(), roots[0]))
+
+	return fs, roots
+}
+
+func TestMigrateStorage(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs, roots := migrateFixture(t, l)
+	before := fs.ReadOrFail(t, roots[10])
+
+	opts := MigrateOptions{Concurrency: 3, DryRun: true}
+	summary, err := MigrateStorage(context.Background(), l, fs, 10, 14, storage.FormatVersionBlockHeader, opts)
+	require.NoError(t, err)
+	require.Equal(t, MigrateSummary{Blocks: 5, Current: 2, Migrated: 3}, summary)
+	require.Equal(t, storage.FormatVersionSidecars, fs.ReadOrFail(t, roots[10]).FormatVersion(), "a dry run must not write")
+
+	opts.DryRun = false
+	summary, err = MigrateStorage(context.Background(), l, fs, 10, 14, storage.FormatVersionBlockHeader, opts)
+	require.NoError(t, err)
+	require.Equal(t, MigrateSummary{Blocks: 5, Current: 2, Migrated: 3}, summary)
+
+	for _, slot := range []uint64{10, 11, 12, 14} {
+		data := fs.ReadOrFail(t, roots[slot])
+		require.Equal(t, storage.FormatVersionBlockHeader, data.FormatVersion())
+		require.NoError(t, data.Header.VerifyBlockHeader())
+	}
+	require.Equal(t, before.BlobSidecars, fs.ReadOrFail(t, roots[10]).BlobSidecars)
+	require.Equal(t, storage.FormatVersionSidecars, fs.ReadOrFail(t, roots[20]).FormatVersion(), "blocks after the range must not be migrated")
+
+	// A second run has nothing to migrate
+	summary, err = MigrateStorage(context.Background(), l, fs, 10, 14, storage.FormatVersionBlockHeader, opts)
+	require.NoError(t, err)
+	require.Equal(t, MigrateSummary{Blocks: 5, Current: 5}, summary)
+
+	// Migrating back strips the headers
+	summary, err = MigrateStorage(context.Background(), l, fs, 10, 14, storage.FormatVersionSidecars, opts)
+	require.NoError(t, err)
+	require.Equal(t, 4, summary.Migrated)
+	require.Equal(t, before, fs.ReadOrFail(t, roots[10]))
+
+	_, err = MigrateStorage(context.Background(), l, fs, 10, 14, storage.LatestFormatVersion+1, opts)
+	require.ErrorContains(t, err, "unknown format version")
+
+	// A data store that cannot list its blocks cannot be migrated
+	_, err = MigrateStorage(context.Background(), l, &storage.GCSStorage{}, 10, 14, storage.FormatVersionBlockHeader, opts)
+	require.ErrorIs(t, err, storage.ErrExpiryUnsupported)
+}
+
+func TestMigrateStorage_ChecksReadBack(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs, _ := migrateFixture(t, l)
+
+	_, err := MigrateStorage(context.Background(), l, &headerDroppingStore{DataStore: fs}, 10, 10, storage.FormatVersionBlockHeader, MigrateOptions{Concurrency: 1})
+	require.ErrorContains(t, err, "did not read back as migrated")
+}
+
+func TestCheckMigrated_DataColumns(t *testing.T) {
+	columns := storagetest.NewDataColumnSidecars(t, 2, 0, 1)
+	written := storage.BlobData{
+		Header:             storage.Header{BeaconBlockHash: common.Hash{1}, Fork: "fulu"},
+		DataColumnSidecars: &storage.DataColumnSidecars{Data: columns},
+	}
+	require.NoError(t, checkMigrated(written, written, storage.FormatVersionSidecars))
+
+	readBack := written
+	readBack.DataColumnSidecars = nil
+	require.ErrorContains(t, checkMigrated(written, readBack, storage.FormatVersionSidecars), "read back with 0 data columns, 2 were written")
+
+	readBack.DataColumnSidecars = &storage.DataColumnSidecars{Data: columns[:1]}
+	require.ErrorContains(t, checkMigrated(written, readBack, storage.FormatVersionSidecars), "read back data columns differ")
+}
+
+func TestMigrateStorage_ResumesFromCheckpoint(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs, roots := migrateFixture(t, l)
+	checkpoint := filepath.Join(t.TempDir(), "migrate.json")
+
+	// Reading the block at slot 12 fails, which stops the migration after the tombstone and the blocks before it
+	opts := MigrateOptions{Concurrency: 1, Checkpoint: checkpoint}
+	summary, err := MigrateStorage(context.Background(), l, &failingStore{DataStore: fs, root: roots[12]}, 10, 14, storage.FormatVersionBlockHeader, opts)
+	require.ErrorContains(t, err, "slot 12")
+	require.Equal(t, MigrateSummary{Blocks: 3, Current: 2, Migrated: 1}, summary)
+
+	data, err := os.ReadFile(checkpoint)
+	require.NoError(t, err)
+	var saved migrateCheckpoint
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Equal(t, migrateCheckpoint{Start: 10, End: 14, Version: storage.FormatVersionBlockHeader, Next: 12}, saved)
+
+	// A dry run neither resumes from nor removes the checkpoint
+	dryRun := opts
+	dryRun.DryRun = true
+	summary, err = MigrateStorage(context.Background(), l, fs, 10, 14, storage.FormatVersionBlockHeader, dryRun)
+	require.NoError(t, err)
+	require.Equal(t, MigrateSummary{Blocks: 5, Current: 3, Migrated: 2}, summary)
+	_, err = os.Stat(checkpoint)
+	require.NoError(t, err)
+
+	// The tombstone has no slot, so it is checked again
+	summary, err = MigrateStorage(context.Background(), l, fs, 10, 14, storage.FormatVersionBlockHeader, opts)
+	require.NoError(t, err)
+	require.Equal(t, MigrateSummary{Blocks: 3, Current: 1, Migrated: 2}, summary)
+	require.Equal(t, storage.FormatVersionBlockHeader, fs.ReadOrFail(t, roots[14]).FormatVersion())
+
+	// The checkpoint is removed once the range is done
+	_, err = os.Stat(checkpoint)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// CheckStatus is the outcome of a single self-test check.
+type CheckStatus string
+
+const (
+	CheckPassed CheckStatus = "pass"
+	CheckFailed CheckStatus = "fail"
+	// CheckSkipped is a check that could not run because a check it depends on failed
+	CheckSkipped CheckStatus = "skip"
+)
+
+const (
+	CheckHealth       = "health"
+	CheckFetchJSON    = "fetch_json"
+	CheckFetchSSZ     = "fetch_ssz"
+	CheckFormatsMatch = "formats_match"
+	CheckKZG          = "kzg"
+)
+
+// CheckResult is the outcome of a single self-test check.
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Status   CheckStatus   `json:"status"`
+	Duration time.Duration `json:"duration"`
+	// Detail describes a passed check, or why a check failed or was skipped
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is the outcome of every check of a self-test, in the order they were run.
+type SelfTestReport struct {
+	Checks []CheckResult `json:"checks"`
+}
+
+// Passed returns true if every check passed.
+func (r SelfTestReport) Passed() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the names of the checks that failed or were skipped.
+func (r SelfTestReport) Failed() []string {
+	var result []string
+	for _, check := range r.Checks {
+		if check.Status != CheckPassed {
+			result = append(result, check.Name)
+		}
+	}
+	return result
+}
+
+// SelfTest checks that a blob service can be used by the validator's client: its health endpoint responds, the block
+// can be fetched in both JSON and SSZ, the two formats hold the same sidecars, and the blobs match their KZG
+// commitments and proofs. block must be a block that does not change between requests, i.e. a slot or root rather
+// than "head", and should have blobs for the KZG check to be meaningful. The health endpoint is requested with
+// httpClient, and URL credentials are sent as basic auth by both clients. Every check is run, even after a failure, so
+// that the report shows all the problems at once.
+func SelfTest(ctx context.Context, client blobclient.BlobSidecarClient, httpClient *http.Client, url string, block string) SelfTestReport {
+	var report SelfTestReport
+	run := func(name string, check func() (string, error)) bool {
+		start := time.Now()
+		detail, err := check()
+		result := CheckResult{Name: name, Status: CheckPassed, Duration: time.Since(start), Detail: detail}
+		if err != nil {
+			result.Status = CheckFailed
+			result.Detail = err.Error()
+		}
+		report.Checks = append(report.Checks, result)
+		return err == nil
+	}
+	skip := func(name string, reason string) {
+		report.Checks = append(report.Checks, CheckResult{Name: name, Status: CheckSkipped, Detail: reason})
+	}
+
+	run(CheckHealth, func() (string, error) {
+		return "", checkHealth(ctx, httpClient, url)
+	})
+
+	formats := make(map[blobformat.Format]storage.BlobSidecars)
+	fetch := func(format blobformat.Format) func() (string, error) {
+		return func() (string, error) {
+			status, sidecars, err := client.FetchSidecars(block, format)
+			if err != nil {
+				return "", fmt.Errorf("status %d: %w", status, err)
+			}
+			formats[format] = sidecars
+			return fmt.Sprintf("%d blobs", len(sidecars.Data)), nil
+		}
+	}
+	jsonOK := run(CheckFetchJSON, fetch(blobformat.JSON))
+	sszOK := run(CheckFetchSSZ, fetch(blobformat.SSZ))
+
+	if jsonOK && sszOK {
+		run(CheckFormatsMatch, func() (string, error) {
+			return "", sameSidecars(formats[blobformat.JSON], formats[blobformat.SSZ])
+		})
+	} else {
+		skip(CheckFormatsMatch, "both formats must be fetched")
+	}
+
+	// The SSZ response is preferred as it is what the validator requests by default
+	sidecars, ok := formats[blobformat.SSZ]
+	if !ok {
+		sidecars, ok = formats[blobformat.JSON]
+	}
+	if ok {
+		run(CheckKZG, func() (string, error) {
+			if len(sidecars.Data) == 0 {
+				return "", fmt.Errorf("block has no blobs to verify, choose a block with blobs")
+			}
+			if err := blobproof.VerifyBlobsBatch(sidecars.Data); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d blobs verified", len(sidecars.Data)), nil
+		})
+	} else {
+		skip(CheckKZG, "the block must be fetched")
+	}
+
+	return report
+}
+
+// checkHealth requests the health endpoint of the blob service at url.
+func checkHealth(ctx context.Context, httpClient *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sameSidecars returns an error if a and b do not encode to the same SSZ.
+func sameSidecars(a, b storage.BlobSidecars) error {
+	if len(a.Data) != len(b.Data) {
+		return fmt.Errorf("json has %d blobs, ssz has %d", len(a.Data), len(b.Data))
+	}
+
+	for i := range a.Data {
+		encodedA, err := a.Data[i].MarshalSSZ()
+		if err != nil {
+			return fmt.Errorf("failed to encode json sidecar %d: %w", i, err)
+		}
+		encodedB, err := b.Data[i].MarshalSSZ()
+		if err != nil {
+			return fmt.Errorf("failed to encode ssz sidecar %d: %w", i, err)
+		}
+		if !bytes.Equal(encodedA, encodedB) {
+			return fmt.Errorf("sidecar %d differs between json and ssz", i)
+		}
+	}
+	return nil
+}
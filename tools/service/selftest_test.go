@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/stretchr/testify/require"
+)
+
+// provenSidecars returns count sidecars with valid KZG commitments and proofs.
+func provenSidecars(t *testing.T, count int) storage.BlobSidecars {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, uint(count)))}
+	for _, sidecar := range sidecars.Data {
+		// Each field element must be less than the BLS modulus, so the first byte of each is zeroed
+		for j := 0; j < len(sidecar.Blob); j += 32 {
+			sidecar.Blob[j] = 0
+		}
+		blob := kzg4844.Blob(sidecar.Blob)
+		commitment, err := kzg4844.BlobToCommitment(blob)
+		require.NoError(t, err)
+		proof, err := kzg4844.ComputeBlobProof(blob, commitment)
+		require.NoError(t, err)
+		sidecar.KZGCommitment = deneb.KZGCommitment(commitment)
+		sidecar.KZGProof = deneb.KZGProof(proof)
+	}
+	return sidecars
+}
+
+// blobServer serves jsonSidecars in JSON and sszSidecars in SSZ, and health with the given status.
+func blobServer(t *testing.T, health int, jsonSidecars, sszSidecars storage.BlobSidecars) *httptest.Server {
+	ssz, err := sszSidecars.MarshalSSZ()
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/healthz":
+			w.WriteHeader(health)
+		case !strings.HasPrefix(r.URL.Path, "/eth/v1/beacon/blob_sidecars/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Accept") == string(blobformat.JSON):
+			_ = json.NewEncoder(w).Encode(jsonSidecars)
+		default:
+			_, _ = w.Write(ssz)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func statuses(report SelfTestReport) map[string]CheckStatus {
+	result := make(map[string]CheckStatus)
+	for _, check := range report.Checks {
+		result[check.Name] = check.Status
+	}
+	return result
+}
+
+func TestSelfTest_Passes(t *testing.T) {
+	sidecars := provenSidecars(t, 2)
+	srv := blobServer(t, http.StatusOK, sidecars, sidecars)
+
+	report := SelfTest(context.Background(), blobclient.NewBlobSidecarClient(srv.URL), srv.Client(), srv.URL, "10")
+	require.True(t, report.Passed(), "%+v", report)
+	require.Len(t, report.Checks, 5)
+	require.Equal(t, "2 blobs verified", report.Checks[4].Detail)
+}
+
+func TestSelfTest_ReportsEveryFailure(t *testing.T) {
+	sidecars := provenSidecars(t, 2)
+	// The SSZ response holds a corrupted blob
+	corrupted := provenSidecars(t, 2)
+	corrupted.Data[1].Blob[1] ^= 0xff
+	srv := blobServer(t, http.StatusServiceUnavailable, sidecars, corrupted)
+
+	report := SelfTest(context.Background(), blobclient.NewBlobSidecarClient(srv.URL), srv.Client(), srv.URL, "10")
+	require.False(t, report.Passed())
+	require.Equal(t, []string{CheckHealth, CheckFormatsMatch, CheckKZG}, report.Failed())
+	require.Equal(t, map[string]CheckStatus{
+		CheckHealth:       CheckFailed,
+		CheckFetchJSON:    CheckPassed,
+		CheckFetchSSZ:     CheckPassed,
+		CheckFormatsMatch: CheckFailed,
+		CheckKZG:          CheckFailed,
+	}, statuses(report))
+	require.Contains(t, report.Checks[4].Detail, "blob 1")
+}
+
+func TestSelfTest_SkipsDependentChecks(t *testing.T) {
+	srv := blobServer(t, http.StatusOK, storage.BlobSidecars{}, storage.BlobSidecars{})
+
+	report := SelfTest(context.Background(), blobclient.NewBlobSidecarClient(srv.URL+"/missing"), srv.Client(), srv.URL, "10")
+	require.Equal(t, map[string]CheckStatus{
+		CheckHealth:       CheckPassed,
+		CheckFetchJSON:    CheckFailed,
+		CheckFetchSSZ:     CheckFailed,
+		CheckFormatsMatch: CheckSkipped,
+		CheckKZG:          CheckSkipped,
+	}, statuses(report))
+	require.Contains(t, report.Checks[1].Detail, "status 404")
+}
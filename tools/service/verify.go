@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DiscrepancyStatus describes how the archive differs from the chain for a block.
+type DiscrepancyStatus string
+
+const (
+	// DiscrepancyMissing is a block with blobs that is not in the archive
+	DiscrepancyMissing DiscrepancyStatus = "missing"
+	// DiscrepancyMismatch is a block whose stored commitments do not exactly match those of the block body
+	DiscrepancyMismatch DiscrepancyStatus = "mismatch"
+)
+
+// Discrepancy is a block whose blobs in the archive are not faithful to the block on chain.
+type Discrepancy struct {
+	Slot   uint64            `json:"slot"`
+	Root   common.Hash       `json:"root"`
+	Status DiscrepancyStatus `json:"status"`
+	// Commitments is the number of blob commitments in the block body
+	Commitments int `json:"commitments"`
+	// Missing, Extra and Reordered are set for a mismatch, see blobproof.CommitmentMismatchError
+	Missing   []int    `json:"missing,omitempty"`
+	Extra     []uint64 `json:"extra,omitempty"`
+	Reordered []uint64 `json:"reordered,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// VerifySummary counts the blocks checked by VerifyAgainstBeacon.
+type VerifySummary struct {
+	// Slots is the number of slots that were checked, after sampling
+	Slots int `json:"slots"`
+	// Blocks is the number of checked slots that have a block
+	Blocks int `json:"blocks"`
+	// Verified is the number of blocks whose stored commitments match the block body, including blocks without blobs
+	Verified int `json:"verified"`
+	// Discrepancies is the number of blocks reported as a Discrepancy
+	Discrepancies int `json:"discrepancies"`
+}
+
+// VerifyOptions configures VerifyAgainstBeacon.
+type VerifyOptions struct {
+	// Concurrency is the number of slots checked at once
+	Concurrency int
+	// SampleRate is the fraction of slots in the range that are checked, chosen at random. Every slot is checked if it
+	// is 0 or 1.
+	SampleRate float64
+	// Seed seeds the choice of sampled slots, so that a sampled run can be repeated
+	Seed int64
+}
+
+// VerifyAgainstBeacon checks the archive against the chain history of the beacon node, for the canonical blocks in the
+// slot range [start, end]. The blob_kzg_commitments of each block body are fetched from the beacon node, and the
+// commitments of the stored sidecars must match them exactly, with blobproof.VerifyAgainstBlockBody. This confirms
+// that the archive holds all, and only, the blobs of each block, which comparing two blob endpoints cannot. Each
+// discrepancy is passed to report as soon as it is found, so they are not reported in slot order. An error is returned
+// if a slot cannot be checked.
+func VerifyAgainstBeacon(ctx context.Context, l log.Logger, beaconClient client.SignedBeaconBlockProvider, dataStore storage.DataStoreReader, start, end uint64, opts VerifyOptions, report func(Discrepancy)) (VerifySummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := slotRange(ctx, start, end)
+	if opts.SampleRate > 0 && opts.SampleRate < 1 {
+		slots = sampleSlots(ctx, slots, opts.SampleRate, opts.Seed)
+	}
+
+	var (
+		mu       sync.Mutex
+		summary  VerifySummary
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < max(opts.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slots {
+				block, discrepancy, err := verifySlot(ctx, beaconClient, dataStore, slot)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					summary.Slots++
+					if block {
+						summary.Blocks++
+					}
+					if discrepancy != nil {
+						summary.Discrepancies++
+						report(*discrepancy)
+					} else if block {
+						summary.Verified++
+					}
+				}
+				mu.Unlock()
+
+				if block {
+					l.Debug("verified block", "slot", slot, "faithful", discrepancy == nil)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return summary, firstErr
+}
+
+// sampleSlots returns a channel that yields each slot from slots with probability rate, using a source seeded with
+// seed.
+func sampleSlots(ctx context.Context, slots <-chan uint64, rate float64, seed int64) <-chan uint64 {
+	sampled := make(chan uint64)
+	go func() {
+		defer close(sampled)
+		random := rand.New(rand.NewSource(seed))
+		for slot := range slots {
+			if random.Float64() >= rate {
+				continue
+			}
+			select {
+			case sampled <- slot:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return sampled
+}
+
+// verifySlot checks the stored sidecars of the block at slot against its block body. It returns whether the slot has a
+// block, and a Discrepancy if the archive is not faithful to it.
+func verifySlot(ctx context.Context, beaconClient client.SignedBeaconBlockProvider, dataStore storage.DataStoreReader, slot uint64) (bool, *Discrepancy, error) {
+	response, err := beaconClient.SignedBeaconBlock(ctx, &api.SignedBeaconBlockOpts{
+		Block: strconv.FormatUint(slot, 10),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return false, nil, nil
+		}
+
+		return false, nil, fmt.Errorf("failed to fetch block for slot %d: %w", slot, err)
+	}
+
+	root, err := response.Data.Root()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to compute root of block at slot %d: %w", slot, err)
+	}
+
+	var commitments [][]byte
+	if response.Data.Version >= spec.DataVersionDeneb {
+		blockCommitments, err := response.Data.BlobKZGCommitments()
+		if err != nil {
+			return false, nil, fmt.Errorf("failed to read commitments of block at slot %d: %w", slot, err)
+		}
+		for i := range blockCommitments {
+			commitments = append(commitments, blockCommitments[i][:])
+		}
+	}
+
+	discrepancy := &Discrepancy{Slot: slot, Root: common.Hash(root), Commitments: len(commitments)}
+	data, err := dataStore.ReadBlob(ctx, common.Hash(root))
+	if errors.Is(err, storage.ErrNotFound) {
+		if len(commitments) == 0 {
+			// A block without blobs need not be stored
+			return true, nil, nil
+		}
+		discrepancy.Status = DiscrepancyMissing
+		return true, discrepancy, nil
+	} else if err != nil {
+		return false, nil, fmt.Errorf("failed to read slot %d (%s): %w", slot, discrepancy.Root, err)
+	}
+
+	err = blobproof.VerifyAgainstBlockBody(data.BlobSidecars, commitments)
+	var mismatch *blobproof.CommitmentMismatchError
+	if errors.As(err, &mismatch) {
+		discrepancy.Status = DiscrepancyMismatch
+		discrepancy.Missing, discrepancy.Extra, discrepancy.Reordered = mismatch.Missing, mismatch.Extra, mismatch.Reordered
+		discrepancy.Error = mismatch.Error()
+		return true, discrepancy, nil
+	} else if err != nil {
+		return false, nil, fmt.Errorf("failed to verify slot %d (%s): %w", slot, discrepancy.Root, err)
+	}
+
+	return true, nil, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// stubBlockProvider serves blocks by slot, and a 404 for any other slot.
+type stubBlockProvider struct {
+	blocks map[string]*spec.VersionedSignedBeaconBlock
+}
+
+func (s *stubBlockProvider) SignedBeaconBlock(_ context.Context, opts *api.SignedBeaconBlockOpts) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+	block, ok := s.blocks[opts.Block]
+	if !ok {
+		return nil, &api.Error{StatusCode: http.StatusNotFound}
+	}
+	return &api.Response[*spec.VersionedSignedBeaconBlock]{Data: block}, nil
+}
+
+// addBlock adds a block at slot with blobCount commitments, and returns its root and the sidecars that match it.
+func (s *stubBlockProvider) addBlock(t *testing.T, slot uint64, blobCount int) (common.Hash, storage.BlobSidecars) {
+	sidecars := storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, uint(blobCount)))}
+	var commitments []deneb.KZGCommitment
+	for _, sidecar := range sidecars.Data {
+		commitments = append(commitments, sidecar.KZGCommitment)
+	}
+
+	block := &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionDeneb,
+		Deneb: &deneb.SignedBeaconBlock{
+			Message: &deneb.BeaconBlock{
+				Slot: phase0.Slot(slot),
+				Body: &deneb.BeaconBlockBody{
+					ETH1Data:           &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+					SyncAggregate:      &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+					ExecutionPayload:   &deneb.ExecutionPayload{BaseFeePerGas: uint256.NewInt(7)},
+					BlobKZGCommitments: commitments,
+				},
+			},
+		},
+	}
+	root, err := block.Root()
+	require.NoError(t, err)
+
+	s.blocks[strconv.FormatUint(slot, 10)] = block
+	return common.Hash(root), sidecars
+}
+
+func TestVerifyAgainstBeacon(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := &stubBlockProvider{blocks: make(map[string]*spec.VersionedSignedBeaconBlock)}
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	write := func(root common.Hash, sidecars storage.BlobSidecars) {
+		fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: root}, BlobSidecars: sidecars})
+	}
+
+	// Slot 1 is stored faithfully
+	root, faithful := beacon.addBlock(t, 1, 2)
+	write(root, faithful)
+	// Slot 2 has no blobs, and need not be stored
+	beacon.addBlock(t, 2, 0)
+	// Slot 3 is not stored
+	missingRoot, _ := beacon.addBlock(t, 3, 1)
+	// Slot 4 is stored without its last blob
+	partialRoot, sidecars := beacon.addBlock(t, 4, 3)
+	write(partialRoot, storage.BlobSidecars{Data: sidecars.Data[:2]})
+	// Slot 5 is stored with the blobs of slot 1
+	swappedRoot, _ := beacon.addBlock(t, 5, 2)
+	write(swappedRoot, faithful)
+	// Slot 6 has no block
+
+	var discrepancies []Discrepancy
+	summary, err := VerifyAgainstBeacon(context.Background(), l, beacon, fs, 1, 6, VerifyOptions{Concurrency: 3}, func(d Discrepancy) {
+		discrepancies = append(discrepancies, d)
+	})
+	require.NoError(t, err)
+	require.Equal(t, VerifySummary{Slots: 6, Blocks: 5, Verified: 2, Discrepancies: 3}, summary)
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].Slot < discrepancies[j].Slot
+	})
+	require.Len(t, discrepancies, 3)
+
+	require.Equal(t, Discrepancy{Slot: 3, Root: missingRoot, Status: DiscrepancyMissing, Commitments: 1}, discrepancies[0])
+
+	require.Equal(t, partialRoot, discrepancies[1].Root)
+	require.Equal(t, DiscrepancyMismatch, discrepancies[1].Status)
+	require.Equal(t, 3, discrepancies[1].Commitments)
+	require.Equal(t, []int{2}, discrepancies[1].Missing)
+	require.Empty(t, discrepancies[1].Extra)
+
+	require.Equal(t, swappedRoot, discrepancies[2].Root)
+	require.Equal(t, DiscrepancyMismatch, discrepancies[2].Status)
+	require.Equal(t, []int{0, 1}, discrepancies[2].Missing)
+	require.Equal(t, []uint64{0, 1}, discrepancies[2].Extra)
+	require.NotEmpty(t, discrepancies[2].Error)
+}
+
+func TestVerifyAgainstBeacon_Sampling(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := &stubBlockProvider{blocks: make(map[string]*spec.VersionedSignedBeaconBlock)}
+	fs := storagetest.NewTestFileStorage(t, l)
+	for slot := uint64(1); slot <= 100; slot++ {
+		beacon.addBlock(t, slot, 0)
+	}
+
+	verify := func(seed int64) VerifySummary {
+		summary, err := VerifyAgainstBeacon(context.Background(), l, beacon, fs, 1, 100, VerifyOptions{Concurrency: 2, SampleRate: 0.2, Seed: seed}, func(Discrepancy) {})
+		require.NoError(t, err)
+		return summary
+	}
+
+	summary := verify(42)
+	require.Greater(t, summary.Slots, 0)
+	require.Less(t, summary.Slots, 50)
+	require.Equal(t, summary.Slots, summary.Verified)
+	// The same seed samples the same slots
+	require.Equal(t, summary, verify(42))
+}
+
+func TestVerifyAgainstBeacon_Error(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := &stubBlockProvider{blocks: make(map[string]*spec.VersionedSignedBeaconBlock)}
+	beacon.addBlock(t, 1, 1)
+	// A block that cannot be read is an error, not a discrepancy
+	beacon.blocks["2"] = &spec.VersionedSignedBeaconBlock{Version: spec.DataVersionDeneb}
+
+	_, err := VerifyAgainstBeacon(context.Background(), l, beacon, storagetest.NewTestFileStorage(t, l), 1, 2, VerifyOptions{Concurrency: 1}, func(Discrepancy) {})
+	require.ErrorContains(t, err, "slot 2")
+}
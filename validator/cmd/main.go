@@ -3,9 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/base-org/blob-archiver/validator/flags"
 	"github.com/base-org/blob-archiver/validator/service"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
@@ -47,6 +53,23 @@ func Main() cliapp.LifecycleAction {
 			return nil, fmt.Errorf("config check failed: %w", err)
 		}
 
+		// The formats, consistency, API version and proxy are valid once the config is checked
+		formats := make([]blobformat.Format, len(cfg.Formats))
+		for i, name := range cfg.Formats {
+			formats[i], _ = blobformat.Parse(name)
+		}
+		consistency, _ := storage.ParseConsistency(cfg.BlobConsistency)
+		apiVersion, _ := blobclient.ParseAPIVersion(cfg.BeaconAPIVersion)
+
+		forkDigests := make([]phase0.ForkDigest, len(cfg.ForkDigests))
+		for i, s := range cfg.ForkDigests {
+			digest, err := service.ParseForkDigest(s)
+			if err != nil {
+				return nil, fmt.Errorf("config check failed: %w", err)
+			}
+			forkDigests[i] = digest
+		}
+
 		l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
 		oplog.SetGlobalLogHandler(l.Handler())
 		opservice.ValidateEnvVars(flags.EnvVarPrefix, flags.Flags, l)
@@ -56,9 +79,66 @@ func Main() cliapp.LifecycleAction {
 			return nil, fmt.Errorf("failed to create beacon client: %w", err)
 		}
 
-		beaconClient := service.NewBlobSidecarClient(cfg.BeaconConfig.BeaconURL)
-		blobClient := service.NewBlobSidecarClient(cfg.BlobConfig.BeaconURL)
+		dialOpts := []blobclient.ClientOption{blobclient.WithContext(cliCtx.Context), blobclient.WithDialTimeout(cfg.DialTimeout), blobclient.WithDualStack(cfg.DualStack), blobclient.WithRetries(cfg.Retry), blobclient.WithLogger(l.New("component", "client"))}
+		if cfg.ProxyURL != "" {
+			proxyURL, _ := url.Parse(cfg.ProxyURL)
+			l.Info("Sending requests through proxy", "proxy", proxyURL.Redacted())
+			dialOpts = append(dialOpts, blobclient.WithProxy(proxyURL))
+		}
+		if cfg.RecordDir != "" {
+			l.Info("Recording requests", "dir", cfg.RecordDir)
+			dialOpts = append(dialOpts, blobclient.WithRecorder(cfg.RecordDir))
+		}
+		clientOpts := append([]blobclient.ClientOption{blobclient.WithDeduplication(), blobclient.WithAllowedForks(cfg.AllowedForks)}, dialOpts...)
+		beaconClient := blobclient.NewBlobSidecarClient(cfg.BeaconConfig.BeaconURL, append([]blobclient.ClientOption{blobclient.WithAPIVersion(apiVersion)}, clientOpts...)...)
+		// Only reads from the blob APIs can be served from a cache
+		blobOpts := append([]blobclient.ClientOption{blobclient.WithConsistency(consistency)}, clientOpts...)
+		var blobClient blobclient.BlobSidecarClient
+		var status http.Handler
+		if len(cfg.BlobURLs) > 1 {
+			fallback := blobclient.NewFallbackBlobSidecarClient(cfg.BlobURLs, blobOpts...)
+			blobClient, status = fallback, fallback
+		} else {
+			blobClient = blobclient.NewBlobSidecarClient(cfg.BlobConfig.BeaconURL, blobOpts...)
+		}
+
+		validator := service.NewValidator(l.New("component", "validator"), headerClient, beaconClient, blobClient, closeApp, cfg.NumBlocks)
+		validator.ValidateFormats(formats)
+		validator.VerifyForkDigests(forkDigests)
+		if cfg.WebhookURL != "" {
+			validator.WithWebhook(cfg.WebhookURL, service.WebhookConfig{
+				Timeout:     cfg.WebhookTimeout,
+				Attempts:    cfg.WebhookAttempts,
+				DedupWindow: cfg.WebhookDedupWindow,
+			})
+		}
+		if cfg.StatusAddr != "" && status != nil {
+			validator.ServeStatus(cfg.StatusAddr, status)
+		}
+		if cfg.Daemon {
+			l.Info("Running as a daemon", "interval", cfg.DaemonInterval, "historicalSamples", cfg.DaemonHistoricalSamples, "historicalSlots", cfg.DaemonHistoricalSlots)
+			validator.RunAsDaemon(service.DaemonConfig{
+				Interval:          cfg.DaemonInterval,
+				HistoricalSamples: cfg.DaemonHistoricalSamples,
+				HistoricalSlots:   cfg.DaemonHistoricalSlots,
+			})
+		}
+		if cfg.VerifyKZG {
+			l.Info("Verifying KZG and inclusion proofs", "fork", cfg.KZGFork)
+			validator.VerifyKZG(cfg.KZGFork)
+		}
+		if cfg.MetricsConfig.Enabled {
+			validator.ServeMetrics(cfg.MetricsConfig.ListenAddr, cfg.MetricsConfig.ListenPort)
+		}
+
+		if len(cfg.QuorumURLs) > 0 {
+			quorumClients := make([]blobclient.BlobSidecarClient, len(cfg.QuorumURLs))
+			for i, url := range cfg.QuorumURLs {
+				quorumClients[i] = blobclient.NewBlobSidecarClient(url, append([]blobclient.ClientOption{blobclient.WithAllowedForks(cfg.AllowedForks), blobclient.WithAPIVersion(apiVersion)}, dialOpts...)...)
+			}
+			validator.UseQuorum(quorumClients, cfg.QuorumThreshold)
+		}
 
-		return service.NewValidator(l, headerClient, beaconClient, blobClient, closeApp, cfg.NumBlocks), nil
+		return validator, nil
 	}
 }
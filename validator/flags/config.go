@@ -2,10 +2,17 @@ package flags
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobproof"
 	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/urfave/cli/v2"
 )
 
@@ -13,10 +20,83 @@ type ValidatorConfig struct {
 	LogConfig    oplog.CLIConfig
 	BeaconConfig common.BeaconConfig
 	BlobConfig   common.BeaconConfig
+	BlobURLs     []string
+	StatusAddr   string
 	NumBlocks    int
+	// Formats are the formats to compare the blobs in, as given by the user, see blobformat.Parse
+	Formats     []string
+	DialTimeout time.Duration
+	DualStack   bool
+	// Retry configures the timeout and retries of the requests to the beacon-nodes and blob APIs
+	Retry blobclient.RetryConfig
+	// ProxyURL is the URL of the proxy requests are sent through, taken from the environment if empty
+	ProxyURL string
+
+	// BlobConsistency is the consistency level of reads from the blob APIs, see storage.ParseConsistency
+	BlobConsistency string
+
+	// BeaconAPIVersion is the version of the blob sidecars endpoint requested from the beacon-nodes, see
+	// blobclient.ParseAPIVersion
+	BeaconAPIVersion string
+
+	// AllowedForks are the forks that responses must be from, any fork is allowed if empty
+	AllowedForks []string
+	// ForkDigests are the hex encoded fork digests that the beacon-node must be on, not checked if empty
+	ForkDigests []string
+
+	// QuorumURLs are the additional beacon-node URLs used to form a quorum, QuorumThreshold of them (including the
+	// primary beacon-node) must agree
+	QuorumURLs      []string
+	QuorumThreshold int
+
+	// RecordDir is the directory requests and responses are recorded to, disabled if empty
+	RecordDir string
+
+	// WebhookURL is the URL validation failures are posted to, disabled if empty
+	WebhookURL         string
+	WebhookTimeout     time.Duration
+	WebhookAttempts    int
+	WebhookDedupWindow time.Duration
+
+	// Daemon runs the validator continuously, see service.ValidatorService.RunAsDaemon
+	Daemon                  bool
+	DaemonInterval          time.Duration
+	DaemonHistoricalSamples int
+	DaemonHistoricalSlots   uint64
+
+	// VerifyKZG verifies the proofs of the sidecars from the blob API, see service.ValidatorService.VerifyKZG
+	VerifyKZG bool
+	// KZGFork is the fork whose block body layout inclusion proofs are verified against
+	KZGFork string
+
+	MetricsConfig opmetrics.CLIConfig
 }
 
 func (c ValidatorConfig) Check() error {
+	if len(c.Formats) == 0 {
+		return fmt.Errorf("at least one format must be set")
+	}
+
+	for _, format := range c.Formats {
+		if _, err := blobformat.Parse(format); err != nil {
+			return err
+		}
+	}
+
+	if _, err := storage.ParseConsistency(c.BlobConsistency); err != nil {
+		return err
+	}
+
+	if _, err := blobclient.ParseAPIVersion(c.BeaconAPIVersion); err != nil {
+		return err
+	}
+
+	if c.ProxyURL != "" {
+		if err := checkProxyURL(c.ProxyURL); err != nil {
+			return err
+		}
+	}
+
 	if err := c.BeaconConfig.Check(); err != nil {
 		return fmt.Errorf("beacon config check failed: %w", err)
 	}
@@ -25,15 +105,105 @@ func (c ValidatorConfig) Check() error {
 		return fmt.Errorf("blob config check failed: %w", err)
 	}
 
+	for _, url := range c.BlobURLs {
+		if url == "" {
+			return fmt.Errorf("blob api urls must not be empty")
+		}
+	}
+
+	if len(c.QuorumURLs) > 0 && (c.QuorumThreshold < 1 || c.QuorumThreshold > len(c.QuorumURLs)+1) {
+		return fmt.Errorf("quorum threshold must be between 1 and %d", len(c.QuorumURLs)+1)
+	}
+
+	if c.DialTimeout <= 0 {
+		return fmt.Errorf("dial timeout must be greater than 0")
+	}
+
+	if c.Retry.Timeout < 0 {
+		return fmt.Errorf("request timeout must not be negative")
+	}
+
+	if c.Retry.MaxRetries < 0 {
+		return fmt.Errorf("request retries must not be negative")
+	}
+
+	if c.Retry.MaxRetries > 0 && (c.Retry.MinBackoff <= 0 || c.Retry.MaxBackoff < c.Retry.MinBackoff) {
+		return fmt.Errorf("retry min backoff must be greater than 0 and not above the max backoff")
+	}
+
+	if c.WebhookURL != "" {
+		if err := checkWebhookURL(c.WebhookURL); err != nil {
+			return err
+		}
+
+		if c.WebhookTimeout <= 0 {
+			return fmt.Errorf("webhook timeout must be greater than 0")
+		}
+
+		if c.WebhookAttempts < 1 {
+			return fmt.Errorf("webhook attempts must be at least 1")
+		}
+
+		if c.WebhookDedupWindow < 0 {
+			return fmt.Errorf("webhook dedup window must not be negative")
+		}
+	}
+
 	if c.NumBlocks <= 0 {
 		return fmt.Errorf("number of blocks must be greater than 0")
 	}
 
+	if c.Daemon {
+		if c.DaemonInterval <= 0 {
+			return fmt.Errorf("daemon interval must be greater than 0")
+		}
+
+		if c.DaemonHistoricalSamples < 0 {
+			return fmt.Errorf("daemon historical samples must not be negative")
+		}
+	}
+
+	if c.VerifyKZG {
+		if _, err := blobproof.InclusionProofDepth(c.KZGFork); err != nil {
+			return fmt.Errorf("invalid verify kzg fork: %w", err)
+		}
+	}
+
+	if err := c.MetricsConfig.Check(); err != nil {
+		return fmt.Errorf("metrics config check failed: %w", err)
+	}
+
 	return nil
 }
 
 func ReadConfig(cliCtx *cli.Context) ValidatorConfig {
 	timeout, _ := time.ParseDuration(cliCtx.String(BeaconClientTimeoutFlag.Name))
+	dialTimeout, _ := time.ParseDuration(cliCtx.String(DialTimeoutFlag.Name))
+
+	var quorumURLs []string
+	if urls := cliCtx.String(QuorumBeaconUrlsFlag.Name); urls != "" {
+		quorumURLs = strings.Split(urls, ",")
+	}
+
+	quorumThreshold := cliCtx.Int(QuorumThresholdFlag.Name)
+	if quorumThreshold == 0 {
+		// A majority of the primary beacon-node and the quorum beacon-nodes
+		quorumThreshold = (len(quorumURLs)+1)/2 + 1
+	}
+
+	var allowedForks []string
+	for _, fork := range strings.Split(cliCtx.String(AllowedForksFlag.Name), ",") {
+		if fork = strings.ToLower(strings.TrimSpace(fork)); fork != "" {
+			allowedForks = append(allowedForks, fork)
+		}
+	}
+
+	var forkDigests []string
+	for _, s := range strings.Split(cliCtx.String(ForkDigestsFlag.Name), ",") {
+		if strings.TrimSpace(s) != "" {
+			forkDigests = append(forkDigests, s)
+		}
+	}
 
 	return ValidatorConfig{
 		LogConfig: oplog.ReadCLIConfig(cliCtx),
@@ -45,6 +215,69 @@ func ReadConfig(cliCtx *cli.Context) ValidatorConfig {
 			BeaconURL:           cliCtx.String(BlobApiClientUrlFlag.Name),
 			BeaconClientTimeout: timeout,
 		},
-		NumBlocks: cliCtx.Int(NumBlocksClientFlag.Name),
+		BlobURLs:   strings.Split(cliCtx.String(BlobApiClientUrlFlag.Name), ","),
+		StatusAddr: cliCtx.String(StatusAddrFlag.Name),
+		NumBlocks:  cliCtx.Int(NumBlocksClientFlag.Name),
+		Formats:    strings.Split(cliCtx.String(FormatsFlag.Name), ","),
+
+		BlobConsistency:  cliCtx.String(BlobApiConsistencyFlag.Name),
+		BeaconAPIVersion: cliCtx.String(BeaconApiVersionFlag.Name),
+
+		DialTimeout: dialTimeout,
+		DualStack:   cliCtx.Bool(DualStackFlag.Name),
+		Retry: blobclient.RetryConfig{
+			Timeout:    cliCtx.Duration(RequestTimeoutFlag.Name),
+			MaxRetries: cliCtx.Int(RequestRetriesFlag.Name),
+			MinBackoff: cliCtx.Duration(RetryMinBackoffFlag.Name),
+			MaxBackoff: cliCtx.Duration(RetryMaxBackoffFlag.Name),
+		},
+		ProxyURL: cliCtx.String(ProxyFlag.Name),
+
+		AllowedForks: allowedForks,
+		ForkDigests:  forkDigests,
+
+		QuorumURLs:      quorumURLs,
+		QuorumThreshold: quorumThreshold,
+
+		RecordDir: cliCtx.String(RecordDirFlag.Name),
+
+		WebhookURL:         cliCtx.String(WebhookUrlFlag.Name),
+		WebhookTimeout:     cliCtx.Duration(WebhookTimeoutFlag.Name),
+		WebhookAttempts:    cliCtx.Int(WebhookAttemptsFlag.Name),
+		WebhookDedupWindow: cliCtx.Duration(WebhookDedupWindowFlag.Name),
+
+		Daemon:                  cliCtx.Bool(DaemonFlag.Name),
+		DaemonInterval:          cliCtx.Duration(DaemonIntervalFlag.Name),
+		DaemonHistoricalSamples: cliCtx.Int(DaemonHistoricalSamplesFlag.Name),
+		DaemonHistoricalSlots:   cliCtx.Uint64(DaemonHistoricalSlotsFlag.Name),
+
+		VerifyKZG: cliCtx.Bool(VerifyKZGFlag.Name),
+		KZGFork:   strings.ToLower(strings.TrimSpace(cliCtx.String(VerifyKZGForkFlag.Name))),
+
+		MetricsConfig: opmetrics.ReadCLIConfig(cliCtx),
 	}
 }
+
+// checkProxyURL checks that s is the URL of an HTTP(S) proxy.
+func checkProxyURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid proxy url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid proxy url: must be an http:// or https:// url with a host")
+	}
+	return nil
+}
+
+// checkWebhookURL checks that s is the URL of an HTTP(S) webhook.
+func checkWebhookURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url: must be an http:// or https:// url with a host")
+	}
+	return nil
+}
@@ -1,8 +1,11 @@
 package flags
 
 import (
+	"time"
+
+	common "github.com/base-org/blob-archiver/common/flags"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
-	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/urfave/cli/v2"
 )
 
@@ -15,18 +18,164 @@ var (
 		Value:   "10s",
 		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CLIENT_TIMEOUT"),
 	}
+	DialTimeoutFlag = &cli.StringFlag{
+		Name:    "dial-timeout",
+		Usage:   "The timeout for establishing a connection to the Beacon-node and Blob APIs",
+		Value:   "30s",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DIAL_TIMEOUT"),
+	}
+	DualStackFlag = &cli.BoolFlag{
+		Name:    "dual-stack",
+		Usage:   "Try IPv4 and IPv6 addresses in parallel when the first is slow to connect (happy eyeballs). Disable to try the addresses one after another",
+		Value:   true,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DUAL_STACK"),
+	}
+	RequestTimeoutFlag = &cli.DurationFlag{
+		Name:    "request-timeout",
+		Usage:   "The timeout of each request to the Beacon-node and Blob APIs, including reading the response, 0 disables the timeout",
+		Value:   60 * time.Second,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "REQUEST_TIMEOUT"),
+	}
+	RequestRetriesFlag = &cli.IntFlag{
+		Name:    "request-retries",
+		Usage:   "The number of times a request to the Beacon-node and Blob APIs is retried after a connection error, a 5xx or a 429, 0 disables retries",
+		Value:   3,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "REQUEST_RETRIES"),
+	}
+	RetryMinBackoffFlag = &cli.DurationFlag{
+		Name:    "retry-min-backoff",
+		Usage:   "The delay before the first retry of a request, which doubles with each retry and is jittered",
+		Value:   500 * time.Millisecond,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RETRY_MIN_BACKOFF"),
+	}
+	RetryMaxBackoffFlag = &cli.DurationFlag{
+		Name:    "retry-max-backoff",
+		Usage:   "The longest delay between retries of a request. A longer Retry-After from the server is honored, up to 5m",
+		Value:   30 * time.Second,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RETRY_MAX_BACKOFF"),
+	}
+	ProxyFlag = &cli.StringFlag{
+		Name:    "http-proxy",
+		Usage:   "URL of a proxy to send requests to the Beacon-node and Blob APIs through. Defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "HTTP_PROXY"),
+	}
 	L1BeaconClientUrlFlag = &cli.StringFlag{
 		Name:     "l1-beacon-http",
 		Usage:    "URL for a L1 Beacon-node API",
 		Required: true,
 		EnvVars:  opservice.PrefixEnvVar(EnvVarPrefix, "L1_BEACON_HTTP"),
 	}
+	BeaconApiVersionFlag = &cli.StringFlag{
+		Name:    "beacon-api-version",
+		Usage:   "The version of the Beacon-node blob_sidecars endpoint to request, options are [v1, v2]. Pins the Beacon-nodes to /eth/v1 or a future /eth/v2 path",
+		Value:   "v1",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BEACON_API_VERSION"),
+	}
 	BlobApiClientUrlFlag = &cli.StringFlag{
 		Name:     "blob-api-http",
-		Usage:    "URL for a Blob API",
+		Usage:    "URL for a Blob API, multiple comma separated URLs can be given to fall back between blob services",
 		Required: true,
 		EnvVars:  opservice.PrefixEnvVar(EnvVarPrefix, "BLOB_API_HTTP"),
 	}
+	BlobApiConsistencyFlag = &cli.StringFlag{
+		Name:    "blob-api-consistency",
+		Usage:   "The consistency level of reads from the Blob API, options are [cached, fresh]. fresh bypasses any cache in front of the Blob API's source, at the cost of latency",
+		Value:   "cached",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BLOB_API_CONSISTENCY"),
+	}
+	QuorumBeaconUrlsFlag = &cli.StringFlag{
+		Name:    "quorum-beacon-http",
+		Usage:   "Comma separated URLs of additional independent Beacon-node APIs. When set, a discrepancy is only reported if the Blob API disagrees with a quorum of the Beacon-nodes",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "QUORUM_BEACON_HTTP"),
+	}
+	QuorumThresholdFlag = &cli.IntFlag{
+		Name:    "quorum-threshold",
+		Usage:   "The number of Beacon-nodes that must agree to form a quorum, defaults to a majority",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "QUORUM_THRESHOLD"),
+	}
+	StatusAddrFlag = &cli.StringFlag{
+		Name:    "status-addr",
+		Usage:   "Address to serve the blob API endpoint scoreboard on at /status, disabled if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STATUS_ADDR"),
+	}
+	FormatsFlag = &cli.StringFlag{
+		Name:    "formats",
+		Usage:   "Comma separated formats to compare the blobs in, options are [json, ssz, ssz_snappy, auto] or their media types. auto requests ssz and falls back to json for servers with broken ssz",
+		Value:   "json,ssz",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "FORMATS"),
+	}
+	AllowedForksFlag = &cli.StringFlag{
+		Name:    "allowed-forks",
+		Usage:   "Comma separated forks, e.g. deneb,electra, that responses must be from. Checked against the Eth-Consensus-Version header, any fork is allowed if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "ALLOWED_FORKS"),
+	}
+	ForkDigestsFlag = &cli.StringFlag{
+		Name:    "fork-digests",
+		Usage:   "Comma separated hex fork digests, one of which the Beacon-node must be on at startup, to check that it is on the expected network. Not checked if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "FORK_DIGESTS"),
+	}
+	RecordDirFlag = &cli.StringFlag{
+		Name:    "record-dir",
+		Usage:   "Directory to save every request and response to, with credentials redacted, so that failures can be replayed offline. Disabled if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RECORD_DIR"),
+	}
+	WebhookUrlFlag = &cli.StringFlag{
+		Name:    "webhook-url",
+		Usage:   "URL to POST each validation failure to as JSON, e.g. to page on-call or feed an incident system. Disabled if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WEBHOOK_URL"),
+	}
+	WebhookTimeoutFlag = &cli.DurationFlag{
+		Name:    "webhook-timeout",
+		Usage:   "The timeout of each attempt to POST a failure to the webhook",
+		Value:   10 * time.Second,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WEBHOOK_TIMEOUT"),
+	}
+	WebhookAttemptsFlag = &cli.IntFlag{
+		Name:    "webhook-attempts",
+		Usage:   "The number of attempts to POST a failure to the webhook before it is dropped",
+		Value:   3,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WEBHOOK_ATTEMPTS"),
+	}
+	WebhookDedupWindowFlag = &cli.DurationFlag{
+		Name:    "webhook-dedup-window",
+		Usage:   "The time for which further failures of a slot are not sent to the webhook after the first. 0 sends every failure",
+		Value:   time.Hour,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WEBHOOK_DEDUP_WINDOW"),
+	}
+	DaemonFlag = &cli.BoolFlag{
+		Name:    "daemon",
+		Usage:   "Run continuously, checking the newly finalized slots and a sample of historical slots on every interval and exporting the results as Prometheus metrics, rather than checking num-blocks slots once and exiting",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DAEMON"),
+	}
+	DaemonIntervalFlag = &cli.DurationFlag{
+		Name:    "daemon-interval",
+		Usage:   "The time between rounds of checks in daemon mode",
+		Value:   time.Minute,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DAEMON_INTERVAL"),
+	}
+	DaemonHistoricalSamplesFlag = &cli.IntFlag{
+		Name:    "daemon-historical-samples",
+		Usage:   "The number of slots sampled at random from the history in each round of checks in daemon mode",
+		Value:   10,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DAEMON_HISTORICAL_SAMPLES"),
+	}
+	DaemonHistoricalSlotsFlag = &cli.Uint64Flag{
+		Name:    "daemon-historical-slots",
+		Usage:   "How many slots back from the finalized slot the historical samples are taken from in daemon mode. Should be within the blob retention of the Beacon-node, 4096 epochs on mainnet",
+		Value:   128000,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DAEMON_HISTORICAL_SLOTS"),
+	}
+	VerifyKZGFlag = &cli.BoolFlag{
+		Name:    "verify-kzg",
+		Usage:   "Verify the KZG proof of each blob from the Blob API and the inclusion proof of its commitment against the signed block header, to detect corruption even when the Beacon-node is unavailable",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "VERIFY_KZG"),
+	}
+	VerifyKZGForkFlag = &cli.StringFlag{
+		Name:    "verify-kzg-fork",
+		Usage:   "The fork whose block body layout commitment inclusion proofs are verified against with --verify-kzg, options are [deneb, electra]. Both place the commitments at the same position",
+		Value:   "deneb",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "VERIFY_KZG_FORK"),
+	}
 	NumBlocksClientFlag = &cli.IntFlag{
 		Name:     "num-blocks",
 		Usage:    "The number of blocks to read blob data for",
@@ -37,8 +186,9 @@ var (
 )
 
 func init() {
-	Flags = append(Flags, oplog.CLIFlags(EnvVarPrefix)...)
-	Flags = append(Flags, BeaconClientTimeoutFlag, L1BeaconClientUrlFlag, BlobApiClientUrlFlag, NumBlocksClientFlag)
+	Flags = append(Flags, common.LogFlags(EnvVarPrefix)...)
+	Flags = append(Flags, BeaconClientTimeoutFlag, DialTimeoutFlag, DualStackFlag, RequestTimeoutFlag, RequestRetriesFlag, RetryMinBackoffFlag, RetryMaxBackoffFlag, ProxyFlag, L1BeaconClientUrlFlag, BeaconApiVersionFlag, BlobApiClientUrlFlag, BlobApiConsistencyFlag, QuorumBeaconUrlsFlag, QuorumThresholdFlag, StatusAddrFlag, FormatsFlag, AllowedForksFlag, ForkDigestsFlag, RecordDirFlag, WebhookUrlFlag, WebhookTimeoutFlag, WebhookAttemptsFlag, WebhookDedupWindowFlag, DaemonFlag, DaemonIntervalFlag, DaemonHistoricalSamplesFlag, DaemonHistoricalSlotsFlag, VerifyKZGFlag, VerifyKZGForkFlag, NumBlocksClientFlag)
+	Flags = append(Flags, opmetrics.CLIFlags(EnvVarPrefix)...)
 }
 
 // Flags contains the list of configuration options available to the binary.
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var MetricsNamespace = "blob_validator"
+
+// The kinds of slots checked by the validator in daemon mode.
+const (
+	// SampleRecent is a slot that was finalized since the previous round
+	SampleRecent = "recent"
+	// SampleHistorical is a slot sampled at random from further back in the history
+	SampleHistorical = "historical"
+)
+
+type Metricer interface {
+	Registry() *prometheus.Registry
+	// RecordCheck records the result of comparing a slot in a format, which is either a match or the type of failure
+	RecordCheck(format string, result string)
+	// RecordFetch records the time taken to fetch a slot's sidecars from an endpoint, including retries
+	RecordFetch(endpoint string, format string, duration time.Duration)
+	// RecordCheckedSlot records a slot that was checked, by whether it was a recent or historical sample
+	RecordCheckedSlot(sample string, slot uint64)
+	// RecordRound records a round of checks in daemon mode that completed
+	RecordRound(duration time.Duration)
+}
+
+type metricsRecorder struct {
+	// checks records the result of each comparison of a slot in a format, see service.CheckMatch
+	checks *prometheus.CounterVec
+	// fetchDuration records the latency of fetching sidecars from the blob-api and beacon-node
+	fetchDuration *prometheus.HistogramVec
+	checkedSlots  *prometheus.CounterVec
+	lastSlot      *prometheus.GaugeVec
+	rounds        prometheus.Counter
+	roundDuration prometheus.Histogram
+	lastRound     prometheus.Gauge
+	registry      *prometheus.Registry
+}
+
+func NewMetrics() Metricer {
+	registry := opmetrics.NewRegistry()
+	factory := metrics.With(registry)
+	return &metricsRecorder{
+		registry: registry,
+		checks: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "checks",
+			Help:      "The number of slots compared between the blob-api and beacon-node, by format and result, which is match or the type of divergence or error",
+		}, []string{"format", "result"}),
+		fetchDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "The time taken to fetch the sidecars of a slot, including retries, by endpoint and format",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"endpoint", "format"}),
+		checkedSlots: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "checked_slots",
+			Help:      "The number of slots checked, by whether they were recent or historical samples",
+		}, []string{"sample"}),
+		lastSlot: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_checked_slot",
+			Help:      "The last slot checked, by whether it was a recent or historical sample",
+		}, []string{"sample"}),
+		rounds: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "rounds",
+			Help:      "The number of completed rounds of checks in daemon mode",
+		}),
+		roundDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "round_duration_seconds",
+			Help:      "The time taken by each round of checks in daemon mode",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+		lastRound: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_round_timestamp_seconds",
+			Help:      "The unix time at which the last round of checks in daemon mode completed, to alert on a stalled validator",
+		}),
+	}
+}
+
+func (m *metricsRecorder) RecordCheck(format string, result string) {
+	m.checks.WithLabelValues(format, result).Inc()
+}
+
+func (m *metricsRecorder) RecordFetch(endpoint string, format string, duration time.Duration) {
+	m.fetchDuration.WithLabelValues(endpoint, format).Observe(duration.Seconds())
+}
+
+func (m *metricsRecorder) RecordCheckedSlot(sample string, slot uint64) {
+	m.checkedSlots.WithLabelValues(sample).Inc()
+	m.lastSlot.WithLabelValues(sample).Set(float64(slot))
+}
+
+func (m *metricsRecorder) RecordRound(duration time.Duration) {
+	m.rounds.Inc()
+	m.roundDuration.Observe(duration.Seconds())
+	m.lastRound.SetToCurrentTime()
+}
+
+func (m *metricsRecorder) Registry() *prometheus.Registry {
+	return m.registry
+}
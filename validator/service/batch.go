@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// BatchResponse is the response for one id of a batch fetched by FetchSidecarsBatch.
+type BatchResponse struct {
+	ID       string
+	Status   int
+	Sidecars storage.BlobSidecars
+	// Err is the *StatusError of a response with a status other than 200, nil otherwise
+	Err error
+}
+
+// BatchResult is the result of FetchSidecarsBatch. Every requested id is in exactly one of Fetched, Failed and
+// NotAttempted.
+type BatchResult struct {
+	// Fetched are the responses of the ids that were fetched, in the order they were requested
+	Fetched []BatchResponse
+	// Failed maps the ids that could not be fetched, after retrying, to the error
+	Failed map[string]error
+	// NotAttempted are the ids that were not fetched because the context ended first, in the order they were
+	// requested. This includes an id whose retries were cut short, as its error says nothing about the endpoint.
+	NotAttempted []string
+}
+
+// Complete returns true if every id was attempted.
+func (r BatchResult) Complete() bool {
+	return len(r.NotAttempted) == 0
+}
+
+// FetchSidecarsBatch fetches the sidecars for each id in turn, retrying each as the validator does. If ctx ends
+// mid-batch, the responses gathered so far are kept and the remaining ids are returned in NotAttempted, along with the
+// error of ctx. This lets a time-boxed run use whatever it managed to fetch.
+func FetchSidecarsBatch(ctx context.Context, endpoint blobclient.BlobSidecarClient, ids []string, format blobformat.Format) (BatchResult, error) {
+	result := BatchResult{Failed: make(map[string]error)}
+
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			result.NotAttempted = append(result.NotAttempted, ids[i:]...)
+			return result, ctx.Err()
+		}
+
+		status, sidecars, err := fetchWithRetries(ctx, endpoint, id, format)
+		if interrupted(ctx, err) {
+			result.NotAttempted = append(result.NotAttempted, ids[i:]...)
+			return result, ctx.Err()
+		}
+
+		if blobclient.IsFetchError(err) {
+			result.Failed[id] = err
+			continue
+		}
+
+		result.Fetched = append(result.Fetched, BatchResponse{ID: id, Status: status, Sidecars: sidecars, Err: err})
+	}
+
+	return result, nil
+}
+
+// interrupted returns true if err is the error of ctx ending, rather than an error from the endpoint.
+func interrupted(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// cancellingClient cancels a context once it has made a number of fetches, to simulate a deadline hit mid-batch.
+type cancellingClient struct {
+	blobclient.BlobSidecarClient
+	after  int
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (c *cancellingClient) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	status, sidecars, err := c.BlobSidecarClient.FetchSidecars(id, format)
+	c.calls++
+	if c.calls == c.after {
+		c.cancel()
+	}
+	return status, sidecars, err
+}
+
+func slotIDs(start, end uint64) []string {
+	var ids []string
+	for slot := start; slot <= end; slot++ {
+		ids = append(ids, strconv.FormatUint(slot, 10))
+	}
+	return ids
+}
+
+func TestFetchSidecarsBatch(t *testing.T) {
+	_, headers, beacon, _ := setup(t)
+	beacon.setResponses(headers)
+	beacon.setResponse("missed", http.StatusNotFound, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: http.StatusNotFound})
+	ids := append(slotIDs(blobtest.StartSlot, blobtest.EndSlot), "missed")
+
+	result, err := FetchSidecarsBatch(context.Background(), beacon, ids, blobformat.JSON)
+	require.NoError(t, err)
+	require.True(t, result.Complete())
+	require.Empty(t, result.Failed)
+	require.Len(t, result.Fetched, len(ids))
+	for i, response := range result.Fetched {
+		require.Equal(t, ids[i], response.ID)
+	}
+
+	// An error status is a response from the endpoint, not a failure to fetch
+	missed := result.Fetched[len(ids)-1]
+	require.Equal(t, http.StatusNotFound, missed.Status)
+	var statusErr *blobclient.StatusError
+	require.ErrorAs(t, missed.Err, &statusErr)
+}
+
+func TestFetchSidecarsBatch_Interrupted(t *testing.T) {
+	_, headers, beacon, _ := setup(t)
+	beacon.setResponses(headers)
+	ids := slotIDs(blobtest.StartSlot, blobtest.EndSlot)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result, err := FetchSidecarsBatch(ctx, &cancellingClient{BlobSidecarClient: beacon, after: 2, cancel: cancel}, ids, blobformat.JSON)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, result.Complete())
+
+	// The responses fetched before the deadline are kept
+	require.Len(t, result.Fetched, 2)
+	require.Equal(t, ids[:2], []string{result.Fetched[0].ID, result.Fetched[1].ID})
+	require.Equal(t, ids[2:], result.NotAttempted)
+	require.Empty(t, result.Failed)
+}
+
+func TestFetchSidecarsBatch_InterruptedDuringRetries(t *testing.T) {
+	_, headers, beacon, _ := setup(t)
+	beacon.setResponses(headers)
+	ids := slotIDs(blobtest.StartSlot, blobtest.StartSlot+2)
+	beacon.setResponse(ids[1], 0, storage.BlobSidecars{}, errors.New("connection refused"))
+
+	// The deadline is hit while the second id is being retried, so it is not attempted rather than failed
+	ctx, cancel := context.WithCancel(context.Background())
+	result, err := FetchSidecarsBatch(ctx, &cancellingClient{BlobSidecarClient: beacon, after: 2, cancel: cancel}, ids, blobformat.JSON)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, result.Fetched, 1)
+	require.Equal(t, ids[1:], result.NotAttempted)
+	require.Empty(t, result.Failed)
+}
+
+func TestValidatorService_CheckBlobsInterrupted(t *testing.T) {
+	validator, headers, beacon, blob := setup(t)
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+
+	// Each slot is fetched from the blob-api in two formats, so the deadline is hit while checking the second slot
+	ctx, cancel := context.WithCancel(context.Background())
+	validator.blobAPI = &cancellingClient{BlobSidecarClient: blob, after: 3, cancel: cancel}
+
+	result := validator.checkBlobs(ctx, phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Empty(t, result.ErrorFetching)
+	require.Empty(t, result.MismatchedStatus)
+	require.Empty(t, result.MismatchedData)
+	require.Equal(t, slotIDs(blobtest.StartSlot+1, blobtest.EndSlot), result.NotChecked)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/validator/metrics"
+)
+
+// DaemonConfig configures the validator to run continuously, see RunAsDaemon.
+type DaemonConfig struct {
+	// Interval is the time between the start of each round of checks
+	Interval time.Duration
+	// HistoricalSamples is the number of slots sampled at random from the history in each round
+	HistoricalSamples int
+	// HistoricalSlots is how far back from the finalized slot the historical samples are taken from. It should be
+	// within the blob retention of the beacon-node, as older slots cannot be compared.
+	HistoricalSlots uint64
+}
+
+// RunAsDaemon configures the validator to keep running rather than checking the range of blocks once and exiting. On
+// every interval it checks the slots finalized since the previous round, at most the number of blocks the validator
+// was created with, and a number of slots sampled at random from the history, so that drift of older archived blobs
+// is caught as well. The results are exported as metrics, see ServeMetrics, to alert on.
+func (a *ValidatorService) RunAsDaemon(cfg DaemonConfig) {
+	a.daemon = &cfg
+}
+
+// ServeMetrics configures the validator to serve its Prometheus metrics at addr and port while it is running.
+func (a *ValidatorService) ServeMetrics(addr string, port int) {
+	a.metricsAddr = addr
+	a.metricsPort = port
+}
+
+// runDaemon runs a round of checks on every interval, starting from the finalized slot end, until ctx ends.
+func (a *ValidatorService) runDaemon(ctx context.Context, end phase0.Slot) {
+	ticker := time.NewTicker(a.daemon.Interval)
+	defer ticker.Stop()
+
+	var checked phase0.Slot
+	for {
+		began := time.Now()
+		result, recent, historical := a.checkRound(ctx, checked, end)
+		if ctx.Err() != nil {
+			return
+		}
+		checked = end
+		a.metrics.RecordRound(time.Since(began))
+
+		failures := len(result.ErrorFetching) + len(result.MismatchedStatus) + len(result.MismatchedData) + len(result.InvalidProof)
+		a.log.Info("completed round of checks", "finalized", end, "recent", recent, "historical", historical, "failures", failures, "duration", time.Since(began))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		next, err := a.finalizedSlot(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			a.log.Warn("failed to fetch the finalized slot, only sampling history this round", "err", err)
+			continue
+		}
+		end = max(end, next)
+	}
+}
+
+// checkRound checks the slots after checked up to end, at most numBlocks of them, then the historical samples taken
+// from before them. It returns the results, and the number of recent and historical slots checked.
+func (a *ValidatorService) checkRound(ctx context.Context, checked phase0.Slot, end phase0.Slot) (CheckBlobResult, int, int) {
+	var result CheckBlobResult
+	from := checked + 1
+	if window := phase0.Slot(a.numBlocks); end > window {
+		from = max(from, end-window)
+	}
+
+	recent := 0
+	for slot := from; slot <= end; slot++ {
+		if !a.checkSlot(ctx, slot, &result) {
+			return result, recent, 0
+		}
+		a.metrics.RecordCheckedSlot(metrics.SampleRecent, uint64(slot))
+		recent++
+	}
+
+	historical := 0
+	for _, slot := range a.historicalSlots(min(from, end+1)) {
+		if !a.checkSlot(ctx, slot, &result) {
+			return result, recent, historical
+		}
+		a.metrics.RecordCheckedSlot(metrics.SampleHistorical, uint64(slot))
+		historical++
+	}
+
+	return result, recent, historical
+}
+
+// historicalSlots returns the slots sampled at random from the HistoricalSlots before the slot before.
+func (a *ValidatorService) historicalSlots(before phase0.Slot) []phase0.Slot {
+	lowest := phase0.Slot(0)
+	if uint64(before) > a.daemon.HistoricalSlots {
+		lowest = before - phase0.Slot(a.daemon.HistoricalSlots)
+	}
+	if lowest >= before {
+		return nil
+	}
+
+	result := make([]phase0.Slot, a.daemon.HistoricalSamples)
+	for i := range result {
+		result[i] = lowest + phase0.Slot(rand.Int63n(int64(before-lowest)))
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/validator/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// roundCounter counts the rounds recorded through it.
+type roundCounter struct {
+	metrics.Metricer
+	rounds atomic.Int32
+}
+
+func (r *roundCounter) RecordRound(duration time.Duration) {
+	r.rounds.Add(1)
+	r.Metricer.RecordRound(duration)
+}
+
+func TestValidatorService_CheckRound(t *testing.T) {
+	validator, headers, beacon, blob := setup(t)
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+	blob.setResponse(blockOne, 404, storage.BlobSidecars{}, nil)
+	validator.numBlocks = 2
+	validator.formats = []blobformat.Format{blobformat.JSON}
+	validator.RunAsDaemon(DaemonConfig{Interval: time.Minute, HistoricalSamples: 4, HistoricalSlots: 3})
+
+	// The last slots up to the finalized slot are recent, and the three before them are sampled
+	result, recent, historical := validator.checkRound(context.Background(), 0, phase0.Slot(blobtest.EndSlot))
+	require.Equal(t, 3, recent)
+	require.Equal(t, 4, historical)
+	require.Empty(t, result.ErrorFetching)
+	require.Empty(t, result.MismatchedData)
+	for _, id := range result.MismatchedStatus {
+		require.Equal(t, blockOne, id)
+	}
+
+	mismatches := len(result.MismatchedStatus)
+	require.NoError(t, testutil.GatherAndCompare(validator.metrics.Registry(), strings.NewReader(`
+# HELP blob_validator_checked_slots The number of slots checked, by whether they were recent or historical samples
+# TYPE blob_validator_checked_slots counter
+blob_validator_checked_slots{sample="historical"} 4
+blob_validator_checked_slots{sample="recent"} 3
+`), "blob_validator_checked_slots"))
+	count, err := testutil.GatherAndCount(validator.metrics.Registry(), "blob_validator_checks")
+	require.NoError(t, err)
+	require.Equal(t, 1+min(mismatches, 1), count)
+
+	// Only the slots finalized since the last round are recent
+	_, recent, historical = validator.checkRound(context.Background(), phase0.Slot(blobtest.EndSlot), phase0.Slot(blobtest.EndSlot))
+	require.Zero(t, recent)
+	require.Equal(t, 4, historical)
+}
+
+func TestValidatorService_HistoricalSlots(t *testing.T) {
+	validator, _, _, _ := setup(t)
+	validator.RunAsDaemon(DaemonConfig{HistoricalSamples: 100, HistoricalSlots: 10})
+
+	for _, slot := range validator.historicalSlots(100) {
+		require.GreaterOrEqual(t, slot, phase0.Slot(90))
+		require.Less(t, slot, phase0.Slot(100))
+	}
+	for _, slot := range validator.historicalSlots(5) {
+		require.Less(t, slot, phase0.Slot(5))
+	}
+	require.Empty(t, validator.historicalSlots(0))
+}
+
+func TestValidatorService_Daemon(t *testing.T) {
+	validator, headers, beacon, blob := setup(t)
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+	validator.numBlocks = 2
+	counter := &roundCounter{Metricer: metrics.NewMetrics()}
+	validator.metrics = counter
+	validator.RunAsDaemon(DaemonConfig{Interval: 10 * time.Millisecond, HistoricalSamples: 1, HistoricalSlots: 3})
+
+	// The head is far enough ahead that the finalized slot is the last stub block
+	head := *headers.Headers["head"]
+	head.Header = &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(blobtest.EndSlot + finalizedL1Offset)}}
+	headers.Headers["head"] = &v1.BeaconBlockHeader{Root: head.Root, Header: head.Header}
+
+	require.NoError(t, validator.Start(context.Background()))
+	require.Eventually(t, func() bool {
+		return counter.rounds.Load() >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, validator.Stop(context.Background()))
+	rounds := counter.rounds.Load()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, rounds, counter.rounds.Load())
+}
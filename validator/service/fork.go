@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// ParseForkDigest parses a hex encoded fork digest, with or without the 0x prefix.
+func ParseForkDigest(s string) (phase0.ForkDigest, error) {
+	var digest phase0.ForkDigest
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil || len(b) != len(digest) {
+		return digest, fmt.Errorf("invalid fork digest %q, expected 4 hex encoded bytes", s)
+	}
+	copy(digest[:], b)
+	return digest, nil
+}
+
+// computeForkDigest computes the fork digest of a fork version on the chain with the given genesis validators root, as
+// defined by compute_fork_digest in the consensus specs.
+func computeForkDigest(version phase0.Version, genesisValidatorsRoot phase0.Root) (phase0.ForkDigest, error) {
+	forkData := &phase0.ForkData{
+		CurrentVersion:        version,
+		GenesisValidatorsRoot: genesisValidatorsRoot,
+	}
+
+	root, err := forkData.HashTreeRoot()
+	if err != nil {
+		return phase0.ForkDigest{}, fmt.Errorf("failed to compute fork data root: %w", err)
+	}
+
+	var digest phase0.ForkDigest
+	copy(digest[:], root[:])
+	return digest, nil
+}
+
+// fetchForkDigest fetches the digest of the fork that the beacon node is currently on. An error is returned if the
+// beacon client does not support the genesis and fork endpoints.
+func fetchForkDigest(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider) (phase0.ForkDigest, error) {
+	genesisProvider, ok := beaconClient.(client.GenesisProvider)
+	if !ok {
+		return phase0.ForkDigest{}, fmt.Errorf("beacon client does not provide genesis")
+	}
+	forkProvider, ok := beaconClient.(client.ForkProvider)
+	if !ok {
+		return phase0.ForkDigest{}, fmt.Errorf("beacon client does not provide fork")
+	}
+
+	genesis, err := genesisProvider.Genesis(ctx, &api.GenesisOpts{})
+	if err != nil {
+		return phase0.ForkDigest{}, fmt.Errorf("failed to fetch genesis: %w", err)
+	}
+
+	fork, err := forkProvider.Fork(ctx, &api.ForkOpts{State: "head"})
+	if err != nil {
+		return phase0.ForkDigest{}, fmt.Errorf("failed to fetch fork: %w", err)
+	}
+
+	return computeForkDigest(fork.Data.CurrentVersion, genesis.Data.GenesisValidatorsRoot)
+}
+
+// verifyForkDigest checks that the beacon node is on one of the expected fork digests.
+func verifyForkDigest(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, expected []phase0.ForkDigest) error {
+	digest, err := fetchForkDigest(ctx, beaconClient)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range expected {
+		if digest == e {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("beacon node is on fork digest %#x, expected one of %#x, check that it is on the expected network", digest, expected)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+var mainnetGenesisValidatorsRoot = phase0.Root(common.HexToHash("0x4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"))
+
+// forkBeaconClient is a stub beacon client that also provides the genesis and current fork.
+type forkBeaconClient struct {
+	*beacontest.StubBeaconClient
+	version phase0.Version
+}
+
+func (c *forkBeaconClient) Genesis(context.Context, *api.GenesisOpts) (*api.Response[*v1.Genesis], error) {
+	return &api.Response[*v1.Genesis]{Data: &v1.Genesis{GenesisValidatorsRoot: mainnetGenesisValidatorsRoot}}, nil
+}
+
+func (c *forkBeaconClient) Fork(context.Context, *api.ForkOpts) (*api.Response[*phase0.Fork], error) {
+	return &api.Response[*phase0.Fork]{Data: &phase0.Fork{CurrentVersion: c.version}}, nil
+}
+
+func TestComputeForkDigest(t *testing.T) {
+	tests := map[phase0.Version]string{
+		{0x00, 0x00, 0x00, 0x00}: "b5303f2a", // mainnet phase0
+		{0x04, 0x00, 0x00, 0x00}: "6a95a1a9", // mainnet deneb
+	}
+
+	for version, expected := range tests {
+		digest, err := computeForkDigest(version, mainnetGenesisValidatorsRoot)
+		require.NoError(t, err)
+		require.Equal(t, expected, common.Bytes2Hex(digest[:]))
+	}
+}
+
+func TestParseForkDigest(t *testing.T) {
+	for _, s := range []string{"0x6a95a1a9", "6a95a1a9", " 0x6A95A1A9 "} {
+		digest, err := ParseForkDigest(s)
+		require.NoError(t, err, s)
+		require.Equal(t, phase0.ForkDigest{0x6a, 0x95, 0xa1, 0xa9}, digest)
+	}
+
+	for _, s := range []string{"", "0x6a95a1", "0x6a95a1a9ff", "not hex"} {
+		_, err := ParseForkDigest(s)
+		require.ErrorContains(t, err, "invalid fork digest", s)
+	}
+}
+
+func TestVerifyForkDigest(t *testing.T) {
+	deneb := phase0.ForkDigest{0x6a, 0x95, 0xa1, 0xa9}
+	other := phase0.ForkDigest{1, 2, 3, 4}
+	beacon := &forkBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t), version: phase0.Version{0x04}}
+
+	require.NoError(t, verifyForkDigest(context.Background(), beacon, []phase0.ForkDigest{other, deneb}))
+	require.ErrorContains(t, verifyForkDigest(context.Background(), beacon, []phase0.ForkDigest{other}), "beacon node is on fork digest 0x6a95a1a9")
+
+	_, err := fetchForkDigest(context.Background(), beacontest.NewDefaultStubBeaconClient(t))
+	require.ErrorContains(t, err, "does not provide genesis")
+}
+
+func TestValidatorStart_VerifiesForkDigest(t *testing.T) {
+	beacon := &forkBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t), version: phase0.Version{0x04}}
+	validator := NewValidator(nil, beacon, nil, nil, nil, 1)
+	validator.VerifyForkDigests([]phase0.ForkDigest{{1, 2, 3, 4}})
+
+	err := validator.Start(context.Background())
+	require.ErrorContains(t, err, "failed to verify fork digest")
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/base-org/blob-archiver/common/blobproof"
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// VerifyKZG configures the validator to cryptographically verify the sidecars fetched from the blob-api before they
+// are compared: the KZG proof of each blob against its commitment, and the inclusion proof of each commitment against
+// the signed block header, using the block body layout of fork (see blobproof.VerifyInclusionProof). This detects
+// corrupted blobs in the archive even when the beacon-node cannot be fetched from to compare against, e.g. for slots
+// beyond its blob retention.
+func (a *ValidatorService) VerifyKZG(fork string) {
+	a.kzgFork = fork
+}
+
+// verifySidecars checks that the sidecars of a block are from the same block header, that their commitments are
+// included in the body of that block, and that the KZG proof of each blob is valid for its commitment.
+func verifySidecars(sidecars []*storage.BlobSidecar, fork string) error {
+	for _, sidecar := range sidecars {
+		if !reflect.DeepEqual(sidecar.SignedBlockHeader, sidecars[0].SignedBlockHeader) {
+			return fmt.Errorf("sidecar %d has a different block header to sidecar %d", sidecar.Index, sidecars[0].Index)
+		}
+
+		if err := blobproof.VerifyInclusionProof(sidecar, fork); err != nil {
+			return err
+		}
+	}
+
+	return blobproof.VerifyBlobsBatch(sidecars)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// denebCommitmentsIndex is the generalized index of the first commitment in a deneb block body, the commitments list
+// being field 11 of 16 and having a limit of 4096.
+const denebCommitmentsIndex = (16 + 11) * 2 * 4096
+
+// newProvenSidecars returns the sidecars of a deneb block at slot with count blobs, with valid KZG and inclusion proofs.
+func newProvenSidecars(t *testing.T, slot phase0.Slot, count int) storage.BlobSidecars {
+	var blobs []kzg4844.Blob
+	var commitments []deneb.KZGCommitment
+	for i := 0; i < count; i++ {
+		var blob kzg4844.Blob
+		// Each field element must be less than the BLS modulus, so the first byte of each is left as zero
+		raw := blobtest.RandBytes(t, uint(len(blob)))
+		for j := 0; j < len(blob); j += 32 {
+			copy(blob[j+1:j+32], raw[j+1:j+32])
+		}
+		commitment, err := kzg4844.BlobToCommitment(blob)
+		require.NoError(t, err)
+
+		blobs = append(blobs, blob)
+		commitments = append(commitments, deneb.KZGCommitment(commitment))
+	}
+
+	body := &deneb.BeaconBlockBody{
+		ETH1Data:           &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+		SyncAggregate:      &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+		ExecutionPayload:   &deneb.ExecutionPayload{BaseFeePerGas: uint256.NewInt(7)},
+		BlobKZGCommitments: commitments,
+	}
+	bodyRoot, err := body.HashTreeRoot()
+	require.NoError(t, err)
+	tree, err := body.GetTree()
+	require.NoError(t, err)
+
+	header := &phase0.SignedBeaconBlockHeader{
+		Message: &phase0.BeaconBlockHeader{Slot: slot, ParentRoot: phase0.Root{1}, StateRoot: phase0.Root{2}, BodyRoot: bodyRoot},
+	}
+
+	var sidecars storage.BlobSidecars
+	for i, blob := range blobs {
+		proof, err := kzg4844.ComputeBlobProof(blob, kzg4844.Commitment(commitments[i]))
+		require.NoError(t, err)
+		inclusion, err := tree.Prove(denebCommitmentsIndex + i)
+		require.NoError(t, err)
+
+		sidecar := &storage.BlobSidecar{
+			Index:             deneb.BlobIndex(i),
+			Blob:              deneb.Blob(blob),
+			KZGCommitment:     commitments[i],
+			KZGProof:          deneb.KZGProof(proof),
+			SignedBlockHeader: header,
+		}
+		for j, h := range inclusion.Hashes {
+			copy(sidecar.KZGCommitmentInclusionProof[j][:], h)
+		}
+		sidecars.Data = append(sidecars.Data, sidecar)
+	}
+	return sidecars
+}
+
+// corrupt returns a copy of sidecars with the sidecar at index changed by modify.
+func corrupt(sidecars storage.BlobSidecars, index int, modify func(*storage.BlobSidecar)) storage.BlobSidecars {
+	result := storage.BlobSidecars{Data: make([]*storage.BlobSidecar, len(sidecars.Data))}
+	for i, sidecar := range sidecars.Data {
+		sidecar := *sidecar
+		if i == index {
+			modify(&sidecar)
+		}
+		result.Data[i] = &sidecar
+	}
+	return result
+}
+
+func TestValidatorService_VerifyKZG(t *testing.T) {
+	slot := phase0.Slot(blobtest.StartSlot + 1)
+	sidecars := newProvenSidecars(t, slot, 3)
+
+	tests := []struct {
+		name     string
+		sidecars storage.BlobSidecars
+		invalid  bool
+	}{
+		{
+			name:     "valid",
+			sidecars: sidecars,
+		},
+		{
+			name:     "corrupted blob",
+			sidecars: corrupt(sidecars, 1, func(s *storage.BlobSidecar) { s.Blob[33] ^= 1 }),
+			invalid:  true,
+		},
+		{
+			name:     "invalid kzg proof",
+			sidecars: corrupt(sidecars, 2, func(s *storage.BlobSidecar) { s.KZGProof = sidecars.Data[1].KZGProof }),
+			invalid:  true,
+		},
+		{
+			name:     "invalid inclusion proof",
+			sidecars: corrupt(sidecars, 0, func(s *storage.BlobSidecar) { s.KZGCommitmentInclusionProof[3][0] ^= 1 }),
+			invalid:  true,
+		},
+		{
+			name: "different block header",
+			sidecars: corrupt(sidecars, 2, func(s *storage.BlobSidecar) {
+				header := *s.SignedBlockHeader.Message
+				header.ProposerIndex = 5
+				s.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: &header}
+			}),
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator, _, beacon, blob := setup(t)
+			validator.VerifyKZG("deneb")
+			beacon.setResponse(blockOne, 200, sidecars, nil)
+			blob.setResponse(blockOne, 200, test.sidecars, nil)
+
+			result := validator.checkBlobs(context.Background(), slot, slot)
+
+			require.Empty(t, result.ErrorFetching)
+			require.Empty(t, result.MismatchedStatus)
+			if test.invalid {
+				// Corrupted sidecars are not also compared with the beacon-node's
+				require.Equal(t, []string{blockOne, blockOne}, result.InvalidProof)
+				require.Empty(t, result.MismatchedData)
+			} else {
+				require.Empty(t, result.InvalidProof)
+				require.Empty(t, result.MismatchedData)
+			}
+		})
+	}
+}
+
+func TestValidatorService_VerifyKZGBeyondRetention(t *testing.T) {
+	slot := phase0.Slot(blobtest.StartSlot + 1)
+	sidecars := newProvenSidecars(t, slot, 2)
+
+	// The beacon-node has pruned the blobs, so they cannot be compared against
+	validator, _, beacon, blob := setup(t)
+	validator.VerifyKZG("deneb")
+	beacon.setResponse(blockOne, 404, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: 404, Message: "Block not found"})
+	blob.setResponse(blockOne, 200, corrupt(sidecars, 0, func(s *storage.BlobSidecar) { s.Blob[64] ^= 1 }), nil)
+
+	result := validator.checkBlobs(context.Background(), slot, slot)
+	require.Equal(t, []string{blockOne, blockOne}, result.InvalidProof)
+	require.Empty(t, result.MismatchedStatus)
+
+	// Valid sidecars are still compared with the beacon-node
+	blob.setResponse(blockOne, 200, sidecars, nil)
+	result = validator.checkBlobs(context.Background(), slot, slot)
+	require.Empty(t, result.InvalidProof)
+	require.Equal(t, []string{blockOne, blockOne}, result.MismatchedStatus)
+}
+
+func TestValidatorService_NoKZGVerification(t *testing.T) {
+	slot := phase0.Slot(blobtest.StartSlot + 1)
+	sidecars := newProvenSidecars(t, slot, 2)
+
+	validator, _, beacon, blob := setup(t)
+	beacon.setResponse(blockOne, 200, sidecars, nil)
+	blob.setResponse(blockOne, 200, corrupt(sidecars, 0, func(s *storage.BlobSidecar) { s.Blob[64] ^= 1 }), nil)
+
+	result := validator.checkBlobs(context.Background(), slot, slot)
+	require.Empty(t, result.InvalidProof)
+	require.Equal(t, []string{blockOne, blockOne}, result.MismatchedData)
+}
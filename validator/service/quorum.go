@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// QuorumResult is the outcome of comparing the blob-api against several independent beacon clients.
+type QuorumResult struct {
+	// Agreed contains the indices of the clients whose response matched the blob-api
+	Agreed []int
+	// Dissented contains the indices of the clients whose response did not match the blob-api
+	Dissented []int
+	// Failed contains the indices of the clients that could not be fetched from
+	Failed []int
+	// Quorum is true if at least threshold clients returned the same response
+	Quorum bool
+	// Discrepancy is true if a quorum was reached and the blob-api disagrees with it
+	Discrepancy bool
+}
+
+type quorumResponse struct {
+	status   int
+	sidecars storage.BlobSidecars
+}
+
+func (r quorumResponse) equal(other quorumResponse) bool {
+	return r.status == other.status && reflect.DeepEqual(r.sidecars, other.sidecars)
+}
+
+// ValidateWithQuorum compares the blob-api response for id against the response of each of the clients. Rather than
+// trusting a single beacon node, the clients vote: if at least threshold of them return the same response it is taken
+// as correct, and a discrepancy is only reported if the blob-api disagrees with it. An error is returned if the
+// blob-api cannot be fetched from.
+func (a *ValidatorService) ValidateWithQuorum(ctx context.Context, id string, format blobformat.Format, clients []blobclient.BlobSidecarClient, threshold int) (QuorumResult, error) {
+	var result QuorumResult
+
+	if threshold < 1 || threshold > len(clients) {
+		return result, fmt.Errorf("invalid quorum threshold %d for %d clients", threshold, len(clients))
+	}
+
+	blobStatus, blobResponse, blobErr := fetchWithRetries(ctx, a.blobAPI, id, format)
+	if blobclient.IsFetchError(blobErr) {
+		return result, fmt.Errorf("failed to fetch from blob-api: %w", blobErr)
+	}
+	blob := quorumResponse{status: blobStatus, sidecars: blobResponse}
+
+	var responses []quorumResponse
+	var votes []int
+	for i, client := range clients {
+		status, sidecars, err := fetchWithRetries(ctx, client, id, format)
+		if blobclient.IsFetchError(err) {
+			result.Failed = append(result.Failed, i)
+			a.log.Warn("quorum client failed", "client", i, "id", id, "err", err)
+			continue
+		}
+
+		response := quorumResponse{status: status, sidecars: sidecars}
+		if response.equal(blob) {
+			result.Agreed = append(result.Agreed, i)
+		} else {
+			result.Dissented = append(result.Dissented, i)
+		}
+
+		found := false
+		for j := range responses {
+			if responses[j].equal(response) {
+				votes[j]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			responses = append(responses, response)
+			votes = append(votes, 1)
+		}
+	}
+
+	for j, count := range votes {
+		if count >= threshold {
+			result.Quorum = true
+			result.Discrepancy = !responses[j].equal(blob)
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// confirmDiscrepancy is called when the blob-api and beacon-node disagree, and returns true if it should be reported.
+// Without quorum clients every disagreement is reported. With them, it is only reported if the blob-api also disagrees
+// with the quorum, or if no quorum can be reached as the blob-api then cannot be shown to be correct.
+func (a *ValidatorService) confirmDiscrepancy(ctx context.Context, l log.Logger, id string, format blobformat.Format) bool {
+	if len(a.quorumClients) == 0 {
+		return true
+	}
+
+	clients := append([]blobclient.BlobSidecarClient{a.beaconAPI}, a.quorumClients...)
+	result, err := a.ValidateWithQuorum(ctx, id, format, clients, a.quorumThreshold)
+	if err != nil {
+		l.Error("failed to validate with quorum", "err", err)
+		return true
+	}
+
+	l.Info("validated with quorum", "quorum", result.Quorum, "discrepancy", result.Discrepancy, "agreed", result.Agreed, "dissented", result.Dissented, "failed", result.Failed)
+	return !result.Quorum || result.Discrepancy
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func newStubClient() *stubBlobSidecarClient {
+	return &stubBlobSidecarClient{
+		data: make(map[string]response),
+	}
+}
+
+func TestValidateWithQuorum(t *testing.T) {
+	validator, headers, beacon, blob := setup(t)
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+
+	// The primary beacon-node is wrong, the other two agree with the blob-api
+	beacon.setResponse(blockOne, 200, storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}, nil)
+	second, third := newStubClient(), newStubClient()
+	second.setResponses(headers)
+	third.setResponses(headers)
+
+	result, err := validator.ValidateWithQuorum(context.Background(), blockOne, blobformat.JSON, []blobclient.BlobSidecarClient{beacon, second, third}, 2)
+	require.NoError(t, err)
+	require.Equal(t, QuorumResult{
+		Agreed:    []int{1, 2},
+		Dissented: []int{0},
+		Quorum:    true,
+	}, result)
+
+	// The blob-api disagrees with the quorum
+	blob.setResponse(blockOne, 404, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: 404})
+	result, err = validator.ValidateWithQuorum(context.Background(), blockOne, blobformat.JSON, []blobclient.BlobSidecarClient{beacon, second, third}, 2)
+	require.NoError(t, err)
+	require.Equal(t, QuorumResult{
+		Dissented:   []int{0, 1, 2},
+		Quorum:      true,
+		Discrepancy: true,
+	}, result)
+
+	// Every beacon-node returns something different, so no quorum is reached
+	third.setResponse(blockOne, 200, storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 2))}, nil)
+	result, err = validator.ValidateWithQuorum(context.Background(), blockOne, blobformat.JSON, []blobclient.BlobSidecarClient{beacon, second, third}, 2)
+	require.NoError(t, err)
+	require.False(t, result.Quorum)
+	require.False(t, result.Discrepancy)
+
+	_, err = validator.ValidateWithQuorum(context.Background(), blockOne, blobformat.JSON, []blobclient.BlobSidecarClient{beacon}, 2)
+	require.ErrorContains(t, err, "invalid quorum threshold")
+}
+
+func TestValidatorService_QuorumOverridesBeacon(t *testing.T) {
+	validator, headers, beacon, blob := setup(t)
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+
+	second, third := newStubClient(), newStubClient()
+	second.setResponses(headers)
+	third.setResponses(headers)
+	validator.UseQuorum([]blobclient.BlobSidecarClient{second, third}, 2)
+
+	// The primary beacon-node disagrees for block one, but the blob-api matches the quorum
+	beacon.setResponse(blockOne, 200, storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}, nil)
+
+	result := validator.checkBlobs(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Empty(t, result.MismatchedStatus)
+	require.Empty(t, result.MismatchedData)
+	require.Empty(t, result.ErrorFetching)
+
+	// The second beacon-node now also disagrees with the blob-api, so there is no quorum and the mismatch is reported
+	second.setResponse(blockOne, 404, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: 404})
+
+	result = validator.checkBlobs(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Empty(t, result.MismatchedStatus)
+	require.Equal(t, []string{blockOne, blockOne}, result.MismatchedData)
+}
@@ -8,12 +8,18 @@ import (
 	"reflect"
 	"strconv"
 	"sync/atomic"
+	"time"
 
 	client "github.com/attestantio/go-eth2-client"
 	"github.com/attestantio/go-eth2-client/api"
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
 	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/validator/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/httputil"
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/ethereum-optimism/optimism/op-service/retry"
 	"github.com/ethereum/go-ethereum/log"
 )
@@ -29,7 +35,7 @@ const (
 	retryAttempts = 10
 )
 
-func NewValidator(l log.Logger, headerClient client.BeaconBlockHeadersProvider, beaconAPI BlobSidecarClient, blobAPI BlobSidecarClient, app context.CancelCauseFunc, numBlocks int) *ValidatorService {
+func NewValidator(l log.Logger, headerClient client.BeaconBlockHeadersProvider, beaconAPI blobclient.BlobSidecarClient, blobAPI blobclient.BlobSidecarClient, app context.CancelCauseFunc, numBlocks int) *ValidatorService {
 	return &ValidatorService{
 		log:          l,
 		headerClient: headerClient,
@@ -37,6 +43,8 @@ func NewValidator(l log.Logger, headerClient client.BeaconBlockHeadersProvider,
 		blobAPI:      blobAPI,
 		closeApp:     app,
 		numBlocks:    numBlocks,
+		formats:      []blobformat.Format{blobformat.JSON, blobformat.SSZ},
+		metrics:      metrics.NewMetrics(),
 	}
 }
 
@@ -44,15 +52,125 @@ type ValidatorService struct {
 	stopped      atomic.Bool
 	log          log.Logger
 	headerClient client.BeaconBlockHeadersProvider
-	beaconAPI    BlobSidecarClient
-	blobAPI      BlobSidecarClient
+	beaconAPI    blobclient.BlobSidecarClient
+	blobAPI      blobclient.BlobSidecarClient
 	closeApp     context.CancelCauseFunc
 	numBlocks    int
+	formats      []blobformat.Format
+	statusAddr   string
+	status       http.Handler
+	statusServer *httputil.HTTPServer
+
+	quorumClients   []blobclient.BlobSidecarClient
+	quorumThreshold int
+
+	forkDigests []phase0.ForkDigest
+
+	// kzgFork is the fork whose block body layout inclusion proofs are verified against, see VerifyKZG. The sidecars
+	// are not verified if it is empty.
+	kzgFork string
+
+	webhook *webhook
+
+	metrics       metrics.Metricer
+	metricsAddr   string
+	metricsPort   int
+	metricsServer *httputil.HTTPServer
+
+	daemon     *DaemonConfig
+	stopDaemon context.CancelFunc
+	daemonDone chan struct{}
+}
+
+// UseQuorum configures additional independent beacon clients. When the blob-api and beacon-node disagree, the
+// beacon-node and these clients vote on the correct response (see ValidateWithQuorum) and the blob-api is only
+// reported if it disagrees with at least threshold of them.
+func (a *ValidatorService) UseQuorum(clients []blobclient.BlobSidecarClient, threshold int) {
+	a.quorumClients = clients
+	a.quorumThreshold = threshold
+}
+
+// ValidateFormats configures the formats that the blobs are requested and compared in, by default JSON and SSZ.
+func (a *ValidatorService) ValidateFormats(formats []blobformat.Format) {
+	a.formats = formats
+}
+
+// VerifyForkDigests configures the validator to check, before it starts, that the beacon-node is currently on one of
+// the given fork digests. The digest identifies both the network and the fork, so this catches a validator that has
+// been pointed at a beacon-node on another network.
+func (a *ValidatorService) VerifyForkDigests(digests []phase0.ForkDigest) {
+	a.forkDigests = digests
+}
+
+// ServeStatus configures the validator to serve the given handler on /status at addr while it is running.
+func (a *ValidatorService) ServeStatus(addr string, handler http.Handler) {
+	a.statusAddr = addr
+	a.status = handler
 }
 
 // Start starts the validator service. This will fetch the current range of blocks to validate and start the validation
 // process.
 func (a *ValidatorService) Start(ctx context.Context) error {
+	if len(a.forkDigests) > 0 {
+		if err := verifyForkDigest(ctx, a.headerClient, a.forkDigests); err != nil {
+			return fmt.Errorf("failed to verify fork digest: %w", err)
+		}
+	}
+
+	end, err := a.finalizedSlot(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.status != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/status", a.status)
+
+		srv, err := httputil.StartHTTPServer(a.statusAddr, mux)
+		if err != nil {
+			return fmt.Errorf("failed to start status server: %w", err)
+		}
+
+		a.log.Info("Status server started", "address", srv.Addr().String())
+		a.statusServer = srv
+	}
+
+	if a.metricsAddr != "" {
+		srv, err := opmetrics.StartServer(a.metrics.Registry(), a.metricsAddr, a.metricsPort)
+		if err != nil {
+			return fmt.Errorf("failed to start metrics server: %w", err)
+		}
+
+		a.log.Info("Metrics server started", "address", srv.Addr().String())
+		a.metricsServer = srv
+	}
+
+	if a.daemon != nil {
+		daemonCtx, cancel := context.WithCancel(ctx)
+		a.stopDaemon = cancel
+		a.daemonDone = make(chan struct{})
+		go func() {
+			defer close(a.daemonDone)
+			a.runDaemon(daemonCtx, end)
+		}()
+		return nil
+	}
+
+	start := end - phase0.Slot(a.numBlocks)
+
+	go func() {
+		a.checkBlobs(ctx, start, end)
+		if ctx.Err() == nil {
+			// Validation is complete, shutdown the app
+			a.closeApp(nil)
+		}
+	}()
+
+	return nil
+}
+
+// finalizedSlot returns the slot finalizedL1Offset slots behind the head of the beacon-node.
+func (a *ValidatorService) finalizedSlot(ctx context.Context) (phase0.Slot, error) {
 	header, err := retry.Do(ctx, retryAttempts, retry.Exponential(), func() (*api.Response[*v1.BeaconBlockHeader], error) {
 		return a.headerClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
 			Block: "head",
@@ -60,15 +178,10 @@ func (a *ValidatorService) Start(ctx context.Context) error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to get beacon block header: %w", err)
+		return 0, fmt.Errorf("failed to get beacon block header: %w", err)
 	}
 
-	end := header.Data.Header.Message.Slot - finalizedL1Offset
-	start := end - phase0.Slot(a.numBlocks)
-
-	go a.checkBlobs(ctx, start, end)
-
-	return nil
+	return header.Data.Header.Message.Slot - finalizedL1Offset, nil
 }
 
 // Stops the validator service.
@@ -80,6 +193,33 @@ func (a *ValidatorService) Stop(ctx context.Context) error {
 	a.log.Info("Stopping validator")
 	a.stopped.Store(true)
 
+	if a.stopDaemon != nil {
+		a.stopDaemon()
+		select {
+		case <-a.daemonDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if a.statusServer != nil {
+		if err := a.statusServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	if a.metricsServer != nil {
+		if err := a.metricsServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	if a.webhook != nil {
+		if err := a.webhook.wait(ctx); err != nil {
+			return fmt.Errorf("failed to deliver failures to webhook: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -95,90 +235,200 @@ type CheckBlobResult struct {
 	MismatchedStatus []string
 	// MismatchedData contains the list of slots for which the data from the blob-api and beacon-node did not match
 	MismatchedData []string
+	// InvalidProof contains the list of slots for which the sidecars from the blob-api failed KZG or inclusion proof
+	// verification, see VerifyKZG
+	InvalidProof []string
+	// NotChecked contains the list of slots that were not checked, in every format, because the context ended first.
+	// These slots are not failures, the check was cut short.
+	NotChecked []string
 }
 
-// shouldRetry returns true if the status code is one of the retryable status codes
-func shouldRetry(status int) bool {
-	switch status {
-	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
-		return true
-	default:
-		return false
+// fetchWithRetries fetches the sidecar and handles retryable error cases (5xx status codes + 429 + connection errors).
+// Non-retryable error statuses are a valid response from the endpoint, in this case the *StatusError is returned
+// without retrying. An endpoint that retries failed requests itself (see blobclient.Retrier) is only fetched from once,
+// so that the retries of the client are not multiplied by those made here.
+func fetchWithRetries(ctx context.Context, endpoint blobclient.BlobSidecarClient, id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	attempts := retryAttempts
+	if r, ok := endpoint.(blobclient.Retrier); ok && r.Retries() {
+		attempts = 1
 	}
-}
 
-// fetchWithRetries fetches the sidecar and handles retryable error cases (5xx status codes + 429 + connection errors)
-func fetchWithRetries(ctx context.Context, endpoint BlobSidecarClient, id string, format Format) (int, storage.BlobSidecars, error) {
-	return retry.Do2(ctx, retryAttempts, retry.Exponential(), func() (int, storage.BlobSidecars, error) {
-		status, resp, err := endpoint.FetchSidecars(id, format)
+	response, err := retry.Do(ctx, attempts, retry.Exponential(), func() (fetchResponse, error) {
+		status, sidecars, err := endpoint.FetchSidecars(id, format)
+
+		var statusErr *blobclient.StatusError
+		if blobclient.ShouldRetry(status) && (err == nil || errors.As(err, &statusErr)) {
+			if statusErr != nil && statusErr.Message != "" {
+				return fetchResponse{}, fmt.Errorf("retryable status code: %d: %s", status, statusErr.Message)
+			}
+			return fetchResponse{}, fmt.Errorf("retryable status code: %d", status)
+		}
 
-		if err == nil && status != http.StatusOK && shouldRetry(status) {
-			err = fmt.Errorf("retryable status code: %d", status)
+		if err != nil && !errors.As(err, &statusErr) {
+			return fetchResponse{}, err
 		}
 
-		return status, resp, err
+		// The error status is the response of the endpoint, so it is returned rather than retried
+		return fetchResponse{status: status, sidecars: sidecars, err: err}, nil
 	})
+
+	if err != nil {
+		return 0, storage.BlobSidecars{}, err
+	}
+
+	return response.status, response.sidecars, response.err
+}
+
+// fetchResponse is a response of an endpoint to fetchWithRetries.
+type fetchResponse struct {
+	status   int
+	sidecars storage.BlobSidecars
+	// err is the *StatusError of a response with a non-retryable error status, nil otherwise
+	err error
 }
 
+// The results of comparing a slot that are not failures, recorded with the failure types in the checks metric.
+const (
+	// CheckMatch is a slot whose sidecars are the same from the blob-api and beacon-node
+	CheckMatch = "match"
+	// CheckMatchingError is a slot for which the blob-api and beacon-node respond with the same error status, e.g. as
+	// the slot was missed
+	CheckMatchingError = "matching-error-status"
+	// CheckQuorumMatch is a slot for which the blob-api and beacon-node differ, but a quorum agrees with the blob-api
+	CheckQuorumMatch = "quorum-match"
+)
+
+// The endpoints whose fetch latency is recorded.
+const (
+	endpointBlobAPI    = "blob-api"
+	endpointBeaconNode = "beacon-node"
+)
+
 // checkBlobs iterates all blocks in the range start:end and checks that the blobs from the beacon-node and blob-api
-// are identical, when encoded in both JSON and SSZ.
+// are identical, when encoded in each of the configured formats. If ctx ends mid-range, the results of the slots
+// checked so far are returned, and the remaining slots are in NotChecked.
 func (a *ValidatorService) checkBlobs(ctx context.Context, start phase0.Slot, end phase0.Slot) CheckBlobResult {
 	var result CheckBlobResult
+	notChecked := func(from phase0.Slot) CheckBlobResult {
+		for slot := from; slot <= end; slot++ {
+			result.NotChecked = append(result.NotChecked, strconv.FormatUint(uint64(slot), 10))
+		}
+		if len(result.NotChecked) > 0 {
+			a.log.Warn("blob check interrupted", "checked", from-start, "notChecked", len(result.NotChecked), "err", ctx.Err())
+		}
+		return result
+	}
 
 	for slot := start; slot <= end; slot++ {
-		for _, format := range []Format{FormatJson, FormatSSZ} {
-			id := strconv.FormatUint(uint64(slot), 10)
+		if !a.checkSlot(ctx, slot, &result) {
+			return notChecked(slot)
+		}
 
-			l := a.log.New("format", format, "slot", slot)
+		// Check if we should stop validation otherwise continue
+		select {
+		case <-ctx.Done():
+			return notChecked(slot + 1)
+		default:
+			continue
+		}
+	}
 
-			blobStatus, blobResponse, blobError := fetchWithRetries(ctx, a.blobAPI, id, format)
+	return result
+}
 
-			if blobError != nil {
-				result.ErrorFetching = append(result.ErrorFetching, id)
-				l.Error(validationErrorLog, "reason", "error-blob-api", "error", blobError, "status", blobStatus)
-				continue
-			}
+// checkSlot checks that the blobs of slot from the beacon-node and blob-api are identical in each of the configured
+// formats, adding any failures to result. It returns false if ctx ended before the slot was checked in every format.
+func (a *ValidatorService) checkSlot(ctx context.Context, slot phase0.Slot, result *CheckBlobResult) bool {
+	for _, format := range a.formats {
+		id := strconv.FormatUint(uint64(slot), 10)
 
-			beaconStatus, beaconResponse, beaconErr := fetchWithRetries(ctx, a.beaconAPI, id, format)
+		l := a.log.New("format", format, "slot", slot)
+		began := time.Now()
 
-			if beaconErr != nil {
-				result.ErrorFetching = append(result.ErrorFetching, id)
-				l.Error(validationErrorLog, "reason", "error-beacon-api", "error", beaconErr, "status", beaconStatus)
-				continue
-			}
+		blobStatus, blobResponse, blobError := fetchWithRetries(ctx, a.blobAPI, id, format)
+		if interrupted(ctx, blobError) {
+			return false
+		}
+		a.metrics.RecordFetch(endpointBlobAPI, string(format), time.Since(began))
+
+		if blobclient.IsFetchError(blobError) {
+			result.ErrorFetching = append(result.ErrorFetching, id)
+			l.Error(validationErrorLog, "reason", FailureErrorBlobAPI, "status", blobStatus, "err", blobError)
+			a.metrics.RecordCheck(string(format), FailureErrorBlobAPI)
+			a.reportFailure(slot, format, FailureErrorBlobAPI, storage.BlobSidecars{}, map[string]string{"blobStatus": strconv.Itoa(blobStatus), "blobError": errDetail(blobError)})
+			continue
+		}
 
-			if beaconStatus != blobStatus {
-				result.MismatchedStatus = append(result.MismatchedStatus, id)
-				l.Error(validationErrorLog, "reason", "status-code-mismatch", "beaconStatus", beaconStatus, "blobStatus", blobStatus)
+		// The blob-api's sidecars are verified before fetching from the beacon-node, so that corruption is detected
+		// even if the beacon-node cannot be fetched from
+		if a.kzgFork != "" && blobStatus == http.StatusOK {
+			if err := verifySidecars(blobResponse.Data, a.kzgFork); err != nil {
+				result.InvalidProof = append(result.InvalidProof, id)
+				l.Error(validationErrorLog, "reason", FailureInvalidProof, "err", err)
+				a.metrics.RecordCheck(string(format), FailureInvalidProof)
+				a.reportFailure(slot, format, FailureInvalidProof, blobResponse, map[string]string{"blobError": err.Error()})
 				continue
 			}
+		}
 
-			if beaconStatus != http.StatusOK {
-				// This can happen if the slot has been missed
-				l.Info("matching error status", "beaconStatus", beaconStatus, "blobStatus", blobStatus)
-				continue
+		beaconBegan := time.Now()
+		beaconStatus, beaconResponse, beaconErr := fetchWithRetries(ctx, a.beaconAPI, id, format)
+		if interrupted(ctx, beaconErr) {
+			return false
+		}
+		a.metrics.RecordFetch(endpointBeaconNode, string(format), time.Since(beaconBegan))
 
-			}
+		if blobclient.IsFetchError(beaconErr) {
+			result.ErrorFetching = append(result.ErrorFetching, id)
+			l.Error(validationErrorLog, "reason", FailureErrorBeaconAPI, "status", beaconStatus, "err", beaconErr)
+			a.metrics.RecordCheck(string(format), FailureErrorBeaconAPI)
+			a.reportFailure(slot, format, FailureErrorBeaconAPI, storage.BlobSidecars{}, map[string]string{"beaconStatus": strconv.Itoa(beaconStatus), "beaconError": errDetail(beaconErr)})
+			continue
+		}
 
-			if !reflect.DeepEqual(beaconResponse, blobResponse) {
-				result.MismatchedData = append(result.MismatchedData, id)
-				l.Error(validationErrorLog, "reason", "response-mismatch")
-			}
+		if beaconStatus != blobStatus && a.confirmDiscrepancy(ctx, l, id, format) {
+			result.MismatchedStatus = append(result.MismatchedStatus, id)
+			l.Error(validationErrorLog, "reason", FailureStatusMismatch, "beaconStatus", beaconStatus, "blobStatus", blobStatus, "beaconError", beaconErr, "blobError", blobError)
+			a.metrics.RecordCheck(string(format), FailureStatusMismatch)
+			a.reportFailure(slot, format, FailureStatusMismatch, beaconResponse, map[string]string{
+				"beaconStatus": strconv.Itoa(beaconStatus), "blobStatus": strconv.Itoa(blobStatus),
+				"beaconError": errDetail(beaconErr), "blobError": errDetail(blobError),
+			})
+			continue
+		}
 
-			l.Info("completed blob check", "blobs", len(beaconResponse.Data))
+		if beaconStatus != blobStatus {
+			l.Info("blob-api matches quorum", "beaconStatus", beaconStatus, "blobStatus", blobStatus)
+			a.metrics.RecordCheck(string(format), CheckQuorumMatch)
+			continue
 		}
 
-		// Check if we should stop validation otherwise continue
-		select {
-		case <-ctx.Done():
-			return result
-		default:
+		if beaconStatus != http.StatusOK {
+			// This can happen if the slot has been missed
+			l.Info("matching error status", "beaconStatus", beaconStatus, "blobStatus", blobStatus, "beaconError", beaconErr, "blobError", blobError)
+			a.metrics.RecordCheck(string(format), CheckMatchingError)
 			continue
+
 		}
-	}
 
-	// Validation is complete, shutdown the app
-	a.closeApp(nil)
+		check := CheckMatch
+		if !reflect.DeepEqual(beaconResponse, blobResponse) {
+			if a.confirmDiscrepancy(ctx, l, id, format) {
+				result.MismatchedData = append(result.MismatchedData, id)
+				l.Error(validationErrorLog, "reason", FailureResponseMismatch)
+				check = FailureResponseMismatch
+				a.reportFailure(slot, format, FailureResponseMismatch, beaconResponse, map[string]string{
+					"beaconBlobs": strconv.Itoa(len(beaconResponse.Data)), "blobBlobs": strconv.Itoa(len(blobResponse.Data)),
+				})
+			} else {
+				l.Info("blob-api matches quorum")
+				check = CheckQuorumMatch
+			}
+		}
+		a.metrics.RecordCheck(string(format), check)
 
-	return result
+		l.Info("completed blob check", "blobs", len(beaconResponse.Data), "duration", time.Since(began))
+	}
+
+	return true
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobclient"
+	"github.com/base-org/blob-archiver/common/blobformat"
 	"github.com/base-org/blob-archiver/common/blobtest"
 	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
@@ -35,7 +37,7 @@ type stubBlobSidecarClient struct {
 func (s *stubBlobSidecarClient) setResponses(sbc *beacontest.StubBeaconClient) {
 	for k, v := range sbc.Blobs {
 		s.data[k] = response{
-			data:       storage.BlobSidecars{Data: v},
+			data:       storage.BlobSidecars{Data: storage.FromDenebSidecars(v)},
 			err:        nil,
 			statusCode: 200,
 		}
@@ -51,7 +53,7 @@ func (s *stubBlobSidecarClient) setResponse(id string, statusCode int, data stor
 	}
 }
 
-func (s *stubBlobSidecarClient) FetchSidecars(id string, format Format) (int, storage.BlobSidecars, error) {
+func (s *stubBlobSidecarClient) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
 	response, ok := s.data[id]
 	if !ok {
 		return 0, storage.BlobSidecars{}, fmt.Errorf("not found")
@@ -127,7 +129,7 @@ func TestValidatorService_CompletelyDifferentBlobData(t *testing.T) {
 	beacon.setResponses(headers)
 	blob.setResponses(headers)
 	blob.setResponse(blockOne, 200, storage.BlobSidecars{
-		Data: blobtest.NewBlobSidecars(t, 1),
+		Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1)),
 	}, nil)
 
 	result := validator.checkBlobs(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
@@ -142,41 +144,41 @@ func TestValidatorService_CompletelyDifferentBlobData(t *testing.T) {
 func TestValidatorService_MistmatchedBlobFields(t *testing.T) {
 	tests := []struct {
 		name         string
-		modification func(i *[]*deneb.BlobSidecar)
+		modification func(i *[]*storage.BlobSidecar)
 	}{
 		{
 			name: "mismatched index",
-			modification: func(i *[]*deneb.BlobSidecar) {
+			modification: func(i *[]*storage.BlobSidecar) {
 				(*i)[0].Index = deneb.BlobIndex(9)
 			},
 		},
 		{
 			name: "mismatched blob",
-			modification: func(i *[]*deneb.BlobSidecar) {
+			modification: func(i *[]*storage.BlobSidecar) {
 				(*i)[0].Blob = deneb.Blob{0, 0, 0}
 			},
 		},
 		{
 			name: "mismatched kzg commitment",
-			modification: func(i *[]*deneb.BlobSidecar) {
+			modification: func(i *[]*storage.BlobSidecar) {
 				(*i)[0].KZGCommitment = deneb.KZGCommitment{0, 0, 0}
 			},
 		},
 		{
 			name: "mismatched kzg proof",
-			modification: func(i *[]*deneb.BlobSidecar) {
+			modification: func(i *[]*storage.BlobSidecar) {
 				(*i)[0].KZGProof = deneb.KZGProof{0, 0, 0}
 			},
 		},
 		{
 			name: "mismatched signed block header",
-			modification: func(i *[]*deneb.BlobSidecar) {
+			modification: func(i *[]*storage.BlobSidecar) {
 				(*i)[0].SignedBlockHeader = nil
 			},
 		},
 		{
 			name: "mismatched kzg commitment inclusion proof",
-			modification: func(i *[]*deneb.BlobSidecar) {
+			modification: func(i *[]*storage.BlobSidecar) {
 				(*i)[0].KZGCommitmentInclusionProof = deneb.KZGCommitmentInclusionProof{{1, 2, 9}}
 			},
 		},
@@ -193,7 +195,7 @@ func TestValidatorService_MistmatchedBlobFields(t *testing.T) {
 			// Deep copy the blob data
 			d, err := json.Marshal(headers.Blobs[blockOne])
 			require.NoError(t, err)
-			var c []*deneb.BlobSidecar
+			var c []*storage.BlobSidecar
 			err = json.Unmarshal(d, &c)
 			require.NoError(t, err)
 
@@ -213,3 +215,78 @@ func TestValidatorService_MistmatchedBlobFields(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatorService_MatchingStatusErrors(t *testing.T) {
+	validator, headers, beacon, blob := setup(t)
+
+	// Both endpoints describe the missing block with an error body
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+	beacon.setResponse(blockOne, 404, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: 404, Message: "Block not found"})
+	blob.setResponse(blockOne, 404, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: 404, Message: "not found"})
+
+	result := validator.checkBlobs(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+
+	require.Empty(t, result.ErrorFetching)
+	require.Empty(t, result.MismatchedStatus)
+	require.Empty(t, result.MismatchedData)
+}
+
+// countingClient counts the fetches made through it, responding to the first unavailable of them with a 503.
+type countingClient struct {
+	blobclient.BlobSidecarClient
+	fetches     int
+	unavailable int
+}
+
+func (c *countingClient) FetchSidecars(id string, format blobformat.Format) (int, storage.BlobSidecars, error) {
+	c.fetches++
+	if c.fetches <= c.unavailable {
+		return 503, storage.BlobSidecars{}, &blobclient.StatusError{StatusCode: 503}
+	}
+	return c.BlobSidecarClient.FetchSidecars(id, format)
+}
+
+func TestFetchWithRetries_ReturnsStatusError(t *testing.T) {
+	_, headers, beacon, _ := setup(t)
+	beacon.setResponses(headers)
+	notFound := &blobclient.StatusError{StatusCode: 404, Message: "Block not found"}
+	beacon.setResponse(blockOne, 404, storage.BlobSidecars{}, notFound)
+	client := &countingClient{BlobSidecarClient: beacon}
+
+	// An error status is the response of the endpoint, it is returned without retrying
+	status, sidecars, err := fetchWithRetries(context.Background(), client, blockOne, blobformat.JSON)
+	require.Equal(t, 404, status)
+	require.Empty(t, sidecars.Data)
+	require.Same(t, notFound, err)
+	require.Equal(t, 1, client.fetches)
+
+	// A retryable status is retried until the endpoint responds
+	beacon.setResponses(headers)
+	client = &countingClient{BlobSidecarClient: beacon, unavailable: 1}
+	status, sidecars, err = fetchWithRetries(context.Background(), client, blockOne, blobformat.JSON)
+	require.NoError(t, err)
+	require.Equal(t, 200, status)
+	require.NotEmpty(t, sidecars.Data)
+	require.Equal(t, 2, client.fetches)
+}
+
+// retryingClient is a countingClient that reports it retries failed requests itself.
+type retryingClient struct {
+	*countingClient
+}
+
+func (c retryingClient) Retries() bool {
+	return true
+}
+
+func TestFetchWithRetries_ClientRetries(t *testing.T) {
+	_, headers, beacon, _ := setup(t)
+	beacon.setResponses(headers)
+	client := &countingClient{BlobSidecarClient: beacon, unavailable: 1}
+
+	// The retries are left to the client, so its last response is returned
+	_, _, err := fetchWithRetries(context.Background(), retryingClient{client}, blockOne, blobformat.JSON)
+	require.ErrorContains(t, err, "retryable status code: 503")
+	require.Equal(t, 1, client.fetches)
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The types of validation failure, which are also the reasons given by the validation error log.
+const (
+	FailureErrorBlobAPI     = "error-blob-api"
+	FailureErrorBeaconAPI   = "error-beacon-api"
+	FailureStatusMismatch   = "status-code-mismatch"
+	FailureResponseMismatch = "response-mismatch"
+	FailureInvalidProof     = "invalid-proof"
+)
+
+// ValidationFailure is the JSON body posted to a webhook when a slot fails validation.
+type ValidationFailure struct {
+	Slot uint64 `json:"slot"`
+	// Root is the root of the block, if the beacon-node returned its sidecars
+	Root   string            `json:"root,omitempty"`
+	Format blobformat.Format `json:"format"`
+	// Type is the type of failure, see FailureResponseMismatch
+	Type string `json:"type"`
+	// Details are the statuses and errors of the responses that failed, as in the validation error log
+	Details map[string]string `json:"details,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// WebhookConfig configures the delivery of validation failures to a webhook.
+type WebhookConfig struct {
+	// Timeout is the timeout of each attempt to post a failure
+	Timeout time.Duration
+	// Attempts is the number of times a failure is posted before it is dropped
+	Attempts int
+	// DedupWindow is the time for which further failures of a slot are not posted after the first, so that a slot
+	// that fails in every format, or on every run, does not flood the receiver. Every failure is posted if it is 0.
+	DedupWindow time.Duration
+}
+
+// WithWebhook configures the validator to post each validation failure to url as a ValidationFailure, so that it can
+// page on-call or feed an incident system. Failures are posted in the background and do not slow validation, and the
+// validator waits for them to be delivered when it is stopped.
+func (a *ValidatorService) WithWebhook(url string, cfg WebhookConfig) {
+	a.webhook = newWebhook(url, cfg, a.log.New("component", "webhook"))
+}
+
+// webhook posts validation failures to a URL, retrying failed posts and dropping repeated failures of a slot.
+type webhook struct {
+	url         string
+	client      *http.Client
+	attempts    int
+	strategy    retry.Strategy
+	dedupWindow time.Duration
+	log         log.Logger
+	now         func() time.Time
+
+	mu sync.Mutex
+	// posted holds when a failure of each slot was last posted, within the dedup window
+	posted  map[uint64]time.Time
+	pending sync.WaitGroup
+}
+
+func newWebhook(url string, cfg WebhookConfig, l log.Logger) *webhook {
+	return &webhook{
+		url:         url,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		attempts:    max(cfg.Attempts, 1),
+		strategy:    retry.Exponential(),
+		dedupWindow: cfg.DedupWindow,
+		log:         l,
+		now:         time.Now,
+		posted:      make(map[uint64]time.Time),
+	}
+}
+
+// notify posts failure in the background, unless a failure of the same slot was posted within the dedup window.
+func (w *webhook) notify(failure ValidationFailure) {
+	now := w.now()
+	failure.Time = now
+
+	w.mu.Lock()
+	for slot, at := range w.posted {
+		if now.Sub(at) >= w.dedupWindow {
+			delete(w.posted, slot)
+		}
+	}
+	if _, ok := w.posted[failure.Slot]; ok {
+		w.mu.Unlock()
+		w.log.Debug("dropping repeated failure", "slot", failure.Slot, "type", failure.Type)
+		return
+	}
+	if w.dedupWindow > 0 {
+		w.posted[failure.Slot] = now
+	}
+	w.mu.Unlock()
+
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		if err := w.deliver(failure); err != nil {
+			w.log.Error("failed to post failure to webhook", "slot", failure.Slot, "type", failure.Type, "err", err)
+		}
+	}()
+}
+
+// deliver posts failure, retrying up to the configured number of attempts. It is not tied to the validation context,
+// so that the failures found before the validator is stopped are still delivered.
+func (w *webhook) deliver(failure ValidationFailure) error {
+	body, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+
+	_, err = retry.Do(context.Background(), w.attempts, w.strategy, func() (struct{}, error) {
+		return struct{}{}, w.post(body)
+	})
+	return err
+}
+
+func (w *webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// wait waits for the failures being posted to be delivered, or for ctx to end.
+func (w *webhook) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reportFailure posts a validation failure to the webhook, if one is configured. sidecars are the beacon-node's
+// response, or the blob-api's for a failure of its own sidecars, which the root of the block is taken from if it has
+// any.
+func (a *ValidatorService) reportFailure(slot phase0.Slot, format blobformat.Format, failureType string, sidecars storage.BlobSidecars, details map[string]string) {
+	if a.webhook == nil {
+		return
+	}
+
+	failure := ValidationFailure{Slot: uint64(slot), Format: format, Type: failureType, Details: details}
+	if len(sidecars.Data) > 0 && sidecars.Data[0].SignedBlockHeader != nil && sidecars.Data[0].SignedBlockHeader.Message != nil {
+		if root, err := sidecars.Data[0].SignedBlockHeader.Message.HashTreeRoot(); err == nil {
+			failure.Root = common.Hash(root).String()
+		}
+	}
+	a.webhook.notify(failure)
+}
+
+// errDetail returns the message of err, or an empty string if it is nil.
+func errDetail(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobformat"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer records the failures posted to it, responding to the first fails posts with a 500.
+type webhookServer struct {
+	mu       sync.Mutex
+	fails    int
+	posts    int
+	failures []ValidationFailure
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.posts++
+	if s.posts <= s.fails {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var failure ValidationFailure
+	if err := json.NewDecoder(r.Body).Decode(&failure); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.failures = append(s.failures, failure)
+}
+
+func (s *webhookServer) received() (int, []ValidationFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts, append([]ValidationFailure{}, s.failures...)
+}
+
+func testWebhook(t *testing.T, url string, cfg WebhookConfig) *webhook {
+	w := newWebhook(url, cfg, testlog.Logger(t, log.LvlInfo))
+	w.strategy = retry.Fixed(time.Millisecond)
+	return w
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	server := &webhookServer{fails: 2}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	w := testWebhook(t, srv.URL, WebhookConfig{Timeout: time.Second, Attempts: 3})
+	w.notify(ValidationFailure{Slot: 10, Format: blobformat.SSZ, Type: FailureResponseMismatch, Details: map[string]string{"beaconBlobs": "2"}})
+	require.NoError(t, w.wait(context.Background()))
+
+	posts, failures := server.received()
+	require.Equal(t, 3, posts)
+	require.Len(t, failures, 1)
+	require.Equal(t, uint64(10), failures[0].Slot)
+	require.Equal(t, FailureResponseMismatch, failures[0].Type)
+	require.Equal(t, "2", failures[0].Details["beaconBlobs"])
+	require.False(t, failures[0].Time.IsZero())
+}
+
+func TestWebhook_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w := testWebhook(t, srv.URL, WebhookConfig{Timeout: 20 * time.Millisecond, Attempts: 2})
+	err := w.deliver(ValidationFailure{Slot: 10})
+	require.ErrorContains(t, err, "Client.Timeout")
+}
+
+func TestWebhook_Dedup(t *testing.T) {
+	server := &webhookServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	w := testWebhook(t, srv.URL, WebhookConfig{Timeout: time.Second, Attempts: 1, DedupWindow: time.Hour})
+	now := time.Unix(1_700_000_000, 0)
+	w.now = func() time.Time { return now }
+
+	w.notify(ValidationFailure{Slot: 10, Format: blobformat.JSON, Type: FailureResponseMismatch})
+	w.notify(ValidationFailure{Slot: 10, Format: blobformat.SSZ, Type: FailureResponseMismatch})
+	w.notify(ValidationFailure{Slot: 11, Format: blobformat.JSON, Type: FailureStatusMismatch})
+	require.NoError(t, w.wait(context.Background()))
+	posts, _ := server.received()
+	require.Equal(t, 2, posts)
+
+	// The slot is posted again once the window has passed
+	now = now.Add(time.Hour)
+	w.notify(ValidationFailure{Slot: 10, Format: blobformat.JSON, Type: FailureResponseMismatch})
+	require.NoError(t, w.wait(context.Background()))
+	posts, _ = server.received()
+	require.Equal(t, 3, posts)
+}
+
+func TestValidatorService_Webhook(t *testing.T) {
+	server := &webhookServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	validator, headers, beacon, blob := setup(t)
+	validator.WithWebhook(srv.URL, WebhookConfig{Timeout: time.Second, Attempts: 1, DedupWindow: time.Hour})
+
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+	blob.setResponse(blockOne, 200, storage.BlobSidecars{Data: storage.FromDenebSidecars(blobtest.NewBlobSidecars(t, 1))}, nil)
+
+	result := validator.checkBlobs(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Len(t, result.MismatchedData, 2)
+	require.NoError(t, validator.Stop(context.Background()))
+
+	// The mismatch in the second format is a repeat of the first
+	_, failures := server.received()
+	require.Len(t, failures, 1)
+	require.Equal(t, blobtest.StartSlot+1, failures[0].Slot)
+	require.Equal(t, blobformat.JSON, failures[0].Format)
+	require.Equal(t, FailureResponseMismatch, failures[0].Type)
+	require.Equal(t, "1", failures[0].Details["blobBlobs"])
+
+	root, err := headers.Blobs[blockOne][0].SignedBlockHeader.Message.HashTreeRoot()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Root(root).String(), failures[0].Root)
+}